@@ -0,0 +1,13 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/analytics"
+	"encoding/json"
+	"net/http"
+)
+
+// handleAnalyticsStatus reports how the analytics stream is doing.
+func handleAnalyticsStatus(w http.ResponseWriter, r *http.Request, stream *analytics.Stream) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stream.Status())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/backup"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+func handleListBackups(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	manifests, err := coordinator.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifests)
+}
+
+func handleCreateBackup(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	manifest, err := coordinator.Run()
+	if err == nil && r.URL.Query().Get("collect") == "true" {
+		manifest, err = coordinator.Collect(manifest.ID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func handleGetBackup(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	manifest, err := coordinator.Get(pathVar(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func handleCollectBackup(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	manifest, err := coordinator.Collect(pathVar(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// handleDownloadSnapshot serves a snapshot file as stored, checksum header
+// included. ServeContent copies the file to the connection with
+// sendfile(2) where the platform supports it.
+func handleDownloadSnapshot(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	id := pathVar(r, "id")
+	file, err := coordinator.OpenSnapshot(id, r.URL.Query().Get("node"))
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"-"+filepath.Base(file.Name())))
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func handleRestoreBackup(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	manifest, err := coordinator.Restore(pathVar(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func handlePointInTimeRestore(w http.ResponseWriter, r *http.Request, coordinator *backup.Coordinator) {
+	asOf, err := time.Parse(time.RFC3339, r.URL.Query().Get("as_of"))
+	if err != nil {
+		http.Error(w, "Invalid as_of, expected an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	report, err := coordinator.RestoreTo(asOf, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), backupErrorStatus(err))
+		return
+	}
+	if !dryRun {
+		log.Printf("Restored cache %s", report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func backupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, backup.ErrNotLeader), errors.Is(err, backup.ErrInProgress):
+		return http.StatusConflict
+	case errors.Is(err, backup.ErrNotFound), errors.Is(err, backup.ErrNoHistory):
+		return http.StatusNotFound
+	case errors.Is(err, backup.ErrInvalidID):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
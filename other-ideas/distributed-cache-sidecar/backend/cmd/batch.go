@@ -0,0 +1,155 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxBatchKeys bounds the keys one batch request may name.
+const maxBatchKeys = 1000
+
+// handleBatchSet stores every item the request lists or, if any can't be
+// stored, none of them, and answers with the version each key was stored
+// at. Peers receive the items together in one replication frame.
+func handleBatchSet(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	var request struct {
+		Items []struct {
+			Key      string            `json:"key"`
+			Value    json.RawMessage   `json:"value"`
+			TTL      int64             `json:"ttl"`
+			Sliding  bool              `json:"sliding"`
+			Encoding string            `json:"encoding"`
+			Metadata map[string]string `json:"metadata"`
+			Tags     []string          `json:"tags"`
+		} `json:"items"`
+		Consistency string `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Items) == 0 {
+		http.Error(w, "items must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(request.Items) > maxBatchKeys {
+		http.Error(w, fmt.Sprintf("at most %d items may be written at once", maxBatchKeys), http.StatusBadRequest)
+		return
+	}
+	consistency, err := cache.ParseConsistency(request.Consistency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries := make([]cache.BatchEntry, len(request.Items))
+	for i, item := range request.Items {
+		if item.Key == "" {
+			http.Error(w, fmt.Sprintf("item %d has no key", i), http.StatusBadRequest)
+			return
+		}
+		value, encoding, err := requestValue(item.Value, item.Encoding)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", item.Key, err), http.StatusBadRequest)
+			return
+		}
+		key, err := namespaced(r, item.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries[i] = cache.BatchEntry{
+			Key:   key,
+			Value: value,
+			Options: cache.WriteOptions{
+				TTL:      time.Duration(item.TTL) * time.Second,
+				Sliding:  item.Sliding,
+				Encoding: encoding,
+				Metadata: item.Metadata,
+				Tags:     item.Tags,
+			},
+		}
+	}
+
+	items, err := cacheManager.WriteBatch(r.Context(), entries, consistency)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	versions := make(map[string]uint64, len(items))
+	for i, item := range items {
+		versions[request.Items[i].Key] = item.Version
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"versions": versions,
+	})
+}
+
+// handleBatchGet reads every key the request lists and answers with the
+// items found, the keys that are missing or expired, and why any other
+// key couldn't be read, such as one this node doesn't own.
+func handleBatchGet(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
+	var request struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Keys) == 0 {
+		http.Error(w, "keys must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(request.Keys) > maxBatchKeys {
+		http.Error(w, fmt.Sprintf("at most %d keys may be read at once", maxBatchKeys), http.StatusBadRequest)
+		return
+	}
+
+	items := make(map[string]*itemResponse, len(request.Keys))
+	missing := []string{}
+	failed := make(map[string]string)
+	seen := make(map[string]bool, len(request.Keys))
+	for _, key := range request.Keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		stored, err := namespaced(r, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		item, err := cacheManager.Read(r.Context(), stored, cache.ReadOptions{})
+		if errors.Is(err, cache.ErrNotFound) {
+			if ownerErr := peerManager.CheckOwner(stored); ownerErr != nil {
+				err = ownerErr
+			}
+		}
+		switch {
+		case err == nil:
+			items[key] = newItemResponse(cacheManager, item)
+		case errors.Is(err, cache.ErrNotFound), errors.Is(err, cache.ErrExpired):
+			missing = append(missing, key)
+		default:
+			failed[key] = err.Error()
+		}
+	}
+
+	response := map[string]interface{}{
+		"items":   items,
+		"missing": missing,
+	}
+	if len(failed) > 0 {
+		response["errors"] = failed
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/changefeed"
+	"encoding/json"
+	"net/http"
+)
+
+// handleChangeFeedStatus reports how publishing changes is going.
+func handleChangeFeedStatus(w http.ResponseWriter, r *http.Request, feed *changefeed.Feed) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feed.Status())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// handleInitiateUpload starts a multipart upload of a large object to key
+// and answers with the upload ID its parts are sent under.
+func handleInitiateUpload(w http.ResponseWriter, r *http.Request) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"key":       key,
+		"upload_id": hex.EncodeToString(id),
+	})
+}
+
+// uploadID parses the upload ID of an upload request.
+func uploadID(r *http.Request) (string, error) {
+	upload := mux.Vars(r)["upload"]
+	if upload == "" || strings.Trim(upload, "0123456789abcdef") != "" {
+		return "", errors.New("invalid upload ID")
+	}
+	return upload, nil
+}
+
+// uploadPart parses the upload ID and part number of a part request.
+func uploadPart(r *http.Request) (string, int, error) {
+	upload, err := uploadID(r)
+	if err != nil {
+		return "", 0, err
+	}
+	part, err := strconv.Atoi(mux.Vars(r)["part"])
+	if err != nil || part < 1 {
+		return "", 0, errors.New("part numbers start at 1")
+	}
+	return upload, part, nil
+}
+
+// handleUploadPart stores the request body as one part of an upload. The
+// optional ttl query parameter, in seconds, should be the TTL the object
+// is completed with.
+func handleUploadPart(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upload, part, err := uploadPart(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var options cache.WriteOptions
+	if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+		seconds, err := strconv.ParseInt(ttl, 10, 64)
+		if err != nil || seconds < 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		options.TTL = time.Duration(seconds) * time.Second
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cacheManager.WritePart(r.Context(), key, upload, part, data, options); err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"part":   part,
+		"size":   len(data),
+	})
+}
+
+// handleCompleteUpload stores the manifest that makes an upload's parts,
+// in the order the request lists them, readable as the object under key.
+func handleCompleteUpload(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upload, err := uploadID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Parts       []int             `json:"parts"`
+		TTL         int64             `json:"ttl"`
+		Metadata    map[string]string `json:"metadata"`
+		Consistency string            `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Parts) == 0 {
+		http.Error(w, "parts must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{
+		TTL:      time.Duration(request.TTL) * time.Second,
+		Metadata: request.Metadata,
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := cacheManager.CompleteUpload(r.Context(), key, upload, request.Parts, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"version": item.Version,
+	})
+}
+
+// writeLargeObject streams the parts of the large object whose manifest
+// is item, decoding one part at a time.
+func writeLargeObject(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, item *cache.CacheItem) {
+	manifest, parts, err := cacheManager.Parts(r.Context(), item)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(manifest.Size, 10))
+	w.Header().Set("X-Cache-Parts", strconv.Itoa(len(parts)))
+	w.Header().Set("Accept-Ranges", "bytes")
+	for _, part := range parts {
+		if _, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, strings.NewReader(part.Value))); err != nil {
+			log.Printf("Streaming %s stopped: %v", item.Key, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/persistence"
+	"distributed-cache-sidecar/internal/version"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"serve", "[--validate-config path]", "Run the sidecar (the default when no command is given)", runServe},
+		{"snapshot", "[--addr url] file", "Save a running node's cache to a snapshot file", runSnapshot},
+		{"restore", "[--addr url] file", "Replace a running node's cache with a snapshot file", runRestore},
+		{"export", "[--addr url] [file]", "Write a running node's items as NDJSON (default stdout)", runExport},
+		{"import", "[--addr url] [file]", "Set every item in an NDJSON export (default stdin) through the cache API", runImport},
+		{"selftest", "[--run name] [-v] [--simulate runs]", "Run the in-process multi-node integration scenarios", runSelftest},
+		{"verify", "[--addr url] [--keys n] [--sla duration]", "Write test keys across the cluster and report nodes that don't converge", runVerify},
+		{"validate-config", "[path]", "Check a config file and print a JSON report (default CONFIG_FILE)", runValidateConfig},
+		{"version", "[--json]", "Print build information", runVersion},
+	}
+}
+
+// main dispatches to a subcommand. Without one the binary serves, so
+// existing images and scripts that run it bare keep working.
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		os.Exit(runServe(args))
+	}
+	if args[0] == "help" {
+		usage(os.Stdout)
+		return
+	}
+
+	for _, command := range subcommands {
+		if command.name == args[0] {
+			os.Exit(command.run(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, command := range subcommands {
+		fmt.Fprintf(w, "  %-16s %s\n  %-16s   %s\n", command.name, command.args, "", command.summary)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	for _, command := range subcommands {
+		if command.name == name {
+			command := command
+			fs.Usage = func() {
+				fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n", os.Args[0], name, command.args, command.summary)
+				fs.PrintDefaults()
+			}
+		}
+	}
+	return fs
+}
+
+func runServe(args []string) int {
+	fs := newFlagSet("serve")
+	validateConfigPath := fs.String("validate-config", "", "validate the config file at `path`, print a JSON report and exit")
+	fs.Parse(args)
+
+	if *validateConfigPath != "" {
+		return validateConfig(*validateConfigPath)
+	}
+	serve()
+	return 0
+}
+
+func runValidateConfig(args []string) int {
+	fs := newFlagSet("validate-config")
+	fs.Parse(args)
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	return validateConfig(path)
+}
+
+func runVersion(args []string) int {
+	fs := newFlagSet("version")
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	info := version.Get()
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(struct {
+			version.Info
+			MinProtocol int `json:"min_protocol_version"`
+			MaxProtocol int `json:"max_protocol_version"`
+		}{info, network.MinProtocolVersion, network.ProtocolVersion})
+		return 0
+	}
+	fmt.Printf("%s (commit %s, built %s, %s, peer protocol %d-%d)\n",
+		info.Version, info.GitCommit, info.BuildDate, info.GoVersion, network.MinProtocolVersion, network.ProtocolVersion)
+	return 0
+}
+
+// adminFlagSet returns a flag set with --addr, which defaults to the HTTP
+// port from the local configuration so commands run inside the sidecar's
+// container need no arguments.
+func adminFlagSet(name string) (*flag.FlagSet, *string) {
+	port := 8080
+	if cfg, err := config.Load(); err == nil {
+		port = cfg.HTTPPort
+	}
+
+	fs := newFlagSet(name)
+	addr := fs.String("addr", fmt.Sprintf("http://localhost:%d", port), "base `url` of the sidecar")
+	return fs, addr
+}
+
+func runSnapshot(args []string) int {
+	fs, addr := adminFlagSet("snapshot")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var snapshot persistence.Snapshot
+	if err := adminRequest(http.MethodGet, *addr, "/api/admin/snapshot", nil, &snapshot); err != nil {
+		return fail(err)
+	}
+	if err := persistence.WriteSnapshot(fs.Arg(0), &snapshot); err != nil {
+		return fail(err)
+	}
+
+	fmt.Printf("Wrote %d items from node %s (sequence %d) to %s\n", len(snapshot.Items), snapshot.NodeID, snapshot.Sequence, fs.Arg(0))
+	return 0
+}
+
+func runRestore(args []string) int {
+	fs, addr := adminFlagSet("restore")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	snapshot, loadedFrom, err := persistence.LoadSnapshot(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	if loadedFrom != fs.Arg(0) {
+		fmt.Fprintf(os.Stderr, "%s is unusable, restoring from %s\n", fs.Arg(0), loadedFrom)
+	}
+
+	var result struct {
+		Items int `json:"items"`
+	}
+	if err := adminRequest(http.MethodPut, *addr, "/api/admin/snapshot", snapshot, &result); err != nil {
+		return fail(err)
+	}
+
+	fmt.Printf("Restored %d items from %s\n", result.Items, loadedFrom)
+	return 0
+}
+
+// exportEntry is one line of an export. TTL is the time the item had left
+// when it was exported, so an import doesn't extend expired data.
+type exportEntry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	TTL      int64  `json:"ttl,omitempty"`
+	Sliding  bool   `json:"sliding,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func runExport(args []string) int {
+	fs, addr := adminFlagSet("export")
+	fs.Parse(args)
+
+	var snapshot persistence.Snapshot
+	if err := adminRequest(http.MethodGet, *addr, "/api/admin/snapshot", nil, &snapshot); err != nil {
+		return fail(err)
+	}
+	sort.Slice(snapshot.Items, func(i, j int) bool { return snapshot.Items[i].Key < snapshot.Items[j].Key })
+
+	out := os.Stdout
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := bufio.NewWriter(out)
+	encoder := json.NewEncoder(w)
+	exported := 0
+	for _, item := range snapshot.Items {
+		ttl, live := remainingTTL(item, snapshot.CreatedAt)
+		if !live {
+			continue
+		}
+		encoder.Encode(exportEntry{Key: item.Key, Value: item.Value, TTL: ttl, Sliding: item.Sliding, Encoding: item.Encoding})
+		exported++
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d items from node %s\n", exported, snapshot.NodeID)
+	return 0
+}
+
+func remainingTTL(item *cache.CacheItem, at time.Time) (int64, bool) {
+	if item.TTL <= 0 {
+		return 0, true
+	}
+	remaining := int64(item.ExpiresAt().Sub(at) / time.Second)
+	return remaining, remaining > 0
+}
+
+// runImport sets each entry through the normal write path, so key
+// policies, schemas and replication apply exactly as for API clients.
+func runImport(args []string) int {
+	fs, addr := adminFlagSet("import")
+	fs.Parse(args)
+
+	in := os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	imported, failed := 0, 0
+	reader := bufio.NewReader(in)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var entry exportEntry
+			if jsonErr := json.Unmarshal(data, &entry); jsonErr != nil {
+				fmt.Fprintf(os.Stderr, "line %d: %v\n", line, jsonErr)
+				failed++
+			} else if setErr := adminRequest(http.MethodPost, *addr, "/api/cache/"+url.PathEscape(entry.Key), map[string]interface{}{
+				"value":    entry.Value,
+				"ttl":      entry.TTL,
+				"sliding":  entry.Sliding,
+				"encoding": entry.Encoding,
+			}, nil); setErr != nil {
+				fmt.Fprintf(os.Stderr, "line %d (%s): %v\n", line, entry.Key, setErr)
+				failed++
+			} else {
+				imported++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d items, %d failed\n", imported, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+var adminClient = &http.Client{Timeout: 5 * time.Minute}
+
+func adminRequest(method, addr, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(addr, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := adminClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(resp.Status + ": " + strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
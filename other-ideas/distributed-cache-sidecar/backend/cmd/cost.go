@@ -0,0 +1,14 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"net/http"
+)
+
+// handleCostEstimate answers with the egress cost of the replication
+// traffic this node has sent, by peer, projected over a month.
+func handleCostEstimate(w http.ResponseWriter, r *http.Request, peerManager *network.PeerManager) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peerManager.CostEstimate())
+}
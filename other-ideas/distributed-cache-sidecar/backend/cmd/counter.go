@@ -0,0 +1,64 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// handleIncrementCache adds the request's delta, 1 by default, to the
+// counter under key, or subtracts it when sign is -1, and answers with
+// the new value.
+func handleIncrementCache(w http.ResponseWriter, r *http.Request, peerManager *network.PeerManager, sign int64) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := struct {
+		Delta       int64             `json:"delta"`
+		TTL         int64             `json:"ttl"`
+		Sliding     bool              `json:"sliding"`
+		Metadata    map[string]string `json:"metadata"`
+		LocalOnly   bool              `json:"local_only"`
+		Consistency string            `json:"consistency"`
+	}{Delta: 1}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{
+		TTL:       time.Duration(request.TTL) * time.Second,
+		Sliding:   request.Sliding,
+		Metadata:  request.Metadata,
+		LocalOnly: request.LocalOnly,
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var item *cache.CacheItem
+	if sign < 0 {
+		item, err = peerManager.Decrement(r.Context(), key, request.Delta, options)
+	} else {
+		item, err = peerManager.Increment(r.Context(), key, request.Delta, options)
+	}
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"value":   json.RawMessage(item.Value),
+		"version": item.Version,
+	})
+}
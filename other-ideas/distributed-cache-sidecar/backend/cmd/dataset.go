@@ -0,0 +1,102 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/dataset"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// handlePublishDataset stores a version of a dataset, signed by the
+// publisher or, without a signature, by this node.
+func handlePublishDataset(w http.ResponseWriter, r *http.Request, store *dataset.Store) {
+	var request struct {
+		Version   string          `json:"version"`
+		Value     json.RawMessage `json:"value"`
+		Encoding  string          `json:"encoding"`
+		KeyID     string          `json:"key_id"`
+		Signature string          `json:"signature"`
+		TTL       int64           `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	value, encoding, err := requestValue(request.Value, request.Encoding)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := pathVar(r, "name")
+	item, err := store.Publish(r.Context(), name, request.Version, value, encoding, request.KeyID, request.Signature, time.Duration(request.TTL)*time.Second)
+	if err != nil {
+		if status := datasetErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "published",
+		"name":      name,
+		"version":   item.Metadata[dataset.VersionMetadata],
+		"key_id":    item.Metadata[dataset.KeyIDMetadata],
+		"signature": item.Metadata[dataset.SignatureMetadata],
+	})
+}
+
+// handleGetDataset answers with a dataset once its signature verifies.
+func handleGetDataset(w http.ResponseWriter, r *http.Request, store *dataset.Store, peerManager *network.PeerManager) {
+	name := pathVar(r, "name")
+	published, err := store.Get(r.Context(), name)
+	if errors.Is(err, cache.ErrNotFound) {
+		if ownerErr := peerManager.CheckOwner(dataset.Key(name)); ownerErr != nil {
+			err = ownerErr
+		}
+	}
+	if err != nil {
+		if datasetErrorStatus(err) != 0 {
+			// The copy held here can't be trusted, whoever asks.
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	var value interface{} = published.Value
+	if published.Encoding == codec.EncodingJSON {
+		value = json.RawMessage(published.Value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":       published.Name,
+		"version":    published.Version,
+		"key_id":     published.KeyID,
+		"signature":  published.Signature,
+		"encoding":   published.Encoding,
+		"value":      value,
+		"updated_at": published.UpdatedAt,
+	})
+}
+
+// datasetErrorStatus returns the status for a dataset that failed
+// verification, or 0 for other errors.
+func datasetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, dataset.ErrNoVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, dataset.ErrUnsigned), errors.Is(err, dataset.ErrUntrustedKey), errors.Is(err, dataset.ErrBadSignature):
+		return http.StatusForbidden
+	}
+	return 0
+}
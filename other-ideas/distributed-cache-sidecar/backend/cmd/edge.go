@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"distributed-cache-sidecar/internal/analytics"
+	"distributed-cache-sidecar/internal/edge"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleEdgeAsset serves a file of the frontend bundle.
+func handleEdgeAsset(w http.ResponseWriter, r *http.Request, edgeCache *edge.Cache) {
+	// API paths no route matched aren't assets.
+	if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	asset, err := edgeCache.Get(r.Context(), r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), edgeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("ETag", asset.ETag)
+	w.Header().Set("X-Deploy-Version", asset.Version)
+	if asset.Immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	analytics.SetOutcome(r, asset.Cached)
+	if asset.Cached {
+		w.Header().Set("X-Edge-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Edge-Cache", "MISS")
+	}
+	http.ServeContent(w, r, asset.Name, time.Time{}, bytes.NewReader(asset.Body))
+}
+
+// handleEdgeStatus answers with the origin, the deploy being served and
+// the assets this node holds per deploy version.
+func handleEdgeStatus(w http.ResponseWriter, r *http.Request, edgeCache *edge.Cache) {
+	deploy, err := edgeCache.Current(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), edgeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"origin":   edgeCache.Origin(),
+		"deploy":   deploy,
+		"versions": edgeCache.Stats(),
+	})
+}
+
+// handleEdgeDeploy switches every node to the assets of a deploy version.
+func handleEdgeDeploy(w http.ResponseWriter, r *http.Request, edgeCache *edge.Cache) {
+	var request struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	deploy, err := edgeCache.Deploy(r.Context(), request.Version)
+	if err != nil {
+		http.Error(w, err.Error(), edgeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deploy)
+}
+
+// handleEdgePurge deletes the cached assets of a deploy version.
+func handleEdgePurge(w http.ResponseWriter, r *http.Request, edgeCache *edge.Cache) {
+	version := pathVar(r, "version")
+	deleted, err := edgeCache.Purge(r.Context(), version)
+	if err != nil {
+		http.Error(w, err.Error(), edgeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": version,
+		"deleted": deleted,
+	})
+}
+
+// edgeErrorStatus maps edge cache errors to HTTP statuses.
+func edgeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, edge.ErrInvalidPath), errors.Is(err, edge.ErrInvalidVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, edge.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, edge.ErrOrigin):
+		return http.StatusBadGateway
+	}
+	return cacheErrorStatus(err)
+}
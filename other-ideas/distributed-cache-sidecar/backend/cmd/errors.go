@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/federation"
+	"distributed-cache-sidecar/internal/network"
+	"errors"
+	"net/http"
+)
+
+// cacheErrorStatus is the HTTP status for an error from the cache or
+// network packages. Clients rely on these to decide whether to retry:
+// 421 means the node does not own the key and the topology is stale.
+func cacheErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, network.ErrNotOwner):
+		return http.StatusMisdirectedRequest
+	case errors.Is(err, cache.ErrNotFound), errors.Is(err, cache.ErrExpired):
+		return http.StatusNotFound
+	case errors.Is(err, cache.ErrBeyondHistory):
+		return http.StatusGone
+	case errors.Is(err, cache.ErrRangeNotSatisfiable):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, cache.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, cache.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, cache.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, cache.ErrVersionMismatch), errors.Is(err, cache.ErrExists):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, cache.ErrNotInteger), errors.Is(err, cache.ErrOverflow), errors.Is(err, cache.ErrWrongType):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, federation.ErrReadOnly), errors.Is(err, network.ErrNotReplicated):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/query"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// evictionSampleInterval is how often the item counts are compared to spot
+// eviction spikes.
+const evictionSampleInterval = 10 * time.Second
+
+// handleEvents returns recent events from the journal, oldest first.
+// ?kind= keeps one kind, ?after= only events with a higher sequence (to
+// poll for new ones), and ?limit= the newest limit of them.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var after uint64
+	if raw := query.Get("after"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid after, expected an event sequence number", http.StatusBadRequest)
+			return
+		}
+		after = parsed
+	}
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events.Recent(query.Get("kind"), after, limit))
+}
+
+// dumpEventsOnQuit writes the journal to dir when the process receives
+// SIGQUIT, then lets the signal through so the runtime still prints every
+// goroutine's stack and exits.
+func dumpEventsOnQuit(dir, nodeID string) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	lifecycle.Go("sigquit-dumper", "", func() {
+		select {
+		case <-quit:
+		case <-lifecycle.Stopping():
+			signal.Stop(quit)
+			return
+		}
+		dumpEvents(dir, nodeID, "SIGQUIT")
+		signal.Reset(syscall.SIGQUIT)
+		if process, err := os.FindProcess(os.Getpid()); err == nil {
+			process.Signal(syscall.SIGQUIT)
+		}
+	})
+}
+
+// dumpEventsOnPanic writes the journal to dir if the calling goroutine is
+// panicking, then carries on panicking. It must be deferred directly.
+func dumpEventsOnPanic(dir, nodeID string) {
+	if recovered := recover(); recovered != nil {
+		events.Record(events.KindPanic, "%v", recovered)
+		dumpEvents(dir, nodeID, fmt.Sprintf("panic: %v", recovered))
+		panic(recovered)
+	}
+}
+
+// stopOnViolations logs and journals every violated cache invariant,
+// dumps the event journal and exits, so a broken node in staging is
+// noticed rather than serving from corrupt state.
+func stopOnViolations(cfg *config.Config, violations []string) {
+	for _, violation := range violations {
+		log.Printf("Cache invariant violated: %s", violation)
+		events.Record(events.KindError, "Cache invariant violated: %s", violation)
+	}
+	dumpEvents(cfg.Events.DumpDir, cfg.NodeID, fmt.Sprintf("%d cache invariants violated", len(violations)))
+	log.Fatalf("Stopping: %d cache invariants violated", len(violations))
+}
+
+func dumpEvents(dir, nodeID, reason string) {
+	path, err := events.Write(dir, nodeID, reason)
+	if err != nil {
+		log.Printf("Failed to dump event journal: %v", err)
+		return
+	}
+	log.Printf("Dumped event journal to %s", path)
+}
+
+// watchEvictions records an event when a large share of the cache
+// disappears between two samples, a tenth of CACHE_SIZE is evicted to stay
+// within CACHE_SIZE or MAX_MEMORY_BYTES, or the derived cache turns over completely, which usually
+// means mass expiry or memory pressure.
+func watchEvictions(cacheManager *cache.Manager, derived *query.DerivedCache, cacheSize, capacity int) {
+	ticker := time.NewTicker(evictionSampleInterval)
+	defer ticker.Stop()
+
+	stats := cacheManager.GetStats()
+	items := stats.TotalItems
+	cacheEvictions := stats.EvictionCount
+	evictions := derived.Stats().Evictions
+	for {
+		select {
+		case <-lifecycle.Stopping():
+			return
+		case <-ticker.C:
+		}
+
+		stats := cacheManager.GetStats()
+		if dropped := items - stats.TotalItems; dropped >= 100 && dropped*10 >= items {
+			events.Record(events.KindEvictions, "%d of %d items gone in %v", dropped, items, evictionSampleInterval)
+		}
+		items = stats.TotalItems
+
+		if evicted := stats.EvictionCount - cacheEvictions; evicted > 0 && evicted*10 >= cacheSize {
+			events.Record(events.KindEvictions, "Cache evicted %d least recently used items in %v to stay within its size and memory limits", evicted, evictionSampleInterval)
+		}
+		cacheEvictions = stats.EvictionCount
+
+		currentEvictions := derived.Stats().Evictions
+		if evicted := currentEvictions - evictions; capacity > 0 && evicted >= int64(capacity) {
+			events.Record(events.KindEvictions, "Derived cache evicted %d entries in %v", evicted, evictionSampleInterval)
+		}
+		evictions = currentEvictions
+	}
+}
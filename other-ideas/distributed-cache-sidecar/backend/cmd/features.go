@@ -0,0 +1,69 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/features"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// gated serves handler only while the named feature flag is enabled, so a
+// disabled subsystem looks absent to clients.
+func gated(flags *features.Flags, name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !flags.Enabled(name) {
+			http.Error(w, fmt.Sprintf("Feature %s is disabled on this node", name), http.StatusNotFound)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func handleListFeatures(w http.ResponseWriter, r *http.Request, flags *features.Flags) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags.List())
+}
+
+func handleSetFeature(w http.ResponseWriter, r *http.Request, flags *features.Flags) {
+	name := pathVar(r, "name")
+
+	var request struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Enabled == nil {
+		http.Error(w, "Invalid JSON, expected {\"enabled\": true|false}", http.StatusBadRequest)
+		return
+	}
+
+	if err := flags.Override(name, *request.Enabled); err != nil {
+		writeFeatureError(w, err)
+		return
+	}
+	events.Record(events.KindConfig, "Feature %s overridden to %v", name, *request.Enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "enabled": *request.Enabled})
+}
+
+func handleClearFeature(w http.ResponseWriter, r *http.Request, flags *features.Flags) {
+	name := pathVar(r, "name")
+
+	if err := flags.ClearOverride(name); err != nil {
+		writeFeatureError(w, err)
+		return
+	}
+	events.Record(events.KindConfig, "Feature %s override cleared", name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "enabled": flags.Enabled(name)})
+}
+
+func writeFeatureError(w http.ResponseWriter, err error) {
+	if errors.Is(err, features.ErrUnknownFlag) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
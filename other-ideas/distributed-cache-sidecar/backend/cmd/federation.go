@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/federation"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+func handleFederationApply(w http.ResponseWriter, r *http.Request, link *federation.Link) {
+	if err := link.Authorize(r.Header.Get("Authorization")); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var items []*cache.CacheItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	applied, err := link.Apply(items)
+	if err != nil {
+		if errors.Is(err, federation.ErrNotSecondary) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"applied": applied})
+}
+
+func handleFederationStatus(w http.ResponseWriter, r *http.Request, link *federation.Link) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link.Status())
+}
+
+func handleFederationPromote(w http.ResponseWriter, r *http.Request, link *federation.Link) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link.Promote())
+}
+
+func handleFederationDemote(w http.ResponseWriter, r *http.Request, link *federation.Link) {
+	timeout := 30 * time.Second
+	if raw := r.URL.Query().Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link.Demote(ctx))
+}
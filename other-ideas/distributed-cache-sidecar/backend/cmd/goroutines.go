@@ -0,0 +1,27 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/lifecycle"
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// handleGoroutines lists the registered long-lived goroutines, with counts
+// by name. A count that keeps growing, e.g. of peer readers while the
+// number of peers stays the same, points at a leak. total is every
+// goroutine in the process, registered or not.
+func handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	live := lifecycle.Live()
+	byName := make(map[string]int)
+	for _, g := range live {
+		byName[g.Name]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"registered": live,
+		"by_name":    byName,
+		"total":      runtime.NumGoroutine(),
+	})
+}
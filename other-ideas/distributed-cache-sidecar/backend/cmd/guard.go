@@ -0,0 +1,139 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/network"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheGuard sits in front of the cache endpoints. While this node is cut
+// off from too many of its peers it is degraded: responses carry
+// X-Cache-Degraded and X-Cache-Staleness so clients can decide how far to
+// trust them, and writes are refused when partition.reject_writes is set.
+// An operator can also make the node read-only, which refuses writes
+// regardless of the partition state. Neither affects replication.
+// Witnesses and standbys that haven't been promoted refuse every cache
+// request. The TCP server applies the same checks to client commands.
+type cacheGuard struct {
+	partition config.PartitionConfig
+	peers     *network.PeerManager
+
+	mutex    sync.RWMutex
+	readOnly readOnlyState
+}
+
+type readOnlyState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+func newCacheGuard(cfg *config.Config, peerManager *network.PeerManager) *cacheGuard {
+	return &cacheGuard{partition: cfg.Partition, peers: peerManager}
+}
+
+func (g *cacheGuard) degraded() (network.Reachability, bool) {
+	reach := g.peers.Reachability()
+	if g.partition.DegradedFraction <= 0 || reach.Known == 0 {
+		return reach, false
+	}
+	return reach, reach.Unlinked() >= g.partition.DegradedFraction
+}
+
+func (g *cacheGuard) readOnlyState() readOnlyState {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.readOnly
+}
+
+func (g *cacheGuard) setReadOnly(enabled bool, reason string) readOnlyState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if enabled != g.readOnly.Enabled {
+		events.Record(events.KindConfig, "Read-only mode set to %v (%s)", enabled, reason)
+	}
+	if !enabled {
+		g.readOnly = readOnlyState{}
+		return g.readOnly
+	}
+	if !g.readOnly.Enabled {
+		now := time.Now()
+		g.readOnly = readOnlyState{Enabled: true, Since: &now}
+	}
+	g.readOnly.Reason = reason
+	return g.readOnly
+}
+
+func (g *cacheGuard) wrap(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch g.peers.NodeMode() {
+		case config.NodeModeWitness:
+			http.Error(w, "Node is a witness and holds no data", http.StatusServiceUnavailable)
+			return
+		case config.NodeModeStandby:
+			http.Error(w, "Node is a standby and serves no requests until promoted", http.StatusServiceUnavailable)
+			return
+		}
+		if isCacheWrite(r) {
+			if message := g.refuseWrite(); message != "" {
+				http.Error(w, message, http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if reach, degraded := g.degraded(); degraded {
+			w.Header().Set("X-Cache-Degraded", "true")
+			w.Header().Set("X-Cache-Staleness", strconv.Itoa(int(time.Since(reach.Since)/time.Second)))
+		}
+		handler(w, r)
+	}
+}
+
+// refuseWrite returns why writes are refused, or "" if they are accepted.
+func (g *cacheGuard) refuseWrite() string {
+	if readOnly := g.readOnlyState(); readOnly.Enabled {
+		message := "Node is read-only"
+		if readOnly.Reason != "" {
+			message += ": " + readOnly.Reason
+		}
+		return message
+	}
+	if reach, degraded := g.degraded(); degraded && g.partition.RejectWrites {
+		return fmt.Sprintf("Node is degraded (linked to %d of %d peers), writes are disabled", reach.Linked, reach.Known)
+	}
+	return ""
+}
+
+// guardWrites is the TCP server's write guard.
+func (g *cacheGuard) guardWrites() error {
+	if message := g.refuseWrite(); message != "" {
+		return fmt.Errorf("%w: %s", network.ErrUnavailable, message)
+	}
+	return nil
+}
+
+// isCacheWrite reports whether r modifies the cache. /proxy carries the
+// method it stands in for as a query parameter, and batch reads are POSTs
+// only to carry their key list.
+func isCacheWrite(r *http.Request) bool {
+	method := r.Method
+	if r.URL.Path == "/proxy" {
+		method = r.URL.Query().Get("method")
+	}
+	if strings.HasSuffix(r.URL.Path, "/cache:batchGet") {
+		return false
+	}
+
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
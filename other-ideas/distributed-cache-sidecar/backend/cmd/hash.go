@@ -0,0 +1,128 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// handleHashSet sets the request's fields of the hash under key and
+// answers with how many are new and the hash's new size.
+func handleHashSet(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Fields      map[string]string `json:"fields"`
+		TTL         int64             `json:"ttl"`
+		Sliding     bool              `json:"sliding"`
+		Metadata    map[string]string `json:"metadata"`
+		LocalOnly   bool              `json:"local_only"`
+		Consistency string            `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Fields) == 0 {
+		http.Error(w, "fields must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{
+		TTL:       time.Duration(request.TTL) * time.Second,
+		Sliding:   request.Sliding,
+		Metadata:  request.Metadata,
+		LocalOnly: request.LocalOnly,
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	added, size, err := cacheManager.HashSet(r.Context(), key, request.Fields, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"added":  added,
+		"size":   size,
+	})
+}
+
+// handleHashDelete removes the request's fields from the hash under key.
+func handleHashDelete(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Fields      []string `json:"fields"`
+		LocalOnly   bool     `json:"local_only"`
+		Consistency string   `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Fields) == 0 {
+		http.Error(w, "fields must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{LocalOnly: request.LocalOnly}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	removed, size, err := cacheManager.HashDelete(r.Context(), key, request.Fields, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"removed": removed,
+		"size":    size,
+	})
+}
+
+// handleHashGet answers with every field of the hash under key, or only
+// with those named by field query parameters.
+func handleHashGet(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var fields map[string]string
+	if names := r.URL.Query()["field"]; len(names) > 0 {
+		fields, err = cacheManager.HashGet(r.Context(), key, names)
+	} else {
+		fields, err = cacheManager.HashGetAll(r.Context(), key)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"fields": fields,
+		"size":   len(fields),
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const defaultHotKeysLimit = 20
+
+// handleHotKeys lists the keys this node served the most reads of within
+// the hot-key window, optionally only those under ?prefix=.
+func handleHotKeys(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	query := r.URL.Query()
+	prefix, err := namespaced(r, query.Get("prefix"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultHotKeysLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxScanLimit {
+			http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(maxScanLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	report := cacheManager.HotKeys(prefix, limit)
+	if report == nil {
+		http.Error(w, "Hot-key tracking is disabled; set HOTKEYS_WINDOW_MS", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
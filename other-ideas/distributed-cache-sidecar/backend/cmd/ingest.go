@@ -0,0 +1,13 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/ingest"
+	"encoding/json"
+	"net/http"
+)
+
+// handleIngestStatus reports how consuming topics into the cache is going.
+func handleIngestStatus(w http.ResponseWriter, r *http.Request, consumer *ingest.Consumer) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consumer.Status())
+}
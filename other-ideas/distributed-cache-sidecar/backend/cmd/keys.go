@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const keyEncodingBase64URL = "base64url"
+
+// The router matches on the escaped path, so route variables arrive still
+// percent-encoded; this is what lets a key contain an encoded "/".
+func pathVar(r *http.Request, name string) string {
+	raw := mux.Vars(r)[name]
+	if value, err := url.PathUnescape(raw); err == nil {
+		return value
+	}
+	return raw
+}
+
+// cacheKey returns the {key} route variable, decoding it from base64url
+// when the client asks for that form via ?key_encoding= or X-Key-Encoding.
+func cacheKey(r *http.Request) (string, error) {
+	key, err := decodeKey(mux.Vars(r)["key"], requestKeyEncoding(r))
+	if err != nil {
+		return "", err
+	}
+	return namespaced(r, key)
+}
+
+func requestKeyEncoding(r *http.Request) string {
+	if encoding := r.URL.Query().Get("key_encoding"); encoding != "" {
+		return encoding
+	}
+	return r.Header.Get("X-Key-Encoding")
+}
+
+func decodeKey(raw, encoding string) (string, error) {
+	key, err := url.PathUnescape(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid percent-encoding in key: %v", err)
+	}
+
+	switch encoding {
+	case "":
+		return key, nil
+	case keyEncodingBase64URL:
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+		if err != nil {
+			return "", fmt.Errorf("invalid base64url key: %v", err)
+		}
+		return string(decoded), nil
+	default:
+		return "", fmt.Errorf("unsupported key encoding %q", encoding)
+	}
+}
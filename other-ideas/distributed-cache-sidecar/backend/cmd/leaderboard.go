@@ -0,0 +1,148 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Leaderboards are sorted sets in the leaderboard namespace, one per
+// board, holding each user's best score. Ranks in responses count from 1.
+
+const (
+	leaderboardNamespace    = "leaderboard"
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 1000
+)
+
+type leaderboardEntry struct {
+	Rank   int     `json:"rank"`
+	UserID string  `json:"user_id"`
+	Score  float64 `json:"score"`
+}
+
+func leaderboardKey(r *http.Request) string {
+	return cache.NamespaceKey(leaderboardNamespace, pathVar(r, "name"))
+}
+
+// handleSubmitScore records a user's score on a leaderboard, which keeps
+// it only if it beats the user's best, and answers with the user's best
+// score and rank.
+func handleSubmitScore(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	var request struct {
+		UserID string   `json:"user_id"`
+		Score  *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.UserID == "" || request.Score == nil {
+		http.Error(w, "user_id and score are required", http.StatusBadRequest)
+		return
+	}
+
+	key := leaderboardKey(r)
+	added, raised, _, err := cacheManager.SortedSetAdd(r.Context(), key, map[string]float64{request.UserID: *request.Score}, cache.WriteOptions{})
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+	best, rank, size, err := cacheManager.SortedSetRank(r.Context(), key, request.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  request.UserID,
+		"score":    best.Score,
+		"rank":     rank + 1,
+		"size":     size,
+		"improved": added+raised > 0,
+	})
+}
+
+// handleLeaderboard answers with a page of a leaderboard, best first.
+func handleLeaderboard(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	query := r.URL.Query()
+	limit := defaultLeaderboardLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxLeaderboardLimit {
+			http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(maxLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	members, size, err := cacheManager.SortedSetRange(r.Context(), leaderboardKey(r), offset, offset+limit-1)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+	entries := make([]leaderboardEntry, len(members))
+	for i, member := range members {
+		entries[i] = leaderboardEntry{Rank: offset + i + 1, UserID: member.Member, Score: member.Score}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    pathVar(r, "name"),
+		"size":    size,
+		"entries": entries,
+	})
+}
+
+// handleLeaderboardRank answers with a user's best score and rank.
+func handleLeaderboardRank(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	userID := pathVar(r, "userId")
+	member, rank, size, err := cacheManager.SortedSetRank(r.Context(), leaderboardKey(r), userID)
+	if errors.Is(err, cache.ErrNotFound) {
+		http.Error(w, "user has no score on this leaderboard", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"score":   member.Score,
+		"rank":    rank + 1,
+		"size":    size,
+	})
+}
+
+// handleResetLeaderboard deletes a leaderboard here and on peers, the
+// only way to lower scores on it.
+func handleResetLeaderboard(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key := leaderboardKey(r)
+	deleted, err := cacheManager.DeleteWhere(r.Context(), key, func(item *cache.CacheItem) bool {
+		return item.Key == key
+	}, cache.WriteOptions{})
+	if err == nil && deleted == 0 {
+		err = &cache.KeyError{Key: key, Err: cache.ErrNotFound}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/analytics"
+	"distributed-cache-sidecar/internal/licensing"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// handleLicensingCalc answers a licensing cost calculation from the
+// cache, calculating it against the current pricing sheet on a miss.
+func handleLicensingCalc(w http.ResponseWriter, r *http.Request, calculator *licensing.Calculator) {
+	var request licensing.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	item, cached, err := calculator.Calculate(r.Context(), request)
+	if err != nil {
+		http.Error(w, err.Error(), licensingErrorStatus(err))
+		return
+	}
+	analytics.SetOutcome(r, cached)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":             item.Key,
+		"cached":          cached,
+		"pricing_version": item.Metadata[licensing.PricingVersionMetadata],
+		"result":          json.RawMessage(item.Value),
+	})
+}
+
+// handleLicensingInvalidate drops every cached licensing result.
+func handleLicensingInvalidate(w http.ResponseWriter, r *http.Request, calculator *licensing.Calculator) {
+	deleted, err := calculator.Invalidate(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "invalidated",
+		"deleted": deleted,
+	})
+}
+
+// licensingErrorStatus maps calculator errors to HTTP statuses; a pricing
+// sheet that can't be read is the operator's to fix, not the caller's.
+func licensingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, licensing.ErrInvalidRequest), errors.Is(err, licensing.ErrNoPrice):
+		return http.StatusBadRequest
+	case errors.Is(err, licensing.ErrInvalidSheet):
+		return http.StatusServiceUnavailable
+	}
+	return cacheErrorStatus(err)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleListPush adds the request's values to the left or right end of the
+// list under key and answers with the list's new length.
+func handleListPush(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, left bool) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Values      []string          `json:"values"`
+		TTL         int64             `json:"ttl"`
+		Sliding     bool              `json:"sliding"`
+		Metadata    map[string]string `json:"metadata"`
+		LocalOnly   bool              `json:"local_only"`
+		Consistency string            `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Values) == 0 {
+		http.Error(w, "values must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{
+		TTL:       time.Duration(request.TTL) * time.Second,
+		Sliding:   request.Sliding,
+		Metadata:  request.Metadata,
+		LocalOnly: request.LocalOnly,
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	length, err := cacheManager.ListPush(r.Context(), key, left, request.Values, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"length": length,
+	})
+}
+
+// handleListPop removes up to count values, 1 by default, from the left
+// or right end of the list under key and answers with them.
+func handleListPop(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, left bool) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := struct {
+		Count       int    `json:"count"`
+		LocalOnly   bool   `json:"local_only"`
+		Consistency string `json:"consistency"`
+	}{Count: 1}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.Count < 1 {
+		http.Error(w, "count must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{LocalOnly: request.LocalOnly}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	values, err := cacheManager.ListPop(r.Context(), key, left, request.Count, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"values": values,
+	})
+}
+
+// handleListRange answers with the values of the list under key between
+// the start and stop query parameters, inclusive, which default to the
+// whole list.
+func handleListRange(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start, stop := 0, -1
+	for name, index := range map[string]*int{"start": &start, "stop": &stop} {
+		if raw := r.URL.Query().Get(name); raw != "" {
+			if *index, err = strconv.Atoi(raw); err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	values, length, err := cacheManager.ListRange(r.Context(), key, start, stop)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"values": values,
+		"length": length,
+	})
+}
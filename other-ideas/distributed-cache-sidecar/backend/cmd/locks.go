@@ -0,0 +1,75 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/locks"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// handleAcquireLock acquires a lock, or renews it for the token sent, and
+// answers with the lease.
+func handleAcquireLock(w http.ResponseWriter, r *http.Request, lockManager *locks.Locks) {
+	var request struct {
+		Owner string `json:"owner"`
+		Token string `json:"token"`
+		TTLMS int64  `json:"ttl_ms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.TTLMS < 0 {
+		http.Error(w, "Invalid ttl_ms", http.StatusBadRequest)
+		return
+	}
+
+	lease, err := lockManager.Acquire(r.Context(), pathVar(r, "name"), request.Owner, request.Token, time.Duration(request.TTLMS)*time.Millisecond)
+	if err != nil {
+		http.Error(w, err.Error(), lockErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lease)
+}
+
+// handleReleaseLock releases a lock held by the ?token= sent.
+func handleReleaseLock(w http.ResponseWriter, r *http.Request, lockManager *locks.Locks) {
+	if err := lockManager.Release(r.Context(), pathVar(r, "name"), r.URL.Query().Get("token")); err != nil {
+		http.Error(w, err.Error(), lockErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "released"})
+}
+
+// handleGetLock answers with the lease on a lock this node granted.
+func handleGetLock(w http.ResponseWriter, r *http.Request, lockManager *locks.Locks) {
+	lease, err := lockManager.Get(r.Context(), pathVar(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), lockErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lease)
+}
+
+// lockErrorStatus maps lock errors to HTTP statuses.
+func lockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, locks.ErrInvalidLock):
+		return http.StatusBadRequest
+	case errors.Is(err, locks.ErrNotHeld):
+		return http.StatusNotFound
+	case errors.Is(err, locks.ErrHeld):
+		return http.StatusConflict
+	case errors.Is(err, locks.ErrNoQuorum):
+		return http.StatusServiceUnavailable
+	}
+	return cacheErrorStatus(err)
+}
@@ -1,17 +1,43 @@
 package main
 
 import (
-	"context"
+	"bytes"
+	"distributed-cache-sidecar/internal/analytics"
+	"distributed-cache-sidecar/internal/backup"
 	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/changefeed"
+	"distributed-cache-sidecar/internal/codec"
 	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/dataset"
+	"distributed-cache-sidecar/internal/edge"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/features"
+	"distributed-cache-sidecar/internal/federation"
+	"distributed-cache-sidecar/internal/ingest"
+	"distributed-cache-sidecar/internal/licensing"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/locks"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
 	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/panics"
+	"distributed-cache-sidecar/internal/persistence"
+	"distributed-cache-sidecar/internal/progress"
+	"distributed-cache-sidecar/internal/query"
+	"distributed-cache-sidecar/internal/schema"
+	"distributed-cache-sidecar/internal/sqlserver"
+	"distributed-cache-sidecar/internal/teardown"
+	"distributed-cache-sidecar/internal/udf"
+	"distributed-cache-sidecar/internal/version"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -29,53 +55,253 @@ var (
 	}
 )
 
-func main() {
+func serve() {
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	// The same checks as validate-config, so a config it rejects never
+	// reaches the components that would misbehave or panic on it.
+	if problems := append(cfg.Validate(), validateComponents(cfg)...); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("Invalid config: %s: %s", problem.Field, problem.Message)
+		}
+		log.Fatalf("Refusing to start with %d config problems", len(problems))
+	}
+	logging.Configure(time.Duration(cfg.Logging.IntervalMS)*time.Millisecond, cfg.Logging.Budget, cfg.Logging.Budgets)
+	events.Configure(cfg.Events.Capacity)
+	panics.Configure(cfg.NodeID, cfg.Region, cfg.PanicWebhookURL)
+	defer dumpEventsOnPanic(cfg.Events.DumpDir, cfg.NodeID)
+	dumpEventsOnQuit(cfg.Events.DumpDir, cfg.NodeID)
+	events.Record(events.KindLifecycle, "Starting %s %s in %s as a %s node", cfg.NodeID, version.Get().Version, cfg.Region, cfg.NodeMode)
 
 	cacheManager := cache.NewManager(cfg.Region, cfg.NodeID)
-	
+	keyPolicy, err := cache.NewKeyPolicy(cfg.KeyPolicy.MaxLength, cfg.KeyPolicy.Pattern, cfg.KeyPolicy.RequiredPrefixes, cfg.KeyPolicy.RequireTenant, cfg.KeyPolicy.RejectURLUnsafe)
+	if err != nil {
+		log.Fatalf("Failed to load key policy: %v", err)
+	}
+	cacheManager.SetKeyPolicy(keyPolicy)
+	cacheManager.SetDedup(cfg.DedupValues)
+	cacheManager.SetCapacity(cfg.CacheSize)
+	cacheManager.SetMemoryLimit(int64(cfg.MaxMemoryBytes))
+	cacheManager.SetMaxValueSize(cfg.MaxValueBytes)
+	if cfg.ExpirySweepIntervalMS > 0 {
+		cacheManager.StartJanitor(time.Duration(cfg.ExpirySweepIntervalMS) * time.Millisecond)
+	}
+	if cfg.InvariantCheckIntervalMS > 0 {
+		cacheManager.EnableInvariantChecks()
+		cacheManager.WatchInvariants(time.Duration(cfg.InvariantCheckIntervalMS)*time.Millisecond, func(violations []string) {
+			stopOnViolations(cfg, violations)
+		})
+	}
+	for prefix, source := range cfg.Schemas {
+		if err := cacheManager.Schemas().Register(prefix, source); err != nil {
+			log.Fatalf("Failed to load schema: %v", err)
+		}
+	}
+	for _, hookCfg := range cfg.Hooks {
+		hook, err := cache.NewHook(hookCfg.Name, hookCfg.Args)
+		if err != nil {
+			log.Fatalf("Failed to load hook for prefix %q: %v", hookCfg.Prefix, err)
+		}
+		cacheManager.AddHook(hookCfg.Prefix, hook)
+	}
+	// Datasets are verified from before the first replicated item arrives.
+	var datasets *dataset.Store
+	if cfg.Datasets.Enabled() {
+		if datasets, err = dataset.New(cfg.Datasets, cacheManager); err != nil {
+			log.Fatalf("Failed to load dataset keys: %v", err)
+		}
+	}
+
+	var edgeCache *edge.Cache
+	if cfg.Edge.Origin != "" {
+		if edgeCache, err = edge.New(cfg.Edge, cacheManager); err != nil {
+			log.Fatalf("Failed to configure edge mode: %v", err)
+		}
+	}
+
+	var analyticsStream *analytics.Stream
+	if cfg.Analytics.Sink != "" {
+		if analyticsStream, err = analytics.New(cfg.Analytics, cfg.NodeID, cfg.Region); err != nil {
+			log.Fatalf("Failed to configure analytics: %v", err)
+		}
+		analyticsStream.Start()
+	}
+
+	if cfg.History.RetentionMS > 0 {
+		cacheManager.EnableHistory(time.Duration(cfg.History.RetentionMS)*time.Millisecond, cfg.History.MaxVersions)
+	}
+	if cfg.HotKeys.WindowMS > 0 {
+		cacheManager.EnableHotKeys(time.Duration(cfg.HotKeys.WindowMS)*time.Millisecond, cfg.HotKeys.MaxKeys)
+	}
+
+	var eventLog *persistence.EventLog
+	if cfg.EventLogPath != "" {
+		var lastSequence uint64
+		eventLog, lastSequence, err = persistence.OpenEventLog(cfg.EventLogPath)
+		if err != nil {
+			log.Fatalf("Failed to open event log: %v", err)
+		}
+		cacheManager.SetJournal(lastSequence, eventLog.Append)
+		if cfg.EventLogFsync {
+			eventLog.EnableGroupCommit(time.Duration(cfg.EventLogGroupCommitMS) * time.Millisecond)
+			cacheManager.SetDurability(eventLog.WaitDurable)
+		}
+	}
+
+	// The snapshot replaces the whole cache, so it is restored before the
+	// warm-up file adds what it lacks.
+	var snapshotter *persistence.Snapshotter
+	if cfg.SnapshotPath != "" {
+		snapshotter = persistence.NewSnapshotter(cfg.SnapshotPath, time.Duration(cfg.SnapshotIntervalMS)*time.Millisecond, cacheManager)
+		if _, err := snapshotter.Restore(); err != nil {
+			log.Printf("Failed to restore snapshot, starting empty: %v", err)
+			events.Record(events.KindError, "Failed to restore snapshot: %v", err)
+		}
+		snapshotter.Start()
+	}
+
+	if cfg.WarmupFile != "" {
+		warmUp(cacheManager, cfg.WarmupFile)
+	}
+
 	tcpServer := network.NewTCPServer(cfg.TCPPort, cacheManager)
-	go func() {
+	tcpServer.Advertise(cfg.AdvertiseURL, cfg.HTTPPort)
+	tcpServer.Bind(cfg.TCPAddresses(), cfg.TCPAcceptors)
+	tcpServer.Tune(cfg.Socket)
+	lifecycle.Go("tcp-server", "", func() {
 		if err := tcpServer.Start(); err != nil {
 			log.Printf("TCP server error: %v", err)
 		}
-	}()
+	})
 
 	peerManager := network.NewPeerManager(cfg, cacheManager)
+	peerManager.Attach(tcpServer)
 	go peerManager.Start()
 
-	router := mux.NewRouter()
-	
+	rebalancer := network.NewRebalancer(peerManager)
+	rebalancer.RegisterCommands(tcpServer)
+	rebalancer.Start()
+
+	verifier := network.NewVerifier(peerManager)
+	verifier.RegisterCommands(tcpServer)
+
+	backupCoordinator := backup.NewCoordinator(cfg.BackupDir, cfg.EventLogPath, cacheManager, peerManager)
+	backupCoordinator.RegisterCommands(tcpServer)
+
+	lockManager := locks.New(cfg.Locks, cfg.Peers, peerManager)
+	lockManager.RegisterCommands(tcpServer)
+
+	var federationLink *federation.Link
+	if cfg.Federation.Role != "" {
+		federationLink = federation.NewLink(cfg.Federation, cacheManager)
+		federationLink.Start()
+	}
+
+	var changeFeed *changefeed.Feed
+	if cfg.ChangeFeed.Broker != "" {
+		if changeFeed, err = changefeed.New(cfg.ChangeFeed, cacheManager); err != nil {
+			log.Fatalf("Failed to configure the change feed: %v", err)
+		}
+		changeFeed.Start()
+	}
+
+	var ingestConsumer *ingest.Consumer
+	if cfg.Ingest.KafkaRESTURL != "" {
+		ingestConsumer = ingest.New(cfg.Ingest, cfg.NodeID, cacheManager)
+		ingestConsumer.Start()
+	}
+
+	var sqlAdapter *sqlserver.Adapter
+	if cfg.SQLServer.DSN != "" {
+		if sqlAdapter, err = sqlserver.New(cfg.SQLServer, cacheManager); err != nil {
+			log.Fatalf("Failed to open SQL Server connection: %v", err)
+		}
+		defer sqlAdapter.Close()
+		sqlAdapter.Watch()
+	}
+	calculator := licensing.New(cfg.Licensing, cacheManager)
+	tracker := progress.New(cfg.Progress, cacheManager)
+	reaper := teardown.New(cfg.Namespaces, cfg.NodeID, cacheManager)
+	reaper.Start()
+
+	flags := features.NewFlags()
+	if err := flags.Configure(cfg.Features); err != nil {
+		log.Fatalf("Failed to load feature flags: %v", err)
+	}
+
+	derived := query.NewDerivedCache(cfg.DerivedCacheSize)
+	cacheManager.AddMutationListener(func(mutation cache.Mutation) {
+		if mutation.Op == cache.MutationReset {
+			derived.InvalidateAll()
+		} else {
+			derived.Invalidate(mutation.Key)
+		}
+	})
+	lifecycle.Go("eviction-watcher", "", func() {
+		watchEvictions(cacheManager, derived, cfg.CacheSize, cfg.DerivedCacheSize)
+	})
+	udfRegistry := udf.NewRegistry(uint32(cfg.UDFMemoryPages), time.Duration(cfg.UDFTimeoutMS)*time.Millisecond)
+
+	guard := newCacheGuard(cfg, peerManager)
+	registerReadOnlyCommand(tcpServer, guard, cfg.NodeID)
+	tcpServer.GuardWrites(guard.guardWrites)
+	router := mux.NewRouter().UseEncodedPath()
+	if analyticsStream != nil {
+		router.Use(analyticsStream.Middleware)
+	}
+
 	router.HandleFunc("/cors-proxy", func(w http.ResponseWriter, r *http.Request) {
 		handleCorsProxy(w, r)
 	}).Methods("OPTIONS")
-	
-	router.HandleFunc("/proxy", func(w http.ResponseWriter, r *http.Request) {
+
+	router.HandleFunc("/proxy", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
 		handleProxy(w, r, cacheManager, peerManager)
-	}).Methods("GET", "POST", "DELETE")
-	
+	})).Methods("GET", "POST", "DELETE")
+
 	router.HandleFunc("/jsonp", func(w http.ResponseWriter, r *http.Request) {
 		handleJSONP(w, r, cacheManager, peerManager)
 	}).Methods("GET")
-	
+
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.Write(w)
+	}).Methods("GET")
+
 	api := router.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/cache/{key}", func(w http.ResponseWriter, r *http.Request) {
-		handleGetCache(w, r, cacheManager)
+	registerCacheRoutes(api, guard, cacheManager, peerManager, derived)
+	namespace := api.PathPrefix("/ns/{ns}").Subrouter()
+	registerCacheRoutes(namespace, guard, cacheManager, peerManager, derived)
+	namespace.HandleFunc("/cache", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleFlushNamespace(w, r, cacheManager)
+	})).Methods("DELETE")
+	namespace.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		handleNamespaceStats(w, r, cacheManager)
 	}).Methods("GET")
-	api.HandleFunc("/cache/{key}", func(w http.ResponseWriter, r *http.Request) {
-		handleSetCache(w, r, cacheManager)
-	}).Methods("POST")
-	api.HandleFunc("/cache/{key}", func(w http.ResponseWriter, r *http.Request) {
-		handleDeleteCache(w, r, cacheManager)
-	}).Methods("DELETE")
-	api.HandleFunc("/cache/{key}", func(w http.ResponseWriter, r *http.Request) {
-		handleOptions(w, r)
-	}).Methods("OPTIONS")
+	namespace.HandleFunc("/clone", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleCloneNamespace(w, r, cacheManager)
+	})).Methods("POST")
+	namespace.HandleFunc("", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSetQuota(w, r, cacheManager)
+	})).Methods("PUT")
+	namespace.HandleFunc("", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleDropNamespace(w, r, cacheManager)
+	})).Methods("DELETE")
+	api.HandleFunc("/namespaces", func(w http.ResponseWriter, r *http.Request) {
+		handleListNamespaces(w, r, cacheManager)
+	}).Methods("GET")
+	api.HandleFunc("/namespaces/reports", func(w http.ResponseWriter, r *http.Request) {
+		handleNamespaceReports(w, r, reaper)
+	}).Methods("GET")
+	api.HandleFunc("/tags/{tag}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleTagged(w, r, cacheManager)
+	})).Methods("GET")
+	api.HandleFunc("/tags/{tag}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleInvalidateTag(w, r, cacheManager)
+	})).Methods("DELETE")
 	api.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		handleStatus(w, r, cacheManager, peerManager)
+		handleStatus(w, r, cacheManager, peerManager, guard, flags, derived)
 	}).Methods("GET")
 	api.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		handleOptions(w, r)
@@ -83,94 +309,592 @@ func main() {
 	api.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
 		handlePeers(w, r, peerManager)
 	}).Methods("GET")
+	api.HandleFunc("/topology", func(w http.ResponseWriter, r *http.Request) {
+		handleTopology(w, r, cfg, cacheManager, peerManager)
+	}).Methods("GET")
+	api.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		handleVersion(w, r, cfg, flags)
+	}).Methods("GET")
 	api.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
 		handleOptions(w, r)
 	}).Methods("OPTIONS")
+	api.HandleFunc("/cluster/placement/audit", func(w http.ResponseWriter, r *http.Request) {
+		handlePlacementAudit(w, r, peerManager)
+	}).Methods("GET")
+	api.HandleFunc("/cluster/rebalance", func(w http.ResponseWriter, r *http.Request) {
+		handleRebalance(w, r, "status", rebalancer, cfg.Peers, peerManager)
+	}).Methods("GET")
+	api.HandleFunc("/cluster/rebalance", func(w http.ResponseWriter, r *http.Request) {
+		handleRebalance(w, r, "start", rebalancer, cfg.Peers, peerManager)
+	}).Methods("POST")
+	api.HandleFunc("/cluster/rebalance/pause", func(w http.ResponseWriter, r *http.Request) {
+		handleRebalance(w, r, "pause", rebalancer, cfg.Peers, peerManager)
+	}).Methods("POST")
+	api.HandleFunc("/cluster/rebalance/resume", func(w http.ResponseWriter, r *http.Request) {
+		handleRebalance(w, r, "resume", rebalancer, cfg.Peers, peerManager)
+	}).Methods("POST")
+	api.HandleFunc("/admin/schemas", func(w http.ResponseWriter, r *http.Request) {
+		handleListSchemas(w, r, cacheManager)
+	}).Methods("GET")
+	api.HandleFunc("/admin/schemas/{prefix}", func(w http.ResponseWriter, r *http.Request) {
+		handlePutSchema(w, r, cacheManager)
+	}).Methods("PUT")
+	api.HandleFunc("/admin/schemas/{prefix}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteSchema(w, r, cacheManager)
+	}).Methods("DELETE")
+	api.HandleFunc("/admin/features", func(w http.ResponseWriter, r *http.Request) {
+		handleListFeatures(w, r, flags)
+	}).Methods("GET")
+	api.HandleFunc("/admin/features/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleSetFeature(w, r, flags)
+	}).Methods("PUT")
+	api.HandleFunc("/admin/features/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleClearFeature(w, r, flags)
+	}).Methods("DELETE")
+	api.HandleFunc("/admin/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		handleGetSnapshot(w, r, cacheManager)
+	}).Methods("GET")
+	api.HandleFunc("/admin/snapshot", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handlePutSnapshot(w, r, cacheManager)
+	})).Methods("PUT")
+	if snapshotter != nil {
+		api.HandleFunc("/admin/snapshot", func(w http.ResponseWriter, r *http.Request) {
+			handleSaveSnapshot(w, r, snapshotter)
+		}).Methods("POST")
+	}
+	api.HandleFunc("/admin/readonly", func(w http.ResponseWriter, r *http.Request) {
+		handleGetReadOnly(w, r, guard)
+	}).Methods("GET")
+	api.HandleFunc("/admin/readonly", func(w http.ResponseWriter, r *http.Request) {
+		handleSetReadOnly(w, r, guard, cfg.NodeID, cfg.Peers, peerManager)
+	}).Methods("POST")
+	api.HandleFunc("/admin/promote", func(w http.ResponseWriter, r *http.Request) {
+		handlePromote(w, r, cfg.NodeID, peerManager)
+	}).Methods("POST")
+	api.HandleFunc("/admin/verify", func(w http.ResponseWriter, r *http.Request) {
+		handleVerify(w, r, verifier)
+	}).Methods("POST")
+	api.HandleFunc("/admin/verify", func(w http.ResponseWriter, r *http.Request) {
+		handleLastVerify(w, r, verifier)
+	}).Methods("GET")
+	api.HandleFunc("/admin/events", func(w http.ResponseWriter, r *http.Request) {
+		handleEvents(w, r)
+	}).Methods("GET")
+	if changeFeed != nil {
+		api.HandleFunc("/admin/changefeed", func(w http.ResponseWriter, r *http.Request) {
+			handleChangeFeedStatus(w, r, changeFeed)
+		}).Methods("GET")
+	}
+	if ingestConsumer != nil {
+		api.HandleFunc("/admin/ingest", func(w http.ResponseWriter, r *http.Request) {
+			handleIngestStatus(w, r, ingestConsumer)
+		}).Methods("GET")
+	}
+	if analyticsStream != nil {
+		api.HandleFunc("/admin/analytics", func(w http.ResponseWriter, r *http.Request) {
+			handleAnalyticsStatus(w, r, analyticsStream)
+		}).Methods("GET")
+	}
+	api.HandleFunc("/admin/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		handleGoroutines(w, r)
+	}).Methods("GET")
+	api.HandleFunc("/admin/cost-estimate", func(w http.ResponseWriter, r *http.Request) {
+		handleCostEstimate(w, r, peerManager)
+	}).Methods("GET")
+	api.HandleFunc("/admin/backups", func(w http.ResponseWriter, r *http.Request) {
+		handleListBackups(w, r, backupCoordinator)
+	}).Methods("GET")
+	api.HandleFunc("/admin/backups", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateBackup(w, r, backupCoordinator)
+	}).Methods("POST")
+	api.HandleFunc("/admin/backups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetBackup(w, r, backupCoordinator)
+	}).Methods("GET")
+	api.HandleFunc("/admin/backups/{id}/collect", func(w http.ResponseWriter, r *http.Request) {
+		handleCollectBackup(w, r, backupCoordinator)
+	}).Methods("POST")
+	api.HandleFunc("/admin/backups/{id}/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		handleDownloadSnapshot(w, r, backupCoordinator)
+	}).Methods("GET")
+	api.HandleFunc("/admin/backups/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		handleRestoreBackup(w, r, backupCoordinator)
+	}).Methods("POST")
+	if eventLog != nil {
+		api.HandleFunc("/admin/restore", func(w http.ResponseWriter, r *http.Request) {
+			handlePointInTimeRestore(w, r, backupCoordinator)
+		}).Methods("POST")
+	}
+	api.HandleFunc("/udf", gated(flags, features.UDF, func(w http.ResponseWriter, r *http.Request) {
+		handleListUDFs(w, r, udfRegistry)
+	})).Methods("GET")
+	api.HandleFunc("/udf/{name}", gated(flags, features.UDF, func(w http.ResponseWriter, r *http.Request) {
+		handlePutUDF(w, r, udfRegistry)
+	})).Methods("PUT")
+	api.HandleFunc("/udf/{name}", gated(flags, features.UDF, func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteUDF(w, r, udfRegistry)
+	})).Methods("DELETE")
+	api.HandleFunc("/udf/{name}/invoke", gated(flags, features.UDF, func(w http.ResponseWriter, r *http.Request) {
+		handleInvokeUDF(w, r, cacheManager, udfRegistry, derived)
+	})).Methods("POST")
+	if federationLink != nil {
+		api.HandleFunc("/federation/apply", func(w http.ResponseWriter, r *http.Request) {
+			handleFederationApply(w, r, federationLink)
+		}).Methods("POST")
+		api.HandleFunc("/federation/status", func(w http.ResponseWriter, r *http.Request) {
+			handleFederationStatus(w, r, federationLink)
+		}).Methods("GET")
+		api.HandleFunc("/admin/federation/promote", func(w http.ResponseWriter, r *http.Request) {
+			handleFederationPromote(w, r, federationLink)
+		}).Methods("POST")
+		api.HandleFunc("/admin/federation/demote", func(w http.ResponseWriter, r *http.Request) {
+			handleFederationDemote(w, r, federationLink)
+		}).Methods("POST")
+	}
+	if sqlAdapter != nil {
+		api.HandleFunc("/sql/query", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleSQLQuery(w, r, sqlAdapter)
+		})).Methods("POST")
+		api.HandleFunc("/sql/tables/{table}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleSQLInvalidate(w, r, sqlAdapter)
+		})).Methods("DELETE")
+	}
+	if datasets != nil {
+		api.HandleFunc("/datasets/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handlePublishDataset(w, r, datasets)
+		})).Methods("POST")
+		api.HandleFunc("/datasets/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleGetDataset(w, r, datasets, peerManager)
+		})).Methods("GET")
+	}
+	api.HandleFunc("/calc/licensing", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleLicensingCalc(w, r, calculator)
+	})).Methods("POST")
+	api.HandleFunc("/calc/licensing", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleLicensingInvalidate(w, r, calculator)
+	})).Methods("DELETE")
+	api.HandleFunc("/progress", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleExportProgress(w, r, tracker)
+	})).Methods("GET")
+	api.HandleFunc("/progress/{userId}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleGetProgress(w, r, tracker, peerManager)
+	})).Methods("GET")
+	api.HandleFunc("/progress/{userId}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleUpdateProgress(w, r, tracker)
+	})).Methods("POST")
+	api.HandleFunc("/progress/{userId}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteProgress(w, r, tracker)
+	})).Methods("DELETE")
+	api.HandleFunc("/leaderboard/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleLeaderboard(w, r, cacheManager)
+	})).Methods("GET")
+	api.HandleFunc("/leaderboard/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSubmitScore(w, r, cacheManager)
+	})).Methods("POST")
+	api.HandleFunc("/leaderboard/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleResetLeaderboard(w, r, cacheManager)
+	})).Methods("DELETE")
+	api.HandleFunc("/leaderboard/{name}/users/{userId}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleLeaderboardRank(w, r, cacheManager)
+	})).Methods("GET")
+	api.HandleFunc("/locks/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleGetLock(w, r, lockManager)
+	})).Methods("GET")
+	api.HandleFunc("/locks/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleAcquireLock(w, r, lockManager)
+	})).Methods("POST")
+	api.HandleFunc("/locks/{name}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleReleaseLock(w, r, lockManager)
+	})).Methods("DELETE")
 	api.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		handleWebSocket(w, r, cacheManager, peerManager)
 	}).Methods("GET")
+	if edgeCache != nil {
+		api.HandleFunc("/edge", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleEdgeStatus(w, r, edgeCache)
+		})).Methods("GET")
+		api.HandleFunc("/edge/deploy", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleEdgeDeploy(w, r, edgeCache)
+		})).Methods("PUT")
+		api.HandleFunc("/edge/versions/{version}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleEdgePurge(w, r, edgeCache)
+		})).Methods("DELETE")
+		// Registered last, the bundle gets every path no other route has.
+		router.PathPrefix("/").Handler(guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+			handleEdgeAsset(w, r, edgeCache)
+		})).Methods("GET", "HEAD")
+	}
 
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"*"},
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
 		AllowCredentials: false,
 	})
 
-	handler := c.Handler(router)
-	
+	handler := panics.Middleware(c.Handler(router))
+
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
 		Handler: handler,
 	}
 
-	go func() {
-		log.Printf("HTTP server starting on port %d", cfg.HTTPPort)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
-		}
-	}()
+	listeners, err := network.Listen(cfg.HTTPAddresses(), 1)
+	if err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+	for _, listener := range listeners {
+		listener := listener
+		lifecycle.Go("http-server", listener.Addr().String(), func() {
+			log.Printf("HTTP server starting on %s", listener.Addr())
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				events.Record(events.KindError, "HTTP server on %s failed: %v", listener.Addr(), err)
+				log.Fatalf("HTTP server error: %v", err)
+			}
+		})
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down servers...")
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
-	}
-	
-	tcpServer.Stop()
-	peerManager.Stop()
-	
+	events.Record(events.KindLifecycle, "Shutting down")
+
+	shutdown := &shutdownSequence{
+		budget:      cfg.Shutdown,
+		server:      server,
+		tcpServer:   tcpServer,
+		peerManager: peerManager,
+		rebalancer:  rebalancer,
+		federation:  federationLink,
+		backups:     backupCoordinator,
+		snapshotter: snapshotter,
+		udfRegistry: udfRegistry,
+		eventLog:    eventLog,
+	}
+	leaked := shutdown.run()
+
 	log.Println("Servers stopped")
+	if len(leaked) > 0 {
+		os.Exit(1)
+	}
 }
 
-func handleGetCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+func handleGetCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var options cache.ReadOptions
+	if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+		options.AsOf, err = time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			http.Error(w, "Invalid asOf, expected an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+
+	item, err := cacheManager.Read(r.Context(), key, options)
+	if errors.Is(err, cache.ErrNotFound) && options.AsOf.IsZero() {
+		if ownerErr := peerManager.CheckOwner(key); ownerErr != nil {
+			err = ownerErr
+		}
+		if peerManager.RemoteReads() {
+			if remote, servedBy, remoteErr := peerManager.ReadRemote(key); remoteErr == nil {
+				item, err = remote, nil
+				w.Header().Set("X-Cache-Served-By", servedBy)
+			}
+		}
+	}
+	if err == nil || errors.Is(err, cache.ErrNotFound) || errors.Is(err, cache.ErrExpired) {
+		analytics.SetOutcome(r, err == nil)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	if r.Header.Get("Range") != "" && writeRange(w, r, cacheManager, item) {
+		return
+	}
+	if item.Type == cache.TypeChunked {
+		writeLargeObject(w, r, cacheManager, item)
+		return
+	}
+
+	if encoding := r.URL.Query().Get("encoding"); encoding != "" {
+		transcoded, err := transcodeItem(cacheManager, item, encoding)
+		if err != nil {
+			http.Error(w, err.Error(), transcodeErrorStatus(err))
+			return
+		}
+		item = transcoded
+	}
 
-	item, exists := cacheManager.Get(key)
-	if !exists {
-		http.Error(w, "Key not found", http.StatusNotFound)
+	w.Header().Set("ETag", versionTag(item.Version))
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		writeRawValue(w, cacheManager, item)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(item)
+	json.NewEncoder(w).Encode(newItemResponse(cacheManager, item))
+}
+
+// writeRawValue answers with item's payload alone, typed by its encoding,
+// so JSON documents and binary values come back as they were stored.
+func writeRawValue(w http.ResponseWriter, cacheManager *cache.Manager, item *cache.CacheItem) {
+	data, serializer, err := cacheManager.Codecs().Bytes(item.Value, item.Encoding)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", serializer.ContentType())
+	w.Header().Set("X-Cache-Encoding", serializer.Name())
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Write(data)
+}
+
+// requestValue returns the value and encoding a set request carries. A
+// JSON string is the value as before; any other JSON document is stored
+// as is with the json encoding, so clients needn't encode it twice.
+func requestValue(raw json.RawMessage, encoding string) (string, string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] == '"' {
+		var value string
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return "", "", err
+			}
+		}
+		return value, encoding, nil
+	}
+	if encoding != "" && encoding != codec.EncodingJSON {
+		return "", "", fmt.Errorf("a value that isn't a string must use the %s encoding, not %s", codec.EncodingJSON, encoding)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return "", "", err
+	}
+	return compacted.String(), codec.EncodingJSON, nil
+}
+
+func transcodeItem(cacheManager *cache.Manager, item *cache.CacheItem, encoding string) (*cache.CacheItem, error) {
+	value, err := cacheManager.Codecs().Transcode(item.Value, item.Encoding, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	transcoded := *item
+	transcoded.Value = value
+	transcoded.Encoding = encoding
+	return &transcoded, nil
+}
+
+func transcodeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, codec.ErrUnknownEncoding):
+		return http.StatusBadRequest
+	case errors.Is(err, codec.ErrNotTranscodable):
+		return http.StatusNotAcceptable
+	default:
+		return http.StatusUnprocessableEntity
+	}
 }
 
 func handleSetCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	key, value, options, ok := setRequest(w, r, cacheManager.MaxValueSize())
+	if !ok {
+		return
+	}
+
+	item, err := cacheManager.Write(r.Context(), key, value, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "version": item.Version})
+}
+
+// maxSetOverhead is how much of a set request's body may be taken by
+// fields other than the value.
+const maxSetOverhead = 64 << 10
+
+// setRequest parses the key, value and options of a set request. If they
+// are invalid it answers the request and returns false. A body that
+// can't hold a value within maxValueBytes, escaped, is refused unread.
+func setRequest(w http.ResponseWriter, r *http.Request, maxValueBytes int) (string, string, cache.WriteOptions, bool) {
+	var options cache.WriteOptions
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", options, false
+	}
 
 	var request struct {
-		Value string `json:"value"`
-		TTL   int64  `json:"ttl"`
+		Value       json.RawMessage   `json:"value"`
+		TTL         int64             `json:"ttl"`
+		KeepTTL     bool              `json:"keep_ttl"`
+		Sliding     bool              `json:"sliding"`
+		Encoding    string            `json:"encoding"`
+		Metadata    map[string]string `json:"metadata"`
+		LocalOnly   bool              `json:"local_only"`
+		Consistency string            `json:"consistency"`
+		MaxReads    int64             `json:"max_reads"`
+		Tags        []string          `json:"tags"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+	body := io.Reader(r.Body)
+	if maxValueBytes > 0 {
+		maxBody := 2*int64(maxValueBytes) + maxSetOverhead
+		if r.ContentLength > maxBody {
+			http.Error(w, fmt.Sprintf("request body exceeds %d bytes", maxBody), http.StatusRequestEntityTooLarge)
+			return "", "", options, false
+		}
+		body = io.LimitReader(r.Body, maxBody)
+	}
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return "", "", options, false
+	}
+	if request.MaxReads < 0 {
+		http.Error(w, "max_reads must not be negative", http.StatusBadRequest)
+		return "", "", options, false
+	}
+
+	value, encoding, err := requestValue(request.Value, request.Encoding)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", options, false
+	}
+
+	options = cache.WriteOptions{
+		TTL:       time.Duration(request.TTL) * time.Second,
+		Sliding:   request.Sliding,
+		Encoding:  encoding,
+		Metadata:  request.Metadata,
+		LocalOnly: request.LocalOnly,
+		MaxReads:  request.MaxReads,
+		Tags:      request.Tags,
+	}
+	if options.IfVersion, err = ifMatchVersion(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", options, false
+	}
+	if request.KeepTTL {
+		options.TTLMode = cache.TTLKeep
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", options, false
+	}
+	return key, value, options, true
+}
+
+// handleGetOrSetCache answers with the live item under key, storing the
+// request's value first if there is none, and says whether it was
+// already stored.
+func handleGetOrSetCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, value, options, ok := setRequest(w, r, cacheManager.MaxValueSize())
+	if !ok {
+		return
+	}
+	if options.IfVersion != 0 {
+		http.Error(w, "If-Match does not apply to getorset", http.StatusBadRequest)
 		return
 	}
 
-	cacheManager.Set(key, request.Value, request.TTL)
+	item, existed, err := cacheManager.GetOrSet(r.Context(), key, value, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+	analytics.SetOutcome(r, existed)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"existed": existed,
+		"item":    item,
+	})
+}
+
+// versionTag is the entity tag for an item version: the version quoted.
+func versionTag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// ifMatchVersion parses the request's If-Match header, a version as sent
+// in ETag, quoted or not. It is zero when there is no header.
+func ifMatchVersion(r *http.Request) (uint64, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(tag, `"`), 10, 64)
+	if err != nil || version == 0 {
+		return 0, fmt.Errorf("invalid If-Match %q, expected an item version", tag)
+	}
+	return version, nil
+}
+
+func writeSetError(w http.ResponseWriter, err error) {
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(validationErr)
+		return
+	}
+	http.Error(w, err.Error(), cacheErrorStatus(err))
+}
+
+// handleTouchCache restarts an item's TTL without reading it.
+func handleTouchCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := cacheManager.Touch(r.Context(), key)
+	if errors.Is(err, cache.ErrNotFound) {
+		if ownerErr := peerManager.CheckOwner(key); ownerErr != nil {
+			err = ownerErr
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	response := map[string]interface{}{"status": "touched"}
+	if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+		response["expires_at"] = expiresAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func handleDeleteCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
-	vars := mux.Vars(r)
-	key := vars["key"]
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var options cache.WriteOptions
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	deleted := cacheManager.Delete(key)
-	if !deleted {
-		http.Error(w, "Key not found", http.StatusNotFound)
+	if err := cacheManager.Remove(r.Context(), key, options); err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
 		return
 	}
 
@@ -178,14 +902,159 @@ func handleDeleteCache(w http.ResponseWriter, r *http.Request, cacheManager *cac
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
-func handleStatus(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
-	stats := cacheManager.GetStats()
+func handleListSchemas(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cacheManager.Schemas().List())
+}
+
+func handlePutSchema(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	prefix := pathVar(r, "prefix")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := cacheManager.Schemas().Register(prefix, body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "registered", "prefix": prefix})
+}
+
+func handleDeleteSchema(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	prefix := pathVar(r, "prefix")
+
+	if !cacheManager.Schemas().Remove(prefix) {
+		http.Error(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "prefix": prefix})
+}
+
+// registerCacheRoutes adds the endpoints that read and write keys to
+// routes, which is either the API root or a namespace's.
+func registerCacheRoutes(routes *mux.Router, guard *cacheGuard, cacheManager *cache.Manager, peerManager *network.PeerManager, derived *query.DerivedCache) {
+	routes.HandleFunc("/cache/{key}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleGetCache(w, r, cacheManager, peerManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache/{key}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSetCache(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteCache(w, r, cacheManager)
+	})).Methods("DELETE")
+	routes.HandleFunc("/cache/{key}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handlePatchCache(w, r, cacheManager)
+	})).Methods("PATCH")
+	routes.HandleFunc("/cache/{key}", func(w http.ResponseWriter, r *http.Request) {
+		handleOptions(w, r)
+	}).Methods("OPTIONS")
+	routes.HandleFunc("/keys", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleScanKeys(w, r, cacheManager)
+	})).Methods("GET")
+	routes.HandleFunc("/hotkeys", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleHotKeys(w, r, cacheManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache:batchGet", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleBatchGet(w, r, cacheManager, peerManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache:batchSet", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleBatchSet(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/getorset", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleGetOrSetCache(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/ttl", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleCacheTTL(w, r, cacheManager, peerManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache/{key}/expire", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleExpireCache(w, r, cacheManager, peerManager, false)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/persist", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleExpireCache(w, r, cacheManager, peerManager, true)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/touch", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleTouchCache(w, r, cacheManager, peerManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/incr", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleIncrementCache(w, r, peerManager, 1)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/decr", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleIncrementCache(w, r, peerManager, -1)
+	})).Methods("POST")
+	routes.HandleFunc("/ratelimit/{key}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleRateLimit(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/lpush", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleListPush(w, r, cacheManager, true)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/rpush", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleListPush(w, r, cacheManager, false)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/lpop", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleListPop(w, r, cacheManager, true)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/rpop", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleListPop(w, r, cacheManager, false)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/list", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleListRange(w, r, cacheManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache/{key}/sadd", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSetUpdate(w, r, cacheManager, false)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/srem", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSetUpdate(w, r, cacheManager, true)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/members", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleSetMembers(w, r, cacheManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache/{key}/hset", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleHashSet(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/hdel", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleHashDelete(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/fields", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleHashGet(w, r, cacheManager)
+	})).Methods("GET")
+	routes.HandleFunc("/cache/{key}/uploads", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleInitiateUpload(w, r)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/uploads/{upload}/parts/{part}", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleUploadPart(w, r, cacheManager)
+	})).Methods("PUT")
+	routes.HandleFunc("/cache/{key}/uploads/{upload}/complete", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleCompleteUpload(w, r, cacheManager)
+	})).Methods("POST")
+	routes.HandleFunc("/cache/{key}/query", guard.wrap(func(w http.ResponseWriter, r *http.Request) {
+		handleQueryCache(w, r, cacheManager, derived)
+	})).Methods("GET")
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager, guard *cacheGuard, flags *features.Flags, derived *query.DerivedCache) {
+	view := cacheManager.View()
 	peers := peerManager.GetPeers()
+	reach, degraded := guard.degraded()
 
 	response := map[string]interface{}{
-		"stats": stats,
-		"peers": peers,
-		"items": cacheManager.GetAllItems(),
+		"stats":         view.Stats,
+		"peers":         peers,
+		"items":         view.Items,
+		"sequence":      view.Sequence,
+		"features":      flags.Active(),
+		"derived_cache": derived.Stats(),
+		"reachability":  reach,
+		"degraded":      degraded,
+		"read_only":     guard.readOnlyState(),
+		"node_mode":     peerManager.NodeMode(),
+		"quorum":        reach.Quorum(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -201,7 +1070,7 @@ func handlePeers(w http.ResponseWriter, r *http.Request, peerManager *network.Pe
 
 func handleCorsProxy(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Access-Control-Max-Age", "86400")
 	w.WriteHeader(http.StatusNoContent)
@@ -209,7 +1078,7 @@ func handleCorsProxy(w http.ResponseWriter, r *http.Request) {
 
 func handleOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Access-Control-Max-Age", "86400")
 	w.WriteHeader(http.StatusNoContent)
@@ -217,77 +1086,99 @@ func handleOptions(w http.ResponseWriter, r *http.Request) {
 
 func handleProxy(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Content-Type", "application/json")
 
 	path := r.URL.Query().Get("path")
 	method := r.URL.Query().Get("method")
-	
+
 	if path == "" {
 		http.Error(w, "Missing path parameter", http.StatusBadRequest)
 		return
 	}
-	
+
 	if method == "" {
 		method = "GET"
 	}
 
 	switch {
 	case path == "/api/status" && method == "GET":
-		stats := cacheManager.GetStats()
+		view := cacheManager.View()
 		peers := peerManager.GetPeers()
 		response := map[string]interface{}{
-			"stats": stats,
+			"stats": view.Stats,
 			"peers": peers,
-			"items": cacheManager.GetAllItems(),
+			"items": view.Items,
 		}
 		json.NewEncoder(w).Encode(response)
-		
+
 	case path == "/api/peers" && method == "GET":
 		peers := peerManager.GetPeers()
 		json.NewEncoder(w).Encode(peers)
-		
+
 	case strings.HasPrefix(path, "/api/cache/") && method == "GET":
-		key := strings.TrimPrefix(path, "/api/cache/")
-		item, exists := cacheManager.Get(key)
-		if !exists {
-			http.Error(w, "Key not found", http.StatusNotFound)
+		key, err := decodeKey(strings.TrimPrefix(path, "/api/cache/"), r.URL.Query().Get("key_encoding"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		item, err := cacheManager.Lookup(key)
+		if err != nil {
+			http.Error(w, err.Error(), cacheErrorStatus(err))
 			return
 		}
-		json.NewEncoder(w).Encode(item)
-		
+		json.NewEncoder(w).Encode(newItemResponse(cacheManager, item))
+
 	case strings.HasPrefix(path, "/api/cache/") && method == "POST":
-		key := strings.TrimPrefix(path, "/api/cache/")
-		
+		key, err := decodeKey(strings.TrimPrefix(path, "/api/cache/"), r.URL.Query().Get("key_encoding"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		var request struct {
-			Value string `json:"value"`
-			TTL   int64  `json:"ttl"`
+			Value    json.RawMessage `json:"value"`
+			TTL      int64           `json:"ttl"`
+			Encoding string          `json:"encoding"`
 		}
-		
+
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "Failed to read body", http.StatusBadRequest)
 			return
 		}
-		
+
 		if err := json.Unmarshal(body, &request); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
-		
-		cacheManager.Set(key, request.Value, request.TTL)
+
+		value, encoding, err := requestValue(request.Value, request.Encoding)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := cacheManager.SetEncoded(key, value, encoding, request.TTL); err != nil {
+			writeSetError(w, err)
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-		
+
 	case strings.HasPrefix(path, "/api/cache/") && method == "DELETE":
-		key := strings.TrimPrefix(path, "/api/cache/")
+		key, err := decodeKey(strings.TrimPrefix(path, "/api/cache/"), r.URL.Query().Get("key_encoding"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		deleted := cacheManager.Delete(key)
 		if !deleted {
 			http.Error(w, "Key not found", http.StatusNotFound)
 			return
 		}
 		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
-		
+
 	default:
 		http.Error(w, "Unsupported path or method", http.StatusNotFound)
 	}
@@ -298,25 +1189,25 @@ func handleJSONP(w http.ResponseWriter, r *http.Request, cacheManager *cache.Man
 	if callback == "" {
 		callback = "callback"
 	}
-	
+
 	w.Header().Set("Content-Type", "application/javascript")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	
-	stats := cacheManager.GetStats()
+
+	view := cacheManager.View()
 	peers := peerManager.GetPeers()
-	
+
 	response := map[string]interface{}{
-		"stats": stats,
+		"stats": view.Stats,
 		"peers": peers,
-		"items": cacheManager.GetAllItems(),
+		"items": view.Items,
 	}
-	
+
 	jsonData, err := json.Marshal(response)
 	if err != nil {
 		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
 		return
 	}
-	
+
 	fmt.Fprintf(w, "%s(%s);", callback, string(jsonData))
 }
 
@@ -326,21 +1217,24 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request, cacheManager *cache
 		return
 	}
 	defer conn.Close()
+	defer lifecycle.Enter("ws-writer", r.RemoteAddr)()
 
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-lifecycle.Stopping():
+			return
 		case <-ticker.C:
-			stats := cacheManager.GetStats()
+			view := cacheManager.View()
 			peers := peerManager.GetPeers()
-			
+
 			update := map[string]interface{}{
 				"type":  "status_update",
-				"stats": stats,
+				"stats": view.Stats,
 				"peers": peers,
-				"items": cacheManager.GetAllItems(),
+				"items": view.Items,
 			}
 
 			if err := conn.WriteJSON(update); err != nil {
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/teardown"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// namespaced returns the key stored for key in the namespace the request
+// is made in, if any.
+func namespaced(r *http.Request, key string) (string, error) {
+	ns, inNamespace := mux.Vars(r)["ns"]
+	if !inNamespace {
+		return key, nil
+	}
+	if err := cache.ValidateNamespace(ns); err != nil {
+		return "", err
+	}
+	return cache.NamespaceKey(ns, key), nil
+}
+
+// requestNamespace returns the namespace the request is made in.
+func requestNamespace(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ns := mux.Vars(r)["ns"]
+	if err := cache.ValidateNamespace(ns); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return ns, true
+}
+
+// handleFlushNamespace deletes every key of a namespace.
+func handleFlushNamespace(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	ns, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	var options cache.WriteOptions
+	var err error
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.LocalOnly = r.URL.Query().Get("local_only") == "true"
+
+	flushed, err := cacheManager.FlushNamespace(r.Context(), ns, options)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "flushed",
+		"namespace": ns,
+		"deleted":   flushed,
+	})
+}
+
+// quotaRequest is the quota sent to create or clone a namespace, with its
+// lifetime in seconds from now.
+type quotaRequest struct {
+	Target     string `json:"target"`
+	MaxItems   int    `json:"max_items"`
+	MaxBytes   int64  `json:"max_bytes"`
+	DefaultTTL int64  `json:"default_ttl"`
+	MaxTTL     int64  `json:"max_ttl"`
+	Lifetime   int64  `json:"lifetime"`
+}
+
+// decodeQuota reads the quota in the request body.
+func decodeQuota(w http.ResponseWriter, r *http.Request) (quotaRequest, cache.NamespaceQuota, bool) {
+	var request quotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return request, cache.NamespaceQuota{}, false
+	}
+	if request.Lifetime < 0 {
+		http.Error(w, "Invalid lifetime", http.StatusBadRequest)
+		return request, cache.NamespaceQuota{}, false
+	}
+
+	quota := cache.NamespaceQuota{
+		MaxItems:   request.MaxItems,
+		MaxBytes:   request.MaxBytes,
+		DefaultTTL: request.DefaultTTL,
+		MaxTTL:     request.MaxTTL,
+	}
+	if request.Lifetime > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.Lifetime) * time.Second)
+		quota.ExpiresAt = &expiresAt
+	}
+	return request, quota, true
+}
+
+// handleSetQuota creates a namespace with a quota, such as a lab's with a
+// lifetime after which it is torn down, or replaces a namespace's quota.
+func handleSetQuota(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	ns, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+	_, quota, ok := decodeQuota(w, r)
+	if !ok {
+		return
+	}
+	quota.Namespace = ns
+	var options cache.WriteOptions
+	var err error
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quota, err = cacheManager.SetQuota(r.Context(), quota, options)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quota)
+}
+
+// handleCloneNamespace copies a namespace into a new one with its own
+// quota and TTL policy, such as a workshop's sandbox seeded from a golden
+// dataset.
+func handleCloneNamespace(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	source, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+	request, quota, ok := decodeQuota(w, r)
+	if !ok {
+		return
+	}
+	quota.Namespace = request.Target
+	var options cache.WriteOptions
+	var err error
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	copied, err := cacheManager.CloneNamespace(r.Context(), source, quota, options)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+	quota, _ = cacheManager.Quota(request.Target)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "cloned",
+		"source":    source,
+		"namespace": request.Target,
+		"copied":    copied,
+		"quota":     quota,
+	})
+}
+
+// handleDropNamespace deletes every key of a namespace and its quota.
+func handleDropNamespace(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	ns, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+	var options cache.WriteOptions
+	var err error
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := cacheManager.DropNamespace(r.Context(), ns, options)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "dropped",
+		"namespace": ns,
+		"deleted":   deleted,
+	})
+}
+
+func handleNamespaceStats(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	ns, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cacheManager.NamespaceStats(ns))
+}
+
+func handleListNamespaces(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cacheManager.Namespaces())
+}
+
+// handleNamespaceReports answers with the reports this node archived of
+// the namespaces it tore down.
+func handleNamespaceReports(w http.ResponseWriter, r *http.Request, reaper *teardown.Reaper) {
+	reports, err := reaper.Reports()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
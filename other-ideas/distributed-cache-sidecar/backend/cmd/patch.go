@@ -0,0 +1,46 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/patch"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+func handlePatchCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patchType, ok := patch.TypeForContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "Content-Type must be "+patch.ContentTypeMergePatch+" or "+patch.ContentTypeJSONPatch, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	item, err := cacheManager.Patch(key, patchType, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, cache.ErrPatchUnsupported), errors.Is(err, patch.ErrInvalidDocument):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, patch.ErrInvalidPatch):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeSetError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newItemResponse(cacheManager, item))
+}
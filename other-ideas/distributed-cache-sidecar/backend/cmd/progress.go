@@ -0,0 +1,136 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/progress"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// handleGetProgress answers with a learner's progress.
+func handleGetProgress(w http.ResponseWriter, r *http.Request, tracker *progress.Tracker, peerManager *network.PeerManager) {
+	userID := pathVar(r, "userId")
+	learner, version, err := tracker.Get(r.Context(), userID)
+	if errors.Is(err, cache.ErrNotFound) {
+		if ownerErr := peerManager.CheckOwner(progress.Key(userID)); ownerErr != nil {
+			err = ownerErr
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), progressErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(version))
+	json.NewEncoder(w).Encode(learner)
+}
+
+// handleUpdateProgress merges the progress a device sends into what is
+// stored and answers with the result.
+func handleUpdateProgress(w http.ResponseWriter, r *http.Request, tracker *progress.Tracker) {
+	var update progress.Progress
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	merged, version, err := tracker.Update(r.Context(), pathVar(r, "userId"), &update)
+	if errors.Is(err, progress.ErrInvalidProgress) || errors.Is(err, progress.ErrBusy) {
+		http.Error(w, err.Error(), progressErrorStatus(err))
+		return
+	}
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(version))
+	json.NewEncoder(w).Encode(merged)
+}
+
+// handleDeleteProgress forgets a learner's progress.
+func handleDeleteProgress(w http.ResponseWriter, r *http.Request, tracker *progress.Tracker) {
+	if err := tracker.Delete(r.Context(), pathVar(r, "userId")); err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// handleExportProgress answers with the progress of every learner held on
+// this node, as JSON or, with ?format=csv, one CSV row per learner and
+// topic or quiz.
+func handleExportProgress(w http.ResponseWriter, r *http.Request, tracker *progress.Tracker) {
+	learners := tracker.Export()
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"learners": learners,
+			"count":    len(learners),
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="progress.csv"`)
+		writeProgressCSV(w, learners)
+	default:
+		http.Error(w, "Invalid format, expected json or csv", http.StatusBadRequest)
+	}
+}
+
+func writeProgressCSV(w http.ResponseWriter, learners []*progress.Progress) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"user_id", "kind", "id", "viewed_at", "completed_at", "attempts", "best_score", "last_score", "last_submitted_at"})
+	for _, learner := range learners {
+		topics := make([]string, 0, len(learner.Topics))
+		for id := range learner.Topics {
+			topics = append(topics, id)
+		}
+		sort.Strings(topics)
+		for _, id := range topics {
+			topic := learner.Topics[id]
+			completedAt := ""
+			if topic.CompletedAt != nil {
+				completedAt = topic.CompletedAt.Format(time.RFC3339)
+			}
+			out.Write([]string{learner.UserID, "topic", id, topic.ViewedAt.Format(time.RFC3339), completedAt, "", "", "", ""})
+		}
+		quizzes := make([]string, 0, len(learner.Quizzes))
+		for id := range learner.Quizzes {
+			quizzes = append(quizzes, id)
+		}
+		sort.Strings(quizzes)
+		for _, id := range quizzes {
+			quiz := learner.Quizzes[id]
+			lastScore, lastSubmitted := "", ""
+			if len(quiz.Attempts) > 0 {
+				lastScore = strconv.FormatFloat(quiz.Attempts[0].Score, 'f', -1, 64)
+				lastSubmitted = quiz.Attempts[0].SubmittedAt.Format(time.RFC3339)
+			}
+			out.Write([]string{learner.UserID, "quiz", id, "", "", strconv.Itoa(len(quiz.Attempts)),
+				strconv.FormatFloat(quiz.BestScore, 'f', -1, 64), lastScore, lastSubmitted})
+		}
+	}
+	out.Flush()
+}
+
+// progressErrorStatus maps tracker errors to HTTP statuses.
+func progressErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, progress.ErrInvalidProgress):
+		return http.StatusBadRequest
+	case errors.Is(err, progress.ErrBusy):
+		return http.StatusConflict
+	}
+	return cacheErrorStatus(err)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/query"
+	"encoding/json"
+	"net/http"
+)
+
+func handleQueryCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, derived *query.DerivedCache) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path, err := query.Parse(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := cacheManager.Read(r.Context(), key, cache.ReadOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	dep := itemDependency(item)
+	var matches []interface{}
+	if cached, found := derived.Get("jsonpath:"+path.String(), dep); found {
+		matches = cached.([]interface{})
+	} else {
+		doc, found := derived.Get("document", dep)
+		if !found {
+			doc, err = parseDocument(cacheManager, item)
+			if err != nil {
+				http.Error(w, "Value is not a JSON document", http.StatusUnprocessableEntity)
+				return
+			}
+			derived.Put("document", doc, dep)
+		}
+		matches = path.Eval(doc)
+		derived.Put("jsonpath:"+path.String(), matches, dep)
+	}
+
+	response := map[string]interface{}{
+		"key":  item.Key,
+		"path": path.String(),
+	}
+	if path.Definite() {
+		if len(matches) == 0 {
+			http.Error(w, "Path not found", http.StatusNotFound)
+			return
+		}
+		response["result"] = matches[0]
+	} else {
+		if matches == nil {
+			matches = []interface{}{}
+		}
+		response["result"] = matches
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func itemDependency(item *cache.CacheItem) query.Dependency {
+	return query.Dependency{Key: item.Key, Version: item.Version, Timestamp: item.Timestamp}
+}
+
+func parseDocument(cacheManager *cache.Manager, item *cache.CacheItem) (interface{}, error) {
+	value := item.Value
+	if item.Encoding != "" && item.Encoding != codec.EncodingRaw && item.Encoding != codec.EncodingJSON {
+		transcoded, err := cacheManager.Codecs().Transcode(item.Value, item.Encoding, codec.EncodingJSON)
+		if err != nil {
+			return nil, err
+		}
+		value = transcoded
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// byteRange resolves a Range header against a payload of size bytes to
+// the offset and length it asks for. ok is false for headers other than a
+// single byte range, which are ignored so the whole payload is served;
+// satisfiable is false for a range that starts past the end.
+func byteRange(header string, size int64) (offset, length int64, ok, satisfiable bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+
+	if first == "" {
+		// A suffix range: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, false
+		}
+		if n == 0 {
+			return 0, 0, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end - start + 1, true, true
+}
+
+// writeRange answers with the part of item's payload the request's Range
+// header names, and reports whether it did. The bytes are served as the
+// raw value would be, so a JSON item's range is of its document.
+func writeRange(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, item *cache.CacheItem) bool {
+	size, err := cacheManager.PayloadSize(item)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return true
+	}
+	offset, length, ok, satisfiable := byteRange(r.Header.Get("Range"), size)
+	if !ok {
+		return false
+	}
+	if !satisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	data, err := cacheManager.ReadRange(r.Context(), item, offset, length)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return true
+	}
+
+	contentType := "application/octet-stream"
+	if item.Type != cache.TypeChunked {
+		serializer, err := cacheManager.Codecs().Get(item.Encoding)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		contentType = serializer.ContentType()
+		w.Header().Set("X-Cache-Encoding", serializer.Name())
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data)
+	return true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleRateLimit takes ?cost= tokens, 1 by default, from the rate limit
+// under a key, which allows ?limit= requests per ?window=, given in
+// seconds or as a duration such as 1m30s. It answers 200 if the request
+// is allowed and 429 if it isn't, with the tokens remaining either way.
+func handleRateLimit(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit < 1 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	window, err := parseWindow(query.Get("window"))
+	if err != nil {
+		http.Error(w, "Invalid window", http.StatusBadRequest)
+		return
+	}
+	cost := int64(1)
+	if raw := query.Get("cost"); raw != "" {
+		if cost, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			http.Error(w, "Invalid cost", http.StatusBadRequest)
+			return
+		}
+	}
+
+	options := cache.WriteOptions{LocalOnly: query.Get("local_only") == "true"}
+	if options.Consistency, err = cache.ParseConsistency(query.Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := cacheManager.TakeTokens(r.Context(), key, limit, window, cost, options)
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.ResetAfter), 10))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":            result.Key,
+		"allowed":        result.Allowed,
+		"limit":          result.Limit,
+		"remaining":      result.Remaining,
+		"retry_after_ms": result.RetryAfter.Milliseconds(),
+		"reset_after_ms": result.ResetAfter.Milliseconds(),
+	})
+}
+
+// parseWindow parses a window given in seconds or as a duration.
+func parseWindow(raw string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if seconds < 1 || seconds > math.MaxInt64/int64(time.Second) {
+			return 0, strconv.ErrRange
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
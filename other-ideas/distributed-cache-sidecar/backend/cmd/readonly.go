@@ -0,0 +1,104 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const readOnlyTimeout = 5 * time.Second
+
+type readOnlyRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	// Cluster applies the switch to every configured peer as well.
+	Cluster bool `json:"cluster,omitempty"`
+}
+
+type readOnlyResult struct {
+	NodeID   string        `json:"node_id,omitempty"`
+	Address  string        `json:"address,omitempty"`
+	ReadOnly readOnlyState `json:"read_only"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// registerReadOnlyCommand lets peers apply a cluster-wide switch to this
+// node.
+func registerReadOnlyCommand(server *network.TCPServer, guard *cacheGuard, nodeID string) {
+	server.RegisterCommand("READONLY", func(payload string) string {
+		var request readOnlyRequest
+		if err := json.Unmarshal([]byte(payload), &request); err != nil || request.Enabled == nil {
+			return "ERROR|Invalid read-only request"
+		}
+
+		state := guard.setReadOnly(*request.Enabled, request.Reason)
+		log.Printf("Read-only mode set to %v by a peer", state.Enabled)
+		data, err := json.Marshal(readOnlyResult{NodeID: nodeID, ReadOnly: state})
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+	})
+}
+
+func handleGetReadOnly(w http.ResponseWriter, r *http.Request, guard *cacheGuard) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(guard.readOnlyState())
+}
+
+// handleSetReadOnly switches writes off or back on. The switch only
+// affects writes from clients; replication from peers keeps applying so
+// the node doesn't fall behind while it is read-only.
+func handleSetReadOnly(w http.ResponseWriter, r *http.Request, guard *cacheGuard, nodeID string, peers []string, peerManager *network.PeerManager) {
+	var request readOnlyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Enabled == nil {
+		http.Error(w, "Invalid JSON, expected {\"enabled\": true|false}", http.StatusBadRequest)
+		return
+	}
+
+	state := guard.setReadOnly(*request.Enabled, request.Reason)
+	log.Printf("Read-only mode set to %v", state.Enabled)
+	results := []readOnlyResult{{NodeID: nodeID, ReadOnly: state}}
+
+	if request.Cluster {
+		peerRequest := request
+		peerRequest.Cluster = false
+		payload, _ := json.Marshal(peerRequest)
+
+		peerResults := make([]readOnlyResult, len(peers))
+		var wg sync.WaitGroup
+		for i, address := range peers {
+			wg.Add(1)
+			go func(i int, address string) {
+				defer wg.Done()
+
+				result := readOnlyResult{Address: address}
+				response, err := peerManager.Request(address, "READONLY", string(payload), readOnlyTimeout)
+				if err == nil {
+					err = json.Unmarshal([]byte(response), &result)
+				}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				peerResults[i] = result
+			}(i, address)
+		}
+		wg.Wait()
+		results = append(results, peerResults...)
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != "" {
+			status = http.StatusBadGateway
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"nodes": results})
+}
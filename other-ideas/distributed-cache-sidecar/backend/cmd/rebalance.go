@@ -0,0 +1,83 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const rebalanceTimeout = 5 * time.Second
+
+type rebalanceResult struct {
+	Address string `json:"address,omitempty"`
+	network.RebalanceStatus
+	Error string `json:"error,omitempty"`
+}
+
+// handleRebalance applies action ("status", "start", "pause" or "resume")
+// to this node and every configured peer, since each node hands over the
+// keys it holds itself, and reports every node's progress.
+func handleRebalance(w http.ResponseWriter, r *http.Request, action string, rebalancer *network.Rebalancer, peers []string, peerManager *network.PeerManager) {
+	var local network.RebalanceStatus
+	var err error
+	switch action {
+	case "start":
+		local, err = rebalancer.Run()
+	case "pause":
+		local = rebalancer.Pause()
+	case "resume":
+		local = rebalancer.Resume()
+	default:
+		local = rebalancer.Status()
+	}
+	if errors.Is(err, network.ErrRebalanceDisabled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if action != "status" {
+		events.Record(events.KindConfig, "Rebalance %s requested", action)
+	}
+
+	results := make([]rebalanceResult, 1+len(peers))
+	results[0] = rebalanceResult{RebalanceStatus: local}
+	if err != nil {
+		results[0].Error = err.Error()
+	}
+
+	var wg sync.WaitGroup
+	for i, address := range peers {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+
+			result := rebalanceResult{Address: address}
+			response, err := peerManager.Request(address, "REBALANCE", action, rebalanceTimeout)
+			if err == nil {
+				err = json.Unmarshal([]byte(response), &result.RebalanceStatus)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results[i+1] = result
+		}(i, address)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != "" {
+			status = http.StatusBadGateway
+		}
+	}
+	if errors.Is(err, network.ErrRebalanceRunning) {
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"nodes": results})
+}
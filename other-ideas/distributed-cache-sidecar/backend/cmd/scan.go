@@ -0,0 +1,61 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Key listing pages default to defaultScanLimit keys and hold at most
+// maxScanLimit.
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// handleScanKeys lists the keys held here that start with ?prefix=, in
+// order, ?limit= at a time. The cursor returned with a page, passed back
+// as ?cursor=, fetches the next; it is empty after the last page.
+func handleScanKeys(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	query := r.URL.Query()
+	prefix, err := namespaced(r, query.Get("prefix"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultScanLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxScanLimit {
+			http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(maxScanLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	// The cursor is the last key of the previous page, encoded so that
+	// clients treat it as opaque.
+	var after string
+	if cursor := query.Get("cursor"); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		after = string(decoded)
+	}
+
+	keys, more := cacheManager.Scan(prefix, after, limit)
+	next := ""
+	if more {
+		next = base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys":   keys,
+		"count":  len(keys),
+		"cursor": next,
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/testutil"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+var errScenarioFailed = errors.New("scenario failed")
+
+// selftestRun reports one scenario to stdout. Fatalf unwinds the scenario
+// with a panic, so its deferred cluster shutdown still runs.
+type selftestRun struct {
+	verbose bool
+	failure string
+}
+
+func (r *selftestRun) Helper() {}
+
+func (r *selftestRun) Logf(format string, args ...interface{}) {
+	if r.verbose {
+		fmt.Printf("    "+format+"\n", args...)
+	}
+}
+
+func (r *selftestRun) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+	panic(errScenarioFailed)
+}
+
+func (r *selftestRun) run(scenario testutil.Scenario) {
+	defer func() {
+		if recovered := recover(); recovered != nil && recovered != errScenarioFailed {
+			r.failure = fmt.Sprintf("panic: %v", recovered)
+		}
+	}()
+	scenario.Run(r)
+}
+
+func runSelftest(args []string) int {
+	fs := newFlagSet("selftest")
+	only := fs.String("run", "", "run only the scenario with this `name`")
+	verbose := fs.Bool("v", false, "show node logs and scenario output")
+	simulate := fs.Int("simulate", 0, "instead of the scenarios, run this many `runs` of the replication simulator")
+	seed := fs.Int64("seed", 1, "first simulator `seed`; run i uses seed+i")
+	steps := fs.Int("steps", 0, "simulator steps per run (default 200)")
+	drop := fs.Float64("drop", 0, "simulator chance of dropping a message")
+	patches := fs.Bool("patches", false, "mix merge patches into simulated writes")
+	fs.Parse(args)
+
+	if *simulate > 0 {
+		options := testutil.SimOptions{
+			Steps:         *steps,
+			DropRate:      *drop,
+			DuplicateRate: 0.1,
+			MaxSkew:       200 * time.Millisecond,
+			Patches:       *patches,
+		}
+		return runSimulations(*simulate, *seed, options, *verbose)
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	failed, ran := 0, 0
+	for _, scenario := range testutil.Scenarios {
+		if *only != "" && scenario.Name != *only {
+			continue
+		}
+		ran++
+
+		run := &selftestRun{verbose: *verbose}
+		started := time.Now()
+		run.run(scenario)
+		elapsed := time.Since(started).Round(time.Millisecond)
+		if run.failure != "" {
+			failed++
+			fmt.Printf("FAIL %-18s %v\n    %s\n", scenario.Name, elapsed, run.failure)
+		} else {
+			fmt.Printf("ok   %-18s %v\n", scenario.Name, elapsed)
+		}
+	}
+
+	if ran == 0 {
+		fmt.Fprintf(os.Stderr, "no scenario named %q\n", *only)
+		return 2
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d scenarios failed\n", failed, ran)
+		return 1
+	}
+	return 0
+}
+
+// runSimulations runs the simulator for runs seeds from first, and prints
+// every seed that diverged. The trace of the first is printed in full with
+// verbose, otherwise only its last steps.
+func runSimulations(runs int, first int64, options testutil.SimOptions, verbose bool) int {
+	const traceTail = 20
+
+	var diverged []*testutil.SimResult
+	delivered, dropped, duplicated := 0, 0, 0
+	for i := 0; i < runs; i++ {
+		options.Seed = first + int64(i)
+		result := testutil.Simulate(options)
+		delivered += result.Delivered
+		dropped += result.Dropped
+		duplicated += result.Duplicated
+		if result.Diverged() || len(result.Violations) > 0 {
+			diverged = append(diverged, result)
+			fmt.Printf("FAIL seed %d\n", result.Seed)
+			for _, divergence := range result.Divergence {
+				fmt.Printf("    %s\n", divergence)
+			}
+			for _, violation := range result.Violations {
+				fmt.Printf("    invariant: %s\n", violation)
+			}
+		}
+	}
+	fmt.Printf("%d runs, %d messages delivered, %d dropped, %d duplicated\n", runs, delivered, dropped, duplicated)
+	if len(diverged) == 0 {
+		fmt.Println("ok   all runs converged")
+		return 0
+	}
+
+	trace := diverged[0].Trace
+	if !verbose && len(trace) > traceTail {
+		trace = trace[len(trace)-traceTail:]
+	}
+	fmt.Printf("trace of seed %d:\n", diverged[0].Seed)
+	for _, line := range trace {
+		fmt.Printf("    %s\n", line)
+	}
+	fmt.Printf("%d of %d runs diverged\n", len(diverged), runs)
+	return 1
+}
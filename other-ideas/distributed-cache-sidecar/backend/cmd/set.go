@@ -0,0 +1,101 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// handleSetUpdate adds the request's members to the set under key, or
+// removes them when remove is set, and answers with how many changed and
+// the set's new size.
+func handleSetUpdate(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, remove bool) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Members     []string          `json:"members"`
+		TTL         int64             `json:"ttl"`
+		Sliding     bool              `json:"sliding"`
+		Metadata    map[string]string `json:"metadata"`
+		LocalOnly   bool              `json:"local_only"`
+		Consistency string            `json:"consistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Members) == 0 {
+		http.Error(w, "members must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	options := cache.WriteOptions{
+		TTL:       time.Duration(request.TTL) * time.Second,
+		Sliding:   request.Sliding,
+		Metadata:  request.Metadata,
+		LocalOnly: request.LocalOnly,
+	}
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changed, size, verb := 0, 0, "added"
+	if remove {
+		verb = "removed"
+		changed, size, err = cacheManager.SetRemove(r.Context(), key, request.Members, options)
+	} else {
+		changed, size, err = cacheManager.SetAdd(r.Context(), key, request.Members, options)
+	}
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		verb:     changed,
+		"size":   size,
+	})
+}
+
+// handleSetMembers answers with the members of the set under key, or with
+// whether the member query parameter is one of them when it is given.
+func handleSetMembers(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if query := r.URL.Query(); query.Has("member") {
+		member := query.Get("member")
+		contains, err := cacheManager.SetContains(r.Context(), key, member)
+		if err != nil {
+			http.Error(w, err.Error(), cacheErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"member":   member,
+			"contains": contains,
+		})
+		return
+	}
+
+	members, err := cacheManager.SetMembers(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"members": members,
+		"size":    len(members),
+	})
+}
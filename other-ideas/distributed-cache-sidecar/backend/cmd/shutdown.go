@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/backup"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/federation"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/persistence"
+	"distributed-cache-sidecar/internal/udf"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// shutdownSequence stops the node in order, each phase within its own
+// budget and all of them within the total one: stop accepting connections,
+// drain HTTP requests, flush replication to the remote cluster, save the
+// snapshot file and write a checkpoint, then close everything else. A phase that runs out of time is
+// cut short and the next one starts; when the total runs out the process
+// exits wherever it is. run returns the registered goroutines that were
+// still running at the end, which are leaks.
+type shutdownSequence struct {
+	budget      config.ShutdownConfig
+	server      *http.Server
+	tcpServer   *network.TCPServer
+	peerManager *network.PeerManager
+	rebalancer  *network.Rebalancer
+	federation  *federation.Link
+	backups     *backup.Coordinator
+	snapshotter *persistence.Snapshotter
+	udfRegistry *udf.Registry
+	eventLog    *persistence.EventLog
+}
+
+// goroutineExitGrace is how long registered goroutines get to exit once
+// everything has been stopped before the ones left are reported as leaks.
+const goroutineExitGrace = 2 * time.Second
+
+func (s *shutdownSequence) run() []lifecycle.Goroutine {
+	start := time.Now()
+	deadline := start.Add(time.Duration(s.budget.TotalMS) * time.Millisecond)
+	time.AfterFunc(time.Until(deadline), func() {
+		log.Printf("Shutdown budget of %dms exhausted, exiting", s.budget.TotalMS)
+		events.Record(events.KindError, "Shutdown budget of %dms exhausted", s.budget.TotalMS)
+		os.Exit(1)
+	})
+
+	s.tcpServer.StopAccepting()
+	lifecycle.Stop()
+
+	phase := time.Now()
+	ctx, cancel := s.phase(deadline, s.budget.DrainHTTPMS)
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP drain cut off after %v: %v", time.Since(phase).Round(time.Millisecond), err)
+		events.Record(events.KindError, "HTTP drain cut off after %v", time.Since(phase).Round(time.Millisecond))
+		s.server.Close()
+	} else {
+		log.Printf("HTTP drained in %v", time.Since(phase).Round(time.Millisecond))
+	}
+	cancel()
+
+	if s.federation != nil {
+		phase = time.Now()
+		ctx, cancel = s.phase(deadline, s.budget.FlushReplicationMS)
+		if pending := s.federation.Drain(ctx); pending > 0 {
+			log.Printf("Replication flush cut off after %v with %d items unsent", time.Since(phase).Round(time.Millisecond), pending)
+		} else {
+			log.Printf("Replication flushed in %v", time.Since(phase).Round(time.Millisecond))
+		}
+		cancel()
+		s.federation.Stop()
+	}
+
+	if s.snapshotter != nil {
+		if status, err := s.snapshotter.Save(); err == nil {
+			log.Printf("Saved %d items to %s in %dms", status.Items, status.Path, status.DurationMS)
+		}
+	}
+
+	if s.budget.SnapshotMS > 0 {
+		phase = time.Now()
+		ctx, cancel = s.phase(deadline, s.budget.SnapshotMS)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			manifest, err := s.backups.Checkpoint()
+			if err != nil {
+				log.Printf("Shutdown checkpoint failed: %v", err)
+				events.Record(events.KindError, "Shutdown checkpoint failed: %v", err)
+				return
+			}
+			log.Printf("Wrote checkpoint %s in %v", manifest.ID, time.Since(phase).Round(time.Millisecond))
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Printf("Checkpoint cut off after %v", time.Since(phase).Round(time.Millisecond))
+		}
+		cancel()
+	}
+
+	s.rebalancer.Stop()
+	s.tcpServer.Stop()
+	s.peerManager.Stop()
+	ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	s.udfRegistry.Close(ctx)
+	if s.eventLog != nil {
+		s.eventLog.Close()
+	}
+
+	ctx, cancel = s.phase(deadline, int(goroutineExitGrace/time.Millisecond))
+	defer cancel()
+	leaked := lifecycle.Wait(ctx)
+	for _, g := range leaked {
+		log.Printf("Goroutine %s %s started %v ago is still running", g.Name, g.Detail, time.Since(g.Started).Round(time.Second))
+	}
+	if len(leaked) > 0 {
+		events.Record(events.KindError, "Shutdown left %d registered goroutines running", len(leaked))
+	}
+	log.Printf("Shutdown took %v", time.Since(start).Round(time.Millisecond))
+	return leaked
+}
+
+// phase returns a context for a phase of budgetMS that ends no later than
+// the overall deadline.
+func (s *shutdownSequence) phase(deadline time.Time, budgetMS int) (context.Context, context.CancelFunc) {
+	end := time.Now().Add(time.Duration(budgetMS) * time.Millisecond)
+	if end.After(deadline) {
+		end = deadline
+	}
+	return context.WithDeadline(context.Background(), end)
+}
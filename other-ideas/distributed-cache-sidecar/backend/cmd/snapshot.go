@@ -0,0 +1,54 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/persistence"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func handleGetSnapshot(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	view := cacheManager.View()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&persistence.Snapshot{
+		NodeID:    cacheManager.NodeID(),
+		Region:    cacheManager.Region(),
+		CreatedAt: view.At,
+		Sequence:  view.Sequence,
+		Items:     view.Items,
+	})
+}
+
+// handlePutSnapshot replaces this node's cache with the uploaded snapshot.
+// Like a backup restore it is node-local and isn't replicated.
+func handlePutSnapshot(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	var snapshot persistence.Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		http.Error(w, "Invalid snapshot", http.StatusBadRequest)
+		return
+	}
+
+	cacheManager.Restore(snapshot.Items)
+	log.Printf("Restored %d items from a snapshot of node %s", len(snapshot.Items), snapshot.NodeID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "restored",
+		"items":    len(snapshot.Items),
+		"sequence": cacheManager.Sequence(),
+	})
+}
+
+// handleSaveSnapshot saves this node's cache to its snapshot file now,
+// rather than at the next interval.
+func handleSaveSnapshot(w http.ResponseWriter, r *http.Request, snapshotter *persistence.Snapshotter) {
+	status, err := snapshotter.Save()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
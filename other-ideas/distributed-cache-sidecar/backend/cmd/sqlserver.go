@@ -0,0 +1,84 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/analytics"
+	"distributed-cache-sidecar/internal/sqlserver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// handleSQLQuery answers a SQL Server query from the cache, running it on
+// a miss.
+func handleSQLQuery(w http.ResponseWriter, r *http.Request, adapter *sqlserver.Adapter) {
+	var request struct {
+		sqlserver.Query
+		TTL int64 `json:"ttl"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	// Numbers stay exact until they are bound.
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.SQL == "" {
+		http.Error(w, "query must not be empty", http.StatusBadRequest)
+		return
+	}
+	if request.TTL < 0 {
+		http.Error(w, "Invalid ttl", http.StatusBadRequest)
+		return
+	}
+	request.Query.TTL = time.Duration(request.TTL) * time.Second
+
+	item, cached, err := adapter.Query(r.Context(), request.Query)
+	if err != nil {
+		http.Error(w, err.Error(), sqlErrorStatus(err))
+		return
+	}
+	analytics.SetOutcome(r, cached)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     item.Key,
+		"cached":  cached,
+		"version": item.Version,
+		"tables":  item.Metadata[sqlserver.TablesMetadata],
+		"result":  json.RawMessage(item.Value),
+	})
+}
+
+// handleSQLInvalidate drops the cached results of queries that read a
+// table.
+func handleSQLInvalidate(w http.ResponseWriter, r *http.Request, adapter *sqlserver.Adapter) {
+	table := pathVar(r, "table")
+	deleted, err := adapter.Invalidate(r.Context(), table)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "invalidated",
+		"table":   sqlserver.NormalizeTable(table),
+		"deleted": deleted,
+	})
+}
+
+// sqlErrorStatus maps adapter errors to HTTP statuses; a query the server
+// rejected or failed to run is the database's fault, not the caller's.
+func sqlErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sqlserver.ErrNotQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, sqlserver.ErrTooManyRows):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, sqlserver.ErrQueryFailed):
+		return http.StatusBadGateway
+	}
+	return cacheErrorStatus(err)
+}
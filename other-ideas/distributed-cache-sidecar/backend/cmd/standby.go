@@ -0,0 +1,24 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// handlePromote turns a standby into a data node. Its peers put it on
+// their rings as soon as they hear of it, and it starts serving clients.
+func handlePromote(w http.ResponseWriter, r *http.Request, nodeID string, peerManager *network.PeerManager) {
+	if !peerManager.Promote() {
+		http.Error(w, "Node is not a standby", http.StatusConflict)
+		return
+	}
+	log.Printf("Promoted %s from standby", nodeID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"node_id":   nodeID,
+		"node_mode": peerManager.NodeMode(),
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"net/http"
+)
+
+// handleTagged lists the keys of the items this node holds that carry a
+// tag.
+func handleTagged(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	tag := pathVar(r, "tag")
+	if err := cache.ValidateTag(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys := cacheManager.Tagged(tag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tag":   tag,
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// handleInvalidateTag deletes every item carrying a tag, here and on
+// peers.
+func handleInvalidateTag(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager) {
+	tag := pathVar(r, "tag")
+	if err := cache.ValidateTag(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var options cache.WriteOptions
+	var err error
+	if options.Consistency, err = cache.ParseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.LocalOnly = r.URL.Query().Get("local_only") == "true"
+
+	deleted, err := cacheManager.InvalidateTag(r.Context(), tag, options)
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "invalidated",
+		"tag":     tag,
+		"deleted": deleted,
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/pkg/ring"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type topologyNode struct {
+	NodeID    string  `json:"node_id"`
+	Region    string  `json:"region"`
+	Zone      string  `json:"zone,omitempty"`
+	Group     string  `json:"group,omitempty"`
+	URL       string  `json:"url"`
+	Connected bool    `json:"connected"`
+	Weight    float64 `json:"weight"`
+}
+
+const maxTopologyWait = 60 * time.Second
+
+// handleTopology describes the ring clients hash keys onto. Only peers
+// that completed a handshake (and so reported their node ID and HTTP
+// endpoint) are included; witnesses and standbys, which own no keys, and
+// nodes the leader has declared dead are left out. With ?watch=<version> the request waits, up to ?timeout_ms (25s by
+// default), for the topology version to move past version, so clients
+// learn about failovers as they happen.
+func handleTopology(w http.ResponseWriter, r *http.Request, cfg *config.Config, cacheManager *cache.Manager, peerManager *network.PeerManager) {
+	state := peerManager.Topology()
+	if watch := r.URL.Query().Get("watch"); watch != "" {
+		version, err := strconv.ParseUint(watch, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid watch version", http.StatusBadRequest)
+			return
+		}
+		wait := 25 * time.Second
+		if value := r.URL.Query().Get("timeout_ms"); value != "" {
+			ms, err := strconv.Atoi(value)
+			if err != nil || ms < 0 {
+				http.Error(w, "Invalid timeout_ms", http.StatusBadRequest)
+				return
+			}
+			wait = time.Duration(ms) * time.Millisecond
+		}
+		if wait > maxTopologyWait {
+			wait = maxTopologyWait
+		}
+		state = peerManager.WaitTopology(version, wait)
+	}
+
+	selfURL := cfg.AdvertiseURL
+	if selfURL == "" {
+		selfURL = "http://" + r.Host
+	}
+
+	var nodes []topologyNode
+	if peerManager.NodeMode() == config.NodeModeData {
+		nodes = append(nodes, topologyNode{
+			NodeID:    cacheManager.NodeID(),
+			Region:    cacheManager.Region(),
+			Zone:      cfg.Placement.Zone,
+			Group:     cfg.Placement.Group,
+			URL:       selfURL,
+			Connected: true,
+			Weight:    cfg.Placement.Weight,
+		})
+	}
+	dead := make(map[string]bool, len(state.Dead))
+	for _, nodeID := range state.Dead {
+		dead[nodeID] = true
+	}
+	for _, peer := range peerManager.GetPeers() {
+		if peer.NodeID == "" || peer.HTTPURL == "" || (peer.Mode != "" && peer.Mode != config.NodeModeData) || dead[peer.NodeID] {
+			continue
+		}
+		nodes = append(nodes, topologyNode{
+			NodeID:    peer.NodeID,
+			Region:    peer.Region,
+			Zone:      peer.Zone,
+			Group:     peer.Group,
+			URL:       peer.HTTPURL,
+			Connected: peer.Connected,
+			Weight:    peer.Weight,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+
+	epoch := strconv.Itoa(cfg.Placement.VNodes) + ";" + strconv.FormatUint(state.Version, 10) + ";"
+	for i, node := range nodes {
+		if node.Weight <= 0 {
+			nodes[i].Weight = 1
+		}
+		epoch += node.NodeID + "=" + node.URL + "*" + strconv.FormatFloat(nodes[i].Weight, 'g', -1, 64) + "#" + node.Group + ";"
+	}
+	prefixes := make([]string, 0, len(cfg.Placement.PrefixGroups))
+	for prefix, group := range cfg.Placement.PrefixGroups {
+		prefixes = append(prefixes, prefix+"="+group)
+	}
+	sort.Strings(prefixes)
+	epoch += strings.Join(prefixes, ",")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"epoch":   fmt.Sprintf("%016x", ring.Hash(epoch)),
+		"version": state.Version,
+		"vnodes":  cfg.Placement.VNodes,
+		"placement": map[string]interface{}{
+			"mode":               cfg.Placement.Mode,
+			"replication_factor": cfg.Placement.ReplicationFactor,
+			"spread_by":          cfg.Placement.SpreadBy,
+			"prefix_groups":      cfg.Placement.PrefixGroups,
+		},
+		"nodes":     nodes,
+		"dead":      state.Dead,
+		"witnesses": peerManager.Witnesses(),
+		"standbys":  peerManager.Standbys(),
+	})
+}
+
+// handlePlacementAudit reports keys held on this node whose replicas
+// aren't spread across failure domains.
+func handlePlacementAudit(w http.ResponseWriter, r *http.Request, peerManager *network.PeerManager) {
+	samples := 20
+	if value := r.URL.Query().Get("samples"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid samples", http.StatusBadRequest)
+			return
+		}
+		samples = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peerManager.AuditPlacement(samples))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// itemResponse is an item as the API returns it, with when it expires
+// worked out for the caller. Items without a TTL omit both fields.
+type itemResponse struct {
+	*cache.CacheItem
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RemainingTTL int64      `json:"remaining_ttl,omitempty"`
+}
+
+func newItemResponse(cacheManager *cache.Manager, item *cache.CacheItem) *itemResponse {
+	expiry := cacheManager.Expiry(item)
+	response := &itemResponse{CacheItem: item, ExpiresAt: expiry.ExpiresAt}
+	if expiry.ExpiresAt != nil {
+		response.RemainingTTL = expiry.RemainingTTL
+	}
+	return response
+}
+
+// handleCacheTTL reports when an item expires, without reading it.
+func handleCacheTTL(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiry, err := cacheManager.TTL(r.Context(), key)
+	if errors.Is(err, cache.ErrNotFound) {
+		if ownerErr := peerManager.CheckOwner(key); ownerErr != nil {
+			err = ownerErr
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), cacheErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expiry)
+}
+
+// handleExpireCache gives an item a new TTL, in seconds from now, without
+// sending its value again. With persist set it removes the TTL instead.
+func handleExpireCache(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, peerManager *network.PeerManager, persist bool) {
+	key, err := cacheKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		TTL         int64  `json:"ttl"`
+		Consistency string `json:"consistency"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	var options cache.WriteOptions
+	if options.Consistency, err = cache.ParseConsistency(request.Consistency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var item *cache.CacheItem
+	if persist {
+		item, err = cacheManager.Persist(r.Context(), key, options)
+	} else {
+		item, err = cacheManager.Expire(r.Context(), key, time.Duration(request.TTL)*time.Second, options)
+	}
+	if errors.Is(err, cache.ErrNotFound) {
+		if ownerErr := peerManager.CheckOwner(key); ownerErr != nil {
+			err = ownerErr
+		}
+	}
+	if err != nil {
+		writeSetError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":  "updated",
+		"version": item.Version,
+		"ttl":     item.TTL,
+	}
+	if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+		response["expires_at"] = expiresAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionTag(item.Version))
+	json.NewEncoder(w).Encode(response)
+}
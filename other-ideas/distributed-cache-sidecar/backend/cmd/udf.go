@@ -0,0 +1,144 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/query"
+	"distributed-cache-sidecar/internal/udf"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const maxUDFModuleSize = 8 << 20
+
+type udfInputItem struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type udfInput struct {
+	Items   []udfInputItem  `json:"items"`
+	Missing []string        `json:"missing"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+func handleListUDFs(w http.ResponseWriter, r *http.Request, udfRegistry *udf.Registry) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(udfRegistry.List())
+}
+
+func handlePutUDF(w http.ResponseWriter, r *http.Request, udfRegistry *udf.Registry) {
+	name := pathVar(r, "name")
+
+	wasm, err := io.ReadAll(io.LimitReader(r.Body, maxUDFModuleSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(wasm) > maxUDFModuleSize {
+		http.Error(w, "Module too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	info, err := udfRegistry.Register(r.Context(), name, wasm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func handleDeleteUDF(w http.ResponseWriter, r *http.Request, udfRegistry *udf.Registry) {
+	name := pathVar(r, "name")
+
+	if !udfRegistry.Remove(r.Context(), name) {
+		http.Error(w, "UDF not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "name": name})
+}
+
+func handleInvokeUDF(w http.ResponseWriter, r *http.Request, cacheManager *cache.Manager, udfRegistry *udf.Registry, derived *query.DerivedCache) {
+	name := pathVar(r, "name")
+
+	var request struct {
+		Key  string          `json:"key"`
+		Keys []string        `json:"keys"`
+		Args json.RawMessage `json:"args"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	keys := request.Keys
+	if request.Key != "" {
+		keys = append([]string{request.Key}, keys...)
+	}
+	if len(keys) == 0 {
+		http.Error(w, "Missing key or keys", http.StatusBadRequest)
+		return
+	}
+
+	info, exists := udfRegistry.Lookup(name)
+	if !exists {
+		http.Error(w, "UDF not found", http.StatusNotFound)
+		return
+	}
+
+	input := udfInput{Items: []udfInputItem{}, Missing: []string{}, Args: request.Args}
+	deps := make([]query.Dependency, 0, len(keys))
+	for _, key := range keys {
+		item, exists := cacheManager.Get(key)
+		if !exists {
+			input.Missing = append(input.Missing, key)
+			deps = append(deps, query.Dependency{Key: key})
+			continue
+		}
+		input.Items = append(input.Items, udfInputItem{Key: item.Key, Value: item.Value, Encoding: item.Encoding})
+		deps = append(deps, itemDependency(item))
+	}
+
+	// Modules have no imports, so their output depends only on the input
+	// and is safe to reuse until one of the items or the module changes.
+	cacheQuery := "udf:" + name + ":" + info.SHA256 + ":" + string(request.Args)
+	var output []byte
+	if cached, found := derived.Get(cacheQuery, deps...); found {
+		output = cached.([]byte)
+	} else {
+		payload, err := json.Marshal(input)
+		if err != nil {
+			http.Error(w, "Failed to encode input", http.StatusInternalServerError)
+			return
+		}
+
+		output, err = udfRegistry.Invoke(r.Context(), name, payload)
+		if err != nil {
+			if errors.Is(err, udf.ErrNotFound) {
+				http.Error(w, "UDF not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		derived.Put(cacheQuery, output, deps...)
+	}
+
+	var result interface{} = string(output)
+	if json.Valid(output) {
+		result = json.RawMessage(output)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"udf":     name,
+		"missing": input.Missing,
+		"result":  result,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/features"
+	"distributed-cache-sidecar/internal/schema"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type validationReport struct {
+	ConfigFile string           `json:"config_file"`
+	Valid      bool             `json:"valid"`
+	Errors     []config.Problem `json:"errors"`
+}
+
+// validateConfig checks the config file at path, with the environment
+// applied as it would be at startup, and prints a JSON report to stdout.
+// It returns the process exit code.
+func validateConfig(path string) int {
+	report := validationReport{ConfigFile: path, Errors: []config.Problem{}}
+	if path != "" {
+		report.Errors = append(report.Errors, config.CheckFile(path)...)
+	}
+
+	if len(report.Errors) == 0 {
+		cfg, err := config.LoadFrom(path)
+		if err != nil {
+			report.Errors = append(report.Errors, config.Problem{Message: err.Error()})
+		} else {
+			report.Errors = append(report.Errors, cfg.Validate()...)
+			report.Errors = append(report.Errors, validateComponents(cfg)...)
+		}
+	}
+	report.Valid = len(report.Errors) == 0
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// validateComponents builds the parts of the configuration that are only
+// checked by their constructors, so validation can't drift from startup.
+func validateComponents(cfg *config.Config) []config.Problem {
+	var problems []config.Problem
+
+	if _, err := cache.NewKeyPolicy(cfg.KeyPolicy.MaxLength, cfg.KeyPolicy.Pattern, cfg.KeyPolicy.RequiredPrefixes, cfg.KeyPolicy.RequireTenant, cfg.KeyPolicy.RejectURLUnsafe); err != nil {
+		problems = append(problems, config.Problem{Field: "key_policy", Message: err.Error()})
+	}
+
+	schemas := schema.NewRegistry()
+	for _, prefix := range sortedKeys(cfg.Schemas) {
+		if err := schemas.Register(prefix, cfg.Schemas[prefix]); err != nil {
+			problems = append(problems, config.Problem{Field: fmt.Sprintf("schemas[%q]", prefix), Message: err.Error()})
+		}
+	}
+
+	for i, hookCfg := range cfg.Hooks {
+		if _, err := cache.NewHook(hookCfg.Name, hookCfg.Args); err != nil {
+			problems = append(problems, config.Problem{Field: fmt.Sprintf("hooks[%d]", i), Message: err.Error()})
+		}
+	}
+
+	flagNames := make([]string, 0, len(cfg.Features))
+	for name := range cfg.Features {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	for _, name := range flagNames {
+		if err := features.NewFlags().Configure(map[string]bool{name: cfg.Features[name]}); err != nil {
+			problems = append(problems, config.Problem{Field: "features." + name, Message: err.Error()})
+		}
+	}
+
+	return problems
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
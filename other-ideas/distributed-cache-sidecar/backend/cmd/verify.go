@@ -0,0 +1,100 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// handleVerify runs a verification and returns its report. ?keys= sets
+// how many keys it writes and ?sla_ms= how long they may take to reach
+// every node. A run that finds discrepancies still answers 200; the
+// report's passed field says how it went.
+func handleVerify(w http.ResponseWriter, r *http.Request, verifier *network.Verifier) {
+	var options network.VerifyOptions
+	query := r.URL.Query()
+	if raw := query.Get("keys"); raw != "" {
+		keys, err := strconv.Atoi(raw)
+		if err != nil || keys <= 0 || keys > 1000 {
+			http.Error(w, "Invalid keys, expected 1 to 1000", http.StatusBadRequest)
+			return
+		}
+		options.Keys = keys
+	}
+	if raw := query.Get("sla_ms"); raw != "" {
+		sla, err := strconv.Atoi(raw)
+		if err != nil || sla <= 0 {
+			http.Error(w, "Invalid sla_ms", http.StatusBadRequest)
+			return
+		}
+		options.SLA = time.Duration(sla) * time.Millisecond
+	}
+
+	report, err := verifier.Run(options)
+	if errors.Is(err, network.ErrVerifyRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if !report.Passed {
+		events.Record(events.KindError, "Verification %s failed: %d of %d keys converged within %dms, %d discrepancies, %d peers unreachable",
+			report.RunID, report.Converged, report.Keys, report.SLAMS, len(report.Discrepancies), len(report.Unreachable))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func handleLastVerify(w http.ResponseWriter, r *http.Request, verifier *network.Verifier) {
+	report := verifier.Last()
+	if report == nil {
+		http.Error(w, "No verification has run on this node", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func runVerify(args []string) int {
+	fs, addr := adminFlagSet("verify")
+	keys := fs.Int("keys", 0, "`number` of keys to write (default 20)")
+	sla := fs.Duration("sla", 0, "how long keys may take to reach every node (default 5s)")
+	fs.Parse(args)
+
+	query := url.Values{}
+	if *keys > 0 {
+		query.Set("keys", strconv.Itoa(*keys))
+	}
+	if *sla > 0 {
+		query.Set("sla_ms", strconv.FormatInt(sla.Milliseconds(), 10))
+	}
+
+	var report network.VerifyReport
+	if err := adminRequest(http.MethodPost, *addr, "/api/admin/verify?"+query.Encode(), nil, &report); err != nil {
+		return fail(err)
+	}
+
+	fmt.Printf("Run %s on %d nodes: %d of %d keys converged within %dms (slowest %dms)\n",
+		report.RunID, len(report.Nodes), report.Converged, report.Keys, report.SLAMS, report.SlowestMS)
+	for _, address := range report.Unreachable {
+		fmt.Printf("  unreachable: %s\n", address)
+	}
+	for _, d := range report.Discrepancies {
+		got := d.Error
+		if got == "" {
+			got = fmt.Sprintf("value %q", d.Got)
+		}
+		fmt.Printf("  %s on %s (written on %s): %s\n", d.Key, d.NodeID, d.WrittenOn, got)
+	}
+	if !report.Passed {
+		fmt.Fprintln(os.Stderr, "Verification failed")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/features"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/version"
+	"encoding/json"
+	"net/http"
+)
+
+func handleVersion(w http.ResponseWriter, r *http.Request, cfg *config.Config, flags *features.Flags) {
+	protocols := make([]int, 0, network.ProtocolVersion-network.MinProtocolVersion+1)
+	for v := network.MinProtocolVersion; v <= network.ProtocolVersion; v++ {
+		protocols = append(protocols, v)
+	}
+
+	response := struct {
+		version.Info
+		Protocols []int           `json:"protocol_versions"`
+		Features  map[string]bool `json:"features"`
+	}{
+		Info:      version.Get(),
+		Protocols: protocols,
+		Features: map[string]bool{
+			"tls":          false,
+			"partitioning": false,
+			"grpc":         false,
+			"persistence":  cfg.EventLogPath != "",
+			"federation":   cfg.Federation.Role != "",
+			"backups":      true,
+			"udf":          flags.Enabled(features.UDF),
+			"json_patch":   true,
+			"jsonpath":     true,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
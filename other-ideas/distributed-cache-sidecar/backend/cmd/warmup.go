@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/events"
+	"log"
+	"os"
+	"time"
+)
+
+// warmUp caches the entries of the warm-up file at path. It runs before
+// the node listens, so the node serves no requests, and fails readiness
+// checks, until the file is loaded. A file that can't be loaded stops the
+// node.
+func warmUp(cacheManager *cache.Manager, path string) {
+	start := time.Now()
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open warm-up file: %v", err)
+	}
+	defer file.Close()
+
+	result, err := cacheManager.WarmUp(context.Background(), file)
+	if err != nil {
+		log.Fatalf("Failed to warm up from %s: %v", path, err)
+	}
+	log.Printf("Warmed up %d items from %s in %s, %d already held", result.Loaded, path, time.Since(start).Round(time.Millisecond), result.Skipped)
+	events.Record(events.KindLifecycle, "Warmed up %d items from %s, %d already held", result.Loaded, path, result.Skipped)
+}
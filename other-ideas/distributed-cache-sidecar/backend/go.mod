@@ -5,5 +5,19 @@ go 1.18
 require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/klauspost/compress v1.17.0
+	github.com/microsoft/go-mssqldb v1.5.0
 	github.com/rs/cors v1.10.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.0
+	github.com/tetratelabs/wazero v1.2.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/sys v0.15.0
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/golang-sql/civil v0.0.0-20220223132316-b832511892a9 // indirect
+	github.com/golang-sql/sqlexp v0.1.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/crypto v0.9.0 // indirect
 )
@@ -0,0 +1,360 @@
+// Package analytics streams anonymous usage events, so course authors can see
+// how learners use the cached content: which endpoints they call, in
+// which namespaces, how fast they are answered and whether reads hit.
+// Events carry no keys, values, client addresses or user IDs, only the
+// route template of the request, and are sampled; learners opt out per
+// request and operators per namespace.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var logger = logging.New("analytics")
+
+var eventsTotal = metrics.NewCounter("sidecar_analytics_events_total",
+	"Analytics events, by whether they were sent, dropped or failed to send.", "result")
+
+// Outcomes of reads.
+const (
+	OutcomeHit  = "hit"
+	OutcomeMiss = "miss"
+)
+
+// latencyBuckets are the upper bounds events report latency by.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// Event is one recorded request.
+type Event struct {
+	Time   time.Time `json:"time"`
+	NodeID string    `json:"node_id"`
+	Region string    `json:"region"`
+	// Endpoint is the method and route template, e.g.
+	// "GET /api/cache/{key}".
+	Endpoint  string `json:"endpoint"`
+	Namespace string `json:"namespace,omitempty"`
+	Status    int    `json:"status"`
+	// Latency is the bound of the smallest bucket the request was
+	// answered within, e.g. "25ms", or "1s+" beyond the last.
+	Latency string `json:"latency"`
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// Status describes the stream.
+type Status struct {
+	Sink       string    `json:"sink"`
+	SampleRate float64   `json:"sample_rate"`
+	Pending    int       `json:"pending"`
+	Sent       int64     `json:"sent"`
+	Dropped    int64     `json:"dropped"`
+	Failures   int64     `json:"failures"`
+	LastSent   time.Time `json:"last_sent"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Stream records sampled requests and sends them to its sink in batches.
+type Stream struct {
+	cfg    config.AnalyticsConfig
+	nodeID string
+	region string
+	sink   sink
+	optOut map[string]bool
+
+	pending []Event
+	status  Status
+	wake    chan struct{}
+	mutex   sync.Mutex
+}
+
+// New returns a Stream sending to the sink cfg configures.
+func New(cfg config.AnalyticsConfig, nodeID, region string) (*Stream, error) {
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+	optOut := make(map[string]bool, len(cfg.OptOutNamespaces))
+	for _, ns := range cfg.OptOutNamespaces {
+		optOut[strings.TrimSpace(ns)] = true
+	}
+	return &Stream{
+		cfg:    cfg,
+		nodeID: nodeID,
+		region: region,
+		sink:   sink,
+		optOut: optOut,
+		status: Status{Sink: sink.String(), SampleRate: cfg.SampleRate},
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Start sends pending events every FlushIntervalMS, or as soon as a batch
+// is full, until the process begins shutting down, then sends what is
+// left.
+func (s *Stream) Start() {
+	lifecycle.Go("analytics-sender", s.sink.String(), func() {
+		interval := time.Duration(s.cfg.FlushIntervalMS) * time.Millisecond
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		backoff := interval
+		for {
+			select {
+			case <-lifecycle.Stopping():
+				s.flush()
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+
+			if err := s.flush(); err != nil {
+				select {
+				case <-lifecycle.Stopping():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = interval
+		}
+	})
+}
+
+// Status returns the stream's counters.
+func (s *Stream) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := s.status
+	status.Pending = len(s.pending)
+	return status
+}
+
+// flush sends the pending events, a batch at a time, until none are left
+// or a batch fails, which stays pending.
+func (s *Stream) flush() error {
+	for {
+		s.mutex.Lock()
+		n := len(s.pending)
+		if n > s.cfg.BatchSize {
+			n = s.cfg.BatchSize
+		}
+		batch := append([]Event(nil), s.pending[:n]...)
+		s.mutex.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := s.sink.send(ctx, batch)
+		cancel()
+
+		s.mutex.Lock()
+		if err != nil {
+			s.status.Failures++
+			s.status.LastError = err.Error()
+			s.mutex.Unlock()
+			eventsTotal.Add(uint64(len(batch)), "failed")
+			logger.Printf("Failed to send analytics events to %s: %v", s.sink, err)
+			events.Record(events.KindError, "Failed to send analytics events to %s: %v", s.sink, err)
+			return err
+		}
+		// Events may have been dropped from the front while sending.
+		drop := n
+		if drop > len(s.pending) {
+			drop = len(s.pending)
+		}
+		s.pending = s.pending[drop:]
+		s.status.Sent += int64(len(batch))
+		s.status.LastSent = time.Now()
+		s.status.LastError = ""
+		s.mutex.Unlock()
+		eventsTotal.Add(uint64(len(batch)), "sent")
+	}
+}
+
+// record queues event, dropping the oldest pending one if the queue is
+// full.
+func (s *Stream) record(event Event) {
+	s.mutex.Lock()
+	if len(s.pending) >= s.cfg.MaxPending {
+		s.pending = s.pending[1:]
+		s.status.Dropped++
+		eventsTotal.Inc("dropped")
+	}
+	s.pending = append(s.pending, event)
+	full := len(s.pending) >= s.cfg.BatchSize
+	s.mutex.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// outcomeKey is the context key of the *string a handler reports the
+// outcome of a read in.
+type outcomeKey struct{}
+
+// SetOutcome reports whether the read r made hit the cache. Requests
+// that aren't being recorded ignore it.
+func SetOutcome(r *http.Request, hit bool) {
+	outcome, recording := r.Context().Value(outcomeKey{}).(*string)
+	if !recording {
+		return
+	}
+	if hit {
+		*outcome = OutcomeHit
+	} else {
+		*outcome = OutcomeMiss
+	}
+}
+
+// Middleware records the requests to the routes of a mux router it is
+// used on. Register it with Router.Use, which runs it once the route is
+// matched.
+func (s *Stream) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.sampled(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ns := namespace(r)
+		if s.optOut[ns] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		outcome := ""
+		writer := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), outcomeKey{}, &outcome)))
+
+		s.record(Event{
+			Time:      start.UTC(),
+			NodeID:    s.nodeID,
+			Region:    s.region,
+			Endpoint:  r.Method + " " + routeTemplate(r),
+			Namespace: s.anonymize(ns),
+			Status:    writer.status,
+			Latency:   latencyBucket(time.Since(start)),
+			Outcome:   outcome,
+		})
+	})
+}
+
+// sampled reports whether r is to be recorded: it hasn't opted out, isn't
+// a WebSocket, whose connection the stream can't follow, and falls in
+// the sample.
+func (s *Stream) sampled(r *http.Request) bool {
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	if optOut, err := strconv.ParseBool(r.Header.Get("X-Analytics-Opt-Out")); err == nil && optOut {
+		return false
+	}
+	return s.cfg.SampleRate >= 1 || rand.Float64() < s.cfg.SampleRate
+}
+
+// anonymize returns the namespace recorded for ns: ns itself, or with
+// NamespaceSalt set, the start of its keyed hash, which groups events by
+// namespace without naming it.
+func (s *Stream) anonymize(ns string) string {
+	if ns == "" || s.cfg.NamespaceSalt == "" {
+		return ns
+	}
+	mac := hmac.New(sha256.New, []byte(s.cfg.NamespaceSalt))
+	mac.Write([]byte(ns))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// namespace returns the namespace r is made in, from its path or the key
+// it names.
+func namespace(r *http.Request) string {
+	vars := mux.Vars(r)
+	if ns, inNamespace := vars["ns"]; inNamespace {
+		return ns
+	}
+	key, err := url.PathUnescape(vars["key"])
+	if err != nil {
+		return ""
+	}
+	ns, _ := cache.SplitNamespace(key)
+	return ns
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+func latencyBucket(latency time.Duration) string {
+	for _, bound := range latencyBuckets {
+		if latency <= bound {
+			return bound.String()
+		}
+	}
+	return latencyBuckets[len(latencyBuckets)-1].String() + "+"
+}
+
+// statusWriter remembers the status of the response it writes.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming handlers flush through it.
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,124 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/eventhubs"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// sink is where batches of events are sent.
+type sink interface {
+	send(ctx context.Context, batch []Event) error
+	// String names the sink in logs and status, without secrets.
+	String() string
+}
+
+func newSink(cfg config.AnalyticsConfig) (sink, error) {
+	switch cfg.Sink {
+	case "file":
+		return fileSink{path: cfg.Path}, nil
+	case "webhook":
+		return webhookSink{url: cfg.URL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "eventhubs":
+		client, err := eventhubs.New(cfg.ConnectionString, "", 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return eventHubSink{client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown analytics sink %q", cfg.Sink)
+}
+
+// fileSink appends events to a file as JSON lines.
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) send(ctx context.Context, batch []Event) error {
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, event := range batch {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(lines.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s fileSink) String() string {
+	return "file " + s.path
+}
+
+// webhookSink posts each batch as a JSON array.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s webhookSink) send(ctx context.Context, batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return nil
+}
+
+func (s webhookSink) String() string {
+	return "webhook " + redact(s.url)
+}
+
+// eventHubSink sends each event of a batch as a message of its own,
+// partitioned by namespace.
+type eventHubSink struct {
+	client *eventhubs.Client
+}
+
+func (s eventHubSink) send(ctx context.Context, batch []Event) error {
+	messages := make([]eventhubs.Message, len(batch))
+	for i, event := range batch {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		messages[i] = eventhubs.Message{Body: body, PartitionKey: event.Namespace}
+	}
+	return s.client.Send(ctx, messages)
+}
+
+func (s eventHubSink) String() string {
+	return "eventhubs " + s.client.Hub()
+}
+
+// redact drops the query of a URL, which may hold a token.
+func redact(url string) string {
+	url, _, _ = strings.Cut(url, "?")
+	return url
+}
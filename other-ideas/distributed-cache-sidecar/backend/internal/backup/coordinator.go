@@ -0,0 +1,377 @@
+package backup
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/network"
+	"distributed-cache-sidecar/internal/persistence"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotLeader  = errors.New("this node is not the cluster leader")
+	ErrInProgress = errors.New("a backup is already in progress")
+	ErrNotFound   = errors.New("backup not found")
+	ErrInvalidID  = errors.New("invalid backup id")
+)
+
+const (
+	manifestFile   = "manifest.json"
+	requestTimeout = 30 * time.Second
+	infoTimeout    = 2 * time.Second
+)
+
+var validID = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.-]*$`)
+
+// NodeBackup describes one node's part of a cluster backup. Sequence is the
+// node's mutation counter at the instant its checkpoint was taken; together
+// the per-node sequences form the cut the backup represents.
+type NodeBackup struct {
+	NodeID   string `json:"node_id"`
+	Region   string `json:"region"`
+	Address  string `json:"address,omitempty"`
+	Sequence uint64 `json:"sequence"`
+	Items    int    `json:"items"`
+	Path     string `json:"path"`
+	Error    string `json:"error,omitempty"`
+	// CollectedPath is where the coordinator holds a copy of the node's
+	// snapshot after Collect.
+	CollectedPath string `json:"collected_path,omitempty"`
+}
+
+type Manifest struct {
+	ID          string       `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Coordinator string       `json:"coordinator"`
+	Complete    bool         `json:"complete"`
+	Nodes       []NodeBackup `json:"nodes"`
+}
+
+type nodeRequest struct {
+	BackupID string `json:"backup_id"`
+}
+
+// Coordinator runs cluster-wide backups from the leader and serves the
+// BACKUP and RESTORE commands that peers' coordinators send to this node.
+// Every node writes its checkpoint to its own backup directory; the leader
+// additionally writes the manifest tying them together.
+type Coordinator struct {
+	dir          string
+	eventLogPath string
+	cacheManager *cache.Manager
+	peerManager  *network.PeerManager
+	mutex        sync.Mutex
+	running      bool
+}
+
+func NewCoordinator(dir, eventLogPath string, cacheManager *cache.Manager, peerManager *network.PeerManager) *Coordinator {
+	return &Coordinator{
+		dir:          dir,
+		eventLogPath: eventLogPath,
+		cacheManager: cacheManager,
+		peerManager:  peerManager,
+	}
+}
+
+func (c *Coordinator) RegisterCommands(server *network.TCPServer) {
+	server.RegisterCommand("BACKUP", func(payload string) string {
+		return c.serveCommand(payload, c.backupLocal)
+	})
+	server.RegisterCommand("RESTORE", func(payload string) string {
+		return c.serveCommand(payload, c.restoreLocal)
+	})
+	server.RegisterStream("SNAPSHOT_FILE", c.serveSnapshotFile)
+}
+
+func (c *Coordinator) serveCommand(payload string, run func(id string) (NodeBackup, error)) string {
+	var request nodeRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return fmt.Sprintf("ERROR|Failed to deserialize: %v", err)
+	}
+
+	result, err := run(request.BackupID)
+	if err != nil {
+		return fmt.Sprintf("ERROR|%v", err)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+	}
+	return fmt.Sprintf("OK|%s", string(data))
+}
+
+// Run takes a backup of the whole cluster. It must be called on the leader
+// so that concurrent requests on different nodes cannot produce competing
+// backups.
+func (c *Coordinator) Run() (*Manifest, error) {
+	leader := c.peerManager.Leader(infoTimeout)
+	if !leader.Self {
+		return nil, fmt.Errorf("%w: leader is %s", ErrNotLeader, leader.NodeID)
+	}
+
+	c.mutex.Lock()
+	if c.running {
+		c.mutex.Unlock()
+		return nil, ErrInProgress
+	}
+	c.running = true
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.running = false
+		c.mutex.Unlock()
+	}()
+
+	manifest := &Manifest{
+		ID:          time.Now().UTC().Format("20060102T150405.000000000Z"),
+		CreatedAt:   time.Now(),
+		Coordinator: c.cacheManager.NodeID(),
+	}
+	manifest.Nodes = c.fanOut("BACKUP", manifest.ID, c.peerManager.ClusterNodes(infoTimeout), c.backupLocal)
+
+	manifest.Complete = true
+	for _, node := range manifest.Nodes {
+		if node.Error != "" {
+			manifest.Complete = false
+		}
+	}
+
+	if err := c.writeManifest(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Checkpoint backs up this node alone, for a node that is shutting down.
+// The backup can be restored like a cluster backup, and restores only this
+// node.
+func (c *Coordinator) Checkpoint() (*Manifest, error) {
+	c.mutex.Lock()
+	if c.running {
+		c.mutex.Unlock()
+		return nil, ErrInProgress
+	}
+	c.running = true
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.running = false
+		c.mutex.Unlock()
+	}()
+
+	manifest := &Manifest{
+		ID:          time.Now().UTC().Format("20060102T150405.000000000Z"),
+		CreatedAt:   time.Now(),
+		Coordinator: c.cacheManager.NodeID(),
+	}
+	node, err := c.backupLocal(manifest.ID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Nodes = []NodeBackup{node}
+	manifest.Complete = true
+
+	if err := c.writeManifest(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Restore loads every node's checkpoint from the backup id. Nodes whose
+// checkpoint failed when the backup was taken are reported but skipped.
+func (c *Coordinator) Restore(id string) (*Manifest, error) {
+	manifest, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]network.NodeInfo, 0, len(manifest.Nodes))
+	for _, node := range manifest.Nodes {
+		if node.Error != "" {
+			continue
+		}
+		nodes = append(nodes, network.NodeInfo{
+			NodeID:  node.NodeID,
+			Address: node.Address,
+			Self:    node.NodeID == c.cacheManager.NodeID(),
+		})
+	}
+
+	result := *manifest
+	result.Nodes = c.fanOut("RESTORE", id, nodes, c.restoreLocal)
+	result.Complete = len(result.Nodes) == len(manifest.Nodes)
+	for _, node := range result.Nodes {
+		if node.Error != "" {
+			result.Complete = false
+		}
+	}
+	return &result, nil
+}
+
+func (c *Coordinator) fanOut(command, id string, nodes []network.NodeInfo, local func(id string) (NodeBackup, error)) []NodeBackup {
+	payload, _ := json.Marshal(nodeRequest{BackupID: id})
+
+	results := make([]NodeBackup, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node network.NodeInfo) {
+			defer wg.Done()
+
+			var result NodeBackup
+			var err error
+			if node.Self {
+				result, err = local(id)
+			} else {
+				var response string
+				response, err = c.peerManager.Request(node.Address, command, string(payload), requestTimeout)
+				if err == nil {
+					err = json.Unmarshal([]byte(response), &result)
+				}
+			}
+			if err != nil {
+				result = NodeBackup{NodeID: node.NodeID, Region: node.Region, Error: err.Error()}
+			}
+			result.Address = node.Address
+			results[i] = result
+		}(i, node)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (c *Coordinator) backupLocal(id string) (NodeBackup, error) {
+	path, err := c.snapshotPath(id)
+	if err != nil {
+		return NodeBackup{}, err
+	}
+
+	view := c.cacheManager.View()
+	snapshot := &persistence.Snapshot{
+		NodeID:    c.cacheManager.NodeID(),
+		Region:    c.cacheManager.Region(),
+		CreatedAt: view.At,
+		Sequence:  view.Sequence,
+		Items:     view.Items,
+	}
+	if err := persistence.WriteSnapshot(path, snapshot); err != nil {
+		return NodeBackup{}, err
+	}
+
+	return NodeBackup{
+		NodeID:   snapshot.NodeID,
+		Region:   snapshot.Region,
+		Sequence: view.Sequence,
+		Items:    len(view.Items),
+		Path:     path,
+	}, nil
+}
+
+func (c *Coordinator) restoreLocal(id string) (NodeBackup, error) {
+	path, err := c.snapshotPath(id)
+	if err != nil {
+		return NodeBackup{}, err
+	}
+
+	snapshot, _, err := persistence.LoadSnapshot(path)
+	if err != nil {
+		return NodeBackup{}, err
+	}
+	if snapshot.NodeID != c.cacheManager.NodeID() {
+		return NodeBackup{}, fmt.Errorf("snapshot %s belongs to node %s", path, snapshot.NodeID)
+	}
+
+	c.cacheManager.Restore(snapshot.Items)
+	return NodeBackup{
+		NodeID:   snapshot.NodeID,
+		Region:   snapshot.Region,
+		Sequence: snapshot.Sequence,
+		Items:    len(snapshot.Items),
+		Path:     path,
+	}, nil
+}
+
+func (c *Coordinator) snapshotPath(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", ErrInvalidID
+	}
+	return filepath.Join(c.dir, id, c.cacheManager.NodeID()+".snap"), nil
+}
+
+func (c *Coordinator) writeManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	dir := filepath.Join(c.dir, manifest.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	tmpPath := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("failed to rename manifest: %v", err)
+	}
+	return nil
+}
+
+func (c *Coordinator) Get(id string) (*Manifest, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, id, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", id, err)
+	}
+	return &manifest, nil
+}
+
+// List returns the manifests of backups coordinated by this node, oldest
+// first.
+func (c *Coordinator) List() ([]*Manifest, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Manifest{}, nil
+		}
+		return nil, fmt.Errorf("failed to list backups: %v", err)
+	}
+
+	manifests := make([]*Manifest, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := c.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].CreatedAt.Before(manifests[j].CreatedAt) })
+	return manifests, nil
+}
@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/persistence"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoEventLog = errors.New("event log is not enabled")
+	ErrNoHistory  = errors.New("no snapshot or event log entry covers the requested time")
+)
+
+var errStopReplay = errors.New("stop replay")
+
+// RestoreReport describes the state a point-in-time restore produces and
+// how it differs from the current cache on this node.
+type RestoreReport struct {
+	AsOf           time.Time `json:"as_of"`
+	DryRun         bool      `json:"dry_run"`
+	BaseSnapshot   string    `json:"base_snapshot,omitempty"`
+	BaseSequence   uint64    `json:"base_sequence"`
+	ReplayedEvents int       `json:"replayed_events"`
+	LastSequence   uint64    `json:"last_sequence"`
+	Items          int       `json:"items"`
+	Added          []string  `json:"added"`
+	Removed        []string  `json:"removed"`
+	Changed        []string  `json:"changed"`
+}
+
+// RestoreTo rebuilds this node's cache as it was at asOf from the newest
+// usable backup snapshot plus the event log, and installs it unless dryRun
+// is set. A snapshot is usable when it was taken no later than asOf and the
+// event log still holds every mutation after it; without one, the log is
+// replayed from its first entry.
+func (c *Coordinator) RestoreTo(asOf time.Time, dryRun bool) (*RestoreReport, error) {
+	if c.eventLogPath == "" {
+		return nil, ErrNoEventLog
+	}
+
+	var first cache.Mutation
+	err := persistence.ReadEventLog(c.eventLogPath, func(mutation cache.Mutation) error {
+		first = mutation
+		return errStopReplay
+	})
+	if err != nil && !errors.Is(err, errStopReplay) {
+		return nil, err
+	}
+
+	report := &RestoreReport{AsOf: asOf, DryRun: dryRun}
+	items := make(map[string]*cache.CacheItem)
+
+	snapshot, path := c.baseSnapshot(asOf, first.Sequence)
+	if snapshot != nil {
+		for _, item := range snapshot.Items {
+			items[item.Key] = item
+		}
+		report.BaseSnapshot = path
+		report.BaseSequence = snapshot.Sequence
+		report.LastSequence = snapshot.Sequence
+	} else if first.Sequence == 0 || first.Timestamp.After(asOf) {
+		return nil, ErrNoHistory
+	}
+
+	err = persistence.ReadEventLog(c.eventLogPath, func(mutation cache.Mutation) error {
+		if mutation.Sequence <= report.BaseSequence {
+			return nil
+		}
+		if mutation.Timestamp.After(asOf) {
+			return errStopReplay
+		}
+		cache.Replay(items, mutation)
+		report.ReplayedEvents++
+		report.LastSequence = mutation.Sequence
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopReplay) {
+		return nil, err
+	}
+
+	restored := make([]*cache.CacheItem, 0, len(items))
+	for _, item := range items {
+		restored = append(restored, item)
+	}
+	report.Items = len(restored)
+	report.Added, report.Removed, report.Changed = diffItems(c.cacheManager, items)
+
+	if !dryRun {
+		c.cacheManager.Restore(restored)
+	}
+	return report, nil
+}
+
+func (c *Coordinator) baseSnapshot(asOf time.Time, firstSequence uint64) (*persistence.Snapshot, string) {
+	paths, _ := filepath.Glob(filepath.Join(c.dir, "*", c.cacheManager.NodeID()+".snap"))
+
+	var best *persistence.Snapshot
+	var bestPath string
+	for _, path := range paths {
+		snapshot, loadedFrom, err := persistence.LoadSnapshot(path)
+		if err != nil || snapshot.NodeID != c.cacheManager.NodeID() {
+			continue
+		}
+		if snapshot.CreatedAt.After(asOf) || firstSequence == 0 || snapshot.Sequence+1 < firstSequence {
+			continue
+		}
+		if best == nil || snapshot.Sequence > best.Sequence {
+			best, bestPath = snapshot, loadedFrom
+		}
+	}
+	return best, bestPath
+}
+
+func diffItems(cacheManager *cache.Manager, target map[string]*cache.CacheItem) (added, removed, changed []string) {
+	current, _ := cacheManager.Checkpoint()
+	currentByKey := make(map[string]*cache.CacheItem, len(current))
+	for _, item := range current {
+		currentByKey[item.Key] = item
+	}
+
+	added, removed, changed = []string{}, []string{}, []string{}
+	for key, item := range target {
+		existing, exists := currentByKey[key]
+		switch {
+		case !exists:
+			added = append(added, key)
+		case existing.Value != item.Value || existing.Version != item.Version || existing.Encoding != item.Encoding:
+			changed = append(changed, key)
+		}
+	}
+	for key := range currentByKey {
+		if _, exists := target[key]; !exists {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+func (r *RestoreReport) String() string {
+	return fmt.Sprintf("as of %s: %d items, %d added, %d removed, %d changed", r.AsOf.Format(time.RFC3339), r.Items, len(r.Added), len(r.Removed), len(r.Changed))
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchEntry is one write of a batch.
+type BatchEntry struct {
+	Key   string
+	Value string
+	// Options of the write. Consistency and LocalOnly apply to the whole
+	// batch and are ignored here.
+	Options WriteOptions
+}
+
+// WriteBatch stores every entry or, if any of them is invalid or fails
+// its conditions, none. The items are stored under one lock, so no read
+// sees some of them without the others, and are replicated together. It
+// returns the stored items in entry order, and waits for the journal as
+// consistency requires.
+func (m *Manager) WriteBatch(ctx context.Context, entries []BatchEntry, consistency Consistency) ([]*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]*CacheItem, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		item := m.newItem(entry.Key, entry.Value, entry.Options)
+		if seen[item.Key] {
+			return nil, fmt.Errorf("%s is written twice in one batch", item.Key)
+		}
+		seen[item.Key] = true
+		if err := m.prepare(item); err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+
+	sequence, err := m.storeBatch(items, entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.await(ctx, sequence, consistency); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := m.hooks.afterSet(ctx, item); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (m *Manager) storeBatch(items []*CacheItem, entries []BatchEntry) (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, item := range items {
+		if err := m.checkConditions(item.Key, entries[i].Options); err != nil {
+			return 0, err
+		}
+		if err := m.checkQuota(item); err != nil {
+			return 0, err
+		}
+	}
+	for i, item := range items {
+		m.place(item, entries[i].Options)
+	}
+	m.updateStats()
+
+	select {
+	case m.onBatch <- items:
+	default:
+	}
+	for _, item := range items {
+		m.notifyListeners(item)
+	}
+	return m.sequence, nil
+}
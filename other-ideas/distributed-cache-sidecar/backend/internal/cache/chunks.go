@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/pkg/ring"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// TypeChunked is the CacheItem.Type of a large object's manifest.
+const TypeChunked = "chunked"
+
+// Objects too large for one item are uploaded in parts, each stored and
+// replicated as an ordinary binary item under PartKey, and then completed
+// by storing a manifest under the object's key that lists its parts in
+// order. Parts are placed by the object's key, so the nodes that hold the
+// manifest hold the parts too. A part evicted or expired before its
+// manifest makes the object unreadable, so parts should be uploaded with
+// the TTL the object is to have.
+
+// Manifest lists the parts a large object is stored in.
+type Manifest struct {
+	Upload string   `json:"upload"`
+	Parts  []string `json:"parts"`
+	Size   int64    `json:"size"`
+}
+
+// PartKey is the key part number part of an upload to key is stored under.
+func PartKey(key, upload string, part int) string {
+	return key + ring.PartSeparator + upload + "~" + strconv.Itoa(part)
+}
+
+// manifest decodes the manifest item holds.
+func (item *CacheItem) manifest() (*Manifest, error) {
+	if item.Type != TypeChunked {
+		return nil, &KeyError{Key: item.Key, Err: ErrWrongType}
+	}
+	var manifest Manifest
+	if err := json.Unmarshal([]byte(item.Value), &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// WritePart stores data as part number part of an upload to key.
+func (m *Manager) WritePart(ctx context.Context, key, upload string, part int, data []byte, options WriteOptions) (*CacheItem, error) {
+	options.Encoding = codec.EncodingBinary
+	options.IfVersion = 0
+	key = m.hooks.normalizeKey(key)
+	return m.Write(ctx, PartKey(key, upload, part), base64.StdEncoding.EncodeToString(data), options)
+}
+
+// CompleteUpload stores the manifest of an upload to key, made of the
+// given parts in that order, with the TTL and metadata in options. Every
+// part must have been written. The parts of an object it replaces are
+// removed from this node.
+func (m *Manager) CompleteUpload(ctx context.Context, key, upload string, parts []int, options WriteOptions) (*CacheItem, error) {
+	key = m.hooks.normalizeKey(key)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("upload %s of %s has no parts", upload, key)
+	}
+
+	manifest := &Manifest{Upload: upload, Parts: make([]string, 0, len(parts))}
+	seen := make(map[int]bool, len(parts))
+	for _, part := range parts {
+		if seen[part] {
+			return nil, fmt.Errorf("part %d of upload %s is listed twice", part, upload)
+		}
+		seen[part] = true
+
+		partKey := PartKey(key, upload, part)
+		item, err := m.Read(ctx, partKey, ReadOptions{})
+		if err != nil {
+			return nil, &KeyError{Key: key, Err: ErrNotFound, Cause: fmt.Errorf("%w: part %d of upload %s", err, part, upload)}
+		}
+		if item.Encoding != codec.EncodingBinary {
+			return nil, &KeyError{Key: partKey, Err: ErrWrongType}
+		}
+		manifest.Parts = append(manifest.Parts, partKey)
+		size, err := m.codecs.Size(item.Value, item.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Size += size
+	}
+	document, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var replaced *Manifest
+	if existing, err := m.peek(key); err == nil && existing.Type == TypeChunked {
+		replaced, _ = existing.manifest()
+	}
+
+	item := &CacheItem{
+		Key:      key,
+		Value:    string(document),
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Encoding: codec.EncodingJSON,
+		Type:     TypeChunked,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+	if item, err = m.write(ctx, item, options); err != nil {
+		return nil, err
+	}
+
+	if replaced != nil && replaced.Upload != upload {
+		for _, partKey := range replaced.Parts {
+			m.delete(partKey, WriteOptions{LocalOnly: true})
+		}
+	}
+	return item, nil
+}
+
+// Parts returns the parts of the large object whose manifest is item, in
+// order. It fails with ErrNotFound if any of them is gone.
+func (m *Manager) Parts(ctx context.Context, item *CacheItem) (*Manifest, []*CacheItem, error) {
+	manifest, err := item.manifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := make([]*CacheItem, len(manifest.Parts))
+	for i, partKey := range manifest.Parts {
+		if parts[i], err = m.Read(ctx, partKey, ReadOptions{}); err != nil {
+			return nil, nil, &KeyError{Key: item.Key, Err: ErrNotFound, Cause: fmt.Errorf("%w: part %d of %d of %s is gone", err, i+1, len(manifest.Parts), item.Key)}
+		}
+	}
+	return manifest, parts, nil
+}
+
+// peek returns the live item under key without counting a read.
+func (m *Manager) peek(key string) (*CacheItem, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	item, exists := m.items[key]
+	if !exists || item.expiredAt(m.now()) {
+		return nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	return item, nil
+}
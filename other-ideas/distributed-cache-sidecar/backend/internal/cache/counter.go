@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrOverflow   = errors.New("increment would overflow")
+)
+
+// Increment atomically adds delta to the integer stored under key and
+// returns the updated item. A missing or expired key counts from 0 and is
+// created with the TTL, sliding and metadata in options; an existing one
+// keeps its own. The result is stored as decimal text and replicated like
+// any write, so increments are atomic on the node that applies them, but
+// two nodes incrementing the same key at once resolve last-writer-wins.
+// PeerManager.Increment sends every increment of a key to its owner.
+func (m *Manager) Increment(ctx context.Context, key string, delta int64, options WriteOptions) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	sequence, item, err := m.increment(key, delta, options)
+	if err != nil {
+		return nil, err
+	}
+	return item, m.settle(ctx, item, sequence, options)
+}
+
+// Decrement is Increment with delta negated.
+func (m *Manager) Decrement(ctx context.Context, key string, delta int64, options WriteOptions) (*CacheItem, error) {
+	if delta == math.MinInt64 {
+		return nil, &KeyError{Key: key, Err: ErrOverflow}
+	}
+	return m.Increment(ctx, key, -delta, options)
+}
+
+// inherit gives item, which updates existing in place, existing's TTL,
+// sliding flag, encoding and metadata. A sliding TTL restarts with the
+// write, so it is kept whole; any other keeps what it had left at now.
+func (item *CacheItem) inherit(existing *CacheItem, now time.Time) {
+	item.TTL = existing.TTL
+	if !existing.Sliding {
+		item.TTL = existing.remainingTTL(now)
+	}
+	item.Sliding = existing.Sliding
+	item.Encoding = existing.Encoding
+	item.Metadata = existing.Metadata
+}
+
+func (m *Manager) increment(key string, delta int64, options WriteOptions) (uint64, *CacheItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item := &CacheItem{
+		Key:      key,
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Sliding:  options.Sliding,
+		Encoding: options.Encoding,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+
+	var current int64
+	existing, exists := m.items[key]
+	if exists && !existing.expiredAt(m.now()) {
+		if existing.Type != "" {
+			return 0, nil, &KeyError{Key: key, Err: ErrWrongType}
+		}
+		if existing.Encoding != "" && existing.Encoding != codec.EncodingRaw && existing.Encoding != codec.EncodingJSON {
+			return 0, nil, &KeyError{Key: key, Err: ErrNotInteger}
+		}
+		var err error
+		current, err = strconv.ParseInt(strings.TrimSpace(existing.Value), 10, 64)
+		if err != nil {
+			return 0, nil, &KeyError{Key: key, Err: ErrNotInteger}
+		}
+		item.inherit(existing, m.now())
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, nil, &KeyError{Key: key, Err: ErrOverflow}
+	}
+	item.Value = strconv.FormatInt(current+delta, 10)
+
+	if err := m.hooks.beforeSet(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.validateSchema(item.Key, item.Value, item.Encoding); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkSize(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, nil, err
+	}
+
+	item.Timestamp = m.stamp(existing)
+	if exists {
+		item.Version = existing.Version + 1
+	} else {
+		item.Version = 1
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	return m.sequence, item, nil
+}
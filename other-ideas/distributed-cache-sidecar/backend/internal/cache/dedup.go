@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// dedupMinBytes is the smallest value worth sharing; a table entry costs
+// more than a shorter value would save.
+const dedupMinBytes = 64
+
+// values stores each distinct value once, keyed by its SHA-256, with a
+// count of the items holding it. Items with equal values then share one
+// string, and the budget charges its bytes once.
+type values struct {
+	entries map[[sha256.Size]byte]*sharedValue
+	saved   int64
+}
+
+type sharedValue struct {
+	value string
+	refs  int
+}
+
+func newValues() *values {
+	return &values{entries: make(map[[sha256.Size]byte]*sharedValue)}
+}
+
+// retain makes item hold the stored copy of its value, adding one if there
+// is none, and returns whether another item already held it.
+func (v *values) retain(item *CacheItem) bool {
+	if len(item.Value) < dedupMinBytes {
+		return false
+	}
+	sum := sha256.Sum256([]byte(item.Value))
+	entry, exists := v.entries[sum]
+	if !exists {
+		v.entries[sum] = &sharedValue{value: item.Value, refs: 1}
+		return false
+	}
+	item.Value = entry.value
+	entry.refs++
+	v.saved += int64(len(entry.value))
+	return true
+}
+
+// release drops item's reference to its value and returns whether other
+// items still hold it.
+func (v *values) release(item *CacheItem) bool {
+	if len(item.Value) < dedupMinBytes {
+		return false
+	}
+	sum := sha256.Sum256([]byte(item.Value))
+	entry, exists := v.entries[sum]
+	if !exists {
+		return false
+	}
+	if entry.refs--; entry.refs == 0 {
+		delete(v.entries, sum)
+		return false
+	}
+	v.saved -= int64(len(entry.value))
+	return true
+}
+
+// SetDedup turns content-addressed storage of values on or off. With it
+// on, values of at least 64 bytes that several keys hold are stored once
+// and counted once against the memory budget, at the cost of hashing each
+// value as it is stored and removed.
+func (m *Manager) SetDedup(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.values = nil
+	if enabled {
+		m.values = newValues()
+	}
+	// Stored items are never modified, so each is replaced by a copy that
+	// charge can point at the shared value.
+	m.bytes = 0
+	for key, item := range m.items {
+		shared := *item
+		m.bytes += m.charge(&shared)
+		m.items[key] = &shared
+	}
+	m.evictOverflow()
+	m.updateStats()
+}
+
+// charge counts item in, and returns the bytes it adds to, the memory
+// held. A value that another item already holds is not counted again.
+func (m *Manager) charge(item *CacheItem) int64 {
+	size := item.size()
+	if m.values != nil && m.values.retain(item) {
+		size -= int64(len(item.Value))
+	}
+	return size
+}
+
+// discharge is charge undone for an item leaving the store.
+func (m *Manager) discharge(item *CacheItem) int64 {
+	size := item.size()
+	if m.values != nil && m.values.release(item) {
+		size -= int64(len(item.Value))
+	}
+	return size
+}
+
+// dedupSavings recomputes from the items held what sharing values saves,
+// for CheckInvariants to compare with the running count.
+func (m *Manager) dedupSavings() int64 {
+	if m.values == nil {
+		return 0
+	}
+	held := make(map[string]bool)
+	var saved int64
+	for _, item := range m.items {
+		if len(item.Value) < dedupMinBytes {
+			continue
+		}
+		if held[item.Value] {
+			saved += int64(len(item.Value))
+		}
+		held[item.Value] = true
+	}
+	return saved
+}
+
+// ValueDigest is the hex SHA-256 of value, by which peers name a value
+// without sending it.
+func ValueDigest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValueByDigest returns a value held here whose ValueDigest is digest: the
+// value of the live item under key or, with dedup on, any stored value.
+func (m *Manager) ValueByDigest(key, digest string) (string, bool) {
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", false
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], decoded)
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if item, exists := m.items[key]; exists && !item.expiredAt(m.now()) && sha256.Sum256([]byte(item.Value)) == sum {
+		return item.Value, true
+	}
+	if m.values != nil {
+		if entry, exists := m.values.entries[sum]; exists {
+			return entry.value, true
+		}
+	}
+	return "", false
+}
+
+// ItemWithDigest returns the live item under key if its value's
+// ValueDigest is digest, without counting a read.
+func (m *Manager) ItemWithDigest(key, digest string) (*CacheItem, bool) {
+	item, err := m.peek(key)
+	if err != nil || ValueDigest(item.Value) != digest {
+		return nil, false
+	}
+	return item, true
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors the Manager reports for a key. Callers test for them with
+// errors.Is; the errors returned usually carry the key as a *KeyError.
+var (
+	ErrNotFound = errors.New("key not found")
+	ErrExpired  = errors.New("key expired")
+	ErrTooLarge = errors.New("too large")
+	ErrConflict = errors.New("conflicting update")
+	// ErrVersionMismatch fails a conditional write whose item is missing
+	// or at another version than the one the caller read.
+	ErrVersionMismatch = errors.New("version does not match")
+	// ErrExists fails a write that was only to create the key.
+	ErrExists = errors.New("key exists")
+	// ErrInvalidTTL fails an EXPIRE without a positive TTL.
+	ErrInvalidTTL = errors.New("TTL must be positive")
+	// ErrInvalidTag fails a write or invalidation naming a malformed tag.
+	ErrInvalidTag = errors.New("invalid tag")
+)
+
+// KeyError is an error about one key. Err is one of the errors above and
+// Cause, when set, is the failure behind it; errors.Is matches both.
+type KeyError struct {
+	Key   string
+	Err   error
+	Cause error
+}
+
+func (e *KeyError) Error() string {
+	if e.Cause != nil {
+		return e.Cause.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Key)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *KeyError) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Cause, target)
+}
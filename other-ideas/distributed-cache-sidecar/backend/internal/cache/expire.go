@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Expire and Persist change the TTL of a live item without the caller
+// sending its value again. The item is stored again as a new write of the
+// same value, with the new TTL counted from now, so it replicates to
+// peers like any write, on every protocol version. As with counters, a
+// TTL change and a write of the same key made on two nodes at once
+// resolve last-writer-wins.
+
+// Expire gives the live item under key a TTL of ttl from now, keeping its
+// value, encoding, metadata and sliding flag, and returns the new item.
+func (m *Manager) Expire(ctx context.Context, key string, ttl time.Duration, options WriteOptions) (*CacheItem, error) {
+	if ttl <= 0 {
+		return nil, &KeyError{Key: key, Err: ErrInvalidTTL}
+	}
+	return m.retime(ctx, key, ttlSeconds(ttl), options)
+}
+
+// Persist removes the TTL of the live item under key, so it is kept until
+// it is deleted or evicted, and returns the new item.
+func (m *Manager) Persist(ctx context.Context, key string, options WriteOptions) (*CacheItem, error) {
+	return m.retime(ctx, key, 0, options)
+}
+
+func (m *Manager) retime(ctx context.Context, key string, ttl int64, options WriteOptions) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	sequence, item, err := m.storeTTL(key, ttl, options)
+	if err != nil {
+		return nil, err
+	}
+	return item, m.settle(ctx, item, sequence, options)
+}
+
+func (m *Manager) storeTTL(key string, ttl int64, options WriteOptions) (uint64, *CacheItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists {
+		return 0, nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	if existing.expiredAt(m.now()) {
+		return 0, nil, &KeyError{Key: key, Err: ErrExpired}
+	}
+
+	item := *existing
+	item.NodeID = m.nodeID
+	item.Region = m.region
+	item.TTL = ttl
+	item.Touched = nil
+	if err := m.checkQuota(&item); err != nil {
+		return 0, nil, err
+	}
+	if ttl == 0 {
+		item.Sliding = false
+	}
+	item.Timestamp = m.stamp(existing)
+	item.Version = existing.Version + 1
+	m.put(&item)
+	m.recordMutation(MutationSet, &item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(&item)
+		m.notifyListeners(&item)
+	}
+	return m.sequence, &item, nil
+}
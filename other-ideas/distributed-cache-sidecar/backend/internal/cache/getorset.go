@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// load is one call of a GetOrLoad loader that concurrent callers for the
+// same key wait on.
+type load struct {
+	done chan struct{}
+	item *CacheItem
+	err  error
+}
+
+// loads tracks the loaders GetOrLoad is running, by key.
+type loads struct {
+	mutex   sync.Mutex
+	running map[string]*load
+}
+
+// GetOrSet returns the live item under key, or stores value with options
+// if there is none. It reports whether the item returned existed before
+// the call. Of several callers racing to set a missing key, one stores its
+// value and the others get it.
+func (m *Manager) GetOrSet(ctx context.Context, key, value string, options WriteOptions) (*CacheItem, bool, error) {
+	options.IfAbsent = true
+	for {
+		item, err := m.Read(ctx, key, ReadOptions{})
+		if err == nil {
+			return item, true, nil
+		}
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrExpired) {
+			return nil, false, err
+		}
+
+		// A write that lost the race to another sees ErrExists and reads
+		// the winner's item on the next pass.
+		item, err = m.Write(ctx, key, value, options)
+		if !errors.Is(err, ErrExists) {
+			return item, false, err
+		}
+	}
+}
+
+// GetOrLoad is GetOrSet with a value computed by loader only when the key
+// is missing. Concurrent calls for the same key on this node share one
+// call of loader, so a missing hot key is computed once rather than by
+// every caller.
+func (m *Manager) GetOrLoad(ctx context.Context, key string, loader func(ctx context.Context) (string, error), options WriteOptions) (*CacheItem, bool, error) {
+	item, err := m.Read(ctx, key, ReadOptions{})
+	if err == nil {
+		return item, true, nil
+	}
+	if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrExpired) {
+		return nil, false, err
+	}
+
+	key = m.hooks.normalizeKey(key)
+	m.loads.mutex.Lock()
+	if running, found := m.loads.running[key]; found {
+		m.loads.mutex.Unlock()
+		select {
+		case <-running.done:
+			return running.item, true, running.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	call := &load{done: make(chan struct{})}
+	if m.loads.running == nil {
+		m.loads.running = make(map[string]*load)
+	}
+	m.loads.running[key] = call
+	m.loads.mutex.Unlock()
+
+	defer func() {
+		m.loads.mutex.Lock()
+		delete(m.loads.running, key)
+		m.loads.mutex.Unlock()
+		close(call.done)
+	}()
+
+	value, err := loader(ctx)
+	if err != nil {
+		call.err = err
+		return nil, false, err
+	}
+	var existed bool
+	call.item, existed, call.err = m.GetOrSet(ctx, key, value, options)
+	return call.item, existed, call.err
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/patch"
+	"encoding/json"
+	"errors"
+)
+
+// TypeHash is the CacheItem.Type of a hash.
+const TypeHash = "hash"
+
+// Hashes hold named string fields under one key, so one field can be read
+// or changed without transferring the whole object. A hash is stored as a
+// JSON object. The write that creates it is replicated like any write;
+// later field changes are replicated as merge patches naming only the
+// changed fields, so changes to different fields of one hash made on two
+// nodes at once both survive.
+
+// fields decodes the fields item holds.
+func (item *CacheItem) fields() (map[string]string, error) {
+	if item.Type != TypeHash {
+		return nil, &KeyError{Key: item.Key, Err: ErrWrongType}
+	}
+	fields := make(map[string]string)
+	if err := json.Unmarshal([]byte(item.Value), &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// HashSet sets fields of the hash under key, creating it with the TTL,
+// sliding flag and metadata in options if there is none. It returns how
+// many of the fields are new and the hash's new size.
+func (m *Manager) HashSet(ctx context.Context, key string, fields map[string]string, options WriteOptions) (int, int, error) {
+	changes := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		changes[name] = value
+	}
+	return m.updateHash(ctx, key, changes, options)
+}
+
+// HashDelete removes fields from the hash under key and returns how many
+// it held and the hash's new size. A hash emptied this way is kept, as
+// with lists; a missing key is an empty hash.
+func (m *Manager) HashDelete(ctx context.Context, key string, fields []string, options WriteOptions) (int, int, error) {
+	changes := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		changes[name] = nil
+	}
+	removed, size, err := m.updateHash(ctx, key, changes, options)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+		return 0, 0, nil
+	}
+	return -removed, size, err
+}
+
+// HashGetAll returns every field of the hash under key.
+func (m *Manager) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	item, err := m.Read(ctx, key, ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return item.fields()
+}
+
+// HashGet returns the named fields of the hash under key that it holds. A
+// missing key is an empty hash.
+func (m *Manager) HashGet(ctx context.Context, key string, names []string) (map[string]string, error) {
+	fields, err := m.HashGetAll(ctx, key)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, exists := fields[name]; exists {
+			found[name] = value
+		}
+	}
+	return found, nil
+}
+
+// updateHash applies changes, new field values or nil for fields to
+// remove, to the hash under key. It returns the change in the number of
+// fields and the new size. Removing fields from a missing hash is
+// ErrNotFound.
+func (m *Manager) updateHash(ctx context.Context, key string, changes map[string]interface{}, options WriteOptions) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return 0, 0, err
+	}
+
+	sequence, item, delta, size, err := m.storeHash(key, changes, options)
+	if err != nil || item == nil {
+		return delta, size, err
+	}
+	return delta, size, m.settle(ctx, item, sequence, options)
+}
+
+func (m *Manager) storeHash(key string, changes map[string]interface{}, options WriteOptions) (uint64, *CacheItem, int, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists || existing.expiredAt(m.now()) {
+		return m.createHash(key, changes, options)
+	}
+	fields, err := existing.fields()
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+
+	// Only the fields that change go into the patch peers apply.
+	delta := 0
+	for name, value := range changes {
+		current, held := fields[name]
+		switch {
+		case value == nil && held:
+			delete(fields, name)
+			delta--
+		case value != nil && !held:
+			fields[name] = value.(string)
+			delta++
+		case value != nil && current != value.(string):
+			fields[name] = value.(string)
+		default:
+			delete(changes, name)
+		}
+	}
+	if len(changes) == 0 {
+		return 0, nil, 0, len(fields), nil
+	}
+
+	patchDoc, err := json.Marshal(changes)
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+	patched, err := json.Marshal(fields)
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+	item, err := m.putPatched(existing, patch.TypeMergePatch, patchDoc, patched, options.LocalOnly)
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+	return m.sequence, item, delta, len(fields), nil
+}
+
+// createHash stores a new hash holding the fields set in changes. The
+// caller holds the write lock.
+func (m *Manager) createHash(key string, changes map[string]interface{}, options WriteOptions) (uint64, *CacheItem, int, int, error) {
+	fields := make(map[string]string, len(changes))
+	for name, value := range changes {
+		if value != nil {
+			fields[name] = value.(string)
+		}
+	}
+	if len(fields) == 0 {
+		return 0, nil, 0, 0, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	document, err := json.Marshal(fields)
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+
+	item := &CacheItem{
+		Key:      key,
+		Value:    string(document),
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Sliding:  options.Sliding,
+		Encoding: codec.EncodingJSON,
+		Type:     TypeHash,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+	if err := m.hooks.beforeSet(item); err != nil {
+		return 0, nil, 0, 0, err
+	}
+	if err := m.checkSize(item); err != nil {
+		return 0, nil, 0, 0, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, nil, 0, 0, err
+	}
+
+	existing := m.items[key]
+	item.Timestamp = m.stamp(existing)
+	item.Version = 1
+	if existing != nil {
+		item.Version = existing.Version + 1
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	return m.sequence, item, len(fields), len(fields), nil
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrHistoryDisabled = errors.New("item history is disabled")
+	ErrBeyondHistory   = errors.New("requested time is outside the retained history")
+	ErrNotFoundAt      = fmt.Errorf("%w at the requested time", ErrNotFound)
+)
+
+// sweepEvery is how many recorded mutations pass between sweeps that drop
+// history for keys that stopped changing.
+const sweepEvery = 1024
+
+// history retains recent versions of every key, in the order this node
+// applied them, so reads can ask for the value current at an earlier time.
+// Versions are kept for retention and at most maxVersions per key; a key's
+// history only answers for times after the oldest version it still holds,
+// or since history started if nothing was ever dropped.
+type history struct {
+	retention   time.Duration
+	maxVersions int
+	started     time.Time
+
+	mutex    sync.Mutex
+	keys     map[string]*keyHistory
+	recorded int
+}
+
+type keyHistory struct {
+	versions []historyVersion
+	// coversFrom is the earliest time the versions fully describe.
+	coversFrom time.Time
+}
+
+// historyVersion is the item stored at a point in time; a nil item means
+// the key was deleted.
+type historyVersion struct {
+	at   time.Time
+	item *CacheItem
+}
+
+// EnableHistory starts retaining versions of every item for GetAt. Only
+// changes made after it is called are retained.
+func (m *Manager) EnableHistory(retention time.Duration, maxVersions int) {
+	h := &history{
+		retention:   retention,
+		maxVersions: maxVersions,
+		started:     time.Now(),
+		keys:        make(map[string]*keyHistory),
+	}
+
+	m.mutex.Lock()
+	for key, item := range m.items {
+		h.keys[key] = &keyHistory{versions: []historyVersion{{at: h.started, item: item}}, coversFrom: h.started}
+	}
+	m.history = h
+	m.mutationListeners = append(m.mutationListeners, h.record)
+	m.mutex.Unlock()
+}
+
+// GetAt returns the version of key that was current on this node at the
+// given time.
+func (m *Manager) GetAt(key string, at time.Time) (*CacheItem, error) {
+	if m.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	item, err := m.history.at(key, at)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed, err := m.hooks.afterGet(item)
+	if err != nil {
+		log.Printf("Dropping read of %s: %v", key, err)
+		return nil, fmt.Errorf("%w: %v", ErrNotFoundAt, err)
+	}
+	return transformed, nil
+}
+
+func (h *history) record(mutation Mutation) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	switch mutation.Op {
+	case MutationSet:
+		h.append(mutation.Key, mutation.Timestamp, mutation.Item)
+	case MutationDelete:
+		h.append(mutation.Key, mutation.Timestamp, nil)
+	case MutationReset:
+		for key := range h.keys {
+			h.append(key, mutation.Timestamp, nil)
+		}
+	}
+
+	h.recorded++
+	if h.recorded%sweepEvery == 0 {
+		h.sweep(mutation.Timestamp)
+	}
+}
+
+func (h *history) append(key string, at time.Time, item *CacheItem) {
+	kh := h.keys[key]
+	if kh == nil {
+		// The key didn't exist before, as far as history knows.
+		kh = &keyHistory{coversFrom: h.started}
+		h.keys[key] = kh
+	}
+	kh.versions = append(kh.versions, historyVersion{at: at, item: item})
+	h.prune(kh, at)
+}
+
+// prune drops versions beyond maxVersions and those superseded before the
+// retention window. The newest version older than the window is kept, as
+// it was still current at the start of the window.
+func (h *history) prune(kh *keyHistory, now time.Time) {
+	if excess := len(kh.versions) - h.maxVersions; excess > 0 {
+		kh.versions = append([]historyVersion(nil), kh.versions[excess:]...)
+		kh.coversFrom = kh.versions[0].at
+	}
+
+	cutoff := now.Add(-h.retention)
+	drop := 0
+	for drop+1 < len(kh.versions) && !kh.versions[drop+1].at.After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		kh.versions = append([]historyVersion(nil), kh.versions[drop:]...)
+		if kh.coversFrom.Before(kh.versions[0].at) {
+			kh.coversFrom = kh.versions[0].at
+		}
+	}
+}
+
+// sweep prunes every key and forgets keys whose only remaining version is
+// a deletion older than the retention window.
+func (h *history) sweep(now time.Time) {
+	cutoff := now.Add(-h.retention)
+	for key, kh := range h.keys {
+		h.prune(kh, now)
+		if len(kh.versions) == 1 && kh.versions[0].item == nil && !kh.versions[0].at.After(cutoff) {
+			delete(h.keys, key)
+		}
+	}
+}
+
+func (h *history) at(key string, at time.Time) (*CacheItem, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if at.Before(time.Now().Add(-h.retention)) || at.Before(h.started) {
+		return nil, ErrBeyondHistory
+	}
+
+	kh := h.keys[key]
+	if kh == nil {
+		return nil, ErrNotFoundAt
+	}
+	if at.Before(kh.coversFrom) {
+		return nil, ErrBeyondHistory
+	}
+
+	// The version current at `at` is the last one applied at or before it.
+	i := sort.Search(len(kh.versions), func(i int) bool { return kh.versions[i].at.After(at) }) - 1
+	if i < 0 {
+		return nil, ErrNotFoundAt
+	}
+
+	item := kh.versions[i].item
+	if item == nil || (item.TTL > 0 && at.Sub(item.Timestamp) > time.Duration(item.TTL)*time.Second) {
+		return nil, ErrNotFoundAt
+	}
+	return item, nil
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Hook is the base interface for Set/Get middleware. A hook opts into a
+// stage by also implementing KeyHook, SetHook, AfterSetHook or GetHook.
+type Hook interface {
+	Name() string
+}
+
+type KeyHook interface {
+	NormalizeKey(key string) string
+}
+
+type SetHook interface {
+	BeforeSet(item *CacheItem) error
+}
+
+// AfterSetHook runs once a replicated local write is stored and as durable
+// as it asked to be. An error fails the write, which stays applied.
+type AfterSetHook interface {
+	AfterSet(ctx context.Context, item *CacheItem) error
+}
+
+type GetHook interface {
+	AfterGet(item *CacheItem) (*CacheItem, error)
+}
+
+// RemoteSetHook vets an item replicated from a peer or mirrored from
+// another cluster before it is stored. An error drops the item.
+type RemoteSetHook interface {
+	AcceptRemote(item *CacheItem) error
+}
+
+type HookFactory func(args map[string]string) (Hook, error)
+
+var (
+	hookFactories = map[string]HookFactory{
+		"lowercase-keys": newLowercaseKeysHook,
+		"strip-fields":   newStripFieldsHook,
+		"metadata":       newMetadataHook,
+	}
+	hookFactoriesMutex sync.RWMutex
+)
+
+func RegisterHookFactory(name string, factory HookFactory) {
+	hookFactoriesMutex.Lock()
+	defer hookFactoriesMutex.Unlock()
+	hookFactories[name] = factory
+}
+
+func NewHook(name string, args map[string]string) (Hook, error) {
+	hookFactoriesMutex.RLock()
+	factory, exists := hookFactories[name]
+	hookFactoriesMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown hook %q", name)
+	}
+	return factory(args)
+}
+
+type registeredHook struct {
+	prefix string
+	hook   Hook
+}
+
+type hookChain struct {
+	hooks []registeredHook
+	mutex sync.RWMutex
+}
+
+func (c *hookChain) add(prefix string, hook Hook) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.hooks = append(c.hooks, registeredHook{prefix: prefix, hook: hook})
+}
+
+func (c *hookChain) matching(key string) []Hook {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	hooks := make([]Hook, 0, len(c.hooks))
+	for _, h := range c.hooks {
+		if strings.HasPrefix(key, h.prefix) {
+			hooks = append(hooks, h.hook)
+		}
+	}
+	return hooks
+}
+
+func (c *hookChain) normalizeKey(key string) string {
+	for _, hook := range c.matching(key) {
+		if kh, ok := hook.(KeyHook); ok {
+			key = kh.NormalizeKey(key)
+		}
+	}
+	return key
+}
+
+func (c *hookChain) beforeSet(item *CacheItem) error {
+	for _, hook := range c.matching(item.Key) {
+		if sh, ok := hook.(SetHook); ok {
+			if err := sh.BeforeSet(item); err != nil {
+				return fmt.Errorf("hook %s rejected set: %w", hook.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *hookChain) afterSet(ctx context.Context, item *CacheItem) error {
+	for _, hook := range c.matching(item.Key) {
+		if ah, ok := hook.(AfterSetHook); ok {
+			if err := ah.AfterSet(ctx, item); err != nil {
+				return fmt.Errorf("hook %s failed after set: %w", hook.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *hookChain) acceptRemote(item *CacheItem) error {
+	for _, hook := range c.matching(item.Key) {
+		if rh, ok := hook.(RemoteSetHook); ok {
+			if err := rh.AcceptRemote(item); err != nil {
+				return fmt.Errorf("hook %s rejected replicated set: %w", hook.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *hookChain) afterGet(item *CacheItem) (*CacheItem, error) {
+	for _, hook := range c.matching(item.Key) {
+		if gh, ok := hook.(GetHook); ok {
+			transformed, err := gh.AfterGet(item)
+			if err != nil {
+				return nil, fmt.Errorf("hook %s failed on get: %w", hook.Name(), err)
+			}
+			item = transformed
+		}
+	}
+	return item, nil
+}
+
+type lowercaseKeysHook struct{}
+
+func newLowercaseKeysHook(args map[string]string) (Hook, error) {
+	return lowercaseKeysHook{}, nil
+}
+
+func (lowercaseKeysHook) Name() string { return "lowercase-keys" }
+
+func (lowercaseKeysHook) NormalizeKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// stripFieldsHook removes top-level fields from JSON object values, both
+// before they are stored and (for values written before the hook existed)
+// when they are read back.
+type stripFieldsHook struct {
+	fields []string
+}
+
+func newStripFieldsHook(args map[string]string) (Hook, error) {
+	var fields []string
+	for _, field := range strings.Split(args["fields"], ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("strip-fields hook requires a \"fields\" argument")
+	}
+	return &stripFieldsHook{fields: fields}, nil
+}
+
+func (h *stripFieldsHook) Name() string { return "strip-fields" }
+
+func (h *stripFieldsHook) BeforeSet(item *CacheItem) error {
+	item.Value = h.strip(item.Value)
+	return nil
+}
+
+func (h *stripFieldsHook) AfterGet(item *CacheItem) (*CacheItem, error) {
+	stripped := h.strip(item.Value)
+	if stripped == item.Value {
+		return item, nil
+	}
+
+	itemCopy := *item
+	itemCopy.Value = stripped
+	return &itemCopy, nil
+}
+
+func (h *stripFieldsHook) strip(value string) string {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return value
+	}
+
+	removed := false
+	for _, field := range h.fields {
+		if _, exists := doc[field]; exists {
+			delete(doc, field)
+			removed = true
+		}
+	}
+	if !removed {
+		return value
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return value
+	}
+	return string(data)
+}
+
+type metadataHook struct {
+	labels map[string]string
+}
+
+func newMetadataHook(args map[string]string) (Hook, error) {
+	labels := make(map[string]string, len(args))
+	for k, v := range args {
+		labels[k] = v
+	}
+	return &metadataHook{labels: labels}, nil
+}
+
+func (h *metadataHook) Name() string { return "metadata" }
+
+// BeforeSet gives item a new map rather than writing to its own, which
+// the caller may share.
+func (h *metadataHook) BeforeSet(item *CacheItem) error {
+	metadata := make(map[string]string, len(item.Metadata)+len(h.labels)+2)
+	for k, v := range item.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range h.labels {
+		metadata[k] = v
+	}
+	metadata["origin_region"] = item.Region
+	metadata["origin_node"] = item.NodeID
+	item.Metadata = metadata
+	return nil
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hot keys are the keys this node serves most reads of. Reads that hit
+// are counted per key in hotKeyBuckets buckets spanning the window, so the
+// counts cover between the window less one bucket and the full window,
+// and a bucket is cleared as the window moves past it. Each bucket counts
+// at most maxKeys distinct keys; reads of further keys are only counted
+// as untracked, so a scan can't grow the counts without bound.
+
+const hotKeyBuckets = 10
+
+// HotKey is a key and how many reads of it hit within the window.
+type HotKey struct {
+	Key  string `json:"key"`
+	Hits uint64 `json:"hits"`
+}
+
+// HotKeysReport lists the most read keys within the window.
+type HotKeysReport struct {
+	WindowSeconds float64 `json:"window_seconds"`
+	// Hits counts every read that hit within the window, and Untracked
+	// those of keys read after a bucket already counted its maximum.
+	Hits      uint64   `json:"hits"`
+	Untracked uint64   `json:"untracked"`
+	Keys      []HotKey `json:"keys"`
+}
+
+type hotKeys struct {
+	mutex   sync.Mutex
+	width   time.Duration
+	maxKeys int
+	buckets [hotKeyBuckets]hotKeyBucket
+}
+
+type hotKeyBucket struct {
+	start     time.Time
+	counts    map[string]uint64
+	hits      uint64
+	untracked uint64
+}
+
+// EnableHotKeys starts counting reads per key over window, tracking up to
+// maxKeys distinct keys at a time.
+func (m *Manager) EnableHotKeys(window time.Duration, maxKeys int) {
+	width := window / hotKeyBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	m.mutex.Lock()
+	m.hotKeys = &hotKeys{width: width, maxKeys: maxKeys}
+	m.mutex.Unlock()
+}
+
+// bucket returns the bucket counting reads at now, cleared if it last
+// counted an earlier round of the window.
+func (h *hotKeys) bucket(now time.Time) *hotKeyBucket {
+	start := now.Truncate(h.width)
+	b := &h.buckets[(start.UnixNano()/int64(h.width))%hotKeyBuckets]
+	if !b.start.Equal(start) {
+		*b = hotKeyBucket{start: start, counts: make(map[string]uint64)}
+	}
+	return b
+}
+
+func (h *hotKeys) count(key string, now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	b := h.bucket(now)
+	b.hits++
+	if _, tracked := b.counts[key]; !tracked && len(b.counts) >= h.maxKeys {
+		b.untracked++
+		return
+	}
+	b.counts[key]++
+}
+
+// HotKeys returns the limit keys starting with prefix that were read most
+// within the window, most read first. It returns nil unless EnableHotKeys
+// was called.
+func (m *Manager) HotKeys(prefix string, limit int) *HotKeysReport {
+	m.mutex.RLock()
+	h := m.hotKeys
+	m.mutex.RUnlock()
+	if h == nil {
+		return nil
+	}
+
+	now := m.now()
+	report := &HotKeysReport{WindowSeconds: (h.width * hotKeyBuckets).Seconds(), Keys: []HotKey{}}
+	totals := make(map[string]uint64)
+	h.mutex.Lock()
+	oldest := now.Truncate(h.width).Add(-h.width * (hotKeyBuckets - 1))
+	for i := range h.buckets {
+		b := &h.buckets[i]
+		if b.start.Before(oldest) {
+			continue
+		}
+		report.Hits += b.hits
+		report.Untracked += b.untracked
+		for key, hits := range b.counts {
+			if strings.HasPrefix(key, prefix) {
+				totals[key] += hits
+			}
+		}
+	}
+	h.mutex.Unlock()
+
+	for key, hits := range totals {
+		report.Keys = append(report.Keys, HotKey{Key: key, Hits: hits})
+	}
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Hits != report.Keys[j].Hits {
+			return report.Keys[i].Hits > report.Keys[j].Hits
+		}
+		return report.Keys[i].Key < report.Keys[j].Key
+	})
+	if limit > 0 && len(report.Keys) > limit {
+		report.Keys = report.Keys[:limit]
+	}
+	return report
+}
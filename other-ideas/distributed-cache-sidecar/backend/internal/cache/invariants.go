@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"distributed-cache-sidecar/internal/lifecycle"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// invariants tracks what CheckInvariants compares the store against: a
+// shadow copy of the items rebuilt from the journaled mutations alone, and
+// violations seen on the read path since the last check.
+type invariants struct {
+	mutex  sync.Mutex
+	shadow map[string]*CacheItem
+	served []string
+}
+
+// EnableInvariantChecks makes the manager keep what CheckInvariants needs.
+// It costs a map entry per item and a check on every read, so it is meant
+// for tests and staging rather than production.
+func (m *Manager) EnableInvariantChecks() {
+	inv := &invariants{shadow: make(map[string]*CacheItem)}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, item := range m.items {
+		inv.shadow[key] = item
+	}
+	m.mutationListeners = append(m.mutationListeners, func(mutation Mutation) {
+		inv.mutex.Lock()
+		defer inv.mutex.Unlock()
+		Replay(inv.shadow, mutation)
+	})
+	m.invariants = inv
+}
+
+// checkServed records a violation if a read is about to return an item
+// that had expired at the time it was looked up.
+func (m *Manager) checkServed(item *CacheItem, now time.Time) {
+	if m.invariants == nil || !item.expiredAt(now) {
+		return
+	}
+	m.invariants.mutex.Lock()
+	defer m.invariants.mutex.Unlock()
+	m.invariants.served = append(m.invariants.served, fmt.Sprintf("served: %s was read at %s after expiring", item.Key, now.Format(time.RFC3339Nano)))
+}
+
+// CheckInvariants verifies the manager's internal state and describes
+// every violation it finds, or returns nil. It checks that stats match
+// the items held, that the byte count matches their sizes and the limits
+// are kept, that the recency list holds exactly the stored keys, that
+// replaying the journal gives the same items, so deletes and evictions
+// were all journaled, and that history's latest version of each key,
+// including deletions, agrees with the store. Reads of expired items
+// since the last check are reported too. It returns nil if checks were
+// not enabled.
+func (m *Manager) CheckInvariants() []string {
+	if m.invariants == nil {
+		return nil
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var violations []string
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	local, size := 0, int64(0)
+	for _, item := range m.items {
+		if item.NodeID == m.nodeID {
+			local++
+		}
+		size += item.size()
+	}
+	size -= m.dedupSavings()
+	if m.stats.TotalItems != len(m.items) {
+		violate("stats: total_items is %d but %d items are held", m.stats.TotalItems, len(m.items))
+	}
+	if m.stats.LocalItems != local || m.stats.RemoteItems != len(m.items)-local {
+		violate("stats: %d local and %d remote items counted but %d and %d held", m.stats.LocalItems, m.stats.RemoteItems, local, len(m.items)-local)
+	}
+	if m.bytes != size || m.stats.MemoryBytes != size {
+		violate("memory: %d bytes counted and %d in stats but items add up to %d", m.bytes, m.stats.MemoryBytes, size)
+	}
+	if m.overCapacity() {
+		violate("capacity: %d items held, more than the capacity of %d", len(m.items), m.capacity)
+	}
+	if m.overBudget() {
+		violate("memory: %d bytes held, more than the limit of %d", m.bytes, m.maxBytes)
+	}
+
+	violations = append(violations, m.recency.check(m.items)...)
+
+	m.invariants.mutex.Lock()
+	for key, item := range m.items {
+		if shadowed, found := m.invariants.shadow[key]; !found {
+			violate("journal: %s is held but the journal has no set for it", key)
+		} else if shadowed != item {
+			violate("journal: %s holds version %d but the journal last set version %d", key, item.Version, shadowed.Version)
+		}
+	}
+	for key := range m.invariants.shadow {
+		if _, found := m.items[key]; !found {
+			violate("journal: %s is gone but its delete was never journaled", key)
+		}
+	}
+	violations = append(violations, m.invariants.served...)
+	m.invariants.served = nil
+	m.invariants.mutex.Unlock()
+
+	if m.history != nil {
+		violations = append(violations, m.history.check(m.items)...)
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+// WatchInvariants runs CheckInvariants every interval until shutdown and
+// passes any violations to report.
+func (m *Manager) WatchInvariants(interval time.Duration, report func(violations []string)) {
+	lifecycle.Go("invariant-checker", "", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lifecycle.Stopping():
+				return
+			case <-ticker.C:
+			}
+			if violations := m.CheckInvariants(); len(violations) > 0 {
+				report(violations)
+			}
+		}
+	})
+}
+
+// check compares the recency list with items.
+func (r *recency) check(items map[string]*CacheItem) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var violations []string
+	if r.order.Len() != len(r.elements) {
+		violations = append(violations, fmt.Sprintf("recency: list has %d entries but its index %d", r.order.Len(), len(r.elements)))
+	}
+	for element := r.order.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+		if r.elements[key] != element {
+			violations = append(violations, fmt.Sprintf("recency: %s is listed but not indexed", key))
+		}
+		if _, found := items[key]; !found {
+			violations = append(violations, fmt.Sprintf("recency: %s is listed but not held", key))
+		}
+	}
+	for key := range items {
+		if _, found := r.elements[key]; !found {
+			violations = append(violations, fmt.Sprintf("recency: %s is held but not listed, so it can never be evicted", key))
+		}
+	}
+	return violations
+}
+
+// check compares the latest version history holds for each key with
+// items: a key history last saw deleted must not be held, and a held key
+// must be the version history last saw set.
+func (h *history) check(items map[string]*CacheItem) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var violations []string
+	for key, kh := range h.keys {
+		if len(kh.versions) == 0 {
+			continue
+		}
+		latest := kh.versions[len(kh.versions)-1].item
+		item, held := items[key]
+		switch {
+		case latest == nil && held:
+			violations = append(violations, fmt.Sprintf("history: %s was deleted but is still held", key))
+		case latest != nil && !held:
+			violations = append(violations, fmt.Sprintf("history: %s is gone but history has no delete for it", key))
+		case latest != nil && latest != item:
+			violations = append(violations, fmt.Sprintf("history: %s holds version %d but history last saw version %d", key, item.Version, latest.Version))
+		}
+	}
+	return violations
+}
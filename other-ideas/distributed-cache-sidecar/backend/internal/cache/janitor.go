@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"distributed-cache-sidecar/internal/lifecycle"
+	"time"
+)
+
+// StartJanitor removes expired items every interval until StopJanitor is
+// called or the process begins shutting down. Without it expired items
+// are only hidden from reads, and a key written once and never read again
+// holds its memory for good.
+func (m *Manager) StartJanitor(interval time.Duration) {
+	stop := make(chan struct{})
+	m.janitorStop = stop
+	lifecycle.Go("cache-janitor", "", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-lifecycle.Stopping():
+				return
+			case <-ticker.C:
+				m.SweepExpired()
+			}
+		}
+	})
+}
+
+func (m *Manager) StopJanitor() {
+	if m.janitorStop != nil {
+		close(m.janitorStop)
+		m.janitorStop = nil
+	}
+}
+
+// SweepExpired removes every expired item and returns how many it removed.
+// It finds them under the read lock and takes the write lock only to
+// remove them, so reads and writes are held up for as long as the removal
+// takes rather than for the whole scan. Like evictions, removals are
+// journaled as deletes and not replicated: peers expire their copies on
+// their own clocks.
+func (m *Manager) SweepExpired() int {
+	m.mutex.RLock()
+	now := m.now()
+	var expired []string
+	for key, item := range m.items {
+		if item.expiredAt(now) {
+			expired = append(expired, key)
+		}
+	}
+	m.mutex.RUnlock()
+	if len(expired) == 0 {
+		return 0
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	removed := 0
+	for _, key := range expired {
+		// The key may have been rewritten since the scan.
+		if item, exists := m.items[key]; exists && item.expiredAt(now) {
+			m.remove(key)
+			m.recordMutation(MutationDelete, &CacheItem{Key: key})
+			removed++
+		}
+	}
+	m.stats.ExpiredCount += removed
+	m.updateStats()
+	return removed
+}
@@ -0,0 +1,106 @@
+package cache
+
+import "time"
+
+const (
+	MutationSet    = "set"
+	MutationDelete = "delete"
+	// MutationReset clears every item. It is journaled on startup and
+	// before a restore, so replaying a journal from its first entry always
+	// reproduces the cache.
+	MutationReset = "reset"
+)
+
+type Mutation struct {
+	Sequence  uint64     `json:"sequence"`
+	Timestamp time.Time  `json:"timestamp"`
+	Op        string     `json:"op"`
+	Key       string     `json:"key,omitempty"`
+	Item      *CacheItem `json:"item,omitempty"`
+}
+
+// SetJournal registers a callback that receives every mutation in sequence
+// order, and continues numbering after sequence (the last sequence already
+// in the journal). The callback runs with the manager lock held.
+func (m *Manager) SetJournal(sequence uint64, journal func(Mutation)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sequence = sequence
+	m.journal = journal
+	m.recordMutation(MutationReset, nil)
+	for _, item := range m.items {
+		m.recordMutation(MutationSet, item)
+	}
+}
+
+// SetDurability registers a function that blocks until the journal has
+// made the mutation with the given sequence durable. Local writes call it
+// after releasing the manager lock, so they return once they are on disk
+// while other writes carry on and can share the same sync.
+func (m *Manager) SetDurability(wait func(sequence uint64)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.awaitDurable = wait
+}
+
+func (m *Manager) durable(sequence uint64) {
+	m.mutex.RLock()
+	wait := m.awaitDurable
+	m.mutex.RUnlock()
+
+	if wait != nil {
+		wait(sequence)
+	}
+}
+
+// AddMutationListener registers a callback for every mutation, local or
+// replicated, including deletes and resets. Like the journal it runs with
+// the manager lock held and must not block or call back into the manager.
+func (m *Manager) AddMutationListener(listener func(Mutation)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mutationListeners = append(m.mutationListeners, listener)
+}
+
+func (m *Manager) recordMutation(op string, item *CacheItem) {
+	m.sequence++
+	if m.journal == nil && len(m.mutationListeners) == 0 {
+		return
+	}
+
+	mutation := Mutation{
+		Sequence:  m.sequence,
+		Timestamp: m.now(),
+		Op:        op,
+	}
+	if item != nil {
+		mutation.Key = item.Key
+		if op == MutationSet {
+			mutation.Item = item
+		}
+	}
+	if m.journal != nil {
+		m.journal(mutation)
+	}
+	for _, listener := range m.mutationListeners {
+		listener(mutation)
+	}
+}
+
+// Replay applies mutations to items in order. It is used to rebuild the
+// cache as of an earlier point from a base checkpoint and the journal.
+func Replay(items map[string]*CacheItem, mutation Mutation) {
+	switch mutation.Op {
+	case MutationSet:
+		if mutation.Item != nil {
+			items[mutation.Key] = mutation.Item
+		}
+	case MutationDelete:
+		delete(items, mutation.Key)
+	case MutationReset:
+		for key := range items {
+			delete(items, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidKey = errors.New("invalid key")
+
+const tenantSeparator = ":"
+
+// KeyPolicy restricts which keys may be stored. Control characters are
+// always rejected because they break the line-based peer protocol.
+type KeyPolicy struct {
+	MaxLength        int
+	Pattern          *regexp.Regexp
+	RequiredPrefixes []string
+	RequireTenant    bool
+	RejectURLUnsafe  bool
+}
+
+func NewKeyPolicy(maxLength int, pattern string, requiredPrefixes []string, requireTenant, rejectURLUnsafe bool) (*KeyPolicy, error) {
+	policy := &KeyPolicy{
+		MaxLength:        maxLength,
+		RequiredPrefixes: requiredPrefixes,
+		RequireTenant:    requireTenant,
+		RejectURLUnsafe:  rejectURLUnsafe,
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern: %v", err)
+		}
+		policy.Pattern = re
+	}
+	return policy, nil
+}
+
+func (p *KeyPolicy) Validate(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: key must not be empty", ErrInvalidKey)
+	}
+	if p.MaxLength > 0 && len(key) > p.MaxLength {
+		return &KeyError{Key: key, Err: ErrTooLarge, Cause: fmt.Errorf("%w: key exceeds %d bytes", ErrInvalidKey, p.MaxLength)}
+	}
+
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: key contains control character %q", ErrInvalidKey, r)
+		}
+		if p.RejectURLUnsafe && !isURLSafe(r) {
+			return fmt.Errorf("%w: key contains URL-unsafe character %q", ErrInvalidKey, r)
+		}
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(key) {
+		return fmt.Errorf("%w: key does not match pattern %s", ErrInvalidKey, p.Pattern.String())
+	}
+
+	if len(p.RequiredPrefixes) > 0 {
+		matched := false
+		for _, prefix := range p.RequiredPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: key must start with one of %s", ErrInvalidKey, strings.Join(p.RequiredPrefixes, ", "))
+		}
+	}
+
+	if p.RequireTenant {
+		tenant, rest, found := strings.Cut(key, tenantSeparator)
+		if !found || tenant == "" || rest == "" {
+			return fmt.Errorf("%w: key must have the form <tenant>%s<name>", ErrInvalidKey, tenantSeparator)
+		}
+	}
+
+	return nil
+}
+
+func isURLSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("-._~:@!$&'()*+,;=", r)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxLength       int
+		pattern         string
+		prefixes        []string
+		requireTenant   bool
+		rejectURLUnsafe bool
+		key             string
+		want            error
+	}{
+		{name: "any key by default", key: "user:42|profile with spaces"},
+		{name: "empty", key: "", want: ErrInvalidKey},
+		{name: "control character", key: "user\n42", want: ErrInvalidKey},
+		{name: "unicode control character", key: "user\u008542", want: ErrInvalidKey},
+		{name: "at the length limit", maxLength: 4, key: "abcd"},
+		{name: "over the length limit", maxLength: 4, key: "abcde", want: ErrTooLarge},
+		{name: "length counts bytes", maxLength: 4, key: "ééé", want: ErrTooLarge},
+		{name: "matches pattern", pattern: `^[a-z]+:\d+$`, key: "user:42"},
+		{name: "doesn't match pattern", pattern: `^[a-z]+:\d+$`, key: "user:ada", want: ErrInvalidKey},
+		{name: "has a required prefix", prefixes: []string{"user:", "session:"}, key: "session:1"},
+		{name: "lacks required prefixes", prefixes: []string{"user:", "session:"}, key: "order:1", want: ErrInvalidKey},
+		{name: "has tenant", requireTenant: true, key: "contoso:user:42"},
+		{name: "no tenant separator", requireTenant: true, key: "user42", want: ErrInvalidKey},
+		{name: "empty tenant", requireTenant: true, key: ":user42", want: ErrInvalidKey},
+		{name: "empty name after tenant", requireTenant: true, key: "contoso:", want: ErrInvalidKey},
+		{name: "URL-safe", rejectURLUnsafe: true, key: "user:42@eu-west~1"},
+		{name: "URL-unsafe space", rejectURLUnsafe: true, key: "user 42", want: ErrInvalidKey},
+		{name: "URL-unsafe slash", rejectURLUnsafe: true, key: "user/42", want: ErrInvalidKey},
+		{name: "URL-unsafe pipe", rejectURLUnsafe: true, key: "user|42", want: ErrInvalidKey},
+		{name: "URL-unsafe non-ASCII", rejectURLUnsafe: true, key: "usér", want: ErrInvalidKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewKeyPolicy(test.maxLength, test.pattern, test.prefixes, test.requireTenant, test.rejectURLUnsafe)
+			if err != nil {
+				t.Fatalf("NewKeyPolicy: %v", err)
+			}
+			err = policy.Validate(test.key)
+			if test.want == nil && err != nil {
+				t.Errorf("Validate(%q): %v", test.key, err)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("Validate(%q) error = %v, want %v", test.key, err, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyPolicyRejectsInvalidPattern(t *testing.T) {
+	if _, err := NewKeyPolicy(0, "user:(", nil, false, false); err == nil || !strings.Contains(err.Error(), "invalid key pattern") {
+		t.Errorf("NewKeyPolicy error = %v, want an invalid key pattern", err)
+	}
+}
+
+func TestManagerAppliesKeyPolicy(t *testing.T) {
+	m := NewManager("test", "node-a")
+	policy, err := NewKeyPolicy(0, "", []string{"user:"}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetKeyPolicy(policy)
+
+	if err := m.Set("user:1", "ok", 0); err != nil {
+		t.Errorf("Set of an allowed key: %v", err)
+	}
+	if err := m.Set("order:1", "no", 0); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set of a disallowed key error = %v, want %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"encoding/json"
+	"errors"
+)
+
+// TypeList is the CacheItem.Type of a list.
+const TypeList = "list"
+
+var ErrWrongType = errors.New("operation against a key holding the wrong type of value")
+
+// Lists hold strings in order, for queues and recent-activity feeds. A
+// list is stored and replicated as a whole item whose Value is a JSON
+// array, so the usual TTL, eviction, journal and SYNC handling apply and
+// peers rebuild the list from the item's type. Like counters, a list is
+// updated atomically on the node that applies the change, while changes
+// made to one list on two nodes at once resolve last-writer-wins. A list
+// popped empty is kept as an empty list rather than deleted, since
+// deletes aren't replicated.
+
+// values decodes the strings held by item, which must be of type typ.
+func (item *CacheItem) values(typ string) ([]string, error) {
+	if item.Type != typ {
+		return nil, &KeyError{Key: item.Key, Err: ErrWrongType}
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(item.Value), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ListPush adds values to the left (head) or right (tail) end of the list
+// under key, creating it with the TTL, sliding flag and metadata in
+// options if there is none, and returns the list's new length. Values
+// pushed to the left end together end up in reverse order, as if pushed
+// one at a time.
+func (m *Manager) ListPush(ctx context.Context, key string, left bool, values []string, options WriteOptions) (int, error) {
+	var length int
+	err := m.updateStrings(ctx, key, TypeList, options, true, func(list []string) ([]string, bool) {
+		if left {
+			pushed := make([]string, 0, len(values)+len(list))
+			for i := len(values) - 1; i >= 0; i-- {
+				pushed = append(pushed, values[i])
+			}
+			list = append(pushed, list...)
+		} else {
+			list = append(list, values...)
+		}
+		length = len(list)
+		return list, len(values) > 0
+	})
+	return length, err
+}
+
+// ListPop removes and returns up to count values from the left or right
+// end of the list under key, nearest the end first.
+func (m *Manager) ListPop(ctx context.Context, key string, left bool, count int, options WriteOptions) ([]string, error) {
+	popped := []string{}
+	err := m.updateStrings(ctx, key, TypeList, options, false, func(list []string) ([]string, bool) {
+		if count > len(list) {
+			count = len(list)
+		}
+		if count <= 0 {
+			return list, false
+		}
+		if left {
+			popped = append(popped, list[:count]...)
+			return list[count:], true
+		}
+		for i := len(list) - 1; i >= len(list)-count; i-- {
+			popped = append(popped, list[i])
+		}
+		return list[:len(list)-count], true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return popped, nil
+}
+
+// ListRange returns the values of the list under key from start to stop,
+// inclusive, and the list's length. Negative indexes count from the end,
+// so 0 and -1 return the whole list; indexes beyond either end are
+// clamped.
+func (m *Manager) ListRange(ctx context.Context, key string, start, stop int) ([]string, int, error) {
+	item, err := m.Read(ctx, key, ReadOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	list, err := item.values(TypeList)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	length := len(list)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop {
+		return []string{}, length, nil
+	}
+	return append([]string{}, list[start:stop+1]...), length, nil
+}
+
+// updateStrings applies update to the strings held by the list or set
+// under key, of type typ, and stores the result unless update reports no
+// change. A missing or expired key holds no strings if create is set and
+// is ErrNotFound otherwise.
+func (m *Manager) updateStrings(ctx context.Context, key, typ string, options WriteOptions, create bool, update func([]string) ([]string, bool)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return err
+	}
+
+	sequence, item, err := m.storeStrings(key, typ, options, create, update)
+	if err != nil || item == nil {
+		return err
+	}
+	return m.settle(ctx, item, sequence, options)
+}
+
+func (m *Manager) storeStrings(key, typ string, options WriteOptions, create bool, update func([]string) ([]string, bool)) (uint64, *CacheItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item := &CacheItem{
+		Key:      key,
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Sliding:  options.Sliding,
+		Encoding: codec.EncodingJSON,
+		Type:     typ,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+
+	var list []string
+	existing, exists := m.items[key]
+	if exists && !existing.expiredAt(m.now()) {
+		var err error
+		if list, err = existing.values(typ); err != nil {
+			return 0, nil, err
+		}
+		item.inherit(existing, m.now())
+	} else if !create {
+		return 0, nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+
+	list, changed := update(list)
+	if !changed {
+		return 0, nil, nil
+	}
+	if list == nil {
+		list = []string{}
+	}
+	document, err := json.Marshal(list)
+	if err != nil {
+		return 0, nil, err
+	}
+	item.Value = string(document)
+
+	if err := m.hooks.beforeSet(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkSize(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, nil, err
+	}
+
+	item.Timestamp = m.stamp(existing)
+	if exists {
+		item.Version = existing.Version + 1
+	} else {
+		item.Version = 1
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	return m.sequence, item, nil
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// itemOverhead approximates what an item costs beyond its strings: the
+// CacheItem itself, its map entry and its recency list element.
+const itemOverhead = 200
+
+// size approximates the memory item holds. It counts string bytes rather
+// than measuring the heap, which is close enough to budget by when values
+// range from a few bytes to megabytes.
+func (item *CacheItem) size() int64 {
+	size := int64(itemOverhead + len(item.Key) + len(item.Value) + len(item.Region) + len(item.NodeID) + len(item.Encoding))
+	for name, value := range item.Metadata {
+		size += int64(len(name) + len(value))
+	}
+	for _, tag := range item.Tags {
+		size += int64(len(tag))
+	}
+	return size
+}
+
+// recency orders keys from most to least recently used. Reads touch it
+// while holding only the manager's read lock, so it has a lock of its own.
+type recency struct {
+	order    *list.List
+	elements map[string]*list.Element
+	mutex    sync.Mutex
+}
+
+func newRecency() *recency {
+	return &recency{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// touch marks key as just used, adding it if it is new.
+func (r *recency) touch(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if element, exists := r.elements[key]; exists {
+		r.order.MoveToFront(element)
+		return
+	}
+	r.elements[key] = r.order.PushFront(key)
+}
+
+func (r *recency) remove(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if element, exists := r.elements[key]; exists {
+		r.order.Remove(element)
+		delete(r.elements, key)
+	}
+}
+
+// oldest returns the least recently used key.
+func (r *recency) oldest() (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	element := r.order.Back()
+	if element == nil {
+		return "", false
+	}
+	return element.Value.(string), true
+}
+
+func (r *recency) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.order.Init()
+	r.elements = make(map[string]*list.Element)
+}
+
+// SetCapacity limits the cache to capacity items, evicting the least
+// recently used ones beyond it. Zero means no limit.
+func (m *Manager) SetCapacity(capacity int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.capacity = capacity
+	m.evictOverflow()
+	m.updateStats()
+}
+
+// SetMemoryLimit limits the approximate size of the items held to maxBytes,
+// evicting the least recently used ones beyond it. Zero means no limit.
+func (m *Manager) SetMemoryLimit(maxBytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.maxBytes = maxBytes
+	m.evictOverflow()
+	m.updateStats()
+}
+
+// SetMaxValueSize limits values, as stored, to maxBytes bytes, for local
+// writes and replicated items alike. Zero means no limit.
+func (m *Manager) SetMaxValueSize(maxBytes int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.maxValueBytes = maxBytes
+}
+
+// MaxValueSize returns the limit set by SetMaxValueSize.
+func (m *Manager) MaxValueSize() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.maxValueBytes
+}
+
+// checkValueSize rejects an item whose value is over the value size
+// limit.
+func (m *Manager) checkValueSize(item *CacheItem) error {
+	if m.maxValueBytes > 0 && len(item.Value) > m.maxValueBytes {
+		return &KeyError{Key: item.Key, Err: ErrTooLarge, Cause: fmt.Errorf("%w: value of %d bytes exceeds the %d byte limit", ErrTooLarge, len(item.Value), m.maxValueBytes)}
+	}
+	return nil
+}
+
+// checkSize rejects a local write of an item whose value is over the
+// value size limit or that could not fit in the memory budget even with
+// everything else evicted.
+func (m *Manager) checkSize(item *CacheItem) error {
+	if err := m.checkValueSize(item); err != nil {
+		return err
+	}
+	if m.maxBytes > 0 && item.size() > m.maxBytes {
+		return &KeyError{Key: item.Key, Err: ErrTooLarge, Cause: fmt.Errorf("%w: item of about %d bytes exceeds the %d byte memory limit", ErrTooLarge, item.size(), m.maxBytes)}
+	}
+	return nil
+}
+
+// put stores item under its key as the most recently used one and evicts
+// whatever no longer fits. The caller holds the write lock and records
+// the mutation.
+func (m *Manager) put(item *CacheItem) {
+	if existing, exists := m.items[item.Key]; exists {
+		m.bytes -= m.discharge(existing)
+		m.tags.drop(existing)
+		m.dischargeQuota(existing, false)
+	}
+	m.items[item.Key] = item
+	m.tags.add(item)
+	m.bytes += m.charge(item)
+	m.chargeQuota(item)
+	m.recency.touch(item.Key)
+	m.evictOverflow()
+}
+
+// remove deletes key from the store. The caller holds the write lock.
+func (m *Manager) remove(key string) {
+	if existing, exists := m.items[key]; exists {
+		m.bytes -= m.discharge(existing)
+		m.tags.drop(existing)
+		m.dischargeQuota(existing, true)
+	}
+	delete(m.items, key)
+	m.recency.remove(key)
+}
+
+// evictOverflow drops least recently used items until the cache is within
+// capacity and the memory budget. The most recently used item is never
+// evicted for memory, so one replicated item bigger than the whole budget
+// is still held. Evictions are journaled as deletes so a replay ends up
+// with the same items, but they are not replicated: peers keep their
+// copies.
+func (m *Manager) evictOverflow() {
+	for m.overCapacity() || m.overBudget() {
+		key, found := m.recency.oldest()
+		if !found {
+			return
+		}
+		m.remove(key)
+		m.recordMutation(MutationDelete, &CacheItem{Key: key})
+		m.stats.EvictionCount++
+	}
+}
+
+func (m *Manager) overCapacity() bool {
+	return m.capacity > 0 && len(m.items) > m.capacity
+}
+
+func (m *Manager) overBudget() bool {
+	return m.maxBytes > 0 && m.bytes > m.maxBytes && len(m.items) > 1
+}
@@ -1,117 +1,691 @@
 package cache
 
 import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/schema"
 	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
 	"sync"
 	"time"
 )
 
+// CacheItem is never modified once it is stored: writes replace the item
+// in the map rather than updating it, so views and readers can share it.
 type CacheItem struct {
-	Key       string    `json:"key"`
-	Value     string    `json:"value"`
-	Region    string    `json:"region"`
-	NodeID    string    `json:"node_id"`
-	Timestamp time.Time `json:"timestamp"`
-	TTL       int64     `json:"ttl"`
+	Key       string            `json:"key"`
+	Value     string            `json:"value"`
+	Region    string            `json:"region"`
+	NodeID    string            `json:"node_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	TTL       int64             `json:"ttl"`
+	Encoding  string            `json:"encoding,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Version   uint64            `json:"version"`
+	// Sliding items restart their TTL whenever they are read; Touched is
+	// when that last happened, or when TOUCH was last called.
+	Sliding bool       `json:"sliding,omitempty"`
+	Touched *time.Time `json:"touched,omitempty"`
+	// Type is empty for a plain value and TypeList for a list, whose
+	// Value is a JSON array of strings.
+	Type string `json:"type,omitempty"`
+	// MaxReads, when positive, is how many reads the item serves before
+	// it is deleted; Reads counts those served so far.
+	MaxReads int64 `json:"max_reads,omitempty"`
+	Reads    int64 `json:"reads,omitempty"`
+	// Tags are the groups the item is invalidated with, sorted.
+	Tags []string `json:"tags,omitempty"`
+
+	// deleted marks an item published to subscribers that stands for the
+	// delete of the write it names.
+	deleted bool
+}
+
+// renewedAt is when the item's TTL started counting down: when it was
+// written, or when it was last touched if that is later.
+func (item *CacheItem) renewedAt() time.Time {
+	if item.Touched != nil && item.Touched.After(item.Timestamp) {
+		return *item.Touched
+	}
+	return item.Timestamp
+}
+
+// ExpiresAt returns when the item expires, or the zero time if it never
+// does.
+func (item *CacheItem) ExpiresAt() time.Time {
+	if item.TTL <= 0 {
+		return time.Time{}
+	}
+	return item.renewedAt().Add(time.Duration(item.TTL) * time.Second)
+}
+
+func (item *CacheItem) expiredAt(at time.Time) bool {
+	return item.TTL > 0 && at.Sub(item.renewedAt()).Seconds() > float64(item.TTL)
+}
+
+// supersedes reports whether item wins over other under last-writer-wins.
+// The later timestamp wins; equal timestamps are broken by node ID so
+// that every node picks the same winner whatever order they arrive in.
+func (item *CacheItem) supersedes(other *CacheItem) bool {
+	if !item.Timestamp.Equal(other.Timestamp) {
+		return item.Timestamp.After(other.Timestamp)
+	}
+	return item.NodeID > other.NodeID
+}
+
+// remainingTTL is the TTL, in whole seconds rounded up, that makes an
+// item written at the given time expire when this one does. It is zero
+// for items without a TTL.
+func (item *CacheItem) remainingTTL(at time.Time) int64 {
+	if item.TTL <= 0 {
+		return 0
+	}
+	remaining := ttlSeconds(item.ExpiresAt().Sub(at))
+	if remaining < 1 {
+		remaining = 1
+	}
+	return remaining
 }
 
 type Manager struct {
-	region   string
-	nodeID   string
-	items    map[string]*CacheItem
-	mutex    sync.RWMutex
-	stats    *Stats
-	onChange chan *CacheItem
+	region string
+	nodeID string
+	items  map[string]*CacheItem
+	mutex  sync.RWMutex
+	stats  *Stats
+	// subscriptions deliver local changes to replicate and to observe.
+	subscriptions subscriptions
+	onPatch       chan *PatchOp
+	onBatch       chan []*CacheItem
+	// onInvalidate carries local tag invalidations to replicate.
+	onInvalidate chan *TagInvalidation
+	codecs       *codec.Registry
+	schemas      *schema.Registry
+	hooks        *hookChain
+	keys         *KeyPolicy
+	capacity     int
+	recency      *recency
+	clock        func() time.Time
+	// tags indexes the keys of the items carrying each tag.
+	tags tagIndex
+	// maxBytes is the memory budget and bytes the approximate size of the
+	// items held, as counted by CacheItem.size.
+	maxBytes int64
+	bytes    int64
+	// maxValueBytes limits each value as stored.
+	maxValueBytes int
+	// values holds the shared copies of values when SetDedup is on.
+	values *values
+	// janitorStop ends the janitor started by StartJanitor.
+	janitorStop chan struct{}
+	invariants  *invariants
+
+	// sequence counts every mutation applied to items on this node, local
+	// or replicated, and orders the entries handed to the journal.
+	sequence          uint64
+	journal           func(Mutation)
+	awaitDurable      func(sequence uint64)
+	mutationListeners []func(Mutation)
+	history           *history
+	loads             loads
+	namespaceReads    namespaceReads
+	// hotKeys counts reads per key when EnableHotKeys is on.
+	hotKeys *hotKeys
+	// quotas holds the quota of each namespace that has one and what the
+	// namespace holds here.
+	quotas map[string]*quotaUsage
+
+	listeners      []func(*CacheItem)
+	listenersMutex sync.RWMutex
 }
 
 type Stats struct {
-	TotalItems    int `json:"total_items"`
-	LocalItems    int `json:"local_items"`
-	RemoteItems   int `json:"remote_items"`
-	HitCount      int `json:"hit_count"`
-	MissCount     int `json:"miss_count"`
-	LastUpdated   time.Time `json:"last_updated"`
+	TotalItems  int `json:"total_items"`
+	LocalItems  int `json:"local_items"`
+	RemoteItems int `json:"remote_items"`
+	HitCount    int `json:"hit_count"`
+	MissCount   int `json:"miss_count"`
+	// EvictionCount counts items dropped to stay within capacity or the
+	// memory budget.
+	EvictionCount int `json:"eviction_count"`
+	// ExpiredCount counts expired items removed by the janitor.
+	ExpiredCount int `json:"expired_count"`
+	// MemoryBytes is the approximate size of the items held.
+	MemoryBytes int64 `json:"memory_bytes"`
+	// DedupValues is how many distinct values are stored for sharing and
+	// DedupSavedBytes the value bytes that sharing them saves; both are
+	// zero unless SetDedup is on.
+	DedupValues     int       `json:"dedup_values"`
+	DedupSavedBytes int64     `json:"dedup_saved_bytes"`
+	LastUpdated     time.Time `json:"last_updated"`
 }
 
 func NewManager(region, nodeID string) *Manager {
 	return &Manager{
-		region:   region,
-		nodeID:   nodeID,
-		items:    make(map[string]*CacheItem),
-		stats:    &Stats{LastUpdated: time.Now()},
-		onChange: make(chan *CacheItem, 100),
+		region:       region,
+		nodeID:       nodeID,
+		items:        make(map[string]*CacheItem),
+		stats:        &Stats{LastUpdated: time.Now()},
+		onPatch:      make(chan *PatchOp, 100),
+		onBatch:      make(chan []*CacheItem, 100),
+		onInvalidate: make(chan *TagInvalidation, 100),
+		tags:         make(tagIndex),
+		quotas:       make(map[string]*quotaUsage),
+		codecs:       codec.NewRegistry(),
+		schemas:      schema.NewRegistry(),
+		hooks:        &hookChain{},
+		keys:         &KeyPolicy{},
+		recency:      newRecency(),
+		clock:        time.Now,
 	}
 }
 
 func (m *Manager) Get(key string) (*CacheItem, bool) {
+	item, err := m.Lookup(key)
+	return item, err == nil
+}
+
+// Lookup is Get that says why a read missed: the key is invalid, was
+// never set (ErrNotFound) or has outlived its TTL (ErrExpired).
+func (m *Manager) Lookup(key string) (*CacheItem, error) {
+	return m.Read(context.Background(), key, ReadOptions{})
+}
+
+// Read returns the item stored under key, or an error saying why there
+// is none.
+func (m *Manager) Read(ctx context.Context, key string, options ReadOptions) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !options.AsOf.IsZero() {
+		return m.GetAt(key, options.AsOf)
+	}
+
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	item, now, err := m.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if item.MaxReads > 0 {
+		if item, err = m.consumeRead(key, now); err != nil {
+			return nil, err
+		}
+	}
+
+	transformed, err := m.hooks.afterGet(item)
+	if err != nil {
+		log.Printf("Dropping read of %s: %v", key, err)
+		return nil, &KeyError{Key: key, Err: ErrNotFound, Cause: err}
+	}
+	if item.Sliding {
+		m.renewOnRead(item, now)
+	}
+	m.checkServed(transformed, now)
+	return transformed, nil
+}
+
+// get returns the item stored under key and the time it was found live
+// at.
+func (m *Manager) get(key string) (*CacheItem, time.Time, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	item, exists := m.items[key]
 	if !exists {
 		m.stats.MissCount++
-		return nil, false
+		m.namespaceReads.count(key, false)
+		return nil, time.Time{}, &KeyError{Key: key, Err: ErrNotFound}
 	}
 
-	if item.TTL > 0 && time.Since(item.Timestamp).Seconds() > float64(item.TTL) {
-		delete(m.items, key)
+	// Expired items are left for the janitor: removing them here would
+	// modify the map under the read lock.
+	now := m.now()
+	if item.expiredAt(now) {
 		m.stats.MissCount++
-		return nil, false
+		m.namespaceReads.count(key, false)
+		return nil, time.Time{}, &KeyError{Key: key, Err: ErrExpired}
 	}
 
+	m.recency.touch(key)
 	m.stats.HitCount++
-	return item, true
+	m.namespaceReads.count(key, true)
+	if m.hotKeys != nil {
+		m.hotKeys.count(key, now)
+	}
+	return item, now, nil
 }
 
-func (m *Manager) Set(key, value string, ttl int64) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+func (m *Manager) Set(key, value string, ttl int64) error {
+	return m.SetEncoded(key, value, "", ttl)
+}
+
+func (m *Manager) SetEncoded(key, value, encoding string, ttl int64) error {
+	_, err := m.Write(context.Background(), key, value, WriteOptions{
+		TTL:      time.Duration(ttl) * time.Second,
+		Encoding: encoding,
+	})
+	return err
+}
+
+// Write stores value under key and returns the stored item. If ctx is
+// done while waiting for the journal, the write has been applied but may
+// not be durable yet.
+func (m *Manager) Write(ctx context.Context, key, value string, options WriteOptions) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.write(ctx, m.newItem(key, value, options), options)
+}
 
+// newItem builds the item a local write of value under key stores.
+func (m *Manager) newItem(key, value string, options WriteOptions) *CacheItem {
 	item := &CacheItem{
-		Key:       key,
-		Value:     value,
-		Region:    m.region,
-		NodeID:    m.nodeID,
-		Timestamp: time.Now(),
-		TTL:       ttl,
+		Key:      m.hooks.normalizeKey(key),
+		Value:    value,
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Encoding: options.Encoding,
+		Sliding:  options.Sliding,
+		MaxReads: options.MaxReads,
+		Tags:     options.Tags,
+	}
+	item.Metadata = cloneMetadata(options.Metadata)
+	return item
+}
+
+// cloneMetadata returns a copy of metadata, or nil if it is empty. Stored
+// items are never modified, so an item built from another's metadata
+// gets its own map.
+func cloneMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	clone := make(map[string]string, len(metadata))
+	for name, value := range metadata {
+		clone[name] = value
+	}
+	return clone
+}
+
+// write validates and stores item, which a local write has just built.
+func (m *Manager) write(ctx context.Context, item *CacheItem, options WriteOptions) (*CacheItem, error) {
+	if err := m.prepare(item); err != nil {
+		return nil, err
+	}
+	sequence, err := m.store(item, options)
+	if err != nil {
+		return nil, err
+	}
+	return item, m.settle(ctx, item, sequence, options)
+}
+
+// prepare runs the BeforeSet hooks on item, which a local write has just
+// built, and validates the result.
+func (m *Manager) prepare(item *CacheItem) error {
+	if err := m.keys.Validate(item.Key); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(item.Tags)
+	if err != nil {
+		return &KeyError{Key: item.Key, Err: ErrInvalidTag, Cause: err}
+	}
+	item.Tags = tags
+	if err := m.hooks.beforeSet(item); err != nil {
+		return err
+	}
+	if err := m.codecs.Validate(item.Value, item.Encoding); err != nil {
+		return err
+	}
+	if err := m.validateSchema(item.Key, item.Value, item.Encoding); err != nil {
+		return err
+	}
+	return m.checkSize(item)
+}
+
+// SetClock replaces the wall clock the manager stamps writes and expires
+// items with, so tests can move time forward instead of sleeping. It must
+// be called before the manager is used.
+func (m *Manager) SetClock(clock func() time.Time) {
+	m.clock = clock
+}
+
+func (m *Manager) now() time.Time {
+	return m.clock()
+}
+
+// SetKeyPolicy replaces the policy keys are validated against.
+func (m *Manager) SetKeyPolicy(policy *KeyPolicy) {
+	m.keys = policy
+}
+
+// AddHook registers a hook for every key starting with prefix; an empty
+// prefix matches all keys. Hooks run in registration order.
+func (m *Manager) AddHook(prefix string, hook Hook) {
+	m.hooks.add(prefix, hook)
+}
+
+// NormalizeKey returns key as the hooks rewrite it before it is stored.
+func (m *Manager) NormalizeKey(key string) string {
+	return m.hooks.normalizeKey(key)
+}
+
+func (m *Manager) validateSchema(key, value, encoding string) error {
+	if _, found := m.schemas.Match(key); !found {
+		return nil
+	}
+
+	document := value
+	if encoding != "" && encoding != codec.EncodingRaw && encoding != codec.EncodingJSON {
+		transcoded, err := m.codecs.Transcode(value, encoding, codec.EncodingJSON)
+		if err != nil {
+			return err
+		}
+		document = transcoded
 	}
+	return m.schemas.Validate(key, []byte(document))
+}
+
+// store saves a local write and returns its sequence number, or
+// ErrExists or ErrVersionMismatch if the conditions in options fail.
+// Versions travel with replicated items, so a version read on one node
+// can be checked on another once the write has reached it.
+func (m *Manager) store(item *CacheItem, options WriteOptions) (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-	m.items[key] = item
+	if err := m.checkConditions(item.Key, options); err != nil {
+		return 0, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, err
+	}
+	m.place(item, options)
 	m.updateStats()
 
+	if options.LocalOnly {
+		return m.sequence, nil
+	}
+	m.publish(item)
+	m.notifyListeners(item)
+	return m.sequence, nil
+}
+
+// checkConditions returns ErrExists or ErrVersionMismatch if the item
+// under key fails the conditions in options. The caller holds the write
+// lock.
+func (m *Manager) checkConditions(key string, options WriteOptions) error {
+	existing, exists := m.items[key]
+	if options.IfAbsent && exists && !existing.expiredAt(m.now()) {
+		return &KeyError{Key: key, Err: ErrExists}
+	}
+	if options.IfVersion != 0 {
+		if !exists || existing.expiredAt(m.now()) {
+			return &KeyError{Key: key, Err: ErrVersionMismatch, Cause: fmt.Errorf("%w: %s does not exist, expected version %d", ErrVersionMismatch, key, options.IfVersion)}
+		}
+		if existing.Version != options.IfVersion {
+			return &KeyError{Key: key, Err: ErrVersionMismatch, Cause: fmt.Errorf("%w: %s is at version %d, expected %d", ErrVersionMismatch, key, existing.Version, options.IfVersion)}
+		}
+	}
+	return nil
+}
+
+// place stamps and versions item as the successor of the item it replaces
+// and puts it in the store. The caller holds the write lock.
+func (m *Manager) place(item *CacheItem, options WriteOptions) {
+	existing, exists := m.items[item.Key]
+	item.Timestamp = m.stamp(existing)
+	if exists {
+		item.Version = existing.Version + 1
+	} else {
+		item.Version = 1
+	}
+	if options.TTLMode == TTLKeep && exists && !existing.expiredAt(item.Timestamp) {
+		item.TTL = existing.remainingTTL(item.Timestamp)
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+}
+
+// stamp returns the timestamp for a local write replacing existing, which
+// may be nil. A write must supersede the item it replaces on every node,
+// so if this node's clock is behind the existing item's (it was written
+// elsewhere by a node whose clock runs ahead), the write is stamped just
+// after it instead of with the local time.
+func (m *Manager) stamp(existing *CacheItem) time.Time {
+	now := m.now()
+	if existing != nil && !now.After(existing.Timestamp) {
+		return existing.Timestamp.Add(time.Nanosecond)
+	}
+	return now
+}
+
+// await waits for the change with the given sequence as consistency
+// requires, or until ctx is done.
+func (m *Manager) await(ctx context.Context, sequence uint64, consistency Consistency) error {
+	if consistency == ConsistencyMemory {
+		return nil
+	}
+	if ctx.Done() == nil {
+		m.durable(sequence)
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.durable(sequence)
+		close(done)
+	}()
 	select {
-	case m.onChange <- item:
-	default:
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// settle waits for a local write as its options require: for the journal,
+// then, unless it stays local, for the AfterSet hooks.
+func (m *Manager) settle(ctx context.Context, item *CacheItem, sequence uint64, options WriteOptions) error {
+	if err := m.await(ctx, sequence, options.Consistency); err != nil {
+		return err
 	}
+	if options.LocalOnly {
+		return nil
+	}
+	return m.hooks.afterSet(ctx, item)
+}
+
+// AddChangeListener registers a callback for every locally originated
+// write and delete, in the order they are made. A delete is passed as the
+// tombstone of the item deleted, for which Deleted reports true. Callbacks
+// run with the manager lock held and must not block or call back into the
+// manager.
+func (m *Manager) AddChangeListener(listener func(*CacheItem)) {
+	m.listenersMutex.Lock()
+	defer m.listenersMutex.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *Manager) notifyListeners(item *CacheItem) {
+	m.listenersMutex.RLock()
+	defer m.listenersMutex.RUnlock()
+
+	for _, listener := range m.listeners {
+		listener(item)
+	}
+}
+
+// ApplyMirrored stores an item written in another cluster, keeping its
+// origin timestamp, and replicates it to peers like a local write.
+func (m *Manager) ApplyMirrored(item *CacheItem) error {
+	if err := m.keys.Validate(item.Key); err != nil {
+		return err
+	}
+	if err := m.checkValueSize(item); err != nil {
+		return err
+	}
+	if err := m.hooks.acceptRemote(item); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[item.Key]
+	if exists && item.Type == TypeSortedSet && existing.Type == TypeSortedSet {
+		joined, err := m.joinSortedSet(existing, item)
+		if err != nil || joined == nil {
+			return err
+		}
+		item = joined
+	} else if exists && !item.supersedes(existing) {
+		return nil
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	m.publish(item)
+	return nil
 }
 
 func (m *Manager) Delete(key string) bool {
+	return m.Remove(context.Background(), key, WriteOptions{}) == nil
+}
+
+// Remove deletes key, returning ErrNotFound if there is nothing to
+// delete. Unless options.LocalOnly is set, change listeners are passed
+// the item's tombstone, which the peer manager replicates to peers as a
+// DEL. options.Consistency applies as it does to sets.
+func (m *Manager) Remove(ctx context.Context, key string, options WriteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key = m.hooks.normalizeKey(key)
+	sequence, deleted := m.delete(key, options)
+	if !deleted {
+		return &KeyError{Key: key, Err: ErrNotFound}
+	}
+	return m.await(ctx, sequence, options.Consistency)
+}
+
+func (m *Manager) delete(key string, options WriteOptions) (uint64, bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if _, exists := m.items[key]; exists {
-		delete(m.items, key)
+	if existing, exists := m.items[key]; exists {
+		m.remove(key)
+		m.recordMutation(MutationDelete, &CacheItem{Key: key})
 		m.updateStats()
-		return true
+		if !options.LocalOnly {
+			m.notifyListeners(existing.tombstone())
+		}
+		return m.sequence, true
 	}
-	return false
+	return 0, false
 }
 
-func (m *Manager) SetRemote(item *CacheItem) {
+// Release deletes item if it is still the stored version of its key, for
+// dropping keys this node has handed over to their owners without losing
+// a write that arrived meanwhile.
+func (m *Manager) Release(item *CacheItem) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.items[item.Key] != item {
+		return false
+	}
+	m.remove(item.Key)
+	m.recordMutation(MutationDelete, &CacheItem{Key: item.Key})
+	m.updateStats()
+	return true
+}
+
+// DeleteWhere deletes every item whose key starts with prefix and, if
+// match is set, that match accepts, and returns how many it deleted.
+// Unless options keep the deletes local, peers delete their copies of the
+// same writes too; writes they hold that this node doesn't are kept.
+func (m *Manager) DeleteWhere(ctx context.Context, prefix string, match func(*CacheItem) bool, options WriteOptions) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mutex.Lock()
+	var deleted []*CacheItem
+	for key, item := range m.items {
+		if strings.HasPrefix(key, prefix) && (match == nil || match(item)) {
+			deleted = append(deleted, item)
+		}
+	}
+	for _, item := range deleted {
+		m.remove(item.Key)
+		m.recordMutation(MutationDelete, &CacheItem{Key: item.Key})
+		if !options.LocalOnly {
+			m.notifyListeners(item.tombstone())
+		}
+	}
+	m.updateStats()
+	sequence := m.sequence
+	m.mutex.Unlock()
+
+	// Deletes are published one by one and may wait for subscribers,
+	// such as the replication sender, so they go out after the lock is
+	// released.
+	if !options.LocalOnly {
+		for _, item := range deleted {
+			if err := m.publishWait(ctx, item.tombstone()); err != nil {
+				return len(deleted), err
+			}
+		}
+	}
+	return len(deleted), m.await(ctx, sequence, options.Consistency)
+}
+
+// SetRemote stores an item replicated from a peer if it is newer than the
+// local copy, and reports whether it was stored.
+func (m *Manager) SetRemote(item *CacheItem) (bool, error) {
+	if err := m.keys.Validate(item.Key); err != nil {
+		return false, err
+	}
+	if err := m.checkValueSize(item); err != nil {
+		return false, err
+	}
+	if err := m.hooks.acceptRemote(item); err != nil {
+		return false, err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	existing, exists := m.items[item.Key]
-	if !exists || item.Timestamp.After(existing.Timestamp) {
-		m.items[item.Key] = item
-		m.updateStats()
+	if exists && item.Type == TypeSortedSet && existing.Type == TypeSortedSet {
+		return m.putJoined(existing, item)
 	}
+	if exists && !item.supersedes(existing) {
+		if item.sameWrite(existing) && item.renewedAt().After(existing.renewedAt()) {
+			// The same write, touched later on another node.
+			m.renew(existing, item.renewedAt(), false)
+			return true, nil
+		}
+		return false, nil
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+	return true, nil
 }
 
 func (m *Manager) GetStats() *Stats {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
 	statsCopy := *m.stats
 	return &statsCopy
 }
@@ -120,24 +694,125 @@ func (m *Manager) GetAllItems() []*CacheItem {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	now := m.now()
 	items := make([]*CacheItem, 0, len(m.items))
 	for _, item := range m.items {
-		if item.TTL == 0 || time.Since(item.Timestamp).Seconds() <= float64(item.TTL) {
+		if !item.expiredAt(now) {
 			items = append(items, item)
 		}
 	}
 	return items
 }
 
-func (m *Manager) GetChangeChannel() <-chan *CacheItem {
-	return m.onChange
+// View is a point-in-time view of the cache: the live items, stats and
+// sequence number as of At, with no write applied part-way through.
+type View struct {
+	Items    []*CacheItem
+	Stats    Stats
+	Sequence uint64
+	At       time.Time
+}
+
+// View takes a consistent view of the cache. Because stored items are
+// never modified, it only copies item pointers while holding the lock;
+// writes are blocked for that long and no longer. The items are shared
+// with the cache and must not be modified.
+func (m *Manager) View() *View {
+	m.mutex.RLock()
+	view := &View{
+		Items:    make([]*CacheItem, 0, len(m.items)),
+		Stats:    *m.stats,
+		Sequence: m.sequence,
+		At:       m.now(),
+	}
+	for _, item := range m.items {
+		view.Items = append(view.Items, item)
+	}
+	m.mutex.RUnlock()
+
+	live := view.Items[:0]
+	for _, item := range view.Items {
+		if !item.expiredAt(view.At) {
+			live = append(live, item)
+		}
+	}
+	view.Items = live
+	return view
+}
+
+// Checkpoint returns a copy of every live item together with the sequence
+// number it corresponds to, taken atomically with respect to writes.
+func (m *Manager) Checkpoint() ([]*CacheItem, uint64) {
+	view := m.View()
+
+	items := make([]*CacheItem, len(view.Items))
+	for i, item := range view.Items {
+		itemCopy := *item
+		items[i] = &itemCopy
+	}
+	return items, view.Sequence
+}
+
+// Restore replaces the whole cache with items. Restored items are not
+// replicated; every node is expected to restore its own checkpoint.
+func (m *Manager) Restore(items []*CacheItem) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.items = make(map[string]*CacheItem, len(items))
+	m.tags = make(tagIndex)
+	m.quotas = make(map[string]*quotaUsage)
+	m.bytes = 0
+	if m.values != nil {
+		m.values = newValues()
+	}
+	m.recency.reset()
+	m.recordMutation(MutationReset, nil)
+	for _, item := range items {
+		m.put(item)
+		m.recordMutation(MutationSet, item)
+	}
+	m.updateStats()
+}
+
+func (m *Manager) NodeID() string {
+	return m.nodeID
+}
+
+func (m *Manager) Region() string {
+	return m.region
+}
+
+func (m *Manager) Sequence() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.sequence
+}
+
+func (m *Manager) Codecs() *codec.Registry {
+	return m.codecs
+}
+
+func (m *Manager) Schemas() *schema.Registry {
+	return m.schemas
+}
+
+// GetBatchChannel delivers the items of each local WriteBatch together.
+func (m *Manager) GetBatchChannel() <-chan []*CacheItem {
+	return m.onBatch
 }
 
 func (m *Manager) updateStats() {
 	m.stats.TotalItems = len(m.items)
+	m.stats.MemoryBytes = m.bytes
+	m.stats.DedupValues, m.stats.DedupSavedBytes = 0, 0
+	if m.values != nil {
+		m.stats.DedupValues = len(m.values.entries)
+		m.stats.DedupSavedBytes = m.values.saved
+	}
 	m.stats.LocalItems = 0
 	m.stats.RemoteItems = 0
-	
+
 	for _, item := range m.items {
 		if item.NodeID == m.nodeID {
 			m.stats.LocalItems++
@@ -145,8 +820,8 @@ func (m *Manager) updateStats() {
 			m.stats.RemoteItems++
 		}
 	}
-	
-	m.stats.LastUpdated = time.Now()
+
+	m.stats.LastUpdated = m.now()
 }
 
 func (m *Manager) SerializeItem(item *CacheItem) ([]byte, error) {
@@ -0,0 +1,83 @@
+package cache
+
+import "time"
+
+// Items written with WriteOptions.MaxReads serve that many reads and are
+// deleted by the last, for one-time tokens and limited-use download
+// links. Reads are counted by the node that serves them, so a limit of
+// more than one read is exact only when reads go to one node, such as the
+// key's owner. The delete is replicated: it goes out on the change
+// channel, after the write it deletes, and peers drop their copy of the
+// same write, while a newer write of the key made elsewhere survives.
+// Until the delete reaches them, peers can still serve their copy.
+
+// consumeRead counts a read of the limited-use item under key, found live
+// at now, and returns the item as read. The read that uses up the item
+// deletes it.
+func (m *Manager) consumeRead(key string, now time.Time) (*CacheItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists {
+		return nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	if existing.expiredAt(now) {
+		return nil, &KeyError{Key: key, Err: ErrExpired}
+	}
+
+	item := *existing
+	item.Reads++
+	if item.MaxReads <= 0 || item.Reads < item.MaxReads {
+		m.put(&item)
+		m.recordMutation(MutationSet, &item)
+		return &item, nil
+	}
+
+	m.remove(key)
+	m.recordMutation(MutationDelete, &CacheItem{Key: key})
+	m.updateStats()
+	tombstone := existing.tombstone()
+	m.publish(tombstone)
+	m.notifyListeners(tombstone)
+	return &item, nil
+}
+
+// tombstone returns the change that replicates the delete of item.
+func (item *CacheItem) tombstone() *CacheItem {
+	return &CacheItem{
+		Key:       item.Key,
+		Region:    item.Region,
+		NodeID:    item.NodeID,
+		Timestamp: item.Timestamp,
+		Version:   item.Version,
+		deleted:   true,
+	}
+}
+
+// Deleted reports whether item, received from a subscription, stands
+// for the delete of the write it names rather than for a write.
+func (item *CacheItem) Deleted() bool {
+	return item.deleted
+}
+
+// RemoveRemote applies a delete replicated by a peer, which names the
+// write it deleted. It deletes key only if the stored item is a copy of
+// that write, and reports whether it did.
+func (m *Manager) RemoveRemote(deleted *CacheItem) (bool, error) {
+	if err := m.keys.Validate(deleted.Key); err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[deleted.Key]
+	if !exists || !existing.sameWrite(deleted) {
+		return false, nil
+	}
+	m.remove(deleted.Key)
+	m.recordMutation(MutationDelete, &CacheItem{Key: deleted.Key})
+	m.updateStats()
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// NamespaceSeparator joins a namespace and a key into the key stored.
+const NamespaceSeparator = "::"
+
+// maxNamespaceLength bounds namespace names.
+const maxNamespaceLength = 64
+
+// Namespaces let applications sharing a node use the same keys without
+// colliding: a key written in a namespace is stored as
+// <namespace>::<key>, so everything configured by key prefix (schemas,
+// hooks, replication and federation prefixes) can be set per namespace
+// with the prefix <namespace>::. Keys written without a namespace belong
+// to none, and their API sees every key.
+
+// ValidateNamespace checks that ns can name a namespace: letters, digits,
+// '-', '_' and '.', at most 64 of them.
+func ValidateNamespace(ns string) error {
+	if ns == "" || len(ns) > maxNamespaceLength {
+		return fmt.Errorf("%w: namespace must be 1 to %d characters", ErrInvalidKey, maxNamespaceLength)
+	}
+	for _, r := range ns {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("%w: namespace contains %q", ErrInvalidKey, r)
+		}
+	}
+	return nil
+}
+
+// NamespaceKey is the key key is stored under in namespace ns.
+func NamespaceKey(ns, key string) string {
+	return ns + NamespaceSeparator + key
+}
+
+// SplitNamespace returns the namespace a stored key belongs to, "" if
+// none, and the key within it.
+func SplitNamespace(key string) (string, string) {
+	ns, name, found := strings.Cut(key, NamespaceSeparator)
+	if !found || ValidateNamespace(ns) != nil {
+		return "", key
+	}
+	return ns, name
+}
+
+// NamespaceStats describes the items of one namespace held here and the
+// reads of its keys this node has served.
+type NamespaceStats struct {
+	Namespace   string `json:"namespace"`
+	Items       int    `json:"items"`
+	MemoryBytes int64  `json:"memory_bytes"`
+	HitCount    uint64 `json:"hit_count"`
+	MissCount   uint64 `json:"miss_count"`
+	// Quota is the namespace's quota, if it has one.
+	Quota *NamespaceQuota `json:"quota,omitempty"`
+}
+
+// namespaceReads counts hits and misses by namespace.
+type namespaceReads struct {
+	counts sync.Map // namespace -> *readCounts
+}
+
+type readCounts struct {
+	hits   uint64
+	misses uint64
+}
+
+func (n *namespaceReads) count(key string, hit bool) {
+	ns, _ := SplitNamespace(key)
+	if ns == "" {
+		return
+	}
+	value, _ := n.counts.Load(ns)
+	if value == nil {
+		value, _ = n.counts.LoadOrStore(ns, &readCounts{})
+	}
+	counts := value.(*readCounts)
+	if hit {
+		atomic.AddUint64(&counts.hits, 1)
+	} else {
+		atomic.AddUint64(&counts.misses, 1)
+	}
+}
+
+func (n *namespaceReads) get(ns string) (uint64, uint64) {
+	value, _ := n.counts.Load(ns)
+	if value == nil {
+		return 0, 0
+	}
+	counts := value.(*readCounts)
+	return atomic.LoadUint64(&counts.hits), atomic.LoadUint64(&counts.misses)
+}
+
+// Namespaces returns the stats of every namespace with live items here or
+// reads counted, ordered by name.
+func (m *Manager) Namespaces() []NamespaceStats {
+	m.mutex.RLock()
+	byName := make(map[string]*NamespaceStats)
+	now := m.now()
+	for key, item := range m.items {
+		ns, _ := SplitNamespace(key)
+		if ns == "" || item.expiredAt(now) {
+			continue
+		}
+		stats := byName[ns]
+		if stats == nil {
+			stats = &NamespaceStats{Namespace: ns}
+			byName[ns] = stats
+		}
+		stats.Items++
+		stats.MemoryBytes += item.size()
+	}
+	for ns, usage := range m.quotas {
+		if byName[ns] == nil {
+			byName[ns] = &NamespaceStats{Namespace: ns}
+		}
+		quota := usage.quota
+		byName[ns].Quota = &quota
+	}
+	m.mutex.RUnlock()
+
+	m.namespaceReads.counts.Range(func(name, _ interface{}) bool {
+		if ns := name.(string); byName[ns] == nil {
+			byName[ns] = &NamespaceStats{Namespace: ns}
+		}
+		return true
+	})
+
+	namespaces := make([]NamespaceStats, 0, len(byName))
+	for ns, stats := range byName {
+		stats.HitCount, stats.MissCount = m.namespaceReads.get(ns)
+		namespaces = append(namespaces, *stats)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+	return namespaces
+}
+
+// NamespaceStats returns the stats of namespace ns.
+func (m *Manager) NamespaceStats(ns string) NamespaceStats {
+	prefix := NamespaceKey(ns, "")
+	stats := NamespaceStats{Namespace: ns}
+
+	m.mutex.RLock()
+	now := m.now()
+	for key, item := range m.items {
+		if strings.HasPrefix(key, prefix) && !item.expiredAt(now) {
+			stats.Items++
+			stats.MemoryBytes += item.size()
+		}
+	}
+	if usage := m.quotas[ns]; usage != nil {
+		quota := usage.quota
+		stats.Quota = &quota
+	}
+	m.mutex.RUnlock()
+
+	stats.HitCount, stats.MissCount = m.namespaceReads.get(ns)
+	return stats
+}
+
+// FlushNamespace deletes every key of namespace ns and returns how many
+// it deleted. Unless options keep the flush local, peers delete their
+// copies of the same writes too; writes they hold that this node doesn't
+// are kept.
+func (m *Manager) FlushNamespace(ctx context.Context, ns string, options WriteOptions) (int, error) {
+	return m.DeleteWhere(ctx, NamespaceKey(ns, ""), nil, options)
+}
+
+// DropNamespace is FlushNamespace that deletes the namespace's quota too,
+// as a sandbox made by CloneNamespace is torn down.
+func (m *Manager) DropNamespace(ctx context.Context, ns string, options WriteOptions) (int, error) {
+	deleted, err := m.FlushNamespace(ctx, ns, options)
+	if err != nil {
+		return deleted, err
+	}
+	key := QuotaKey(ns)
+	_, err = m.DeleteWhere(ctx, key, func(item *CacheItem) bool {
+		return item.Key == key
+	}, options)
+	return deleted, err
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// TTLMode says where a write takes the item's TTL from.
+type TTLMode int
+
+const (
+	// TTLSet uses WriteOptions.TTL; zero means the item never expires.
+	TTLSet TTLMode = iota
+	// TTLKeep keeps the remaining lifetime of the item being replaced, and
+	// uses WriteOptions.TTL only when there is no live item.
+	TTLKeep
+)
+
+// Consistency says when a local write or delete returns.
+type Consistency int
+
+const (
+	// ConsistencyDurable returns once the change is in the journal, when
+	// there is one.
+	ConsistencyDurable Consistency = iota
+	// ConsistencyMemory returns as soon as the change is applied in
+	// memory. A crash before the next journal sync loses it.
+	ConsistencyMemory
+)
+
+// ParseConsistency parses a consistency name as used in requests; an
+// empty name is the default.
+func ParseConsistency(name string) (Consistency, error) {
+	switch name {
+	case "", "durable":
+		return ConsistencyDurable, nil
+	case "memory":
+		return ConsistencyMemory, nil
+	default:
+		return 0, fmt.Errorf("unknown consistency %q, expected durable or memory", name)
+	}
+}
+
+// WriteOptions are the optional parts of a write. The zero value is a
+// replicated raw value without a TTL that returns once it is durable, so
+// new options must keep their zero value meaning "as before".
+type WriteOptions struct {
+	TTL      time.Duration
+	TTLMode  TTLMode
+	Encoding string
+	// Sliding makes the TTL restart whenever the item is read.
+	Sliding bool
+	// Metadata is copied onto the item; hooks may add to it.
+	Metadata map[string]string
+	// LocalOnly keeps the write on this node: it is neither replicated to
+	// peers nor mirrored to other clusters.
+	LocalOnly   bool
+	Consistency Consistency
+	// MaxReads, when positive, deletes the item on every node once it has
+	// been read that many times.
+	MaxReads int64
+	// IfVersion, when not zero, makes the write a compare-and-swap: it
+	// fails with ErrVersionMismatch unless the live item under the key is
+	// at that version.
+	IfVersion uint64
+	// IfAbsent makes the write fail with ErrExists when a live item is
+	// stored under the key.
+	IfAbsent bool
+	// Tags are copied onto the item, which InvalidateTag of any of them
+	// deletes.
+	Tags []string
+}
+
+// ReadOptions are the optional parts of a read.
+type ReadOptions struct {
+	// AsOf reads the version that was current at that time from the item
+	// history instead of the current one.
+	AsOf time.Time
+}
+
+// ttlSeconds converts a TTL to the whole seconds CacheItem stores,
+// rounding up so that a short positive TTL never means "no expiry".
+func ttlSeconds(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return int64((ttl + time.Second - 1) / time.Second)
+}
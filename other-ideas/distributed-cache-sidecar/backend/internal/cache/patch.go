@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/patch"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPatchNotFound is ErrNotFound, kept for callers written before it.
+	ErrPatchNotFound    = ErrNotFound
+	ErrPatchUnsupported = errors.New("value encoding does not support patching")
+)
+
+// PatchOp is a partial update replicated to peers as an operation rather
+// than as the resulting item, so concurrent patches touching different
+// fields on different nodes merge instead of overwriting each other. Type
+// is the patch format; ItemType, Encoding and the fields after them are
+// the patched item's, which a receiver without the base needs to store the
+// result as the origin did. BaseNodeID and BaseTimestamp identify the write the patch was applied
+// to, so a receiver can tell whether it holds the same base.
+type PatchOp struct {
+	Key       string            `json:"key"`
+	Type      string            `json:"type"`
+	Patch     json.RawMessage   `json:"patch"`
+	Result    string            `json:"result"`
+	Version   uint64            `json:"version"`
+	Region    string            `json:"region"`
+	NodeID    string            `json:"node_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	ItemType  string            `json:"item_type,omitempty"`
+	Encoding  string            `json:"encoding,omitempty"`
+	TTL       int64             `json:"ttl,omitempty"`
+	Sliding   bool              `json:"sliding,omitempty"`
+	MaxReads  int64             `json:"max_reads,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+
+	BaseNodeID    string    `json:"base_node_id,omitempty"`
+	BaseTimestamp time.Time `json:"base_timestamp,omitempty"`
+}
+
+func (m *Manager) Patch(key, patchType string, patchDoc []byte) (*CacheItem, error) {
+	item, sequence, err := m.patch(key, patchType, patchDoc)
+	if err != nil {
+		return nil, err
+	}
+	m.durable(sequence)
+	return item, nil
+}
+
+func (m *Manager) patch(key, patchType string, patchDoc []byte) (*CacheItem, uint64, error) {
+	key = m.hooks.normalizeKey(key)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists {
+		return nil, 0, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	if existing.expiredAt(m.now()) {
+		return nil, 0, &KeyError{Key: key, Err: ErrExpired}
+	}
+	if existing.Type != "" {
+		return nil, 0, &KeyError{Key: key, Err: ErrWrongType}
+	}
+	if existing.Encoding != "" && existing.Encoding != codec.EncodingRaw && existing.Encoding != codec.EncodingJSON {
+		return nil, 0, ErrPatchUnsupported
+	}
+
+	patched, err := patch.Apply(patchType, []byte(existing.Value), patchDoc)
+	if errors.Is(err, patch.ErrTestFailed) {
+		return nil, 0, &KeyError{Key: key, Err: ErrConflict, Cause: err}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	item, err := m.putPatched(existing, patchType, patchDoc, patched, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return item, m.sequence, nil
+}
+
+// putPatched stores patched, the result of applying patchDoc to existing,
+// and queues the patch for replication unless localOnly is set. The
+// caller holds the write lock.
+func (m *Manager) putPatched(existing *CacheItem, patchType string, patchDoc, patched []byte, localOnly bool) (*CacheItem, error) {
+	item := &CacheItem{
+		Key:      existing.Key,
+		Value:    string(patched),
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      existing.TTL,
+		Sliding:  existing.Sliding,
+		Encoding: existing.Encoding,
+		Metadata: cloneMetadata(existing.Metadata),
+		Type:     existing.Type,
+		MaxReads: existing.MaxReads,
+		Tags:     existing.Tags,
+	}
+	if err := m.hooks.beforeSet(item); err != nil {
+		return nil, err
+	}
+	if item.Type == "" {
+		if err := m.validateSchema(item.Key, item.Value, item.Encoding); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.checkSize(item); err != nil {
+		return nil, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return nil, err
+	}
+
+	item.Timestamp = m.stamp(existing)
+	item.Version = existing.Version + 1
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+	if localOnly {
+		return item, nil
+	}
+
+	op := &PatchOp{
+		Key:       item.Key,
+		Type:      patchType,
+		Patch:     append(json.RawMessage(nil), patchDoc...),
+		Result:    item.Value,
+		Version:   item.Version,
+		Region:    item.Region,
+		NodeID:    item.NodeID,
+		Timestamp: item.Timestamp,
+		ItemType:  item.Type,
+		Encoding:  item.Encoding,
+		TTL:       item.TTL,
+		Sliding:   item.Sliding,
+		MaxReads:  item.MaxReads,
+		Metadata:  cloneMetadata(item.Metadata),
+		Tags:      item.Tags,
+
+		BaseNodeID:    existing.NodeID,
+		BaseTimestamp: existing.Timestamp,
+	}
+	select {
+	case m.onPatch <- op:
+	default:
+	}
+	m.notifyListeners(item)
+	return item, nil
+}
+
+// ApplyRemotePatch applies a peer's patch to the local copy of the item.
+// When the local copy is the one the patch was applied to, or there is no
+// local copy, the origin's result is stored as is. When the patch raced
+// another write that it supersedes, it is rebased: applied to the local
+// copy, which already holds the other write, and the merged item is
+// stamped after both and replicated like a local write, so every node
+// ends up with it. A patch superseded by the local copy is ignored, as
+// its origin rebases the local write onto it in turn. It reports false
+// without applying anything when the patch is ignored or the local copy
+// already is its result, which happens when the same patch arrives over
+// more than one path.
+func (m *Manager) ApplyRemotePatch(op *PatchOp) (bool, error) {
+	if err := m.keys.Validate(op.Key); err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[op.Key]
+	if !exists || existing.expiredAt(m.now()) {
+		return m.putPatchResult(op)
+	}
+	if existing.NodeID == op.NodeID && existing.Timestamp.Equal(op.Timestamp) {
+		return false, nil
+	}
+
+	if op.ItemType == TypeSortedSet && existing.Type == TypeSortedSet {
+		joined, err := joinScores(existing.Value, string(op.Patch))
+		if err != nil {
+			return false, fmt.Errorf("failed to apply remote patch to %s: %w", op.Key, err)
+		}
+		item := *existing
+		item.Value = joined
+		if origin := (&CacheItem{NodeID: op.NodeID, Timestamp: op.Timestamp}); origin.supersedes(&item) {
+			item.Timestamp = op.Timestamp
+			item.Region = op.Region
+			item.NodeID = op.NodeID
+		}
+		if op.Version > item.Version {
+			item.Version = op.Version
+		}
+		if err := m.hooks.acceptRemote(&item); err != nil {
+			return false, err
+		}
+		m.put(&item)
+		m.recordMutation(MutationSet, &item)
+		m.updateStats()
+		return true, nil
+	}
+
+	origin := &CacheItem{NodeID: op.NodeID, Timestamp: op.Timestamp}
+	if !origin.supersedes(existing) {
+		return false, nil
+	}
+	if existing.NodeID == op.BaseNodeID && existing.Timestamp.Equal(op.BaseTimestamp) {
+		return m.putPatchResult(op)
+	}
+	return m.rebasePatch(existing, op)
+}
+
+// putPatchResult stores the item op produced on its origin. The caller
+// holds the write lock.
+func (m *Manager) putPatchResult(op *PatchOp) (bool, error) {
+	item := &CacheItem{
+		Key:       op.Key,
+		Value:     op.Result,
+		Region:    op.Region,
+		NodeID:    op.NodeID,
+		Timestamp: op.Timestamp,
+		Version:   op.Version,
+		Encoding:  op.Encoding,
+		Type:      op.ItemType,
+		TTL:       op.TTL,
+		Sliding:   op.Sliding,
+		MaxReads:  op.MaxReads,
+		Metadata:  cloneMetadata(op.Metadata),
+		Tags:      append([]string(nil), op.Tags...),
+	}
+	if err := m.hooks.acceptRemote(item); err != nil {
+		return false, err
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+	return true, nil
+}
+
+// rebasePatch applies op to existing, a write op raced and supersedes,
+// and replicates the merged item. If op doesn't apply to existing, op's
+// result replaces it as any newer write would. The caller holds the
+// write lock.
+func (m *Manager) rebasePatch(existing *CacheItem, op *PatchOp) (bool, error) {
+	patched, err := patch.Apply(op.Type, []byte(existing.Value), op.Patch)
+	if err != nil {
+		return m.putPatchResult(op)
+	}
+
+	item := *existing
+	item.Value = string(patched)
+	item.Region = m.region
+	item.NodeID = m.nodeID
+	item.Timestamp = m.stamp(&CacheItem{Timestamp: op.Timestamp})
+	item.Version = existing.Version
+	if op.Version > item.Version {
+		item.Version = op.Version
+	}
+	item.Version++
+	if err := m.hooks.acceptRemote(&item); err != nil {
+		return false, err
+	}
+	m.put(&item)
+	m.recordMutation(MutationSet, &item)
+	m.updateStats()
+
+	m.publish(&item)
+	m.notifyListeners(&item)
+	return true, nil
+}
+
+func (m *Manager) GetPatchChannel() <-chan *PatchOp {
+	return m.onPatch
+}
+
+func (m *Manager) SerializePatch(op *PatchOp) ([]byte, error) {
+	return json.Marshal(op)
+}
+
+func (m *Manager) DeserializePatch(data []byte) (*PatchOp, error) {
+	var op PatchOp
+	err := json.Unmarshal(data, &op)
+	return &op, err
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// patchPair writes value under key on a fresh node-a with options, patches
+// it there with patchDoc and returns both nodes with the replicated op.
+func patchPair(t *testing.T, key, value string, options WriteOptions, patchDoc string) (*Manager, *Manager, *PatchOp) {
+	t.Helper()
+	origin, peer := NewManager("test", "node-a"), NewManager("test", "node-b")
+	if _, err := origin.Write(context.Background(), key, value, options); err != nil {
+		t.Fatalf("write %s: %v", key, err)
+	}
+	if _, err := origin.Patch(key, "merge", []byte(patchDoc)); err != nil {
+		t.Fatalf("patch %s: %v", key, err)
+	}
+	select {
+	case op := <-origin.GetPatchChannel():
+		return origin, peer, op
+	default:
+		t.Fatalf("patch of %s was not queued for replication", key)
+		return nil, nil, nil
+	}
+}
+
+func TestRemotePatchKeepsItemFields(t *testing.T) {
+	options := WriteOptions{
+		TTL:      time.Minute,
+		Sliding:  true,
+		MaxReads: 3,
+		Metadata: map[string]string{"owner": "pricing"},
+		Tags:     []string{"sheet"},
+	}
+	origin, peer, op := patchPair(t, "quote", `{"a":1}`, options, `{"b":2}`)
+	if applied, err := peer.ApplyRemotePatch(op); err != nil || !applied {
+		t.Fatalf("ApplyRemotePatch = %v, %v; want applied", applied, err)
+	}
+
+	want, _ := origin.Get("quote")
+	got, ok := peer.Get("quote")
+	if !ok {
+		t.Fatal("patched item missing on peer")
+	}
+	tests := []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"Value", got.Value, want.Value},
+		{"TTL", got.TTL, want.TTL},
+		{"Sliding", got.Sliding, want.Sliding},
+		{"MaxReads", got.MaxReads, int64(3)},
+		{"Metadata[owner]", got.Metadata["owner"], "pricing"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("peer %s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+	if got.ExpiresAt().IsZero() {
+		t.Error("patched item never expires on peer")
+	}
+}
+
+func TestPatchKeepsTags(t *testing.T) {
+	origin, peer, op := patchPair(t, "quote", `{"a":1}`, WriteOptions{Tags: []string{"sheet"}}, `{"b":2}`)
+	if _, err := peer.ApplyRemotePatch(op); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*Manager{origin, peer} {
+		deleted, err := m.InvalidateTag(context.Background(), "sheet", WriteOptions{LocalOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 1 {
+			t.Errorf("%s: InvalidateTag deleted %d items, want 1", m.NodeID(), deleted)
+		}
+		if _, ok := m.Get("quote"); ok {
+			t.Errorf("%s: patched item survived invalidation of its tag", m.NodeID())
+		}
+	}
+}
+
+func TestPatchLeavesStoredMetadataAlone(t *testing.T) {
+	m := NewManager("test", "node-a")
+	hook, err := NewHook("metadata", map[string]string{"team": "pricing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddHook("", hook)
+
+	options := WriteOptions{Metadata: map[string]string{"owner": "sheet"}}
+	if _, err := m.Write(context.Background(), "quote", `{"a":1}`, options); err != nil {
+		t.Fatal(err)
+	}
+	if options.Metadata["team"] != "" {
+		t.Errorf("hook wrote into the caller's metadata: %v", options.Metadata)
+	}
+	before, _ := m.Get("quote")
+	patched, err := m.Patch("quote", "merge", []byte(`{"b":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched.Metadata["owner"] = "changed"
+	if before.Metadata["owner"] != "sheet" {
+		t.Errorf("patched item shares the stored item's metadata: %v", before.Metadata)
+	}
+}
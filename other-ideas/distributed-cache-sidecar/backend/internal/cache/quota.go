@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A namespace can be given a quota: a limit on the items and bytes it
+// holds and a policy for the TTLs of its items. Quotas are items
+// themselves, one JSON NamespaceQuota per namespace in QuotaNamespace, so
+// they replicate and persist like any other item, and every node enforces
+// the quotas it holds on the writes made to it. Each node counts what the
+// namespaces with a quota hold as items are put and removed.
+//
+// A quota with ExpiresAt time-boxes its namespace: writes to it are
+// refused once it expires. Neither the quota nor the namespace's items
+// expire with it; they stay until the namespace is torn down with
+// DropNamespace, so whoever tears expired namespaces down can still find
+// them and what they held.
+//
+// CloneNamespace builds on quotas to seed a disposable namespace, such as
+// one workshop's sandbox, from a golden one.
+
+// QuotaNamespace is the namespace quotas are stored in, keyed by the
+// namespace they apply to.
+const QuotaNamespace = "_quota"
+
+// ErrQuotaExceeded fails a write that would take a namespace beyond its
+// quota, or that is made to a namespace whose lifetime is over.
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// NamespaceQuota limits a namespace. Zero limits are unlimited. Items
+// written without a TTL get DefaultTTL, and none may have a TTL beyond
+// MaxTTL, both in seconds. No writes are accepted after ExpiresAt.
+type NamespaceQuota struct {
+	Namespace  string     `json:"namespace"`
+	Source     string     `json:"source,omitempty"`
+	MaxItems   int        `json:"max_items,omitempty"`
+	MaxBytes   int64      `json:"max_bytes,omitempty"`
+	DefaultTTL int64      `json:"default_ttl,omitempty"`
+	MaxTTL     int64      `json:"max_ttl,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// QuotaKey is the key the quota of namespace ns is stored under.
+func QuotaKey(ns string) string {
+	return NamespaceKey(QuotaNamespace, ns)
+}
+
+// quotaUsage is a namespace's quota and what the namespace holds here.
+type quotaUsage struct {
+	quota NamespaceQuota
+	items int
+	bytes int64
+}
+
+// chargeQuota counts item, just put, against its namespace's quota, or
+// installs the quota it is. The caller holds the write lock.
+func (m *Manager) chargeQuota(item *CacheItem) {
+	ns, name := SplitNamespace(item.Key)
+	if ns == QuotaNamespace {
+		m.installQuota(name, item)
+		return
+	}
+	if usage := m.quotas[ns]; usage != nil {
+		usage.items++
+		usage.bytes += item.size()
+	}
+}
+
+// dischargeQuota is chargeQuota undone for an item leaving the store, and
+// drops the quota if the item is one.
+func (m *Manager) dischargeQuota(item *CacheItem, removed bool) {
+	ns, name := SplitNamespace(item.Key)
+	if ns == QuotaNamespace {
+		if removed {
+			delete(m.quotas, name)
+		}
+		return
+	}
+	if usage := m.quotas[ns]; usage != nil {
+		usage.items--
+		usage.bytes -= item.size()
+	}
+}
+
+// installQuota sets the quota of namespace ns to the one stored in item,
+// counting what the namespace already holds if it had none. Items that
+// aren't a valid quota leave the namespace without one.
+func (m *Manager) installQuota(ns string, item *CacheItem) {
+	var quota NamespaceQuota
+	if err := json.Unmarshal([]byte(item.Value), &quota); err != nil || ValidateNamespace(ns) != nil {
+		delete(m.quotas, ns)
+		return
+	}
+	quota.Namespace = ns
+	if usage := m.quotas[ns]; usage != nil {
+		usage.quota = quota
+		return
+	}
+
+	usage := &quotaUsage{quota: quota}
+	prefix := NamespaceKey(ns, "")
+	for key, held := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			usage.items++
+			usage.bytes += held.size()
+		}
+	}
+	m.quotas[ns] = usage
+}
+
+// checkQuota applies the TTL policy of item's namespace to item and
+// rejects it if storing it would exceed the namespace's quota. The caller
+// holds the write lock.
+func (m *Manager) checkQuota(item *CacheItem) error {
+	ns, _ := SplitNamespace(item.Key)
+	usage := m.quotas[ns]
+	if usage == nil {
+		return nil
+	}
+	if err := limitTTL(item, usage.quota, m.now()); err != nil {
+		return err
+	}
+
+	items, bytes := usage.items+1, usage.bytes+item.size()
+	if existing, exists := m.items[item.Key]; exists {
+		items--
+		bytes -= existing.size()
+	}
+	return usage.quota.check(item.Key, items, bytes)
+}
+
+// check rejects a namespace holding items and bytes beyond the quota.
+func (quota NamespaceQuota) check(key string, items int, bytes int64) error {
+	if quota.MaxItems > 0 && items > quota.MaxItems {
+		return &KeyError{Key: key, Err: ErrQuotaExceeded, Cause: fmt.Errorf("%w: namespace %s may hold %d items", ErrQuotaExceeded, quota.Namespace, quota.MaxItems)}
+	}
+	if quota.MaxBytes > 0 && bytes > quota.MaxBytes {
+		return &KeyError{Key: key, Err: ErrQuotaExceeded, Cause: fmt.Errorf("%w: namespace %s may hold about %d bytes", ErrQuotaExceeded, quota.Namespace, quota.MaxBytes)}
+	}
+	return nil
+}
+
+// limitTTL gives item the TTL quota allows it, and refuses it if the
+// namespace expired before now.
+func limitTTL(item *CacheItem, quota NamespaceQuota, now time.Time) error {
+	if quota.ExpiresAt != nil && !now.Before(*quota.ExpiresAt) {
+		return &KeyError{Key: item.Key, Err: ErrQuotaExceeded, Cause: fmt.Errorf("%w: namespace %s expired at %s", ErrQuotaExceeded, quota.Namespace, quota.ExpiresAt.Format(time.RFC3339))}
+	}
+	if item.TTL == 0 && quota.DefaultTTL > 0 {
+		item.TTL = quota.DefaultTTL
+	}
+	if quota.MaxTTL > 0 && (item.TTL == 0 || item.TTL > quota.MaxTTL) {
+		item.TTL = quota.MaxTTL
+	}
+	return nil
+}
+
+// Quotas returns every namespace quota held here, ordered by namespace.
+func (m *Manager) Quotas() []NamespaceQuota {
+	m.mutex.RLock()
+	quotas := make([]NamespaceQuota, 0, len(m.quotas))
+	for _, usage := range m.quotas {
+		quotas = append(quotas, usage.quota)
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Namespace < quotas[j].Namespace })
+	return quotas
+}
+
+// SetQuota gives the namespace quota names the quota, replacing any it
+// has, and returns it as stored. The namespace may already hold items,
+// even beyond the quota: writes are refused until it is back within it.
+// Unless options keep it local, the quota is replicated like any write.
+func (m *Manager) SetQuota(ctx context.Context, quota NamespaceQuota, options WriteOptions) (NamespaceQuota, error) {
+	if err := ctx.Err(); err != nil {
+		return NamespaceQuota{}, err
+	}
+	if err := ValidateNamespace(quota.Namespace); err != nil {
+		return NamespaceQuota{}, err
+	}
+	if quota.Namespace == QuotaNamespace {
+		return NamespaceQuota{}, fmt.Errorf("%w: namespace %s is reserved", ErrInvalidKey, quota.Namespace)
+	}
+
+	m.mutex.Lock()
+	now := m.now()
+	quota.CreatedAt = now
+	if usage := m.quotas[quota.Namespace]; usage != nil {
+		quota.CreatedAt = usage.quota.CreatedAt
+		if quota.Source == "" {
+			quota.Source = usage.quota.Source
+		}
+	}
+	item, err := m.quotaItem(quota, now)
+	if err != nil {
+		m.mutex.Unlock()
+		return NamespaceQuota{}, err
+	}
+	m.place(item, WriteOptions{})
+	m.updateStats()
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	sequence := m.sequence
+	m.mutex.Unlock()
+
+	return quota, m.await(ctx, sequence, options.Consistency)
+}
+
+// Quota returns the quota of namespace ns, if it has one.
+func (m *Manager) Quota(ns string) (NamespaceQuota, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	usage := m.quotas[ns]
+	if usage == nil {
+		return NamespaceQuota{}, false
+	}
+	return usage.quota, true
+}
+
+// CloneNamespace copies the live items of namespace source into the
+// namespace quota names and gives that namespace the quota, in one step,
+// and returns how many items it copied. The target must be empty and
+// without a quota. Copies share their values with the originals until
+// either is overwritten, so a clone costs little memory of its own, and
+// their TTLs are the originals' remaining ones, limited by the quota's
+// TTL policy. Unless options keep the clone local, the quota and the
+// copies are replicated like any write.
+func (m *Manager) CloneNamespace(ctx context.Context, source string, quota NamespaceQuota, options WriteOptions) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	target := quota.Namespace
+	for _, ns := range []string{source, target} {
+		if err := ValidateNamespace(ns); err != nil {
+			return 0, err
+		}
+		if ns == QuotaNamespace {
+			return 0, fmt.Errorf("%w: namespace %s is reserved", ErrInvalidKey, ns)
+		}
+	}
+	if source == target {
+		return 0, fmt.Errorf("%w: a namespace can't be cloned into itself", ErrInvalidKey)
+	}
+
+	m.mutex.Lock()
+	now := m.now()
+	quota.Source = source
+	quota.CreatedAt = now
+	policy, err := m.quotaItem(quota, now)
+	if err != nil {
+		m.mutex.Unlock()
+		return 0, err
+	}
+	if _, exists := m.quotas[target]; exists {
+		m.mutex.Unlock()
+		return 0, &KeyError{Key: policy.Key, Err: ErrExists, Cause: fmt.Errorf("%w: namespace %s already has a quota", ErrExists, target)}
+	}
+
+	sourcePrefix, targetPrefix := NamespaceKey(source, ""), NamespaceKey(target, "")
+	var copies []*CacheItem
+	var bytes int64
+	for key, item := range m.items {
+		if strings.HasPrefix(key, targetPrefix) {
+			m.mutex.Unlock()
+			return 0, &KeyError{Key: key, Err: ErrExists, Cause: fmt.Errorf("%w: namespace %s is not empty", ErrExists, target)}
+		}
+		if !strings.HasPrefix(key, sourcePrefix) || item.expiredAt(now) {
+			continue
+		}
+		clone := *item
+		clone.Key = targetPrefix + strings.TrimPrefix(key, sourcePrefix)
+		clone.Region = m.region
+		clone.NodeID = m.nodeID
+		clone.TTL = item.remainingTTL(now)
+		clone.Touched = nil
+		clone.Reads = 0
+		if err := limitTTL(&clone, quota, now); err != nil {
+			m.mutex.Unlock()
+			return 0, err
+		}
+		copies = append(copies, &clone)
+		bytes += clone.size()
+	}
+	if len(copies) == 0 {
+		m.mutex.Unlock()
+		return 0, &KeyError{Key: sourcePrefix, Err: ErrNotFound, Cause: fmt.Errorf("%w: namespace %s holds no items", ErrNotFound, source)}
+	}
+	if err := quota.check(targetPrefix, len(copies), bytes); err != nil {
+		m.mutex.Unlock()
+		return 0, err
+	}
+
+	// The quota goes first, so it counts the copies as they are put.
+	placed := append([]*CacheItem{policy}, copies...)
+	for _, item := range placed {
+		m.place(item, WriteOptions{})
+	}
+	m.updateStats()
+	sequence := m.sequence
+	m.mutex.Unlock()
+
+	// Like DeleteWhere's deletes, the copies may wait for subscribers, so
+	// they are published after the lock is released.
+	if !options.LocalOnly {
+		for _, item := range placed {
+			if err := m.publishWait(ctx, item); err != nil {
+				return len(copies), err
+			}
+		}
+	}
+	return len(copies), m.await(ctx, sequence, options.Consistency)
+}
+
+// quotaItem returns the item storing quota.
+func (m *Manager) quotaItem(quota NamespaceQuota, now time.Time) (*CacheItem, error) {
+	if quota.MaxItems < 0 || quota.MaxBytes < 0 || quota.DefaultTTL < 0 || quota.MaxTTL < 0 {
+		return nil, fmt.Errorf("%w: quota limits can't be negative", ErrInvalidKey)
+	}
+	value, err := json.Marshal(quota)
+	if err != nil {
+		return nil, err
+	}
+	item := &CacheItem{
+		Key:      QuotaKey(quota.Namespace),
+		Value:    string(value),
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		Encoding: codec.EncodingJSON,
+	}
+	if quota.ExpiresAt != nil && !quota.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: namespace %s would expire at once", ErrInvalidTTL, quota.Namespace)
+	}
+	return item, nil
+}
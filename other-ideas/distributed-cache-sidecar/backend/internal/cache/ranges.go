@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRangeNotSatisfiable fails a read of bytes beyond the end of a value.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// PayloadSize returns the size in bytes of item's payload: what its value
+// decodes to, or for a large object the total of its parts.
+func (m *Manager) PayloadSize(item *CacheItem) (int64, error) {
+	if item.Type == TypeChunked {
+		manifest, err := item.manifest()
+		if err != nil {
+			return 0, err
+		}
+		return manifest.Size, nil
+	}
+	return m.codecs.Size(item.Value, item.Encoding)
+}
+
+// ReadRange returns length bytes of item's payload from offset. Only the
+// parts of a large object that the range covers are read.
+func (m *Manager) ReadRange(ctx context.Context, item *CacheItem, offset, length int64) ([]byte, error) {
+	size, err := m.PayloadSize(item)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset+length > size {
+		return nil, &KeyError{Key: item.Key, Err: ErrRangeNotSatisfiable, Cause: fmt.Errorf("%w: %d bytes from %d of %d", ErrRangeNotSatisfiable, length, offset, size)}
+	}
+	if item.Type != TypeChunked {
+		return m.codecs.Range(item.Value, item.Encoding, offset, length)
+	}
+
+	manifest, err := item.manifest()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, length)
+	var start int64
+	for i, partKey := range manifest.Parts {
+		if int64(len(data)) == length {
+			break
+		}
+		part, err := m.Read(ctx, partKey, ReadOptions{})
+		if err != nil {
+			return nil, &KeyError{Key: item.Key, Err: ErrNotFound, Cause: fmt.Errorf("%w: part %d of %d of %s is gone", err, i+1, len(manifest.Parts), item.Key)}
+		}
+		partSize, err := m.codecs.Size(part.Value, part.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		if end := start + partSize; end > offset {
+			from := offset + int64(len(data)) - start
+			n := partSize - from
+			if remaining := length - int64(len(data)); n > remaining {
+				n = remaining
+			}
+			chunk, err := m.codecs.Range(part.Value, part.Encoding, from, n)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, chunk...)
+		}
+		start += partSize
+	}
+	return data, nil
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TypeRateLimit is the CacheItem.Type of a rate limit's token bucket.
+const TypeRateLimit = "ratelimit"
+
+var ErrInvalidRateLimit = errors.New("invalid rate limit")
+
+// A rate limit is a token bucket: it holds up to limit tokens, refills at
+// limit tokens per window, and each request allowed takes tokens from it.
+// The bucket is stored as an item of its own type, which expires when the
+// bucket would be full again, so idle limits cost nothing. Like counters,
+// a bucket is updated atomically on the node that applies the request and
+// replicated last-writer-wins: send a key's requests to one node, such as
+// its owner. Denied requests take nothing and store nothing.
+
+// bucket is the Value of a rate limit item.
+type bucket struct {
+	Tokens     float64   `json:"tokens"`
+	RefilledAt time.Time `json:"refilled_at"`
+}
+
+// RateLimit is the outcome of a request against a rate limit.
+type RateLimit struct {
+	Key       string
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// RetryAfter is how long a denied request must wait for the tokens it
+	// asked for, and ResetAfter how long until the bucket is full again.
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// TakeTokens takes cost tokens from the rate limit under key, which allows
+// limit per window, if it holds them. A missing or expired key is a full
+// bucket, created with the metadata in options; its TTL is always until
+// it is full again.
+func (m *Manager) TakeTokens(ctx context.Context, key string, limit int64, window time.Duration, cost int64, options WriteOptions) (*RateLimit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit < 1 || window < time.Millisecond || cost < 1 || cost > limit {
+		return nil, fmt.Errorf("%w: limit must be positive, window at least 1ms and cost 1 to the limit", ErrInvalidRateLimit)
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	sequence, result, item, err := m.takeTokens(key, limit, window, cost, options)
+	if err != nil || item == nil {
+		return result, err
+	}
+	return result, m.settle(ctx, item, sequence, options)
+}
+
+func (m *Manager) takeTokens(key string, limit int64, window time.Duration, cost int64, options WriteOptions) (uint64, *RateLimit, *CacheItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	state := bucket{Tokens: float64(limit), RefilledAt: now}
+	existing, exists := m.items[key]
+	if exists && !existing.expiredAt(now) {
+		if existing.Type != TypeRateLimit {
+			return 0, nil, nil, &KeyError{Key: key, Err: ErrWrongType}
+		}
+		if err := json.Unmarshal([]byte(existing.Value), &state); err != nil {
+			return 0, nil, nil, &KeyError{Key: key, Err: ErrWrongType, Cause: err}
+		}
+		if elapsed := now.Sub(state.RefilledAt); elapsed > 0 {
+			state.Tokens += float64(limit) * elapsed.Seconds() / window.Seconds()
+		}
+		state.Tokens = math.Min(state.Tokens, float64(limit))
+		state.RefilledAt = now
+	}
+
+	// perToken is how long the bucket takes to refill one token.
+	perToken := time.Duration(float64(window) / float64(limit))
+	result := &RateLimit{Key: key, Limit: limit}
+	if state.Tokens < float64(cost) {
+		result.Remaining = int64(state.Tokens)
+		result.RetryAfter = time.Duration((float64(cost) - state.Tokens) * float64(perToken))
+		result.ResetAfter = time.Duration((float64(limit) - state.Tokens) * float64(perToken))
+		return 0, result, nil, nil
+	}
+	state.Tokens -= float64(cost)
+	result.Allowed = true
+	result.Remaining = int64(state.Tokens)
+	result.ResetAfter = time.Duration((float64(limit) - state.Tokens) * float64(perToken))
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	item := &CacheItem{
+		Key:    key,
+		Value:  string(value),
+		Region: m.region,
+		NodeID: m.nodeID,
+		TTL:    ttlSeconds(result.ResetAfter),
+		Type:   TypeRateLimit,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+	if err := m.hooks.beforeSet(item); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := m.checkSize(item); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, nil, nil, err
+	}
+
+	item.Timestamp = m.stamp(existing)
+	if exists {
+		item.Version = existing.Version + 1
+	} else {
+		item.Version = 1
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	return m.sequence, result, item, nil
+}
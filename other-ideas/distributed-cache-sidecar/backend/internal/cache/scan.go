@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+)
+
+// Scan returns, in order, up to limit keys of live items that start with
+// prefix and sort after the key after, and whether more follow. Paging
+// through keys by passing the last key of each page as the next one's
+// after sees every key that is live throughout, whatever is written in
+// between. A page costs one pass over the keys, keeping only the limit
+// smallest, so no index has to be kept up to date on writes.
+func (m *Manager) Scan(prefix, after string, limit int) ([]string, bool) {
+	if limit < 1 {
+		return nil, false
+	}
+	// One key more than the page tells whether another page follows.
+	smallest := make(keyHeap, 0, limit+1)
+
+	m.mutex.RLock()
+	now := m.now()
+	for key, item := range m.items {
+		if key <= after || !strings.HasPrefix(key, prefix) || item.expiredAt(now) {
+			continue
+		}
+		if len(smallest) <= limit {
+			heap.Push(&smallest, key)
+		} else if key < smallest[0] {
+			smallest[0] = key
+			heap.Fix(&smallest, 0)
+		}
+	}
+	m.mutex.RUnlock()
+
+	keys := []string(smallest)
+	sort.Strings(keys)
+	if len(keys) > limit {
+		return keys[:limit], true
+	}
+	return keys, false
+}
+
+// keyHeap is a max-heap of keys, so the largest of those kept is the one
+// a smaller key replaces.
+type keyHeap []string
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	key := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return key
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// TypeSet is the CacheItem.Type of a set.
+const TypeSet = "set"
+
+// Sets hold distinct strings, such as the modules a user has completed,
+// so a member can be added or checked without round-tripping the whole
+// collection. A set is stored like a list, as a JSON array kept sorted,
+// and is replicated and resolved the same way.
+
+// SetAdd adds members to the set under key, creating it with the TTL,
+// sliding flag and metadata in options if there is none. It returns how
+// many members weren't in the set yet and the set's new size.
+func (m *Manager) SetAdd(ctx context.Context, key string, members []string, options WriteOptions) (int, int, error) {
+	var added, size int
+	err := m.updateStrings(ctx, key, TypeSet, options, true, func(set []string) ([]string, bool) {
+		for _, member := range members {
+			if i := sort.SearchStrings(set, member); i == len(set) || set[i] != member {
+				set = append(set, "")
+				copy(set[i+1:], set[i:])
+				set[i] = member
+				added++
+			}
+		}
+		size = len(set)
+		return set, added > 0
+	})
+	return added, size, err
+}
+
+// SetRemove removes members from the set under key and returns how many
+// were in it and the set's new size. A set emptied this way is kept, as
+// with lists; a missing key is an empty set.
+func (m *Manager) SetRemove(ctx context.Context, key string, members []string, options WriteOptions) (int, int, error) {
+	var removed, size int
+	err := m.updateStrings(ctx, key, TypeSet, options, true, func(set []string) ([]string, bool) {
+		for _, member := range members {
+			if i := sort.SearchStrings(set, member); i < len(set) && set[i] == member {
+				set = append(set[:i], set[i+1:]...)
+				removed++
+			}
+		}
+		size = len(set)
+		return set, removed > 0
+	})
+	return removed, size, err
+}
+
+// SetMembers returns the members of the set under key in sorted order.
+func (m *Manager) SetMembers(ctx context.Context, key string) ([]string, error) {
+	item, err := m.Read(ctx, key, ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return item.values(TypeSet)
+}
+
+// SetContains reports whether member is in the set under key. A missing
+// key is an empty set.
+func (m *Manager) SetContains(ctx context.Context, key, member string) (bool, error) {
+	set, err := m.SetMembers(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+			return false, nil
+		}
+		return false, err
+	}
+	i := sort.SearchStrings(set, member)
+	return i < len(set) && set[i] == member, nil
+}
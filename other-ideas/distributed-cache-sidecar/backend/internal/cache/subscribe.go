@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Subscriptions deliver the changes made on this node, the ones that
+// replicate, to any number of consumers: the replication sender, and
+// whatever else wants to follow writes under a prefix. Every subscription
+// has its own buffer. Writes never wait for a subscriber with a full
+// buffer, which misses the change instead, so a slow subscriber can't hold
+// up writes or the other subscribers. Only DeleteWhere, which publishes
+// its deletes after releasing the lock, waits for room.
+
+// SubscriptionBuffer is how many events a subscription holds for its
+// consumer before further ones are dropped.
+const SubscriptionBuffer = 100
+
+// Event is a change made on this node: an item written, or the tombstone
+// of an item deleted. Op is MutationSet or MutationDelete.
+type Event struct {
+	Op   string
+	Key  string
+	Item *CacheItem
+}
+
+type subscription struct {
+	prefix string
+	events chan Event
+	// done is closed by Unsubscribe.
+	done chan struct{}
+}
+
+type subscriptions struct {
+	mutex sync.RWMutex
+	list  []*subscription
+}
+
+// Subscribe returns a channel receiving every change made on this node to
+// keys starting with prefix, until Unsubscribe.
+func (m *Manager) Subscribe(prefix string) <-chan Event {
+	s := &subscription{prefix: prefix, events: make(chan Event, SubscriptionBuffer), done: make(chan struct{})}
+	m.subscriptions.mutex.Lock()
+	m.subscriptions.list = append(m.subscriptions.list, s)
+	m.subscriptions.mutex.Unlock()
+	return s.events
+}
+
+// Unsubscribe stops delivering changes to events, a channel returned by
+// Subscribe. The channel is left open and needn't be drained.
+func (m *Manager) Unsubscribe(events <-chan Event) {
+	m.subscriptions.mutex.Lock()
+	defer m.subscriptions.mutex.Unlock()
+
+	for i, s := range m.subscriptions.list {
+		if s.events == events {
+			m.subscriptions.list = append(m.subscriptions.list[:i:i], m.subscriptions.list[i+1:]...)
+			close(s.done)
+			return
+		}
+	}
+}
+
+func newEvent(item *CacheItem) Event {
+	if item.Deleted() {
+		return Event{Op: MutationDelete, Key: item.Key, Item: item}
+	}
+	return Event{Op: MutationSet, Key: item.Key, Item: item}
+}
+
+// publish hands item to every subscription under its key that has room.
+func (m *Manager) publish(item *CacheItem) {
+	event := newEvent(item)
+	m.subscriptions.mutex.RLock()
+	defer m.subscriptions.mutex.RUnlock()
+
+	for _, s := range m.subscriptions.list {
+		if !strings.HasPrefix(event.Key, s.prefix) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// publishWait hands item to every subscription under its key, waiting for
+// room until ctx is done. The caller must not hold the manager lock.
+func (m *Manager) publishWait(ctx context.Context, item *CacheItem) error {
+	event := newEvent(item)
+	m.subscriptions.mutex.RLock()
+	list := m.subscriptions.list
+	m.subscriptions.mutex.RUnlock()
+
+	for _, s := range list {
+		if !strings.HasPrefix(event.Key, s.prefix) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tags name groups of items that are invalidated together, such as every
+// result derived from one pricing sheet. An item's tags are set by the
+// write that stores it and replicate with it; a later write of the key
+// without tags leaves it untagged. InvalidateTag deletes every item with
+// a tag on this node and hands the invalidation to the replication
+// sender, so peers delete theirs, including items this node never held.
+
+// MaxTags bounds the tags one item may carry.
+const MaxTags = 32
+
+// TagInvalidation is the invalidation of a tag, as replicated to peers.
+type TagInvalidation struct {
+	Tag    string `json:"tag"`
+	Origin string `json:"origin"`
+	// Deleted are the deletes of the items this node held, for peers that
+	// can only replicate deletes one key at a time.
+	Deleted []*CacheItem `json:"-"`
+}
+
+// tagIndex maps each tag to the keys of the items carrying it.
+type tagIndex map[string]map[string]struct{}
+
+func (index tagIndex) add(item *CacheItem) {
+	for _, tag := range item.Tags {
+		keys, exists := index[tag]
+		if !exists {
+			keys = make(map[string]struct{})
+			index[tag] = keys
+		}
+		keys[item.Key] = struct{}{}
+	}
+}
+
+func (index tagIndex) drop(item *CacheItem) {
+	for _, tag := range item.Tags {
+		delete(index[tag], item.Key)
+		if len(index[tag]) == 0 {
+			delete(index, tag)
+		}
+	}
+}
+
+// normalizeTags validates tags and returns them sorted and without
+// duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if err := ValidateTag(tag); err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("%w: at most %d tags per item", ErrInvalidTag, MaxTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// ValidateTag returns ErrInvalidTag unless tag is non-empty, at most 128
+// bytes and free of whitespace, control characters and the separators of
+// the TCP protocol.
+func ValidateTag(tag string) error {
+	if tag == "" || len(tag) > 128 {
+		return fmt.Errorf("%w: tags must be 1 to 128 bytes", ErrInvalidTag)
+	}
+	if strings.ContainsAny(tag, "|,\x7f") || strings.IndexFunc(tag, func(r rune) bool { return r <= ' ' }) >= 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	}
+	return nil
+}
+
+// Tagged returns the keys of the items carrying tag, sorted.
+func (m *Manager) Tagged(tag string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make([]string, 0, len(m.tags[tag]))
+	for key := range m.tags[tag] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TagCounts returns how many items carry each tag.
+func (m *Manager) TagCounts() map[string]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := make(map[string]int, len(m.tags))
+	for tag, keys := range m.tags {
+		counts[tag] = len(keys)
+	}
+	return counts
+}
+
+// InvalidateTag deletes every item carrying tag and returns how many this
+// node held. Unless options keep it local, the invalidation replicates to
+// peers, which delete every item carrying tag that they hold.
+func (m *Manager) InvalidateTag(ctx context.Context, tag string, options WriteOptions) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := ValidateTag(tag); err != nil {
+		return 0, err
+	}
+
+	sequence, deleted := m.deleteTagged(tag, !options.LocalOnly)
+	if !options.LocalOnly {
+		invalidation := &TagInvalidation{Tag: tag, Origin: m.nodeID, Deleted: make([]*CacheItem, len(deleted))}
+		for i, item := range deleted {
+			invalidation.Deleted[i] = item.tombstone()
+		}
+		select {
+		case m.onInvalidate <- invalidation:
+		case <-ctx.Done():
+			return len(deleted), ctx.Err()
+		}
+	}
+	return len(deleted), m.await(ctx, sequence, options.Consistency)
+}
+
+// ApplyTagInvalidation deletes every item carrying the invalidated tag,
+// for an invalidation replicated from a peer, and returns how many it
+// deleted.
+func (m *Manager) ApplyTagInvalidation(invalidation *TagInvalidation) (int, error) {
+	if err := ValidateTag(invalidation.Tag); err != nil {
+		return 0, err
+	}
+	_, deleted := m.deleteTagged(invalidation.Tag, false)
+	return len(deleted), nil
+}
+
+// deleteTagged deletes every item carrying tag, passing their tombstones
+// to the change listeners if notify is set.
+func (m *Manager) deleteTagged(tag string, notify bool) (uint64, []*CacheItem) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	deleted := make([]*CacheItem, 0, len(m.tags[tag]))
+	for key := range m.tags[tag] {
+		deleted = append(deleted, m.items[key])
+	}
+	for _, item := range deleted {
+		m.remove(item.Key)
+		m.recordMutation(MutationDelete, &CacheItem{Key: item.Key})
+		if notify {
+			m.notifyListeners(item.tombstone())
+		}
+	}
+	m.updateStats()
+	return m.sequence, deleted
+}
+
+// GetTagChannel delivers each local tag invalidation to replicate.
+func (m *Manager) GetTagChannel() <-chan *TagInvalidation {
+	return m.onInvalidate
+}
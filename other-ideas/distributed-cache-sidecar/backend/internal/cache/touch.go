@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// touchGranularity is how stale an item's renewal must be before a read
+// of a sliding item renews it again. TTLs are whole seconds, so renewing
+// more often than this would only add journal entries and peer traffic.
+const touchGranularity = time.Second
+
+// sameWrite reports whether item and other are copies of the same write,
+// which may have been touched at different times.
+func (item *CacheItem) sameWrite(other *CacheItem) bool {
+	return item.Timestamp.Equal(other.Timestamp) && item.NodeID == other.NodeID
+}
+
+// Touch restarts key's TTL as if it had just been written, without
+// changing its value, and returns the renewed item. Unlike a write it
+// does not take part in last-writer-wins: a touch never overrides a newer
+// write made elsewhere, and touches of the same write made on different
+// nodes merge to the latest.
+func (m *Manager) Touch(ctx context.Context, key string) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists {
+		return nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	now := m.now()
+	if existing.expiredAt(now) {
+		return nil, &KeyError{Key: key, Err: ErrExpired}
+	}
+	return m.renew(existing, now, true), nil
+}
+
+// renewOnRead renews a sliding item that was just read at now, unless it
+// was renewed less than touchGranularity ago or has changed since.
+func (m *Manager) renewOnRead(item *CacheItem, now time.Time) {
+	if now.Sub(item.renewedAt()) < touchGranularity {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.items[item.Key] == item {
+		m.renew(item, now, true)
+	}
+}
+
+// renew replaces item with a copy touched at the given time. Stored items
+// are never modified, so views taken earlier keep the old copy. A local
+// renewal is replicated like a write, so that peers keep the item as long
+// as this node does. The caller holds the write lock.
+func (m *Manager) renew(item *CacheItem, at time.Time, local bool) *CacheItem {
+	renewed := *item
+	renewed.Touched = &at
+	m.put(&renewed)
+	m.recordMutation(MutationSet, &renewed)
+	m.updateStats()
+
+	if local {
+		m.publish(&renewed)
+	}
+	return &renewed
+}
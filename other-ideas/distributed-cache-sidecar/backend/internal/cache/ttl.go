@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Expiry describes when an item expires, as of At. RenewedAt is when its
+// TTL started counting down: when it was written, or last touched or, if
+// sliding, read. Items without a TTL have no ExpiresAt and a
+// RemainingTTL of -1.
+type Expiry struct {
+	Key          string     `json:"key"`
+	TTL          int64      `json:"ttl"`
+	Sliding      bool       `json:"sliding"`
+	RenewedAt    time.Time  `json:"renewed_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	RemainingTTL int64      `json:"remaining_ttl"`
+	RemainingMS  int64      `json:"remaining_ms"`
+	At           time.Time  `json:"at"`
+}
+
+// Expiry returns when item expires, as of now.
+func (m *Manager) Expiry(item *CacheItem) Expiry {
+	now := m.now()
+	expiry := Expiry{
+		Key:          item.Key,
+		TTL:          item.TTL,
+		Sliding:      item.Sliding,
+		RenewedAt:    item.renewedAt(),
+		RemainingTTL: -1,
+		RemainingMS:  -1,
+		At:           now,
+	}
+	if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+		expiry.ExpiresAt = &expiresAt
+		expiry.RemainingTTL = item.remainingTTL(now)
+		expiry.RemainingMS = int64(expiresAt.Sub(now) / time.Millisecond)
+	}
+	return expiry
+}
+
+// TTL returns when the item under key expires without counting a read,
+// so inspecting a sliding item doesn't renew it and inspecting a
+// max_reads item doesn't use it up. An item that has expired but not yet
+// been swept is ErrExpired, saying when it expired.
+func (m *Manager) TTL(ctx context.Context, key string) (*Expiry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	item, exists := m.items[key]
+	m.mutex.RUnlock()
+	if !exists {
+		return nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	expiry := m.Expiry(item)
+	if item.expiredAt(expiry.At) {
+		return nil, &KeyError{Key: key, Err: ErrExpired, Cause: fmt.Errorf("%w: %s at %s", ErrExpired, key, expiry.ExpiresAt.Format(time.RFC3339))}
+	}
+	return &expiry, nil
+}
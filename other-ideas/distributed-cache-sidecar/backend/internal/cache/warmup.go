@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WarmUpEntry is an item of a warm-up file. A string Value is stored as
+// is; any other JSON value is stored as its JSON text, with the json
+// encoding unless Encoding says otherwise. TTL is in seconds, zero for
+// none.
+type WarmUpEntry struct {
+	Key      string            `json:"key"`
+	Value    json.RawMessage   `json:"value"`
+	TTL      int64             `json:"ttl"`
+	Encoding string            `json:"encoding"`
+	Metadata map[string]string `json:"metadata"`
+	Tags     []string          `json:"tags"`
+}
+
+// WarmUpResult is what WarmUp stored.
+type WarmUpResult struct {
+	Loaded int `json:"loaded"`
+	// Skipped counts the entries whose key was already held.
+	Skipped int `json:"skipped"`
+}
+
+// WarmUp stores the entries read from r, a JSON array of WarmUpEntry or
+// one entry per line (NDJSON), so a node starts with reference data
+// already cached. Every node loads its own copy, so the entries are
+// written on this node only, and never over a live item it already holds,
+// such as one restored or replicated since. An invalid entry stops the
+// warm-up with an error naming it; the entries before it stay stored.
+func (m *Manager) WarmUp(ctx context.Context, r io.Reader) (WarmUpResult, error) {
+	var result WarmUpResult
+	reader := bufio.NewReader(r)
+	decoder := json.NewDecoder(reader)
+	array, err := startsArray(reader)
+	if err != nil {
+		return result, err
+	}
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return result, err
+		}
+	}
+
+	for n := 1; ; n++ {
+		if array && !decoder.More() {
+			break
+		}
+		var entry WarmUpEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF && !array {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("entry %d: %v", n, err)
+		}
+
+		stored, err := m.warmUp(ctx, entry)
+		if err != nil {
+			return result, fmt.Errorf("entry %d (%s): %w", n, entry.Key, err)
+		}
+		if stored {
+			result.Loaded++
+		} else {
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+// startsArray reports whether the first JSON value in reader is an array,
+// without consuming it.
+func startsArray(reader *bufio.Reader) (bool, error) {
+	for {
+		next, err := reader.Peek(1)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return next[0] == '[', nil
+		}
+	}
+}
+
+func (m *Manager) warmUp(ctx context.Context, entry WarmUpEntry) (bool, error) {
+	if entry.Key == "" {
+		return false, fmt.Errorf("%w: key is required", ErrInvalidKey)
+	}
+	if len(entry.Value) == 0 || string(entry.Value) == "null" {
+		return false, errors.New("value is required")
+	}
+	if entry.TTL < 0 {
+		return false, errors.New("ttl must not be negative")
+	}
+
+	options := WriteOptions{
+		TTL:         time.Duration(entry.TTL) * time.Second,
+		Encoding:    entry.Encoding,
+		Metadata:    entry.Metadata,
+		Tags:        entry.Tags,
+		LocalOnly:   true,
+		Consistency: ConsistencyMemory,
+		IfAbsent:    true,
+	}
+	var value string
+	if err := json.Unmarshal(entry.Value, &value); err != nil {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, entry.Value); err != nil {
+			return false, err
+		}
+		value = compact.String()
+		if options.Encoding == "" {
+			options.Encoding = codec.EncodingJSON
+		}
+	}
+
+	_, err := m.Write(ctx, entry.Key, value, options)
+	if errors.Is(err, ErrExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/patch"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// TypeSortedSet is the CacheItem.Type of a sorted set.
+const TypeSortedSet = "zset"
+
+// Sorted sets hold members with a score each, such as players and their
+// best result, and are read ordered by score. Scores only ever rise: a
+// member added with a lower score than it has keeps its score. That makes
+// every copy of a sorted set mergeable with any other by keeping each
+// member's higher score, whatever order changes arrive in, so a sorted
+// set is not resolved last-writer-wins like other values: whenever one
+// arrives from a peer or another cluster, by patch or whole, it is merged
+// into the copy held here. A sorted set is stored as a JSON object of
+// scores; changes are replicated as merge patches naming the members
+// whose score rose. Deleting the key is the only way to lower a score.
+
+// ScoredMember is a member of a sorted set with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// scores decodes the scores item holds.
+func (item *CacheItem) scores() (map[string]float64, error) {
+	if item.Type != TypeSortedSet {
+		return nil, &KeyError{Key: item.Key, Err: ErrWrongType}
+	}
+	scores := make(map[string]float64)
+	if err := json.Unmarshal([]byte(item.Value), &scores); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// SortedSetAdd raises the scores of members of the sorted set under key to
+// those given, adding the members it doesn't hold, and creates it with
+// the TTL, sliding flag and metadata in options if there is none. It
+// returns how many members are new, how many scores rose and the set's
+// new size.
+func (m *Manager) SortedSetAdd(ctx context.Context, key string, scores map[string]float64, options WriteOptions) (int, int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, 0, err
+	}
+	key = m.hooks.normalizeKey(key)
+	if err := m.keys.Validate(key); err != nil {
+		return 0, 0, 0, err
+	}
+
+	sequence, item, added, raised, size, err := m.storeSortedSet(key, scores, options)
+	if err != nil || item == nil {
+		return added, raised, size, err
+	}
+	return added, raised, size, m.settle(ctx, item, sequence, options)
+}
+
+func (m *Manager) storeSortedSet(key string, scores map[string]float64, options WriteOptions) (uint64, *CacheItem, int, int, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.items[key]
+	if !exists || existing.expiredAt(m.now()) {
+		sequence, item, err := m.createSortedSet(key, scores, options)
+		return sequence, item, len(scores), 0, len(scores), err
+	}
+	held, err := existing.scores()
+	if err != nil {
+		return 0, nil, 0, 0, 0, err
+	}
+
+	// Only the members whose score rises go into the patch peers apply.
+	changes := make(map[string]float64)
+	added, raised := 0, 0
+	for member, score := range scores {
+		current, holds := held[member]
+		switch {
+		case !holds:
+			added++
+		case score > current:
+			raised++
+		default:
+			continue
+		}
+		held[member] = score
+		changes[member] = score
+	}
+	if len(changes) == 0 {
+		return 0, nil, 0, 0, len(held), nil
+	}
+
+	patchDoc, err := json.Marshal(changes)
+	if err != nil {
+		return 0, nil, 0, 0, 0, err
+	}
+	patched, err := json.Marshal(held)
+	if err != nil {
+		return 0, nil, 0, 0, 0, err
+	}
+	item, err := m.putPatched(existing, patch.TypeMergePatch, patchDoc, patched, options.LocalOnly)
+	if err != nil {
+		return 0, nil, 0, 0, 0, err
+	}
+	return m.sequence, item, added, raised, len(held), nil
+}
+
+// createSortedSet stores a new sorted set holding scores. The caller holds
+// the write lock.
+func (m *Manager) createSortedSet(key string, scores map[string]float64, options WriteOptions) (uint64, *CacheItem, error) {
+	if len(scores) == 0 {
+		return 0, nil, &KeyError{Key: key, Err: ErrNotFound}
+	}
+	document, err := json.Marshal(scores)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	item := &CacheItem{
+		Key:      key,
+		Value:    string(document),
+		Region:   m.region,
+		NodeID:   m.nodeID,
+		TTL:      ttlSeconds(options.TTL),
+		Sliding:  options.Sliding,
+		Encoding: codec.EncodingJSON,
+		Type:     TypeSortedSet,
+	}
+	if len(options.Metadata) > 0 {
+		item.Metadata = make(map[string]string, len(options.Metadata))
+		for name, value := range options.Metadata {
+			item.Metadata[name] = value
+		}
+	}
+	if err := m.hooks.beforeSet(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkSize(item); err != nil {
+		return 0, nil, err
+	}
+	if err := m.checkQuota(item); err != nil {
+		return 0, nil, err
+	}
+
+	existing := m.items[key]
+	item.Timestamp = m.stamp(existing)
+	item.Version = 1
+	if existing != nil {
+		item.Version = existing.Version + 1
+	}
+	m.put(item)
+	m.recordMutation(MutationSet, item)
+	m.updateStats()
+
+	if !options.LocalOnly {
+		m.publish(item)
+		m.notifyListeners(item)
+	}
+	return m.sequence, item, nil
+}
+
+// SortedSetRange returns the members of the sorted set under key ranked
+// start to stop, counted from 0 for the highest score and inclusive, and
+// the set's size. Members with equal scores rank by name. A missing key
+// is an empty set.
+func (m *Manager) SortedSetRange(ctx context.Context, key string, start, stop int) ([]ScoredMember, int, error) {
+	ranked, err := m.ranked(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(ranked) {
+		stop = len(ranked) - 1
+	}
+	if start > stop {
+		return []ScoredMember{}, len(ranked), nil
+	}
+	return ranked[start : stop+1], len(ranked), nil
+}
+
+// SortedSetRank returns member's score and rank in the sorted set under
+// key, counted from 0 for the highest score, and the set's size. A member
+// the set doesn't hold is ErrNotFound.
+func (m *Manager) SortedSetRank(ctx context.Context, key, member string) (ScoredMember, int, int, error) {
+	ranked, err := m.ranked(ctx, key)
+	if err != nil {
+		return ScoredMember{}, 0, 0, err
+	}
+	for rank, scored := range ranked {
+		if scored.Member == member {
+			return scored, rank, len(ranked), nil
+		}
+	}
+	return ScoredMember{}, 0, len(ranked), &KeyError{Key: key, Err: ErrNotFound}
+}
+
+// ranked returns the members of the sorted set under key, highest score
+// first.
+func (m *Manager) ranked(ctx context.Context, key string) ([]ScoredMember, error) {
+	item, err := m.Read(ctx, key, ReadOptions{})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+		return []ScoredMember{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scores, err := item.scores()
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := make([]ScoredMember, 0, len(scores))
+	for member, score := range scores {
+		ranked = append(ranked, ScoredMember{Member: member, Score: score})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Member < ranked[j].Member
+	})
+	return ranked, nil
+}
+
+// joinScores merges the scores in incoming, a whole sorted set or a patch
+// of one, into those in held, keeping each member's higher score.
+func joinScores(held, incoming string) (string, error) {
+	scores := make(map[string]float64)
+	if err := json.Unmarshal([]byte(held), &scores); err != nil {
+		return "", err
+	}
+	var other map[string]float64
+	if err := json.Unmarshal([]byte(incoming), &other); err != nil {
+		return "", err
+	}
+	for member, score := range other {
+		if current, holds := scores[member]; !holds || score > current {
+			scores[member] = score
+		}
+	}
+	joined, err := json.Marshal(scores)
+	return string(joined), err
+}
+
+// joinSortedSet returns what storing item, a sorted set from a peer or
+// another cluster, over existing makes of it: the members of both with
+// their higher score, under whichever of the two writes supersedes the
+// other. It returns nil when that changes nothing. The caller holds the
+// write lock.
+func (m *Manager) joinSortedSet(existing, item *CacheItem) (*CacheItem, error) {
+	joined, err := joinScores(existing.Value, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	winner := existing
+	if item.supersedes(existing) {
+		winner = item
+	}
+	if winner == existing && joined == existing.Value {
+		return nil, nil
+	}
+
+	merged := *winner
+	merged.Value = joined
+	if existing.Version > merged.Version {
+		merged.Version = existing.Version
+	}
+	return &merged, nil
+}
+
+// putJoined stores the join of item, a sorted set from a peer, into
+// existing, and reports whether that changed anything. The caller holds
+// the write lock.
+func (m *Manager) putJoined(existing, item *CacheItem) (bool, error) {
+	joined, err := m.joinSortedSet(existing, item)
+	if err != nil || joined == nil {
+		return false, err
+	}
+	m.put(joined)
+	m.recordMutation(MutationSet, joined)
+	m.updateStats()
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package changefeed
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/eventhubs"
+	"distributed-cache-sidecar/internal/kafkarest"
+	"fmt"
+	"time"
+)
+
+// broker is where batches of changes are published.
+type broker interface {
+	send(ctx context.Context, batch []pendingChange) error
+	// String names the broker in logs and status, without secrets.
+	String() string
+}
+
+func newBroker(cfg config.ChangeFeedConfig) (broker, error) {
+	switch cfg.Broker {
+	case "eventhubs":
+		client, err := eventhubs.New(cfg.ConnectionString, "", 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return eventHubBroker{client: client}, nil
+	case "kafka":
+		return kafkaBroker{client: kafkarest.New(cfg.KafkaRESTURL, 30*time.Second), topic: cfg.Topic}, nil
+	}
+	return nil, fmt.Errorf("unknown change feed broker %q", cfg.Broker)
+}
+
+// eventHubBroker sends each change as a message partitioned by its key,
+// with its op as the "op" property.
+type eventHubBroker struct {
+	client *eventhubs.Client
+}
+
+func (b eventHubBroker) send(ctx context.Context, batch []pendingChange) error {
+	messages := make([]eventhubs.Message, len(batch))
+	for i, change := range batch {
+		messages[i] = eventhubs.Message{
+			Body:         change.body,
+			PartitionKey: change.key,
+			Properties:   map[string]string{"op": change.op},
+		}
+	}
+	return b.client.Send(ctx, messages)
+}
+
+func (b eventHubBroker) String() string {
+	return "eventhubs " + b.client.Hub()
+}
+
+// kafkaBroker produces each change as a record keyed by its key.
+type kafkaBroker struct {
+	client *kafkarest.Client
+	topic  string
+}
+
+func (b kafkaBroker) send(ctx context.Context, batch []pendingChange) error {
+	records := make([]kafkarest.Record, len(batch))
+	for i, change := range batch {
+		records[i] = kafkarest.Record{Key: change.key, Value: change.body}
+	}
+	return b.client.Produce(ctx, b.topic, records)
+}
+
+func (b kafkaBroker) String() string {
+	return fmt.Sprintf("kafka %s/topics/%s", b.client, b.topic)
+}
@@ -0,0 +1,275 @@
+// Package changefeed publishes the changes made on this node, writes and
+// deletes, to an Event Hub or a Kafka topic, so downstream systems can
+// build materialized views of the cache. Each node publishes the changes
+// made on it and none it received from peers, so a cluster publishes each
+// change once. Changes are keyed by cache key: the broker keeps each key's
+// changes in order on one partition, and the feed never sends a change
+// before those made earlier on the node have been accepted.
+package changefeed
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = logging.New("changefeed")
+
+var changesTotal = metrics.NewCounter("sidecar_changefeed_changes_total",
+	"Changes published to the change feed, by whether they were sent, dropped or failed to send.", "result")
+
+const (
+	// maxValueBytes is the largest value a change carries; larger values
+	// are left out, as brokers cap the size of a message.
+	maxValueBytes = 256 << 10
+	// maxBatchBytes bounds the encoded changes sent in one batch, below
+	// the 1 MB Event Hubs accepts.
+	maxBatchBytes = 900 << 10
+	// maxBackoff bounds the wait before retrying a failed batch.
+	maxBackoff = 30 * time.Second
+)
+
+// Change is the message published for a write or delete. Deletes carry
+// the key and the version, timestamp and origin of the write deleted.
+type Change struct {
+	Op        string            `json:"op"`
+	Key       string            `json:"key"`
+	Version   uint64            `json:"version"`
+	Timestamp time.Time         `json:"timestamp"`
+	NodeID    string            `json:"node_id"`
+	Region    string            `json:"region"`
+	TTL       int64             `json:"ttl,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Encoding  string            `json:"encoding,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Value     *string           `json:"value,omitempty"`
+	// ValueOmitted is set when values are included but this one was too
+	// large to be.
+	ValueOmitted bool `json:"value_omitted,omitempty"`
+}
+
+// Status describes the feed.
+type Status struct {
+	Broker    string    `json:"broker"`
+	Prefixes  []string  `json:"prefixes"`
+	Pending   int       `json:"pending"`
+	Sent      int64     `json:"sent"`
+	Dropped   int64     `json:"dropped"`
+	Failures  int64     `json:"failures"`
+	LastSent  time.Time `json:"last_sent"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Feed publishes the changes made on a node.
+type Feed struct {
+	cfg    config.ChangeFeedConfig
+	broker broker
+
+	pending []pendingChange
+	status  Status
+	wake    chan struct{}
+	mutex   sync.Mutex
+}
+
+// pendingChange is a change encoded for sending.
+type pendingChange struct {
+	key  string
+	op   string
+	body []byte
+}
+
+// New returns a Feed publishing the changes made through cacheManager to
+// the broker cfg configures.
+func New(cfg config.ChangeFeedConfig, cacheManager *cache.Manager) (*Feed, error) {
+	broker, err := newBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f := &Feed{
+		cfg:    cfg,
+		broker: broker,
+		status: Status{Broker: broker.String(), Prefixes: cfg.Prefixes},
+		wake:   make(chan struct{}, 1),
+	}
+	if f.status.Prefixes == nil {
+		f.status.Prefixes = []string{}
+	}
+	cacheManager.AddChangeListener(f.enqueue)
+	return f, nil
+}
+
+// Start sends pending changes every FlushIntervalMS, or as soon as a
+// batch is full, until the process begins shutting down, then sends what
+// is left once more.
+func (f *Feed) Start() {
+	lifecycle.Go("changefeed-sender", f.broker.String(), func() {
+		interval := time.Duration(f.cfg.FlushIntervalMS) * time.Millisecond
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		backoff := interval
+		for {
+			select {
+			case <-lifecycle.Stopping():
+				f.flush()
+				return
+			case <-ticker.C:
+			case <-f.wake:
+			}
+
+			if err := f.flush(); err != nil {
+				select {
+				case <-lifecycle.Stopping():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < maxBackoff {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = interval
+		}
+	})
+}
+
+// Status returns the feed's counters.
+func (f *Feed) Status() Status {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	status := f.status
+	status.Pending = len(f.pending)
+	return status
+}
+
+func (f *Feed) published(key string) bool {
+	if len(f.cfg.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.cfg.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue queues the change item stands for. It runs with the manager
+// lock held, so changes are queued in the order they are made.
+func (f *Feed) enqueue(item *cache.CacheItem) {
+	if !f.published(item.Key) {
+		return
+	}
+	change := f.change(item)
+	body, err := json.Marshal(change)
+	if err != nil {
+		logger.Printf("Failed to encode change of %s: %v", item.Key, err)
+		return
+	}
+
+	f.mutex.Lock()
+	if len(f.pending) >= f.cfg.MaxPending {
+		f.pending = f.pending[1:]
+		f.status.Dropped++
+		changesTotal.Inc("dropped")
+	}
+	f.pending = append(f.pending, pendingChange{key: item.Key, op: change.Op, body: body})
+	full := len(f.pending) >= f.cfg.BatchSize
+	f.mutex.Unlock()
+
+	if full {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *Feed) change(item *cache.CacheItem) Change {
+	change := Change{
+		Op:        cache.MutationSet,
+		Key:       item.Key,
+		Version:   item.Version,
+		Timestamp: item.Timestamp,
+		NodeID:    item.NodeID,
+		Region:    item.Region,
+	}
+	if item.Deleted() {
+		change.Op = cache.MutationDelete
+		return change
+	}
+	change.TTL = item.TTL
+	if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+		change.ExpiresAt = &expiresAt
+	}
+	change.Type = item.Type
+	change.Encoding = item.Encoding
+	change.Metadata = item.Metadata
+	change.Tags = item.Tags
+	if f.cfg.IncludeValues {
+		if len(item.Value) <= maxValueBytes {
+			value := item.Value
+			change.Value = &value
+		} else {
+			change.ValueOmitted = true
+		}
+	}
+	return change
+}
+
+// flush sends the pending changes, a batch at a time, until none are left
+// or a batch fails, which stays first in line.
+func (f *Feed) flush() error {
+	for {
+		f.mutex.Lock()
+		n, size := 0, 0
+		for n < len(f.pending) && n < f.cfg.BatchSize {
+			size += len(f.pending[n].body)
+			if n > 0 && size > maxBatchBytes {
+				break
+			}
+			n++
+		}
+		batch := append([]pendingChange(nil), f.pending[:n]...)
+		f.mutex.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := f.broker.send(ctx, batch)
+		cancel()
+
+		f.mutex.Lock()
+		if err != nil {
+			f.status.Failures++
+			f.status.LastError = err.Error()
+			f.mutex.Unlock()
+			changesTotal.Add(uint64(len(batch)), "failed")
+			logger.Printf("Failed to publish changes to %s: %v", f.broker, err)
+			events.Record(events.KindError, "Failed to publish changes to %s: %v", f.broker, err)
+			return err
+		}
+		// Changes may have been dropped from the front while sending.
+		drop := n
+		if drop > len(f.pending) {
+			drop = len(f.pending)
+		}
+		f.pending = f.pending[drop:]
+		f.status.Sent += int64(len(batch))
+		f.status.LastSent = time.Now()
+		f.status.LastError = ""
+		f.mutex.Unlock()
+		changesTotal.Add(uint64(len(batch)), "sent")
+	}
+}
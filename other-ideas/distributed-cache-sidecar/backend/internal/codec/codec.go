@@ -0,0 +1,316 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	EncodingRaw      = "raw"
+	EncodingJSON     = "json"
+	EncodingMsgpack  = "msgpack"
+	EncodingProtobuf = "protobuf"
+	EncodingBinary   = "binary"
+)
+
+var (
+	ErrUnknownEncoding = errors.New("unknown encoding")
+	ErrNotTranscodable = errors.New("encoding does not support transcoding")
+	ErrInvalidValue    = errors.New("value does not match declared encoding")
+)
+
+// Serializer describes one value encoding. Binary serializers carry their
+// payload base64-encoded in CacheItem.Value so it survives the JSON API and
+// the peer protocol.
+type Serializer interface {
+	Name() string
+	ContentType() string
+	Binary() bool
+	Validate(data []byte) error
+	Decode(data []byte) (interface{}, error)
+	Encode(v interface{}) ([]byte, error)
+}
+
+type Registry struct {
+	serializers map[string]Serializer
+	mutex       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{serializers: make(map[string]Serializer)}
+	r.Register(rawSerializer{})
+	r.Register(jsonSerializer{})
+	r.Register(msgpackSerializer{})
+	r.Register(protobufSerializer{})
+	r.Register(binarySerializer{})
+	return r
+}
+
+func (r *Registry) Register(s Serializer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.serializers[s.Name()] = s
+}
+
+func (r *Registry) Get(name string) (Serializer, error) {
+	if name == "" {
+		name = EncodingRaw
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s, exists := r.serializers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, name)
+	}
+	return s, nil
+}
+
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.serializers))
+	for name := range r.serializers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that value, as carried in CacheItem.Value, is well formed
+// for the named encoding.
+func (r *Registry) Validate(value, encoding string) error {
+	s, err := r.Get(encoding)
+	if err != nil {
+		return err
+	}
+
+	data, err := payload(s, value)
+	if err != nil {
+		return err
+	}
+	if err := s.Validate(data); err != nil {
+		return fmt.Errorf("%w (%s): %v", ErrInvalidValue, s.Name(), err)
+	}
+	return nil
+}
+
+// Transcode converts value from one encoding to another, returning it in
+// the form stored in CacheItem.Value for the target encoding.
+func (r *Registry) Transcode(value, from, to string) (string, error) {
+	src, err := r.Get(from)
+	if err != nil {
+		return "", err
+	}
+	dst, err := r.Get(to)
+	if err != nil {
+		return "", err
+	}
+	if src.Name() == dst.Name() {
+		return value, nil
+	}
+
+	data, err := payload(src, value)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := src.Decode(data)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := dst.Encode(decoded)
+	if err != nil {
+		return "", err
+	}
+
+	if dst.Binary() {
+		return base64.StdEncoding.EncodeToString(encoded), nil
+	}
+	return string(encoded), nil
+}
+
+// Bytes returns the payload value carries for the named encoding: the
+// value itself, or for binary encodings the bytes it base64-encodes.
+func (r *Registry) Bytes(value, encoding string) ([]byte, Serializer, error) {
+	s, err := r.Get(encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := payload(s, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, s, nil
+}
+
+// Size returns the length of the payload value carries for the named
+// encoding, without decoding it.
+func (r *Registry) Size(value, encoding string) (int64, error) {
+	s, err := r.Get(encoding)
+	if err != nil {
+		return 0, err
+	}
+	if !s.Binary() {
+		return int64(len(value)), nil
+	}
+	padding := len(value) - len(strings.TrimRight(value, "="))
+	return int64(len(value)/4*3 - padding), nil
+}
+
+// Range returns length bytes of the payload value carries for the named
+// encoding, from offset. Of a binary value only the base64 covering the
+// range is decoded. The range must lie within the payload.
+func (r *Registry) Range(value, encoding string, offset, length int64) ([]byte, error) {
+	s, err := r.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Binary() {
+		return []byte(value[offset : offset+length]), nil
+	}
+
+	// Each 4 characters of base64 carry 3 bytes.
+	first, last := offset/3*4, (offset+length+2)/3*4
+	if last > int64(len(value)) {
+		last = int64(len(value))
+	}
+	data, err := base64.StdEncoding.DecodeString(value[first:last])
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s): value must be base64 encoded", ErrInvalidValue, s.Name())
+	}
+	skip := offset - first/4*3
+	return data[skip : skip+length], nil
+}
+
+func payload(s Serializer, value string) ([]byte, error) {
+	if !s.Binary() {
+		return []byte(value), nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s): value must be base64 encoded", ErrInvalidValue, s.Name())
+	}
+	return data, nil
+}
+
+type rawSerializer struct{}
+
+func (rawSerializer) Name() string               { return EncodingRaw }
+func (rawSerializer) ContentType() string        { return "text/plain" }
+func (rawSerializer) Binary() bool               { return false }
+func (rawSerializer) Validate(data []byte) error { return nil }
+
+func (rawSerializer) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func (rawSerializer) Encode(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(v)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Name() string        { return EncodingJSON }
+func (jsonSerializer) ContentType() string { return "application/json" }
+func (jsonSerializer) Binary() bool        { return false }
+
+func (jsonSerializer) Validate(data []byte) error {
+	if !json.Valid(data) {
+		return errors.New("invalid JSON document")
+	}
+	return nil
+}
+
+func (jsonSerializer) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (jsonSerializer) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Name() string        { return EncodingMsgpack }
+func (msgpackSerializer) ContentType() string { return "application/msgpack" }
+func (msgpackSerializer) Binary() bool        { return true }
+
+func (s msgpackSerializer) Validate(data []byte) error {
+	_, err := s.Decode(data)
+	return err
+}
+
+func (msgpackSerializer) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (msgpackSerializer) Encode(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// protobufSerializer only checks wire-format framing: without the message
+// descriptor there is no way to decode fields, so it can't be transcoded.
+type protobufSerializer struct{}
+
+func (protobufSerializer) Name() string        { return EncodingProtobuf }
+func (protobufSerializer) ContentType() string { return "application/x-protobuf" }
+func (protobufSerializer) Binary() bool        { return true }
+
+func (protobufSerializer) Validate(data []byte) error {
+	for len(data) > 0 {
+		_, _, n := protowire.ConsumeField(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (protobufSerializer) Decode(data []byte) (interface{}, error) {
+	return nil, fmt.Errorf("%w: %s", ErrNotTranscodable, EncodingProtobuf)
+}
+
+func (protobufSerializer) Encode(v interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %s", ErrNotTranscodable, EncodingProtobuf)
+}
+
+// binarySerializer holds opaque bytes, such as images or serialized objects
+// in a format the cache doesn't know. Any payload is valid and none can be
+// transcoded.
+type binarySerializer struct{}
+
+func (binarySerializer) Name() string               { return EncodingBinary }
+func (binarySerializer) ContentType() string        { return "application/octet-stream" }
+func (binarySerializer) Binary() bool               { return true }
+func (binarySerializer) Validate(data []byte) error { return nil }
+
+func (binarySerializer) Decode(data []byte) (interface{}, error) {
+	return nil, fmt.Errorf("%w: %s", ErrNotTranscodable, EncodingBinary)
+}
+
+func (binarySerializer) Encode(v interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %s", ErrNotTranscodable, EncodingBinary)
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTranscodeRoundTrip(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		name     string
+		value    string
+		encoding string
+		via      string
+	}{
+		{"json via msgpack", `{"name":"Ada","tags":["a","b"],"age":36,"admin":false,"manager":null}`, EncodingJSON, EncodingMsgpack},
+		{"json array via msgpack", `[1,2.5,"three"]`, EncodingJSON, EncodingMsgpack},
+		{"json string via raw", `"plain"`, EncodingJSON, EncodingRaw},
+		{"raw via msgpack", "hello|world", EncodingRaw, EncodingMsgpack},
+		{"same encoding", "anything", EncodingRaw, EncodingRaw},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			there, err := r.Transcode(test.value, test.encoding, test.via)
+			if err != nil {
+				t.Fatalf("Transcode to %s: %v", test.via, err)
+			}
+			if err := r.Validate(there, test.via); err != nil {
+				t.Fatalf("Validate %s: %v", test.via, err)
+			}
+			back, err := r.Transcode(there, test.via, test.encoding)
+			if err != nil {
+				t.Fatalf("Transcode back to %s: %v", test.encoding, err)
+			}
+			if test.encoding == EncodingJSON {
+				var got, want interface{}
+				json.Unmarshal([]byte(back), &got)
+				json.Unmarshal([]byte(test.value), &want)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("round trip = %s, want %s", back, test.value)
+				}
+			} else if back != test.value {
+				t.Errorf("round trip = %q, want %q", back, test.value)
+			}
+		})
+	}
+}
+
+func TestTranscodeErrors(t *testing.T) {
+	r := NewRegistry()
+	blob := base64.StdEncoding.EncodeToString([]byte{1, 2, 3})
+	tests := []struct {
+		name     string
+		value    string
+		from, to string
+		want     error
+	}{
+		{"unknown source", "x", "yaml", EncodingJSON, ErrUnknownEncoding},
+		{"unknown target", "x", EncodingRaw, "yaml", ErrUnknownEncoding},
+		{"from binary", blob, EncodingBinary, EncodingJSON, ErrNotTranscodable},
+		{"to protobuf", `{}`, EncodingJSON, EncodingProtobuf, ErrNotTranscodable},
+		{"msgpack not base64", "!!", EncodingMsgpack, EncodingJSON, ErrInvalidValue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := r.Transcode(test.value, test.from, test.to); !errors.Is(err, test.want) {
+				t.Errorf("Transcode error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := NewRegistry()
+	encode := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name     string
+		value    string
+		encoding string
+		valid    bool
+	}{
+		{"raw anything", "{not json", EncodingRaw, true},
+		{"empty encoding is raw", "{not json", "", true},
+		{"json document", `{"a":1}`, EncodingJSON, true},
+		{"json invalid", `{"a":`, EncodingJSON, false},
+		{"msgpack map", encode([]byte{0x81, 0xa1, 'a', 0x01}), EncodingMsgpack, true},
+		{"msgpack truncated", encode([]byte{0x81, 0xa1}), EncodingMsgpack, false},
+		{"protobuf varint field", encode([]byte{0x08, 0x96, 0x01}), EncodingProtobuf, true},
+		{"protobuf truncated", encode([]byte{0x08, 0x96}), EncodingProtobuf, false},
+		{"binary anything", encode([]byte{0xff, 0x00}), EncodingBinary, true},
+		{"binary not base64", "not base64!", EncodingBinary, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := r.Validate(test.value, test.encoding)
+			if test.valid && err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("Validate error = %v, want %v", err, ErrInvalidValue)
+			}
+		})
+	}
+}
+
+func TestSizeAndRange(t *testing.T) {
+	r := NewRegistry()
+	data := []byte("0123456789abcdefghij")
+	tests := []struct {
+		name     string
+		value    string
+		encoding string
+	}{
+		{"raw", string(data), EncodingRaw},
+		{"binary", base64.StdEncoding.EncodeToString(data), EncodingBinary},
+		{"binary padded", base64.StdEncoding.EncodeToString(data[:19]), EncodingBinary},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, _, err := r.Bytes(test.value, test.encoding)
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			size, err := r.Size(test.value, test.encoding)
+			if err != nil || size != int64(len(payload)) {
+				t.Fatalf("Size = %d, %v, want %d", size, err, len(payload))
+			}
+			for offset := int64(0); offset < size; offset++ {
+				for length := int64(1); offset+length <= size; length++ {
+					got, err := r.Range(test.value, test.encoding, offset, length)
+					if err != nil {
+						t.Fatalf("Range(%d, %d): %v", offset, length, err)
+					}
+					if want := payload[offset : offset+length]; string(got) != string(want) {
+						t.Fatalf("Range(%d, %d) = %q, want %q", offset, length, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,36 +1,1052 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
 )
 
 type Config struct {
-	Region    string
-	NodeID    string
-	HTTPPort  int
-	TCPPort   int
-	Peers     []string
-	CacheSize int
+	Region   string `json:"region"`
+	NodeID   string `json:"node_id"`
+	NodeMode string `json:"node_mode"`
+	HTTPPort int    `json:"http_port"`
+	TCPPort  int    `json:"tcp_port"`
+	// HTTPListen and TCPListen are the host:port addresses each server
+	// binds, e.g. "10.0.0.4:8080" or "[::]:8080". When empty the server
+	// listens on its port on every interface. HTTPPort is still the port
+	// advertised to peers when AdvertiseURL is unset.
+	HTTPListen []string `json:"http_listen"`
+	TCPListen  []string `json:"tcp_listen"`
+	// TCPAcceptors above 1 opens that many SO_REUSEPORT listeners per
+	// TCP address, each with its own accept loop (Linux only).
+	TCPAcceptors int `json:"tcp_acceptors"`
+	// AdvertiseURL is the HTTP base URL peers and SDK clients use to
+	// reach this node. When empty peers derive it from the TCP address.
+	AdvertiseURL string   `json:"advertise_url"`
+	Peers        []string `json:"peers"`
+	// PeerDial sets how peers are dialed, keyed by peer address; the "*"
+	// entry applies to peers without one of their own.
+	PeerDial  map[string]PeerDialConfig `json:"peer_dial"`
+	CacheSize int                       `json:"cache_size"`
+	// MaxMemoryBytes bounds the approximate size of the cached items;
+	// zero leaves only CacheSize.
+	MaxMemoryBytes int `json:"max_memory_bytes"`
+	// MaxValueBytes bounds each value as stored, binary values encoded,
+	// so that every item fits a line of the peer protocol.
+	MaxValueBytes int `json:"max_value_bytes"`
+	// DedupValues stores values that several keys hold once, counting
+	// them once against MaxMemoryBytes.
+	DedupValues bool `json:"dedup_values"`
+	// ExpirySweepIntervalMS is how often expired items are removed; zero
+	// leaves them in memory, hidden from reads, until overwritten.
+	ExpirySweepIntervalMS int `json:"expiry_sweep_interval_ms"`
+	// InvariantCheckIntervalMS, if not zero, checks the cache's internal
+	// invariants this often and stops the node if any is violated. It is
+	// meant for tests and staging.
+	InvariantCheckIntervalMS int                        `json:"invariant_check_interval_ms"`
+	Schemas                  map[string]json.RawMessage `json:"schemas"`
+	Hooks                    []HookConfig               `json:"hooks"`
+	KeyPolicy                KeyPolicyConfig            `json:"key_policy"`
+
+	Federation  FederationConfig  `json:"federation"`
+	Replication ReplicationConfig `json:"replication"`
+	Placement   PlacementConfig   `json:"placement"`
+	Failover    FailoverConfig    `json:"failover"`
+	Partition   PartitionConfig   `json:"partition"`
+	Socket      SocketConfig      `json:"socket"`
+	Shutdown    ShutdownConfig    `json:"shutdown"`
+	Events      EventsConfig      `json:"events"`
+	History     HistoryConfig     `json:"history"`
+	HotKeys     HotKeysConfig     `json:"hot_keys"`
+	Logging     LoggingConfig     `json:"logging"`
+	Cost        CostConfig        `json:"cost"`
+	Simulation  SimulationConfig  `json:"simulation"`
+	SQLServer   SQLServerConfig   `json:"sqlserver"`
+	Licensing   LicensingConfig   `json:"licensing"`
+	Datasets    DatasetsConfig    `json:"datasets"`
+	Progress    ProgressConfig    `json:"progress"`
+	Locks       LocksConfig       `json:"locks"`
+	Edge        EdgeConfig        `json:"edge"`
+	Namespaces  NamespacesConfig  `json:"namespaces"`
+	Analytics   AnalyticsConfig   `json:"analytics"`
+	ChangeFeed  ChangeFeedConfig  `json:"change_feed"`
+	Ingest      IngestConfig      `json:"ingest"`
+
+	UDFMemoryPages int `json:"udf_memory_pages"`
+	UDFTimeoutMS   int `json:"udf_timeout_ms"`
+
+	DerivedCacheSize int `json:"derived_cache_size"`
+
+	Features map[string]bool `json:"features"`
+
+	// PanicWebhookURL receives a JSON report of every panic recovered in
+	// a request handler or connection goroutine.
+	PanicWebhookURL string `json:"panic_webhook_url"`
+
+	BackupDir    string `json:"backup_dir"`
+	EventLogPath string `json:"event_log_path"`
+	// EventLogFsync makes writes wait until their event log entry is
+	// fsynced. Entries are synced in groups at most
+	// EventLogGroupCommitMS after the first waiting write.
+	EventLogFsync         bool `json:"event_log_fsync"`
+	EventLogGroupCommitMS int  `json:"event_log_group_commit_ms"`
+	// WarmupFile is a JSON or NDJSON file of entries the node caches on
+	// startup, before it serves requests.
+	WarmupFile string `json:"warmup_file"`
+	// SnapshotPath is a file the node saves its cache to every
+	// SnapshotIntervalMS, zero for only on request and on shutdown, and
+	// restores it from on startup.
+	SnapshotPath       string `json:"snapshot_path"`
+	SnapshotIntervalMS int    `json:"snapshot_interval_ms"`
+}
+
+// PeerDialConfig routes connections to a peer through a proxy and TLS,
+// for regions whose egress only allows those. Proxy is an http:// (HTTP
+// CONNECT) or socks5:// URL; credentials in it are sent to the proxy.
+// With TLS the connection to the peer's address is wrapped in TLS, for
+// peers reached through a TLS-terminating gateway in front of their TCP
+// port. ServerName overrides the name sent as SNI and checked against the
+// gateway's certificate, which defaults to the host in the peer's address,
+// and CAFile replaces the system roots with a PEM bundle.
+type PeerDialConfig struct {
+	Proxy      string `json:"proxy"`
+	TLS        bool   `json:"tls"`
+	ServerName string `json:"server_name"`
+	CAFile     string `json:"ca_file"`
+}
+
+type KeyPolicyConfig struct {
+	MaxLength        int      `json:"max_length"`
+	Pattern          string   `json:"pattern"`
+	RequiredPrefixes []string `json:"required_prefixes"`
+	RequireTenant    bool     `json:"require_tenant"`
+	RejectURLUnsafe  bool     `json:"reject_url_unsafe"`
+}
+
+type FederationConfig struct {
+	Role            string   `json:"role"`
+	RemoteURL       string   `json:"remote_url"`
+	Token           string   `json:"token"`
+	Prefixes        []string `json:"prefixes"`
+	BatchSize       int      `json:"batch_size"`
+	FlushIntervalMS int      `json:"flush_interval_ms"`
+	MaxPending      int      `json:"max_pending"`
+}
+
+type ReplicationConfig struct {
+	// Relay forwards updates received from one peer to the other peers,
+	// for clusters where not every pair of nodes is linked.
+	Relay   bool `json:"relay"`
+	MaxHops int  `json:"max_hops"`
+
+	// SyncIntervalMS paces reconnecting to peers, HealthIntervalMS pinging
+	// them. When Adaptive, both loops back off towards MaxIntervalMS while
+	// the cluster is stable and drop to MinIntervalMS on churn.
+	SyncIntervalMS   int  `json:"sync_interval_ms"`
+	HealthIntervalMS int  `json:"health_interval_ms"`
+	Adaptive         bool `json:"adaptive"`
+	MinIntervalMS    int  `json:"min_interval_ms"`
+	MaxIntervalMS    int  `json:"max_interval_ms"`
+
+	// Compression lists the frame compression offered to and accepted
+	// from peers, most preferred first; empty disables it. Frames shorter
+	// than CompressMinBytes are always sent as is.
+	Compression      []string `json:"compression"`
+	CompressMinBytes int      `json:"compress_min_bytes"`
+
+	// Acks is how many of a key's replicas must acknowledge a local write
+	// before it returns: "none" (fire-and-forget), "quorum" (with this
+	// node, a majority of the key's copies) or "all". PrefixAcks overrides
+	// it for keys starting with a prefix, the longest matching prefix
+	// winning. A write not acknowledged within AckTimeoutMS fails, though
+	// it stays applied here and still reaches the other replicas.
+	Acks         string            `json:"acks"`
+	PrefixAcks   map[string]string `json:"prefix_acks"`
+	AckTimeoutMS int               `json:"ack_timeout_ms"`
+
+	// CoalesceMS, when positive, replicates keys under CoalescePrefixes
+	// (every key if empty) at most once per interval, latest value wins.
+	CoalesceMS       int      `json:"coalesce_ms"`
+	CoalescePrefixes []string `json:"coalesce_prefixes"`
+
+	// LocalNamespaces lists namespaces whose keys stay on the node they
+	// are written on.
+	LocalNamespaces []string `json:"local_namespaces"`
+
+	// DigestMinBytes, when positive, sends values at least this long to
+	// peers as a digest first, and in full only if they don't hold them.
+	DigestMinBytes int `json:"digest_min_bytes"`
+}
+
+// Replication ack levels.
+const (
+	AcksNone   = "none"
+	AcksQuorum = "quorum"
+	AcksAll    = "all"
+)
+
+// PlacementConfig controls which nodes hold a key. In "full" mode (the
+// default) every node holds every key. In "partitioned" mode each key is
+// replicated only to the ReplicationFactor linked nodes the hash ring
+// picks for it, and when nodes join or leave, each node hands the keys it
+// holds over to their new owners once membership has been stable for
+// RebalanceSettleMS, at most RebalanceKeysPerSec keys a second. With
+// RebalanceRelease a node drops keys it no longer owns after handing them
+// over.
+//
+// VNodes is the number of ring points per node of weight 1 and must be the
+// same on every node. Weight is this node's: a node of weight 2 gets twice
+// the points, and so twice the share of the keyspace, of a node of weight 1.
+//
+// Zone is this node's availability zone. SpreadBy ("zone", "region" or
+// "none") names the failure domain a key's replicas are spread across: a
+// second copy never goes to the owner's domain while another domain has a
+// node available.
+//
+// Group names the node group this node belongs to. PrefixGroups
+// dedicates keys to groups by prefix: keys starting with a prefix (the
+// longest that matches) are held, in either mode, only by the nodes of
+// its group, and other nodes refuse to write them. Keys no prefix matches
+// go on every node as usual.
+//
+// With RemoteReads a read that misses here is served by a peer that should
+// hold the key, picked by ReadPolicy: "nearest" (lowest ping round trip)
+// or "random".
+type PlacementConfig struct {
+	Mode                string            `json:"mode"`
+	ReplicationFactor   int               `json:"replication_factor"`
+	VNodes              int               `json:"vnodes"`
+	Weight              float64           `json:"weight"`
+	Zone                string            `json:"zone"`
+	SpreadBy            string            `json:"spread_by"`
+	RebalanceAuto       bool              `json:"rebalance_auto"`
+	RebalanceKeysPerSec int               `json:"rebalance_keys_per_sec"`
+	RebalanceSettleMS   int               `json:"rebalance_settle_ms"`
+	RebalanceRelease    bool              `json:"rebalance_release"`
+	Group               string            `json:"group"`
+	PrefixGroups        map[string]string `json:"prefix_groups"`
+	RemoteReads         bool              `json:"remote_reads"`
+	ReadPolicy          string            `json:"read_policy"`
+}
+
+// Node modes. A witness joins the cluster, counts towards quorum and can
+// lead failover, but is left off the hash ring, receives no replication
+// and refuses cache requests, so it can break ties between two regions
+// from a third without holding any data. A standby is also left off the
+// ring and refuses cache requests, but receives every update, so it can
+// be promoted to a data node with a full copy when its region takes over.
+const (
+	NodeModeData    = "data"
+	NodeModeWitness = "witness"
+	NodeModeStandby = "standby"
+)
+
+// FailoverConfig controls automatic failover in partitioned placement: the
+// leader declares a node dead, handing its keys to their replicas, once no
+// node has been linked to it for DeadAfterMS. 0 disables failover. With
+// Quorum the leader only decides while it is linked to a majority of the
+// cluster, counting itself and witnesses, so the smaller side of a split
+// never fails the larger one over.
+type FailoverConfig struct {
+	DeadAfterMS int  `json:"dead_after_ms"`
+	Quorum      bool `json:"quorum"`
+}
+
+// PartitionConfig controls degraded mode. A node is degraded while it is
+// not linked to at least DegradedFraction of its known peers (0 disables
+// degraded mode); it keeps serving reads but flags them as possibly stale
+// and, with RejectWrites, refuses writes it could not replicate.
+type PartitionConfig struct {
+	DegradedFraction float64 `json:"degraded_fraction"`
+	RejectWrites     bool    `json:"reject_writes"`
+}
+
+// SocketConfig tunes the TCP connections between peers, on both the
+// dialing and the accepting side. KeepAliveMS is the interval between TCP
+// keepalive probes on idle connections, which stops firewalls and NATs on
+// the path from dropping quiet cross-region links without telling either
+// end; 0 disables keepalives. NoDelay disables Nagle's algorithm. Zero
+// buffer sizes leave the kernel's defaults.
+type SocketConfig struct {
+	KeepAliveMS      int  `json:"keepalive_ms"`
+	NoDelay          bool `json:"nodelay"`
+	ReadBufferBytes  int  `json:"read_buffer_bytes"`
+	WriteBufferBytes int  `json:"write_buffer_bytes"`
+}
+
+// ShutdownConfig budgets a graceful shutdown. On SIGTERM the node stops
+// accepting connections, then gives in-flight HTTP requests up to
+// DrainHTTPMS to finish, pending federation batches up to
+// FlushReplicationMS to reach the remote cluster, and, when SnapshotMS is
+// positive, up to SnapshotMS to write a checkpoint of its data. Whatever
+// is still running when TotalMS has passed since the signal is cut off
+// and the process exits.
+type ShutdownConfig struct {
+	DrainHTTPMS        int `json:"drain_http_ms"`
+	FlushReplicationMS int `json:"flush_replication_ms"`
+	SnapshotMS         int `json:"snapshot_ms"`
+	TotalMS            int `json:"total_ms"`
+}
+
+// EventsConfig controls the event journal: the last Capacity significant
+// events are kept in memory and written to DumpDir if the process panics
+// or receives SIGQUIT.
+type EventsConfig struct {
+	Capacity int    `json:"capacity"`
+	DumpDir  string `json:"dump_dir"`
+}
+
+// HistoryConfig controls item history, which keeps overwritten and
+// deleted versions for time-travel reads. A zero RetentionMS disables it.
+type HistoryConfig struct {
+	RetentionMS int `json:"retention_ms"`
+	MaxVersions int `json:"max_versions"`
+}
+
+// HotKeysConfig controls the hot-key report, which counts reads of each
+// key over the last WindowMS, for up to MaxKeys distinct keys at a time.
+// A zero WindowMS disables it.
+type HotKeysConfig struct {
+	WindowMS int `json:"window_ms"`
+	MaxKeys  int `json:"max_keys"`
+}
+
+// LoggingConfig controls log deduplication. Each subsystem writes every
+// distinct message at most once per interval and at most Budget distinct
+// messages per interval; Budgets overrides Budget per subsystem.
+type LoggingConfig struct {
+	IntervalMS int            `json:"interval_ms"`
+	Budget     int            `json:"budget"`
+	Budgets    map[string]int `json:"budgets"`
+}
+
+// CostConfig prices replication egress for cost estimates. EgressPerGB
+// maps "from:to" region pairs to the price of a GB sent from one to the
+// other; "from:*" covers every other destination of a region and "*"
+// every other pair. Traffic within a region is free unless its pair is
+// listed.
+type CostConfig struct {
+	Currency    string             `json:"currency"`
+	EgressPerGB map[string]float64 `json:"egress_per_gb"`
+}
+
+// SQLServerConfig enables caching the results of SQL Server queries,
+// which are run against DSN on a miss and kept for CacheTTLSeconds unless
+// the query asks for another TTL. A query is given QueryTimeoutMS to run
+// and may return at most MaxRows rows. WatchTables are polled every
+// WatchIntervalMS, and a change to one invalidates the cached results of
+// the queries that read it. A table is watched through change tracking,
+// or, given as table:column, through its row count and the largest value
+// of a rowversion column.
+type SQLServerConfig struct {
+	DSN             string   `json:"dsn"`
+	CacheTTLSeconds int      `json:"cache_ttl_seconds"`
+	QueryTimeoutMS  int      `json:"query_timeout_ms"`
+	MaxRows         int      `json:"max_rows"`
+	WatchTables     []string `json:"watch_tables"`
+	WatchIntervalMS int      `json:"watch_interval_ms"`
+}
+
+// LicensingConfig configures the licensing cost calculation cache.
+// Calculations are priced with the pricing sheet stored under PricingKey,
+// and a change to that key drops every cached result. Results are kept
+// for CacheTTLSeconds unless the sheet sets its own result TTL.
+type LicensingConfig struct {
+	PricingKey      string `json:"pricing_key"`
+	CacheTTLSeconds int    `json:"cache_ttl_seconds"`
+}
+
+// ProgressConfig configures learner progress storage. A learner's
+// progress expires TTLSeconds after it was last read or updated, and
+// keeps the MaxAttempts latest attempts of each quiz.
+type ProgressConfig struct {
+	TTLSeconds  int `json:"ttl_seconds"`
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// LocksConfig configures distributed locks. A lease lasts DefaultTTLMS
+// unless it is acquired for another TTL, which may be at most MaxTTLMS.
+type LocksConfig struct {
+	DefaultTTLMS int `json:"default_ttl_ms"`
+	MaxTTLMS     int `json:"max_ttl_ms"`
+}
+
+// EdgeConfig enables serving the frontend bundle from the cache. Assets
+// are fetched from Origin, in which {version} stands for the deploy
+// version, starting with DeployVersion. Those whose path matches
+// ImmutablePattern are cached for ImmutableTTLSeconds and served as
+// immutable, the others for TTLSeconds. Paths without an extension the
+// origin doesn't have are served Fallback.
+type EdgeConfig struct {
+	Origin              string `json:"origin"`
+	DeployVersion       string `json:"deploy_version"`
+	ImmutablePattern    string `json:"immutable_pattern"`
+	TTLSeconds          int    `json:"ttl_seconds"`
+	ImmutableTTLSeconds int    `json:"immutable_ttl_seconds"`
+	Fallback            string `json:"fallback"`
+	MaxAssetBytes       int    `json:"max_asset_bytes"`
+	TimeoutMS           int    `json:"timeout_ms"`
+}
+
+// NamespacesConfig configures the teardown of time-boxed namespaces:
+// every TeardownIntervalMS the node purges those whose lifetime is over
+// and archives their stats as a report in ReportDir.
+type NamespacesConfig struct {
+	TeardownIntervalMS int    `json:"teardown_interval_ms"`
+	ReportDir          string `json:"report_dir"`
+}
+
+// AnalyticsConfig enables the usage analytics stream for course authors. A
+// share of API requests, SampleRate, is recorded as anonymous events,
+// without keys, values or client addresses, and sent to Sink: "file"
+// appends JSON lines to Path, "webhook" posts JSON arrays to URL and
+// "eventhubs" sends to the Event Hub of ConnectionString. Events are sent
+// every FlushIntervalMS, BatchSize at a time; at most MaxPending wait,
+// beyond which the oldest are dropped. Requests in OptOutNamespaces, or
+// with DNT: 1 or X-Analytics-Opt-Out: true, are never recorded. With
+// NamespaceSalt, namespaces are recorded as a keyed hash.
+type AnalyticsConfig struct {
+	Sink             string   `json:"sink"`
+	Path             string   `json:"path"`
+	URL              string   `json:"url"`
+	ConnectionString string   `json:"connection_string"`
+	SampleRate       float64  `json:"sample_rate"`
+	BatchSize        int      `json:"batch_size"`
+	FlushIntervalMS  int      `json:"flush_interval_ms"`
+	MaxPending       int      `json:"max_pending"`
+	OptOutNamespaces []string `json:"opt_out_namespaces"`
+	NamespaceSalt    string   `json:"namespace_salt"`
+}
+
+// ChangeFeedConfig publishes the writes and deletes made on this node to
+// Broker: "eventhubs" sends them to the Event Hub of ConnectionString,
+// "kafka" produces them to Topic through the Kafka REST Proxy at
+// KafkaRESTURL. Changes are keyed by cache key, so each key's stay in
+// order. Only keys under Prefixes are published, every key if there are
+// none, and values only with IncludeValues. Changes are sent every
+// FlushIntervalMS, BatchSize at a time, and a batch that fails is retried
+// before any later change is sent; at most MaxPending wait, beyond which
+// the oldest are dropped.
+type ChangeFeedConfig struct {
+	Broker           string   `json:"broker"`
+	ConnectionString string   `json:"connection_string"`
+	KafkaRESTURL     string   `json:"kafka_rest_url"`
+	Topic            string   `json:"topic"`
+	Prefixes         []string `json:"prefixes"`
+	IncludeValues    bool     `json:"include_values"`
+	BatchSize        int      `json:"batch_size"`
+	FlushIntervalMS  int      `json:"flush_interval_ms"`
+	MaxPending       int      `json:"max_pending"`
+}
+
+// IngestConfig consumes Topics through the Kafka REST Proxy at
+// KafkaRESTURL into the cache. Each node consumes every message itself,
+// in the consumer group Group followed by its node ID, and stores it on
+// itself only. PollIntervalMS is the wait after a fetch that returned no
+// messages.
+type IngestConfig struct {
+	KafkaRESTURL   string        `json:"kafka_rest_url"`
+	Group          string        `json:"group"`
+	Topics         []IngestTopic `json:"topics"`
+	PollIntervalMS int           `json:"poll_interval_ms"`
+}
+
+// IngestTopic is how the messages of Topic are stored. A message's key is
+// KeyPrefix followed by the KeyField of its JSON value, a dotted path
+// into nested objects, or by the message's own key without KeyField. It
+// expires after the seconds in its TTLField, or TTLSeconds if it has
+// none, zero for never. A message with a null value deletes KeyPrefix
+// followed by its own key.
+type IngestTopic struct {
+	Topic      string `json:"topic"`
+	KeyField   string `json:"key_field"`
+	KeyPrefix  string `json:"key_prefix"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+	TTLField   string `json:"ttl_field"`
+}
+
+// DatasetsConfig enables signed reference datasets. TrustedKeys maps a
+// key ID to a base64 Ed25519 public key; datasets signed by any of them
+// are accepted. With SigningKey, a base64 Ed25519 seed or private key,
+// the node signs datasets published to it without a signature itself, as
+// SigningKeyID, and trusts that key too.
+type DatasetsConfig struct {
+	TrustedKeys  map[string]string `json:"trusted_keys"`
+	SigningKey   string            `json:"signing_key"`
+	SigningKeyID string            `json:"signing_key_id"`
+}
+
+// Enabled reports whether any key is configured.
+func (c DatasetsConfig) Enabled() bool {
+	return len(c.TrustedKeys) > 0 || c.SigningKey != ""
+}
+
+// SimulationConfig makes the replication links to peers behave like WAN
+// links, for demonstrating the effect of distance on convergence without
+// multi-region infrastructure. WAN maps a peer's node ID or region, or
+// "*" for every other peer, to the conditions of frames sent to it.
+type SimulationConfig struct {
+	WAN map[string]WANConditions `json:"wan"`
+}
+
+// WANConditions delays each frame by LatencyMS, give or take up to
+// JitterMS, and drops LossPercent of them.
+type WANConditions struct {
+	LatencyMS   int     `json:"latency_ms"`
+	JitterMS    int     `json:"jitter_ms"`
+	LossPercent float64 `json:"loss_percent"`
+}
+
+type HookConfig struct {
+	Prefix string            `json:"prefix"`
+	Name   string            `json:"name"`
+	Args   map[string]string `json:"args"`
 }
 
 func Load() (*Config, error) {
-	cfg := &Config{
-		Region:    getEnv("REGION", "us-east-1"),
-		NodeID:    getEnv("NODE_ID", "node-1"),
-		HTTPPort:  getEnvInt("HTTP_PORT", 8080),
-		TCPPort:   getEnvInt("TCP_PORT", 9090),
-		CacheSize: getEnvInt("CACHE_SIZE", 1000),
+	return LoadFrom(os.Getenv("CONFIG_FILE"))
+}
+
+// Defaults returns the built-in configuration, before any config file
+// or environment variable is applied.
+func Defaults() *Config {
+	return &Config{
+		Region:                "us-east-1",
+		NodeID:                "node-1",
+		NodeMode:              NodeModeData,
+		HTTPPort:              8080,
+		TCPPort:               9090,
+		TCPAcceptors:          1,
+		CacheSize:             1000,
+		MaxValueBytes:         32 << 20,
+		ExpirySweepIntervalMS: 1000,
+		KeyPolicy: KeyPolicyConfig{
+			MaxLength: 512,
+		},
+
+		Federation: FederationConfig{
+			BatchSize:       100,
+			FlushIntervalMS: 1000,
+			MaxPending:      100000,
+		},
+		Replication: ReplicationConfig{
+			MaxHops:          4,
+			SyncIntervalMS:   30000,
+			HealthIntervalMS: 10000,
+			MinIntervalMS:    2000,
+			MaxIntervalMS:    300000,
+			Compression:      []string{"zstd", "snappy"},
+			CompressMinBytes: 1024,
+			Acks:             "none",
+			AckTimeoutMS:     2000,
+		},
+		Placement: PlacementConfig{
+			Mode:                "full",
+			ReplicationFactor:   2,
+			VNodes:              64,
+			Weight:              1,
+			SpreadBy:            "zone",
+			RebalanceAuto:       true,
+			RebalanceKeysPerSec: 1000,
+			RebalanceSettleMS:   5000,
+			ReadPolicy:          "nearest",
+		},
+		Failover: FailoverConfig{
+			DeadAfterMS: 15000,
+			Quorum:      true,
+		},
+		Partition: PartitionConfig{
+			DegradedFraction: 0.5,
+		},
+		Socket: SocketConfig{
+			KeepAliveMS: 15000,
+			NoDelay:     true,
+		},
+		Shutdown: ShutdownConfig{
+			DrainHTTPMS:        20000,
+			FlushReplicationMS: 5000,
+			TotalMS:            30000,
+		},
+		Events: EventsConfig{
+			Capacity: 1000,
+			DumpDir:  "./dumps",
+		},
+		History: HistoryConfig{
+			MaxVersions: 16,
+		},
+		HotKeys: HotKeysConfig{
+			WindowMS: 300000,
+			MaxKeys:  10000,
+		},
+		Logging: LoggingConfig{
+			IntervalMS: 10000,
+			Budget:     20,
+		},
+		Cost: CostConfig{
+			Currency:    "USD",
+			EgressPerGB: map[string]float64{"*": 0.02},
+		},
+		SQLServer: SQLServerConfig{
+			CacheTTLSeconds: 300,
+			QueryTimeoutMS:  5000,
+			MaxRows:         10000,
+			WatchIntervalMS: 5000,
+		},
+		Licensing: LicensingConfig{
+			PricingKey:      "licensing-pricing",
+			CacheTTLSeconds: 3600,
+		},
+		Progress: ProgressConfig{
+			TTLSeconds:  30 * 24 * 3600,
+			MaxAttempts: 20,
+		},
+		Locks: LocksConfig{
+			DefaultTTLMS: 30000,
+			MaxTTLMS:     600000,
+		},
+		Edge: EdgeConfig{
+			DeployVersion: "default",
+			// Vite's build output: assets/<name>-<hash>.<ext>.
+			ImmutablePattern:    `^assets/.+[.-][0-9A-Za-z_-]{8,}\.[0-9A-Za-z]+$`,
+			TTLSeconds:          300,
+			ImmutableTTLSeconds: 7 * 24 * 3600,
+			Fallback:            "index.html",
+			MaxAssetBytes:       16 << 20,
+			TimeoutMS:           10000,
+		},
+		Namespaces: NamespacesConfig{
+			TeardownIntervalMS: 10000,
+			ReportDir:          "./reports",
+		},
+		Analytics: AnalyticsConfig{
+			Path:            "./analytics.jsonl",
+			SampleRate:      1,
+			BatchSize:       100,
+			FlushIntervalMS: 5000,
+			MaxPending:      10000,
+		},
+		ChangeFeed: ChangeFeedConfig{
+			BatchSize:       100,
+			FlushIntervalMS: 1000,
+			MaxPending:      100000,
+		},
+		Ingest: IngestConfig{
+			Group:          "cache-sidecar",
+			PollIntervalMS: 1000,
+		},
+
+		UDFMemoryPages: 256,
+		UDFTimeoutMS:   1000,
+
+		DerivedCacheSize: 256,
+
+		BackupDir:             "./backups",
+		EventLogGroupCommitMS: 5,
+		SnapshotIntervalMS:    60000,
 	}
+}
+
+// LoadFrom is Load with an explicit config file path instead of
+// CONFIG_FILE. An empty path loads the defaults and environment only.
+func LoadFrom(path string) (*Config, error) {
+	cfg := Defaults()
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Region = getEnv("REGION", cfg.Region)
+	cfg.NodeID = getEnv("NODE_ID", cfg.NodeID)
+	cfg.NodeMode = getEnv("NODE_MODE", cfg.NodeMode)
+	cfg.HTTPPort = getEnvInt("HTTP_PORT", cfg.HTTPPort)
+	cfg.TCPPort = getEnvInt("TCP_PORT", cfg.TCPPort)
+	cfg.TCPAcceptors = getEnvInt("TCP_ACCEPTORS", cfg.TCPAcceptors)
+	cfg.AdvertiseURL = getEnv("ADVERTISE_URL", cfg.AdvertiseURL)
+	cfg.CacheSize = getEnvInt("CACHE_SIZE", cfg.CacheSize)
+	cfg.MaxMemoryBytes = getEnvInt("MAX_MEMORY_BYTES", cfg.MaxMemoryBytes)
+	cfg.MaxValueBytes = getEnvInt("MAX_VALUE_BYTES", cfg.MaxValueBytes)
+	cfg.DedupValues = getEnvBool("DEDUP_VALUES", cfg.DedupValues)
+	cfg.ExpirySweepIntervalMS = getEnvInt("EXPIRY_SWEEP_INTERVAL_MS", cfg.ExpirySweepIntervalMS)
+	cfg.InvariantCheckIntervalMS = getEnvInt("INVARIANT_CHECK_INTERVAL_MS", cfg.InvariantCheckIntervalMS)
+	cfg.UDFMemoryPages = getEnvInt("UDF_MEMORY_PAGES", cfg.UDFMemoryPages)
+	cfg.UDFTimeoutMS = getEnvInt("UDF_TIMEOUT_MS", cfg.UDFTimeoutMS)
+	cfg.DerivedCacheSize = getEnvInt("DERIVED_CACHE_SIZE", cfg.DerivedCacheSize)
+	cfg.PanicWebhookURL = getEnv("PANIC_WEBHOOK_URL", cfg.PanicWebhookURL)
+	cfg.BackupDir = getEnv("BACKUP_DIR", cfg.BackupDir)
+	cfg.EventLogPath = getEnv("EVENT_LOG_PATH", cfg.EventLogPath)
+	cfg.EventLogFsync = getEnvBool("EVENT_LOG_FSYNC", cfg.EventLogFsync)
+	cfg.EventLogGroupCommitMS = getEnvInt("EVENT_LOG_GROUP_COMMIT_MS", cfg.EventLogGroupCommitMS)
+	cfg.WarmupFile = getEnv("WARMUP_FILE", cfg.WarmupFile)
+	cfg.SnapshotPath = getEnv("SNAPSHOT_PATH", cfg.SnapshotPath)
+	cfg.SnapshotIntervalMS = getEnvInt("SNAPSHOT_INTERVAL_MS", cfg.SnapshotIntervalMS)
+
+	cfg.KeyPolicy.MaxLength = getEnvInt("KEY_MAX_LENGTH", cfg.KeyPolicy.MaxLength)
+	cfg.KeyPolicy.Pattern = getEnv("KEY_PATTERN", cfg.KeyPolicy.Pattern)
+	cfg.KeyPolicy.RequireTenant = getEnvBool("KEY_REQUIRE_TENANT", cfg.KeyPolicy.RequireTenant)
+	cfg.KeyPolicy.RejectURLUnsafe = getEnvBool("KEY_REJECT_URL_UNSAFE", cfg.KeyPolicy.RejectURLUnsafe)
+
+	cfg.Federation.Role = getEnv("FEDERATION_ROLE", cfg.Federation.Role)
+	cfg.Federation.RemoteURL = getEnv("FEDERATION_REMOTE_URL", cfg.Federation.RemoteURL)
+	cfg.Federation.Token = getEnv("FEDERATION_TOKEN", cfg.Federation.Token)
+	cfg.Replication.Relay = getEnvBool("REPLICATION_RELAY", cfg.Replication.Relay)
+	cfg.Replication.MaxHops = getEnvInt("REPLICATION_MAX_HOPS", cfg.Replication.MaxHops)
+	cfg.Replication.SyncIntervalMS = getEnvInt("SYNC_INTERVAL_MS", cfg.Replication.SyncIntervalMS)
+	cfg.Replication.HealthIntervalMS = getEnvInt("HEALTH_INTERVAL_MS", cfg.Replication.HealthIntervalMS)
+	cfg.Replication.Adaptive = getEnvBool("ADAPTIVE_SYNC", cfg.Replication.Adaptive)
+	cfg.Replication.MinIntervalMS = getEnvInt("SYNC_MIN_INTERVAL_MS", cfg.Replication.MinIntervalMS)
+	cfg.Replication.MaxIntervalMS = getEnvInt("SYNC_MAX_INTERVAL_MS", cfg.Replication.MaxIntervalMS)
+	if compression, ok := os.LookupEnv("REPLICATION_COMPRESSION"); ok {
+		cfg.Replication.Compression = nil
+		for _, name := range strings.Split(compression, ",") {
+			if name = strings.TrimSpace(name); name != "" && name != "none" {
+				cfg.Replication.Compression = append(cfg.Replication.Compression, name)
+			}
+		}
+	}
+	cfg.Replication.CompressMinBytes = getEnvInt("REPLICATION_COMPRESS_MIN_BYTES", cfg.Replication.CompressMinBytes)
+	cfg.Replication.Acks = getEnv("REPLICATION_ACKS", cfg.Replication.Acks)
+	cfg.Replication.AckTimeoutMS = getEnvInt("REPLICATION_ACK_TIMEOUT_MS", cfg.Replication.AckTimeoutMS)
+	cfg.Replication.CoalesceMS = getEnvInt("REPLICATION_COALESCE_MS", cfg.Replication.CoalesceMS)
+	if prefixesEnv := os.Getenv("REPLICATION_COALESCE_PREFIXES"); prefixesEnv != "" {
+		cfg.Replication.CoalescePrefixes = strings.Split(prefixesEnv, ",")
+	}
+	if namespacesEnv := os.Getenv("REPLICATION_LOCAL_NAMESPACES"); namespacesEnv != "" {
+		cfg.Replication.LocalNamespaces = strings.Split(namespacesEnv, ",")
+	}
+	cfg.Replication.DigestMinBytes = getEnvInt("REPLICATION_DIGEST_MIN_BYTES", cfg.Replication.DigestMinBytes)
+	cfg.Placement.Mode = getEnv("PLACEMENT_MODE", cfg.Placement.Mode)
+	cfg.Placement.ReplicationFactor = getEnvInt("REPLICATION_FACTOR", cfg.Placement.ReplicationFactor)
+	cfg.Placement.VNodes = getEnvInt("RING_VNODES", cfg.Placement.VNodes)
+	cfg.Placement.Weight = getEnvFloat("NODE_WEIGHT", cfg.Placement.Weight)
+	cfg.Placement.Zone = getEnv("ZONE", cfg.Placement.Zone)
+	cfg.Placement.SpreadBy = getEnv("PLACEMENT_SPREAD_BY", cfg.Placement.SpreadBy)
+	cfg.Placement.RebalanceAuto = getEnvBool("REBALANCE_AUTO", cfg.Placement.RebalanceAuto)
+	cfg.Placement.RebalanceKeysPerSec = getEnvInt("REBALANCE_KEYS_PER_SEC", cfg.Placement.RebalanceKeysPerSec)
+	cfg.Placement.RebalanceSettleMS = getEnvInt("REBALANCE_SETTLE_MS", cfg.Placement.RebalanceSettleMS)
+	cfg.Placement.RebalanceRelease = getEnvBool("REBALANCE_RELEASE", cfg.Placement.RebalanceRelease)
+	cfg.Placement.Group = getEnv("NODE_GROUP", cfg.Placement.Group)
+	cfg.Placement.RemoteReads = getEnvBool("PLACEMENT_REMOTE_READS", cfg.Placement.RemoteReads)
+	cfg.Placement.ReadPolicy = getEnv("PLACEMENT_READ_POLICY", cfg.Placement.ReadPolicy)
+	cfg.Failover.DeadAfterMS = getEnvInt("FAILOVER_DEAD_AFTER_MS", cfg.Failover.DeadAfterMS)
+	cfg.Failover.Quorum = getEnvBool("FAILOVER_QUORUM", cfg.Failover.Quorum)
+	cfg.Partition.DegradedFraction = getEnvFloat("PARTITION_DEGRADED_FRACTION", cfg.Partition.DegradedFraction)
+	cfg.Partition.RejectWrites = getEnvBool("PARTITION_REJECT_WRITES", cfg.Partition.RejectWrites)
+	cfg.Socket.KeepAliveMS = getEnvInt("TCP_KEEPALIVE_MS", cfg.Socket.KeepAliveMS)
+	cfg.Socket.NoDelay = getEnvBool("TCP_NODELAY", cfg.Socket.NoDelay)
+	cfg.Socket.ReadBufferBytes = getEnvInt("TCP_READ_BUFFER_BYTES", cfg.Socket.ReadBufferBytes)
+	cfg.Socket.WriteBufferBytes = getEnvInt("TCP_WRITE_BUFFER_BYTES", cfg.Socket.WriteBufferBytes)
+	cfg.Shutdown.DrainHTTPMS = getEnvInt("SHUTDOWN_DRAIN_HTTP_MS", cfg.Shutdown.DrainHTTPMS)
+	cfg.Shutdown.FlushReplicationMS = getEnvInt("SHUTDOWN_FLUSH_REPLICATION_MS", cfg.Shutdown.FlushReplicationMS)
+	cfg.Shutdown.SnapshotMS = getEnvInt("SHUTDOWN_SNAPSHOT_MS", cfg.Shutdown.SnapshotMS)
+	cfg.Shutdown.TotalMS = getEnvInt("SHUTDOWN_TOTAL_MS", cfg.Shutdown.TotalMS)
+	cfg.Events.Capacity = getEnvInt("EVENTS_CAPACITY", cfg.Events.Capacity)
+	cfg.Events.DumpDir = getEnv("EVENTS_DUMP_DIR", cfg.Events.DumpDir)
+	cfg.History.RetentionMS = getEnvInt("HISTORY_RETENTION_MS", cfg.History.RetentionMS)
+	cfg.History.MaxVersions = getEnvInt("HISTORY_MAX_VERSIONS", cfg.History.MaxVersions)
+	cfg.HotKeys.WindowMS = getEnvInt("HOTKEYS_WINDOW_MS", cfg.HotKeys.WindowMS)
+	cfg.HotKeys.MaxKeys = getEnvInt("HOTKEYS_MAX_KEYS", cfg.HotKeys.MaxKeys)
+	cfg.Logging.IntervalMS = getEnvInt("LOG_INTERVAL_MS", cfg.Logging.IntervalMS)
+	cfg.Logging.Budget = getEnvInt("LOG_BUDGET", cfg.Logging.Budget)
 
 	if peersEnv := os.Getenv("PEERS"); peersEnv != "" {
 		cfg.Peers = strings.Split(peersEnv, ",")
 	}
+	if listenEnv := os.Getenv("HTTP_LISTEN"); listenEnv != "" {
+		cfg.HTTPListen = strings.Split(listenEnv, ",")
+	}
+	if listenEnv := os.Getenv("TCP_LISTEN"); listenEnv != "" {
+		cfg.TCPListen = strings.Split(listenEnv, ",")
+	}
+	if dial, ok := peerDialFromEnv(cfg.PeerDial["*"]); ok {
+		if cfg.PeerDial == nil {
+			cfg.PeerDial = make(map[string]PeerDialConfig)
+		}
+		cfg.PeerDial["*"] = dial
+	}
+	if prefixesEnv := os.Getenv("KEY_REQUIRED_PREFIXES"); prefixesEnv != "" {
+		cfg.KeyPolicy.RequiredPrefixes = strings.Split(prefixesEnv, ",")
+	}
+	if prefixesEnv := os.Getenv("FEDERATION_PREFIXES"); prefixesEnv != "" {
+		cfg.Federation.Prefixes = strings.Split(prefixesEnv, ",")
+	}
+	if groupsEnv := os.Getenv("PLACEMENT_PREFIX_GROUPS"); groupsEnv != "" {
+		groups, err := parsePrefixMap(groupsEnv, "prefix group", "prefix=group")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Placement.PrefixGroups = groups
+	}
+	if acksEnv := os.Getenv("REPLICATION_PREFIX_ACKS"); acksEnv != "" {
+		acks, err := parsePrefixMap(acksEnv, "prefix acks", "prefix=acks")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Replication.PrefixAcks = acks
+	}
+	cfg.Cost.Currency = getEnv("COST_CURRENCY", cfg.Cost.Currency)
+	if pricesEnv := os.Getenv("COST_EGRESS_PER_GB"); pricesEnv != "" {
+		prices, err := parsePrefixMap(pricesEnv, "egress price", "from:to=price")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Cost.EgressPerGB = make(map[string]float64, len(prices))
+		for pair, price := range prices {
+			perGB, err := strconv.ParseFloat(price, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid egress price %q for %s", price, pair)
+			}
+			cfg.Cost.EgressPerGB[pair] = perGB
+		}
+	}
+	cfg.SQLServer.DSN = getEnv("SQLSERVER_DSN", cfg.SQLServer.DSN)
+	cfg.SQLServer.CacheTTLSeconds = getEnvInt("SQLSERVER_CACHE_TTL_SECONDS", cfg.SQLServer.CacheTTLSeconds)
+	cfg.SQLServer.QueryTimeoutMS = getEnvInt("SQLSERVER_QUERY_TIMEOUT_MS", cfg.SQLServer.QueryTimeoutMS)
+	cfg.SQLServer.MaxRows = getEnvInt("SQLSERVER_MAX_ROWS", cfg.SQLServer.MaxRows)
+	if tablesEnv := os.Getenv("SQLSERVER_WATCH_TABLES"); tablesEnv != "" {
+		cfg.SQLServer.WatchTables = strings.Split(tablesEnv, ",")
+	}
+	cfg.SQLServer.WatchIntervalMS = getEnvInt("SQLSERVER_WATCH_INTERVAL_MS", cfg.SQLServer.WatchIntervalMS)
+	cfg.Licensing.PricingKey = getEnv("LICENSING_PRICING_KEY", cfg.Licensing.PricingKey)
+	cfg.Licensing.CacheTTLSeconds = getEnvInt("LICENSING_CACHE_TTL_SECONDS", cfg.Licensing.CacheTTLSeconds)
+	cfg.Progress.TTLSeconds = getEnvInt("PROGRESS_TTL_SECONDS", cfg.Progress.TTLSeconds)
+	cfg.Progress.MaxAttempts = getEnvInt("PROGRESS_MAX_ATTEMPTS", cfg.Progress.MaxAttempts)
+	cfg.Locks.DefaultTTLMS = getEnvInt("LOCK_DEFAULT_TTL_MS", cfg.Locks.DefaultTTLMS)
+	cfg.Locks.MaxTTLMS = getEnvInt("LOCK_MAX_TTL_MS", cfg.Locks.MaxTTLMS)
+	cfg.Edge.Origin = getEnv("EDGE_ORIGIN", cfg.Edge.Origin)
+	cfg.Edge.DeployVersion = getEnv("EDGE_DEPLOY_VERSION", cfg.Edge.DeployVersion)
+	cfg.Edge.ImmutablePattern = getEnv("EDGE_IMMUTABLE_PATTERN", cfg.Edge.ImmutablePattern)
+	cfg.Edge.TTLSeconds = getEnvInt("EDGE_TTL_SECONDS", cfg.Edge.TTLSeconds)
+	cfg.Edge.ImmutableTTLSeconds = getEnvInt("EDGE_IMMUTABLE_TTL_SECONDS", cfg.Edge.ImmutableTTLSeconds)
+	cfg.Edge.Fallback = getEnv("EDGE_FALLBACK", cfg.Edge.Fallback)
+	cfg.Edge.MaxAssetBytes = getEnvInt("EDGE_MAX_ASSET_BYTES", cfg.Edge.MaxAssetBytes)
+	cfg.Edge.TimeoutMS = getEnvInt("EDGE_TIMEOUT_MS", cfg.Edge.TimeoutMS)
+	cfg.Namespaces.TeardownIntervalMS = getEnvInt("NAMESPACE_TEARDOWN_INTERVAL_MS", cfg.Namespaces.TeardownIntervalMS)
+	cfg.Namespaces.ReportDir = getEnv("NAMESPACE_REPORT_DIR", cfg.Namespaces.ReportDir)
+	cfg.Analytics.Sink = getEnv("ANALYTICS_SINK", cfg.Analytics.Sink)
+	cfg.Analytics.Path = getEnv("ANALYTICS_FILE", cfg.Analytics.Path)
+	cfg.Analytics.URL = getEnv("ANALYTICS_WEBHOOK_URL", cfg.Analytics.URL)
+	cfg.Analytics.ConnectionString = getEnv("ANALYTICS_EVENTHUBS_CONNECTION_STRING", cfg.Analytics.ConnectionString)
+	cfg.Analytics.SampleRate = getEnvFloat("ANALYTICS_SAMPLE_RATE", cfg.Analytics.SampleRate)
+	cfg.Analytics.BatchSize = getEnvInt("ANALYTICS_BATCH_SIZE", cfg.Analytics.BatchSize)
+	cfg.Analytics.FlushIntervalMS = getEnvInt("ANALYTICS_FLUSH_INTERVAL_MS", cfg.Analytics.FlushIntervalMS)
+	cfg.Analytics.MaxPending = getEnvInt("ANALYTICS_MAX_PENDING", cfg.Analytics.MaxPending)
+	if namespacesEnv := os.Getenv("ANALYTICS_OPT_OUT_NAMESPACES"); namespacesEnv != "" {
+		cfg.Analytics.OptOutNamespaces = strings.Split(namespacesEnv, ",")
+	}
+	cfg.Analytics.NamespaceSalt = getEnv("ANALYTICS_NAMESPACE_SALT", cfg.Analytics.NamespaceSalt)
+	cfg.ChangeFeed.Broker = getEnv("CHANGEFEED_BROKER", cfg.ChangeFeed.Broker)
+	cfg.ChangeFeed.ConnectionString = getEnv("CHANGEFEED_EVENTHUBS_CONNECTION_STRING", cfg.ChangeFeed.ConnectionString)
+	cfg.ChangeFeed.KafkaRESTURL = getEnv("CHANGEFEED_KAFKA_REST_URL", cfg.ChangeFeed.KafkaRESTURL)
+	cfg.ChangeFeed.Topic = getEnv("CHANGEFEED_TOPIC", cfg.ChangeFeed.Topic)
+	if prefixesEnv := os.Getenv("CHANGEFEED_PREFIXES"); prefixesEnv != "" {
+		cfg.ChangeFeed.Prefixes = strings.Split(prefixesEnv, ",")
+	}
+	cfg.ChangeFeed.IncludeValues = getEnvBool("CHANGEFEED_INCLUDE_VALUES", cfg.ChangeFeed.IncludeValues)
+	cfg.ChangeFeed.BatchSize = getEnvInt("CHANGEFEED_BATCH_SIZE", cfg.ChangeFeed.BatchSize)
+	cfg.ChangeFeed.FlushIntervalMS = getEnvInt("CHANGEFEED_FLUSH_INTERVAL_MS", cfg.ChangeFeed.FlushIntervalMS)
+	cfg.ChangeFeed.MaxPending = getEnvInt("CHANGEFEED_MAX_PENDING", cfg.ChangeFeed.MaxPending)
+	cfg.Ingest.KafkaRESTURL = getEnv("INGEST_KAFKA_REST_URL", cfg.Ingest.KafkaRESTURL)
+	cfg.Ingest.Group = getEnv("INGEST_GROUP", cfg.Ingest.Group)
+	cfg.Ingest.PollIntervalMS = getEnvInt("INGEST_POLL_INTERVAL_MS", cfg.Ingest.PollIntervalMS)
+	if keysEnv := os.Getenv("DATASET_TRUSTED_KEYS"); keysEnv != "" {
+		cfg.Datasets.TrustedKeys = make(map[string]string)
+		for _, entry := range strings.Split(keysEnv, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			// Base64 may end in "=", so IDs are separated by ":".
+			id, key, found := strings.Cut(entry, ":")
+			if !found {
+				return nil, fmt.Errorf("invalid trusted dataset key %q, expected key_id:base64_public_key", entry)
+			}
+			cfg.Datasets.TrustedKeys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+		}
+	}
+	cfg.Datasets.SigningKey = getEnv("DATASET_SIGNING_KEY", cfg.Datasets.SigningKey)
+	cfg.Datasets.SigningKeyID = getEnv("DATASET_SIGNING_KEY_ID", cfg.Datasets.SigningKeyID)
+	if wanEnv := os.Getenv("SIMULATE_WAN"); wanEnv != "" {
+		links, err := parsePrefixMap(wanEnv, "WAN simulation", "peer=latency_ms/jitter_ms/loss_percent")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Simulation.WAN = make(map[string]WANConditions, len(links))
+		for peer, spec := range links {
+			conditions, err := parseWANConditions(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid WAN simulation for %s: %v", peer, err)
+			}
+			cfg.Simulation.WAN[peer] = conditions
+		}
+	}
+	if featuresEnv := os.Getenv("FEATURES"); featuresEnv != "" {
+		if err := parseFeatures(featuresEnv, cfg); err != nil {
+			return nil, err
+		}
+	}
 
+	normalizeAddresses(cfg)
 	return cfg, nil
 }
 
+// HTTPAddresses returns the addresses the HTTP server binds.
+func (c *Config) HTTPAddresses() []string {
+	if len(c.HTTPListen) == 0 {
+		return []string{fmt.Sprintf(":%d", c.HTTPPort)}
+	}
+	return c.HTTPListen
+}
+
+// TCPAddresses returns the addresses the TCP server binds.
+func (c *Config) TCPAddresses() []string {
+	if len(c.TCPListen) == 0 {
+		return []string{fmt.Sprintf(":%d", c.TCPPort)}
+	}
+	return c.TCPListen
+}
+
+// normalizeAddresses writes IP literals in peer and listen addresses in
+// their canonical form, so "[0:0::1]:9090" and "[::1]:9090" name the same
+// peer. Addresses that don't parse are left for Validate to report.
+func normalizeAddresses(cfg *Config) {
+	for _, addresses := range [][]string{cfg.Peers, cfg.HTTPListen, cfg.TCPListen} {
+		for i, address := range addresses {
+			addresses[i] = NormalizeHostPort(address)
+		}
+	}
+	if len(cfg.PeerDial) > 0 {
+		dial := make(map[string]PeerDialConfig, len(cfg.PeerDial))
+		for address, options := range cfg.PeerDial {
+			if address != "*" {
+				address = NormalizeHostPort(address)
+			}
+			dial[address] = options
+		}
+		cfg.PeerDial = dial
+	}
+}
+
+// NormalizeHostPort trims address and rewrites an IP literal host in its
+// canonical form.
+func NormalizeHostPort(address string) string {
+	address = strings.TrimSpace(address)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	ip, zone := host, ""
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		ip, zone = host[:i], host[i:]
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		host = parsed.String() + zone
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// parseFeatures reads "name=true,other=false"; a bare name means enabled.
+// Entries override the same flags from the config file.
+func parseFeatures(value string, cfg *Config) error {
+	if cfg.Features == nil {
+		cfg.Features = make(map[string]bool)
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		enabled := true
+		if len(parts) == 2 {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return fmt.Errorf("invalid value for feature %s: %v", parts[0], err)
+			}
+			enabled = parsed
+		}
+		cfg.Features[strings.TrimSpace(parts[0])] = enabled
+	}
+	return nil
+}
+
+// parsePrefixMap reads a comma-separated list of prefix=value entries, as
+// in PLACEMENT_PREFIX_GROUPS. Prefixes may themselves contain "=".
+func parsePrefixMap(value, what, form string) (map[string]string, error) {
+	prefixes := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(entry, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid %s %q, expected %s", what, entry, form)
+		}
+		prefixes[entry[:separator]] = strings.TrimSpace(entry[separator+1:])
+	}
+	return prefixes, nil
+}
+
+// peerDialFromEnv applies the PEER_PROXY and PEER_TLS* variables to the
+// default dial settings, reporting whether any is set.
+func peerDialFromEnv(dial PeerDialConfig) (PeerDialConfig, bool) {
+	set := false
+	for _, key := range []string{"PEER_PROXY", "PEER_TLS", "PEER_TLS_SERVER_NAME", "PEER_TLS_CA_FILE"} {
+		if os.Getenv(key) != "" {
+			set = true
+		}
+	}
+	dial.Proxy = getEnv("PEER_PROXY", dial.Proxy)
+	dial.TLS = getEnvBool("PEER_TLS", dial.TLS)
+	dial.ServerName = getEnv("PEER_TLS_SERVER_NAME", dial.ServerName)
+	dial.CAFile = getEnv("PEER_TLS_CA_FILE", dial.CAFile)
+	return dial, set
+}
+
+// parseWANConditions parses "latency_ms[/jitter_ms[/loss_percent]]".
+func parseWANConditions(spec string) (WANConditions, error) {
+	var conditions WANConditions
+	fields := strings.Split(spec, "/")
+	if len(fields) > 3 {
+		return conditions, fmt.Errorf("%q has more than three fields", spec)
+	}
+	var err error
+	if conditions.LatencyMS, err = strconv.Atoi(fields[0]); err != nil {
+		return conditions, fmt.Errorf("invalid latency %q", fields[0])
+	}
+	if len(fields) > 1 {
+		if conditions.JitterMS, err = strconv.Atoi(fields[1]); err != nil {
+			return conditions, fmt.Errorf("invalid jitter %q", fields[1])
+		}
+	}
+	if len(fields) > 2 {
+		if conditions.LossPercent, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return conditions, fmt.Errorf("invalid loss %q", fields[2])
+		}
+	}
+	return conditions, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -46,3 +1062,21 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
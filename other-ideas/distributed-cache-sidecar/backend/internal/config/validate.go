@@ -0,0 +1,626 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is one validation failure. Field is the config key path of the
+// offending value, e.g. "peers[1]" or "federation.remote_url".
+type Problem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func problem(field, format string, args ...interface{}) Problem {
+	return Problem{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// CheckFile reports keys in the config file that don't correspond to any
+// setting. Load ignores them, which hides typos in rendered configs.
+func CheckFile(path string) []Problem {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []Problem{problem("", "failed to read config file: %v", err)}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&Config{}); err != nil {
+		if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+			return []Problem{problem(strings.Trim(field, `"`), "unknown config key")}
+		}
+		return []Problem{problem("", "failed to parse config file: %v", err)}
+	}
+	return nil
+}
+
+// Validate checks the settings that can be verified without building the
+// components that use them.
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+
+	if c.Region == "" {
+		problems = append(problems, problem("region", "must not be empty"))
+	}
+	if c.NodeID == "" {
+		problems = append(problems, problem("node_id", "must not be empty"))
+	} else if strings.ContainsAny(c.NodeID, "|#, \t\r\n") {
+		problems = append(problems, problem("node_id", "must not contain '|', '#', ',' or whitespace"))
+	}
+	if c.NodeMode != NodeModeData && c.NodeMode != NodeModeWitness && c.NodeMode != NodeModeStandby {
+		problems = append(problems, problem("node_mode", "must be data, witness or standby"))
+	}
+
+	if !validPort(c.HTTPPort) {
+		problems = append(problems, problem("http_port", "must be between 1 and 65535"))
+	}
+	if !validPort(c.TCPPort) {
+		problems = append(problems, problem("tcp_port", "must be between 1 and 65535"))
+	}
+	if c.HTTPPort == c.TCPPort {
+		problems = append(problems, problem("tcp_port", "must differ from http_port"))
+	}
+	if c.AdvertiseURL != "" {
+		if err := validHTTPURL(c.AdvertiseURL); err != nil {
+			problems = append(problems, problem("advertise_url", "%v", err))
+		}
+	}
+
+	for i, address := range c.HTTPListen {
+		if err := validListenAddress(address); err != nil {
+			problems = append(problems, problem(fmt.Sprintf("http_listen[%d]", i), "%v", err))
+		}
+	}
+	if len(c.HTTPListen) > 0 && c.AdvertiseURL == "" && !listensOn(c.HTTPListen, c.HTTPPort) {
+		problems = append(problems, problem("http_port", "must be one of the http_listen ports, since peers are told to use it; or set advertise_url"))
+	}
+	for i, address := range c.TCPListen {
+		if err := validListenAddress(address); err != nil {
+			problems = append(problems, problem(fmt.Sprintf("tcp_listen[%d]", i), "%v", err))
+		}
+	}
+
+	if c.TCPAcceptors < 1 || c.TCPAcceptors > 256 {
+		problems = append(problems, problem("tcp_acceptors", "must be between 1 and 256"))
+	} else if c.TCPAcceptors > 1 && runtime.GOOS != "linux" {
+		problems = append(problems, problem("tcp_acceptors", "SO_REUSEPORT acceptors are only supported on Linux"))
+	}
+
+	if c.Socket.KeepAliveMS < 0 {
+		problems = append(problems, problem("socket.keepalive_ms", "must not be negative"))
+	} else if c.Socket.KeepAliveMS > 0 && c.Socket.KeepAliveMS < 1000 {
+		problems = append(problems, problem("socket.keepalive_ms", "must be at least 1000 (keepalive intervals are whole seconds)"))
+	}
+	if c.Socket.ReadBufferBytes < 0 {
+		problems = append(problems, problem("socket.read_buffer_bytes", "must not be negative"))
+	}
+	if c.Socket.WriteBufferBytes < 0 {
+		problems = append(problems, problem("socket.write_buffer_bytes", "must not be negative"))
+	}
+
+	if c.Shutdown.DrainHTTPMS < 0 {
+		problems = append(problems, problem("shutdown.drain_http_ms", "must not be negative"))
+	}
+	if c.Shutdown.FlushReplicationMS < 0 {
+		problems = append(problems, problem("shutdown.flush_replication_ms", "must not be negative"))
+	}
+	if c.Shutdown.SnapshotMS < 0 {
+		problems = append(problems, problem("shutdown.snapshot_ms", "must not be negative"))
+	}
+	if c.Shutdown.TotalMS <= 0 {
+		problems = append(problems, problem("shutdown.total_ms", "must be positive"))
+	}
+
+	if c.PanicWebhookURL != "" {
+		if err := validHTTPURL(c.PanicWebhookURL); err != nil {
+			problems = append(problems, problem("panic_webhook_url", "%v", err))
+		}
+	}
+	if c.Events.Capacity < 1 {
+		problems = append(problems, problem("events.capacity", "must be positive"))
+	}
+	if c.Events.DumpDir == "" {
+		problems = append(problems, problem("events.dump_dir", "must not be empty"))
+	}
+
+	seen := make(map[string]bool, len(c.Peers))
+	for i, peer := range c.Peers {
+		field := fmt.Sprintf("peers[%d]", i)
+		if err := validHostPort(peer); err != nil {
+			problems = append(problems, problem(field, "%v", err))
+		} else if seen[peer] {
+			problems = append(problems, problem(field, "duplicate peer %s", peer))
+		}
+		seen[peer] = true
+	}
+	dialed := make([]string, 0, len(c.PeerDial))
+	for address := range c.PeerDial {
+		dialed = append(dialed, address)
+	}
+	sort.Strings(dialed)
+	for _, address := range dialed {
+		dial := c.PeerDial[address]
+		field := fmt.Sprintf("peer_dial[%s]", address)
+		if address != "*" {
+			if err := validHostPort(address); err != nil {
+				problems = append(problems, problem(field, "%v", err))
+			}
+		}
+		if dial.Proxy != "" {
+			if err := validProxyURL(dial.Proxy); err != nil {
+				problems = append(problems, problem(field+".proxy", "%v", err))
+			}
+		}
+		if !dial.TLS && (dial.ServerName != "" || dial.CAFile != "") {
+			problems = append(problems, problem(field+".tls", "must be enabled to use server_name or ca_file"))
+		}
+	}
+
+	if c.CacheSize <= 0 {
+		problems = append(problems, problem("cache_size", "must be positive"))
+	}
+	if c.MaxMemoryBytes < 0 {
+		problems = append(problems, problem("max_memory_bytes", "must not be negative"))
+	}
+	// Replicated items travel as one line of at most 64 MiB, and a value
+	// can grow when it is escaped as JSON.
+	if c.MaxValueBytes < 1 || c.MaxValueBytes > 32<<20 {
+		problems = append(problems, problem("max_value_bytes", "must be 1 to %d", 32<<20))
+	}
+	if c.ExpirySweepIntervalMS < 0 {
+		problems = append(problems, problem("expiry_sweep_interval_ms", "must not be negative"))
+	}
+	if c.InvariantCheckIntervalMS < 0 {
+		problems = append(problems, problem("invariant_check_interval_ms", "must not be negative"))
+	}
+	if c.KeyPolicy.MaxLength < 0 {
+		problems = append(problems, problem("key_policy.max_length", "must not be negative"))
+	}
+	if c.UDFMemoryPages <= 0 || c.UDFMemoryPages > 65536 {
+		problems = append(problems, problem("udf_memory_pages", "must be between 1 and 65536"))
+	}
+	if c.UDFTimeoutMS <= 0 {
+		problems = append(problems, problem("udf_timeout_ms", "must be positive"))
+	}
+	if c.DerivedCacheSize < 0 {
+		problems = append(problems, problem("derived_cache_size", "must not be negative"))
+	}
+	if c.BackupDir == "" {
+		problems = append(problems, problem("backup_dir", "must not be empty"))
+	}
+	if c.WarmupFile != "" {
+		if info, err := os.Stat(c.WarmupFile); err != nil {
+			problems = append(problems, problem("warmup_file", "%v", err))
+		} else if info.IsDir() {
+			problems = append(problems, problem("warmup_file", "%s is a directory", c.WarmupFile))
+		}
+	}
+	if c.SnapshotPath != "" {
+		if info, err := os.Stat(c.SnapshotPath); err == nil && info.IsDir() {
+			problems = append(problems, problem("snapshot_path", "%s is a directory", c.SnapshotPath))
+		}
+	}
+	if c.SnapshotIntervalMS < 0 {
+		problems = append(problems, problem("snapshot_interval_ms", "must not be negative"))
+	}
+	if c.EventLogFsync && c.EventLogPath == "" {
+		problems = append(problems, problem("event_log_fsync", "requires event_log_path"))
+	}
+	if c.EventLogGroupCommitMS < 0 {
+		problems = append(problems, problem("event_log_group_commit_ms", "must not be negative"))
+	}
+	if c.Replication.MaxHops < 1 {
+		problems = append(problems, problem("replication.max_hops", "must be at least 1"))
+	}
+	if c.Replication.SyncIntervalMS <= 0 {
+		problems = append(problems, problem("replication.sync_interval_ms", "must be positive"))
+	}
+	if c.Replication.HealthIntervalMS <= 0 {
+		problems = append(problems, problem("replication.health_interval_ms", "must be positive"))
+	}
+	if c.Replication.Adaptive {
+		if c.Replication.MinIntervalMS <= 0 {
+			problems = append(problems, problem("replication.min_interval_ms", "must be positive"))
+		}
+		if c.Replication.MaxIntervalMS < c.Replication.MinIntervalMS {
+			problems = append(problems, problem("replication.max_interval_ms", "must be at least min_interval_ms"))
+		}
+	}
+	for _, name := range c.Replication.Compression {
+		if name != "zstd" && name != "snappy" {
+			problems = append(problems, problem("replication.compression", "unknown algorithm %q, expected zstd or snappy", name))
+		}
+	}
+	if c.Replication.CompressMinBytes < 0 {
+		problems = append(problems, problem("replication.compress_min_bytes", "must not be negative"))
+	}
+	if !validAcks(c.Replication.Acks) {
+		problems = append(problems, problem("replication.acks", "must be none, quorum or all"))
+	}
+	for prefix, acks := range c.Replication.PrefixAcks {
+		if prefix == "" || !validAcks(acks) {
+			problems = append(problems, problem("replication.prefix_acks", "prefix %q maps to %q; expected a non-empty prefix and none, quorum or all", prefix, acks))
+		}
+	}
+	if c.Replication.AckTimeoutMS <= 0 {
+		problems = append(problems, problem("replication.ack_timeout_ms", "must be positive"))
+	}
+	if c.Replication.CoalesceMS < 0 {
+		problems = append(problems, problem("replication.coalesce_ms", "must not be negative"))
+	}
+	for _, ns := range c.Replication.LocalNamespaces {
+		if ns == "" || strings.Contains(ns, "::") {
+			problems = append(problems, problem("replication.local_namespaces", "invalid namespace %q", ns))
+		}
+	}
+	if c.Replication.DigestMinBytes < 0 {
+		problems = append(problems, problem("replication.digest_min_bytes", "must not be negative"))
+	}
+	if c.Placement.Mode != "full" && c.Placement.Mode != "partitioned" {
+		problems = append(problems, problem("placement.mode", "must be full or partitioned"))
+	}
+	if c.Placement.ReplicationFactor < 1 {
+		problems = append(problems, problem("placement.replication_factor", "must be at least 1"))
+	}
+	if c.Placement.VNodes < 1 || c.Placement.VNodes > 4096 {
+		problems = append(problems, problem("placement.vnodes", "must be between 1 and 4096"))
+	}
+	if c.Placement.Weight <= 0 || c.Placement.Weight > 64 {
+		problems = append(problems, problem("placement.weight", "must be greater than 0 and at most 64"))
+	}
+	if c.Placement.SpreadBy != "zone" && c.Placement.SpreadBy != "region" && c.Placement.SpreadBy != "none" {
+		problems = append(problems, problem("placement.spread_by", "must be zone, region or none"))
+	}
+	if c.Placement.RebalanceKeysPerSec < 0 {
+		problems = append(problems, problem("placement.rebalance_keys_per_sec", "must not be negative"))
+	}
+	if c.Placement.RebalanceSettleMS < 0 {
+		problems = append(problems, problem("placement.rebalance_settle_ms", "must not be negative"))
+	}
+	for prefix, group := range c.Placement.PrefixGroups {
+		if prefix == "" || group == "" {
+			problems = append(problems, problem("placement.prefix_groups", "prefix %q maps to group %q; neither may be empty", prefix, group))
+		}
+	}
+	if c.Placement.ReadPolicy != "nearest" && c.Placement.ReadPolicy != "random" {
+		problems = append(problems, problem("placement.read_policy", "must be nearest or random"))
+	}
+	if c.Failover.DeadAfterMS < 0 {
+		problems = append(problems, problem("failover.dead_after_ms", "must not be negative"))
+	}
+	if c.Partition.DegradedFraction < 0 || c.Partition.DegradedFraction > 1 {
+		problems = append(problems, problem("partition.degraded_fraction", "must be between 0 and 1"))
+	}
+	if c.History.RetentionMS < 0 {
+		problems = append(problems, problem("history.retention_ms", "must not be negative"))
+	}
+	if c.History.RetentionMS > 0 && c.History.MaxVersions < 1 {
+		problems = append(problems, problem("history.max_versions", "must be at least 1"))
+	}
+	if c.HotKeys.WindowMS < 0 {
+		problems = append(problems, problem("hot_keys.window_ms", "must not be negative"))
+	}
+	if c.HotKeys.WindowMS > 0 && c.HotKeys.MaxKeys < 1 {
+		problems = append(problems, problem("hot_keys.max_keys", "must be at least 1"))
+	}
+	if c.Logging.IntervalMS < 0 {
+		problems = append(problems, problem("logging.interval_ms", "must not be negative"))
+	}
+	if c.Logging.Budget < 1 {
+		problems = append(problems, problem("logging.budget", "must be at least 1"))
+	}
+	for subsystem, budget := range c.Logging.Budgets {
+		if budget < 1 {
+			problems = append(problems, problem("logging.budgets."+subsystem, "must be at least 1"))
+		}
+	}
+	for pair, price := range c.Cost.EgressPerGB {
+		if from, to, ok := strings.Cut(pair, ":"); pair != "*" && (!ok || from == "" || from == "*" || to == "") {
+			problems = append(problems, problem("cost.egress_per_gb", "invalid region pair %q, expected from:to, from:* or *", pair))
+		}
+		if price < 0 {
+			problems = append(problems, problem("cost.egress_per_gb", "price for %s must not be negative", pair))
+		}
+	}
+
+	if c.SQLServer.DSN != "" {
+		if c.SQLServer.CacheTTLSeconds < 0 {
+			problems = append(problems, problem("sqlserver.cache_ttl_seconds", "must not be negative"))
+		}
+		if c.SQLServer.QueryTimeoutMS < 1 {
+			problems = append(problems, problem("sqlserver.query_timeout_ms", "must be at least 1"))
+		}
+		if c.SQLServer.MaxRows < 1 {
+			problems = append(problems, problem("sqlserver.max_rows", "must be at least 1"))
+		}
+		if len(c.SQLServer.WatchTables) > 0 && c.SQLServer.WatchIntervalMS < 100 {
+			problems = append(problems, problem("sqlserver.watch_interval_ms", "must be at least 100"))
+		}
+		for _, table := range c.SQLServer.WatchTables {
+			if name, column, _ := strings.Cut(table, ":"); strings.TrimSpace(name) == "" || strings.Contains(table, ":") && strings.TrimSpace(column) == "" {
+				problems = append(problems, problem("sqlserver.watch_tables", "invalid table %q, expected table or table:rowversion_column", table))
+			}
+		}
+	} else if len(c.SQLServer.WatchTables) > 0 {
+		problems = append(problems, problem("sqlserver.watch_tables", "requires sqlserver.dsn"))
+	}
+	if c.Licensing.PricingKey == "" {
+		problems = append(problems, problem("licensing.pricing_key", "must not be empty"))
+	}
+	if c.Licensing.CacheTTLSeconds < 0 {
+		problems = append(problems, problem("licensing.cache_ttl_seconds", "must not be negative"))
+	}
+	if c.Progress.TTLSeconds < 0 {
+		problems = append(problems, problem("progress.ttl_seconds", "must not be negative"))
+	}
+	if c.Progress.MaxAttempts < 1 {
+		problems = append(problems, problem("progress.max_attempts", "must be at least 1"))
+	}
+	if c.Locks.DefaultTTLMS < 1 {
+		problems = append(problems, problem("locks.default_ttl_ms", "must be at least 1"))
+	}
+	if c.Locks.MaxTTLMS < c.Locks.DefaultTTLMS {
+		problems = append(problems, problem("locks.max_ttl_ms", "must be at least locks.default_ttl_ms"))
+	}
+	if c.Edge.Origin != "" {
+		if err := validHTTPURL(strings.ReplaceAll(c.Edge.Origin, "{version}", "v")); err != nil {
+			problems = append(problems, problem("edge.origin", "%v", err))
+		}
+		if c.Edge.DeployVersion == "" || strings.ContainsAny(c.Edge.DeployVersion, "/?#") {
+			problems = append(problems, problem("edge.deploy_version", "must be non-empty and contain no '/', '?' or '#'"))
+		}
+		if _, err := regexp.Compile(c.Edge.ImmutablePattern); err != nil {
+			problems = append(problems, problem("edge.immutable_pattern", "%v", err))
+		}
+		if c.Edge.TTLSeconds < 0 || c.Edge.ImmutableTTLSeconds < 0 {
+			problems = append(problems, problem("edge.ttl_seconds", "TTLs must not be negative"))
+		}
+		if c.Edge.MaxAssetBytes < 1 {
+			problems = append(problems, problem("edge.max_asset_bytes", "must be at least 1"))
+		} else if base64.StdEncoding.EncodedLen(c.Edge.MaxAssetBytes) > c.MaxValueBytes {
+			problems = append(problems, problem("edge.max_asset_bytes", "assets are stored base64-encoded and must fit max_value_bytes"))
+		}
+		if c.Edge.TimeoutMS < 1 {
+			problems = append(problems, problem("edge.timeout_ms", "must be at least 1"))
+		}
+	}
+	if c.Namespaces.TeardownIntervalMS < 1 {
+		problems = append(problems, problem("namespaces.teardown_interval_ms", "must be at least 1"))
+	}
+	if c.Namespaces.ReportDir == "" {
+		problems = append(problems, problem("namespaces.report_dir", "must not be empty"))
+	}
+	switch c.Analytics.Sink {
+	case "":
+	case "file":
+		if c.Analytics.Path == "" {
+			problems = append(problems, problem("analytics.path", "is required with the file sink"))
+		}
+	case "webhook":
+		if err := validHTTPURL(c.Analytics.URL); err != nil {
+			problems = append(problems, problem("analytics.url", "%v", err))
+		}
+	case "eventhubs":
+		for _, field := range []string{"Endpoint=", "SharedAccessKeyName=", "SharedAccessKey=", "EntityPath="} {
+			if !strings.Contains(c.Analytics.ConnectionString, field) {
+				problems = append(problems, problem("analytics.connection_string", "must contain %s", strings.TrimSuffix(field, "=")))
+			}
+		}
+	default:
+		problems = append(problems, problem("analytics.sink", "unknown sink %q, expected file, webhook or eventhubs", c.Analytics.Sink))
+	}
+	if c.Analytics.Sink != "" {
+		if c.Analytics.SampleRate <= 0 || c.Analytics.SampleRate > 1 {
+			problems = append(problems, problem("analytics.sample_rate", "must be above 0 and at most 1"))
+		}
+		if c.Analytics.BatchSize < 1 {
+			problems = append(problems, problem("analytics.batch_size", "must be at least 1"))
+		}
+		if c.Analytics.FlushIntervalMS < 1 {
+			problems = append(problems, problem("analytics.flush_interval_ms", "must be at least 1"))
+		}
+		if c.Analytics.MaxPending < c.Analytics.BatchSize {
+			problems = append(problems, problem("analytics.max_pending", "must be at least analytics.batch_size"))
+		}
+	}
+	switch c.ChangeFeed.Broker {
+	case "":
+	case "eventhubs":
+		for _, field := range []string{"Endpoint=", "SharedAccessKeyName=", "SharedAccessKey=", "EntityPath="} {
+			if !strings.Contains(c.ChangeFeed.ConnectionString, field) {
+				problems = append(problems, problem("change_feed.connection_string", "must contain %s", strings.TrimSuffix(field, "=")))
+			}
+		}
+	case "kafka":
+		if err := validHTTPURL(c.ChangeFeed.KafkaRESTURL); err != nil {
+			problems = append(problems, problem("change_feed.kafka_rest_url", "%v", err))
+		}
+		if c.ChangeFeed.Topic == "" {
+			problems = append(problems, problem("change_feed.topic", "is required with the kafka broker"))
+		}
+	default:
+		problems = append(problems, problem("change_feed.broker", "unknown broker %q, expected eventhubs or kafka", c.ChangeFeed.Broker))
+	}
+	if c.ChangeFeed.Broker != "" {
+		if c.ChangeFeed.BatchSize < 1 {
+			problems = append(problems, problem("change_feed.batch_size", "must be at least 1"))
+		}
+		if c.ChangeFeed.FlushIntervalMS < 1 {
+			problems = append(problems, problem("change_feed.flush_interval_ms", "must be at least 1"))
+		}
+		if c.ChangeFeed.MaxPending < c.ChangeFeed.BatchSize {
+			problems = append(problems, problem("change_feed.max_pending", "must be at least change_feed.batch_size"))
+		}
+	}
+	if c.Ingest.KafkaRESTURL != "" {
+		if err := validHTTPURL(c.Ingest.KafkaRESTURL); err != nil {
+			problems = append(problems, problem("ingest.kafka_rest_url", "%v", err))
+		}
+		if c.Ingest.Group == "" {
+			problems = append(problems, problem("ingest.group", "must not be empty"))
+		}
+		if len(c.Ingest.Topics) == 0 {
+			problems = append(problems, problem("ingest.topics", "must list at least one topic"))
+		}
+		if c.Ingest.PollIntervalMS < 1 {
+			problems = append(problems, problem("ingest.poll_interval_ms", "must be at least 1"))
+		}
+	}
+	ingestTopics := make(map[string]bool, len(c.Ingest.Topics))
+	for i, topic := range c.Ingest.Topics {
+		field := fmt.Sprintf("ingest.topics[%d]", i)
+		if topic.Topic == "" {
+			problems = append(problems, problem(field+".topic", "must not be empty"))
+		} else if ingestTopics[topic.Topic] {
+			problems = append(problems, problem(field+".topic", "%s is listed twice", topic.Topic))
+		}
+		ingestTopics[topic.Topic] = true
+		if topic.TTLSeconds < 0 {
+			problems = append(problems, problem(field+".ttl_seconds", "must not be negative"))
+		}
+	}
+	for id, key := range c.Datasets.TrustedKeys {
+		if decoded, err := base64.StdEncoding.DecodeString(key); id == "" || err != nil || len(decoded) != 32 {
+			problems = append(problems, problem("datasets.trusted_keys", "key %q must be a base64 Ed25519 public key under a non-empty ID", id))
+		}
+	}
+	if c.Datasets.SigningKey != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(c.Datasets.SigningKey); err != nil || len(decoded) != 32 && len(decoded) != 64 {
+			problems = append(problems, problem("datasets.signing_key", "must be a base64 Ed25519 seed or private key"))
+		}
+		if c.Datasets.SigningKeyID == "" {
+			problems = append(problems, problem("datasets.signing_key_id", "is required with datasets.signing_key"))
+		}
+	}
+	for peer, conditions := range c.Simulation.WAN {
+		field := "simulation.wan." + peer
+		if conditions.LatencyMS < 0 || conditions.JitterMS < 0 {
+			problems = append(problems, problem(field, "latency and jitter must not be negative"))
+		}
+		if conditions.LossPercent < 0 || conditions.LossPercent > 100 {
+			problems = append(problems, problem(field, "loss must be between 0 and 100 percent"))
+		}
+	}
+
+	return append(problems, c.Federation.validate()...)
+}
+
+func (f *FederationConfig) validate() []Problem {
+	if f.Role == "" {
+		return nil
+	}
+
+	var problems []Problem
+	switch f.Role {
+	case "primary":
+		if f.RemoteURL == "" {
+			problems = append(problems, problem("federation.remote_url", "is required for the primary role"))
+		}
+	case "secondary":
+	default:
+		problems = append(problems, problem("federation.role", "must be \"primary\" or \"secondary\", got %q", f.Role))
+	}
+	if f.RemoteURL != "" {
+		if err := validHTTPURL(f.RemoteURL); err != nil {
+			problems = append(problems, problem("federation.remote_url", "%v", err))
+		}
+	}
+	if f.BatchSize <= 0 {
+		problems = append(problems, problem("federation.batch_size", "must be positive"))
+	}
+	if f.FlushIntervalMS <= 0 {
+		problems = append(problems, problem("federation.flush_interval_ms", "must be positive"))
+	}
+	if f.MaxPending < f.BatchSize {
+		problems = append(problems, problem("federation.max_pending", "must be at least batch_size"))
+	}
+	return problems
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func validHostPort(address string) error {
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("invalid address %q: missing host", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || !validPort(n) {
+		return fmt.Errorf("invalid address %q: port must be between 1 and 65535", address)
+	}
+	return nil
+}
+
+func validAcks(acks string) bool {
+	return acks == AcksNone || acks == AcksQuorum || acks == AcksAll
+}
+
+// validListenAddress is validHostPort allowing an empty host, which binds
+// every interface.
+func validListenAddress(address string) error {
+	_, port, err := splitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || !validPort(n) {
+		return fmt.Errorf("invalid address %q: port must be between 1 and 65535", address)
+	}
+	return nil
+}
+
+func splitHostPort(address string) (string, string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		if strings.Count(address, ":") > 1 && !strings.HasPrefix(address, "[") {
+			return "", "", fmt.Errorf("invalid address %q: IPv6 addresses must be in brackets, e.g. [::1]:9090", address)
+		}
+		return "", "", fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	return host, port, nil
+}
+
+func listensOn(addresses []string, port int) bool {
+	for _, address := range addresses {
+		if _, p, err := net.SplitHostPort(address); err == nil && p == strconv.Itoa(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func validProxyURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", raw, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "socks5") || parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q: must be an http or socks5 URL", raw)
+	}
+	return nil
+}
+
+func validHTTPURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", raw, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q: must be an absolute http or https URL", raw)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package dataset
+
+import (
+	"context"
+	"crypto/ed25519"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Datasets are versioned reference data, such as licensing price sheets,
+// published once and served by every node. Each is stored as an item in
+// Namespace under its name, carrying its version, the ID of the key that
+// signed it and an Ed25519 signature of the name, version and value as
+// metadata. The signature is checked when the dataset is written
+// locally, when it arrives from a peer or another cluster and whenever it
+// is read, so a node never serves a dataset that no trusted key signed,
+// whichever way it got there.
+
+// Namespace is the cache namespace datasets are stored in.
+const Namespace = "dataset"
+
+// Metadata a dataset item carries.
+const (
+	VersionMetadata   = "dataset_version"
+	KeyIDMetadata     = "dataset_key_id"
+	SignatureMetadata = "dataset_signature"
+)
+
+var (
+	ErrUnsigned     = errors.New("dataset is not signed")
+	ErrUntrustedKey = errors.New("dataset is signed with an untrusted key")
+	ErrBadSignature = errors.New("dataset signature does not verify")
+	ErrNoVersion    = errors.New("dataset has no version")
+)
+
+var rejectedDatasets = metrics.NewCounter("sidecar_dataset_rejected_total",
+	"Dataset writes, replicated copies and reads refused because their signature did not verify, by stage.", "stage")
+
+// Dataset is a dataset as read back, with the signature it was verified
+// against.
+type Dataset struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	KeyID     string    `json:"key_id"`
+	Signature string    `json:"signature"`
+	Encoding  string    `json:"encoding,omitempty"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store publishes and reads datasets, and keeps unverified ones out of
+// the cache.
+type Store struct {
+	cacheManager *cache.Manager
+	trusted      map[string]ed25519.PublicKey
+	signer       ed25519.PrivateKey
+	signerID     string
+}
+
+// New returns a Store trusting the keys in cfg and registers the hook
+// that verifies every dataset stored or read.
+func New(cfg config.DatasetsConfig, cacheManager *cache.Manager) (*Store, error) {
+	s := &Store{cacheManager: cacheManager, trusted: make(map[string]ed25519.PublicKey, len(cfg.TrustedKeys)+1)}
+	for id, encoded := range cfg.TrustedKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("trusted dataset key %q is not a base64 Ed25519 public key", id)
+		}
+		s.trusted[id] = ed25519.PublicKey(key)
+	}
+	if cfg.SigningKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.SigningKey)
+		switch {
+		case err == nil && len(key) == ed25519.SeedSize:
+			s.signer = ed25519.NewKeyFromSeed(key)
+		case err == nil && len(key) == ed25519.PrivateKeySize:
+			s.signer = ed25519.PrivateKey(key)
+		default:
+			return nil, fmt.Errorf("dataset signing key is not a base64 Ed25519 seed or private key")
+		}
+		if cfg.SigningKeyID == "" {
+			return nil, fmt.Errorf("dataset signing key has no ID")
+		}
+		s.signerID = cfg.SigningKeyID
+		s.trusted[s.signerID] = s.signer.Public().(ed25519.PublicKey)
+	}
+
+	cacheManager.AddHook(cache.NamespaceKey(Namespace, ""), &signatureHook{store: s})
+	return s, nil
+}
+
+// Message returns what a dataset's signature signs. Publishers signing
+// offline sign the same bytes: "sidecar-dataset", the name, the version
+// and the value as stored, base64 for binary encodings, each but the last
+// followed by a newline.
+func Message(name, version, value string) []byte {
+	return []byte("sidecar-dataset\n" + name + "\n" + version + "\n" + value)
+}
+
+// Publish stores version of the dataset name with its signature by the
+// trusted key keyID, or, without a signature, signed by this node's key.
+func (s *Store) Publish(ctx context.Context, name, version, value, encoding, keyID, signature string, ttl time.Duration) (*cache.CacheItem, error) {
+	if version == "" {
+		return nil, ErrNoVersion
+	}
+	if signature == "" {
+		if s.signer == nil {
+			return nil, fmt.Errorf("%w and this node has no signing key", ErrUnsigned)
+		}
+		keyID = s.signerID
+		signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signer, Message(name, version, value)))
+	}
+
+	return s.cacheManager.Write(ctx, Key(name), value, cache.WriteOptions{
+		TTL:      ttl,
+		Encoding: encoding,
+		Metadata: map[string]string{
+			VersionMetadata:   version,
+			KeyIDMetadata:     keyID,
+			SignatureMetadata: signature,
+		},
+	})
+}
+
+// Get returns the dataset name, verified.
+func (s *Store) Get(ctx context.Context, name string) (*Dataset, error) {
+	item, err := s.cacheManager.Read(ctx, Key(name), cache.ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &Dataset{
+		Name:      name,
+		Version:   item.Metadata[VersionMetadata],
+		KeyID:     item.Metadata[KeyIDMetadata],
+		Signature: item.Metadata[SignatureMetadata],
+		Encoding:  item.Encoding,
+		Value:     item.Value,
+		UpdatedAt: item.Timestamp,
+	}, nil
+}
+
+// Key returns the cache key of the dataset name.
+func Key(name string) string {
+	return cache.NamespaceKey(Namespace, name)
+}
+
+// verify checks item's signature against the trusted keys.
+func (s *Store) verify(item *cache.CacheItem) error {
+	name := strings.TrimPrefix(item.Key, cache.NamespaceKey(Namespace, ""))
+	version := item.Metadata[VersionMetadata]
+	if version == "" {
+		return ErrNoVersion
+	}
+	encoded := item.Metadata[SignatureMetadata]
+	if encoded == "" {
+		return ErrUnsigned
+	}
+	key, trusted := s.trusted[item.Metadata[KeyIDMetadata]]
+	if !trusted {
+		return fmt.Errorf("%w %q", ErrUntrustedKey, item.Metadata[KeyIDMetadata])
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !ed25519.Verify(key, Message(name, version, item.Value), signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// signatureHook verifies datasets as they are written locally, arrive
+// from elsewhere and are read.
+type signatureHook struct {
+	store *Store
+}
+
+func (h *signatureHook) Name() string { return "dataset-signature" }
+
+func (h *signatureHook) BeforeSet(item *cache.CacheItem) error {
+	return h.check(item, "write")
+}
+
+func (h *signatureHook) AcceptRemote(item *cache.CacheItem) error {
+	return h.check(item, "replicated")
+}
+
+func (h *signatureHook) AfterGet(item *cache.CacheItem) (*cache.CacheItem, error) {
+	return item, h.check(item, "read")
+}
+
+func (h *signatureHook) check(item *cache.CacheItem, stage string) error {
+	err := h.store.verify(item)
+	if err != nil {
+		rejectedDatasets.Inc(stage)
+	}
+	return err
+}
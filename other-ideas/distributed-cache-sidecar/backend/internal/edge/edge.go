@@ -0,0 +1,304 @@
+package edge
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// In edge mode the node serves the frontend bundle itself, fetching each
+// asset from the origin on its first request and caching it in Namespace,
+// so a workshop can run from one container. Assets are cached per deploy:
+// their keys carry the deploy version and a generation, both kept in the
+// replicated deploy record, so deploying a new version switches every node
+// to it and purging bumps the generation, which no cached copy has yet.
+// Files whose path marks them as content-hashed never change under that
+// path and are served as immutable; the others, such as index.html, are
+// revalidated by browsers on every use.
+
+// Namespace is the cache namespace assets and the deploy record are kept
+// in.
+const Namespace = "edge"
+
+// deployKey is the key of the deploy record. Asset keys always contain a
+// '/' after the version, so none can collide with it.
+var deployKey = cache.NamespaceKey(Namespace, "deploy")
+
+var (
+	ErrInvalidPath    = errors.New("invalid asset path")
+	ErrInvalidVersion = errors.New("invalid deploy version")
+	ErrNotFound       = errors.New("asset not found at the origin")
+	ErrOrigin         = errors.New("origin request failed")
+)
+
+// Deploy is the deploy the node serves assets of.
+type Deploy struct {
+	Version    string `json:"version"`
+	Generation uint64 `json:"generation"`
+}
+
+// Asset is a file of the bundle.
+type Asset struct {
+	Name        string
+	Version     string
+	ContentType string
+	Body        []byte
+	// Immutable assets have a content hash in their path.
+	Immutable bool
+	// Cached reports whether the asset was served from the cache rather
+	// than fetched.
+	Cached bool
+	ETag   string
+}
+
+// VersionStats is how many assets of a deploy version this node holds.
+type VersionStats struct {
+	Version string `json:"version"`
+	Assets  int    `json:"assets"`
+	Bytes   int    `json:"bytes"`
+}
+
+// Cache serves assets from the cache, fetching the missing ones from the
+// origin. Concurrent misses of one asset on a node fetch it once.
+type Cache struct {
+	cfg          config.EdgeConfig
+	immutable    *regexp.Regexp
+	client       *http.Client
+	cacheManager *cache.Manager
+}
+
+// New returns a Cache fetching assets from cfg.Origin.
+func New(cfg config.EdgeConfig, cacheManager *cache.Manager) (*Cache, error) {
+	immutable, err := regexp.Compile(cfg.ImmutablePattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		cfg:          cfg,
+		immutable:    immutable,
+		client:       &http.Client{Timeout: time.Duration(cfg.TimeoutMS) * time.Millisecond},
+		cacheManager: cacheManager,
+	}, nil
+}
+
+// Key returns the cache key of the asset name of deploy.
+func Key(deploy Deploy, name string) string {
+	return cache.NamespaceKey(Namespace, fmt.Sprintf("%s/%d/%s", deploy.Version, deploy.Generation, name))
+}
+
+// Origin returns the origin URL without its query, which may hold a
+// shared access signature.
+func (c *Cache) Origin() string {
+	origin, _, _ := strings.Cut(c.cfg.Origin, "?")
+	return origin
+}
+
+// Current returns the deploy assets are served from: the deploy record,
+// or the configured version until one is made.
+func (c *Cache) Current(ctx context.Context) (Deploy, error) {
+	item, err := c.cacheManager.Read(ctx, deployKey, cache.ReadOptions{})
+	if errors.Is(err, cache.ErrNotFound) || errors.Is(err, cache.ErrExpired) {
+		return Deploy{Version: c.cfg.DeployVersion}, nil
+	}
+	if err != nil {
+		return Deploy{}, err
+	}
+	var deploy Deploy
+	if err := json.Unmarshal([]byte(item.Value), &deploy); err != nil {
+		return Deploy{}, fmt.Errorf("invalid deploy record: %v", err)
+	}
+	return deploy, nil
+}
+
+// Deploy makes every node serve the assets of version.
+func (c *Cache) Deploy(ctx context.Context, version string) (Deploy, error) {
+	if err := validVersion(version); err != nil {
+		return Deploy{}, err
+	}
+	deploy, err := c.Current(ctx)
+	if err != nil {
+		return Deploy{}, err
+	}
+	deploy.Version = version
+	return deploy, c.record(ctx, deploy)
+}
+
+// Purge deletes the cached assets of version on every node and returns how
+// many of this node's it deleted. If version is being served, its assets
+// are fetched again from the origin as they are requested.
+func (c *Cache) Purge(ctx context.Context, version string) (int, error) {
+	if err := validVersion(version); err != nil {
+		return 0, err
+	}
+	deploy, err := c.Current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// A new generation leaves behind every copy of the assets, including
+	// any the deletes below don't reach, so none of them is served again
+	// even if version is deployed once more.
+	deploy.Generation++
+	if err := c.record(ctx, deploy); err != nil {
+		return 0, err
+	}
+	return c.cacheManager.DeleteWhere(ctx, cache.NamespaceKey(Namespace, version+"/"), nil, cache.WriteOptions{})
+}
+
+func (c *Cache) record(ctx context.Context, deploy Deploy) error {
+	value, err := json.Marshal(deploy)
+	if err != nil {
+		return err
+	}
+	_, err = c.cacheManager.Write(ctx, deployKey, string(value), cache.WriteOptions{Encoding: codec.EncodingJSON})
+	return err
+}
+
+// Get returns the asset at the request path requestPath of the current
+// deploy. Paths ending in '/' stand for their index.html. A path without
+// an extension that the origin doesn't have is served the fallback
+// document instead, for the frontend's client-side routes.
+func (c *Cache) Get(ctx context.Context, requestPath string) (*Asset, error) {
+	name, err := assetName(requestPath)
+	if err != nil {
+		return nil, err
+	}
+	deploy, err := c.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	asset, err := c.load(ctx, deploy, name)
+	if errors.Is(err, ErrNotFound) && c.cfg.Fallback != "" && path.Ext(name) == "" {
+		asset, err = c.load(ctx, deploy, c.cfg.Fallback)
+	}
+	return asset, err
+}
+
+func (c *Cache) load(ctx context.Context, deploy Deploy, name string) (*Asset, error) {
+	immutable := c.immutable.MatchString(name)
+	ttl := time.Duration(c.cfg.TTLSeconds) * time.Second
+	if immutable {
+		ttl = time.Duration(c.cfg.ImmutableTTLSeconds) * time.Second
+	}
+
+	item, cached, err := c.cacheManager.GetOrLoad(ctx, Key(deploy, name), func(ctx context.Context) (string, error) {
+		return c.fetch(ctx, deploy.Version, name)
+	}, cache.WriteOptions{TTL: ttl, Encoding: codec.EncodingBinary})
+	if err != nil {
+		return nil, err
+	}
+	body, err := base64.StdEncoding.DecodeString(item.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset stored under %s: %v", item.Key, err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Asset{
+		Name:        name,
+		Version:     deploy.Version,
+		ContentType: contentType,
+		Body:        body,
+		Immutable:   immutable,
+		Cached:      cached,
+		ETag:        fmt.Sprintf("%q", deploy.Version+"-"+cache.ValueDigest(item.Value)[:16]),
+	}, nil
+}
+
+// fetch downloads the asset name of version from the origin and returns
+// it base64-encoded, as binary values are stored.
+func (c *Cache) fetch(ctx context.Context, version, name string) (string, error) {
+	origin, err := url.Parse(strings.ReplaceAll(c.cfg.Origin, "{version}", url.PathEscape(version)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOrigin, err)
+	}
+	origin.Path = strings.TrimSuffix(origin.Path, "/") + "/" + name
+	origin.RawPath = ""
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, origin.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOrigin, err)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOrigin, err)
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	case response.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%w: %s answered %s", ErrOrigin, name, response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, int64(c.cfg.MaxAssetBytes)+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOrigin, err)
+	}
+	if len(body) > c.cfg.MaxAssetBytes {
+		return "", fmt.Errorf("%w: %s is larger than %d bytes", ErrOrigin, name, c.cfg.MaxAssetBytes)
+	}
+	return base64.StdEncoding.EncodeToString(body), nil
+}
+
+// Stats returns how many assets of each deploy version this node holds,
+// ordered by version.
+func (c *Cache) Stats() []VersionStats {
+	prefix := cache.NamespaceKey(Namespace, "")
+	byVersion := make(map[string]*VersionStats)
+	for _, item := range c.cacheManager.View().Items {
+		version, _, isAsset := strings.Cut(strings.TrimPrefix(item.Key, prefix), "/")
+		if !strings.HasPrefix(item.Key, prefix) || !isAsset {
+			continue
+		}
+		stats := byVersion[version]
+		if stats == nil {
+			stats = &VersionStats{Version: version}
+			byVersion[version] = stats
+		}
+		stats.Assets++
+		stats.Bytes += base64.StdEncoding.DecodedLen(len(item.Value))
+	}
+
+	versions := make([]VersionStats, 0, len(byVersion))
+	for _, stats := range byVersion {
+		versions = append(versions, *stats)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions
+}
+
+// assetName returns the bundle path requestPath stands for.
+func assetName(requestPath string) (string, error) {
+	name := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if strings.HasSuffix(requestPath, "/") || name == "" {
+		name = path.Join(name, "index.html")
+	}
+	if strings.Contains(name, "\x00") {
+		return "", ErrInvalidPath
+	}
+	return name, nil
+}
+
+func validVersion(version string) error {
+	if version == "" || strings.ContainsAny(version, "/?#") {
+		return fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package eventhubs sends events to an Azure Event Hub over its REST API,
+// authenticating with a shared access signature from the hub's connection
+// string, so the node needs no AMQP client.
+package eventhubs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenLifetime is how long each shared access signature is valid.
+const tokenLifetime = time.Hour
+
+var ErrInvalidConnectionString = errors.New("invalid Event Hubs connection string")
+
+// Message is one event of a batch. Events with the same PartitionKey go to
+// the same partition, in the order they are sent; an empty key lets the
+// hub spread them.
+type Message struct {
+	Body         []byte
+	PartitionKey string
+	Properties   map[string]string
+}
+
+// Client sends batches to one Event Hub.
+type Client struct {
+	// endpoint is the hub's URL, which signatures also cover.
+	endpoint string
+	keyName  string
+	key      string
+	client   *http.Client
+}
+
+// New returns a Client for the Event Hub named by connectionString:
+// "Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=
+// <name>;SharedAccessKey=<key>;EntityPath=<hub>". A connection string
+// without an EntityPath names the hub with hub.
+func New(connectionString, hub string, timeout time.Duration) (*Client, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if found {
+			fields[strings.ToLower(name)] = value
+		}
+	}
+	if fields["entitypath"] != "" {
+		hub = fields["entitypath"]
+	}
+	endpoint, err := url.Parse(fields["endpoint"])
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: Endpoint must be sb://<namespace>.servicebus.windows.net/", ErrInvalidConnectionString)
+	}
+	if fields["sharedaccesskeyname"] == "" || fields["sharedaccesskey"] == "" {
+		return nil, fmt.Errorf("%w: SharedAccessKeyName and SharedAccessKey are required", ErrInvalidConnectionString)
+	}
+	if hub == "" {
+		return nil, fmt.Errorf("%w: no EntityPath naming the event hub", ErrInvalidConnectionString)
+	}
+
+	scheme := "https"
+	if endpoint.Scheme == "http" {
+		// Local emulators listen without TLS.
+		scheme = "http"
+	}
+	base := fmt.Sprintf("%s://%s/%s", scheme, endpoint.Host, url.PathEscape(hub))
+	return &Client{
+		endpoint: base,
+		keyName:  fields["sharedaccesskeyname"],
+		key:      fields["sharedaccesskey"],
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Hub returns the URL of the hub, which holds no secret.
+func (c *Client) Hub() string {
+	return c.endpoint
+}
+
+// batchMessage is the JSON form of a message in a batch send.
+type batchMessage struct {
+	Body             string            `json:"Body"`
+	BrokerProperties *brokerProperties `json:"BrokerProperties,omitempty"`
+	UserProperties   map[string]string `json:"UserProperties,omitempty"`
+}
+
+type brokerProperties struct {
+	PartitionKey string `json:"PartitionKey"`
+}
+
+// Send sends messages in order. A batch goes to one partition, so they are
+// sent as one batch per partition key, in the order the keys first appear;
+// if one fails, the batches before it have been sent and those after it
+// haven't.
+func (c *Client) Send(ctx context.Context, messages []Message) error {
+	var keys []string
+	byKey := make(map[string][]batchMessage)
+	for _, message := range messages {
+		if _, seen := byKey[message.PartitionKey]; !seen {
+			keys = append(keys, message.PartitionKey)
+		}
+		batched := batchMessage{Body: string(message.Body), UserProperties: message.Properties}
+		if message.PartitionKey != "" {
+			batched.BrokerProperties = &brokerProperties{PartitionKey: message.PartitionKey}
+		}
+		byKey[message.PartitionKey] = append(byKey[message.PartitionKey], batched)
+	}
+	for _, key := range keys {
+		if err := c.sendBatch(ctx, byKey[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBatch sends batch, which the hub accepts or refuses as a whole.
+func (c *Client) sendBatch(ctx context.Context, batch []batchMessage) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/messages?timeout=60&api-version=2014-01", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/vnd.microsoft.servicebus.json")
+	request.Header.Set("Authorization", c.signature(time.Now().Add(tokenLifetime)))
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("event hub answered %s: %s", response.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// signature returns a shared access signature for the hub valid until
+// expiry.
+func (c *Client) signature(expiry time.Time) string {
+	resource := url.QueryEscape(c.endpoint)
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(c.key))
+	mac.Write([]byte(resource + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", resource, url.QueryEscape(sig), se, url.QueryEscape(c.keyName))
+}
@@ -0,0 +1,133 @@
+// Package events keeps a bounded in-memory journal of recent significant
+// events: peer links coming and going, topology and mode changes, admin
+// changes to runtime settings, eviction spikes and errors. It is meant
+// for reconstructing what led up to an incident, so it is dumped to disk
+// when the process panics or receives SIGQUIT and can be read at any time
+// over the admin API.
+package events
+
+import (
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of events.
+const (
+	KindLifecycle = "lifecycle"
+	KindPeer      = "peer"
+	KindTopology  = "topology"
+	KindConfig    = "config"
+	KindEvictions = "evictions"
+	KindError     = "error"
+	KindPanic     = "panic"
+)
+
+var recorded = metrics.NewCounter("sidecar_events_recorded_total",
+	"Events recorded in the in-memory journal, by kind.", "kind")
+
+type Event struct {
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Message  string    `json:"message"`
+}
+
+var journal = struct {
+	mutex    sync.Mutex
+	events   []Event
+	next     int
+	sequence uint64
+}{
+	events: make([]Event, 0, 1000),
+}
+
+// Configure sets how many events are kept; the oldest are overwritten
+// first. Events already recorded are kept up to the new capacity.
+func Configure(capacity int) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	events := recentLocked()
+	if len(events) > capacity {
+		events = events[len(events)-capacity:]
+	}
+	journal.events = append(make([]Event, 0, capacity), events...)
+	journal.next = len(journal.events) % capacity
+}
+
+// Record adds an event to the journal.
+func Record(kind, format string, args ...interface{}) {
+	event := Event{Time: time.Now(), Kind: kind, Message: fmt.Sprintf(format, args...)}
+	recorded.Inc(kind)
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	journal.sequence++
+	event.Sequence = journal.sequence
+	if len(journal.events) < cap(journal.events) {
+		journal.events = append(journal.events, event)
+	} else {
+		journal.events[journal.next] = event
+	}
+	journal.next = (journal.next + 1) % cap(journal.events)
+}
+
+// Recent returns up to limit of the newest events after sequence after,
+// oldest first, optionally only those of kind. A limit of 0 returns all.
+func Recent(kind string, after uint64, limit int) []Event {
+	journal.mutex.Lock()
+	all := recentLocked()
+	journal.mutex.Unlock()
+
+	events := make([]Event, 0, len(all))
+	for _, event := range all {
+		if event.Sequence > after && (kind == "" || event.Kind == kind) {
+			events = append(events, event)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
+
+// recentLocked returns the journal oldest first. Callers must hold
+// journal.mutex.
+func recentLocked() []Event {
+	if len(journal.events) < cap(journal.events) {
+		return append([]Event(nil), journal.events...)
+	}
+	return append(append([]Event(nil), journal.events[journal.next:]...), journal.events[:journal.next]...)
+}
+
+// Dump is what Write puts on disk.
+type Dump struct {
+	NodeID   string    `json:"node_id"`
+	Reason   string    `json:"reason"`
+	DumpedAt time.Time `json:"dumped_at"`
+	Events   []Event   `json:"events"`
+}
+
+// Write dumps the whole journal to a new file in dir and returns its path.
+func Write(dir, nodeID, reason string) (string, error) {
+	dump := Dump{NodeID: nodeID, Reason: reason, DumpedAt: time.Now(), Events: Recent("", 0, 0)}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("events-%s.json", dump.DumpedAt.UTC().Format("20060102T150405.000000000Z")))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,126 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Experimental subsystems that can be switched off per node. Subsystems
+// add their flag here when they land.
+const (
+	UDF = "udf"
+)
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	Enabled     bool   `json:"enabled"`
+	Overridden  bool   `json:"overridden"`
+}
+
+// Flags holds the configured state of every known flag plus runtime
+// overrides set through the admin API. Overrides are node-local and are
+// lost on restart.
+type Flags struct {
+	flags     map[string]*Flag
+	overrides map[string]bool
+	mutex     sync.RWMutex
+}
+
+func NewFlags() *Flags {
+	f := &Flags{
+		flags:     make(map[string]*Flag),
+		overrides: make(map[string]bool),
+	}
+	f.define(UDF, true, "WebAssembly user-defined functions under /api/udf")
+	return f
+}
+
+func (f *Flags) define(name string, enabled bool, description string) {
+	f.flags[name] = &Flag{Name: name, Description: description, Default: enabled}
+}
+
+// Configure applies the configured value of each flag, replacing its
+// built-in default.
+func (f *Flags) Configure(values map[string]bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for name, enabled := range values {
+		flag, exists := f.flags[name]
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+		}
+		flag.Default = enabled
+	}
+	return nil
+}
+
+func (f *Flags) Enabled(name string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if enabled, overridden := f.overrides[name]; overridden {
+		return enabled
+	}
+	if flag, exists := f.flags[name]; exists {
+		return flag.Default
+	}
+	return false
+}
+
+func (f *Flags) Override(name string, enabled bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, exists := f.flags[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	f.overrides[name] = enabled
+	return nil
+}
+
+// ClearOverride reverts a flag to its configured value.
+func (f *Flags) ClearOverride(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, exists := f.flags[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	delete(f.overrides, name)
+	return nil
+}
+
+func (f *Flags) List() []Flag {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	flags := make([]Flag, 0, len(f.flags))
+	for name, flag := range f.flags {
+		flagCopy := *flag
+		flagCopy.Enabled, flagCopy.Overridden = f.overrides[name]
+		if !flagCopy.Overridden {
+			flagCopy.Enabled = flag.Default
+		}
+		flags = append(flags, flagCopy)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// Active returns the names of every enabled flag.
+func (f *Flags) Active() []string {
+	active := []string{}
+	for _, flag := range f.List() {
+		if flag.Enabled {
+			active = append(active, flag.Name)
+		}
+	}
+	return active
+}
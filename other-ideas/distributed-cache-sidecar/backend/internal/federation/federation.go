@@ -0,0 +1,354 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = logging.New("federation")
+
+const (
+	RolePrimary   = "primary"
+	RoleSecondary = "secondary"
+)
+
+var (
+	ErrReadOnly     = errors.New("key is mirrored from the primary cluster and read-only here")
+	ErrUnauthorized = errors.New("invalid federation token")
+	ErrNotSecondary = errors.New("cluster is not a federation secondary")
+)
+
+type Status struct {
+	Role            string    `json:"role"`
+	RemoteURL       string    `json:"remote_url,omitempty"`
+	Prefixes        []string  `json:"prefixes"`
+	Pending         int       `json:"pending"`
+	Dropped         int64     `json:"dropped"`
+	Sent            int64     `json:"sent"`
+	Failures        int64     `json:"failures"`
+	Received        int64     `json:"received"`
+	LagSeconds      float64   `json:"lag_seconds"`
+	LastSent        time.Time `json:"last_sent"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastReceived    time.Time `json:"last_received"`
+	LastMirroredTS  time.Time `json:"last_mirrored_timestamp"`
+	LastPromotionAt time.Time `json:"last_promotion_at"`
+}
+
+// Link mirrors writes under the configured prefixes to a remote cluster.
+// Only the primary side sends; the secondary accepts mirrored batches and
+// treats the mirrored prefixes as read-only until it is promoted.
+type Link struct {
+	cfg          config.FederationConfig
+	cacheManager *cache.Manager
+	client       *http.Client
+
+	role    string
+	pending []*cache.CacheItem
+	status  Status
+	wake    chan struct{}
+	stop    chan struct{}
+	mutex   sync.Mutex
+
+	// flushing serialises flushes, so the send loop, Demote and Drain
+	// never send the same batch twice or trim each other's items.
+	flushing sync.Mutex
+}
+
+func NewLink(cfg config.FederationConfig, cacheManager *cache.Manager) *Link {
+	l := &Link{
+		cfg:          cfg,
+		cacheManager: cacheManager,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		role:         cfg.Role,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+
+	cacheManager.AddChangeListener(l.enqueue)
+	cacheManager.AddHook("", &readOnlyHook{link: l})
+	return l
+}
+
+func (l *Link) Start() {
+	lifecycle.Go("federation-sender", l.cfg.RemoteURL, l.sendLoop)
+}
+
+func (l *Link) Stop() {
+	close(l.stop)
+}
+
+func (l *Link) Role() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.role
+}
+
+func (l *Link) mirrored(key string) bool {
+	for _, prefix := range l.cfg.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Link) enqueue(item *cache.CacheItem) {
+	// Only writes are mirrored.
+	if item.Deleted() || !l.mirrored(item.Key) {
+		return
+	}
+
+	l.mutex.Lock()
+	if l.role != RolePrimary || l.cfg.RemoteURL == "" {
+		l.mutex.Unlock()
+		return
+	}
+	if len(l.pending) >= l.cfg.MaxPending {
+		l.pending = l.pending[1:]
+		l.status.Dropped++
+	}
+	l.pending = append(l.pending, item)
+	full := len(l.pending) >= l.cfg.BatchSize
+	l.mutex.Unlock()
+
+	if full {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *Link) sendLoop() {
+	interval := time.Duration(l.cfg.FlushIntervalMS) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	backoff := interval
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		case <-l.wake:
+		}
+
+		for {
+			sent, err := l.flushBatch()
+			if err != nil {
+				logger.Printf("Federation mirror to %s failed: %v", l.cfg.RemoteURL, err)
+				events.Record(events.KindError, "Federation mirror to %s failed: %v", l.cfg.RemoteURL, err)
+				select {
+				case <-l.stop:
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = interval
+			if sent < l.cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// flushBatch sends the oldest pending items, up to a batch, and removes
+// them from the queue once the remote cluster has them.
+func (l *Link) flushBatch() (int, error) {
+	l.flushing.Lock()
+	defer l.flushing.Unlock()
+
+	l.mutex.Lock()
+	n := len(l.pending)
+	if n > l.cfg.BatchSize {
+		n = l.cfg.BatchSize
+	}
+	batch := append([]*cache.CacheItem(nil), l.pending[:n]...)
+	dropped := l.status.Dropped
+	l.mutex.Unlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	err := l.send(batch)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err != nil {
+		l.status.Failures++
+		l.status.LastError = err.Error()
+		return 0, err
+	}
+
+	// A full queue drops items from the front, so any dropped while
+	// sending were items of the batch, and only the rest are still queued.
+	remaining := n - int(l.status.Dropped-dropped)
+	if remaining > 0 {
+		l.pending = l.pending[remaining:]
+	}
+	l.status.Sent += int64(len(batch))
+	l.status.LastSent = time.Now()
+	l.status.LastError = ""
+	l.status.LastMirroredTS = batch[len(batch)-1].Timestamp
+	return len(batch), nil
+}
+
+func (l *Link) send(batch []*cache.CacheItem) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(l.cfg.RemoteURL, "/")+"/api/federation/apply", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+l.cfg.Token)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("remote cluster returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Authorize checks the bearer token presented by a remote cluster.
+func (l *Link) Authorize(header string) error {
+	token := strings.TrimPrefix(header, "Bearer ")
+	if l.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(l.cfg.Token)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Apply stores a batch mirrored from the primary cluster.
+func (l *Link) Apply(items []*cache.CacheItem) (int, error) {
+	if l.Role() != RoleSecondary {
+		return 0, ErrNotSecondary
+	}
+
+	applied := 0
+	for _, item := range items {
+		if !l.mirrored(item.Key) {
+			continue
+		}
+		if err := l.cacheManager.ApplyMirrored(item); err != nil {
+			logger.Printf("Rejected mirrored item %s: %v", item.Key, err)
+			continue
+		}
+		applied++
+	}
+
+	l.mutex.Lock()
+	l.status.Received += int64(applied)
+	l.status.LastReceived = time.Now()
+	if len(items) > 0 {
+		l.status.LastMirroredTS = items[len(items)-1].Timestamp
+	}
+	l.mutex.Unlock()
+	return applied, nil
+}
+
+// Promote makes this cluster the writable primary for the mirrored
+// prefixes, e.g. after the old primary region is lost.
+func (l *Link) Promote() Status {
+	l.mutex.Lock()
+	l.role = RolePrimary
+	l.status.LastPromotionAt = time.Now()
+	l.mutex.Unlock()
+	events.Record(events.KindConfig, "Federation role set to %s", RolePrimary)
+	return l.Status()
+}
+
+// Demote stops local writes to mirrored prefixes, waits up to timeout for
+// already-accepted writes to reach the remote cluster, then hands over the
+// primary role. Pending items still unsent at the deadline are reported.
+func (l *Link) Demote(ctx context.Context) Status {
+	l.mutex.Lock()
+	l.role = RoleSecondary
+	l.mutex.Unlock()
+	events.Record(events.KindConfig, "Federation role set to %s", RoleSecondary)
+
+	for {
+		sent, err := l.flushBatch()
+		if err != nil || sent == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return l.Status()
+		default:
+		}
+	}
+	return l.Status()
+}
+
+// Drain sends pending items to the remote cluster until none are left, a
+// send fails or ctx is done, and returns how many are still pending.
+func (l *Link) Drain(ctx context.Context) int {
+	for ctx.Err() == nil {
+		sent, err := l.flushBatch()
+		if err != nil || sent == 0 {
+			break
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.pending)
+}
+
+func (l *Link) Status() Status {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	status := l.status
+	status.Role = l.role
+	status.RemoteURL = l.cfg.RemoteURL
+	status.Prefixes = l.cfg.Prefixes
+	status.Pending = len(l.pending)
+	if len(l.pending) > 0 {
+		status.LagSeconds = time.Since(l.pending[0].Timestamp).Seconds()
+	} else if l.role == RoleSecondary && !status.LastReceived.IsZero() {
+		status.LagSeconds = status.LastReceived.Sub(status.LastMirroredTS).Seconds()
+	}
+	return status
+}
+
+type readOnlyHook struct {
+	link *Link
+}
+
+func (h *readOnlyHook) Name() string { return "federation-read-only" }
+
+func (h *readOnlyHook) BeforeSet(item *cache.CacheItem) error {
+	if h.link.mirrored(item.Key) && h.link.Role() == RoleSecondary {
+		return ErrReadOnly
+	}
+	return nil
+}
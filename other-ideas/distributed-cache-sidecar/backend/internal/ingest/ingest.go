@@ -0,0 +1,358 @@
+// Package ingest consumes Kafka topics into the cache, so reference data
+// maintained elsewhere lands on every node without anyone writing it
+// there. Topics are read through a Kafka REST Proxy, which can also front
+// the Kafka endpoint of an Event Hubs namespace. Each node consumes every
+// message in a consumer group of its own and stores it on itself only, as
+// replication would send each message to the peers that consume it too.
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/kafkarest"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = logging.New("ingest")
+
+var messagesTotal = metrics.NewCounter("sidecar_ingest_messages_total",
+	"Messages consumed into the cache, by topic and whether they were stored, deleted their key or were skipped.", "topic", "result")
+
+const (
+	// fetchTimeout is how long a fetch waits for messages to arrive.
+	fetchTimeout = time.Second
+	// maxBackoff bounds the wait before retrying after the proxy failed.
+	maxBackoff = 30 * time.Second
+)
+
+// TopicStatus counts the messages consumed from a topic.
+type TopicStatus struct {
+	Topic   string `json:"topic"`
+	Stored  int64  `json:"stored"`
+	Deleted int64  `json:"deleted"`
+	Skipped int64  `json:"skipped"`
+	// Offsets maps each partition read to the offset of the last message
+	// processed.
+	Offsets map[int]int64 `json:"offsets"`
+}
+
+// Status describes the consumer.
+type Status struct {
+	Proxy         string        `json:"proxy"`
+	Group         string        `json:"group"`
+	Topics        []TopicStatus `json:"topics"`
+	Failures      int64         `json:"failures"`
+	LastMessage   time.Time     `json:"last_message"`
+	LastError     string        `json:"last_error,omitempty"`
+	LastSkipError string        `json:"last_skip_error,omitempty"`
+}
+
+// Consumer stores the messages of the configured topics in the cache.
+type Consumer struct {
+	cfg          config.IngestConfig
+	client       *kafkarest.Client
+	group        string
+	name         string
+	topics       map[string]config.IngestTopic
+	cacheManager *cache.Manager
+
+	status Status
+	mutex  sync.Mutex
+}
+
+// New returns a Consumer for the topics of cfg, consuming as nodeID.
+func New(cfg config.IngestConfig, nodeID string, cacheManager *cache.Manager) *Consumer {
+	c := &Consumer{
+		cfg:          cfg,
+		client:       kafkarest.New(cfg.KafkaRESTURL, 30*time.Second),
+		group:        cfg.Group + "-" + nodeID,
+		name:         nodeID,
+		topics:       make(map[string]config.IngestTopic, len(cfg.Topics)),
+		cacheManager: cacheManager,
+	}
+	c.status = Status{Proxy: c.client.String(), Group: c.group, Topics: make([]TopicStatus, len(cfg.Topics))}
+	for i, topic := range cfg.Topics {
+		c.topics[topic.Topic] = topic
+		c.status.Topics[i] = TopicStatus{Topic: topic.Topic, Offsets: map[int]int64{}}
+	}
+	return c
+}
+
+// Start consumes the topics until the process begins shutting down. When
+// the proxy fails, the consumer instance is recreated after a backoff and
+// resumes from the last offsets committed.
+func (c *Consumer) Start() {
+	lifecycle.Go("ingest-consumer", c.group, func() {
+		interval := time.Duration(c.cfg.PollIntervalMS) * time.Millisecond
+		backoff := interval
+		for {
+			err := c.consume()
+			if err == nil {
+				return
+			}
+			c.mutex.Lock()
+			c.status.Failures++
+			c.status.LastError = err.Error()
+			c.mutex.Unlock()
+			logger.Printf("Failed to consume %s through %s: %v", strings.Join(c.topicNames(), ","), c.client, err)
+			events.Record(events.KindError, "Failed to consume %s through %s: %v", strings.Join(c.topicNames(), ","), c.client, err)
+
+			select {
+			case <-lifecycle.Stopping():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < maxBackoff {
+				backoff *= 2
+			}
+		}
+	})
+}
+
+// Status returns the consumer's counters.
+func (c *Consumer) Status() Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := c.status
+	status.Topics = make([]TopicStatus, len(c.status.Topics))
+	for i, topic := range c.status.Topics {
+		status.Topics[i] = topic
+		status.Topics[i].Offsets = make(map[int]int64, len(topic.Offsets))
+		for partition, offset := range topic.Offsets {
+			status.Topics[i].Offsets[partition] = offset
+		}
+	}
+	return status
+}
+
+func (c *Consumer) topicNames() []string {
+	names := make([]string, len(c.cfg.Topics))
+	for i, topic := range c.cfg.Topics {
+		names[i] = topic.Topic
+	}
+	return names
+}
+
+// consume runs one consumer instance until the process begins shutting
+// down, returning nil, or the proxy fails.
+func (c *Consumer) consume() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-lifecycle.Stopping():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	consumer, err := c.client.NewConsumer(ctx, c.group, c.name)
+	if err != nil {
+		return fmt.Errorf("creating consumer: %w", err)
+	}
+	defer func() {
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer closeCancel()
+		if err := consumer.Close(closeCtx); err != nil {
+			logger.Printf("Failed to close consumer of %s: %v", c.group, err)
+		}
+	}()
+	if err := consumer.Subscribe(ctx, c.topicNames()); err != nil {
+		return fmt.Errorf("subscribing: %w", err)
+	}
+
+	interval := time.Duration(c.cfg.PollIntervalMS) * time.Millisecond
+	for {
+		messages, err := consumer.Fetch(ctx, fetchTimeout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("fetching: %w", err)
+		}
+		if len(messages) == 0 {
+			select {
+			case <-lifecycle.Stopping():
+				return nil
+			case <-time.After(interval):
+			}
+			continue
+		}
+
+		last := make(map[string]map[int]int64)
+		for _, message := range messages {
+			c.apply(message)
+			if last[message.Topic] == nil {
+				last[message.Topic] = make(map[int]int64)
+			}
+			last[message.Topic][message.Partition] = message.Offset
+		}
+		var commit []kafkarest.Offset
+		for topic, partitions := range last {
+			for partition, offset := range partitions {
+				commit = append(commit, kafkarest.Offset{Topic: topic, Partition: partition, Offset: offset})
+			}
+		}
+		if err := consumer.Commit(ctx, commit); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("committing offsets: %w", err)
+		}
+		c.mutex.Lock()
+		for i := range c.status.Topics {
+			for partition, offset := range last[c.status.Topics[i].Topic] {
+				c.status.Topics[i].Offsets[partition] = offset
+			}
+		}
+		c.status.LastMessage = time.Now()
+		c.status.LastError = ""
+		c.mutex.Unlock()
+	}
+}
+
+// apply stores message, or deletes its key if its value is null. A
+// message that can't be stored is skipped, so one bad message doesn't
+// hold up its partition.
+func (c *Consumer) apply(message kafkarest.Message) {
+	topic := c.topics[message.Topic]
+	result := "stored"
+	deleted, err := c.store(topic, message)
+	if deleted {
+		result = "deleted"
+	}
+	if err != nil {
+		result = "skipped"
+		logger.Printf("Skipped message %d of %s partition %d: %v", message.Offset, message.Topic, message.Partition, err)
+	}
+	messagesTotal.Inc(message.Topic, result)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range c.status.Topics {
+		if c.status.Topics[i].Topic != message.Topic {
+			continue
+		}
+		switch result {
+		case "stored":
+			c.status.Topics[i].Stored++
+		case "deleted":
+			c.status.Topics[i].Deleted++
+		default:
+			c.status.Topics[i].Skipped++
+			c.status.LastSkipError = fmt.Sprintf("%s partition %d offset %d: %v", message.Topic, message.Partition, message.Offset, err)
+		}
+	}
+}
+
+// store writes message to the cache, or for a tombstone, a message with
+// a null value, deletes the key of the message and reports it deleted.
+func (c *Consumer) store(topic config.IngestTopic, message kafkarest.Message) (bool, error) {
+	ctx := context.Background()
+	if isNull(message.Value) {
+		key, err := jsonString(message.Key)
+		if err != nil {
+			return false, fmt.Errorf("tombstone key %v", err)
+		}
+		err = c.cacheManager.Remove(ctx, topic.KeyPrefix+key, cache.WriteOptions{LocalOnly: true})
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return false, err
+		}
+		return true, nil
+	}
+
+	var fields map[string]json.RawMessage
+	json.Unmarshal(message.Value, &fields)
+	rawKey := message.Key
+	if topic.KeyField != "" {
+		rawKey = field(fields, topic.KeyField)
+		if rawKey == nil {
+			return false, fmt.Errorf("value has no %s", topic.KeyField)
+		}
+	}
+	key, err := jsonString(rawKey)
+	if err != nil {
+		return false, fmt.Errorf("key %v", err)
+	}
+
+	options := cache.WriteOptions{
+		TTL:       time.Duration(topic.TTLSeconds) * time.Second,
+		LocalOnly: true,
+	}
+	if topic.TTLField != "" {
+		if rawTTL := field(fields, topic.TTLField); rawTTL != nil {
+			var seconds int64
+			if err := json.Unmarshal(rawTTL, &seconds); err != nil || seconds < 0 {
+				return false, fmt.Errorf("%s must be a number of seconds", topic.TTLField)
+			}
+			options.TTL = time.Duration(seconds) * time.Second
+		}
+	}
+
+	var value string
+	if err := json.Unmarshal(message.Value, &value); err != nil {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, message.Value); err != nil {
+			return false, err
+		}
+		value = compact.String()
+		options.Encoding = codec.EncodingJSON
+	}
+	_, err = c.cacheManager.Write(ctx, topic.KeyPrefix+key, value, options)
+	return false, err
+}
+
+// field returns the member of fields at path, a dotted path into nested
+// objects, or nil if there is none.
+func field(fields map[string]json.RawMessage, path string) json.RawMessage {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		raw, ok := fields[name]
+		if !ok || isNull(raw) {
+			return nil
+		}
+		if i == len(names)-1 {
+			return raw
+		}
+		fields = nil
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// jsonString returns raw, a JSON string or number, as text.
+func jsonString(raw json.RawMessage) (string, error) {
+	if isNull(raw) {
+		return "", errors.New("is missing")
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if text == "" {
+			return "", errors.New("is empty")
+		}
+		return text, nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String(), nil
+	}
+	return "", fmt.Errorf("%s is not a string or number", raw)
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(bytes.TrimSpace(raw)) == "null"
+}
@@ -0,0 +1,119 @@
+package kafkarest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Message is a record fetched by a Consumer. Key and Value are the JSON
+// the record was produced with, null if it had none.
+type Message struct {
+	Topic     string          `json:"topic"`
+	Key       json.RawMessage `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+}
+
+// Offset is the position of a message in a partition.
+type Offset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Consumer is a consumer instance the proxy holds for a consumer group.
+// It reads JSON records, starting from the earliest one for partitions
+// the group has no committed offset for, and commits offsets only when
+// told to. The proxy forgets an instance left idle for a few minutes,
+// after which its calls fail with a 404 StatusError and a new one has to
+// be created.
+type Consumer struct {
+	client *Client
+	path   string
+}
+
+// NewConsumer creates the consumer instance name in group, replacing one
+// of that name left behind by an earlier run.
+func (c *Client) NewConsumer(ctx context.Context, group, name string) (*Consumer, error) {
+	body, err := json.Marshal(map[string]string{
+		"name":               name,
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	})
+	if err != nil {
+		return nil, err
+	}
+	consumer := &Consumer{
+		client: c,
+		path:   "/consumers/" + url.PathEscape(group) + "/instances/" + url.PathEscape(name),
+	}
+
+	create := func() error {
+		return c.do(ctx, http.MethodPost, "/consumers/"+url.PathEscape(group), acceptV2, acceptV2, body, nil)
+	}
+	err = create()
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+		if err := consumer.Close(ctx); err != nil {
+			return nil, err
+		}
+		err = create()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// Subscribe subscribes the consumer to topics, replacing any earlier
+// subscription.
+func (c *Consumer) Subscribe(ctx context.Context, topics []string) error {
+	body, err := json.Marshal(map[string][]string{"topics": topics})
+	if err != nil {
+		return err
+	}
+	return c.client.do(ctx, http.MethodPost, c.path+"/subscription", acceptV2, acceptV2, body, nil)
+}
+
+// Fetch returns the next messages of the subscribed topics, waiting up to
+// timeout for some to arrive.
+func (c *Consumer) Fetch(ctx context.Context, timeout time.Duration) ([]Message, error) {
+	var messages []Message
+	path := fmt.Sprintf("%s/records?timeout=%d", c.path, timeout.Milliseconds())
+	if err := c.client.do(ctx, http.MethodGet, path, "", contentTypeJSON, nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Commit commits the given offsets for the group: each is the offset of
+// the last message processed in its partition, and the group resumes
+// after it.
+func (c *Consumer) Commit(ctx context.Context, offsets []Offset) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string][]Offset{"offsets": offsets})
+	if err != nil {
+		return err
+	}
+	return c.client.do(ctx, http.MethodPost, c.path+"/offsets", acceptV2, acceptV2, body, nil)
+}
+
+// Close removes the consumer instance, so its partitions are reassigned
+// at once. Closing an instance the proxy no longer holds succeeds.
+func (c *Consumer) Close(ctx context.Context) error {
+	err := c.client.do(ctx, http.MethodDelete, c.path, acceptV2, acceptV2, []byte{}, nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
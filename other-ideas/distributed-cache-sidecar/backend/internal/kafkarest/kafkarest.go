@@ -0,0 +1,139 @@
+// Package kafkarest produces to and consumes from Kafka topics through a
+// Kafka REST Proxy speaking the v2 API, such as Confluent's, so the node
+// needs no Kafka client. The proxy can front any Kafka cluster, including the Kafka
+// endpoint of an Event Hubs namespace.
+package kafkarest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeJSON = "application/vnd.kafka.json.v2+json"
+	acceptV2        = "application/vnd.kafka.v2+json"
+)
+
+// Record is a message to produce. Records with the same Key go to the same
+// partition, in the order they are produced.
+type Record struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Client talks to one REST proxy.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// New returns a Client for the REST proxy at baseURL. Credentials for it
+// may be given in the URL's user info.
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+// String returns the proxy URL without its credentials.
+func (c *Client) String() string {
+	parsed, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "kafka-rest"
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// produceResponse is the proxy's answer to a produce request: an offset,
+// or an error, for each record.
+type produceResponse struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		Offset    int64   `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Produce appends records to topic. It fails if the proxy refuses the
+// request or any of the records, in which case some of them may still
+// have been written.
+func (c *Client) Produce(ctx context.Context, topic string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string][]Record{"records": records})
+	if err != nil {
+		return err
+	}
+	var response produceResponse
+	if err := c.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topic), contentTypeJSON, acceptV2, body, &response); err != nil {
+		return err
+	}
+	for _, offset := range response.Offsets {
+		if offset.Error != nil || offset.ErrorCode != nil {
+			message := ""
+			if offset.Error != nil {
+				message = *offset.Error
+			}
+			return fmt.Errorf("kafka refused a record for partition %d: %s", offset.Partition, message)
+		}
+	}
+	return nil
+}
+
+// StatusError is an error answer of the proxy.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Detail     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kafka REST proxy answered %s: %s", e.Status, e.Detail)
+}
+
+// do sends a request to the proxy and decodes its JSON answer, of the
+// accept media type, into result if it isn't nil. An error answer is
+// returned as a *StatusError.
+func (c *Client) do(ctx context.Context, method, path, contentType, accept string, body []byte, result interface{}) error {
+	target, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return err
+	}
+	user := target.User
+	target.User = nil
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		password, _ := user.Password()
+		request.SetBasicAuth(user.Username(), password)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+	request.Header.Set("Accept", accept)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return &StatusError{StatusCode: response.StatusCode, Status: response.Status, Detail: strings.TrimSpace(string(detail))}
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,342 @@
+package licensing
+
+import (
+	"context"
+	"crypto/sha256"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var logger = logging.New("licensing")
+
+// Namespace is the cache namespace calculation results are stored in, so
+// they can be listed, measured and flushed like any namespace.
+const Namespace = "calc"
+
+// PricingVersionMetadata is the item metadata naming the pricing sheet
+// version a result was calculated with.
+const PricingVersionMetadata = "pricing_version"
+
+// resultPrefix is the key prefix, within Namespace, of licensing results.
+const resultPrefix = "licensing:"
+
+var (
+	ErrInvalidRequest = errors.New("invalid licensing request")
+	ErrNoPrice        = errors.New("no price for edition and license model")
+	ErrInvalidSheet   = errors.New("invalid pricing sheet")
+)
+
+// Price is what one edition costs under one license model: per core, or
+// per server plus per client access license (CAL).
+type Price struct {
+	ID           string  `json:"id"`
+	Edition      string  `json:"edition"`
+	LicenseType  string  `json:"license_type"`
+	PricePerUnit float64 `json:"price_per_unit,omitempty"`
+	ServerPrice  float64 `json:"server_price,omitempty"`
+	CALPrice     float64 `json:"cal_price,omitempty"`
+}
+
+// Sheet is a version of the pricing dataset. Results calculated with a
+// sheet are cached for its ResultTTL seconds, or the configured TTL if 0.
+type Sheet struct {
+	Version   string  `json:"version"`
+	ResultTTL int64   `json:"result_ttl,omitempty"`
+	Prices    []Price `json:"prices"`
+}
+
+// DefaultSheet is used while the pricing key holds no sheet. It carries
+// the list prices the training material is written against.
+var DefaultSheet = Sheet{
+	Version: "default",
+	Prices: []Price{
+		{ID: "std-core", Edition: "Standard", LicenseType: "PerCore", PricePerUnit: 3586},
+		{ID: "ent-core", Edition: "Enterprise", LicenseType: "PerCore", PricePerUnit: 14256},
+		{ID: "std-cal", Edition: "Standard", LicenseType: "ServerCAL", ServerPrice: 931, CALPrice: 209},
+		{ID: "ent-cal", Edition: "Enterprise", LicenseType: "ServerCAL", ServerPrice: 14256, CALPrice: 209},
+	},
+}
+
+const (
+	// minimumCores are billed however few cores a server has.
+	minimumCores = 4
+	// assuranceRate is Software Assurance as a share of the license cost.
+	assuranceRate = 0.25
+)
+
+// Request is a licensing cost calculation, in the form the training
+// API's cost model takes.
+type Request struct {
+	WorkloadType string `json:"workload_type"`
+	Edition      string `json:"edition"`
+	LicenseModel string `json:"license_model"`
+	CoreCount    int    `json:"core_count"`
+	UserCount    *int   `json:"user_count,omitempty"`
+	IncludeSA    *bool  `json:"include_sa,omitempty"`
+	TermYears    int    `json:"term_years,omitempty"`
+}
+
+// Result is a calculated licensing cost, as stored in the cache.
+type Result struct {
+	TotalCost       float64   `json:"total_cost"`
+	AnnualBreakdown []float64 `json:"annual_breakdown"`
+	CostPerUser     *float64  `json:"cost_per_user"`
+	Notes           string    `json:"notes"`
+	PricingVersion  string    `json:"pricing_version"`
+}
+
+// Calculator answers licensing cost calculations from the cache,
+// calculating them against the pricing sheet stored under the pricing key
+// on a miss. Changing or deleting the sheet drops every cached result.
+type Calculator struct {
+	cfg          config.LicensingConfig
+	cacheManager *cache.Manager
+	changed      chan struct{}
+}
+
+// New returns a Calculator and starts dropping cached results whenever
+// the pricing key changes, here or through replication.
+func New(cfg config.LicensingConfig, cacheManager *cache.Manager) *Calculator {
+	c := &Calculator{cfg: cfg, cacheManager: cacheManager, changed: make(chan struct{}, 1)}
+	cacheManager.AddMutationListener(func(mutation cache.Mutation) {
+		if mutation.Key != cfg.PricingKey && mutation.Op != cache.MutationReset {
+			return
+		}
+		select {
+		case c.changed <- struct{}{}:
+		default:
+		}
+	})
+	lifecycle.Go("licensing-invalidator", cfg.PricingKey, c.invalidate)
+	return c
+}
+
+func (c *Calculator) invalidate() {
+	for {
+		select {
+		case <-c.changed:
+		case <-lifecycle.Stopping():
+			return
+		}
+		deleted, err := c.Invalidate(context.Background())
+		if err != nil {
+			logger.Printf("Dropping licensing results after a pricing change failed: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			logger.Printf("Pricing sheet %s changed, dropped %d cached licensing results", c.cfg.PricingKey, deleted)
+		}
+	}
+}
+
+// Invalidate deletes every cached licensing result, here and, through the
+// replicated deletes, on peers, and returns how many this node held.
+func (c *Calculator) Invalidate(ctx context.Context) (int, error) {
+	return c.cacheManager.DeleteWhere(ctx, cache.NamespaceKey(Namespace, resultPrefix), nil, cache.WriteOptions{})
+}
+
+// Sheet returns the pricing sheet under the pricing key, or DefaultSheet
+// if there is none.
+func (c *Calculator) Sheet(ctx context.Context) (*Sheet, error) {
+	item, err := c.cacheManager.Read(ctx, c.cfg.PricingKey, cache.ReadOptions{})
+	var keyErr *cache.KeyError
+	if errors.As(err, &keyErr) && keyErr.Cause != nil {
+		// A hook refused the sheet, such as a signed one that doesn't
+		// verify; pricing with the defaults instead would hide that.
+		return nil, fmt.Errorf("%w under %s: %v", ErrInvalidSheet, c.cfg.PricingKey, keyErr.Cause)
+	}
+	if errors.Is(err, cache.ErrNotFound) || errors.Is(err, cache.ErrExpired) {
+		sheet := DefaultSheet
+		return &sheet, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := c.cacheManager.Codecs().Transcode(item.Value, item.Encoding, codec.EncodingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w under %s: %v", ErrInvalidSheet, c.cfg.PricingKey, err)
+	}
+	var sheet Sheet
+	if err := json.Unmarshal([]byte(document), &sheet); err != nil {
+		return nil, fmt.Errorf("%w under %s: %v", ErrInvalidSheet, c.cfg.PricingKey, err)
+	}
+	if sheet.Version == "" || len(sheet.Prices) == 0 || sheet.ResultTTL < 0 {
+		return nil, fmt.Errorf("%w under %s: it needs a version and prices", ErrInvalidSheet, c.cfg.PricingKey)
+	}
+	return &sheet, nil
+}
+
+// Calculate returns the cached result of request against the current
+// pricing sheet, calculating it if there is none, and reports whether the
+// result was cached.
+func (c *Calculator) Calculate(ctx context.Context, request Request) (*cache.CacheItem, bool, error) {
+	sheet, err := c.Sheet(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	price, err := sheet.price(request.Edition, request.LicenseModel)
+	if err != nil {
+		return nil, false, err
+	}
+	request = request.normalize(price)
+	if err := request.validate(); err != nil {
+		return nil, false, err
+	}
+	key, err := Key(sheet.Version, request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ttl := sheet.ResultTTL
+	if ttl == 0 {
+		ttl = int64(c.cfg.CacheTTLSeconds)
+	}
+	options := cache.WriteOptions{
+		TTL:      time.Duration(ttl) * time.Second,
+		Encoding: codec.EncodingJSON,
+		Metadata: map[string]string{PricingVersionMetadata: sheet.Version},
+	}
+	return c.cacheManager.GetOrLoad(ctx, key, func(ctx context.Context) (string, error) {
+		result := calculate(request, price)
+		result.PricingVersion = sheet.Version
+		document, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		return string(document), nil
+	}, options)
+}
+
+// Key is the cache key of the result of request against a pricing sheet
+// version: a hash of both, so equal requests share a result and a new
+// sheet version never reads an old one.
+func Key(version string, request Request) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(version))
+	hash.Write([]byte{0})
+	hash.Write(encoded)
+	return cache.NamespaceKey(Namespace, resultPrefix+hex.EncodeToString(hash.Sum(nil)[:16])), nil
+}
+
+// price returns the sheet's price for edition under licenseModel, matched
+// without case.
+func (s *Sheet) price(edition, licenseModel string) (*Price, error) {
+	for i := range s.Prices {
+		price := &s.Prices[i]
+		if strings.EqualFold(price.Edition, edition) && strings.EqualFold(price.LicenseType, licenseModel) {
+			return price, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s in pricing sheet %s", ErrNoPrice, edition, licenseModel, s.Version)
+}
+
+// normalize fills in the defaults and spells the edition and license
+// model as the sheet does, so requests that differ only in those share a
+// key. Inputs that don't affect the result are dropped for the same
+// reason.
+func (r Request) normalize(price *Price) Request {
+	r.Edition = price.Edition
+	r.LicenseModel = price.LicenseType
+	if r.IncludeSA == nil {
+		include := true
+		r.IncludeSA = &include
+	}
+	if r.TermYears == 0 {
+		r.TermYears = 3
+	}
+	switch r.WorkloadType {
+	case "AzureVM", "AzureSQLMI":
+	default:
+		r.WorkloadType = ""
+	}
+	return r
+}
+
+func (r Request) validate() error {
+	switch {
+	case r.TermYears < 1:
+		return fmt.Errorf("%w: term_years must be at least 1", ErrInvalidRequest)
+	case r.LicenseModel == "PerCore" && r.CoreCount < 1:
+		return fmt.Errorf("%w: core_count must be at least 1", ErrInvalidRequest)
+	case r.LicenseModel == "ServerCAL" && (r.UserCount == nil || *r.UserCount < 1):
+		return fmt.Errorf("%w: user_count is required for Server+CAL licensing", ErrInvalidRequest)
+	case r.LicenseModel != "PerCore" && r.LicenseModel != "ServerCAL":
+		return fmt.Errorf("%w: unknown license model %s", ErrInvalidRequest, r.LicenseModel)
+	case r.UserCount != nil && *r.UserCount < 0:
+		return fmt.Errorf("%w: user_count must not be negative", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// calculate works out the cost of a normalized, valid request with the
+// same rules as the training API's cost model.
+func calculate(request Request, price *Price) *Result {
+	var total float64
+	var notes []string
+
+	switch request.LicenseModel {
+	case "PerCore":
+		cores := request.CoreCount
+		if cores < minimumCores {
+			cores = minimumCores
+		}
+		total = float64(cores) * price.PricePerUnit
+		if *request.IncludeSA {
+			total += total * assuranceRate
+			notes = append(notes, "Software Assurance included (25% of license cost)")
+		}
+		notes = append(notes, fmt.Sprintf("Minimum %d cores enforced (requested: %d, billed: %d)", minimumCores, request.CoreCount, cores))
+	case "ServerCAL":
+		cals := float64(*request.UserCount) * price.CALPrice
+		total = price.ServerPrice + cals
+		if *request.IncludeSA {
+			total += total * assuranceRate
+			notes = append(notes, "Software Assurance included (25% of total cost)")
+		}
+		notes = append(notes, fmt.Sprintf("Server license: %s, CAL licenses: %d × $%v = %s",
+			dollars(price.ServerPrice), *request.UserCount, price.CALPrice, dollars(cals)))
+	}
+
+	switch request.WorkloadType {
+	case "AzureVM":
+		notes = append(notes, "Consider Azure Hybrid Benefit for potential cost savings")
+	case "AzureSQLMI":
+		notes = append(notes, "Azure SQL Managed Instance uses vCore-based pricing")
+	}
+
+	result := &Result{TotalCost: total, Notes: strings.Join(notes, "; ")}
+	annual := total / float64(request.TermYears)
+	for year := 0; year < request.TermYears; year++ {
+		result.AnnualBreakdown = append(result.AnnualBreakdown, annual)
+	}
+	if request.UserCount != nil && *request.UserCount > 0 {
+		perUser := total / float64(*request.UserCount)
+		result.CostPerUser = &perUser
+	}
+	return result
+}
+
+// dollars formats amount as $1,234.56.
+func dollars(amount float64) string {
+	cents := int64(math.Round(amount * 100))
+	whole := fmt.Sprint(cents / 100)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return fmt.Sprintf("$%s.%02d", whole, cents%100)
+}
@@ -0,0 +1,116 @@
+// Package lifecycle registers the process's long-lived goroutines, so a
+// shutdown can check that every one of them has exited and a goroutine
+// that outlives its connection or its component shows up as a leak
+// instead of going unnoticed.
+package lifecycle
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+var liveGauge = metrics.NewGauge("sidecar_goroutines_registered",
+	"Registered long-lived goroutines that are running, by name.", "name")
+
+// Goroutine is a registered goroutine. Name says what it is, e.g.
+// "peer-reader", and Detail which one, e.g. the peer's address.
+type Goroutine struct {
+	ID      uint64    `json:"id"`
+	Name    string    `json:"name"`
+	Detail  string    `json:"detail,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+var registry = struct {
+	mutex    sync.Mutex
+	next     uint64
+	live     map[uint64]Goroutine
+	byName   map[string]int
+	exited   chan struct{}
+	stopping chan struct{}
+	stopOnce sync.Once
+}{
+	live:     make(map[uint64]Goroutine),
+	byName:   make(map[string]int),
+	exited:   make(chan struct{}),
+	stopping: make(chan struct{}),
+}
+
+// Go runs fn in a new goroutine registered under name until fn returns.
+func Go(name, detail string, fn func()) {
+	done := Enter(name, detail)
+	go func() {
+		defer done()
+		fn()
+	}()
+}
+
+// Enter registers the calling goroutine, for long-lived ones the process
+// didn't start itself such as HTTP handlers serving a WebSocket. Call the
+// returned function when it exits.
+func Enter(name, detail string) func() {
+	registry.mutex.Lock()
+	registry.next++
+	id := registry.next
+	registry.live[id] = Goroutine{ID: id, Name: name, Detail: detail, Started: time.Now()}
+	registry.byName[name]++
+	liveGauge.Set(float64(registry.byName[name]), name)
+	registry.mutex.Unlock()
+
+	return func() {
+		registry.mutex.Lock()
+		defer registry.mutex.Unlock()
+		delete(registry.live, id)
+		registry.byName[name]--
+		liveGauge.Set(float64(registry.byName[name]), name)
+		close(registry.exited)
+		registry.exited = make(chan struct{})
+	}
+}
+
+// Stopping is closed once shutdown starts. Goroutines with no stop signal
+// of their own wait on it.
+func Stopping() <-chan struct{} {
+	return registry.stopping
+}
+
+// Stop closes Stopping.
+func Stop() {
+	registry.stopOnce.Do(func() { close(registry.stopping) })
+}
+
+// Live returns the registered goroutines still running, oldest first.
+func Live() []Goroutine {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	live := make([]Goroutine, 0, len(registry.live))
+	for _, g := range registry.live {
+		live = append(live, g)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+	return live
+}
+
+// Wait blocks until every registered goroutine has exited or ctx is done,
+// and returns the ones still running.
+func Wait(ctx context.Context) []Goroutine {
+	for {
+		registry.mutex.Lock()
+		if len(registry.live) == 0 {
+			registry.mutex.Unlock()
+			return nil
+		}
+		exited := registry.exited
+		registry.mutex.Unlock()
+
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			return Live()
+		}
+	}
+}
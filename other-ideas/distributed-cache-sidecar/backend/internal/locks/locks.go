@@ -0,0 +1,320 @@
+package locks
+
+import (
+	"context"
+	"crypto/rand"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/network"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A lock is a lease on a name: whoever holds it until it expires or is
+// released is its only owner in the cluster. Replicating a lease like any
+// other item would let two nodes grant it at once and settle on one of
+// them later, so leases aren't replicated that way. Instead every node
+// keeps its own grants in memory, outside the cache, where neither
+// eviction nor writes to the cache can touch them, and a lease is
+// acquired by asking every node of the cluster for a grant: it is held once a majority granted it. Two owners would
+// need a majority each, and any two majorities share a node, which grants
+// a name to one token at a time. Each node times a grant from when it made
+// it, which is after the owner started asking, so a node lets a lease go
+// no earlier than its owner does, whatever the clocks say.
+
+// requestTimeout bounds how long a node waits for a peer's answer.
+const requestTimeout = 2 * time.Second
+
+var (
+	ErrInvalidLock = errors.New("invalid lock request")
+	ErrHeld        = errors.New("lock is held by another owner")
+	ErrNotHeld     = errors.New("lock is not held")
+	ErrNoQuorum    = errors.New("lock not granted by a majority of nodes")
+)
+
+// Lease is a held lock. Token identifies its owner: it renews and
+// releases the lease, and is only ever returned to whoever acquired it.
+type Lease struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	TTLMS     int64     `json:"ttl_ms"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Granted is how many of the cluster's Nodes granted the lease.
+	Granted int `json:"granted,omitempty"`
+	Nodes   int `json:"nodes,omitempty"`
+}
+
+// lockRequest is the payload of the LOCK and UNLOCK commands.
+type lockRequest struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Owner string `json:"owner,omitempty"`
+	TTLMS int64  `json:"ttl_ms,omitempty"`
+}
+
+// Locks grants and releases leases on this node and acquires them across
+// the cluster.
+type Locks struct {
+	cfg         config.LocksConfig
+	peers       []string
+	peerManager *network.PeerManager
+
+	// grants holds this node's grants by lock name. A grant is live until
+	// its ExpiresAt, which carries the monotonic clock reading it was
+	// granted at.
+	grants map[string]*Lease
+	// mutex makes checking and changing a grant on this node one step.
+	mutex sync.Mutex
+}
+
+// New returns Locks asking the nodes at the peer addresses for grants.
+func New(cfg config.LocksConfig, peers []string, peerManager *network.PeerManager) *Locks {
+	return &Locks{cfg: cfg, peers: peers, peerManager: peerManager, grants: make(map[string]*Lease)}
+}
+
+// RegisterCommands lets other nodes ask this one for grants.
+func (l *Locks) RegisterCommands(server *network.TCPServer) {
+	server.RegisterCommand("LOCK", func(payload string) string {
+		return l.serveCommand(payload, l.grant)
+	})
+	server.RegisterCommand("UNLOCK", func(payload string) string {
+		return l.serveCommand(payload, l.release)
+	})
+}
+
+func (l *Locks) serveCommand(payload string, run func(lockRequest) error) string {
+	var request lockRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return fmt.Sprintf("ERROR|Failed to deserialize: %v", err)
+	}
+
+	err := run(request)
+	switch {
+	case err == nil:
+		return "OK|" + request.Name
+	case errors.Is(err, ErrHeld):
+		return fmt.Sprintf("HELD|%v", err)
+	case errors.Is(err, ErrNotHeld):
+		return fmt.Sprintf("NOT_HELD|%v", err)
+	}
+	return fmt.Sprintf("ERROR|%v", err)
+}
+
+// Acquire acquires the lock name for owner, or renews it if token already
+// holds it, for ttl or, if that is zero, the default TTL. Without a token
+// a new one is made. A lease a majority didn't grant is released on the
+// nodes that did, so a failed renewal gives the lock up.
+func (l *Locks) Acquire(ctx context.Context, name, owner, token string, ttl time.Duration) (*Lease, error) {
+	if ttl == 0 {
+		ttl = time.Duration(l.cfg.DefaultTTLMS) * time.Millisecond
+	}
+	if ttl < time.Millisecond || ttl > time.Duration(l.cfg.MaxTTLMS)*time.Millisecond {
+		return nil, fmt.Errorf("%w: ttl_ms must be 1 to %d", ErrInvalidLock, l.cfg.MaxTTLMS)
+	}
+	if token == "" {
+		var err error
+		if token, err = newToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	request := lockRequest{Name: name, Token: token, Owner: owner, TTLMS: ttl.Milliseconds()}
+	votes, err := l.poll(ctx, "LOCK", request, l.grant)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, held := 0, 0
+	var refusal error
+	for _, vote := range votes {
+		switch {
+		case vote == nil:
+			granted++
+		case isHeld(vote):
+			held++
+			refusal = vote
+		}
+	}
+	lease := &Lease{
+		Name:      name,
+		Owner:     owner,
+		Token:     token,
+		TTLMS:     ttl.Milliseconds(),
+		ExpiresAt: start.Add(ttl),
+		Granted:   granted,
+		Nodes:     len(votes),
+	}
+	if granted > len(votes)/2 && time.Now().Before(lease.ExpiresAt) {
+		return lease, nil
+	}
+
+	// Give back the grants this attempt got, so they don't keep others
+	// out until they expire.
+	l.poll(context.Background(), "UNLOCK", request, l.release)
+	if held > 0 {
+		return nil, fmt.Errorf("%w: %d of %d nodes granted it, %d refused: %v", ErrHeld, granted, len(votes), held, refusal)
+	}
+	return nil, fmt.Errorf("%w: %d of %d nodes granted it", ErrNoQuorum, granted, len(votes))
+}
+
+// Release releases the lock name held by token on every node that granted
+// it.
+func (l *Locks) Release(ctx context.Context, name, token string) error {
+	if token == "" {
+		return fmt.Errorf("%w: token is required", ErrInvalidLock)
+	}
+	votes, err := l.poll(ctx, "UNLOCK", lockRequest{Name: name, Token: token}, l.release)
+	if err != nil {
+		return err
+	}
+
+	released, held := 0, 0
+	for _, vote := range votes {
+		switch {
+		case vote == nil:
+			released++
+		case isHeld(vote):
+			held++
+		}
+	}
+	switch {
+	case released > 0:
+		return nil
+	case held > 0:
+		return ErrHeld
+	}
+	return ErrNotHeld
+}
+
+// Get returns the lease on name this node granted, without its token.
+func (l *Locks) Get(ctx context.Context, name string) (*Lease, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	granted := l.granted(name)
+	if granted == nil {
+		return nil, ErrNotHeld
+	}
+	lease := *granted
+	lease.Token = ""
+	return &lease, nil
+}
+
+// poll sends request to every peer as command and runs local on this
+// node, and returns every node's answer, nil for yes, once all have
+// answered or timed out.
+func (l *Locks) poll(ctx context.Context, command string, request lockRequest, local func(lockRequest) error) ([]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make(chan error, len(l.peers))
+	for _, address := range l.peers {
+		go func(address string) {
+			_, err := l.peerManager.Request(address, command, string(payload), requestTimeout)
+			answers <- err
+		}(address)
+	}
+	votes := []error{local(request)}
+	for range l.peers {
+		votes = append(votes, <-answers)
+	}
+	return votes, nil
+}
+
+// isHeld reports whether err is a node's answer that another token holds
+// the lock.
+func isHeld(err error) bool {
+	var remote *network.RemoteError
+	if errors.As(err, &remote) {
+		return remote.Status == "HELD"
+	}
+	return errors.Is(err, ErrHeld)
+}
+
+// grant grants the lock in request to its token on this node, unless
+// another token holds it.
+func (l *Locks) grant(request lockRequest) error {
+	if request.Name == "" || request.Token == "" || request.TTLMS <= 0 || request.TTLMS > int64(l.cfg.MaxTTLMS) {
+		return fmt.Errorf("%w: name, token and a ttl_ms of 1 to %d are required", ErrInvalidLock, l.cfg.MaxTTLMS)
+	}
+	ttl := time.Duration(request.TTLMS) * time.Millisecond
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.expire()
+	lease := l.grants[request.Name]
+	if lease != nil && lease.Token != request.Token {
+		return fmt.Errorf("%w %q until %s", ErrHeld, lease.Owner, lease.ExpiresAt.Format(time.RFC3339Nano))
+	}
+	if lease != nil && request.Owner == "" {
+		request.Owner = lease.Owner
+	}
+
+	l.grants[request.Name] = &Lease{
+		Name:      request.Name,
+		Owner:     request.Owner,
+		Token:     request.Token,
+		TTLMS:     request.TTLMS,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// release deletes this node's grant of the lock in request, if its token
+// holds it.
+func (l *Locks) release(request lockRequest) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lease := l.granted(request.Name)
+	if lease == nil {
+		return ErrNotHeld
+	}
+	if lease.Token != request.Token {
+		return ErrHeld
+	}
+	delete(l.grants, request.Name)
+	return nil
+}
+
+// granted returns the live grant of the lock name, or nil if there is
+// none. The caller holds the mutex.
+func (l *Locks) granted(name string) *Lease {
+	lease := l.grants[name]
+	if lease == nil || !time.Now().Before(lease.ExpiresAt) {
+		return nil
+	}
+	return lease
+}
+
+// expire forgets the grants that have expired. The caller holds the mutex.
+func (l *Locks) expire() {
+	now := time.Now()
+	for name, lease := range l.grants {
+		if !now.Before(lease.ExpiresAt) {
+			delete(l.grants, name)
+		}
+	}
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
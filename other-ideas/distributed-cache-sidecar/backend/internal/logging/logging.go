@@ -0,0 +1,132 @@
+// Package logging deduplicates and rate-limits log output per subsystem,
+// so a failing peer or remote produces a handful of lines and a summary
+// per interval instead of one line per attempt.
+package logging
+
+import (
+	"distributed-cache-sidecar/internal/metrics"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var messagesTotal = metrics.NewCounter("sidecar_log_messages_total",
+	"Log messages by subsystem and whether they were written or suppressed.", "subsystem", "outcome")
+
+var settings = struct {
+	mutex    sync.RWMutex
+	interval time.Duration
+	budget   int
+	budgets  map[string]int
+}{
+	interval: 10 * time.Second,
+	budget:   20,
+}
+
+// Configure sets the window over which messages are deduplicated and how
+// many distinct messages each subsystem may write per window. budgets
+// overrides the budget for individual subsystems. Changes apply from each
+// logger's next window.
+func Configure(interval time.Duration, budget int, budgets map[string]int) {
+	settings.mutex.Lock()
+	defer settings.mutex.Unlock()
+	settings.interval = interval
+	settings.budget = budget
+	settings.budgets = budgets
+}
+
+// Logger writes each distinct message once per window. Repeats, and any
+// messages past the subsystem's budget, are counted and summarised when
+// the window ends.
+type Logger struct {
+	subsystem string
+
+	mutex       sync.Mutex
+	interval    time.Duration
+	budget      int
+	windowStart time.Time
+	repeats     map[string]int
+	written     int
+	overBudget  int
+	flushTimer  *time.Timer
+}
+
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem, repeats: make(map[string]int)}
+}
+
+func (l *Logger) Printf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if time.Since(l.windowStart) >= l.interval {
+		l.flushLocked()
+	}
+
+	if _, seen := l.repeats[message]; seen {
+		l.repeats[message]++
+		l.suppressLocked()
+		return
+	}
+	if l.written >= l.budget {
+		l.overBudget++
+		l.suppressLocked()
+		return
+	}
+
+	l.repeats[message] = 0
+	l.written++
+	messagesTotal.Inc(l.subsystem, "written")
+	log.Print(message)
+}
+
+func (l *Logger) suppressLocked() {
+	messagesTotal.Inc(l.subsystem, "suppressed")
+	if l.flushTimer == nil {
+		l.flushTimer = time.AfterFunc(time.Until(l.windowStart.Add(l.interval)), l.flush)
+	}
+}
+
+func (l *Logger) flush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.flushLocked()
+}
+
+// flushLocked summarises the window that is ending and starts a new one.
+func (l *Logger) flushLocked() {
+	messages := make([]string, 0, len(l.repeats))
+	for message, count := range l.repeats {
+		if count > 0 {
+			messages = append(messages, message)
+		}
+	}
+	sort.Strings(messages)
+	for _, message := range messages {
+		log.Printf("[%s] repeated %d more times in %s: %s", l.subsystem, l.repeats[message], l.interval, message)
+	}
+	if l.overBudget > 0 {
+		log.Printf("[%s] suppressed %d messages over the budget of %d per %s", l.subsystem, l.overBudget, l.budget, l.interval)
+	}
+
+	settings.mutex.RLock()
+	l.interval = settings.interval
+	l.budget = settings.budget
+	if budget, ok := settings.budgets[l.subsystem]; ok {
+		l.budget = budget
+	}
+	settings.mutex.RUnlock()
+
+	if l.flushTimer != nil {
+		l.flushTimer.Stop()
+		l.flushTimer = nil
+	}
+	l.windowStart = time.Now()
+	l.repeats = make(map[string]int)
+	l.written = 0
+	l.overBudget = 0
+}
@@ -0,0 +1,137 @@
+// Package metrics is a minimal registry of labelled counters and gauges,
+// rendered in the Prometheus text exposition format by Write.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var registry = struct {
+	mutex    sync.RWMutex
+	families []*family
+}{}
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func register(name, help, kind string, labels []string) *family {
+	f := &family{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.families = append(registry.families, f)
+	return f
+}
+
+func (f *family) update(labelValues []string, fn func(float64) float64) {
+	key := strings.Join(labelValues, "\x00")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[key] = fn(f.values[key])
+}
+
+func (f *family) value(labelValues []string) float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.values[strings.Join(labelValues, "\x00")]
+}
+
+type Counter struct {
+	family *family
+}
+
+// NewCounter registers a counter. Every call must pass one value per
+// label, in the order given here.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{family: register(name, help, "counter", labels)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta uint64, labelValues ...string) {
+	c.family.update(labelValues, func(v float64) float64 { return v + float64(delta) })
+}
+
+// Value returns the counter's current value for the given labels.
+func (c *Counter) Value(labelValues ...string) uint64 {
+	return uint64(c.family.value(labelValues))
+}
+
+type Gauge struct {
+	family *family
+}
+
+// NewGauge registers a gauge. Every call must pass one value per label,
+// in the order given here.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{family: register(name, help, "gauge", labels)}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(float64) float64 { return value })
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.family.value(labelValues)
+}
+
+func (f *family) write(w io.Writer) {
+	f.mutex.Lock()
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]float64, len(keys))
+	for i, key := range keys {
+		values[i] = f.values[key]
+	}
+	f.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for i, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, f.renderLabels(key), strconv.FormatFloat(values[i], 'g', -1, 64))
+	}
+}
+
+func (f *family) renderLabels(key string) string {
+	if len(f.labels) == 0 {
+		return ""
+	}
+
+	values := strings.Split(key, "\x00")
+	pairs := make([]string, len(f.labels))
+	for i, label := range f.labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%q", label, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Write renders every registered metric.
+func Write(w io.Writer) {
+	registry.mutex.RLock()
+	families := append([]*family(nil), registry.families...)
+	registry.mutex.RUnlock()
+
+	for _, f := range families {
+		f.write(w)
+	}
+}
@@ -0,0 +1,171 @@
+package network
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/metrics"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Replication is fire-and-forget by default: a write returns once it is
+// applied here and reaches peers over the links in the background. Keys
+// whose replication.acks level is quorum or all instead also go straight
+// to each of their replicas as a SYNC request, and the write returns once
+// enough of them have acknowledged it. Peers this node can't dial, such as
+// ones it only knows by an inbound link, count as replicas that never
+// acknowledge.
+
+var ErrNotReplicated = errors.New("write not acknowledged by enough replicas")
+
+var replicationAckFailures = metrics.NewCounter("sidecar_replication_ack_failures_total",
+	"Writes that returned without the replica acknowledgements their prefix requires.", "acks")
+
+// AcksFor returns the ack level configured for key.
+func (pm *PeerManager) AcksFor(key string) string {
+	acks, longest := pm.config.Replication.Acks, -1
+	for prefix, level := range pm.config.Replication.PrefixAcks {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			acks, longest = level, len(prefix)
+		}
+	}
+	return acks
+}
+
+// ackReplicas returns the data peers that should hold key. In partitioned
+// placement those are its owners other than this node, which are left
+// without an address when no peer is known for them.
+func (pm *PeerManager) ackReplicas(key string) []*Peer {
+	if pm.keepsLocal(key) {
+		return nil
+	}
+	var replicas []*Peer
+	if pm.Partitioned() {
+		byNode := make(map[string]*Peer)
+		for _, peer := range pm.GetPeers() {
+			if peer.NodeID != "" && (byNode[peer.NodeID] == nil || peer.configured) {
+				byNode[peer.NodeID] = peer
+			}
+		}
+		for _, owner := range pm.Owners(key) {
+			if owner == pm.cacheManager.NodeID() {
+				continue
+			}
+			if peer := byNode[owner]; peer != nil {
+				replicas = append(replicas, peer)
+			} else {
+				replicas = append(replicas, &Peer{NodeID: owner})
+			}
+		}
+		return replicas
+	}
+
+	for _, peer := range pm.GetPeers() {
+		if peer.Mode != "" && peer.Mode != config.NodeModeData {
+			continue
+		}
+		// A configured peer that was never reached may be in any group.
+		if peer.NodeID != "" && !pm.inGroupFor(peer.Group, key) {
+			continue
+		}
+		replicas = append(replicas, peer)
+	}
+	return replicas
+}
+
+// acksNeeded returns how many of replicas must acknowledge a write at the
+// given level. A quorum is a majority of the key's copies, this node's
+// included.
+func acksNeeded(acks string, replicas int) int {
+	switch acks {
+	case config.AcksAll:
+		return replicas
+	case config.AcksQuorum:
+		return (replicas + 1) / 2
+	}
+	return 0
+}
+
+// AwaitAcks sends item to its replicas and waits until as many have
+// acknowledged it as its prefix's ack level requires, failing with
+// ErrNotReplicated once too many have failed or replication.ack_timeout_ms
+// has passed.
+func (pm *PeerManager) AwaitAcks(ctx context.Context, item *cache.CacheItem) error {
+	acks := pm.AcksFor(item.Key)
+	replicas := pm.ackReplicas(item.Key)
+	needed := acksNeeded(acks, len(replicas))
+	if needed == 0 {
+		return nil
+	}
+
+	data, err := pm.cacheManager.SerializeItem(item)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(pm.config.Replication.AckTimeoutMS) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make(chan error, len(replicas))
+	for _, peer := range replicas {
+		if !peer.configured {
+			results <- fmt.Errorf("no address for %s", peer.NodeID)
+			continue
+		}
+		version := peer.ProtocolVersion
+		if version == 0 {
+			version = ProtocolVersion
+		}
+		message := strings.TrimSpace(routedFrame(version, "SYNC", []string{pm.cacheManager.NodeID()}, data))
+		go func(address string) {
+			_, err := pm.Request(address, "SYNC", strings.TrimPrefix(message, "SYNC|"), timeout)
+			results <- err
+		}(peer.Address)
+	}
+
+	acked, failed := 0, 0
+	for acked < needed {
+		select {
+		case err := <-results:
+			if err == nil {
+				acked++
+				continue
+			}
+			if failed++; len(replicas)-failed < needed {
+				replicationAckFailures.Inc(acks)
+				return fmt.Errorf("%w: %s needs %d of %d, %d failed, last: %v", ErrNotReplicated, acks, needed, len(replicas), failed, err)
+			}
+		case <-ctx.Done():
+			replicationAckFailures.Inc(acks)
+			return fmt.Errorf("%w: %s needs %d of %d, %d acknowledged in time", ErrNotReplicated, acks, needed, len(replicas), acked)
+		}
+	}
+	return nil
+}
+
+// acksConfigured reports whether any key needs acknowledgements.
+func acksConfigured(cfg *config.Config) bool {
+	if cfg.Replication.Acks != config.AcksNone {
+		return true
+	}
+	for _, acks := range cfg.Replication.PrefixAcks {
+		if acks != config.AcksNone {
+			return true
+		}
+	}
+	return false
+}
+
+// ackHook makes local writes wait for their replicas' acknowledgements.
+type ackHook struct {
+	pm *PeerManager
+}
+
+func (h *ackHook) Name() string { return "replication-acks" }
+
+func (h *ackHook) AfterSet(ctx context.Context, item *cache.CacheItem) error {
+	return h.pm.AwaitAcks(ctx, item)
+}
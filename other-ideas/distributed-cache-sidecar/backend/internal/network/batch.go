@@ -0,0 +1,73 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+)
+
+// The items of a batch write go to version 6 peers in one MSYNC frame,
+// whose payload is the JSON array of the items a peer replicates, rather
+// than one SYNC frame each. Receivers apply them one by one like SYNC
+// items. Older peers get a SYNC frame per item. Keys held for coalescing
+// leave the batch and are sent with the next flush.
+
+// broadcastBatch replicates the items of one batch write.
+func (pm *PeerManager) broadcastBatch(items []*cache.CacheItem) {
+	route := []string{pm.cacheManager.NodeID()}
+	for _, peer := range pm.connectedPeers() {
+		var batch []*cache.CacheItem
+		for _, item := range items {
+			if pm.replicatesTo(peer, item.Key) {
+				batch = append(batch, item)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		if peer.ProtocolVersion >= 6 {
+			data, err := json.Marshal(batch)
+			if err != nil {
+				peerLog.Printf("Failed to serialize batch: %v", err)
+				return
+			}
+			pm.send(peer, routedFrame(peer.ProtocolVersion, "MSYNC", route, data))
+			continue
+		}
+		for _, item := range batch {
+			data, err := pm.cacheManager.SerializeItem(item)
+			if err != nil {
+				continue
+			}
+			pm.send(peer, routedFrame(peer.ProtocolVersion, "SYNC", route, data))
+		}
+	}
+}
+
+// applySyncBatch applies the body of an MSYNC frame. It returns the items
+// that changed local state, and their route, so they may be relayed.
+func applySyncBatch(cacheManager *cache.Manager, version int, body string) ([]*cache.CacheItem, []string, error) {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return nil, nil, nil
+	}
+
+	var items []*cache.CacheItem
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, nil, err
+	}
+	var applied []*cache.CacheItem
+	for _, item := range items {
+		changed, err := cacheManager.SetRemote(item)
+		if err != nil {
+			return applied, route, err
+		}
+		if changed {
+			applied = append(applied, item)
+		}
+	}
+	return applied, route, nil
+}
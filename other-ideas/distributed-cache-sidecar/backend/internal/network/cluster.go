@@ -0,0 +1,102 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type NodeInfo struct {
+	NodeID   string `json:"node_id"`
+	Region   string `json:"region"`
+	Sequence uint64 `json:"sequence"`
+	Address  string `json:"address,omitempty"`
+	Self     bool   `json:"self,omitempty"`
+}
+
+// Request sends a single command to address on a dedicated connection and
+// returns the payload of an OK response. Replication traffic on the shared
+// peer connections is fire-and-forget, so request/response commands never
+// go over them.
+func (pm *PeerManager) Request(address, command, payload string, timeout time.Duration) (string, error) {
+	label := pm.addressLabel(address)
+	conn, err := pm.dial(address, timeout)
+	if err != nil {
+		pm.traffic.failed(label)
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	request := fmt.Sprintf("%s|%s\n", command, payload)
+	if _, err := conn.Write([]byte(request)); err != nil {
+		pm.traffic.failed(label)
+		return "", err
+	}
+	pm.traffic.sent(label, len(request), len(request))
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		pm.traffic.failed(label)
+		return "", err
+	}
+	pm.traffic.received(label, len(line))
+
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 2)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid response from %s", address)
+	}
+	if parts[0] != "OK" {
+		return "", &RemoteError{Address: address, Status: parts[0], Message: parts[1]}
+	}
+	return parts[1], nil
+}
+
+// ClusterNodes asks every configured peer for its identity. Unreachable
+// peers are left out; this node is always included.
+func (pm *PeerManager) ClusterNodes(timeout time.Duration) []NodeInfo {
+	nodes := []NodeInfo{{
+		NodeID:   pm.cacheManager.NodeID(),
+		Region:   pm.cacheManager.Region(),
+		Sequence: pm.cacheManager.Sequence(),
+		Self:     true,
+	}}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, address := range pm.config.Peers {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+
+			response, err := pm.Request(address, "INFO", "", timeout)
+			if err != nil {
+				return
+			}
+			var info NodeInfo
+			if err := json.Unmarshal([]byte(response), &info); err != nil {
+				return
+			}
+			info.Address = address
+
+			mutex.Lock()
+			nodes = append(nodes, info)
+			mutex.Unlock()
+		}(address)
+	}
+	wg.Wait()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return nodes
+}
+
+// Leader returns the reachable node with the lowest node ID. Every node
+// computes the same answer as long as they agree on who is reachable.
+func (pm *PeerManager) Leader(timeout time.Duration) NodeInfo {
+	return pm.ClusterNodes(timeout)[0]
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Write coalescing cuts replication of high-churn keys, such as
+// metrics-style values updated hundreds of times a second. Updates to
+// keys under replication.coalesce_prefixes (every key when none are
+// listed) are held instead of broadcast, and every
+// replication.coalesce_ms whatever is held goes out: one update per key,
+// the latest. Peers see such keys up to an interval late and skip the
+// values in between. A patch to a held key sends the held update first,
+// since peers apply patches to the value they have.
+
+var coalescedUpdates = metrics.NewCounter("sidecar_replication_coalesced_total",
+	"Updates replaced by a later update to the same key before they were replicated.")
+
+type coalescer struct {
+	pm       *PeerManager
+	prefixes []string
+	interval time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]*cache.CacheItem
+}
+
+// newCoalescer returns nil when coalescing is off.
+func newCoalescer(pm *PeerManager) *coalescer {
+	if pm.config.Replication.CoalesceMS <= 0 {
+		return nil
+	}
+	return &coalescer{
+		pm:       pm,
+		prefixes: pm.config.Replication.CoalescePrefixes,
+		interval: time.Duration(pm.config.Replication.CoalesceMS) * time.Millisecond,
+		pending:  make(map[string]*cache.CacheItem),
+	}
+}
+
+func (c *coalescer) coalesces(key string) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hold keeps item to be sent with the next flush, replacing any update to
+// its key still held. It reports false for keys that aren't coalesced.
+func (c *coalescer) hold(item *cache.CacheItem) bool {
+	if !c.coalesces(item.Key) {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, held := c.pending[item.Key]; held {
+		coalescedUpdates.Inc()
+	}
+	c.pending[item.Key] = item
+	return true
+}
+
+// release sends the update held for key, if any, right away.
+func (c *coalescer) release(key string) {
+	c.mutex.Lock()
+	item, held := c.pending[key]
+	delete(c.pending, key)
+	c.mutex.Unlock()
+	if held {
+		c.pm.broadcastItem(item)
+	}
+}
+
+func (c *coalescer) flush() {
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*cache.CacheItem, len(pending))
+	c.mutex.Unlock()
+
+	for _, item := range pending {
+		c.pm.broadcastItem(item)
+	}
+}
+
+func (c *coalescer) start(stop <-chan struct{}) {
+	lifecycle.Go("replication-coalescer", "", func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.flush()
+			case <-stop:
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package network
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms a link can negotiate. Peers list the ones they
+// accept in their HELLO in order of preference; the accepting side picks
+// the first of the dialer's that it also has enabled and answers with it.
+// Nodes that predate compression send no list and get none.
+const (
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// maxDecompressedFrame bounds what a compressed frame may expand to.
+const maxDecompressedFrame = 64 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedFrame))
+)
+
+func SupportedCompression(name string) bool {
+	return name == CompressionZstd || name == CompressionSnappy
+}
+
+// chooseCompression picks the link's compression from the dialer's offer,
+// or "" for none.
+func chooseCompression(enabled, offered []string) string {
+	for _, name := range offered {
+		for _, local := range enabled {
+			if name == local && SupportedCompression(name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// compressFrame wraps a replication frame as Z|<algorithm>|<base64 data>
+// when compressing it makes it smaller. Frames are newline-terminated
+// lines, hence the base64.
+func compressFrame(algorithm, message string) string {
+	body := []byte(strings.TrimSuffix(message, "\n"))
+
+	var compressed []byte
+	switch algorithm {
+	case CompressionZstd:
+		compressed = zstdEncoder.EncodeAll(body, nil)
+	case CompressionSnappy:
+		compressed = snappy.Encode(nil, body)
+	default:
+		return message
+	}
+
+	wrapped := "Z|" + algorithm + "|" + base64.StdEncoding.EncodeToString(compressed) + "\n"
+	if len(wrapped) >= len(message) {
+		return message
+	}
+	return wrapped
+}
+
+// expandFrame returns the original frame of a compressed one. Other
+// messages are returned unchanged.
+func expandFrame(message string) (string, error) {
+	payload := strings.TrimPrefix(message, "Z|")
+	if payload == message {
+		return message, nil
+	}
+
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid compressed frame")
+	}
+	compressed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid compressed frame: %v", err)
+	}
+
+	var body []byte
+	switch parts[0] {
+	case CompressionZstd:
+		body, err = zstdDecoder.DecodeAll(compressed, nil)
+	case CompressionSnappy:
+		var length int
+		if length, err = snappy.DecodedLen(compressed); err == nil && length > maxDecompressedFrame {
+			err = fmt.Errorf("frame expands to %d bytes", length)
+		}
+		if err == nil {
+			body, err = snappy.Decode(nil, compressed)
+		}
+	default:
+		return "", fmt.Errorf("unsupported frame compression %q", parts[0])
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress frame: %v", err)
+	}
+	return string(body), nil
+}
+
+// encodeFrame prepares message for the wire to peer, compressing it if
+// the link negotiated compression and the message is large enough.
+func (pm *PeerManager) encodeFrame(peer *Peer, message string) string {
+	wire := message
+	if peer.Compression != "" && len(message) >= pm.config.Replication.CompressMinBytes {
+		wire = compressFrame(peer.Compression, message)
+	}
+	pm.traffic.sent(peer.label(), len(wire), len(message))
+	return wire
+}
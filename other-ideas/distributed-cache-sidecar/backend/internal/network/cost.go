@@ -0,0 +1,85 @@
+package network
+
+import (
+	"sort"
+	"time"
+)
+
+// hoursPerMonth is the average month cloud providers bill by.
+const hoursPerMonth = 730
+
+// LinkCost is the egress cost of replicating to one peer.
+type LinkCost struct {
+	Peer   string `json:"peer"`
+	Region string `json:"region"`
+	// PricePerGB is what a GB sent from this node's region to the peer's
+	// costs, as configured.
+	PricePerGB float64 `json:"price_per_gb"`
+	SentBytes  uint64  `json:"sent_bytes"`
+	Cost       float64 `json:"cost"`
+	// MonthlyBytes and MonthlyCost project the rate seen so far over a
+	// month.
+	MonthlyBytes uint64  `json:"projected_monthly_bytes"`
+	MonthlyCost  float64 `json:"projected_monthly_cost"`
+}
+
+// CostEstimate projects this node's replication egress cost from the
+// traffic it has sent each peer since it started.
+type CostEstimate struct {
+	Region          string     `json:"region"`
+	Currency        string     `json:"currency"`
+	ObservedSeconds float64    `json:"observed_seconds"`
+	Links           []LinkCost `json:"links"`
+	Cost            float64    `json:"cost"`
+	MonthlyCost     float64    `json:"projected_monthly_cost"`
+}
+
+// CostEstimate prices the bytes sent to each known peer at the egress
+// price for its region and projects them over a month at the rate seen
+// since the node started. The cluster's cost is the sum of every node's.
+func (pm *PeerManager) CostEstimate() CostEstimate {
+	observed := time.Since(pm.started)
+	estimate := CostEstimate{
+		Region:          pm.config.Region,
+		Currency:        pm.config.Cost.Currency,
+		ObservedSeconds: observed.Seconds(),
+		Links:           []LinkCost{},
+	}
+	scale := float64(hoursPerMonth*time.Hour) / float64(observed)
+
+	for _, peer := range pm.GetPeers() {
+		link := LinkCost{
+			Peer:       peer.label(),
+			Region:     peer.Region,
+			PricePerGB: pm.egressPrice(peer.Region),
+			SentBytes:  peer.Traffic.SentBytes,
+		}
+		link.Cost = float64(link.SentBytes) / (1 << 30) * link.PricePerGB
+		link.MonthlyBytes = uint64(float64(link.SentBytes) * scale)
+		link.MonthlyCost = link.Cost * scale
+		estimate.Links = append(estimate.Links, link)
+		estimate.Cost += link.Cost
+		estimate.MonthlyCost += link.MonthlyCost
+	}
+	sort.Slice(estimate.Links, func(i, j int) bool {
+		return estimate.Links[i].MonthlyCost > estimate.Links[j].MonthlyCost
+	})
+	return estimate
+}
+
+// egressPrice is the configured price of a GB sent from this node's region
+// to region.
+func (pm *PeerManager) egressPrice(region string) float64 {
+	prices := pm.config.Cost.EgressPerGB
+	from := pm.config.Region
+	if price, exists := prices[from+":"+region]; exists {
+		return price
+	}
+	if region == from {
+		return 0
+	}
+	if price, exists := prices[from+":*"]; exists {
+		return price
+	}
+	return prices["*"]
+}
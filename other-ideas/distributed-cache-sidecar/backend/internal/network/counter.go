@@ -0,0 +1,91 @@
+package network
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Counters are incremented by their owner, the first node Owners names
+// for the key, and replicate from there like any write. An increment reads
+// the value it adds to, so two nodes incrementing one counter at once
+// would each replicate their own total and only one would survive; sent
+// to one node, increments apply one after the other. A node that can't
+// reach the owner at a configured address increments locally.
+
+const incrementTimeout = 2 * time.Second
+
+// incrementRequest is the payload of the INCR_OWNED command, which applies
+// an increment forwarded by a node that doesn't own the counter.
+type incrementRequest struct {
+	Key         string            `json:"key"`
+	Delta       int64             `json:"delta"`
+	TTLMS       int64             `json:"ttl_ms,omitempty"`
+	Sliding     bool              `json:"sliding,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Consistency cache.Consistency `json:"consistency,omitempty"`
+}
+
+func (r incrementRequest) options() cache.WriteOptions {
+	return cache.WriteOptions{
+		TTL:         time.Duration(r.TTLMS) * time.Millisecond,
+		Sliding:     r.Sliding,
+		Metadata:    r.Metadata,
+		Consistency: r.Consistency,
+	}
+}
+
+// Increment is cache.Manager.Increment applied on the owner of key.
+func (pm *PeerManager) Increment(ctx context.Context, key string, delta int64, options cache.WriteOptions) (*cache.CacheItem, error) {
+	key = pm.cacheManager.NormalizeKey(key)
+	address := pm.counterOwner(key, options)
+	if address == "" {
+		return pm.cacheManager.Increment(ctx, key, delta, options)
+	}
+
+	payload, err := json.Marshal(incrementRequest{
+		Key:         key,
+		Delta:       delta,
+		TTLMS:       options.TTL.Milliseconds(),
+		Sliding:     options.Sliding,
+		Metadata:    options.Metadata,
+		Consistency: options.Consistency,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := pm.Request(address, "INCR_OWNED", string(payload), incrementTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return pm.cacheManager.DeserializeItem([]byte(response))
+}
+
+// Decrement is Increment with delta negated.
+func (pm *PeerManager) Decrement(ctx context.Context, key string, delta int64, options cache.WriteOptions) (*cache.CacheItem, error) {
+	if delta == math.MinInt64 {
+		return nil, &cache.KeyError{Key: key, Err: cache.ErrOverflow}
+	}
+	return pm.Increment(ctx, key, -delta, options)
+}
+
+// counterOwner returns the address to forward increments of key to, or ""
+// if they apply here: on the owner, for local-only writes and keys, and
+// when the owner isn't linked at a configured address.
+func (pm *PeerManager) counterOwner(key string, options cache.WriteOptions) string {
+	if options.LocalOnly || pm.keepsLocal(key) {
+		return ""
+	}
+	owners := pm.Owners(key)
+	if len(owners) == 0 || owners[0] == pm.cacheManager.NodeID() {
+		return ""
+	}
+	for _, peer := range pm.GetPeers() {
+		if peer.NodeID == owners[0] && peer.Connected && peer.configured {
+			return peer.Address
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"distributed-cache-sidecar/internal/config"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Dialer opens a connection to a peer address.
+type Dialer func(address string, timeout time.Duration) (net.Conn, error)
+
+// SetDialer makes the manager open peer connections with dial instead of
+// over TCP, ignoring peer_dial and socket options. In-process test
+// clusters use it to connect nodes through an in-memory network. It must
+// be called before Start.
+func (pm *PeerManager) SetDialer(dial Dialer) {
+	pm.dialer = dial
+}
+
+// dial opens a connection to the peer at address, through the proxy and
+// TLS configured for it in peer_dial.
+func (pm *PeerManager) dial(address string, timeout time.Duration) (net.Conn, error) {
+	if pm.dialer != nil {
+		return pm.dialer(address, timeout)
+	}
+	options, ok := pm.config.PeerDial[address]
+	if !ok {
+		options = pm.config.PeerDial["*"]
+	}
+	return dialPeer(address, options, pm.config.Socket, timeout)
+}
+
+func dialPeer(address string, options config.PeerDialConfig, socket config.SocketConfig, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+
+	var conn net.Conn
+	var err error
+	if options.Proxy == "" {
+		conn, err = net.DialTimeout("tcp", address, timeout)
+	} else {
+		conn, err = dialProxy(options.Proxy, address, deadline)
+	}
+	if err == nil {
+		tuneSocket(conn, socket)
+	}
+	if err != nil || !options.TLS {
+		return conn, err
+	}
+
+	tlsConfig, err := peerTLSConfig(address, options)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	tlsConn.SetDeadline(deadline)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s: %v", address, err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func peerTLSConfig(address string, options config.PeerDialConfig) (*tls.Config, error) {
+	serverName := options.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+
+	tlsConfig := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", options.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// dialProxy opens a tunnel to address through the proxy at rawURL.
+func dialProxy(rawURL, address string, deadline time.Time) (net.Conn, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", proxyURL.Host, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %v", proxyURL.Host, err)
+	}
+	conn.SetDeadline(deadline)
+
+	switch proxyURL.Scheme {
+	case "http":
+		err = httpConnect(conn, address, proxyURL.User)
+	case "socks5":
+		err = socks5Connect(conn, address, proxyURL.User)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", proxyURL.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks an HTTP proxy on conn to open a tunnel to address.
+func httpConnect(conn net.Conn, address string, user *url.Userinfo) error {
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := request.Write(conn); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT to %s refused: %s", address, response.Status)
+	}
+	if reader.Buffered() > 0 {
+		return errors.New("proxy sent data before the tunnel was open")
+	}
+	return nil
+}
+
+// SOCKS5 (RFC 1928) with username/password authentication (RFC 1929).
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksPasswordAuth = 2
+	socksNoAcceptable = 0xff
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+)
+
+var socksReplies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect asks a SOCKS5 proxy on conn to open a tunnel to address.
+func socks5Connect(conn net.Conn, address string, user *url.Userinfo) error {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port in %s", address)
+	}
+
+	methods := []byte{socksNoAuth}
+	if user != nil {
+		methods = []byte{socksPasswordAuth}
+	}
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPasswordAuth:
+		if user == nil {
+			return errors.New("proxy requires a username and password")
+		}
+		if err := socks5Authenticate(conn, user); err != nil {
+			return err
+		}
+	case socksNoAcceptable:
+		return errors.New("proxy accepts none of the offered authentication methods")
+	default:
+		return fmt.Errorf("proxy chose unsupported authentication method %d", reply[1])
+	}
+
+	request := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %s too long", host)
+		}
+		request = append(request, socksDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socksIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socksIPv6)
+		request = append(request, ip...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		message, ok := socksReplies[header[1]]
+		if !ok {
+			message = fmt.Sprintf("error %d", header[1])
+		}
+		return fmt.Errorf("CONNECT to %s refused: %s", address, message)
+	}
+
+	// Skip the bound address and port.
+	var skip int
+	switch header[3] {
+	case socksIPv4:
+		skip = net.IPv4len + 2
+	case socksIPv6:
+		skip = net.IPv6len + 2
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0]) + 2
+	default:
+		return fmt.Errorf("invalid address type %d in proxy reply", header[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip))
+	return err
+}
+
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	username := user.Username()
+	password, _ := user.Password()
+	if len(username) > 255 || len(password) > 255 {
+		return errors.New("proxy username or password too long")
+	}
+
+	request := []byte{1, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("proxy rejected the username and password")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/metrics"
+	"fmt"
+	"strings"
+)
+
+// Large values are often rewritten unchanged, and with dedup on several
+// keys may hold the same one. When replication.digest_min_bytes is set, a
+// local write whose value is at least that long goes to version 5 peers
+// as a SYNCD frame: the item with its value left out, preceded by the
+// value's digest. A peer holding a value with that digest, under the key
+// or, with dedup on, under any key, applies the item with it. One that
+// doesn't answers WANT|<version>|<digest>|<key> on the same link and is
+// sent the item in full, as long as the sender still holds that value; a
+// newer write is on its way anyway. Relayed updates are sent in full.
+
+var (
+	digestSyncs = metrics.NewCounter("sidecar_replication_digest_total",
+		"Values received as a digest, by whether this node held the content (hit) or asked for it (miss).", "result")
+	digestSavedBytes = metrics.NewCounter("sidecar_replication_digest_saved_bytes_total",
+		"Value bytes peers did not send because this node held the content.")
+)
+
+// digestBody renders the body of a SYNCD frame for item, or nil when its
+// value is too short to be worth sending as a digest.
+func (pm *PeerManager) digestBody(item *cache.CacheItem) []byte {
+	minBytes := pm.config.Replication.DigestMinBytes
+	if minBytes <= 0 || len(item.Value) < minBytes {
+		return nil
+	}
+	stripped := *item
+	stripped.Value = ""
+	data, err := pm.cacheManager.SerializeItem(&stripped)
+	if err != nil {
+		return nil
+	}
+	return append([]byte(cache.ValueDigest(item.Value)+"|"), data...)
+}
+
+// applySyncDigest applies the body of a SYNCD frame. Like applySync, it
+// returns the item and its route when the item changed local state; when
+// the value isn't held here it instead returns the WANT frame to answer
+// with.
+func applySyncDigest(cacheManager *cache.Manager, version int, body string) (*cache.CacheItem, []string, string, error) {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return nil, nil, "", nil
+	}
+	parts := strings.SplitN(data, "|", 2)
+	if len(parts) < 2 {
+		return nil, nil, "", fmt.Errorf("invalid digest frame")
+	}
+	digest := parts[0]
+
+	item, err := cacheManager.DeserializeItem([]byte(parts[1]))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	value, held := cacheManager.ValueByDigest(item.Key, digest)
+	if !held {
+		digestSyncs.Add(1, "miss")
+		return nil, nil, fmt.Sprintf("WANT|%d|%s|%s", version, digest, item.Key), nil
+	}
+	digestSyncs.Add(1, "hit")
+	digestSavedBytes.Add(uint64(len(value)))
+
+	item.Value = value
+	applied, err := cacheManager.SetRemote(item)
+	if err != nil || !applied {
+		return nil, nil, "", err
+	}
+	return item, route, "", nil
+}
+
+// wanted answers the payload of a WANT frame with a SYNC frame carrying
+// the item it names in full, or "" if the value asked for has since been
+// replaced here.
+func (pm *PeerManager) wanted(payload string) string {
+	version, body, err := parseFrame(payload)
+	if err != nil {
+		return ""
+	}
+	parts := strings.SplitN(body, "|", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	item, held := pm.cacheManager.ItemWithDigest(parts[1], parts[0])
+	if !held {
+		return ""
+	}
+	data, err := pm.cacheManager.SerializeItem(item)
+	if err != nil {
+		return ""
+	}
+	return routedFrame(version, "SYNC", []string{pm.cacheManager.NodeID()}, data)
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotOwner  = errors.New("node does not own the key")
+	ErrNotLinked = errors.New("not linked to node")
+	// ErrUnavailable refuses a client command this node doesn't serve in
+	// its mode, or a write while writes are switched off.
+	ErrUnavailable = errors.New("node is unavailable")
+)
+
+// statusErrors maps the status word of a TCP response to the error it
+// stands for. Responses with any other status are plain RemoteErrors.
+var statusErrors = []struct {
+	status string
+	err    error
+}{
+	{"NOT_OWNER", ErrNotOwner},
+	{"UNAVAILABLE", ErrUnavailable},
+	{"EXPIRED", cache.ErrExpired},
+	{"NOT_FOUND", cache.ErrNotFound},
+	{"TOO_LARGE", cache.ErrTooLarge},
+	{"CONFLICT", cache.ErrConflict},
+	{"VERSION_MISMATCH", cache.ErrVersionMismatch},
+	{"NOT_INTEGER", cache.ErrNotInteger},
+	{"OVERFLOW", cache.ErrOverflow},
+	{"WRONG_TYPE", cache.ErrWrongType},
+}
+
+// RemoteError is a non-OK response to a request sent to a peer. It
+// unwraps to the error its status stands for, so errors.Is(err,
+// cache.ErrNotFound) works the same for local and remote reads.
+type RemoteError struct {
+	Address string
+	Status  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s from %s: %s", e.Status, e.Address, e.Message)
+}
+
+func (e *RemoteError) Unwrap() error {
+	for _, s := range statusErrors {
+		if s.status == e.Status {
+			return s.err
+		}
+	}
+	return nil
+}
+
+// errorResponse renders err as a response line for the requesting peer.
+func errorResponse(err error) string {
+	for _, s := range statusErrors {
+		if errors.Is(err, s.err) {
+			return fmt.Sprintf("%s|%v", s.status, err)
+		}
+	}
+	return fmt.Sprintf("ERROR|%v", err)
+}
+
+// CheckOwner returns ErrNotOwner when placement is partitioned and this
+// node is not one of key's owners, so a miss here says nothing about
+// whether the key exists.
+func (pm *PeerManager) CheckOwner(key string) error {
+	if !pm.Partitioned() {
+		if group := pm.GroupFor(key); !pm.inGroupFor(pm.config.Placement.Group, key) {
+			return fmt.Errorf("%w: %s is dedicated to group %s", ErrNotOwner, key, group)
+		}
+		return nil
+	}
+	self := pm.cacheManager.NodeID()
+	owners := pm.Owners(key)
+	for _, owner := range owners {
+		if owner == self {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is held by %v", ErrNotOwner, key, owners)
+}
@@ -0,0 +1,263 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// In partitioned placement the leader (the linked node with the lowest
+// node ID) declares a member dead once nobody has been able to link to it
+// for failover.dead_after_ms. Dead nodes are taken off every node's ring,
+// even on nodes that still have a link to them, so the next replica on the
+// ring becomes the owner of their keys everywhere at once. Each decision
+// bumps the cluster's topology version, which the leader sends to its
+// peers in FAILOVER frames; nodes adopt any version newer than their own.
+// Every node repeats the latest version it has, so a restarted leader
+// catches up before its next decision. A dead node that links to the
+// leader again is brought back the same way. With failover.quorum the
+// leader holds off while it can't reach a majority of the cluster, so a
+// witness in a third region decides which side of a split fails over.
+
+var (
+	failovers = metrics.NewCounter("sidecar_failover_events_total",
+		"Nodes declared dead or brought back by the leader.", "event")
+	topologyVersionGauge = metrics.NewGauge("sidecar_topology_version",
+		"The cluster topology version this node has seen.")
+)
+
+// failoverAnnounceInterval is how often nodes repeat the topology version
+// they have, so nodes that link later or missed a frame catch up.
+const failoverAnnounceInterval = 5 * time.Second
+
+// TopologyState is the leader's latest decision.
+type TopologyState struct {
+	Version uint64    `json:"version"`
+	Leader  string    `json:"leader"`
+	Dead    []string  `json:"dead,omitempty"`
+	Changed time.Time `json:"changed"`
+}
+
+type topologyState struct {
+	mutex   sync.Mutex
+	state   TopologyState
+	dead    map[string]bool
+	changed chan struct{}
+	// lastLinked is when the leader last saw each member linked.
+	lastLinked map[string]time.Time
+}
+
+func (pm *PeerManager) Topology() TopologyState {
+	pm.topology.mutex.Lock()
+	defer pm.topology.mutex.Unlock()
+	state := pm.topology.state
+	state.Dead = append([]string{}, state.Dead...)
+	return state
+}
+
+// WaitTopology blocks until the topology version differs from version or
+// timeout passes, and returns the current topology.
+func (pm *PeerManager) WaitTopology(version uint64, timeout time.Duration) TopologyState {
+	pm.topology.mutex.Lock()
+	if pm.topology.changed == nil {
+		pm.topology.changed = make(chan struct{})
+	}
+	changed := pm.topology.changed
+	current := pm.topology.state.Version
+	pm.topology.mutex.Unlock()
+
+	if current == version {
+		select {
+		case <-changed:
+		case <-time.After(timeout):
+		}
+	}
+	return pm.Topology()
+}
+
+// adoptTopology replaces the local topology state with state if it is
+// newer, and reports whether it did.
+func (pm *PeerManager) adoptTopology(state TopologyState) bool {
+	pm.topology.mutex.Lock()
+	defer pm.topology.mutex.Unlock()
+
+	if state.Version <= pm.topology.state.Version {
+		return false
+	}
+	pm.topology.state = state
+	pm.topology.dead = make(map[string]bool, len(state.Dead))
+	for _, nodeID := range state.Dead {
+		pm.topology.dead[nodeID] = true
+	}
+	if pm.topology.changed != nil {
+		close(pm.topology.changed)
+	}
+	pm.topology.changed = make(chan struct{})
+	topologyVersionGauge.Set(float64(state.Version))
+	return true
+}
+
+// applyFailover handles a FAILOVER frame from a peer.
+func (pm *PeerManager) applyFailover(payload string) {
+	var state TopologyState
+	if err := json.Unmarshal([]byte(payload), &state); err != nil {
+		peerLog.Printf("Invalid failover frame: %v", err)
+		return
+	}
+	if pm.adoptTopology(state) {
+		pm.noteChurn("topology_changed")
+		peerLog.Printf("Topology version %d from %s: dead nodes %v", state.Version, state.Leader, state.Dead)
+		events.Record(events.KindTopology, "Adopted topology version %d from %s: dead nodes %v", state.Version, state.Leader, state.Dead)
+	}
+}
+
+func (pm *PeerManager) failoverLoop() {
+	deadAfter := time.Duration(pm.config.Failover.DeadAfterMS) * time.Millisecond
+	var announced time.Time
+
+	for pm.sleep(time.Second) {
+		now := time.Now()
+		changed := pm.failOver(now, deadAfter)
+		state := pm.Topology()
+		if !changed && (state.Version == 0 || now.Sub(announced) < failoverAnnounceInterval) {
+			continue
+		}
+
+		data, err := json.Marshal(state)
+		if err != nil {
+			continue
+		}
+		pm.broadcast(func(peer *Peer) string {
+			if peer.ProtocolVersion < 2 {
+				return ""
+			}
+			return fmt.Sprintf("FAILOVER|%s\n", string(data))
+		})
+		announced = now
+	}
+}
+
+// failOver declares members dead or brings them back when this node is
+// the leader, and reports whether it changed the topology.
+func (pm *PeerManager) failOver(now time.Time, deadAfter time.Duration) bool {
+	self := pm.cacheManager.NodeID()
+	linked, lastSeen := pm.memberLinks()
+	if !pm.leads(self, linked) {
+		return false
+	}
+	if pm.config.Failover.Quorum && !pm.Reachability().Quorum() {
+		return false
+	}
+
+	pm.topology.mutex.Lock()
+	if pm.topology.lastLinked == nil {
+		pm.topology.lastLinked = make(map[string]time.Time)
+	}
+	for nodeID, seen := range lastSeen {
+		if _, known := pm.topology.lastLinked[nodeID]; !known {
+			pm.topology.lastLinked[nodeID] = seen
+		}
+	}
+	for nodeID := range pm.topology.dead {
+		if _, known := pm.topology.lastLinked[nodeID]; !known {
+			pm.topology.lastLinked[nodeID] = now
+		}
+	}
+	for nodeID := range linked {
+		pm.topology.lastLinked[nodeID] = now
+	}
+
+	dead := make([]string, 0, len(pm.topology.dead))
+	changed := false
+	for nodeID, last := range pm.topology.lastLinked {
+		switch {
+		case pm.topology.dead[nodeID] && linked[nodeID]:
+			changed = true
+			failovers.Inc("revived")
+			peerLog.Printf("Node %s is back, returning its ranges", nodeID)
+			events.Record(events.KindTopology, "Declared %s back", nodeID)
+		case pm.topology.dead[nodeID]:
+			dead = append(dead, nodeID)
+		case now.Sub(last) >= deadAfter:
+			dead = append(dead, nodeID)
+			changed = true
+			failovers.Inc("dead")
+			peerLog.Printf("Node %s unreachable for %v, promoting its replicas", nodeID, now.Sub(last).Round(time.Second))
+			events.Record(events.KindTopology, "Declared %s dead after %v unreachable", nodeID, now.Sub(last).Round(time.Second))
+		}
+	}
+	version := pm.topology.state.Version
+	pm.topology.mutex.Unlock()
+
+	if !changed {
+		return false
+	}
+	sort.Strings(dead)
+	pm.adoptTopology(TopologyState{Version: version + 1, Leader: self, Dead: dead, Changed: now})
+	pm.noteChurn("topology_changed")
+	return true
+}
+
+// leads reports whether this node is the failover leader: the lowest node
+// ID among itself and the linked nodes that aren't dead. A node that has
+// been declared dead never leads, so one cut off from the leader can't
+// declare the rest of the cluster dead in turn.
+func (pm *PeerManager) leads(self string, linked map[string]bool) bool {
+	pm.topology.mutex.Lock()
+	defer pm.topology.mutex.Unlock()
+
+	if pm.topology.dead[self] {
+		return false
+	}
+	for nodeID := range linked {
+		if nodeID < self && !pm.topology.dead[nodeID] {
+			return false
+		}
+	}
+	return true
+}
+
+// linksLost records that the nodes were linked until now. An inbound link
+// from a node this one has no configured address for leaves no peer entry
+// behind, so without it a node cut off before the leader's next round
+// would never be declared dead.
+func (pm *PeerManager) linksLost(nodeIDs []string, now time.Time) {
+	pm.topology.mutex.Lock()
+	defer pm.topology.mutex.Unlock()
+
+	for _, nodeID := range nodeIDs {
+		if nodeID == "" {
+			continue
+		}
+		if pm.topology.lastLinked == nil {
+			pm.topology.lastLinked = make(map[string]time.Time)
+		}
+		pm.topology.lastLinked[nodeID] = now
+	}
+}
+
+// memberLinks returns the node IDs of linked peers, and when every peer
+// with a known node ID was last heard from.
+func (pm *PeerManager) memberLinks() (map[string]bool, map[string]time.Time) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	linked := make(map[string]bool, len(pm.peers))
+	lastSeen := make(map[string]time.Time, len(pm.peers))
+	for _, peer := range pm.peers {
+		if peer.NodeID == "" {
+			continue
+		}
+		if peer.Connected {
+			linked[peer.NodeID] = true
+		}
+		if peer.LastSeen.After(lastSeen[peer.NodeID]) {
+			lastSeen[peer.NodeID] = peer.LastSeen
+		}
+	}
+	return linked, lastSeen
+}
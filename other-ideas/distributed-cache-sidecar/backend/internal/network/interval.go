@@ -0,0 +1,62 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/metrics"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	peerEvents = metrics.NewCounter("sidecar_peer_events_total",
+		"Peer link events: connected, connect_failed, disconnected and health_failed.", "event")
+	loopInterval = metrics.NewGauge("sidecar_peer_loop_interval_seconds",
+		"Current interval of the peer sync and health check loops.", "loop")
+)
+
+// noteChurn records a change in the peer set or a failure talking to a
+// peer. Adaptive loops tighten their interval when they see churn.
+func (pm *PeerManager) noteChurn(event string) {
+	atomic.AddUint64(&pm.churn, 1)
+	peerEvents.Inc(event)
+}
+
+// loopTimer paces a periodic peer loop. A fixed interval always waits
+// base. An adaptive one doubles after every round without churn, up to
+// max, and drops to min as soon as churn is seen, so a stable cluster
+// goes quiet while a changing one converges quickly.
+type loopTimer struct {
+	name      string
+	base      time.Duration
+	min       time.Duration
+	max       time.Duration
+	adaptive  bool
+	current   time.Duration
+	lastChurn uint64
+}
+
+func newLoopTimer(name string, base, min, max time.Duration, adaptive bool) *loopTimer {
+	t := &loopTimer{name: name, base: base, min: min, max: max, adaptive: adaptive, current: base}
+	if adaptive {
+		// Startup is churn: peers still need to be connected.
+		t.current = min
+	}
+	loopInterval.Set(t.current.Seconds(), name)
+	return t
+}
+
+// next returns how long to wait before the next round, given the churn
+// counter after the round that just finished.
+func (t *loopTimer) next(churn uint64) time.Duration {
+	if !t.adaptive {
+		return t.base
+	}
+
+	if churn != t.lastChurn {
+		t.current = t.min
+	} else if t.current *= 2; t.current > t.max {
+		t.current = t.max
+	}
+	t.lastChurn = churn
+	loopInterval.Set(t.current.Seconds(), t.name)
+	return t.current
+}
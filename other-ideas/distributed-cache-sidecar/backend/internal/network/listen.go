@@ -0,0 +1,105 @@
+package network
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/metrics"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	acceptQueueGauge = metrics.NewGauge("sidecar_tcp_accept_queue",
+		"Connections waiting in a listener's accept queue.", "listener", "acceptor")
+	acceptQueueLimitGauge = metrics.NewGauge("sidecar_tcp_accept_queue_limit",
+		"Capacity of a listener's accept queue.", "listener", "acceptor")
+)
+
+// Listen opens a listener on each of addresses, or with acceptors above 1
+// that many SO_REUSEPORT listeners per address, among which the kernel
+// spreads incoming connections.
+//
+// An IPv4 literal binds only IPv4, and an IPv6 literal only IPv6, except
+// that the IPv6 wildcard "[::]" also accepts IPv4 where the OS allows it
+// unless an IPv4 address with the same port is listed too. That way
+// "[::]:8080" alone is dual-stack while "0.0.0.0:8080,[::]:8080" binds
+// both families side by side. A host name or an empty host listens on
+// both families.
+func Listen(addresses []string, acceptors int) ([]net.Listener, error) {
+	var config net.ListenConfig
+	if acceptors > 1 {
+		config.Control = reusePort
+	} else {
+		acceptors = 1
+	}
+
+	listeners := make([]net.Listener, 0, len(addresses)*acceptors)
+	for _, address := range addresses {
+		for i := 0; i < acceptors; i++ {
+			listener, err := config.Listen(context.Background(), listenNetwork(address, addresses), address)
+			if err != nil {
+				for _, opened := range listeners {
+					opened.Close()
+				}
+				return nil, err
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners, nil
+}
+
+func listenNetwork(address string, addresses []string) string {
+	ip, port := splitIP(address)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	case !ip.IsUnspecified():
+		return "tcp6"
+	}
+	for _, other := range addresses {
+		if otherIP, otherPort := splitIP(other); otherIP != nil && otherIP.To4() != nil && otherPort == port {
+			return "tcp6"
+		}
+	}
+	return "tcp"
+}
+
+// splitIP returns the IP literal and port in address; the IP is nil for
+// host names and empty hosts.
+func splitIP(address string) (net.IP, string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, ""
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host), port
+}
+
+// sampleAcceptQueues exports the accept queue of each of listeners, the
+// acceptors of a TCP server, every interval until stop is closed. It
+// stops at once where the queues can't be read.
+func sampleAcceptQueues(listeners []net.Listener, interval time.Duration, stop <-chan struct{}) {
+	for {
+		for i, listener := range listeners {
+			waiting, limit, err := acceptQueue(listener)
+			if err != nil {
+				tcpLog.Printf("Accept queue metrics unavailable: %v", err)
+				return
+			}
+			address, acceptor := listener.Addr().String(), strconv.Itoa(i)
+			acceptQueueGauge.Set(float64(waiting), address, acceptor)
+			acceptQueueLimitGauge.Set(float64(limit), address, acceptor)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func reusePort(network, address string, conn syscall.RawConn) error {
+	var sockErr error
+	err := conn.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// acceptQueue returns the connections waiting in listener's accept queue
+// and the queue's capacity. For a listening socket, TCP_INFO reports them
+// as unacked and sacked.
+func acceptQueue(listener net.Listener) (waiting, limit int, err error) {
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return 0, 0, fmt.Errorf("%T is not a TCP listener", listener)
+	}
+	conn, err := tcp.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var info *unix.TCPInfo
+	var sockErr error
+	err = conn.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if sockErr != nil {
+		return 0, 0, sockErr
+	}
+	return int(info.Unacked), int(info.Sacked), nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package network
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var errNotLinux = errors.New("only supported on Linux")
+
+func reusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT acceptors are " + errNotLinux.Error())
+}
+
+func acceptQueue(listener net.Listener) (int, int, error) {
+	return 0, 0, errNotLinux
+}
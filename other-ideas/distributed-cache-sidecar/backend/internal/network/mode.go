@@ -0,0 +1,103 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NodeMode returns this node's current mode.
+func (pm *PeerManager) NodeMode() string {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return pm.mode
+}
+
+// Witness reports whether this node is a witness.
+func (pm *PeerManager) Witness() bool {
+	return pm.NodeMode() == config.NodeModeWitness
+}
+
+// Standby reports whether this node is a standby that hasn't been promoted.
+func (pm *PeerManager) Standby() bool {
+	return pm.NodeMode() == config.NodeModeStandby
+}
+
+// Witnesses returns the node IDs of linked witnesses, sorted, including
+// this node if it is one.
+func (pm *PeerManager) Witnesses() []string {
+	return pm.nodesInMode(config.NodeModeWitness)
+}
+
+// Standbys returns the node IDs of linked standbys, sorted, including this
+// node if it is one.
+func (pm *PeerManager) Standbys() []string {
+	return pm.nodesInMode(config.NodeModeStandby)
+}
+
+func (pm *PeerManager) nodesInMode(mode string) []string {
+	pm.mutex.RLock()
+	nodes := []string{}
+	if pm.mode == mode {
+		nodes = append(nodes, pm.cacheManager.NodeID())
+	}
+	for _, peer := range pm.peers {
+		if peer.Connected && peer.NodeID != "" && peer.Mode == mode {
+			nodes = append(nodes, peer.NodeID)
+		}
+	}
+	pm.mutex.RUnlock()
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Promote turns this standby into a data node and tells its peers, which
+// then place it on their rings. It reports whether the node was a standby.
+func (pm *PeerManager) Promote() bool {
+	pm.mutex.Lock()
+	if pm.mode != config.NodeModeStandby {
+		pm.mutex.Unlock()
+		return false
+	}
+	pm.mode = config.NodeModeData
+	pm.mutex.Unlock()
+
+	peerLog.Printf("Promoted from standby to data node")
+	events.Record(events.KindConfig, "Promoted from standby to data node")
+	pm.noteChurn("promoted")
+	nodeID := pm.cacheManager.NodeID()
+	pm.broadcast(func(peer *Peer) string {
+		if peer.ProtocolVersion < 2 {
+			return ""
+		}
+		return fmt.Sprintf("MODE|%s|%s\n", nodeID, config.NodeModeData)
+	})
+	return true
+}
+
+// applyMode handles a MODE frame, sent by a peer whose mode changed.
+func (pm *PeerManager) applyMode(payload string) {
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		peerLog.Printf("Invalid mode frame: %s", payload)
+		return
+	}
+
+	pm.mutex.Lock()
+	for _, peer := range pm.peers {
+		if peer.NodeID == parts[0] {
+			peer.Mode = parts[1]
+		}
+	}
+	pm.mutex.Unlock()
+	peerLog.Printf("Node %s is now in %s mode", parts[0], parts[1])
+	events.Record(events.KindTopology, "Node %s is now in %s mode", parts[0], parts[1])
+}
+
+// holdsKeys reports whether a node in mode can own keys. Nodes that don't
+// report a mode are data nodes.
+func holdsKeys(mode string) bool {
+	return mode == "" || mode == config.NodeModeData
+}
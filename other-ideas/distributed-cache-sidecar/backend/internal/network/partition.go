@@ -0,0 +1,51 @@
+package network
+
+import "time"
+
+// Reachability summarises how much of the cluster this node can currently
+// replicate with.
+type Reachability struct {
+	Linked int `json:"linked"`
+	Known  int `json:"known"`
+	// Since is the longest time an unlinked peer has gone unheard from
+	// (or since startup for peers never reached). Updates written on those
+	// peers after Since may be missing here.
+	Since time.Time `json:"since,omitempty"`
+}
+
+// Unlinked is the fraction of known peers this node has no link to.
+func (r Reachability) Unlinked() float64 {
+	if r.Known == 0 {
+		return 0
+	}
+	return float64(r.Known-r.Linked) / float64(r.Known)
+}
+
+// Quorum reports whether this node and the peers it is linked to are a
+// majority of the cluster.
+func (r Reachability) Quorum() bool {
+	return 2*(r.Linked+1) > r.Known+1
+}
+
+func (pm *PeerManager) Reachability() Reachability {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	var reach Reachability
+	for _, peer := range pm.peers {
+		reach.Known++
+		if peer.Connected {
+			reach.Linked++
+			continue
+		}
+
+		lastSeen := peer.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = pm.started
+		}
+		if reach.Since.IsZero() || lastSeen.Before(reach.Since) {
+			reach.Since = lastSeen
+		}
+	}
+	return reach
+}
@@ -4,59 +4,199 @@ import (
 	"bufio"
 	"distributed-cache-sidecar/internal/cache"
 	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/panics"
+	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var peerLog = logging.New("peer")
+
 type PeerManager struct {
 	config       *config.Config
 	cacheManager *cache.Manager
 	peers        map[string]*Peer
 	mutex        sync.RWMutex
-	running      bool
+	// running is 1 from Start until Stop, read and written atomically as
+	// the peer readers check it without the lock.
+	running int32
+	// stop is closed by Stop, ending the manager's loops.
+	stop chan struct{}
+	// mode is this node's mode, which starts as config.NodeMode and
+	// changes when a standby is promoted. Guarded by mutex.
+	mode string
+
+	// churn counts link changes and failures; see noteChurn.
+	churn   uint64
+	started time.Time
+
+	placement placement
+	topology  topologyState
+	traffic   *trafficLog
+	// wan delays and drops frames to peers when simulation.wan is set.
+	wan *wanSimulator
+
+	// dialer replaces dialPeer when set; see SetDialer.
+	dialer Dialer
+	// readPolicy replaces placement.read_policy when set; see
+	// SetReadPolicy.
+	readPolicy ReadPolicy
 }
 
+// Peer is a node this one replicates with. Configured peers are keyed by
+// their configured address; nodes that dial in without being configured
+// here get an entry keyed by their connection's remote address for as long
+// as the link lasts. Inbound is set when the current link was dialed by
+// the peer rather than by this node. Latency is the smoothed round trip
+// time of health check pings, 0 until the first one is answered. Traffic
+// is only filled in by GetPeers.
 type Peer struct {
-	Address    string
-	Region     string
-	Connected  bool
-	LastSeen   time.Time
-	Connection net.Conn
+	Address         string
+	NodeID          string
+	Region          string
+	ProtocolVersion int
+	HTTPURL         string
+	Connected       bool
+	Inbound         bool
+	Compression     string
+	Weight          float64
+	Zone            string
+	Group           string
+	Mode            string
+	LastSeen        time.Time
+	Latency         time.Duration
+	Traffic         Traffic
+	Connection      net.Conn
+
+	configured  bool
+	unreachable bool
+	pingSent    time.Time
 }
 
 func NewPeerManager(cfg *config.Config, cacheManager *cache.Manager) *PeerManager {
-	return &PeerManager{
+	pm := &PeerManager{
 		config:       cfg,
 		cacheManager: cacheManager,
 		peers:        make(map[string]*Peer),
+		mode:         cfg.NodeMode,
+		started:      time.Now(),
+		stop:         make(chan struct{}),
+		traffic:      newTrafficLog(),
+	}
+	pm.wan = newWANSimulator(pm)
+	if len(cfg.Placement.PrefixGroups) > 0 {
+		cacheManager.AddHook("", &groupHook{pm: pm})
 	}
+	if acksConfigured(cfg) {
+		cacheManager.AddHook("", &ackHook{pm: pm})
+	}
+	return pm
 }
 
 func (pm *PeerManager) Start() {
-	pm.running = true
-	
+	atomic.StoreInt32(&pm.running, 1)
+
 	for _, peerAddr := range pm.config.Peers {
 		pm.addPeer(peerAddr)
 	}
 
-	go pm.syncLoop()
-	go pm.healthCheckLoop()
-	
-	changeChannel := pm.cacheManager.GetChangeChannel()
-	go func() {
-		for item := range changeChannel {
-			pm.broadcastItem(item)
+	lifecycle.Go("peer-sync", "", pm.syncLoop)
+	lifecycle.Go("peer-health", "", pm.healthCheckLoop)
+	if pm.Partitioned() && pm.config.Failover.DeadAfterMS > 0 {
+		lifecycle.Go("failover", "", pm.failoverLoop)
+	}
+
+	coalescer := newCoalescer(pm)
+	if coalescer != nil {
+		coalescer.start(pm.stop)
+	}
+
+	changes := pm.cacheManager.Subscribe("")
+	lifecycle.Go("replication-sender", "sync", func() {
+		for {
+			select {
+			case event := <-changes:
+				item := event.Item
+				switch {
+				case item.Deleted():
+					if coalescer != nil {
+						coalescer.release(item.Key)
+					}
+					pm.broadcastDelete(item)
+				case coalescer == nil || !coalescer.hold(item):
+					pm.broadcastItem(item)
+				}
+			case <-pm.stop:
+				return
+			}
 		}
-	}()
+	})
+
+	batchChannel := pm.cacheManager.GetBatchChannel()
+	lifecycle.Go("replication-sender", "batch", func() {
+		for {
+			select {
+			case items := <-batchChannel:
+				if coalescer != nil {
+					sent := items[:0:0]
+					for _, item := range items {
+						if !coalescer.hold(item) {
+							sent = append(sent, item)
+						}
+					}
+					items = sent
+				}
+				pm.broadcastBatch(items)
+			case <-pm.stop:
+				return
+			}
+		}
+	})
+
+	tagChannel := pm.cacheManager.GetTagChannel()
+	lifecycle.Go("replication-sender", "tags", func() {
+		for {
+			select {
+			case invalidation := <-tagChannel:
+				if coalescer != nil {
+					for _, deleted := range invalidation.Deleted {
+						coalescer.release(deleted.Key)
+					}
+				}
+				pm.broadcastTagInvalidation(invalidation)
+			case <-pm.stop:
+				return
+			}
+		}
+	})
+
+	patchChannel := pm.cacheManager.GetPatchChannel()
+	lifecycle.Go("replication-sender", "patch", func() {
+		for {
+			select {
+			case op := <-patchChannel:
+				if coalescer != nil {
+					coalescer.release(op.Key)
+				}
+				pm.broadcastPatch(op)
+			case <-pm.stop:
+				return
+			}
+		}
+	})
 }
 
 func (pm *PeerManager) Stop() {
-	pm.running = false
-	
+	atomic.StoreInt32(&pm.running, 0)
+	close(pm.stop)
+
 	pm.mutex.Lock()
 	for _, peer := range pm.peers {
 		if peer.Connection != nil {
@@ -69,68 +209,414 @@ func (pm *PeerManager) Stop() {
 func (pm *PeerManager) addPeer(address string) {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
-	
+
 	if _, exists := pm.peers[address]; !exists {
 		pm.peers[address] = &Peer{
-			Address:   address,
-			Connected: false,
-			LastSeen:  time.Now(),
+			Address:    address,
+			Connected:  false,
+			LastSeen:   time.Now(),
+			configured: true,
 		}
 	}
 }
 
+// Attach makes server hand connections that open with a HELLO to this
+// manager, so they become replication links used in both directions.
+func (pm *PeerManager) Attach(server *TCPServer) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.peerManager = pm
+}
+
 func (pm *PeerManager) connectToPeer(peer *Peer) error {
-	conn, err := net.DialTimeout("tcp", peer.Address, 10*time.Second)
+	conn, err := pm.dial(peer.Address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	remote, err := pm.handshake(peer.Address, conn, reader)
 	if err != nil {
+		conn.Close()
 		return err
 	}
 
+	pm.mutex.Lock()
+	nodeID := peer.NodeID
+	if remote.NodeID != "" {
+		nodeID = remote.NodeID
+	}
+	existing := pm.linkTo(nodeID, peer)
+	if existing == nil && peer.Connected {
+		// The node dialed this one meanwhile, and its link was accepted
+		// onto this same peer.
+		existing = peer
+	}
+	if existing != nil {
+		if pm.preferExisting(existing, pm.cacheManager.NodeID()) {
+			if existing != peer {
+				pm.merge(peer, existing)
+			}
+			pm.mutex.Unlock()
+			conn.Close()
+			peerLog.Printf("Already linked to %s, dropping new connection to %s", existing.NodeID, peer.Address)
+			return nil
+		}
+		pm.dropLink(existing)
+	}
+	peer.ProtocolVersion = remote.ProtocolVersion
+	if remote.NodeID != "" {
+		peer.NodeID = remote.NodeID
+		peer.Region = remote.Region
+		peer.HTTPURL = remote.httpURL(peer.Address)
+		peer.Compression = chooseCompression(pm.config.Replication.Compression, remote.Compression)
+		peer.Weight = remote.Weight
+		peer.Zone = remote.Zone
+		peer.Group = remote.Group
+		peer.Mode = remote.Mode
+	}
 	peer.Connection = conn
 	peer.Connected = true
+	peer.Inbound = false
 	peer.LastSeen = time.Now()
-	
-	go pm.handlePeerConnection(peer)
-	
+	peer.unreachable = false
+	pm.mutex.Unlock()
+	pm.noteChurn("connected")
+	events.Record(events.KindPeer, "Linked to %s at %s", nodeID, peer.Address)
+
+	lifecycle.Go("peer-reader", peer.Address, func() {
+		pm.handlePeerConnection(peer, conn, reader)
+	})
+
 	return nil
 }
 
-func (pm *PeerManager) handlePeerConnection(peer *Peer) {
-	defer func() {
-		peer.Connected = false
-		if peer.Connection != nil {
-			peer.Connection.Close()
+// linkTo returns a peer other than except that is connected to nodeID.
+// Every pair of nodes keeps a single replication link: when both nodes
+// dial each other, the connection dialed by the node with the lower node
+// ID wins, so both ends independently drop the same one. Callers must
+// hold pm.mutex.
+func (pm *PeerManager) linkTo(nodeID string, except *Peer) *Peer {
+	if nodeID == "" {
+		return nil
+	}
+	for _, peer := range pm.peers {
+		if peer != except && peer.Connected && peer.NodeID == nodeID {
+			return peer
+		}
+	}
+	return nil
+}
+
+// preferExisting reports whether the existing link should be kept over a
+// new connection to the same node dialed by newDialer. A node redialing
+// its own link replaces it, since the old one is most likely dead; this
+// node never redials a connected peer, so for outbound links that only
+// happens when two configured addresses reach the same node.
+func (pm *PeerManager) preferExisting(existing *Peer, newDialer string) bool {
+	local := pm.cacheManager.NodeID()
+	existingDialer := local
+	if existing.Inbound {
+		existingDialer = existing.NodeID
+	}
+	if existingDialer == newDialer {
+		return newDialer == local
+	}
+	return existingDialer < newDialer
+}
+
+// merge moves an inbound link from an unconfigured entry onto the
+// configured peer for the same node. Callers must hold pm.mutex.
+func (pm *PeerManager) merge(peer, existing *Peer) {
+	if existing.configured {
+		return
+	}
+	delete(pm.peers, existing.Address)
+	peer.NodeID = existing.NodeID
+	peer.Region = existing.Region
+	peer.ProtocolVersion = existing.ProtocolVersion
+	peer.HTTPURL = existing.HTTPURL
+	peer.Compression = existing.Compression
+	peer.Weight = existing.Weight
+	peer.Zone = existing.Zone
+	peer.Group = existing.Group
+	peer.Mode = existing.Mode
+	peer.Connection = existing.Connection
+	peer.Connected = true
+	peer.Inbound = true
+	peer.LastSeen = existing.LastSeen
+}
+
+// dropLink closes peer's link. Callers must hold pm.mutex.
+func (pm *PeerManager) dropLink(peer *Peer) {
+	if peer.Connection != nil {
+		peer.Connection.Close()
+	}
+	peer.Connection = nil
+	peer.Connected = false
+	if !peer.configured {
+		delete(pm.peers, peer.Address)
+	}
+}
+
+// acceptLink takes over an inbound connection whose HELLO has been
+// answered. It returns false when an existing link to the node wins, in
+// which case the caller closes the connection.
+func (pm *PeerManager) acceptLink(conn net.Conn, remote Hello, version int) bool {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if existing := pm.linkTo(remote.NodeID, nil); existing != nil {
+		if pm.preferExisting(existing, remote.NodeID) {
+			return false
+		}
+		pm.dropLink(existing)
+	}
+
+	var peer *Peer
+	for _, candidate := range pm.peers {
+		if candidate.configured && candidate.NodeID == remote.NodeID {
+			peer = candidate
+			break
+		}
+	}
+	if peer == nil {
+		peer = &Peer{Address: conn.RemoteAddr().String()}
+		pm.peers[peer.Address] = peer
+	}
+
+	peer.NodeID = remote.NodeID
+	peer.Region = remote.Region
+	peer.ProtocolVersion = version
+	peer.HTTPURL = remote.httpURL(conn.RemoteAddr().String())
+	peer.Compression = chooseCompression(pm.config.Replication.Compression, remote.Compression)
+	peer.Weight = remote.Weight
+	peer.Zone = remote.Zone
+	peer.Group = remote.Group
+	peer.Mode = remote.Mode
+	peer.Connection = conn
+	peer.Connected = true
+	peer.Inbound = true
+	peer.LastSeen = time.Now()
+	pm.noteChurn("connected")
+	events.Record(events.KindPeer, "Linked to %s from %s", peer.NodeID, peer.Address)
+	return true
+}
+
+// linkClosed marks the peer using conn as disconnected. Links that were
+// already replaced are left alone.
+func (pm *PeerManager) linkClosed(conn net.Conn) {
+	pm.mutex.Lock()
+	var lost []string
+	for _, peer := range pm.peers {
+		if peer.Connection == conn {
 			peer.Connection = nil
+			peer.Connected = false
+			if !peer.configured {
+				delete(pm.peers, peer.Address)
+			}
+			lost = append(lost, peer.NodeID)
+			pm.noteChurn("disconnected")
+			events.Record(events.KindPeer, "Lost link to %s at %s", peer.NodeID, peer.Address)
 		}
+	}
+	pm.mutex.Unlock()
+
+	pm.linksLost(lost, time.Now())
+}
+
+// handshake negotiates the protocol version with the newly dialed peer at
+// address and returns its HELLO, for the caller to record under pm.mutex.
+// Peers from before the handshake existed answer HELLO with an unknown
+// command error and are spoken to with version 1 frames; for them the
+// HELLO returned only carries that version.
+func (pm *PeerManager) handshake(address string, conn net.Conn, reader *bufio.Reader) (Hello, error) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := localHello(pm.cacheManager.NodeID(), pm.cacheManager.Region(), pm.config.AdvertiseURL, pm.config.HTTPPort)
+	hello.Compression = pm.config.Replication.Compression
+	hello.Weight = pm.config.Placement.Weight
+	hello.Zone = pm.config.Placement.Zone
+	hello.Group = pm.config.Placement.Group
+	hello.Mode = pm.NodeMode()
+	if _, err := conn.Write([]byte(encodeHello(hello))); err != nil {
+		return Hello{}, err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return Hello{}, err
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 2)
+	if len(parts) == 2 && parts[0] == "ERROR" && parts[1] == "Unknown command" {
+		peerLog.Printf("Peer %s does not support the handshake, using protocol version 1", address)
+		return Hello{ProtocolVersion: 1}, nil
+	}
+	if len(parts) < 2 || parts[0] != "OK" {
+		return Hello{}, fmt.Errorf("handshake rejected by %s: %s", address, strings.TrimSpace(line))
+	}
+
+	var remote Hello
+	if err := json.Unmarshal([]byte(parts[1]), &remote); err != nil {
+		return Hello{}, fmt.Errorf("invalid handshake from %s: %v", address, err)
+	}
+	return remote, nil
+}
+
+func (pm *PeerManager) handlePeerConnection(peer *Peer, conn net.Conn, reader *bufio.Reader) {
+	defer panics.Recover("peer " + peer.Address)
+	defer func() {
+		conn.Close()
+		pm.linkClosed(conn)
 	}()
 
-	scanner := bufio.NewScanner(peer.Connection)
-	for scanner.Scan() && pm.running {
-		message := strings.TrimSpace(scanner.Text())
-		if message != "" {
-			pm.processPeerMessage(peer, message)
+	// Later handshakes with the same node rewrite peer under pm.mutex, so
+	// traffic is counted under the label it had when this link was made.
+	pm.mutex.RLock()
+	label := peer.label()
+	pm.mutex.RUnlock()
+
+	scanner := frameScanner(reader)
+	for scanner.Scan() && atomic.LoadInt32(&pm.running) == 1 {
+		wire := strings.TrimSpace(scanner.Text())
+		// The peer health checks links it accepted by pinging down them.
+		switch wire {
+		case "":
+			continue
+		case "PING":
+			conn.Write([]byte("PONG\n"))
+			continue
+		case "PONG":
+			pm.processPeerMessage(peer, label, wire)
+			continue
 		}
+
+		pm.traffic.received(label, len(wire)+1)
+		message, err := expandFrame(wire)
+		if err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Dropped frame from peer %s: %v", peer.Address, err)
+			continue
+		}
+		pm.processPeerMessage(peer, label, message)
 	}
 }
 
-func (pm *PeerManager) processPeerMessage(peer *Peer, message string) {
-	parts := strings.Split(message, "|")
+// processPeerMessage applies a message from peer, whose failures are
+// counted under label.
+func (pm *PeerManager) processPeerMessage(peer *Peer, label, message string) {
+	if message == "PONG" {
+		pm.mutex.Lock()
+		pm.ponged(peer)
+		pm.mutex.Unlock()
+		return
+	}
+
+	parts := strings.SplitN(message, "|", 2)
 	if len(parts) < 2 {
 		return
 	}
 
 	command := parts[0]
-	
+
 	switch command {
 	case "SYNC":
-		if len(parts) >= 2 {
-			itemData := parts[1]
-			item, err := pm.cacheManager.DeserializeItem([]byte(itemData))
-			if err == nil {
-				pm.cacheManager.SetRemote(item)
-			}
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		item, route, err := applySync(pm.cacheManager, version, body)
+		if err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Rejected item from peer %s: %v", peer.Address, err)
+		} else if item != nil {
+			pm.relay(route, item)
+		}
+	case "SYNCD":
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		item, route, want, err := applySyncDigest(pm.cacheManager, version, body)
+		switch {
+		case err != nil:
+			pm.traffic.failed(label)
+			peerLog.Printf("Rejected item from peer %s: %v", peer.Address, err)
+		case want != "":
+			pm.send(peer, want+"\n")
+		case item != nil:
+			pm.relay(route, item)
+		}
+	case "MSYNC":
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		items, route, err := applySyncBatch(pm.cacheManager, version, body)
+		if err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Rejected batch from peer %s: %v", peer.Address, err)
 		}
-	case "PONG":
-		peer.LastSeen = time.Now()
+		for _, item := range items {
+			pm.relay(route, item)
+		}
+	case "WANT":
+		if message := pm.wanted(parts[1]); message != "" {
+			pm.send(peer, message)
+		}
+	case "PATCH":
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		item, route, err := applyPatch(pm.cacheManager, version, body)
+		if err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Failed to apply patch from peer %s: %v", peer.Address, err)
+		} else if item != nil {
+			pm.relay(route, item)
+		}
+	case "DEL":
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		if err := applyDelete(pm.cacheManager, version, body); err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Rejected delete from peer %s: %v", peer.Address, err)
+		}
+	case "TAG_INVALIDATE":
+		if pm.Witness() {
+			return
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return
+		}
+		if _, err := applyTagInvalidation(pm.cacheManager, version, body); err != nil {
+			pm.traffic.failed(label)
+			peerLog.Printf("Rejected tag invalidation from peer %s: %v", peer.Address, err)
+		}
+	case "FAILOVER":
+		pm.applyFailover(parts[1])
+	case "MODE":
+		pm.applyMode(parts[1])
 	}
 }
 
@@ -140,48 +626,156 @@ func (pm *PeerManager) broadcastItem(item *cache.CacheItem) {
 		return
 	}
 
-	message := fmt.Sprintf("SYNC|%s\n", string(data))
+	digested := pm.digestBody(item)
+
+	route := []string{pm.cacheManager.NodeID()}
+	pm.broadcast(func(peer *Peer) string {
+		if !pm.replicatesTo(peer, item.Key) {
+			return ""
+		}
+		if digested != nil && peer.ProtocolVersion >= 5 {
+			return routedFrame(peer.ProtocolVersion, "SYNCD", route, digested)
+		}
+		return routedFrame(peer.ProtocolVersion, "SYNC", route, data)
+	})
+}
+
+func (pm *PeerManager) broadcastPatch(op *cache.PatchOp) {
+	data, err := pm.cacheManager.SerializePatch(op)
+	if err != nil {
+		return
+	}
+
+	// Version 1 peers don't understand PATCH, so they get the patched item
+	// as a plain SYNC instead.
+	legacy, err := pm.cacheManager.SerializeItem(patchResult(op))
+	if err != nil {
+		return
+	}
 
+	route := []string{pm.cacheManager.NodeID()}
+	pm.broadcast(func(peer *Peer) string {
+		if !pm.replicatesTo(peer, op.Key) {
+			return ""
+		}
+		if peer.ProtocolVersion < 2 {
+			return frame(peer.ProtocolVersion, "SYNC", legacy)
+		}
+		return routedFrame(peer.ProtocolVersion, "PATCH", route, data)
+	})
+}
+
+// broadcastDelete replicates the delete of the write deleted names. Peers
+// before version 4 don't understand DEL and keep their copy until it
+// expires.
+func (pm *PeerManager) broadcastDelete(deleted *cache.CacheItem) {
+	data, err := pm.cacheManager.SerializeItem(deleted)
+	if err != nil {
+		return
+	}
+
+	route := []string{pm.cacheManager.NodeID()}
+	pm.broadcast(func(peer *Peer) string {
+		if peer.ProtocolVersion < 4 || !pm.replicatesTo(peer, deleted.Key) {
+			return ""
+		}
+		return routedFrame(peer.ProtocolVersion, "DEL", route, data)
+	})
+}
+
+// send writes message to peer's link, through the WAN simulation if one
+// is configured for the peer. It works on a copy of peer taken under
+// pm.mutex, as the link may be replaced meanwhile.
+func (pm *PeerManager) send(peer *Peer, message string) {
+	pm.mutex.RLock()
+	link := *peer
+	pm.mutex.RUnlock()
+
+	if pm.wan != nil && pm.wan.send(&link, message) {
+		return
+	}
+	pm.write(&link, message)
+}
+
+// write writes message to peer's link.
+func (pm *PeerManager) write(peer *Peer, message string) {
+	conn := peer.Connection
+	if conn == nil {
+		return
+	}
+	if _, err := conn.Write([]byte(pm.encodeFrame(peer, message))); err != nil {
+		pm.traffic.failed(peer.label())
+		peerLog.Printf("Failed to send to peer %s: %v", peer.Address, err)
+	}
+}
+
+// connectedPeers returns copies of the peers with a link to send on, so
+// callers can read them without holding pm.mutex.
+func (pm *PeerManager) connectedPeers() []*Peer {
 	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
 	peers := make([]*Peer, 0, len(pm.peers))
 	for _, peer := range pm.peers {
 		if peer.Connected && peer.Connection != nil {
-			peers = append(peers, peer)
+			peerCopy := *peer
+			peers = append(peers, &peerCopy)
 		}
 	}
-	pm.mutex.RUnlock()
+	return peers
+}
 
-	for _, peer := range peers {
-		if _, err := peer.Connection.Write([]byte(message)); err != nil {
-			log.Printf("Failed to send to peer %s: %v", peer.Address, err)
+// broadcast sends every connected peer the message rendered for it, so
+// each peer receives frames in its negotiated protocol version. Peers for
+// which render returns "" are skipped.
+func (pm *PeerManager) broadcast(render func(peer *Peer) string) {
+	for _, peer := range pm.connectedPeers() {
+		message := render(peer)
+		if message != "" {
+			pm.send(peer, message)
 		}
 	}
 }
 
 func (pm *PeerManager) syncLoop() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	timer := pm.newLoopTimer("sync", pm.config.Replication.SyncIntervalMS)
+	wait := timer.current
 
-	for pm.running {
-		select {
-		case <-ticker.C:
-			pm.syncWithPeers()
-		}
+	for pm.sleep(wait) {
+		pm.syncWithPeers()
+		wait = timer.next(atomic.LoadUint64(&pm.churn))
 	}
 }
 
 func (pm *PeerManager) healthCheckLoop() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+	timer := pm.newLoopTimer("health", pm.config.Replication.HealthIntervalMS)
+	wait := timer.current
 
-	for pm.running {
-		select {
-		case <-ticker.C:
-			pm.checkPeerHealth()
-		}
+	for pm.sleep(wait) {
+		pm.checkPeerHealth()
+		wait = timer.next(atomic.LoadUint64(&pm.churn))
+	}
+}
+
+// sleep waits for d and reports whether the manager is still running.
+func (pm *PeerManager) sleep(d time.Duration) bool {
+	select {
+	case <-pm.stop:
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
 
+func (pm *PeerManager) newLoopTimer(name string, baseMS int) *loopTimer {
+	replication := pm.config.Replication
+	return newLoopTimer(name,
+		time.Duration(baseMS)*time.Millisecond,
+		time.Duration(replication.MinIntervalMS)*time.Millisecond,
+		time.Duration(replication.MaxIntervalMS)*time.Millisecond,
+		replication.Adaptive)
+}
+
 func (pm *PeerManager) syncWithPeers() {
 	pm.mutex.RLock()
 	peers := make([]*Peer, 0, len(pm.peers))
@@ -191,32 +785,48 @@ func (pm *PeerManager) syncWithPeers() {
 	pm.mutex.RUnlock()
 
 	for _, peer := range peers {
-		if !peer.Connected {
+		pm.mutex.RLock()
+		linked := peer.Connected || pm.linkTo(peer.NodeID, peer) != nil
+		pm.mutex.RUnlock()
+
+		if !linked {
 			if err := pm.connectToPeer(peer); err != nil {
-				log.Printf("Failed to connect to peer %s: %v", peer.Address, err)
+				// A peer that stays down is not churn; only its first
+				// failure should tighten the loops.
+				pm.mutex.Lock()
+				first := !peer.unreachable
+				peer.unreachable = true
+				pm.mutex.Unlock()
+				if first {
+					pm.noteChurn("connect_failed")
+					events.Record(events.KindPeer, "Cannot reach peer %s: %v", peer.Address, err)
+				} else {
+					peerEvents.Inc("connect_failed")
+				}
+				peerLog.Printf("Failed to connect to peer %s: %v", peer.Address, err)
 			}
 		}
 	}
 }
 
 func (pm *PeerManager) checkPeerHealth() {
-	pm.mutex.RLock()
-	peers := make([]*Peer, 0, len(pm.peers))
+	pm.mutex.Lock()
+	conns := make(map[*Peer]net.Conn, len(pm.peers))
 	for _, peer := range pm.peers {
 		if peer.Connected && peer.Connection != nil {
-			peers = append(peers, peer)
+			conns[peer] = peer.Connection
+			pm.pinged(peer)
 		}
 	}
-	pm.mutex.RUnlock()
+	pm.mutex.Unlock()
 
-	for _, peer := range peers {
-		if _, err := peer.Connection.Write([]byte("PING\n")); err != nil {
-			log.Printf("Health check failed for peer %s: %v", peer.Address, err)
-			peer.Connected = false
-			if peer.Connection != nil {
-				peer.Connection.Close()
-				peer.Connection = nil
-			}
+	for peer, conn := range conns {
+		if _, err := conn.Write([]byte("PING\n")); err != nil {
+			pm.noteChurn("health_failed")
+			events.Record(events.KindPeer, "Health check failed for %s at %s: %v", peer.NodeID, peer.Address, err)
+			peerLog.Printf("Health check failed for peer %s: %v", peer.Address, err)
+			conn.Close()
+			pm.linkClosed(conn)
 		}
 	}
 }
@@ -224,13 +834,14 @@ func (pm *PeerManager) checkPeerHealth() {
 func (pm *PeerManager) GetPeers() []*Peer {
 	pm.mutex.RLock()
 	defer pm.mutex.RUnlock()
-	
+
 	peers := make([]*Peer, 0, len(pm.peers))
 	for _, peer := range pm.peers {
 		peerCopy := *peer
 		peerCopy.Connection = nil
+		peerCopy.Traffic = pm.traffic.get(peer.label())
 		peers = append(peers, &peerCopy)
 	}
-	
+
 	return peers
 }
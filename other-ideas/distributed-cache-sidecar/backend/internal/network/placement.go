@@ -0,0 +1,313 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/pkg/ring"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// In partitioned placement a key is replicated only to its owners: the
+// first replication_factor nodes the hash ring picks for it among this
+// node and the peers it is linked to, each weighted as announced in its
+// HELLO. Peers that didn't report a node ID (version 1) aren't members and
+// receive nothing.
+//
+// Unless placement.spread_by is "none", a key's replicas are spread across
+// failure domains (zones, or regions) before any domain gets a second copy.
+// The owner itself is always the ring's first pick, so SDKs that don't
+// know about domains still route to it.
+//
+// Only data nodes are members: witnesses and standbys are never owners.
+//
+// placement.prefix_groups dedicates keys to node groups: a key with a
+// dedicated prefix is owned, and in full placement held, only by nodes
+// announcing that group in their HELLO. The ring places it as if those
+// nodes were the only members.
+
+// placement caches the ring for the current membership.
+type placement struct {
+	mutex sync.Mutex
+	epoch string
+	ring  *ring.Ring
+}
+
+func (pm *PeerManager) Partitioned() bool {
+	return pm.config.Placement.Mode == "partitioned"
+}
+
+// Members returns the node IDs on the ring, sorted: this node and every
+// linked data node the leader hasn't declared dead.
+func (pm *PeerManager) Members() []string {
+	members, _, _ := pm.members()
+	return members
+}
+
+// members returns the sorted node IDs on the ring with the weight,
+// failure domain and group of each.
+func (pm *PeerManager) members() ([]string, map[string]float64, map[string]string) {
+	members, weights, domains, _ := pm.groupedMembers()
+	return members, weights, domains
+}
+
+func (pm *PeerManager) groupedMembers() ([]string, map[string]float64, map[string]string, map[string]string) {
+	weights := make(map[string]float64)
+	domains := make(map[string]string)
+	groups := make(map[string]string)
+	if holdsKeys(pm.NodeMode()) {
+		self := pm.cacheManager.NodeID()
+		weights[self] = pm.config.Placement.Weight
+		domains[self] = pm.domain(pm.cacheManager.Region(), pm.config.Placement.Zone)
+		groups[self] = pm.config.Placement.Group
+	}
+	dead := pm.Topology().Dead
+
+	pm.mutex.RLock()
+	for _, peer := range pm.peers {
+		if peer.Connected && peer.NodeID != "" && holdsKeys(peer.Mode) && !contains(dead, peer.NodeID) {
+			weights[peer.NodeID] = peer.Weight
+			domains[peer.NodeID] = pm.domain(peer.Region, peer.Zone)
+			groups[peer.NodeID] = peer.Group
+		}
+	}
+	pm.mutex.RUnlock()
+
+	members := make([]string, 0, len(weights))
+	for member := range weights {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, weights, domains, groups
+}
+
+// domain returns the failure domain replicas are spread across for a node
+// in region and zone. Zones are qualified with the region, since zone
+// names such as "1" repeat across regions.
+func (pm *PeerManager) domain(region, zone string) string {
+	switch pm.config.Placement.SpreadBy {
+	case "zone":
+		return region + "/" + zone
+	case "region":
+		return region
+	default:
+		return ""
+	}
+}
+
+// Ring returns the hash ring for the current membership and its epoch, a
+// string that changes whenever membership or a member's weight or failure
+// domain does.
+func (pm *PeerManager) Ring() (*ring.Ring, string) {
+	members, weights, domains, groups := pm.groupedMembers()
+
+	vnodes := pm.config.Placement.VNodes
+	parts := make([]string, len(members))
+	for i, member := range members {
+		parts[i] = member + "*" + strconv.Itoa(ring.Points(vnodes, weights[member])) + "@" + domains[member] + "#" + groups[member]
+	}
+	epoch := strings.Join(parts, ",")
+
+	pm.placement.mutex.Lock()
+	defer pm.placement.mutex.Unlock()
+	if pm.placement.ring == nil || pm.placement.epoch != epoch {
+		pm.placement.ring = ring.NewWeighted(members, weights, vnodes)
+		if pm.config.Placement.SpreadBy != "none" {
+			pm.placement.ring = pm.placement.ring.WithDomains(domains)
+		}
+		if len(pm.config.Placement.PrefixGroups) > 0 {
+			pm.placement.ring = pm.placement.ring.WithGroups(groups, pm.config.Placement.PrefixGroups)
+		}
+		pm.placement.epoch = epoch
+	}
+	return pm.placement.ring, epoch
+}
+
+// Owners returns the nodes that hold key in partitioned placement, owner
+// first.
+func (pm *PeerManager) Owners(key string) []string {
+	r, _ := pm.Ring()
+	return r.Owners(key, pm.config.Placement.ReplicationFactor)
+}
+
+// replicatesTo reports whether updates to key are sent to peer. Standbys
+// get every update and witnesses none.
+func (pm *PeerManager) replicatesTo(peer *Peer, key string) bool {
+	if pm.keepsLocal(key) {
+		return false
+	}
+	switch peer.Mode {
+	case config.NodeModeWitness:
+		return false
+	case config.NodeModeStandby:
+		return true
+	}
+	if !pm.Partitioned() {
+		return pm.inGroupFor(peer.Group, key)
+	}
+	for _, owner := range pm.Owners(key) {
+		if owner == peer.NodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsLocal reports whether key is in one of
+// replication.local_namespaces, which aren't replicated.
+func (pm *PeerManager) keepsLocal(key string) bool {
+	ns, _ := cache.SplitNamespace(key)
+	if ns == "" {
+		return false
+	}
+	for _, local := range pm.config.Replication.LocalNamespaces {
+		if ns == local {
+			return true
+		}
+	}
+	return false
+}
+
+// sendTo writes the message rendered for the peer linked to nodeID and
+// returns the number of bytes it took on the wire.
+func (pm *PeerManager) sendTo(nodeID string, render func(peer *Peer) string) (int, error) {
+	pm.mutex.RLock()
+	var peer Peer
+	if linked := pm.linkTo(nodeID, nil); linked != nil {
+		peer = *linked
+	}
+	pm.mutex.RUnlock()
+	conn := peer.Connection
+	if conn == nil {
+		return 0, fmt.Errorf("%w %s", ErrNotLinked, nodeID)
+	}
+
+	n, err := conn.Write([]byte(pm.encodeFrame(&peer, render(&peer))))
+	if err != nil {
+		pm.traffic.failed(peer.label())
+	}
+	return n, err
+}
+
+// PlacementViolation is a key whose replicas all sit in one failure domain.
+type PlacementViolation struct {
+	Key    string   `json:"key"`
+	Owners []string `json:"owners"`
+	Domain string   `json:"domain"`
+}
+
+// PlacementAudit checks the placement of the keys this node holds against
+// the spreading rule. Misplaced counts keys held here that this node
+// doesn't own, which a rebalance with release enabled would drop.
+type PlacementAudit struct {
+	Mode              string               `json:"mode"`
+	SpreadBy          string               `json:"spread_by"`
+	ReplicationFactor int                  `json:"replication_factor"`
+	Domains           map[string][]string  `json:"domains"`
+	Checked           int                  `json:"checked"`
+	Misplaced         int                  `json:"misplaced"`
+	Violations        int                  `json:"violations"`
+	Samples           []PlacementViolation `json:"samples,omitempty"`
+	Warnings          []string             `json:"warnings,omitempty"`
+}
+
+// AuditPlacement audits every key this node holds, returning up to
+// samples of the violations found.
+func (pm *PeerManager) AuditPlacement(samples int) PlacementAudit {
+	placement := pm.config.Placement
+	current, _ := pm.Ring()
+	self := pm.cacheManager.NodeID()
+
+	audit := PlacementAudit{
+		Mode:              placement.Mode,
+		SpreadBy:          placement.SpreadBy,
+		ReplicationFactor: placement.ReplicationFactor,
+		Domains:           make(map[string][]string),
+	}
+	for _, member := range current.Nodes() {
+		domain := current.Domain(member)
+		audit.Domains[domain] = append(audit.Domains[domain], member)
+	}
+
+	if !pm.Partitioned() {
+		audit.Warnings = append(audit.Warnings, "placement is full: every node holds every key")
+	}
+	if placement.SpreadBy != "none" && placement.ReplicationFactor > 1 && len(audit.Domains) < 2 {
+		audit.Warnings = append(audit.Warnings, fmt.Sprintf("all members are in one %s; replicas can't be spread", placement.SpreadBy))
+	}
+	if placement.SpreadBy == "zone" {
+		for domain, members := range audit.Domains {
+			if strings.HasSuffix(domain, "/") {
+				audit.Warnings = append(audit.Warnings, fmt.Sprintf("no zone configured on %s", strings.Join(members, ", ")))
+			}
+		}
+	}
+	_, _, _, groups := pm.groupedMembers()
+	for prefix, group := range placement.PrefixGroups {
+		found := false
+		for _, member := range groups {
+			found = found || member == group
+		}
+		if !found {
+			audit.Warnings = append(audit.Warnings, fmt.Sprintf("no linked node is in group %s, which %q keys are dedicated to", group, prefix))
+		}
+	}
+	sort.Strings(audit.Warnings)
+
+	for _, item := range pm.cacheManager.View().Items {
+		audit.Checked++
+		owners := current.Owners(item.Key, placement.ReplicationFactor)
+		if !contains(owners, self) {
+			audit.Misplaced++
+		}
+		if placement.SpreadBy == "none" || len(owners) < 2 {
+			continue
+		}
+
+		domain := current.Domain(owners[0])
+		spread := false
+		for _, owner := range owners[1:] {
+			if current.Domain(owner) != domain {
+				spread = true
+				break
+			}
+		}
+		if !spread {
+			audit.Violations++
+			if len(audit.Samples) < samples {
+				audit.Samples = append(audit.Samples, PlacementViolation{Key: item.Key, Owners: owners, Domain: domain})
+			}
+		}
+	}
+	return audit
+}
+
+// GroupFor returns the node group placement.prefix_groups dedicates key
+// to, or "" if any node may hold it.
+func (pm *PeerManager) GroupFor(key string) string {
+	return ring.Prefixes(pm.config.Placement.PrefixGroups).Group(key)
+}
+
+// inGroupFor reports whether a node in group may hold key.
+func (pm *PeerManager) inGroupFor(group, key string) bool {
+	dedicated := pm.GroupFor(key)
+	return dedicated == "" || dedicated == group
+}
+
+// groupHook refuses local writes of keys dedicated to a group this node
+// isn't in, so they never start out on the wrong nodes.
+type groupHook struct {
+	pm *PeerManager
+}
+
+func (h *groupHook) Name() string { return "prefix-groups" }
+
+func (h *groupHook) BeforeSet(item *cache.CacheItem) error {
+	if group := h.pm.GroupFor(item.Key); !h.pm.inGroupFor(h.pm.config.Placement.Group, item.Key) {
+		return fmt.Errorf("%w: %s is dedicated to group %s", ErrNotOwner, item.Key, group)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions spoken on peer connections.
+//
+//	1: unversioned SYNC|<item> frames, no handshake, no PATCH.
+//	2: HELLO handshake; frames are CMD|<version>|<payload>; PATCH frames.
+//	3: SYNC and PATCH frames carry the update's route, the node IDs it has
+//	   passed through starting with its origin: CMD|3|<id>,<id>|<payload>.
+//	4: DEL frames replicate the delete of a write, named by its key, origin
+//	   and timestamp.
+//	5: SYNCD frames send a large value's digest in place of the value;
+//	   the receiver answers WANT frames for content it doesn't hold.
+//	6: MSYNC frames carry the items of a batch write together.
+//	7: TAG_INVALIDATE frames replicate the invalidation of a tag.
+//
+// A node speaks every version from MinProtocolVersion up to
+// ProtocolVersion, so a cluster can be upgraded one node at a time.
+const (
+	ProtocolVersion    = 7
+	MinProtocolVersion = 1
+)
+
+type Hello struct {
+	NodeID          string `json:"node_id"`
+	Region          string `json:"region"`
+	ProtocolVersion int    `json:"protocol_version"`
+	MinProtocol     int    `json:"min_protocol"`
+	MaxProtocol     int    `json:"max_protocol"`
+	HTTPURL         string `json:"http_url,omitempty"`
+	HTTPPort        int    `json:"http_port,omitempty"`
+	// Weight is the sender's share of the hash ring relative to a node of
+	// weight 1; nodes that don't send it have weight 1.
+	Weight float64 `json:"weight,omitempty"`
+	Zone   string  `json:"zone,omitempty"`
+	// Group is the node group the sender belongs to, which keys can be
+	// dedicated to by prefix.
+	Group string `json:"group,omitempty"`
+	// Mode is the sender's node mode; nodes that don't send it hold data.
+	Mode string `json:"mode,omitempty"`
+	// Compression lists the frame compression the dialer accepts, in
+	// order of preference; the answer holds the one chosen, if any.
+	Compression []string `json:"compression,omitempty"`
+}
+
+func localHello(nodeID, region, httpURL string, httpPort int) Hello {
+	return Hello{
+		NodeID:          nodeID,
+		Region:          region,
+		ProtocolVersion: ProtocolVersion,
+		MinProtocol:     MinProtocolVersion,
+		MaxProtocol:     ProtocolVersion,
+		HTTPURL:         httpURL,
+		HTTPPort:        httpPort,
+	}
+}
+
+// httpURL returns the URL clients should use to reach the node that sent
+// hello over a connection to tcpAddress. Nodes that don't advertise a URL
+// are assumed to serve HTTP on the same host as their TCP listener.
+func (hello Hello) httpURL(tcpAddress string) string {
+	if hello.HTTPURL != "" {
+		return hello.HTTPURL
+	}
+	if hello.HTTPPort == 0 {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(tcpAddress)
+	if err != nil {
+		return ""
+	}
+	// An IPv6 zone's "%" must be escaped in a URL.
+	host = strings.Replace(host, "%", "%25", 1)
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(hello.HTTPPort))
+}
+
+// negotiate picks the highest version both sides speak.
+func negotiate(remote Hello) (int, error) {
+	version := ProtocolVersion
+	if remote.MaxProtocol < version {
+		version = remote.MaxProtocol
+	}
+	if version < MinProtocolVersion || version < remote.MinProtocol {
+		return 0, fmt.Errorf("no common protocol version (local %d-%d, remote %d-%d)",
+			MinProtocolVersion, ProtocolVersion, remote.MinProtocol, remote.MaxProtocol)
+	}
+	return version, nil
+}
+
+func encodeHello(hello Hello) string {
+	data, _ := json.Marshal(hello)
+	return fmt.Sprintf("HELLO|%s\n", string(data))
+}
+
+// maxFrameLine bounds one line read from a peer connection, and so the
+// largest item that can be replicated. bufio.Scanner's default of 64 KiB
+// would end the link at the first bigger one.
+const maxFrameLine = 64 << 20
+
+// frameScanner reads the lines of a peer connection.
+func frameScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxFrameLine)
+	return scanner
+}
+
+// frame renders a replication frame for a peer speaking version.
+func frame(version int, command string, payload []byte) string {
+	if version < 2 {
+		return fmt.Sprintf("%s|%s\n", command, string(payload))
+	}
+	return fmt.Sprintf("%s|%d|%s\n", command, version, string(payload))
+}
+
+// routedFrame renders a SYNC or PATCH frame, including the route for peers
+// that understand it.
+func routedFrame(version int, command string, route []string, payload []byte) string {
+	if version < 3 {
+		return frame(version, command, payload)
+	}
+	return fmt.Sprintf("%s|%d|%s|%s\n", command, version, strings.Join(route, ","), string(payload))
+}
+
+// splitRoute separates the route from the body of a SYNC or PATCH frame.
+// Frames from before version 3 have no route.
+func splitRoute(version int, body string) ([]string, string, error) {
+	if version < 3 {
+		return nil, body, nil
+	}
+	parts := strings.SplitN(body, "|", 2)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, "", fmt.Errorf("invalid frame route")
+	}
+	return strings.Split(parts[0], ","), parts[1], nil
+}
+
+// parseFrame splits the payload of a replication frame into its version
+// and body. Version 1 frames carry the JSON body directly.
+func parseFrame(payload string) (int, string, error) {
+	if strings.HasPrefix(payload, "{") {
+		return 1, payload, nil
+	}
+
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) < 2 {
+		return 0, "", fmt.Errorf("invalid frame")
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid frame version %q", parts[0])
+	}
+	if version < MinProtocolVersion || version > ProtocolVersion {
+		return 0, "", fmt.Errorf("unsupported protocol version %d", version)
+	}
+	return version, parts[1], nil
+}
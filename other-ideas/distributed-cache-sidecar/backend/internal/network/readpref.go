@@ -0,0 +1,182 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/metrics"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+)
+
+// Remote reads serve a key this node doesn't hold from a peer that does.
+// The peers that should hold it are tried in the order the read policy
+// puts them in; by default the nearest, going by the round trip time of
+// the health check pings on each link.
+
+var peerRTT = metrics.NewGauge("sidecar_peer_rtt_seconds",
+	"Smoothed round trip time of health check pings to each peer.", "peer")
+
+const (
+	// rttWeight is how much a new ping sample moves a peer's latency.
+	rttWeight = 0.3
+	// remoteReadAttempts caps the peers a single remote read asks.
+	remoteReadAttempts = 3
+	remoteReadTimeout  = time.Second
+)
+
+// Read policy names accepted by placement.read_policy.
+const (
+	ReadPolicyNearest = "nearest"
+	ReadPolicyRandom  = "random"
+)
+
+// A ReadPolicy orders the peers a remote read may be served by, most
+// preferred first. Peers are copies and may be reordered in place.
+type ReadPolicy interface {
+	Order(peers []*Peer) []*Peer
+}
+
+// ReadPolicyFunc adapts a function to ReadPolicy.
+type ReadPolicyFunc func(peers []*Peer) []*Peer
+
+func (f ReadPolicyFunc) Order(peers []*Peer) []*Peer {
+	return f(peers)
+}
+
+// NearestPolicy prefers the peer with the lowest measured latency. Peers
+// that haven't answered a ping yet go last, in node ID order.
+var NearestPolicy ReadPolicy = ReadPolicyFunc(func(peers []*Peer) []*Peer {
+	sort.SliceStable(peers, func(i, j int) bool {
+		a, b := peers[i].Latency, peers[j].Latency
+		if (a == 0) != (b == 0) {
+			return b == 0
+		}
+		if a != b {
+			return a < b
+		}
+		return peers[i].NodeID < peers[j].NodeID
+	})
+	return peers
+})
+
+// RandomPolicy spreads remote reads evenly regardless of latency.
+var RandomPolicy ReadPolicy = ReadPolicyFunc(func(peers []*Peer) []*Peer {
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	return peers
+})
+
+// readPolicyNamed returns the built-in policy called name, falling back to
+// nearest.
+func readPolicyNamed(name string) ReadPolicy {
+	if name == ReadPolicyRandom {
+		return RandomPolicy
+	}
+	return NearestPolicy
+}
+
+// SetReadPolicy replaces the policy configured by placement.read_policy.
+func (pm *PeerManager) SetReadPolicy(policy ReadPolicy) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.readPolicy = policy
+}
+
+func (pm *PeerManager) currentReadPolicy() ReadPolicy {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	if pm.readPolicy != nil {
+		return pm.readPolicy
+	}
+	return readPolicyNamed(pm.config.Placement.ReadPolicy)
+}
+
+// pinged notes when a health check ping went out on peer's link. The
+// caller holds pm.mutex.
+func (pm *PeerManager) pinged(peer *Peer) {
+	peer.pingSent = time.Now()
+}
+
+// ponged folds the round trip of the ping peer just answered into its
+// latency. The caller holds pm.mutex.
+func (pm *PeerManager) ponged(peer *Peer) {
+	now := time.Now()
+	peer.LastSeen = now
+	if peer.pingSent.IsZero() {
+		return
+	}
+	sample := now.Sub(peer.pingSent)
+	peer.pingSent = time.Time{}
+	if peer.Latency == 0 {
+		peer.Latency = sample
+	} else {
+		peer.Latency += time.Duration(rttWeight * float64(sample-peer.Latency))
+	}
+	peerRTT.Set(peer.Latency.Seconds(), peer.NodeID)
+}
+
+// pongOn handles a PONG that arrived on an inbound link.
+func (pm *PeerManager) pongOn(conn net.Conn) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	for _, peer := range pm.peers {
+		if peer.Connection == conn {
+			pm.ponged(peer)
+		}
+	}
+}
+
+// RemoteReads reports whether reads that miss here are served by peers.
+func (pm *PeerManager) RemoteReads() bool {
+	return pm.config.Placement.RemoteReads
+}
+
+// readCandidates returns the linked peers that should hold key, ordered by
+// the read policy. Only peers dialed by configured address can be asked,
+// since an inbound link's address is the peer's outgoing port.
+func (pm *PeerManager) readCandidates(key string) []*Peer {
+	var candidates []*Peer
+	for _, peer := range pm.GetPeers() {
+		if !peer.Connected || !peer.configured || peer.unreachable || peer.NodeID == "" {
+			continue
+		}
+		if peer.Mode != "" && peer.Mode != config.NodeModeData {
+			continue
+		}
+		if pm.replicatesTo(peer, key) {
+			candidates = append(candidates, peer)
+		}
+	}
+	return pm.currentReadPolicy().Order(candidates)
+}
+
+// ReadRemote fetches key from the peers that should hold it, trying at
+// most remoteReadAttempts of them in read policy order. It returns the
+// item and the node that served it, or ErrNotFound if none had it.
+func (pm *PeerManager) ReadRemote(key string) (*cache.CacheItem, string, error) {
+	candidates := pm.readCandidates(key)
+	if len(candidates) > remoteReadAttempts {
+		candidates = candidates[:remoteReadAttempts]
+	}
+
+	err := error(cache.ErrNotFound)
+	for _, peer := range candidates {
+		response, requestErr := pm.Request(peer.Address, "GET", key, remoteReadTimeout)
+		if requestErr != nil {
+			if !errors.Is(requestErr, cache.ErrNotFound) && !errors.Is(requestErr, ErrNotOwner) {
+				peerLog.Printf("Remote read of %s from %s failed: %v", key, peer.Address, requestErr)
+				err = requestErr
+			}
+			continue
+		}
+		item, decodeErr := pm.cacheManager.DeserializeItem([]byte(response))
+		if decodeErr != nil {
+			err = decodeErr
+			continue
+		}
+		return item, peer.NodeID, nil
+	}
+	return nil, "", err
+}
@@ -0,0 +1,405 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/metrics"
+	"distributed-cache-sidecar/pkg/ring"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRebalanceDisabled = errors.New("rebalancing requires partitioned placement")
+	ErrRebalanceRunning  = errors.New("a rebalance is already in progress")
+
+	rebalanceKeys = metrics.NewCounter("sidecar_rebalance_keys_total",
+		"Keys handled by rebalancing, by result.", "result")
+	rebalanceBytes = metrics.NewCounter("sidecar_rebalance_bytes_total",
+		"Bytes sent to new owners by rebalancing.")
+)
+
+const (
+	RebalanceIdle       = "idle"
+	RebalanceRunning    = "running"
+	RebalancePaused     = "paused"
+	RebalanceDone       = "done"
+	RebalanceSuperseded = "superseded"
+	RebalanceStopped    = "stopped"
+)
+
+// RebalanceStatus reports the progress of this node's current or last
+// rebalance. Members is the membership being rebalanced to; Total counts
+// the keys the node held when the pass started, Moved those sent to at
+// least one new owner and Released those dropped afterwards.
+type RebalanceStatus struct {
+	NodeID     string     `json:"node_id"`
+	State      string     `json:"state"`
+	Members    []string   `json:"members,omitempty"`
+	Total      int        `json:"total"`
+	Scanned    int        `json:"scanned"`
+	Moved      int        `json:"moved"`
+	Released   int        `json:"released"`
+	Failed     int        `json:"failed"`
+	Bytes      int64      `json:"bytes"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Rebalancer hands the keys this node holds over to their owners when
+// membership changes in partitioned placement. A pass only sends a key to
+// owners that didn't own it under the ring of the last completed pass, so
+// keys whose owners are unchanged cost nothing. Standbys are sent every
+// key, so one that links after keys were written still gets a full copy.
+// A membership change during a pass supersedes it; the next pass starts
+// once membership settles. A standby doesn't hand its keys over until it
+// is promoted.
+type Rebalancer struct {
+	pm     *PeerManager
+	config config.PlacementConfig
+
+	mutex   sync.Mutex
+	resumed *sync.Cond
+	status  RebalanceStatus
+	paused  bool
+	pass    uint64 // numbers passes, so a superseded one knows to stop
+	epoch   string // membership of the running or last pass
+	// balanced is the membership the last completed pass placed keys
+	// for, placed the ring it used and seeded the standbys it sent every
+	// key to.
+	balanced string
+	placed   *ring.Ring
+	seeded   []string
+}
+
+func NewRebalancer(pm *PeerManager) *Rebalancer {
+	r := &Rebalancer{
+		pm:     pm,
+		config: pm.config.Placement,
+		status: RebalanceStatus{NodeID: pm.cacheManager.NodeID(), State: RebalanceIdle},
+	}
+	r.resumed = sync.NewCond(&r.mutex)
+	return r
+}
+
+// Start watches membership and starts a pass once it has been stable for
+// the settle interval, when automatic rebalancing is enabled.
+func (r *Rebalancer) Start() {
+	if !r.pm.Partitioned() || !r.config.RebalanceAuto {
+		return
+	}
+	lifecycle.Go("rebalance-watch", "", r.watch)
+}
+
+// Stop ends the running pass, and with the peer manager stopped, the
+// watch loop.
+func (r *Rebalancer) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active() {
+		r.finish(RebalanceStopped)
+		r.resumed.Broadcast()
+	}
+}
+
+func (r *Rebalancer) watch() {
+	settle := time.Duration(r.config.RebalanceSettleMS) * time.Millisecond
+	var seen string
+	var since time.Time
+
+	for r.pm.sleep(time.Second) {
+		current, standbys, epoch := r.target()
+		if epoch != seen {
+			seen, since = epoch, time.Now()
+			r.supersede(epoch)
+			continue
+		}
+		if time.Since(since) < settle {
+			continue
+		}
+
+		r.mutex.Lock()
+		due := epoch != r.balanced && !r.active() && !r.pm.Standby()
+		var pass uint64
+		if due {
+			pass = r.begin(epoch)
+		}
+		placed, seeded := r.placed, r.seeded
+		r.mutex.Unlock()
+		if due {
+			lifecycle.Go("rebalance-pass", epoch, func() {
+				r.run(pass, current, standbys, epoch, placed, seeded)
+			})
+		}
+	}
+}
+
+// Run starts a full pass that sends every key to all of its current
+// owners and the standbys, for repairing placement by hand.
+func (r *Rebalancer) Run() (RebalanceStatus, error) {
+	if !r.pm.Partitioned() {
+		return RebalanceStatus{}, ErrRebalanceDisabled
+	}
+	current, standbys, epoch := r.target()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active() {
+		return r.snapshot(), ErrRebalanceRunning
+	}
+	pass := r.begin(epoch)
+	lifecycle.Go("rebalance-pass", epoch, func() {
+		r.run(pass, current, standbys, epoch, nil, nil)
+	})
+	return r.snapshot(), nil
+}
+
+// Pause holds the running pass after the key it is handing over. Pausing
+// or resuming when no pass is running has no effect.
+func (r *Rebalancer) Pause() RebalanceStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.status.State == RebalanceRunning {
+		r.paused = true
+		r.status.State = RebalancePaused
+	}
+	return r.snapshot()
+}
+
+func (r *Rebalancer) Resume() RebalanceStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.status.State == RebalancePaused {
+		r.paused = false
+		r.status.State = RebalanceRunning
+		r.resumed.Broadcast()
+	}
+	return r.snapshot()
+}
+
+func (r *Rebalancer) Status() RebalanceStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.snapshot()
+}
+
+// RegisterCommands lets peers drive this node's rebalancing, so it can be
+// controlled and watched cluster-wide from any node.
+func (r *Rebalancer) RegisterCommands(server *TCPServer) {
+	server.RegisterCommand("REBALANCE", func(payload string) string {
+		var status RebalanceStatus
+		var err error
+		switch payload {
+		case "status":
+			status = r.Status()
+		case "start":
+			status, err = r.Run()
+		case "pause":
+			status = r.Pause()
+		case "resume":
+			status = r.Resume()
+		default:
+			return "ERROR|Unknown rebalance action"
+		}
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+
+		data, err := json.Marshal(status)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+	})
+}
+
+// target returns the ring to place keys for, the standbys to send every
+// key to and an epoch covering both.
+func (r *Rebalancer) target() (*ring.Ring, []string, string) {
+	current, epoch := r.pm.Ring()
+	standbys := r.pm.Standbys()
+	return current, standbys, epoch + "+" + strings.Join(standbys, ",")
+}
+
+// active reports whether a pass is running or paused. Callers must hold
+// r.mutex.
+func (r *Rebalancer) active() bool {
+	return r.status.State == RebalanceRunning || r.status.State == RebalancePaused
+}
+
+// begin resets the status for a new pass to epoch and returns its number.
+// Callers must hold r.mutex.
+func (r *Rebalancer) begin(epoch string) uint64 {
+	now := time.Now()
+	r.pass++
+	r.epoch = epoch
+	r.paused = false
+	r.status = RebalanceStatus{
+		NodeID:    r.status.NodeID,
+		State:     RebalanceRunning,
+		StartedAt: &now,
+	}
+	return r.pass
+}
+
+// supersede abandons a pass for a membership other than epoch.
+func (r *Rebalancer) supersede(epoch string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active() && r.epoch != epoch {
+		r.finish(RebalanceSuperseded)
+		r.resumed.Broadcast()
+	}
+}
+
+// finish ends the running pass. Callers must hold r.mutex.
+func (r *Rebalancer) finish(state string) {
+	now := time.Now()
+	r.paused = false
+	r.status.State = state
+	r.status.FinishedAt = &now
+}
+
+// proceed blocks while pass is paused and reports whether it should carry
+// on.
+func (r *Rebalancer) proceed(pass uint64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for r.paused && r.pass == pass {
+		r.resumed.Wait()
+	}
+	return r.pass == pass && r.status.State == RebalanceRunning
+}
+
+func (r *Rebalancer) snapshot() RebalanceStatus {
+	status := r.status
+	status.Members = append([]string(nil), status.Members...)
+	return status
+}
+
+func (r *Rebalancer) run(pass uint64, current *ring.Ring, standbys []string, epoch string, placed *ring.Ring, seeded []string) {
+	cacheManager := r.pm.cacheManager
+	self := cacheManager.NodeID()
+	factor := r.config.ReplicationFactor
+
+	items := cacheManager.View().Items
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	r.mutex.Lock()
+	if r.pass == pass {
+		r.status.Members = current.Nodes()
+		r.status.Total = len(items)
+	}
+	r.mutex.Unlock()
+
+	var interval time.Duration
+	if r.config.RebalanceKeysPerSec > 0 {
+		interval = time.Second / time.Duration(r.config.RebalanceKeysPerSec)
+	}
+	route := []string{self}
+
+	for _, item := range items {
+		if !r.proceed(pass) {
+			return
+		}
+
+		owners := current.Owners(item.Key, factor)
+		var previous []string
+		if placed != nil {
+			previous = placed.Owners(item.Key, factor)
+		}
+
+		sent, failed, bytes := r.handOver(item, append(owners, standbys...), append(previous, seeded...), route)
+		released := false
+		if r.config.RebalanceRelease && failed == 0 && !contains(owners, self) && !r.pm.Standby() {
+			released = cacheManager.Release(item)
+		}
+
+		r.mutex.Lock()
+		if r.pass != pass {
+			r.mutex.Unlock()
+			return
+		}
+		r.status.Scanned++
+		r.status.Bytes += int64(bytes)
+		if sent > 0 {
+			r.status.Moved++
+		}
+		if failed > 0 {
+			r.status.Failed++
+		}
+		if released {
+			r.status.Released++
+		}
+		r.mutex.Unlock()
+
+		if sent > 0 {
+			rebalanceKeys.Inc("moved")
+			time.Sleep(interval)
+		}
+		if failed > 0 {
+			rebalanceKeys.Inc("failed")
+		}
+		if released {
+			rebalanceKeys.Inc("released")
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.pass == pass && r.active() {
+		r.finish(RebalanceDone)
+		r.balanced = epoch
+		r.placed = current
+		r.seeded = standbys
+		peerLog.Printf("Rebalanced %d keys to %v: %d moved, %d released, %d failed",
+			r.status.Total, r.status.Members, r.status.Moved, r.status.Released, r.status.Failed)
+	}
+}
+
+// handOver sends item to each of targets other than this node that isn't
+// in previous.
+func (r *Rebalancer) handOver(item *cache.CacheItem, targets, previous, route []string) (sent, failed, bytes int) {
+	self := r.pm.cacheManager.NodeID()
+	var data []byte
+
+	for _, owner := range targets {
+		if owner == self || contains(previous, owner) {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = r.pm.cacheManager.SerializeItem(item); err != nil {
+				return sent, failed + 1, bytes
+			}
+		}
+
+		n, err := r.pm.sendTo(owner, func(peer *Peer) string {
+			return routedFrame(peer.ProtocolVersion, "SYNC", route, data)
+		})
+		bytes += n
+		if err != nil {
+			peerLog.Printf("Failed to hand %s over to %s: %v", item.Key, owner, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	rebalanceBytes.Add(uint64(bytes))
+	return sent, failed, bytes
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
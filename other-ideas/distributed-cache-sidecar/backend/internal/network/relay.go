@@ -0,0 +1,128 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+)
+
+// Replicated updates carry their route so that, when relaying is enabled,
+// they can be forwarded across nodes that aren't linked directly without
+// ever coming back: a node drops updates whose route already contains it,
+// never relays to a node on the route, and stops relaying once the route
+// is longer than replication.max_hops. Updates that didn't change local
+// state (already seen over another path) aren't relayed either.
+
+// applySync applies the body of a SYNC frame. It returns the item and its
+// route when the item changed local state and may be relayed.
+func applySync(cacheManager *cache.Manager, version int, body string) (*cache.CacheItem, []string, error) {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return nil, nil, nil
+	}
+
+	item, err := cacheManager.DeserializeItem([]byte(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := cacheManager.SetRemote(item)
+	if err != nil || !applied {
+		return nil, nil, err
+	}
+	if route == nil {
+		route = []string{item.NodeID}
+	}
+	return item, route, nil
+}
+
+// applyDelete applies the body of a DEL frame. Deletes aren't relayed.
+func applyDelete(cacheManager *cache.Manager, version int, body string) error {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return nil
+	}
+
+	deleted, err := cacheManager.DeserializeItem([]byte(data))
+	if err != nil {
+		return err
+	}
+	_, err = cacheManager.RemoveRemote(deleted)
+	return err
+}
+
+// applyPatch applies the body of a PATCH frame. It returns the patched
+// item as sent by its origin, together with the route, when the patch
+// changed local state and may be relayed.
+func applyPatch(cacheManager *cache.Manager, version int, body string) (*cache.CacheItem, []string, error) {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return nil, nil, nil
+	}
+
+	op, err := cacheManager.DeserializePatch([]byte(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := cacheManager.ApplyRemotePatch(op)
+	if err != nil || !applied {
+		return nil, nil, err
+	}
+	if route == nil {
+		route = []string{op.NodeID}
+	}
+	return patchResult(op), route, nil
+}
+
+// patchResult is the item a patch produced on its origin. It stands in for
+// the patch where ops can't be sent: to version 1 peers and when relaying,
+// since a relayed op could reach a node twice and be applied twice.
+func patchResult(op *cache.PatchOp) *cache.CacheItem {
+	return &cache.CacheItem{
+		Key:       op.Key,
+		Value:     op.Result,
+		Region:    op.Region,
+		NodeID:    op.NodeID,
+		Timestamp: op.Timestamp,
+		Version:   op.Version,
+		Encoding:  op.Encoding,
+		Type:      op.ItemType,
+	}
+}
+
+// relay forwards an update received over route to every linked peer not
+// already on it.
+func (pm *PeerManager) relay(route []string, item *cache.CacheItem) {
+	if !pm.config.Replication.Relay || len(route) > pm.config.Replication.MaxHops {
+		return
+	}
+
+	data, err := pm.cacheManager.SerializeItem(item)
+	if err != nil {
+		peerLog.Printf("Failed to serialize relayed item %s: %v", item.Key, err)
+		return
+	}
+
+	next := append(append([]string(nil), route...), pm.cacheManager.NodeID())
+	pm.broadcast(func(peer *Peer) string {
+		if onRoute(next, peer.NodeID) || !pm.replicatesTo(peer, item.Key) {
+			return ""
+		}
+		return routedFrame(peer.ProtocolVersion, "SYNC", next, data)
+	})
+}
+
+func onRoute(route []string, nodeID string) bool {
+	for _, id := range route {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/config"
+	"net"
+	"time"
+)
+
+// tuneSocket applies the socket options to conn. Connections that aren't
+// plain TCP are left alone, and failures are only logged: a connection
+// with the kernel's defaults still works.
+func tuneSocket(conn net.Conn, socket config.SocketConfig) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	var err error
+	if socket.KeepAliveMS > 0 {
+		if err = tcpConn.SetKeepAlive(true); err == nil {
+			err = tcpConn.SetKeepAlivePeriod(time.Duration(socket.KeepAliveMS) * time.Millisecond)
+		}
+	} else {
+		err = tcpConn.SetKeepAlive(false)
+	}
+	if err == nil {
+		err = tcpConn.SetNoDelay(socket.NoDelay)
+	}
+	if err == nil && socket.ReadBufferBytes > 0 {
+		err = tcpConn.SetReadBuffer(socket.ReadBufferBytes)
+	}
+	if err == nil && socket.WriteBufferBytes > 0 {
+		err = tcpConn.SetWriteBuffer(socket.WriteBufferBytes)
+	}
+	if err != nil {
+		tcpLog.Printf("Failed to set socket options on %s: %v", conn.RemoteAddr(), err)
+	}
+}
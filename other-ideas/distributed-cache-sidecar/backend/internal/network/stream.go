@@ -0,0 +1,109 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamHandler serves a command whose response is a byte stream rather
+// than a line, such as a snapshot file. The server answers
+// "OK|<size>\n" followed by size bytes, then closes the connection.
+//
+// When the returned reader is an *os.File the stream is copied straight
+// to the socket, which Go does with sendfile(2) on Linux so the file never
+// passes through user space; other readers and platforms fall back to a
+// plain buffered copy.
+type StreamHandler func(payload string) (io.ReadCloser, int64, error)
+
+func (s *TCPServer) RegisterStream(command string, handler StreamHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.streams[command] = handler
+}
+
+func (s *TCPServer) stream(conn net.Conn, message string) bool {
+	parts := strings.SplitN(message, "|", 2)
+	if len(parts) < 2 {
+		return false
+	}
+
+	s.mutex.RLock()
+	handler, exists := s.streams[parts[0]]
+	s.mutex.RUnlock()
+	if !exists {
+		return false
+	}
+
+	reader, size, err := handler(parts[1])
+	if err != nil {
+		fmt.Fprintf(conn, "%s\n", errorResponse(err))
+		return true
+	}
+	defer reader.Close()
+
+	fmt.Fprintf(conn, "OK|%d\n", size)
+	if _, err := io.CopyN(conn, reader, size); err != nil {
+		tcpLog.Printf("Failed to stream %s to %s: %v", parts[0], conn.RemoteAddr(), err)
+	}
+	return true
+}
+
+// Fetch sends a stream command to address on a dedicated connection and
+// copies the response body to w. Copying from the socket into an
+// *os.File uses splice(2) where available.
+func (pm *PeerManager) Fetch(address, command, payload string, w io.Writer, timeout time.Duration) (int64, error) {
+	conn, err := pm.dial(address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := fmt.Fprintf(conn, "%s|%s\n", command, payload); err != nil {
+		return 0, err
+	}
+
+	// Read the header without buffering so no body bytes are consumed
+	// and the body can be copied from the socket directly.
+	line, err := readLine(conn)
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.SplitN(line, "|", 2)
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("invalid response from %s", address)
+	}
+	if parts[0] != "OK" {
+		return 0, &RemoteError{Address: address, Status: parts[0], Message: parts[1]}
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stream size from %s: %v", address, err)
+	}
+
+	n, err := io.CopyN(w, conn, size)
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("stream from %s ended after %d of %d bytes", address, n, size)
+	}
+	return n, err
+}
+
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < 4096 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSpace(string(line)), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("response header too long")
+}
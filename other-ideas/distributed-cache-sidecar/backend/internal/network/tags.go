@@ -0,0 +1,61 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/json"
+)
+
+// A tag invalidation goes to version 7 peers as one TAG_INVALIDATE frame
+// naming the tag, and each of them deletes every item carrying it that it
+// holds, whether or not the origin held the same items. Version 4 to 6
+// peers get a DEL frame for each item the origin deleted instead, so they
+// keep tagged items the origin didn't hold. Older peers keep theirs until
+// they expire, as with any delete.
+
+// broadcastTagInvalidation replicates a local tag invalidation.
+func (pm *PeerManager) broadcastTagInvalidation(invalidation *cache.TagInvalidation) {
+	data, err := json.Marshal(invalidation)
+	if err != nil {
+		peerLog.Printf("Failed to serialize invalidation of tag %s: %v", invalidation.Tag, err)
+		return
+	}
+
+	deletes := make(map[string][]byte, len(invalidation.Deleted))
+	for _, deleted := range invalidation.Deleted {
+		if body, err := pm.cacheManager.SerializeItem(deleted); err == nil {
+			deletes[deleted.Key] = body
+		}
+	}
+
+	route := []string{pm.cacheManager.NodeID()}
+	for _, peer := range pm.connectedPeers() {
+		switch {
+		case peer.ProtocolVersion >= 7:
+			pm.send(peer, routedFrame(peer.ProtocolVersion, "TAG_INVALIDATE", route, data))
+		case peer.ProtocolVersion >= 4:
+			for key, body := range deletes {
+				if pm.replicatesTo(peer, key) {
+					pm.send(peer, routedFrame(peer.ProtocolVersion, "DEL", route, body))
+				}
+			}
+		}
+	}
+}
+
+// applyTagInvalidation applies the body of a TAG_INVALIDATE frame and
+// returns how many items it deleted.
+func applyTagInvalidation(cacheManager *cache.Manager, version int, body string) (int, error) {
+	route, data, err := splitRoute(version, body)
+	if err != nil {
+		return 0, err
+	}
+	if onRoute(route, cacheManager.NodeID()) {
+		return 0, nil
+	}
+
+	var invalidation cache.TagInvalidation
+	if err := json.Unmarshal([]byte(data), &invalidation); err != nil {
+		return 0, err
+	}
+	return cacheManager.ApplyTagInvalidation(&invalidation)
+}
@@ -1,64 +1,223 @@
 package network
 
 import (
-	"bufio"
+	"context"
 	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
+	"distributed-cache-sidecar/internal/panics"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	tcpLog = logging.New("tcp")
+
+	accepted = metrics.NewCounter("sidecar_tcp_accepted_total",
+		"Connections accepted by the TCP server, by listener and acceptor.", "listener", "acceptor")
+	acceptErrors = metrics.NewCounter("sidecar_tcp_accept_errors_total",
+		"Failed accepts on the TCP server, by listener.", "listener")
+)
+
+// acceptQueueInterval is how often the accept queue gauges are updated.
+const acceptQueueInterval = 5 * time.Second
+
 type TCPServer struct {
 	port         int
-	listener     net.Listener
+	addresses    []string
+	acceptors    int
+	socket       *config.SocketConfig
+	listeners    []net.Listener
 	cacheManager *cache.Manager
 	connections  map[string]net.Conn
+	commands     map[string]CommandHandler
+	streams      map[string]StreamHandler
+	peerManager  *PeerManager
+	httpURL      string
+	httpPort     int
+	writeGuard   WriteGuard
 	mutex        sync.RWMutex
-	running      bool
+	// running is 1 while the listeners accept, read and written
+	// atomically as every acceptor checks it.
+	running  int32
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
+// WriteGuard returns an error wrapping ErrUnavailable when client writes
+// are switched off on this node, or nil when they are accepted.
+type WriteGuard func() error
+
+// clientCommands maps each command clients send to whether it writes.
+var clientCommands = map[string]bool{
+	"GET":      false,
+	"MGET":     false,
+	"GETRANGE": false,
+	"TOUCH":    true,
+	"EXPIRE":   true,
+	"PERSIST":  true,
+	"INCR":     true,
+	"INCRBY":   true,
+	"CAS":      true,
+	// INCR_OWNED is sent by peers, but on behalf of a client's INCR.
+	"INCR_OWNED": true,
+}
+
+// CommandHandler serves a request/response command registered outside the
+// network package. It receives the payload after "CMD|" and returns the
+// full response line.
+type CommandHandler func(payload string) string
+
 func NewTCPServer(port int, cacheManager *cache.Manager) *TCPServer {
 	return &TCPServer{
 		port:         port,
 		cacheManager: cacheManager,
 		connections:  make(map[string]net.Conn),
+		commands:     make(map[string]CommandHandler),
+		streams:      make(map[string]StreamHandler),
+		stopped:      make(chan struct{}),
 	}
 }
 
+// Advertise sets the HTTP endpoint this node reports to peers during the
+// handshake. An empty url lets peers derive it from the connection address.
+func (s *TCPServer) Advertise(url string, port int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.httpURL = url
+	s.httpPort = port
+}
+
+// Bind sets the addresses Start listens on and the number of SO_REUSEPORT
+// listeners, each with its own accept loop, opened per address. By default
+// the server listens on its port on every interface with one acceptor.
+func (s *TCPServer) Bind(addresses []string, acceptors int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addresses = addresses
+	s.acceptors = acceptors
+}
+
+// Tune sets the socket options applied to accepted connections. Without
+// it they keep Go's defaults.
+func (s *TCPServer) Tune(socket config.SocketConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.socket = &socket
+}
+
+// GuardWrites makes client write commands check guard first, so they are
+// refused whenever the HTTP API refuses writes.
+func (s *TCPServer) GuardWrites(guard WriteGuard) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.writeGuard = guard
+}
+
+func (s *TCPServer) RegisterCommand(command string, handler CommandHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands[command] = handler
+}
+
 func (s *TCPServer) Start() error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	s.mutex.RLock()
+	addresses, acceptors := s.addresses, s.acceptors
+	s.mutex.RUnlock()
+	if len(addresses) == 0 {
+		addresses = []string{fmt.Sprintf(":%d", s.port)}
+	}
+
+	listeners, err := Listen(addresses, acceptors)
 	if err != nil {
 		return fmt.Errorf("failed to start TCP server: %v", err)
 	}
+	return s.Serve(listeners...)
+}
+
+// Serve is Start on listeners the caller opened, such as the in-memory
+// listeners of an in-process test cluster. Like Start it returns once
+// every listener is closed.
+func (s *TCPServer) Serve(listeners ...net.Listener) error {
+	s.mutex.Lock()
+	s.listeners = listeners
+	s.mutex.Unlock()
+	atomic.StoreInt32(&s.running, 1)
+
+	lifecycle.Go("tcp-accept-queue-sampler", "", func() {
+		sampleAcceptQueues(listeners, acceptQueueInterval, s.stopped)
+	})
+
+	var wg sync.WaitGroup
+	for i, listener := range listeners {
+		acceptor := strconv.Itoa(i)
+		log.Printf("TCP server listening on %s (acceptor %s)", listener.Addr(), acceptor)
+		wg.Add(1)
+		listener := listener
+		lifecycle.Go("tcp-acceptor", listener.Addr().String()+"#"+acceptor, func() {
+			defer wg.Done()
+			s.accept(listener, acceptor)
+		})
+	}
+	wg.Wait()
 
-	s.listener = listener
-	s.running = true
-	
-	log.Printf("TCP server listening on port %d", s.port)
+	return nil
+}
 
-	for s.running {
+// accept runs one accept loop. Acceptors are numbered across listeners,
+// so the metrics show how evenly SO_REUSEPORT spreads connections.
+func (s *TCPServer) accept(listener net.Listener, acceptor string) {
+	address := listener.Addr().String()
+	for atomic.LoadInt32(&s.running) == 1 {
 		conn, err := listener.Accept()
 		if err != nil {
-			if s.running {
-				log.Printf("Failed to accept connection: %v", err)
+			if atomic.LoadInt32(&s.running) == 1 {
+				acceptErrors.Inc(address)
+				tcpLog.Printf("Failed to accept connection: %v", err)
 			}
 			continue
 		}
 
-		go s.handleConnection(conn)
+		accepted.Inc(address, acceptor)
+		s.mutex.RLock()
+		socket := s.socket
+		s.mutex.RUnlock()
+		if socket != nil {
+			tuneSocket(conn, *socket)
+		}
+		lifecycle.Go("tcp-conn", conn.RemoteAddr().String(), func() {
+			s.handleConnection(conn)
+		})
 	}
+}
 
-	return nil
+// StopAccepting closes the listeners, leaving open connections (and so
+// peer links) up until Stop.
+func (s *TCPServer) StopAccepting() {
+	atomic.StoreInt32(&s.running, 0)
+	s.stopOnce.Do(func() { close(s.stopped) })
+
+	s.mutex.RLock()
+	listeners := s.listeners
+	s.mutex.RUnlock()
+	for _, listener := range listeners {
+		listener.Close()
+	}
 }
 
 func (s *TCPServer) Stop() {
-	s.running = false
-	
-	if s.listener != nil {
-		s.listener.Close()
-	}
+	s.StopAccepting()
 
 	s.mutex.Lock()
 	for _, conn := range s.connections {
@@ -69,10 +228,11 @@ func (s *TCPServer) Stop() {
 }
 
 func (s *TCPServer) handleConnection(conn net.Conn) {
+	defer panics.Recover("tcp " + conn.RemoteAddr().String())
 	defer conn.Close()
-	
+
 	remoteAddr := conn.RemoteAddr().String()
-	log.Printf("New TCP connection from %s", remoteAddr)
+	tcpLog.Printf("New TCP connection from %s", remoteAddr)
 
 	s.mutex.Lock()
 	s.connections[remoteAddr] = conn
@@ -84,77 +244,588 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 		s.mutex.Unlock()
 	}()
 
-	scanner := bufio.NewScanner(conn)
+	// Traffic on a replication link is counted under the peer's node ID.
+	var linkedTo *PeerManager
+	var link string
+	defer func() {
+		if linkedTo != nil {
+			linkedTo.linkClosed(conn)
+		}
+	}()
+
+	scanner := frameScanner(conn)
 	for scanner.Scan() {
 		message := strings.TrimSpace(scanner.Text())
 		if message == "" {
 			continue
 		}
 
-		response := s.processMessage(message)
-		if response != "" {
+		// A HELLO opens a replication link. Once answered, the connection
+		// is handed to the peer manager, which also sends on it.
+		if payload := strings.TrimPrefix(message, "HELLO|"); payload != message {
+			response, remote, version := s.hello(payload)
 			fmt.Fprintf(conn, "%s\n", response)
+
+			s.mutex.RLock()
+			peerManager := s.peerManager
+			s.mutex.RUnlock()
+			if remote != nil && linkedTo == nil && peerManager != nil {
+				if !peerManager.acceptLink(conn, *remote, version) {
+					tcpLog.Printf("Closing duplicate link from %s", remote.NodeID)
+					return
+				}
+				linkedTo = peerManager
+				link = remote.NodeID
+				if link == "" {
+					link = remoteAddr
+				}
+			}
+			continue
+		}
+
+		// Peers answer the health check pings sent on links they dialed.
+		if message == "PONG" {
+			if linkedTo != nil {
+				linkedTo.pongOn(conn)
+			}
+			continue
+		}
+
+		if s.stream(conn, message) {
+			return
+		}
+		if linkedTo != nil {
+			linkedTo.traffic.received(link, len(message)+1)
+		}
+
+		message, err := expandFrame(message)
+		if err != nil {
+			if linkedTo != nil {
+				linkedTo.traffic.failed(link)
+			}
+			tcpLog.Printf("Dropped frame from %s: %v", remoteAddr, err)
+			continue
+		}
+		response := s.processMessage(message)
+		if response == "" {
+			continue
 		}
+		if linkedTo != nil {
+			linkedTo.traffic.sent(link, len(response)+1, len(response)+1)
+			if strings.HasPrefix(response, "ERROR|") {
+				linkedTo.traffic.failed(link)
+			}
+		}
+		fmt.Fprintf(conn, "%s\n", response)
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("Connection error with %s: %v", remoteAddr, err)
+		tcpLog.Printf("Connection error with %s: %v", remoteAddr, err)
 	}
 }
 
 func (s *TCPServer) processMessage(message string) string {
-	parts := strings.Split(message, "|")
+	if message == "PING" {
+		return "PONG"
+	}
+
+	parts := strings.SplitN(message, "|", 2)
 	if len(parts) < 2 {
 		return "ERROR|Invalid message format"
 	}
 
 	command := parts[0]
-	
+	if write, client := clientCommands[command]; client {
+		if err := s.admit(write); err != nil {
+			return errorResponse(err)
+		}
+	}
+
 	switch command {
 	case "SYNC":
 		if len(parts) < 2 {
 			return "ERROR|Missing data for SYNC"
 		}
-		
-		itemData := parts[1]
-		item, err := s.cacheManager.DeserializeItem([]byte(itemData))
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+
+		version, body, err := parseFrame(parts[1])
 		if err != nil {
-			return fmt.Sprintf("ERROR|Failed to deserialize: %v", err)
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		item, route, err := applySync(s.cacheManager, version, body)
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		s.relay(route, item)
+		return "OK|Synced"
+
+	case "SYNCD":
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		item, route, want, err := applySyncDigest(s.cacheManager, version, body)
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		if want != "" {
+			return want
+		}
+		s.relay(route, item)
+		return "OK|Synced"
+
+	case "MSYNC":
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		items, route, err := applySyncBatch(s.cacheManager, version, body)
+		for _, item := range items {
+			s.relay(route, item)
+		}
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
 		}
-		
-		s.cacheManager.SetRemote(item)
 		return "OK|Synced"
-		
+
+	case "WANT":
+		s.mutex.RLock()
+		peerManager := s.peerManager
+		s.mutex.RUnlock()
+		if peerManager == nil {
+			return ""
+		}
+		return strings.TrimSuffix(peerManager.wanted(parts[1]), "\n")
+
+	case "PATCH":
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		item, route, err := applyPatch(s.cacheManager, version, body)
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		s.relay(route, item)
+		return "OK|Patched"
+
+	case "DEL":
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		if err := applyDelete(s.cacheManager, version, body); err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		return "OK|Deleted"
+
+	case "TAG_INVALIDATE":
+		if s.witness() {
+			return "OK|Ignored by witness"
+		}
+		version, body, err := parseFrame(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		deleted, err := applyTagInvalidation(s.cacheManager, version, body)
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		return fmt.Sprintf("OK|Deleted %d", deleted)
+
 	case "GET":
 		if len(parts) < 2 {
 			return "ERROR|Missing key for GET"
 		}
-		
+
 		key := parts[1]
-		item, exists := s.cacheManager.Get(key)
-		if !exists {
-			return "NOT_FOUND|Key not found"
+		item, err := s.cacheManager.Lookup(key)
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				if ownerErr := s.checkOwner(key); ownerErr != nil {
+					return errorResponse(ownerErr)
+				}
+			}
+			return errorResponse(err)
 		}
-		
+
 		data, err := s.cacheManager.SerializeItem(item)
 		if err != nil {
 			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
 		}
-		
+
 		return fmt.Sprintf("OK|%s", string(data))
-		
-	case "PING":
-		return "PONG"
-		
+
+	case "MGET":
+		// MGET|key|key... answers with a JSON array holding each key's
+		// item, or null where it is missing or expired here. Keys that
+		// contain '|' are sent as a JSON array instead: MGET|["a|b","c"].
+		keys, err := mgetKeys(parts[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		items := make([]*cache.CacheItem, len(keys))
+		for i, key := range keys {
+			item, err := s.cacheManager.Lookup(key)
+			if err != nil && !errors.Is(err, cache.ErrNotFound) && !errors.Is(err, cache.ErrExpired) {
+				return errorResponse(err)
+			}
+			items[i] = item
+		}
+		data, err := json.Marshal(items)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+
+	case "TOUCH":
+		key := parts[1]
+		item, err := s.cacheManager.Touch(context.Background(), key)
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				if ownerErr := s.checkOwner(key); ownerErr != nil {
+					return errorResponse(ownerErr)
+				}
+			}
+			return errorResponse(err)
+		}
+
+		data, err := s.cacheManager.SerializeItem(item)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+
+	case "EXPIRE", "PERSIST":
+		// EXPIRE|seconds|key sets key's TTL to seconds from now and
+		// PERSIST|key removes it; both answer with the updated item.
+		key := parts[1]
+		var item *cache.CacheItem
+		var err error
+		if command == "EXPIRE" {
+			fields := strings.SplitN(parts[1], "|", 2)
+			if len(fields) < 2 {
+				return "ERROR|EXPIRE expects seconds|key"
+			}
+			seconds, parseErr := strconv.ParseInt(fields[0], 10, 64)
+			if parseErr != nil {
+				return "ERROR|Invalid seconds for EXPIRE"
+			}
+			key = fields[1]
+			item, err = s.cacheManager.Expire(context.Background(), key, time.Duration(seconds)*time.Second, cache.WriteOptions{})
+		} else {
+			item, err = s.cacheManager.Persist(context.Background(), key, cache.WriteOptions{})
+		}
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				if ownerErr := s.checkOwner(key); ownerErr != nil {
+					return errorResponse(ownerErr)
+				}
+			}
+			return errorResponse(err)
+		}
+
+		data, err := s.cacheManager.SerializeItem(item)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+
+	case "INCR", "INCRBY":
+		key, delta := parts[1], int64(1)
+		if command == "INCRBY" {
+			fields := strings.SplitN(parts[1], "|", 2)
+			if len(fields) < 2 {
+				return "ERROR|INCRBY expects delta|key"
+			}
+			var err error
+			if delta, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+				return "ERROR|Invalid delta for INCRBY"
+			}
+			key = fields[1]
+		}
+
+		s.mutex.RLock()
+		peerManager := s.peerManager
+		s.mutex.RUnlock()
+		increment := s.cacheManager.Increment
+		if peerManager != nil {
+			increment = peerManager.Increment
+		}
+		item, err := increment(context.Background(), key, delta, cache.WriteOptions{})
+		if err != nil {
+			return errorResponse(err)
+		}
+		return fmt.Sprintf("OK|%s", item.Value)
+
+	case "INCR_OWNED":
+		var request incrementRequest
+		if err := json.Unmarshal([]byte(parts[1]), &request); err != nil {
+			return fmt.Sprintf("ERROR|Failed to deserialize: %v", err)
+		}
+		item, err := s.cacheManager.Increment(context.Background(), request.Key, request.Delta, request.options())
+		if err != nil {
+			return errorResponse(err)
+		}
+		data, err := s.cacheManager.SerializeItem(item)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+
+	case "GETRANGE":
+		// GETRANGE|start|end|key answers with the base64 of the bytes of
+		// key's payload from start to end inclusive. Negative offsets count
+		// from the end, -1 being the last byte, and end is clamped to it.
+		fields := strings.SplitN(parts[1], "|", 3)
+		if len(fields) < 3 {
+			return "ERROR|GETRANGE expects start|end|key"
+		}
+		start, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return "ERROR|Invalid start for GETRANGE"
+		}
+		end, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return "ERROR|Invalid end for GETRANGE"
+		}
+		key := fields[2]
+		item, err := s.cacheManager.Lookup(key)
+		if err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				if ownerErr := s.checkOwner(key); ownerErr != nil {
+					return errorResponse(ownerErr)
+				}
+			}
+			return errorResponse(err)
+		}
+		size, err := s.cacheManager.PayloadSize(item)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if start < 0 {
+			start += size
+		}
+		if end < 0 {
+			end += size
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end >= size {
+			end = size - 1
+		}
+		if start > end {
+			return "OK|"
+		}
+		data, err := s.cacheManager.ReadRange(context.Background(), item, start, end-start+1)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return "OK|" + base64.StdEncoding.EncodeToString(data)
+
+	case "CAS":
+		// CAS|version|key|value replaces the value of key, which must be
+		// at version, and answers with the new version. A key that
+		// contains '|' is sent as a JSON string: CAS|3|"a|b"|value.
+		fields := strings.SplitN(parts[1], "|", 2)
+		if len(fields) < 2 {
+			return "ERROR|CAS expects version|key|value"
+		}
+		version, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || version == 0 {
+			return "ERROR|Invalid version for CAS"
+		}
+		key, value, err := cutKey(fields[1])
+		if err != nil {
+			return fmt.Sprintf("ERROR|CAS expects version|key|value: %v", err)
+		}
+		item, err := s.cacheManager.Write(context.Background(), key, value, cache.WriteOptions{IfVersion: version})
+		if err != nil {
+			return errorResponse(err)
+		}
+		return fmt.Sprintf("OK|%d", item.Version)
+
+	case "INFO":
+		data, err := json.Marshal(NodeInfo{
+			NodeID:   s.cacheManager.NodeID(),
+			Region:   s.cacheManager.Region(),
+			Sequence: s.cacheManager.Sequence(),
+		})
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+
+	case "FAILOVER":
+		s.mutex.RLock()
+		peerManager := s.peerManager
+		s.mutex.RUnlock()
+		if peerManager != nil {
+			peerManager.applyFailover(parts[1])
+		}
+		return ""
+
+	case "MODE":
+		s.mutex.RLock()
+		peerManager := s.peerManager
+		s.mutex.RUnlock()
+		if peerManager != nil {
+			peerManager.applyMode(parts[1])
+		}
+		return ""
+
 	default:
+		s.mutex.RLock()
+		handler, exists := s.commands[command]
+		s.mutex.RUnlock()
+		if exists {
+			return handler(parts[1])
+		}
 		return "ERROR|Unknown command"
 	}
 }
 
+// mgetKeys parses the keys of an MGET: a JSON array of strings, or the
+// keys separated by '|'.
+func mgetKeys(payload string) ([]string, error) {
+	if !strings.HasPrefix(payload, "[") {
+		return strings.Split(payload, "|"), nil
+	}
+	var keys []string
+	if err := json.Unmarshal([]byte(payload), &keys); err != nil {
+		return nil, fmt.Errorf("invalid MGET key array: %v", err)
+	}
+	return keys, nil
+}
+
+// cutKey splits payload, a key followed by '|' and the rest of a frame,
+// around that separator. A key that starts with '"' is a JSON string,
+// which is how keys containing '|' are sent.
+func cutKey(payload string) (string, string, error) {
+	if !strings.HasPrefix(payload, `"`) {
+		key, rest, found := strings.Cut(payload, "|")
+		if !found {
+			return "", "", errors.New("missing separator after key")
+		}
+		return key, rest, nil
+	}
+	var key string
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	if err := decoder.Decode(&key); err != nil {
+		return "", "", fmt.Errorf("invalid quoted key: %v", err)
+	}
+	rest := payload[decoder.InputOffset():]
+	if !strings.HasPrefix(rest, "|") {
+		return "", "", errors.New("missing separator after key")
+	}
+	return key, rest[1:], nil
+}
+
+func (s *TCPServer) relay(route []string, item *cache.CacheItem) {
+	s.mutex.RLock()
+	peerManager := s.peerManager
+	s.mutex.RUnlock()
+	if item != nil && peerManager != nil {
+		peerManager.relay(route, item)
+	}
+}
+
+// admit returns ErrUnavailable for a client command this node must refuse:
+// any command on a witness or a standby that hasn't been promoted, and a
+// write while the write guard refuses it.
+func (s *TCPServer) admit(write bool) error {
+	s.mutex.RLock()
+	peerManager := s.peerManager
+	guard := s.writeGuard
+	s.mutex.RUnlock()
+
+	if peerManager != nil {
+		switch peerManager.NodeMode() {
+		case config.NodeModeWitness:
+			return fmt.Errorf("%w: node is a witness and holds no data", ErrUnavailable)
+		case config.NodeModeStandby:
+			return fmt.Errorf("%w: node is a standby and serves no requests until promoted", ErrUnavailable)
+		}
+	}
+	if write && guard != nil {
+		return guard()
+	}
+	return nil
+}
+
+// checkOwner is PeerManager.CheckOwner, or nil before the peer manager is
+// attached.
+func (s *TCPServer) checkOwner(key string) error {
+	s.mutex.RLock()
+	peerManager := s.peerManager
+	s.mutex.RUnlock()
+	if peerManager == nil {
+		return nil
+	}
+	return peerManager.CheckOwner(key)
+}
+
+// witness reports whether this node is a witness, which drops replication
+// sent by peers that don't know it holds no data.
+func (s *TCPServer) witness() bool {
+	s.mutex.RLock()
+	peerManager := s.peerManager
+	s.mutex.RUnlock()
+	return peerManager != nil && peerManager.Witness()
+}
+
+// hello answers a handshake. The remote's hello and the negotiated version
+// are returned when the handshake succeeded.
+func (s *TCPServer) hello(payload string) (string, *Hello, int) {
+	var remote Hello
+	if err := json.Unmarshal([]byte(payload), &remote); err != nil {
+		return fmt.Sprintf("ERROR|Failed to deserialize: %v", err), nil, 0
+	}
+	version, err := negotiate(remote)
+	if err != nil {
+		return fmt.Sprintf("ERROR|%v", err), nil, 0
+	}
+
+	s.mutex.RLock()
+	hello := localHello(s.cacheManager.NodeID(), s.cacheManager.Region(), s.httpURL, s.httpPort)
+	peerManager := s.peerManager
+	s.mutex.RUnlock()
+	hello.ProtocolVersion = version
+	if peerManager != nil {
+		hello.Weight = peerManager.config.Placement.Weight
+		hello.Zone = peerManager.config.Placement.Zone
+		hello.Group = peerManager.config.Placement.Group
+		hello.Mode = peerManager.NodeMode()
+		if compression := chooseCompression(peerManager.config.Replication.Compression, remote.Compression); compression != "" {
+			hello.Compression = []string{compression}
+		}
+	}
+	data, err := json.Marshal(hello)
+	if err != nil {
+		return fmt.Sprintf("ERROR|Serialization failed: %v", err), nil, 0
+	}
+	return fmt.Sprintf("OK|%s", string(data)), &remote, version
+}
+
 func (s *TCPServer) BroadcastSync(item *cache.CacheItem) {
 	data, err := s.cacheManager.SerializeItem(item)
 	if err != nil {
-		log.Printf("Failed to serialize item for broadcast: %v", err)
+		tcpLog.Printf("Failed to serialize item for broadcast: %v", err)
 		return
 	}
 
@@ -169,7 +840,7 @@ func (s *TCPServer) BroadcastSync(item *cache.CacheItem) {
 
 	for _, conn := range connections {
 		if _, err := conn.Write([]byte(message)); err != nil {
-			log.Printf("Failed to broadcast to connection: %v", err)
+			tcpLog.Printf("Failed to broadcast to connection: %v", err)
 		}
 	}
 }
@@ -0,0 +1,43 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"strings"
+	"testing"
+)
+
+func TestClientCommandsWithPipeInKeys(t *testing.T) {
+	cacheManager := cache.NewManager("test", "node-a")
+	for key, value := range map[string]string{"a|b": "ab", "a": "a", "b": "b", "n|1": "1"} {
+		if err := cacheManager.Set(key, value, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := NewTCPServer(0, cacheManager)
+
+	tests := []struct {
+		message string
+		want    string // part of the response
+	}{
+		{"GET|a|b", `OK|{"key":"a|b"`},
+		{`MGET|["a|b","missing"]`, `OK|[{"key":"a|b"`},
+		{`MGET|["a|b","missing"]`, `},null]`},
+		{"MGET|a|b", `OK|[{"key":"a",`},
+		{`MGET|["a|b"`, "ERROR|invalid MGET key array"},
+		{"EXPIRE|60|a|b", `OK|{"key":"a|b"`},
+		{"INCRBY|2|n|1", "OK|3"},
+		{"GETRANGE|0|0|a|b", "OK|YQ=="},
+		{`CAS|2|"a|b"|new|value`, "OK|3"},
+		{"GET|a|b", `OK|{"key":"a|b","value":"new|value"`},
+		{"CAS|1|a|b|value", "OK|2"},
+		{"GET|a", `OK|{"key":"a","value":"b|value"`},
+		{`CAS|1|"a|b`, "ERROR|CAS expects version|key|value"},
+		{`CAS|1|"a|b"`, "ERROR|CAS expects version|key|value"},
+	}
+	for _, tt := range tests {
+		got := server.processMessage(tt.message)
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("%s = %s, want it to contain %s", tt.message, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/metrics"
+	"sync"
+)
+
+// Traffic to and from every peer is counted so that cross-region egress
+// can be attributed to the links that cause it. Counts are kept by the
+// peer's node ID (its address until it has said hello), across
+// reconnects, and cover replication frames on the links in both
+// directions as well as request/response exchanges such as write acks.
+// Health check pings aren't counted.
+
+var (
+	peerSentBytes = metrics.NewCounter("sidecar_peer_sent_bytes_total",
+		"Replication bytes written to each peer link, after compression.", "peer")
+	peerUncompressedBytes = metrics.NewCounter("sidecar_peer_uncompressed_bytes_total",
+		"Replication bytes each peer link would have carried without compression.", "peer")
+	peerReceivedBytes = metrics.NewCounter("sidecar_peer_received_bytes_total",
+		"Replication bytes read from each peer link, as received.", "peer")
+	peerSentMessages = metrics.NewCounter("sidecar_peer_sent_messages_total",
+		"Frames written to each peer link.", "peer")
+	peerReceivedMessages = metrics.NewCounter("sidecar_peer_received_messages_total",
+		"Frames read from each peer link.", "peer")
+	peerErrors = metrics.NewCounter("sidecar_peer_errors_total",
+		"Failed writes, undecodable frames and rejected updates on each peer link.", "peer")
+)
+
+// Traffic is what has gone over the links with one peer since this node
+// started. CompressionRatio is UncompressedBytes over SentBytes, 1 before
+// anything is sent.
+type Traffic struct {
+	SentBytes         uint64
+	UncompressedBytes uint64
+	ReceivedBytes     uint64
+	SentMessages      uint64
+	ReceivedMessages  uint64
+	Errors            uint64
+	CompressionRatio  float64
+}
+
+type trafficLog struct {
+	mutex sync.Mutex
+	links map[string]*Traffic
+}
+
+func newTrafficLog() *trafficLog {
+	return &trafficLog{links: make(map[string]*Traffic)}
+}
+
+func (t *trafficLog) link(label string) *Traffic {
+	traffic, exists := t.links[label]
+	if !exists {
+		traffic = &Traffic{}
+		t.links[label] = traffic
+	}
+	return traffic
+}
+
+// sent counts a frame of uncompressed bytes written to label as wire
+// bytes.
+func (t *trafficLog) sent(label string, wire, uncompressed int) {
+	peerSentBytes.Add(uint64(wire), label)
+	peerUncompressedBytes.Add(uint64(uncompressed), label)
+	peerSentMessages.Inc(label)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	traffic := t.link(label)
+	traffic.SentBytes += uint64(wire)
+	traffic.UncompressedBytes += uint64(uncompressed)
+	traffic.SentMessages++
+}
+
+func (t *trafficLog) received(label string, wire int) {
+	peerReceivedBytes.Add(uint64(wire), label)
+	peerReceivedMessages.Inc(label)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	traffic := t.link(label)
+	traffic.ReceivedBytes += uint64(wire)
+	traffic.ReceivedMessages++
+}
+
+func (t *trafficLog) failed(label string) {
+	peerErrors.Inc(label)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.link(label).Errors++
+}
+
+func (t *trafficLog) get(label string) Traffic {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var traffic Traffic
+	if counted, exists := t.links[label]; exists {
+		traffic = *counted
+	}
+	traffic.CompressionRatio = 1
+	if traffic.SentBytes > 0 {
+		traffic.CompressionRatio = float64(traffic.UncompressedBytes) / float64(traffic.SentBytes)
+	}
+	return traffic
+}
+
+// label is what peer's traffic is counted under.
+func (peer *Peer) label() string {
+	if peer.NodeID != "" {
+		return peer.NodeID
+	}
+	return peer.Address
+}
+
+// addressLabel is what traffic to the peer at address is counted under.
+func (pm *PeerManager) addressLabel(address string) string {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	if peer, exists := pm.peers[address]; exists {
+		return peer.label()
+	}
+	return address
+}
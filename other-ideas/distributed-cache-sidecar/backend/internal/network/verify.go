@@ -0,0 +1,391 @@
+package network
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VerifyPrefix starts every key a verification run writes.
+const VerifyPrefix = "__verify/"
+
+var ErrVerifyRunning = errors.New("a verification run is already in progress")
+
+const (
+	// verifyPollInterval is how often a run re-reads the keys that have
+	// not converged yet.
+	verifyPollInterval = 100 * time.Millisecond
+	verifyTimeout      = 2 * time.Second
+)
+
+// VerifyOptions size a verification run. Zero values take the defaults.
+type VerifyOptions struct {
+	Keys int           // default 20
+	SLA  time.Duration // default 5s
+	// TTL is how long the test keys live, so they don't need deleting.
+	TTL time.Duration // default 10m
+}
+
+// VerifyDiscrepancy is a node that did not hold the value written for a
+// key when the SLA ran out.
+type VerifyDiscrepancy struct {
+	Key       string `json:"key"`
+	NodeID    string `json:"node_id"`
+	WrittenOn string `json:"written_on"`
+	Expected  string `json:"expected"`
+	Got       string `json:"got,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// VerifyReport is the outcome of a verification run. A key converged if
+// every node that should hold it did within the SLA; SlowestMS is the
+// longest that took. Unreachable lists configured peers that could not be
+// asked for their identity, which fails the run too.
+type VerifyReport struct {
+	RunID         string              `json:"run_id"`
+	StartedAt     time.Time           `json:"started_at"`
+	DurationMS    int64               `json:"duration_ms"`
+	SLAMS         int64               `json:"sla_ms"`
+	Nodes         []string            `json:"nodes"`
+	Unreachable   []string            `json:"unreachable,omitempty"`
+	Keys          int                 `json:"keys"`
+	Converged     int                 `json:"converged"`
+	SlowestMS     int64               `json:"slowest_ms"`
+	Discrepancies []VerifyDiscrepancy `json:"discrepancies,omitempty"`
+	Passed        bool                `json:"passed"`
+}
+
+// Verifier is a push-button consistency audit. A run writes known values
+// under VerifyPrefix through nodes across the cluster, reads every key
+// back from every node that should hold it until they all agree or the
+// SLA runs out, and reports which nodes did not.
+type Verifier struct {
+	pm *PeerManager
+
+	mutex   sync.Mutex
+	running bool
+	last    *VerifyReport
+}
+
+func NewVerifier(pm *PeerManager) *Verifier {
+	return &Verifier{pm: pm}
+}
+
+// RegisterCommands lets other nodes' runs write through this one and read
+// it back. Reads go through VERIFY_READ rather than GET, as a standby
+// refuses GET but is still expected to hold every key.
+func (v *Verifier) RegisterCommands(server *TCPServer) {
+	server.RegisterCommand("VERIFY_WRITE", func(payload string) string {
+		var write verifyWrite
+		if err := json.Unmarshal([]byte(payload), &write); err != nil {
+			return fmt.Sprintf("ERROR|%v", err)
+		}
+		if err := v.write(write); err != nil {
+			return errorResponse(err)
+		}
+		return "OK|Written"
+	})
+	server.RegisterCommand("VERIFY_READ", func(key string) string {
+		item, err := v.pm.cacheManager.Lookup(key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		data, err := v.pm.cacheManager.SerializeItem(item)
+		if err != nil {
+			return fmt.Sprintf("ERROR|Serialization failed: %v", err)
+		}
+		return fmt.Sprintf("OK|%s", string(data))
+	})
+}
+
+type verifyWrite struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTLMS int64  `json:"ttl_ms"`
+}
+
+func (v *Verifier) write(write verifyWrite) error {
+	_, err := v.pm.cacheManager.Write(context.Background(), write.Key, write.Value, cache.WriteOptions{
+		TTL: time.Duration(write.TTLMS) * time.Millisecond,
+	})
+	return err
+}
+
+// Last returns the report of the last completed run, or nil.
+func (v *Verifier) Last() *VerifyReport {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.last
+}
+
+// verifyNode is a node taking part in a run.
+type verifyNode struct {
+	NodeInfo
+	mode string
+}
+
+// verifyKey tracks one test key through a run.
+type verifyKey struct {
+	key, value string
+	writer     verifyNode
+	// pending holds the nodes that don't have the value yet.
+	pending map[string]verifyNode
+	last    map[string]VerifyDiscrepancy
+	took    time.Duration
+}
+
+// Run performs a verification run and returns its report. Only one run
+// goes at a time.
+func (v *Verifier) Run(options VerifyOptions) (*VerifyReport, error) {
+	if options.Keys <= 0 {
+		options.Keys = 20
+	}
+	if options.SLA <= 0 {
+		options.SLA = 5 * time.Second
+	}
+	if options.TTL <= 0 {
+		options.TTL = 10 * time.Minute
+	}
+
+	v.mutex.Lock()
+	if v.running {
+		v.mutex.Unlock()
+		return nil, ErrVerifyRunning
+	}
+	v.running = true
+	v.mutex.Unlock()
+
+	report := v.run(options)
+
+	v.mutex.Lock()
+	v.running = false
+	v.last = report
+	v.mutex.Unlock()
+	return report, nil
+}
+
+func (v *Verifier) run(options VerifyOptions) *VerifyReport {
+	started := time.Now()
+	report := &VerifyReport{
+		RunID:     fmt.Sprintf("%s-%d", v.pm.cacheManager.NodeID(), started.UnixNano()),
+		StartedAt: started,
+		SLAMS:     options.SLA.Milliseconds(),
+		Keys:      options.Keys,
+	}
+
+	nodes := v.nodes(report)
+	var writers []verifyNode
+	for _, node := range nodes {
+		report.Nodes = append(report.Nodes, node.NodeID)
+		if node.mode == config.NodeModeData {
+			writers = append(writers, node)
+		}
+	}
+	if len(writers) == 0 {
+		report.DurationMS = time.Since(started).Milliseconds()
+		return report
+	}
+
+	keys := make([]*verifyKey, 0, options.Keys)
+	for i := 0; i < options.Keys; i++ {
+		key := &verifyKey{
+			key:     fmt.Sprintf("%s%s/%d", VerifyPrefix, report.RunID, i),
+			value:   fmt.Sprintf("%s/%d", report.RunID, i),
+			pending: make(map[string]verifyNode),
+			last:    make(map[string]VerifyDiscrepancy),
+		}
+		key.writer = v.writerFor(key.key, i, writers)
+		for _, node := range nodes {
+			if v.holds(node, key.key) {
+				key.pending[node.NodeID] = node
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	// Writes go out one after another so each key's clock starts when it
+	// was written; a write that fails is reported against its writer.
+	written := make([]time.Time, len(keys))
+	for i, key := range keys {
+		written[i] = time.Now()
+		if err := v.writeVia(key, options.TTL); err != nil {
+			key.last[key.writer.NodeID] = v.discrepancy(key, key.writer, "", fmt.Sprintf("write failed: %v", err))
+			key.pending = map[string]verifyNode{key.writer.NodeID: key.writer}
+			written[i] = time.Time{}
+		}
+	}
+
+	deadline := time.Now().Add(options.SLA)
+	for {
+		outstanding := 0
+		for i, key := range keys {
+			if written[i].IsZero() || len(key.pending) == 0 {
+				continue
+			}
+			v.check(key)
+			if len(key.pending) == 0 {
+				key.took = time.Since(written[i])
+			} else {
+				outstanding++
+			}
+		}
+		if outstanding == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(verifyPollInterval)
+	}
+
+	for _, key := range keys {
+		if len(key.pending) == 0 {
+			report.Converged++
+			if took := key.took.Milliseconds(); took > report.SlowestMS {
+				report.SlowestMS = took
+			}
+			continue
+		}
+		for nodeID := range key.pending {
+			report.Discrepancies = append(report.Discrepancies, key.last[nodeID])
+		}
+	}
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.NodeID < b.NodeID
+	})
+
+	report.Passed = len(report.Discrepancies) == 0 && len(report.Unreachable) == 0
+	report.DurationMS = time.Since(started).Milliseconds()
+	return report
+}
+
+// nodes returns the reachable nodes with their modes, and records the
+// configured peers that could not be reached in report.
+func (v *Verifier) nodes(report *VerifyReport) []verifyNode {
+	modes := map[string]string{v.pm.cacheManager.NodeID(): v.pm.NodeMode()}
+	for _, peer := range v.pm.GetPeers() {
+		if peer.NodeID != "" && peer.Mode != "" {
+			modes[peer.NodeID] = peer.Mode
+		}
+	}
+
+	reached := make(map[string]bool)
+	var nodes []verifyNode
+	for _, info := range v.pm.ClusterNodes(verifyTimeout) {
+		mode := modes[info.NodeID]
+		if mode == "" {
+			mode = config.NodeModeData
+		}
+		nodes = append(nodes, verifyNode{NodeInfo: info, mode: mode})
+		reached[info.Address] = true
+	}
+	for _, address := range v.pm.config.Peers {
+		if !reached[address] {
+			report.Unreachable = append(report.Unreachable, address)
+		}
+	}
+	return nodes
+}
+
+// writerFor picks the node key is written through: its owner in
+// partitioned placement, if reachable, otherwise the writers in turn.
+func (v *Verifier) writerFor(key string, i int, writers []verifyNode) verifyNode {
+	if v.pm.Partitioned() {
+		for _, owner := range v.pm.Owners(key) {
+			for _, writer := range writers {
+				if writer.NodeID == owner {
+					return writer
+				}
+			}
+		}
+	}
+	return writers[i%len(writers)]
+}
+
+// holds reports whether node should end up holding key, following the
+// same rules as replicatesTo.
+func (v *Verifier) holds(node verifyNode, key string) bool {
+	switch node.mode {
+	case config.NodeModeWitness:
+		return false
+	case config.NodeModeStandby:
+		return true
+	}
+	if !v.pm.Partitioned() {
+		return true
+	}
+	for _, owner := range v.pm.Owners(key) {
+		if owner == node.NodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier) writeVia(key *verifyKey, ttl time.Duration) error {
+	write := verifyWrite{Key: key.key, Value: key.value, TTLMS: ttl.Milliseconds()}
+	if key.writer.Self {
+		return v.write(write)
+	}
+	payload, err := json.Marshal(write)
+	if err != nil {
+		return err
+	}
+	_, err = v.pm.Request(key.writer.Address, "VERIFY_WRITE", string(payload), verifyTimeout)
+	return err
+}
+
+// check reads key from every node still pending and drops those that
+// hold its value.
+func (v *Verifier) check(key *verifyKey) {
+	for nodeID, node := range key.pending {
+		got, err := v.read(node, key.key)
+		switch {
+		case err != nil:
+			key.last[nodeID] = v.discrepancy(key, node, "", err.Error())
+		case got != key.value:
+			key.last[nodeID] = v.discrepancy(key, node, got, "")
+		default:
+			delete(key.pending, nodeID)
+			delete(key.last, nodeID)
+		}
+	}
+}
+
+func (v *Verifier) read(node verifyNode, key string) (string, error) {
+	if node.Self {
+		item, err := v.pm.cacheManager.Lookup(key)
+		if err != nil {
+			return "", err
+		}
+		return item.Value, nil
+	}
+
+	response, err := v.pm.Request(node.Address, "VERIFY_READ", key, verifyTimeout)
+	if err != nil {
+		return "", err
+	}
+	item, err := v.pm.cacheManager.DeserializeItem([]byte(response))
+	if err != nil {
+		return "", err
+	}
+	return item.Value, nil
+}
+
+func (v *Verifier) discrepancy(key *verifyKey, node verifyNode, got, err string) VerifyDiscrepancy {
+	return VerifyDiscrepancy{
+		Key:       key.key,
+		NodeID:    node.NodeID,
+		WrittenOn: key.writer.NodeID,
+		Expected:  key.value,
+		Got:       got,
+		Error:     err,
+	}
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/metrics"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// With simulation.wan configured, frames pushed to peers over the links
+// (replicated writes, patches, deletes, batches and relays) are held back
+// and randomly dropped as if the links crossed regions. Each link keeps
+// its frames in order, as TCP would, so jitter can bunch frames up but
+// never reorder them, and a dropped frame is simply never sent, which
+// leaves the peer without that update until the key is written again.
+// Request/response exchanges such as write acks and rebalancing aren't
+// affected.
+
+var (
+	wanDelayedFrames = metrics.NewCounter("sidecar_wan_simulated_delayed_total",
+		"Frames held back by the WAN simulation, by peer.", "peer")
+	wanDroppedFrames = metrics.NewCounter("sidecar_wan_simulated_dropped_total",
+		"Frames dropped by the WAN simulation, by peer.", "peer")
+)
+
+// wanQueueLength bounds the frames a simulated link holds; frames beyond
+// it are dropped, as a saturated link would.
+const wanQueueLength = 4096
+
+type wanFrame struct {
+	peer    *Peer
+	message string
+	due     time.Time
+}
+
+// wanLink holds the frames in flight to one peer.
+type wanLink struct {
+	frames chan wanFrame
+	// last is the due time of the latest frame queued, which later frames
+	// may not precede.
+	last time.Time
+}
+
+type wanSimulator struct {
+	pm     *PeerManager
+	mutex  sync.Mutex
+	random *rand.Rand
+	links  map[string]*wanLink
+}
+
+func newWANSimulator(pm *PeerManager) *wanSimulator {
+	if len(pm.config.Simulation.WAN) == 0 {
+		return nil
+	}
+	peerLog.Printf("Simulating WAN conditions on links to peers: %v", pm.config.Simulation.WAN)
+	return &wanSimulator{
+		pm:     pm,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		links:  make(map[string]*wanLink),
+	}
+}
+
+// conditionsFor returns the conditions configured for peer's node ID,
+// then its region, then "*".
+func (s *wanSimulator) conditionsFor(peer *Peer) (config.WANConditions, bool) {
+	wan := s.pm.config.Simulation.WAN
+	for _, name := range []string{peer.NodeID, peer.Region} {
+		if name == "" {
+			continue
+		}
+		if conditions, exists := wan[name]; exists {
+			return conditions, true
+		}
+	}
+	conditions, exists := wan["*"]
+	return conditions, exists
+}
+
+// send queues message for peer under the link's conditions and reports
+// whether it did; messages to peers without conditions are left to the
+// caller.
+func (s *wanSimulator) send(peer *Peer, message string) bool {
+	conditions, exists := s.conditionsFor(peer)
+	if !exists {
+		return false
+	}
+	label := peer.label()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if conditions.LossPercent > 0 && s.random.Float64()*100 < conditions.LossPercent {
+		wanDroppedFrames.Inc(label)
+		return true
+	}
+	link := s.link(label)
+
+	delay := time.Duration(conditions.LatencyMS) * time.Millisecond
+	if conditions.JitterMS > 0 {
+		delay += time.Duration(s.random.Int63n(int64(2*conditions.JitterMS+1))-int64(conditions.JitterMS)) * time.Millisecond
+	}
+	due := time.Now().Add(delay)
+	if due.Before(link.last) {
+		due = link.last
+	}
+
+	select {
+	case link.frames <- wanFrame{peer: peer, message: message, due: due}:
+		link.last = due
+		wanDelayedFrames.Inc(label)
+	default:
+		wanDroppedFrames.Inc(label)
+	}
+	return true
+}
+
+// link returns the link to label, starting its sender on first use. The
+// caller holds the mutex.
+func (s *wanSimulator) link(label string) *wanLink {
+	if link, exists := s.links[label]; exists {
+		return link
+	}
+	link := &wanLink{frames: make(chan wanFrame, wanQueueLength)}
+	s.links[label] = link
+	lifecycle.Go("wan-simulation", label, func() { s.deliver(link) })
+	return link
+}
+
+// deliver writes each of link's frames once it is due.
+func (s *wanSimulator) deliver(link *wanLink) {
+	for {
+		select {
+		case <-s.pm.stop:
+			return
+		case frame := <-link.frames:
+			if wait := time.Until(frame.due); wait > 0 && !s.pm.sleep(wait) {
+				return
+			}
+			s.pm.write(frame.peer, frame.message)
+		}
+	}
+}
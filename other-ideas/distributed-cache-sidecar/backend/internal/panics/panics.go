@@ -0,0 +1,136 @@
+// Package panics turns panics in request handlers and connection
+// goroutines into logged, counted and reported errors, so one bad request
+// or frame fails on its own instead of taking the process down.
+package panics
+
+import (
+	"bytes"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	panicsTotal = metrics.NewCounter("sidecar_panics_total",
+		"Panics recovered, by where they happened.", "where")
+	reportsFailed = metrics.NewCounter("sidecar_panic_reports_failed_total",
+		"Panic reports the error-tracking webhook didn't accept.")
+)
+
+// Report is what is posted to the webhook for each panic.
+type Report struct {
+	NodeID string    `json:"node_id"`
+	Region string    `json:"region"`
+	Where  string    `json:"where"`
+	Error  string    `json:"error"`
+	Stack  string    `json:"stack"`
+	Time   time.Time `json:"time"`
+}
+
+var settings = struct {
+	mutex      sync.RWMutex
+	nodeID     string
+	region     string
+	webhookURL string
+	client     *http.Client
+}{
+	client: &http.Client{Timeout: 5 * time.Second},
+}
+
+// Configure identifies this node in reports and sets the error-tracking
+// webhook every recovered panic is posted to. An empty url only logs.
+func Configure(nodeID, region, webhookURL string) {
+	settings.mutex.Lock()
+	defer settings.mutex.Unlock()
+	settings.nodeID = nodeID
+	settings.region = region
+	settings.webhookURL = webhookURL
+}
+
+// Recover stops a panic in the calling goroutine and handles it. It must
+// be deferred directly, before any deferred cleanup that should still run.
+func Recover(where string) {
+	if recovered := recover(); recovered != nil {
+		handle(where, recovered)
+	}
+}
+
+// Middleware recovers panics in handler and answers the request with a
+// 500 JSON error. http.ErrAbortHandler, which handlers use to abort a
+// response on purpose, is passed through.
+func Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			handle(fmt.Sprintf("http %s %s", r.Method, r.URL.Path), recovered)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+		}()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func handle(where string, recovered interface{}) {
+	stack := string(debug.Stack())
+	log.Printf("Recovered panic in %s: %v\n%s", where, recovered, stack)
+	panicsTotal.Inc(metricLabel(where))
+	events.Record(events.KindPanic, "Recovered panic in %s: %v", where, recovered)
+
+	settings.mutex.RLock()
+	report := Report{
+		NodeID: settings.nodeID,
+		Region: settings.region,
+		Where:  where,
+		Error:  fmt.Sprint(recovered),
+		Stack:  stack,
+		Time:   time.Now(),
+	}
+	webhookURL := settings.webhookURL
+	settings.mutex.RUnlock()
+
+	if webhookURL != "" {
+		go send(webhookURL, report)
+	}
+}
+
+// metricLabel keeps the metric's cardinality down to the kind of
+// goroutine: "http", "tcp" or "peer".
+func metricLabel(where string) string {
+	if i := strings.IndexByte(where, ' '); i >= 0 {
+		return where[:i]
+	}
+	return where
+}
+
+func send(webhookURL string, report Report) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	resp, err := settings.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		reportsFailed.Inc()
+		log.Printf("Failed to report panic to %s: %v", webhookURL, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		reportsFailed.Inc()
+		log.Printf("Failed to report panic to %s: %s", webhookURL, resp.Status)
+	}
+}
@@ -0,0 +1,323 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeMergePatch = "merge"
+	TypeJSONPatch  = "json-patch"
+
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidDocument = errors.New("target value is not a JSON document")
+	ErrInvalidPatch    = errors.New("invalid patch")
+	ErrTestFailed      = errors.New("json patch test operation failed")
+)
+
+func TypeForContentType(contentType string) (string, bool) {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch mediaType {
+	case ContentTypeMergePatch:
+		return TypeMergePatch, true
+	case ContentTypeJSONPatch:
+		return TypeJSONPatch, true
+	}
+	return "", false
+}
+
+// Apply applies a patch of the given type to a JSON document.
+func Apply(patchType string, document, patch []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, ErrInvalidDocument
+	}
+
+	var err error
+	switch patchType {
+	case TypeMergePatch:
+		var p interface{}
+		if err := json.Unmarshal(patch, &p); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		doc = mergePatch(doc, p)
+	case TypeJSONPatch:
+		doc, err = applyJSONPatch(doc, patch)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown patch type %q", ErrInvalidPatch, patchType)
+	}
+
+	return json.Marshal(doc)
+}
+
+// mergePatch implements RFC 7386.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+		} else {
+			targetObj[name] = mergePatch(targetObj[name], value)
+		}
+	}
+	return targetObj
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch implements RFC 6902. Operations are applied in order and
+// the whole patch fails if any single operation fails.
+func applyJSONPatch(doc interface{}, patch []byte) (interface{}, error) {
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "replace", "test":
+			var value interface{}
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("%w: operation %d (%s) is missing a value", ErrInvalidPatch, i, op.Op)
+			}
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+			}
+			switch op.Op {
+			case "add":
+				doc, err = add(doc, op.Path, value)
+			case "replace":
+				if _, err = get(doc, op.Path); err == nil {
+					doc, err = add(doc, op.Path, value)
+				}
+			case "test":
+				var current interface{}
+				if current, err = get(doc, op.Path); err == nil && !reflect.DeepEqual(current, value) {
+					err = ErrTestFailed
+				}
+			}
+		case "remove":
+			doc, _, err = remove(doc, op.Path)
+		case "move":
+			var value interface{}
+			if doc, value, err = remove(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = get(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(value))
+			}
+		default:
+			err = fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+		}
+		if err != nil {
+			if errors.Is(err, ErrTestFailed) || errors.Is(err, ErrInvalidPatch) {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+	}
+	return doc, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("json pointer %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func get(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, exists := node[token]
+			if !exists {
+				return nil, fmt.Errorf("path %q not found", pointer)
+			}
+			current = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+	}
+	return current, nil
+}
+
+func add(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, tokens[:len(tokens)-1], node)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", pointer)
+	}
+}
+
+func remove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the document root")
+	}
+
+	parent, err := get(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, exists := node[last]
+		if !exists {
+			return nil, nil, fmt.Errorf("path %q not found", pointer)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = replaceParent(doc, tokens[:len(tokens)-1], node)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("path %q not found", pointer)
+	}
+}
+
+// replaceParent stores a resized array back into its container, since
+// appending to a slice may reallocate it.
+func replaceParent(doc interface{}, tokens []string, value []interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	container, err := get(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := container.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+	}
+	return doc, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerOf(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	escaped := make([]string, len(tokens))
+	for i, token := range tokens {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+func deepCopy(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var copied interface{}
+	json.Unmarshal(data, &copied)
+	return copied
+}
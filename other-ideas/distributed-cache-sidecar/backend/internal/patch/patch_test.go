@@ -0,0 +1,93 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType string
+		document  string
+		patch     string
+		want      string
+		wantErr   error
+	}{
+		// RFC 7386
+		{"merge sets and deletes", TypeMergePatch, `{"a":1,"b":2}`, `{"b":null,"c":3}`, `{"a":1,"c":3}`, nil},
+		{"merge recurses into objects", TypeMergePatch, `{"a":{"x":1,"y":2}}`, `{"a":{"y":null,"z":3}}`, `{"a":{"x":1,"z":3}}`, nil},
+		{"merge replaces arrays", TypeMergePatch, `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`, nil},
+		{"merge non-object replaces", TypeMergePatch, `{"a":1}`, `[1]`, `[1]`, nil},
+		{"merge over a scalar", TypeMergePatch, `5`, `{"a":1}`, `{"a":1}`, nil},
+		{"merge invalid patch", TypeMergePatch, `{}`, `{`, "", ErrInvalidPatch},
+
+		// RFC 6902
+		{"add field", TypeJSONPatch, `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, nil},
+		{"add inserts into array", TypeJSONPatch, `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, nil},
+		{"add appends with -", TypeJSONPatch, `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, nil},
+		{"add replaces root", TypeJSONPatch, `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`, nil},
+		{"add past the end", TypeJSONPatch, `{"a":[1]}`, `[{"op":"add","path":"/a/5","value":2}]`, "", ErrInvalidPatch},
+		{"add escaped pointer", TypeJSONPatch, `{}`, `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"a/b~c":1}`, nil},
+		{"remove field", TypeJSONPatch, `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, nil},
+		{"remove from array", TypeJSONPatch, `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`, nil},
+		{"remove missing", TypeJSONPatch, `{}`, `[{"op":"remove","path":"/a"}]`, "", ErrInvalidPatch},
+		{"remove root", TypeJSONPatch, `{}`, `[{"op":"remove","path":""}]`, "", ErrInvalidPatch},
+		{"replace field", TypeJSONPatch, `{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `{"a":2}`, nil},
+		{"replace missing", TypeJSONPatch, `{}`, `[{"op":"replace","path":"/a","value":2}]`, "", ErrInvalidPatch},
+		{"replace without value", TypeJSONPatch, `{"a":1}`, `[{"op":"replace","path":"/a"}]`, "", ErrInvalidPatch},
+		{"move field", TypeJSONPatch, `{"a":{"b":1}}`, `[{"op":"move","from":"/a/b","path":"/c"}]`, `{"a":{},"c":1}`, nil},
+		{"move array element", TypeJSONPatch, `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`, nil},
+		{"copy is deep", TypeJSONPatch, `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"test passes", TypeJSONPatch, `{"a":[1,{"b":2}]}`, `[{"op":"test","path":"/a","value":[1,{"b":2}]}]`, `{"a":[1,{"b":2}]}`, nil},
+		{"test fails", TypeJSONPatch, `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, "", ErrTestFailed},
+		{"a failing op fails the patch", TypeJSONPatch, `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":3}]`, "", ErrTestFailed},
+		{"unknown op", TypeJSONPatch, `{}`, `[{"op":"frobnicate","path":"/a"}]`, "", ErrInvalidPatch},
+		{"bad pointer", TypeJSONPatch, `{}`, `[{"op":"add","path":"a","value":1}]`, "", ErrInvalidPatch},
+		{"not a patch array", TypeJSONPatch, `{}`, `{"op":"add"}`, "", ErrInvalidPatch},
+
+		{"invalid document", TypeMergePatch, `not json`, `{}`, "", ErrInvalidDocument},
+		{"unknown type", "xml-patch", `{}`, `{}`, "", ErrInvalidPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Apply(test.patchType, []byte(test.document), []byte(test.patch))
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Apply error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			var gotValue, wantValue interface{}
+			json.Unmarshal(got, &gotValue)
+			json.Unmarshal([]byte(test.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("Apply = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTypeForContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		wantOK      bool
+	}{
+		{"application/merge-patch+json", TypeMergePatch, true},
+		{"application/json-patch+json; charset=utf-8", TypeJSONPatch, true},
+		{"application/json", "", false},
+	}
+	for _, test := range tests {
+		got, ok := TypeForContentType(test.contentType)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("TypeForContentType(%q) = %q, %v, want %q, %v", test.contentType, got, ok, test.want, test.wantOK)
+		}
+	}
+}
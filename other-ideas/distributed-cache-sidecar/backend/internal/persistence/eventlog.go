@@ -0,0 +1,228 @@
+package persistence
+
+import (
+	"bufio"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/logging"
+	"distributed-cache-sidecar/internal/metrics"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	logger = logging.New("eventlog")
+
+	fsyncs = metrics.NewCounter("sidecar_eventlog_fsyncs_total",
+		"Event log fsyncs made by group commit.")
+	fsyncedEntries = metrics.NewCounter("sidecar_eventlog_fsynced_entries_total",
+		"Event log entries made durable by group commit; divide by fsyncs for the average group size.")
+)
+
+// EventLog is an append-only journal of cache mutations, one JSON object
+// per line. By default it is written with plain writes and is not fsynced,
+// so a crash can lose the tail but never reorders entries. With group
+// commit enabled, entries are fsynced in batches and writers can wait for
+// their entry to be durable.
+type EventLog struct {
+	path  string
+	file  *os.File
+	mutex sync.Mutex
+
+	// Group commit state, guarded by mutex. written and synced are the
+	// sequences of the last entry appended and the last one fsynced.
+	groupCommit bool
+	maxLatency  time.Duration
+	written     uint64
+	synced      uint64
+	closed      bool
+	changed     *sync.Cond
+	syncerDone  chan struct{}
+}
+
+// OpenEventLog opens path for appending and returns the last sequence
+// number it already contains.
+func OpenEventLog(path string) (*EventLog, uint64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, 0, fmt.Errorf("failed to create event log directory: %v", err)
+	}
+
+	var last uint64
+	valid, err := readEvents(path, func(mutation cache.Mutation) error {
+		last = mutation.Sequence
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open event log: %v", err)
+	}
+	// Drop a torn final line so new entries don't get glued onto it.
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to truncate event log: %v", err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to seek event log: %v", err)
+	}
+	l := &EventLog{path: path, file: file, written: last, synced: last}
+	l.changed = sync.NewCond(&l.mutex)
+	return l, last, nil
+}
+
+// EnableGroupCommit makes the log durable. Entries are fsynced in groups:
+// a sync starts at most maxLatency after the first entry waiting for one
+// and covers every entry appended by then, so many writes share a single
+// fsync instead of each paying for its own.
+func (l *EventLog) EnableGroupCommit(maxLatency time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.groupCommit {
+		return
+	}
+	l.groupCommit = true
+	l.maxLatency = maxLatency
+	l.syncerDone = make(chan struct{})
+	lifecycle.Go("eventlog-syncer", "", l.syncLoop)
+}
+
+// WaitDurable blocks until the entry with the given sequence has been
+// fsynced. It returns at once when group commit is off or the log is
+// closed.
+func (l *EventLog) WaitDurable(sequence uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.groupCommit && !l.closed && l.synced < sequence {
+		l.changed.Wait()
+	}
+}
+
+func (l *EventLog) syncLoop() {
+	defer close(l.syncerDone)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for {
+		for l.written == l.synced && !l.closed {
+			l.changed.Wait()
+		}
+		if l.closed {
+			return
+		}
+
+		// Let more entries join the group, then sync without holding the
+		// lock so appends carry on meanwhile.
+		l.mutex.Unlock()
+		time.Sleep(l.maxLatency)
+		l.mutex.Lock()
+		target, pending := l.written, l.written-l.synced
+		l.mutex.Unlock()
+
+		err := l.file.Sync()
+
+		l.mutex.Lock()
+		if err != nil {
+			logger.Printf("Failed to fsync event log: %v", err)
+			events.Record(events.KindError, "Failed to fsync event log: %v", err)
+		}
+		fsyncs.Inc()
+		fsyncedEntries.Add(pending)
+		l.synced = target
+		l.changed.Broadcast()
+	}
+}
+
+func (l *EventLog) Path() string {
+	return l.path
+}
+
+func (l *EventLog) Append(mutation cache.Mutation) {
+	data, err := json.Marshal(mutation)
+	if err != nil {
+		logger.Printf("Failed to encode event %d: %v", mutation.Sequence, err)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		logger.Printf("Failed to append event %d: %v", mutation.Sequence, err)
+		events.Record(events.KindError, "Failed to append event %d: %v", mutation.Sequence, err)
+	}
+	l.written = mutation.Sequence
+	if l.groupCommit {
+		l.changed.Broadcast()
+	}
+}
+
+func (l *EventLog) Close() error {
+	l.mutex.Lock()
+	l.closed = true
+	l.changed.Broadcast()
+	done := l.syncerDone
+	l.mutex.Unlock()
+
+	if done != nil {
+		<-done
+		l.file.Sync()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// ReadEventLog calls fn for every entry in the log in order. A torn final
+// line left by a crash is ignored.
+func ReadEventLog(path string, fn func(cache.Mutation) error) error {
+	_, err := readEvents(path, fn)
+	return err
+}
+
+// readEvents returns the length of the log up to the end of the last
+// complete line.
+func readEvents(path string, fn func(cache.Mutation) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var offset int64
+	var last uint64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read event log: %v", err)
+		}
+
+		var mutation cache.Mutation
+		if err := json.Unmarshal(line, &mutation); err != nil {
+			return offset, fmt.Errorf("corrupt event log entry after sequence %d: %v", last, err)
+		}
+		if err := fn(mutation); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+		last = mutation.Sequence
+	}
+}
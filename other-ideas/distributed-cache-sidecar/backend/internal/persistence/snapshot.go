@@ -0,0 +1,175 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"distributed-cache-sidecar/internal/cache"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const snapshotMagic = "CACHESNAP"
+const snapshotFormatVersion = 1
+
+var (
+	ErrNoSnapshot      = errors.New("no snapshot found")
+	ErrCorruptSnapshot = errors.New("snapshot is corrupt")
+)
+
+type Snapshot struct {
+	NodeID    string             `json:"node_id"`
+	Region    string             `json:"region"`
+	CreatedAt time.Time          `json:"created_at"`
+	Sequence  uint64             `json:"sequence,omitempty"`
+	Items     []*cache.CacheItem `json:"items"`
+}
+
+// WriteSnapshot writes the snapshot to a temp file in the same directory,
+// fsyncs it and atomically renames it over path. The snapshot being
+// replaced is kept as path+".prev" so a corrupt latest snapshot can fall
+// back to the previous good one.
+func WriteSnapshot(path string, snapshot *Snapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	sum := sha256.Sum256(payload)
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp snapshot: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "%s %d %s %d\n", snapshotMagic, snapshotFormatVersion, hex.EncodeToString(sum[:]), len(payload))
+	w.Write(payload)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %v", err)
+	}
+
+	// A crash between these two renames leaves only the .prev file, which
+	// LoadSnapshot falls back to. A current file that fails its checksum
+	// is overwritten in place rather than rotated, so it never replaces a
+	// good .prev.
+	if data, err := os.ReadFile(path); err == nil {
+		if _, err := verifySnapshot(data); err != nil {
+			log.Printf("Replacing corrupt snapshot %s without rotating it: %v", path, err)
+		} else if err := os.Rename(path, path+".prev"); err != nil {
+			return fmt.Errorf("failed to rotate previous snapshot: %v", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename snapshot: %v", err)
+	}
+
+	return syncDir(dir)
+}
+
+// LoadSnapshot reads the snapshot at path, falling back to path+".prev"
+// when the latest snapshot is missing or fails its checksum. The returned
+// string is the file the snapshot was actually loaded from.
+func LoadSnapshot(path string) (*Snapshot, string, error) {
+	snapshot, err := readSnapshot(path)
+	if err == nil {
+		return snapshot, path, nil
+	}
+
+	prevPath := path + ".prev"
+	prev, prevErr := readSnapshot(prevPath)
+	if prevErr == nil {
+		return prev, prevPath, nil
+	}
+
+	if errors.Is(err, ErrNoSnapshot) && errors.Is(prevErr, ErrNoSnapshot) {
+		return nil, "", ErrNoSnapshot
+	}
+	return nil, "", err
+}
+
+func readSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, fmt.Errorf("failed to read snapshot %s: %v", path, err)
+	}
+
+	payload, err := verifySnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", path, ErrCorruptSnapshot, err)
+	}
+	return &snapshot, nil
+}
+
+func verifySnapshot(data []byte) ([]byte, error) {
+	newline := bytes.IndexByte(data, '\n')
+	if newline < 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrCorruptSnapshot)
+	}
+
+	fields := strings.Fields(string(data[:newline]))
+	if len(fields) != 4 || fields[0] != snapshotMagic {
+		return nil, fmt.Errorf("%w: invalid header", ErrCorruptSnapshot)
+	}
+	if version, err := strconv.Atoi(fields[1]); err != nil || version != snapshotFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %s", ErrCorruptSnapshot, fields[1])
+	}
+
+	length, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid length", ErrCorruptSnapshot)
+	}
+	payload := data[newline+1:]
+	if len(payload) != length {
+		return nil, fmt.Errorf("%w: expected %d bytes, found %d", ErrCorruptSnapshot, length, len(payload))
+	}
+
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != fields[2] {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	return payload, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot directory: %v", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot directory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package persistence
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flipByte corrupts the last byte of the file at path, inside the payload,
+// leaving its length and header intact.
+func flipByte(t *testing.T, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func truncate(t *testing.T, path string) {
+	if err := os.Truncate(path, 20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	tests := []struct {
+		name string
+		// Snapshots are written for each node ID in before, then damage
+		// runs on the snapshot path, then after is written.
+		before   []string
+		damage   func(t *testing.T, path string)
+		after    []string
+		wantNode string
+		wantPrev bool
+		wantErr  error
+		// wantPrevNode, if set, is the node ID .prev must then hold.
+		wantPrevNode string
+	}{
+		{name: "latest", before: []string{"a", "b"}, wantNode: "b", wantPrevNode: "a"},
+		{name: "missing", wantErr: ErrNoSnapshot},
+		{name: "checksum mismatch falls back to prev", before: []string{"a", "b"}, damage: flipByte, wantNode: "a", wantPrev: true},
+		{name: "truncated falls back to prev", before: []string{"a", "b"}, damage: truncate, wantNode: "a", wantPrev: true},
+		{name: "bad header falls back to prev", before: []string{"a", "b"}, damage: func(t *testing.T, path string) {
+			os.WriteFile(path, []byte("NOTASNAP 1 00 2\n{}"), 0o644)
+		}, wantNode: "a", wantPrev: true},
+		{name: "crash between renames leaves prev", before: []string{"a", "b"}, damage: func(t *testing.T, path string) {
+			os.Remove(path)
+		}, wantNode: "a", wantPrev: true},
+		{name: "checksum mismatch without prev", before: []string{"a"}, damage: flipByte, wantErr: ErrCorruptSnapshot},
+		{name: "both corrupt", before: []string{"a", "b"}, damage: func(t *testing.T, path string) {
+			flipByte(t, path)
+			flipByte(t, path+".prev")
+		}, wantErr: ErrCorruptSnapshot},
+		{name: "corrupt latest is not rotated over prev", before: []string{"a", "b"}, damage: flipByte, after: []string{"c"}, wantNode: "c", wantPrevNode: "a"},
+		{name: "good latest is rotated", before: []string{"a", "b"}, after: []string{"c"}, wantNode: "c", wantPrevNode: "b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.snap")
+			write := func(nodeIDs []string) {
+				for _, nodeID := range nodeIDs {
+					snapshot := &Snapshot{
+						NodeID:    nodeID,
+						CreatedAt: time.Now(),
+						Items:     []*cache.CacheItem{{Key: "owner", Value: nodeID}},
+					}
+					if err := WriteSnapshot(path, snapshot); err != nil {
+						t.Fatalf("WriteSnapshot(%s): %v", nodeID, err)
+					}
+				}
+			}
+			write(test.before)
+			if test.damage != nil {
+				test.damage(t, path)
+			}
+			write(test.after)
+
+			snapshot, from, err := LoadSnapshot(path)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("LoadSnapshot error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSnapshot: %v", err)
+			}
+			if snapshot.NodeID != test.wantNode || len(snapshot.Items) != 1 || snapshot.Items[0].Value != test.wantNode {
+				t.Errorf("loaded snapshot of %q with items %v, want %q", snapshot.NodeID, snapshot.Items, test.wantNode)
+			}
+			wantFrom := path
+			if test.wantPrev {
+				wantFrom += ".prev"
+			}
+			if from != wantFrom {
+				t.Errorf("loaded from %s, want %s", from, wantFrom)
+			}
+
+			if test.wantPrevNode != "" {
+				prev, err := readSnapshot(path + ".prev")
+				if err != nil {
+					t.Fatalf("reading .prev: %v", err)
+				}
+				if prev.NodeID != test.wantPrevNode {
+					t.Errorf(".prev holds the snapshot of %q, want %q", prev.NodeID, test.wantPrevNode)
+				}
+			}
+
+			leftovers, _ := filepath.Glob(path + ".tmp-*")
+			if len(leftovers) > 0 {
+				t.Errorf("temp files left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshotReportsChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	if err := WriteSnapshot(path, &Snapshot{NodeID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	flipByte(t, path)
+
+	data, _ := os.ReadFile(path)
+	if _, err := verifySnapshot(data); !errors.Is(err, ErrCorruptSnapshot) || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifySnapshot error = %v, want a checksum mismatch", err)
+	}
+}
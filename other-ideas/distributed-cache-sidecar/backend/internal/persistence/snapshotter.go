@@ -0,0 +1,148 @@
+package persistence
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// SnapshotStatus describes the last snapshot a Snapshotter saved.
+type SnapshotStatus struct {
+	Path       string    `json:"path"`
+	IntervalMS int64     `json:"interval_ms"`
+	Items      int       `json:"items"`
+	Sequence   uint64    `json:"sequence"`
+	SavedAt    time.Time `json:"saved_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Failures   int64     `json:"failures"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Snapshotter keeps a snapshot of this node's cache in a local file, so a
+// restarted node starts with the items it held rather than an empty
+// cache. Unlike a backup it covers this node only and there is one file,
+// replaced by every save, with the one before kept as its ".prev".
+type Snapshotter struct {
+	path         string
+	interval     time.Duration
+	cacheManager *cache.Manager
+
+	// saving serialises saves, so a manual save and a periodic one never
+	// write the file at once.
+	saving sync.Mutex
+	status SnapshotStatus
+	mutex  sync.Mutex
+}
+
+// NewSnapshotter returns a Snapshotter saving the cache of cacheManager
+// to path every interval, or only when asked if interval is zero.
+func NewSnapshotter(path string, interval time.Duration, cacheManager *cache.Manager) *Snapshotter {
+	return &Snapshotter{
+		path:         path,
+		interval:     interval,
+		cacheManager: cacheManager,
+		status:       SnapshotStatus{Path: path, IntervalMS: interval.Milliseconds()},
+	}
+}
+
+// Restore replaces the cache with the items of the snapshot file that
+// haven't expired since, returning how many it restored. It restores
+// nothing, without error, when there is no snapshot yet. A snapshot of
+// another node is refused.
+func (s *Snapshotter) Restore() (int, error) {
+	snapshot, loadedFrom, err := LoadSnapshot(s.path)
+	if errors.Is(err, ErrNoSnapshot) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if snapshot.NodeID != s.cacheManager.NodeID() {
+		return 0, fmt.Errorf("snapshot %s belongs to node %s", loadedFrom, snapshot.NodeID)
+	}
+
+	now := time.Now()
+	live := snapshot.Items[:0]
+	for _, item := range snapshot.Items {
+		if expiresAt := item.ExpiresAt(); expiresAt.IsZero() || expiresAt.After(now) {
+			live = append(live, item)
+		}
+	}
+	s.cacheManager.Restore(live)
+	log.Printf("Restored %d items from %s, taken %v ago", len(live), loadedFrom, now.Sub(snapshot.CreatedAt).Round(time.Second))
+	events.Record(events.KindLifecycle, "Restored %d items from %s", len(live), loadedFrom)
+	return len(live), nil
+}
+
+// Start saves the cache every interval, skipping saves when nothing has
+// changed since the last one, until the process begins shutting down.
+// The final save is left to the shutdown sequence, which makes it once
+// requests have drained.
+func (s *Snapshotter) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	lifecycle.Go("snapshotter", s.path, func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lifecycle.Stopping():
+				return
+			case <-ticker.C:
+			}
+			if s.cacheManager.Sequence() == s.Status().Sequence {
+				continue
+			}
+			s.Save()
+		}
+	})
+}
+
+// Save writes a snapshot of the cache now and returns the status after it.
+func (s *Snapshotter) Save() (SnapshotStatus, error) {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	start := time.Now()
+	view := s.cacheManager.View()
+	err := WriteSnapshot(s.path, &Snapshot{
+		NodeID:    s.cacheManager.NodeID(),
+		Region:    s.cacheManager.Region(),
+		CreatedAt: view.At,
+		Sequence:  view.Sequence,
+		Items:     view.Items,
+	})
+
+	s.mutex.Lock()
+	if err != nil {
+		s.status.Failures++
+		s.status.LastError = err.Error()
+	} else {
+		s.status.Items = len(view.Items)
+		s.status.Sequence = view.Sequence
+		s.status.SavedAt = view.At
+		s.status.DurationMS = time.Since(start).Milliseconds()
+		s.status.LastError = ""
+	}
+	status := s.status
+	s.mutex.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save snapshot: %v", err)
+		events.Record(events.KindError, "Failed to save snapshot to %s: %v", s.path, err)
+	}
+	return status, err
+}
+
+// Status returns the status of the last save.
+func (s *Snapshotter) Status() SnapshotStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
@@ -0,0 +1,278 @@
+package progress
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Each learner's progress through the training is one JSON item in
+// Namespace, kept for a sliding TTL so that learners who come back keep
+// it and those who don't are forgotten. A learner may use several devices
+// at once, so an update is never stored as sent: it is merged into the
+// stored progress, and the merge retries with a compare-and-swap until no
+// other update came in between. The merge only ever adds: a topic stays
+// completed, quiz attempts are kept by ID, so an update sent twice, or
+// one built on stale progress, loses nothing.
+
+// Namespace is the cache namespace progress is stored in.
+const Namespace = "progress"
+
+// mergeAttempts bounds the compare-and-swap retries of one update.
+const mergeAttempts = 8
+
+var (
+	ErrInvalidProgress = errors.New("invalid progress")
+	ErrBusy            = errors.New("progress changed by too many concurrent updates")
+)
+
+// Progress is one learner's progress through the topics and quizzes.
+type Progress struct {
+	UserID    string                    `json:"user_id"`
+	Topics    map[string]*TopicProgress `json:"topics"`
+	Quizzes   map[string]*QuizProgress  `json:"quizzes"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
+
+// TopicProgress is when a learner last viewed a topic and first
+// completed it.
+type TopicProgress struct {
+	ViewedAt    time.Time  `json:"viewed_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// QuizProgress is a learner's latest attempts at a quiz and the best score
+// of any attempt, including those no longer kept.
+type QuizProgress struct {
+	Attempts  []*QuizAttempt `json:"attempts"`
+	BestScore float64        `json:"best_score"`
+}
+
+// QuizAttempt is one submission of a quiz. The ID, chosen by the device,
+// identifies the attempt across retries and devices; attempts sent
+// without one are identified by when they were submitted.
+type QuizAttempt struct {
+	ID          string    `json:"id"`
+	Answers     []int     `json:"answers,omitempty"`
+	Score       float64   `json:"score"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// Tracker stores learner progress in the cache.
+type Tracker struct {
+	cfg          config.ProgressConfig
+	cacheManager *cache.Manager
+}
+
+// New returns a Tracker storing progress in cacheManager.
+func New(cfg config.ProgressConfig, cacheManager *cache.Manager) *Tracker {
+	return &Tracker{cfg: cfg, cacheManager: cacheManager}
+}
+
+// Key returns the cache key of userID's progress.
+func Key(userID string) string {
+	return cache.NamespaceKey(Namespace, userID)
+}
+
+// Get returns userID's progress, restarting its TTL.
+func (t *Tracker) Get(ctx context.Context, userID string) (*Progress, uint64, error) {
+	item, err := t.cacheManager.Read(ctx, Key(userID), cache.ReadOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	progress, err := decode(item)
+	if err != nil {
+		return nil, 0, err
+	}
+	return progress, item.Version, nil
+}
+
+// Update merges update into userID's progress and returns the result.
+func (t *Tracker) Update(ctx context.Context, userID string, update *Progress) (*Progress, uint64, error) {
+	now := time.Now().UTC()
+	if err := normalize(update, now); err != nil {
+		return nil, 0, err
+	}
+
+	for attempt := 0; attempt < mergeAttempts; attempt++ {
+		options := cache.WriteOptions{
+			TTL:      time.Duration(t.cfg.TTLSeconds) * time.Second,
+			Encoding: codec.EncodingJSON,
+			Sliding:  true,
+		}
+		merged := &Progress{UserID: userID}
+		stored, version, err := t.Get(ctx, userID)
+		switch {
+		case err == nil:
+			merged = stored
+			options.IfVersion = version
+		case errors.Is(err, cache.ErrNotFound), errors.Is(err, cache.ErrExpired):
+			options.IfAbsent = true
+		default:
+			return nil, 0, err
+		}
+		merge(merged, update, t.cfg.MaxAttempts)
+		merged.UserID = userID
+		merged.UpdatedAt = now
+
+		value, err := json.Marshal(merged)
+		if err != nil {
+			return nil, 0, err
+		}
+		item, err := t.cacheManager.Write(ctx, Key(userID), string(value), options)
+		if errors.Is(err, cache.ErrVersionMismatch) || errors.Is(err, cache.ErrExists) {
+			// Another device's update got in first; merge into that.
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return merged, item.Version, nil
+	}
+	return nil, 0, ErrBusy
+}
+
+// Delete forgets userID's progress, here and, through the replicated
+// delete, on peers.
+func (t *Tracker) Delete(ctx context.Context, userID string) error {
+	key := Key(userID)
+	deleted, err := t.cacheManager.DeleteWhere(ctx, key, func(item *cache.CacheItem) bool {
+		return item.Key == key
+	}, cache.WriteOptions{})
+	if err == nil && deleted == 0 {
+		err = &cache.KeyError{Key: key, Err: cache.ErrNotFound}
+	}
+	return err
+}
+
+// Export returns the progress of every learner held on this node, ordered
+// by user ID. Unlike Get it leaves their TTLs alone, so reporting doesn't
+// keep inactive learners' progress alive.
+func (t *Tracker) Export() []*Progress {
+	prefix := cache.NamespaceKey(Namespace, "")
+	exported := []*Progress{}
+	for _, item := range t.cacheManager.View().Items {
+		if !strings.HasPrefix(item.Key, prefix) {
+			continue
+		}
+		progress, err := decode(item)
+		if err != nil {
+			continue
+		}
+		exported = append(exported, progress)
+	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].UserID < exported[j].UserID })
+	return exported
+}
+
+func decode(item *cache.CacheItem) (*Progress, error) {
+	var progress Progress
+	if err := json.Unmarshal([]byte(item.Value), &progress); err != nil {
+		return nil, fmt.Errorf("%w stored under %s: %v", ErrInvalidProgress, item.Key, err)
+	}
+	if progress.Topics == nil {
+		progress.Topics = make(map[string]*TopicProgress)
+	}
+	if progress.Quizzes == nil {
+		progress.Quizzes = make(map[string]*QuizProgress)
+	}
+	return &progress, nil
+}
+
+// normalize checks an update and fills in the times and attempt IDs a
+// device left out.
+func normalize(update *Progress, now time.Time) error {
+	for id, topic := range update.Topics {
+		if id == "" || topic == nil {
+			return fmt.Errorf("%w: topics need an ID and a body", ErrInvalidProgress)
+		}
+		if topic.ViewedAt.IsZero() {
+			topic.ViewedAt = now
+		}
+	}
+	for id, quiz := range update.Quizzes {
+		if id == "" || quiz == nil {
+			return fmt.Errorf("%w: quizzes need an ID and a body", ErrInvalidProgress)
+		}
+		if quiz.BestScore < 0 {
+			return fmt.Errorf("%w: quiz %s has a negative best score", ErrInvalidProgress, id)
+		}
+		for _, attempt := range quiz.Attempts {
+			if attempt == nil || attempt.Score < 0 {
+				return fmt.Errorf("%w: quiz %s has an attempt with a negative score", ErrInvalidProgress, id)
+			}
+			if attempt.SubmittedAt.IsZero() {
+				attempt.SubmittedAt = now
+			}
+			if attempt.ID == "" {
+				attempt.ID = attempt.SubmittedAt.UTC().Format(time.RFC3339Nano)
+			}
+		}
+	}
+	return nil
+}
+
+// merge adds update to progress: topics keep their latest view and first
+// completion, quizzes the union of their attempts, latest maxAttempts
+// first, and the best score of either.
+func merge(progress, update *Progress, maxAttempts int) {
+	if progress.Topics == nil {
+		progress.Topics = make(map[string]*TopicProgress)
+	}
+	if progress.Quizzes == nil {
+		progress.Quizzes = make(map[string]*QuizProgress)
+	}
+
+	for id, topic := range update.Topics {
+		stored := progress.Topics[id]
+		if stored == nil {
+			progress.Topics[id] = topic
+			continue
+		}
+		if topic.ViewedAt.After(stored.ViewedAt) {
+			stored.ViewedAt = topic.ViewedAt
+		}
+		if topic.CompletedAt != nil && (stored.CompletedAt == nil || topic.CompletedAt.Before(*stored.CompletedAt)) {
+			stored.CompletedAt = topic.CompletedAt
+		}
+	}
+
+	for id, quiz := range update.Quizzes {
+		stored := progress.Quizzes[id]
+		if stored == nil {
+			stored = &QuizProgress{}
+			progress.Quizzes[id] = stored
+		}
+		known := make(map[string]bool, len(stored.Attempts))
+		for _, attempt := range stored.Attempts {
+			known[attempt.ID] = true
+		}
+		for _, attempt := range quiz.Attempts {
+			if !known[attempt.ID] {
+				known[attempt.ID] = true
+				stored.Attempts = append(stored.Attempts, attempt)
+			}
+		}
+		sort.SliceStable(stored.Attempts, func(i, j int) bool {
+			return stored.Attempts[i].SubmittedAt.After(stored.Attempts[j].SubmittedAt)
+		})
+		if quiz.BestScore > stored.BestScore {
+			stored.BestScore = quiz.BestScore
+		}
+		for _, attempt := range stored.Attempts {
+			if attempt.Score > stored.BestScore {
+				stored.BestScore = attempt.Score
+			}
+		}
+		if len(stored.Attempts) > maxAttempts {
+			stored.Attempts = stored.Attempts[:maxAttempts]
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package query
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dependency identifies the exact revision of an item a derived value was
+// computed from. Version alone is not unique across nodes, so the write
+// timestamp is part of the identity too. A zero Dependency stands for a
+// key that did not exist.
+type Dependency struct {
+	Key       string
+	Version   uint64
+	Timestamp time.Time
+}
+
+type derivedEntry struct {
+	id    string
+	keys  []string
+	value interface{}
+}
+
+type DerivedStats struct {
+	Entries   int   `json:"entries"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// DerivedCache is a small LRU of values computed from cache items, such as
+// parsed JSON documents, JSONPath results and UDF outputs, keyed by what was
+// computed and the revisions of the items it was computed from. Entries are
+// also dropped as soon as any item they depend on changes.
+type DerivedCache struct {
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	byKey      map[string]map[string]struct{}
+	stats      DerivedStats
+	mutex      sync.Mutex
+}
+
+func NewDerivedCache(maxEntries int) *DerivedCache {
+	return &DerivedCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		byKey:      make(map[string]map[string]struct{}),
+	}
+}
+
+func entryID(query string, deps []Dependency) string {
+	var b strings.Builder
+	b.WriteString(query)
+	for _, dep := range deps {
+		fmt.Fprintf(&b, "\x00%s\x00%d\x00%d", dep.Key, dep.Version, dep.Timestamp.UnixNano())
+	}
+	return b.String()
+}
+
+func (c *DerivedCache) Get(query string, deps ...Dependency) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.entries[entryID(query, deps)]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*derivedEntry).value, true
+}
+
+func (c *DerivedCache) Put(query string, value interface{}, deps ...Dependency) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := entryID(query, deps)
+	if element, exists := c.entries[id]; exists {
+		element.Value.(*derivedEntry).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	entry := &derivedEntry{id: id, value: value}
+	for _, dep := range deps {
+		entry.keys = append(entry.keys, dep.Key)
+		if c.byKey[dep.Key] == nil {
+			c.byKey[dep.Key] = make(map[string]struct{})
+		}
+		c.byKey[dep.Key][id] = struct{}{}
+	}
+	c.entries[id] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Invalidate drops every entry derived from key.
+func (c *DerivedCache) Invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id := range c.byKey[key] {
+		if element, exists := c.entries[id]; exists {
+			c.remove(element)
+		}
+	}
+}
+
+// InvalidateAll empties the cache.
+func (c *DerivedCache) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.byKey = make(map[string]map[string]struct{})
+}
+
+func (c *DerivedCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*derivedEntry)
+	delete(c.entries, entry.id)
+	for _, key := range entry.keys {
+		delete(c.byKey[key], entry.id)
+		if len(c.byKey[key]) == 0 {
+			delete(c.byKey, key)
+		}
+	}
+}
+
+func (c *DerivedCache) Stats() DerivedStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
@@ -0,0 +1,206 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segmentField segmentKind = iota
+	segmentIndex
+	segmentWildcard
+	segmentSlice
+)
+
+type segment struct {
+	kind  segmentKind
+	field string
+	index int
+	start *int
+	end   *int
+}
+
+// Path is a compiled JSONPath expression. The supported subset is the root
+// "$" followed by .field, ['field'], [n], [-n], [*], .* and [start:end].
+type Path struct {
+	raw      string
+	segments []segment
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Definite reports whether the path can select at most one value.
+func (p *Path) Definite() bool {
+	for _, seg := range p.segments {
+		if seg.kind == segmentWildcard || seg.kind == segmentSlice {
+			return false
+		}
+	}
+	return true
+}
+
+func Parse(raw string) (*Path, error) {
+	expr := strings.TrimSpace(raw)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath must start with $: %q", raw)
+	}
+
+	p := &Path{raw: raw}
+	rest := expr[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, "*") {
+				p.segments = append(p.segments, segment{kind: segmentWildcard})
+				rest = rest[1:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty field name in jsonpath %q", raw)
+			}
+			p.segments = append(p.segments, segment{kind: segmentField, field: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in jsonpath %q", raw)
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%v in jsonpath %q", err, raw)
+			}
+			p.segments = append(p.segments, seg)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath %q", rest[0], raw)
+		}
+	}
+	return p, nil
+}
+
+func parseBracket(inner string) (segment, error) {
+	inner = strings.TrimSpace(inner)
+	switch {
+	case inner == "*":
+		return segment{kind: segmentWildcard}, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return segment{kind: segmentField, field: inner[1 : len(inner)-1]}, nil
+	case strings.Contains(inner, ":"):
+		parts := strings.SplitN(inner, ":", 2)
+		seg := segment{kind: segmentSlice}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return segment{}, fmt.Errorf("invalid slice bound %q", part)
+			}
+			if i == 0 {
+				seg.start = &n
+			} else {
+				seg.end = &n
+			}
+		}
+		return seg, nil
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return segment{}, fmt.Errorf("invalid index %q", inner)
+		}
+		return segment{kind: segmentIndex, index: n}, nil
+	}
+}
+
+// Eval applies the path to a decoded JSON document (as produced by
+// encoding/json into interface{}) and returns every selected value.
+func (p *Path) Eval(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, node := range current {
+			next = append(next, seg.apply(node)...)
+		}
+		current = next
+		if len(current) == 0 {
+			break
+		}
+	}
+	return current
+}
+
+func (s segment) apply(node interface{}) []interface{} {
+	switch s.kind {
+	case segmentField:
+		if obj, ok := node.(map[string]interface{}); ok {
+			if v, exists := obj[s.field]; exists {
+				return []interface{}{v}
+			}
+		}
+	case segmentIndex:
+		if arr, ok := node.([]interface{}); ok {
+			i := s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []interface{}{arr[i]}
+			}
+		}
+	case segmentWildcard:
+		switch v := node.(type) {
+		case []interface{}:
+			return append([]interface{}(nil), v...)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			values := make([]interface{}, 0, len(v))
+			for _, k := range keys {
+				values = append(values, v[k])
+			}
+			return values
+		}
+	case segmentSlice:
+		if arr, ok := node.([]interface{}); ok {
+			start, end := 0, len(arr)
+			if s.start != nil {
+				start = clampIndex(*s.start, len(arr))
+			}
+			if s.end != nil {
+				end = clampIndex(*s.end, len(arr))
+			}
+			if start < end {
+				return append([]interface{}(nil), arr[start:end]...)
+			}
+		}
+	}
+	return nil
+}
+
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
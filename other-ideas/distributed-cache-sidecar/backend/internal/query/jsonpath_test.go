@@ -0,0 +1,70 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{
+		"name": "Ada",
+		"tags": ["a", "b", "c", "d"],
+		"address": {"city": "London", "zip": "N1"},
+		"orders": [{"id": 1, "total": 5}, {"id": 2, "total": 7}],
+		"odd key": true
+	}`), &doc)
+
+	tests := []struct {
+		path     string
+		want     string
+		definite bool
+	}{
+		{"$", `[` + mustMarshal(doc) + `]`, true},
+		{"$.name", `["Ada"]`, true},
+		{"$['name']", `["Ada"]`, true},
+		{`$["odd key"]`, `[true]`, true},
+		{"$.address.city", `["London"]`, true},
+		{"$.tags[0]", `["a"]`, true},
+		{"$.tags[-1]", `["d"]`, true},
+		{"$.tags[4]", `null`, true},
+		{"$.tags[*]", `["a","b","c","d"]`, false},
+		{"$.address.*", `["London","N1"]`, false},
+		{"$.tags[1:3]", `["b","c"]`, false},
+		{"$.tags[:2]", `["a","b"]`, false},
+		{"$.tags[-2:]", `["c","d"]`, false},
+		{"$.tags[3:1]", `null`, false},
+		{"$.orders[*].total", `[5,7]`, false},
+		{"$.orders[1].id", `[2]`, true},
+		{"$.missing.field", `null`, true},
+		{"$.name.first", `null`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			p, err := Parse(test.path)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := mustMarshal(p.Eval(doc)); got != test.want {
+				t.Errorf("Eval = %s, want %s", got, test.want)
+			}
+			if p.Definite() != test.definite {
+				t.Errorf("Definite = %v, want %v", p.Definite(), test.definite)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, path := range []string{"name", "$.", "$..name", "$[0", "$[x]", "$[1:x]", "$name"} {
+		if _, err := Parse(path); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", path)
+		}
+	}
+}
+
+func mustMarshal(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+type ValidationError struct {
+	Key     string       `json:"key"`
+	Prefix  string       `json:"prefix"`
+	Message string       `json:"error"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+type FieldError struct {
+	InstanceLocation string `json:"instance_location"`
+	KeywordLocation  string `json:"keyword_location"`
+	Message          string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Details) > 0 {
+		return fmt.Sprintf("%s: %s at %s", e.Message, e.Details[0].Message, e.Details[0].InstanceLocation)
+	}
+	return e.Message
+}
+
+type entry struct {
+	source json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// Registry holds JSON Schemas keyed by key prefix. A key is validated
+// against the schema registered for its longest matching prefix.
+type Registry struct {
+	entries map[string]*entry
+	mutex   sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*entry)}
+}
+
+func (r *Registry) Register(prefix string, source []byte) error {
+	if prefix == "" {
+		return errors.New("schema prefix must not be empty")
+	}
+
+	url := "mem://schemas/" + prefix
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(source)); err != nil {
+		return fmt.Errorf("invalid schema for prefix %q: %v", prefix, err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("invalid schema for prefix %q: %v", prefix, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[prefix] = &entry{
+		source: append(json.RawMessage(nil), source...),
+		schema: compiled,
+	}
+	return nil
+}
+
+func (r *Registry) Remove(prefix string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.entries[prefix]; exists {
+		delete(r.entries, prefix)
+		return true
+	}
+	return false
+}
+
+func (r *Registry) List() map[string]json.RawMessage {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	schemas := make(map[string]json.RawMessage, len(r.entries))
+	for prefix, e := range r.entries {
+		schemas[prefix] = e.source
+	}
+	return schemas
+}
+
+// Match returns the longest registered prefix that key starts with.
+func (r *Registry) Match(key string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.match(key)
+}
+
+func (r *Registry) match(key string) (string, bool) {
+	prefixes := make([]string, 0, len(r.entries))
+	for prefix := range r.entries {
+		if strings.HasPrefix(key, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return "", false
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return prefixes[0], true
+}
+
+// Validate checks a JSON document against the schema for key. Keys with no
+// matching prefix always pass.
+func (r *Registry) Validate(key string, document []byte) error {
+	r.mutex.RLock()
+	prefix, found := r.match(key)
+	var compiled *jsonschema.Schema
+	if found {
+		compiled = r.entries[prefix].schema
+	}
+	r.mutex.RUnlock()
+
+	if !found {
+		return nil
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return &ValidationError{Key: key, Prefix: prefix, Message: "value is not a valid JSON document"}
+	}
+
+	err := compiled.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	verr := &ValidationError{Key: key, Prefix: prefix, Message: "value does not match schema"}
+	var schemaErr *jsonschema.ValidationError
+	if errors.As(err, &schemaErr) {
+		for _, basic := range schemaErr.BasicOutput().Errors {
+			if basic.Error == "" || strings.HasPrefix(basic.Error, "doesn't validate with") {
+				continue
+			}
+			verr.Details = append(verr.Details, FieldError{
+				InstanceLocation: basic.InstanceLocation,
+				KeywordLocation:  basic.KeywordLocation,
+				Message:          basic.Error,
+			})
+		}
+	}
+	return verr
+}
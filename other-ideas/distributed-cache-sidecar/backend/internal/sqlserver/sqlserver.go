@@ -0,0 +1,298 @@
+package sqlserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/codec"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/logging"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+var logger = logging.New("sqlserver")
+
+// Namespace is the cache namespace query results are stored in, so they
+// can be listed, measured and flushed like any namespace.
+const Namespace = "sql"
+
+// TablesMetadata is the item metadata listing the tables a result was
+// read from, comma-separated and normalized.
+const TablesMetadata = "sql_tables"
+
+var (
+	ErrNotQuery    = errors.New("only single SELECT statements can be cached")
+	ErrTooManyRows = errors.New("query returned too many rows to cache")
+	ErrQueryFailed = errors.New("query failed")
+)
+
+// Query is a parameterized statement to run, with the tables it reads,
+// by which its cached result is invalidated. Params are bound by name,
+// as @name in the statement.
+type Query struct {
+	SQL    string                 `json:"query"`
+	Params map[string]interface{} `json:"params"`
+	Tables []string               `json:"tables"`
+	TTL    time.Duration          `json:"-"`
+}
+
+// Result is the rows a query returned, as stored in the cache.
+type Result struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Adapter runs queries against SQL Server on a cache miss and caches their
+// results. Concurrent misses of one query on a node run it once.
+type Adapter struct {
+	cfg          config.SQLServerConfig
+	cacheManager *cache.Manager
+	db           *sql.DB
+}
+
+// New opens the connection pool for cfg.DSN. Connections are made as
+// queries need them, so an unreachable server isn't an error here.
+func New(cfg config.SQLServerConfig, cacheManager *cache.Manager) (*Adapter, error) {
+	db, err := sql.Open("sqlserver", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &Adapter{cfg: cfg, cacheManager: cacheManager, db: db}, nil
+}
+
+func (a *Adapter) Close() error {
+	return a.db.Close()
+}
+
+// Query returns the cached result of query, running it if there is none,
+// and reports whether the result was cached.
+func (a *Adapter) Query(ctx context.Context, query Query) (*cache.CacheItem, bool, error) {
+	statement := Normalize(query.SQL)
+	if !isSelect(statement) {
+		return nil, false, ErrNotQuery
+	}
+	key, err := Key(statement, query.Params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tables := make([]string, 0, len(query.Tables))
+	for _, table := range query.Tables {
+		tables = append(tables, NormalizeTable(table))
+	}
+	sort.Strings(tables)
+
+	ttl := query.TTL
+	if ttl == 0 {
+		ttl = time.Duration(a.cfg.CacheTTLSeconds) * time.Second
+	}
+	options := cache.WriteOptions{
+		TTL:      ttl,
+		Encoding: codec.EncodingJSON,
+		Metadata: map[string]string{TablesMetadata: strings.Join(tables, ",")},
+	}
+	return a.cacheManager.GetOrLoad(ctx, key, func(ctx context.Context) (string, error) {
+		result, err := a.run(ctx, query.SQL, query.Params)
+		if err != nil && !errors.Is(err, ErrTooManyRows) {
+			return "", fmt.Errorf("%w: %v", ErrQueryFailed, err)
+		}
+		return result, err
+	}, options)
+}
+
+// run executes statement and encodes the rows it returns.
+func (a *Adapter) run(ctx context.Context, statement string, params map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.cfg.QueryTimeoutMS)*time.Millisecond)
+	defer cancel()
+
+	args := make([]interface{}, 0, len(params))
+	for name, value := range params {
+		args = append(args, sql.Named(name, bindValue(value)))
+	}
+	started := time.Now()
+	rows, err := a.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	result := &Result{Rows: [][]interface{}{}}
+	if result.Columns, err = rows.Columns(); err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		if len(result.Rows) == a.cfg.MaxRows {
+			return "", fmt.Errorf("%w: more than %d", ErrTooManyRows, a.cfg.MaxRows)
+		}
+		values := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+		for i, value := range values {
+			// Decimals, money and binary columns arrive as bytes.
+			if raw, isBytes := value.([]byte); isBytes {
+				values[i] = string(raw)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	logger.Printf("Ran query for %d rows in %v", len(result.Rows), time.Since(started))
+
+	document, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(document), nil
+}
+
+// bindValue converts a JSON parameter to the type the driver binds:
+// integral numbers to int64, other numbers to float64.
+func bindValue(value interface{}) interface{} {
+	number, isNumber := value.(json.Number)
+	if !isNumber {
+		return value
+	}
+	if integer, err := number.Int64(); err == nil {
+		return integer
+	}
+	float, _ := number.Float64()
+	return float
+}
+
+// Invalidate deletes the cached results of queries that read table, here
+// and, through the replicated deletes, on peers, and returns how many
+// this node held.
+func (a *Adapter) Invalidate(ctx context.Context, table string) (int, error) {
+	table = NormalizeTable(table)
+	return a.cacheManager.DeleteWhere(ctx, cache.NamespaceKey(Namespace, ""), func(item *cache.CacheItem) bool {
+		for _, read := range strings.Split(item.Metadata[TablesMetadata], ",") {
+			if read == table {
+				return true
+			}
+		}
+		return false
+	}, cache.WriteOptions{})
+}
+
+// Key is the cache key of the result of the normalized statement run with
+// params: a hash of both, so the same query with the same parameters maps
+// to one key however it is laid out.
+func Key(statement string, params map[string]interface{}) (string, error) {
+	// Maps encode with sorted keys, so equal parameters encode alike.
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(statement + "\x00" + string(encoded)))
+	return cache.NamespaceKey(Namespace, hex.EncodeToString(sum[:16])), nil
+}
+
+// Normalize collapses runs of whitespace outside quoted strings and
+// identifiers to one space, and lowercases what is outside them, so
+// queries that differ only in layout or keyword case share a result.
+func Normalize(statement string) string {
+	var normalized strings.Builder
+	var quote rune
+	space := false
+	for _, r := range strings.TrimSpace(statement) {
+		switch {
+		case quote != 0:
+			normalized.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '\'' || r == '"' || r == '[':
+			quote = r
+			if r == '[' {
+				quote = ']'
+			}
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			space = true
+			continue
+		}
+		if space {
+			normalized.WriteByte(' ')
+			space = false
+		}
+		if quote == 0 && r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		normalized.WriteRune(r)
+	}
+	return normalized.String()
+}
+
+// writeKeywords are the keywords that make a statement more than a read.
+var writeKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "into": true,
+	"create": true, "alter": true, "drop": true, "truncate": true,
+	"exec": true, "execute": true, "grant": true, "revoke": true, "deny": true,
+}
+
+// isSelect reports whether the normalized statement is one SELECT, or one
+// WITH ... SELECT, that can't write: it has no second statement and none
+// of writeKeywords outside quotes. This keeps a cache read from changing
+// data by mistake; it is no substitute for a DSN whose login can only
+// read.
+func isSelect(statement string) bool {
+	if !strings.HasPrefix(statement, "select ") && !strings.HasPrefix(statement, "with ") {
+		return false
+	}
+	statement = strings.TrimSuffix(statement, ";")
+	var quote rune
+	var word strings.Builder
+	for _, r := range statement + " " {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == ';':
+			return false
+		case r == '_' || r == '@' || r == '#' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			word.WriteRune(r)
+			continue
+		}
+		if writeKeywords[word.String()] {
+			return false
+		}
+		word.Reset()
+	}
+	return true
+}
+
+// NormalizeTable lowercases a table name and drops the brackets around
+// its parts, so [dbo].[Licenses] and dbo.licenses name the same table. A
+// name without a schema is taken to be in dbo.
+func NormalizeTable(table string) string {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(table)), ".")
+	for i, part := range parts {
+		parts[i] = strings.TrimSuffix(strings.TrimPrefix(part, "["), "]")
+	}
+	if len(parts) == 1 {
+		parts = []string{"dbo", parts[0]}
+	}
+	return strings.Join(parts, ".")
+}
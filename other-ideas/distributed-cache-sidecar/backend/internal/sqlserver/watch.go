@@ -0,0 +1,174 @@
+package sqlserver
+
+import (
+	"context"
+	"database/sql"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"distributed-cache-sidecar/internal/metrics"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The watcher polls the tables in sqlserver.watch_tables and, when one
+// has changed since the last poll, invalidates the cached results tagged
+// with it. Tables with change tracking enabled are asked whether
+// CHANGETABLE lists changes since the version last seen, which catches
+// every insert, update and delete. Tables given as table:column are
+// instead compared by row count and the largest value of a rowversion
+// column, which catches inserts, updates and deletes that change the
+// count, but not a delete and an insert between two polls that cancel
+// out. The first poll of a table only records where it stands.
+
+var (
+	sqlTableChanges = metrics.NewCounter("sidecar_sqlserver_table_changes_total",
+		"Changes to watched SQL Server tables that invalidated cached results, by table.", "table")
+	sqlWatchErrors = metrics.NewCounter("sidecar_sqlserver_watch_errors_total",
+		"Failed polls of watched SQL Server tables, by table.", "table")
+)
+
+// watchedTable is a table the watcher polls and where it stood when last
+// polled.
+type watchedTable struct {
+	// name is the table as queries are tagged with it; quoted is how
+	// statements name it.
+	name   string
+	quoted string
+	// column is the quoted rowversion column, empty for change tracking.
+	column string
+
+	primed  bool
+	version int64
+	rows    int64
+}
+
+func newWatchedTable(spec string) *watchedTable {
+	table, column, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	watched := &watchedTable{name: NormalizeTable(table), quoted: quoteName(table)}
+	if column = strings.TrimSpace(column); column != "" {
+		watched.column = quoteName(column)
+	}
+	return watched
+}
+
+// quoteName brackets each part of a dotted name, as QUOTENAME does, so
+// configured names can't break out of the statements they go into.
+func quoteName(name string) string {
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	for i, part := range parts {
+		part = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(part), "["), "]")
+		parts[i] = "[" + strings.ReplaceAll(part, "]", "]]") + "]"
+	}
+	return strings.Join(parts, ".")
+}
+
+// Watch starts polling sqlserver.watch_tables, until the process stops.
+func (a *Adapter) Watch() {
+	if len(a.cfg.WatchTables) == 0 {
+		return
+	}
+	tables := make([]*watchedTable, 0, len(a.cfg.WatchTables))
+	for _, spec := range a.cfg.WatchTables {
+		tables = append(tables, newWatchedTable(spec))
+	}
+	interval := time.Duration(a.cfg.WatchIntervalMS) * time.Millisecond
+
+	lifecycle.Go("sqlserver-watcher", "", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, table := range tables {
+				a.check(table)
+			}
+			select {
+			case <-ticker.C:
+			case <-lifecycle.Stopping():
+				return
+			}
+		}
+	})
+}
+
+// check polls table once and invalidates what reads it if it changed.
+func (a *Adapter) check(table *watchedTable) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.cfg.QueryTimeoutMS)*time.Millisecond)
+	defer cancel()
+
+	var changed bool
+	var err error
+	if table.column != "" {
+		changed, err = a.pollRowversion(ctx, table)
+	} else {
+		changed, err = a.pollChangeTracking(ctx, table)
+	}
+	if err != nil {
+		sqlWatchErrors.Inc(table.name)
+		logger.Printf("Polling %s for changes failed: %v", table.name, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	sqlTableChanges.Inc(table.name)
+	deleted, err := a.Invalidate(ctx, table.name)
+	if err != nil {
+		logger.Printf("Invalidating results that read %s failed: %v", table.name, err)
+		return
+	}
+	logger.Printf("%s changed, invalidated %d cached results", table.name, deleted)
+}
+
+// pollChangeTracking reports whether change tracking lists changes to
+// table since the version last seen. Once the last version seen falls
+// out of the retained history every change is assumed.
+func (a *Adapter) pollChangeTracking(ctx context.Context, table *watchedTable) (bool, error) {
+	var current, minimum sql.NullInt64
+	err := a.db.QueryRowContext(ctx,
+		"SELECT CHANGE_TRACKING_CURRENT_VERSION(), CHANGE_TRACKING_MIN_VALID_VERSION(OBJECT_ID(@table))",
+		sql.Named("table", table.quoted)).Scan(&current, &minimum)
+	if err != nil {
+		return false, err
+	}
+	if !current.Valid || !minimum.Valid {
+		return false, fmt.Errorf("change tracking is not enabled for %s; enable it or watch %s:<rowversion column>", table.name, table.name)
+	}
+
+	last := table.version
+	table.version = current.Int64
+	switch {
+	case !table.primed:
+		table.primed = true
+		return false, nil
+	case current.Int64 == last:
+		return false, nil
+	case minimum.Int64 > last:
+		return true, nil
+	}
+
+	var changes int64
+	err = a.db.QueryRowContext(ctx,
+		"SELECT COUNT_BIG(*) FROM CHANGETABLE(CHANGES "+table.quoted+", @last) AS changes",
+		sql.Named("last", last)).Scan(&changes)
+	if err != nil {
+		// Look again from the same version next time.
+		table.version = last
+		return false, err
+	}
+	return changes > 0, nil
+}
+
+// pollRowversion reports whether table's row count or largest rowversion
+// differs from the last poll.
+func (a *Adapter) pollRowversion(ctx context.Context, table *watchedTable) (bool, error) {
+	var rows, version int64
+	err := a.db.QueryRowContext(ctx,
+		"SELECT COUNT_BIG(*), ISNULL(CONVERT(bigint, MAX("+table.column+")), 0) FROM "+table.quoted).Scan(&rows, &version)
+	if err != nil {
+		return false, err
+	}
+
+	changed := table.primed && (rows != table.rows || version != table.version)
+	table.primed, table.rows, table.version = true, rows, version
+	return changed, nil
+}
@@ -0,0 +1,144 @@
+// Package teardown purges time-boxed namespaces once their lifetime is
+// over. A namespace is time-boxed by a quota with an expiry; its items
+// can't outlive it, but the namespace is only gone once its keys are
+// deleted here and on peers and its quota with them. Before purging one,
+// the node archives its stats, so how a lab's namespace was used can be
+// reported on after it is gone.
+package teardown
+
+import (
+	"context"
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/events"
+	"distributed-cache-sidecar/internal/lifecycle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Report is the archive of a namespace torn down by NodeID: its quota and
+// its stats on that node just before.
+type Report struct {
+	NodeID     string               `json:"node_id"`
+	Namespace  string               `json:"namespace"`
+	Quota      cache.NamespaceQuota `json:"quota"`
+	Stats      cache.NamespaceStats `json:"stats"`
+	TornDownAt time.Time            `json:"torn_down_at"`
+}
+
+// Reaper tears down the namespaces whose lifetime is over.
+type Reaper struct {
+	cfg          config.NamespacesConfig
+	nodeID       string
+	cacheManager *cache.Manager
+}
+
+// New returns a Reaper tearing down namespaces held in cacheManager.
+func New(cfg config.NamespacesConfig, nodeID string, cacheManager *cache.Manager) *Reaper {
+	return &Reaper{cfg: cfg, nodeID: nodeID, cacheManager: cacheManager}
+}
+
+// Start sweeps every TeardownIntervalMS until the process begins shutting
+// down.
+func (r *Reaper) Start() {
+	lifecycle.Go("namespace-reaper", "", func() {
+		ticker := time.NewTicker(time.Duration(r.cfg.TeardownIntervalMS) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lifecycle.Stopping():
+				return
+			case <-ticker.C:
+				r.Sweep(context.Background())
+			}
+		}
+	})
+}
+
+// Sweep tears down every namespace whose lifetime is over and returns the
+// reports of those it tore down.
+func (r *Reaper) Sweep(ctx context.Context) []Report {
+	now := time.Now()
+	var reports []Report
+	for _, quota := range r.cacheManager.Quotas() {
+		if quota.ExpiresAt == nil || quota.ExpiresAt.After(now) {
+			continue
+		}
+		report, err := r.tearDown(ctx, quota)
+		if err != nil {
+			log.Printf("Failed to tear down namespace %s: %v", quota.Namespace, err)
+			events.Record(events.KindError, "Failed to tear down namespace %s: %v", quota.Namespace, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// tearDown archives the stats of the namespace quota applies to, then
+// deletes its keys and quota here and on peers. A report that can't be
+// written leaves the namespace in place, to be tried again.
+func (r *Reaper) tearDown(ctx context.Context, quota cache.NamespaceQuota) (Report, error) {
+	report := Report{
+		NodeID:     r.nodeID,
+		Namespace:  quota.Namespace,
+		Quota:      quota,
+		Stats:      r.cacheManager.NamespaceStats(quota.Namespace),
+		TornDownAt: time.Now().UTC(),
+	}
+	report.Stats.Quota = nil
+	path, err := r.archive(report)
+	if err != nil {
+		return Report{}, err
+	}
+
+	deleted, err := r.cacheManager.DropNamespace(ctx, quota.Namespace, cache.WriteOptions{})
+	if err != nil {
+		return Report{}, err
+	}
+	log.Printf("Tore down namespace %s, expired at %s, deleting %d items; report in %s", quota.Namespace, quota.ExpiresAt.Format(time.RFC3339), deleted, path)
+	events.Record(events.KindLifecycle, "Tore down namespace %s, deleting %d items", quota.Namespace, deleted)
+	return report, nil
+}
+
+func (r *Reaper) archive(report Report) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(r.cfg.ReportDir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(r.cfg.ReportDir, fmt.Sprintf("namespace-%s-%s.json", report.Namespace, report.TornDownAt.Format("20060102T150405.000000000Z")))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Reports returns the reports archived on this node, latest first.
+func (r *Reaper) Reports() ([]Report, error) {
+	paths, err := filepath.Glob(filepath.Join(r.cfg.ReportDir, "namespace-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	reports := []Report{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid report %s: %v", filepath.Base(path), err)
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].TornDownAt.After(reports[j].TornDownAt) })
+	return reports, nil
+}
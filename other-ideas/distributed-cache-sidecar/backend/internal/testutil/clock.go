@@ -0,0 +1,35 @@
+package testutil
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a manually advanced clock shared by the nodes of a Cluster.
+// Every reading is at least a nanosecond after the previous one, so two
+// writes never get the same timestamp and last-writer-wins stays decided
+// by the order the writes happened in.
+type Clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(time.Nanosecond)
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
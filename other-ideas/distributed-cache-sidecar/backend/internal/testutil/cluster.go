@@ -0,0 +1,257 @@
+// Package testutil runs clusters of sidecar nodes inside one process for
+// integration tests: nodes talk over an in-memory Network with injectable
+// faults and stamp writes with a shared, manually advanced Clock.
+package testutil
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"distributed-cache-sidecar/internal/network"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Node is one in-process sidecar: a cache, its TCP server and its peer
+// manager. There is no HTTP server.
+type Node struct {
+	ID      string
+	Address string
+	Config  *config.Config
+	Cache   *cache.Manager
+	Peers   *network.PeerManager
+	Server  *network.TCPServer
+}
+
+// Cluster is a set of nodes that list each other as peers.
+type Cluster struct {
+	Nodes   []*Node
+	Network *Network
+	Clock   *Clock
+}
+
+// NewCluster starts size nodes named node-1 to node-size. Each starts from
+// the default configuration with replication and failover intervals cut
+// to fractions of a second; configure, if not nil, can change it further
+// before the node starts.
+func NewCluster(size int, configure func(cfg *config.Config)) (*Cluster, error) {
+	c := &Cluster{
+		Network: NewNetwork(),
+		Clock:   NewClock(time.Now()),
+	}
+
+	addresses := make([]string, size)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("node-%d:9090", i+1)
+	}
+
+	for i, address := range addresses {
+		cfg := config.Defaults()
+		cfg.NodeID = fmt.Sprintf("node-%d", i+1)
+		cfg.Region = "test"
+		for _, peer := range addresses {
+			if peer != address {
+				cfg.Peers = append(cfg.Peers, peer)
+			}
+		}
+		cfg.Replication.SyncIntervalMS = 100
+		cfg.Replication.HealthIntervalMS = 100
+		cfg.Replication.MinIntervalMS = 50
+		cfg.Replication.MaxIntervalMS = 200
+		cfg.Failover.DeadAfterMS = 1000
+		cfg.ExpirySweepIntervalMS = 50
+		if configure != nil {
+			configure(cfg)
+		}
+
+		node, err := c.start(cfg, address)
+		if err != nil {
+			c.Stop()
+			return nil, err
+		}
+		c.Nodes = append(c.Nodes, node)
+	}
+	return c, nil
+}
+
+func (c *Cluster) start(cfg *config.Config, address string) (*Node, error) {
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("%s: invalid config: %v", cfg.NodeID, problems)
+	}
+	listener, err := c.Network.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheManager := cache.NewManager(cfg.Region, cfg.NodeID)
+	cacheManager.SetClock(c.Clock.Now)
+	cacheManager.SetCapacity(cfg.CacheSize)
+	cacheManager.SetMemoryLimit(int64(cfg.MaxMemoryBytes))
+	cacheManager.EnableInvariantChecks()
+	if cfg.ExpirySweepIntervalMS > 0 {
+		cacheManager.StartJanitor(time.Duration(cfg.ExpirySweepIntervalMS) * time.Millisecond)
+	}
+
+	server := network.NewTCPServer(0, cacheManager)
+	go server.Serve(listener)
+
+	peerManager := network.NewPeerManager(cfg, cacheManager)
+	peerManager.SetDialer(c.Network.Dialer(address))
+	peerManager.Attach(server)
+	peerManager.Start()
+
+	return &Node{
+		ID:      cfg.NodeID,
+		Address: address,
+		Config:  cfg,
+		Cache:   cacheManager,
+		Peers:   peerManager,
+		Server:  server,
+	}, nil
+}
+
+// Node returns the node with the given ID, or nil.
+func (c *Cluster) Node(id string) *Node {
+	for _, node := range c.Nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// Others returns the addresses of every node but node.
+func (c *Cluster) Others(node *Node) []string {
+	var addresses []string
+	for _, other := range c.Nodes {
+		if other != node {
+			addresses = append(addresses, other.Address)
+		}
+	}
+	return addresses
+}
+
+// Isolate cuts node off from every other node.
+func (c *Cluster) Isolate(node *Node) {
+	c.Network.Isolate(node.Address, c.Others(node)...)
+}
+
+// Linked reports whether every node has a single link to every other
+// node, dialed by one end and accepted by the other.
+func (c *Cluster) Linked() bool {
+	type ends struct{ dialed, accepted int }
+	links := make(map[[2]string]*ends)
+	for _, node := range c.Nodes {
+		for _, other := range c.Nodes {
+			if node != other {
+				links[[2]string{node.ID, other.ID}] = &ends{}
+			}
+		}
+	}
+	for _, node := range c.Nodes {
+		for _, peer := range node.Peers.GetPeers() {
+			if !peer.Connected {
+				continue
+			}
+			link, ok := links[[2]string{node.ID, peer.NodeID}]
+			if !ok {
+				continue
+			}
+			if peer.Inbound {
+				link.accepted++
+			} else {
+				link.dialed++
+			}
+		}
+	}
+	for pair, link := range links {
+		back := links[[2]string{pair[1], pair[0]}]
+		if link.dialed+link.accepted != 1 || link.dialed != back.accepted {
+			return false
+		}
+	}
+	return true
+}
+
+// Values returns the value each node holds for key, by node ID. Nodes
+// without a live item are left out.
+func (c *Cluster) Values(key string) map[string]string {
+	values := make(map[string]string)
+	for _, node := range c.Nodes {
+		if item, err := node.Cache.Lookup(key); err == nil {
+			values[node.ID] = item.Value
+		}
+	}
+	return values
+}
+
+// Converged reports whether every node holds value for key.
+func (c *Cluster) Converged(key, value string) bool {
+	values := c.Values(key)
+	if len(values) != len(c.Nodes) {
+		return false
+	}
+	for _, v := range values {
+		if v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe renders the value each node holds for key, for failure
+// messages.
+func (c *Cluster) Describe(key string) string {
+	values := c.Values(key)
+	ids := make([]string, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		ids = append(ids, node.ID)
+	}
+	sort.Strings(ids)
+
+	description := ""
+	for _, id := range ids {
+		value, found := values[id]
+		if !found {
+			value = "<missing>"
+		}
+		description += fmt.Sprintf("%s=%q ", id, value)
+	}
+	return description
+}
+
+// CheckInvariants checks every node's cache invariants and returns the
+// violations, each prefixed with the node's ID.
+func (c *Cluster) CheckInvariants() []string {
+	var violations []string
+	for _, node := range c.Nodes {
+		for _, violation := range node.Cache.CheckInvariants() {
+			violations = append(violations, node.ID+": "+violation)
+		}
+	}
+	return violations
+}
+
+// Stop shuts every node down and closes its listener.
+func (c *Cluster) Stop() {
+	for _, node := range c.Nodes {
+		node.Peers.Stop()
+		node.Server.Stop()
+		node.Cache.StopJanitor()
+	}
+}
+
+// Eventually polls condition every 10ms until it holds or timeout passes,
+// and reports whether it held.
+func Eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
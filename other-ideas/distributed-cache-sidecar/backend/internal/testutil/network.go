@@ -0,0 +1,338 @@
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnreachable  = errors.New("connection refused")
+	errListenerDown = errors.New("listener closed")
+)
+
+// Network connects in-process nodes without sockets. Connections are
+// buffered in memory, so writers never wait for readers, and faults can
+// be injected between any two addresses: cutting a link closes its open
+// connections and refuses new ones until it is healed, and latency delays
+// every write.
+type Network struct {
+	mutex     sync.Mutex
+	listeners map[string]*memListener
+	conns     map[*memConn]struct{}
+	cut       map[link]bool
+	latency   time.Duration
+	// nextPort numbers the local ends of dialed connections, which like
+	// TCP ephemeral ports keep their addresses unique.
+	nextPort int
+}
+
+// link is an unordered pair of addresses.
+type link struct {
+	a, b string
+}
+
+func newLink(a, b string) link {
+	if b < a {
+		a, b = b, a
+	}
+	return link{a, b}
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		listeners: make(map[string]*memListener),
+		conns:     make(map[*memConn]struct{}),
+		cut:       make(map[link]bool),
+		nextPort:  40000,
+	}
+}
+
+// Listen returns a listener for address. Connections dialed to address
+// arrive on it until it is closed.
+func (n *Network) Listen(address string) (net.Listener, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, exists := n.listeners[address]; exists {
+		return nil, fmt.Errorf("%s is already in use", address)
+	}
+	listener := &memListener{
+		network: n,
+		address: address,
+		accepts: make(chan net.Conn, 16),
+		done:    make(chan struct{}),
+	}
+	n.listeners[address] = listener
+	return listener, nil
+}
+
+// Dialer returns a dial function for the node at from. It has the
+// signature of network.Dialer.
+func (n *Network) Dialer(from string) func(address string, timeout time.Duration) (net.Conn, error) {
+	return func(address string, timeout time.Duration) (net.Conn, error) {
+		return n.dial(from, address, timeout)
+	}
+}
+
+func (n *Network) dial(from, to string, timeout time.Duration) (net.Conn, error) {
+	n.mutex.Lock()
+	listener := n.listeners[to]
+	if listener == nil || n.cut[newLink(from, to)] {
+		n.mutex.Unlock()
+		return nil, fmt.Errorf("dial %s from %s: %w", to, from, ErrUnreachable)
+	}
+	host, _, err := net.SplitHostPort(from)
+	if err != nil {
+		host = from
+	}
+	n.nextPort++
+	local, remote := newMemConnPair(n, from, to, net.JoinHostPort(host, fmt.Sprint(n.nextPort)))
+	n.conns[local] = struct{}{}
+	n.conns[remote] = struct{}{}
+	n.mutex.Unlock()
+
+	select {
+	case listener.accepts <- remote:
+		return local, nil
+	case <-listener.done:
+	case <-time.After(timeout):
+	}
+	local.Close()
+	return nil, fmt.Errorf("dial %s from %s: %w", to, from, ErrUnreachable)
+}
+
+// Cut breaks the link between a and b: open connections between them are
+// closed and new ones refused until Heal.
+func (n *Network) Cut(a, b string) {
+	n.mutex.Lock()
+	n.cut[newLink(a, b)] = true
+	var closing []*memConn
+	for conn := range n.conns {
+		if newLink(conn.from, conn.to) == newLink(a, b) {
+			closing = append(closing, conn)
+		}
+	}
+	n.mutex.Unlock()
+
+	for _, conn := range closing {
+		conn.Close()
+	}
+}
+
+// Isolate cuts every link between address and the given others.
+func (n *Network) Isolate(address string, others ...string) {
+	for _, other := range others {
+		n.Cut(address, other)
+	}
+}
+
+// Heal restores the link between a and b. Nodes reconnect on their own.
+func (n *Network) Heal(a, b string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.cut, newLink(a, b))
+}
+
+// HealAll restores every link.
+func (n *Network) HealAll() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.cut = make(map[link]bool)
+}
+
+// SetLatency delays every write on the network by d.
+func (n *Network) SetLatency(d time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.latency = d
+}
+
+func (n *Network) currentLatency() time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.latency
+}
+
+func (n *Network) forget(conn *memConn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.conns, conn)
+}
+
+func (n *Network) closeListener(listener *memListener) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.listeners[listener.address] == listener {
+		delete(n.listeners, listener.address)
+	}
+}
+
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+type memListener struct {
+	network   *Network
+	address   string
+	accepts   chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepts:
+		return conn, nil
+	case <-l.done:
+		return nil, errListenerDown
+	}
+}
+
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.network.closeListener(l)
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr(l.address)
+}
+
+// pipe is one direction of a connection: an unbounded buffer with a read
+// deadline.
+type pipe struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	buffer   bytes.Buffer
+	closed   bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newPipe() *pipe {
+	p := &pipe{}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for p.buffer.Len() == 0 {
+		if p.closed {
+			return 0, io.EOF
+		}
+		if !p.deadline.IsZero() && !time.Now().Before(p.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		p.cond.Wait()
+	}
+	return p.buffer.Read(b)
+}
+
+func (p *pipe) write(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.buffer.Write(b)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *pipe) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+func (p *pipe) setDeadline(t time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.deadline = t
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if !t.IsZero() {
+		p.timer = time.AfterFunc(time.Until(t), func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			p.cond.Broadcast()
+		})
+	}
+	p.cond.Broadcast()
+}
+
+// memConn is one end of an in-memory connection between the nodes
+// listening at from and to.
+type memConn struct {
+	network    *Network
+	from, to   string
+	localAddr  memAddr
+	remoteAddr memAddr
+	in, out    *pipe
+	closeOnce  sync.Once
+}
+
+// newMemConnPair returns both ends of a connection dialed from the node
+// at from, whose end has the address ephemeral, to the listener at to.
+func newMemConnPair(n *Network, from, to, ephemeral string) (*memConn, *memConn) {
+	forward, backward := newPipe(), newPipe()
+	dialed := &memConn{network: n, from: from, to: to, localAddr: memAddr(ephemeral), remoteAddr: memAddr(to), in: backward, out: forward}
+	accepted := &memConn{network: n, from: from, to: to, localAddr: memAddr(to), remoteAddr: memAddr(ephemeral), in: forward, out: backward}
+	return dialed, accepted
+}
+
+func (c *memConn) Read(b []byte) (int, error) {
+	return c.in.read(b)
+}
+
+func (c *memConn) Write(b []byte) (int, error) {
+	if latency := c.network.currentLatency(); latency > 0 {
+		time.Sleep(latency)
+	}
+	return c.out.write(b)
+}
+
+// Close closes both directions, so the other end reads EOF once it has
+// read what was already written.
+func (c *memConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.in.close()
+		c.out.close()
+		c.network.forget(c)
+	})
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *memConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes never block.
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
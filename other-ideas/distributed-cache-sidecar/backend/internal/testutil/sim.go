@@ -0,0 +1,285 @@
+package testutil
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/patch"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The simulator runs the replication protocol's conflict resolution
+// without goroutines or sockets. A seeded scheduler picks every step:
+// a local set or patch on some node, the delivery of some in-flight
+// message (so messages arrive in any order), a drop or duplicate, or a
+// move of virtual time. Each node's clock is virtual time plus a fixed
+// skew. Messages are the SYNC and PATCH payloads the peer manager sends,
+// applied through the same cache.Manager entry points. After the last
+// step every message still in flight is delivered and the nodes must
+// hold identical items; the same seed always replays the same schedule.
+
+// SimOptions configure a simulated run. Zero values take the defaults
+// noted on each field.
+type SimOptions struct {
+	Seed  int64
+	Nodes int // default 3
+	Steps int // default 200
+	Keys  int // default 4
+	// DropRate and DuplicateRate are the chances that a scheduled
+	// delivery drops or duplicates the message instead. Replication has
+	// no catch-up for lost messages, so any drop can leave nodes
+	// divergent.
+	DropRate      float64
+	DuplicateRate float64
+	// MaxSkew bounds each node's clock offset from virtual time.
+	MaxSkew time.Duration
+	// Patches mixes JSON merge patches in with sets. A patch that races
+	// another write is rebased by the node holding the older one, so runs
+	// with patches must converge like runs without.
+	Patches bool
+}
+
+// SimResult is the outcome of one run. Trace lists every step taken, for
+// replaying a failure by hand.
+type SimResult struct {
+	Seed       int64
+	Delivered  int
+	Dropped    int
+	Duplicated int
+	Divergence []string
+	// Violations lists each node's broken cache invariants at the end.
+	Violations []string
+	Trace      []string
+}
+
+func (r *SimResult) Diverged() bool {
+	return len(r.Divergence) > 0
+}
+
+type simMessage struct {
+	from, to int
+	kind     string
+	payload  []byte
+}
+
+type simNode struct {
+	id      string
+	cache   *cache.Manager
+	changes <-chan cache.Event
+	skew    time.Duration
+}
+
+type simulation struct {
+	options  SimOptions
+	random   *rand.Rand
+	now      time.Time
+	nodes    []*simNode
+	inFlight []simMessage
+	result   *SimResult
+}
+
+// Simulate runs one seeded schedule.
+func Simulate(options SimOptions) *SimResult {
+	if options.Nodes <= 0 {
+		options.Nodes = 3
+	}
+	if options.Steps <= 0 {
+		options.Steps = 200
+	}
+	if options.Keys <= 0 {
+		options.Keys = 4
+	}
+
+	s := &simulation{
+		options: options,
+		random:  rand.New(rand.NewSource(options.Seed)),
+		now:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		result:  &SimResult{Seed: options.Seed},
+	}
+	for i := 0; i < options.Nodes; i++ {
+		node := &simNode{id: fmt.Sprintf("node-%d", i+1)}
+		if options.MaxSkew > 0 {
+			node.skew = time.Duration(s.random.Int63n(int64(2*options.MaxSkew))) - options.MaxSkew
+		}
+		node.cache = cache.NewManager("sim", node.id)
+		node.changes = node.cache.Subscribe("")
+		skew := node.skew
+		node.cache.SetClock(func() time.Time { return s.now.Add(skew) })
+		node.cache.EnableInvariantChecks()
+		s.nodes = append(s.nodes, node)
+	}
+
+	for step := 0; step < options.Steps; step++ {
+		s.step()
+	}
+	for len(s.inFlight) > 0 {
+		s.deliver(s.random.Intn(len(s.inFlight)), false)
+	}
+	s.compare()
+	for _, node := range s.nodes {
+		for _, violation := range node.cache.CheckInvariants() {
+			s.result.Violations = append(s.result.Violations, node.id+": "+violation)
+		}
+	}
+	return s.result
+}
+
+func (s *simulation) tracef(format string, args ...interface{}) {
+	s.result.Trace = append(s.result.Trace, fmt.Sprintf("%s "+format, append([]interface{}{s.now.Format("15:04:05.000000")}, args...)...))
+}
+
+func (s *simulation) step() {
+	switch roll := s.random.Intn(10); {
+	case roll < 3:
+		s.write()
+	case roll < 9 && len(s.inFlight) > 0:
+		s.deliver(s.random.Intn(len(s.inFlight)), true)
+	default:
+		d := time.Duration(s.random.Int63n(int64(50 * time.Millisecond)))
+		s.now = s.now.Add(d)
+		s.tracef("advance %v", d)
+	}
+}
+
+func (s *simulation) write() {
+	from := s.random.Intn(len(s.nodes))
+	node := s.nodes[from]
+	key := fmt.Sprintf("key-%d", s.random.Intn(s.options.Keys))
+	field := fmt.Sprintf("f%d", s.random.Intn(3))
+	value := s.random.Intn(1000)
+
+	if s.options.Patches && s.random.Intn(2) == 0 {
+		document := fmt.Sprintf(`{%q:%d}`, field, value)
+		_, err := node.cache.Patch(key, patch.TypeMergePatch, []byte(document))
+		s.tracef("%s patch %s %s: %v", node.id, key, document, err)
+	} else {
+		document := fmt.Sprintf(`{%q:%d}`, field, value)
+		err := node.cache.Set(key, document, 0)
+		s.tracef("%s set %s %s: %v", node.id, key, document, err)
+	}
+	s.collect(from)
+}
+
+// collect turns the updates a node queued for replication into messages
+// to every other node, like the peer manager's sender goroutines do. A
+// delivery can queue updates too, when the receiver rebases a patch.
+func (s *simulation) collect(from int) {
+	node := s.nodes[from]
+	for {
+		select {
+		case event := <-node.changes:
+			item := event.Item
+			payload, _ := node.cache.SerializeItem(item)
+			if item.Deleted() {
+				s.send(from, "DEL", payload)
+			} else {
+				s.send(from, "SYNC", payload)
+			}
+		case op := <-node.cache.GetPatchChannel():
+			payload, _ := node.cache.SerializePatch(op)
+			s.send(from, "PATCH", payload)
+		default:
+			return
+		}
+	}
+}
+
+func (s *simulation) send(from int, kind string, payload []byte) {
+	for to := range s.nodes {
+		if to != from {
+			s.inFlight = append(s.inFlight, simMessage{from: from, to: to, kind: kind, payload: payload})
+		}
+	}
+}
+
+// deliver applies the in-flight message at index i. With faults, it may
+// drop or duplicate it instead, as configured.
+func (s *simulation) deliver(i int, faults bool) {
+	message := s.inFlight[i]
+	s.inFlight = append(s.inFlight[:i], s.inFlight[i+1:]...)
+	from, to := s.nodes[message.from], s.nodes[message.to]
+
+	if faults && s.random.Float64() < s.options.DropRate {
+		s.result.Dropped++
+		s.tracef("drop %s %s->%s %s", message.kind, from.id, to.id, message.payload)
+		return
+	}
+	if faults && s.random.Float64() < s.options.DuplicateRate {
+		s.result.Duplicated++
+		s.inFlight = append(s.inFlight, message)
+	}
+
+	var applied bool
+	var err error
+	switch message.kind {
+	case "SYNC":
+		var item *cache.CacheItem
+		if item, err = to.cache.DeserializeItem(message.payload); err == nil {
+			applied, err = to.cache.SetRemote(item)
+		}
+	case "PATCH":
+		var op *cache.PatchOp
+		if op, err = to.cache.DeserializePatch(message.payload); err == nil {
+			applied, err = to.cache.ApplyRemotePatch(op)
+		}
+	case "DEL":
+		var item *cache.CacheItem
+		if item, err = to.cache.DeserializeItem(message.payload); err == nil {
+			applied, err = to.cache.RemoveRemote(item)
+		}
+	}
+	s.result.Delivered++
+	s.tracef("deliver %s %s->%s %s: applied=%v err=%v", message.kind, from.id, to.id, message.payload, applied, err)
+	s.collect(message.to)
+}
+
+// compare records every key whose items differ between nodes.
+func (s *simulation) compare() {
+	states := make([]map[string]*cache.CacheItem, len(s.nodes))
+	keys := make(map[string]bool)
+	for i, node := range s.nodes {
+		states[i] = make(map[string]*cache.CacheItem)
+		for _, item := range node.cache.GetAllItems() {
+			states[i][item.Key] = item
+			keys[item.Key] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		var held []string
+		agree := true
+		first := states[0][key]
+		for i, node := range s.nodes {
+			item := states[i][key]
+			held = append(held, fmt.Sprintf("%s=%s", node.id, describeSimItem(item)))
+			if !sameSimItem(first, item) {
+				agree = false
+			}
+		}
+		if !agree {
+			s.result.Divergence = append(s.result.Divergence, fmt.Sprintf("%s: %s", key, strings.Join(held, " ")))
+		}
+	}
+}
+
+func sameSimItem(a, b *cache.CacheItem) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Value == b.Value && a.Timestamp.Equal(b.Timestamp) && a.NodeID == b.NodeID
+}
+
+func describeSimItem(item *cache.CacheItem) string {
+	if item == nil {
+		return "<missing>"
+	}
+	return fmt.Sprintf("%s@%s/%s", item.Value, item.Timestamp.Format("15:04:05.000000"), item.NodeID)
+}
@@ -0,0 +1,44 @@
+package testutil_test
+
+import (
+	"distributed-cache-sidecar/internal/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSimulate runs the simulator in the configurations beyond the
+// simulation scenario's that must converge. Drops are left out: lost
+// messages aren't retransmitted, so runs with them may end divergent.
+func TestSimulate(t *testing.T) {
+	configs := []struct {
+		name    string
+		options testutil.SimOptions
+	}{
+		{"patches", testutil.SimOptions{DuplicateRate: 0.1, MaxSkew: 200 * time.Millisecond, Patches: true}},
+		{"five-nodes", testutil.SimOptions{Nodes: 5, Keys: 2, DuplicateRate: 0.1, MaxSkew: time.Second, Patches: true}},
+	}
+	for _, config := range configs {
+		config := config
+		t.Run(config.name, func(t *testing.T) {
+			for seed := int64(1); seed <= testutil.SimulationRuns; seed++ {
+				options := config.options
+				options.Seed = seed
+				result := testutil.Simulate(options)
+				if result.Diverged() {
+					t.Fatalf("seed %d diverged: %v\n%s", seed, result.Divergence, tail(result.Trace, 20))
+				}
+				if len(result.Violations) > 0 {
+					t.Fatalf("seed %d violated cache invariants: %v", seed, result.Violations)
+				}
+			}
+		})
+	}
+}
+
+func tail(trace []string, n int) string {
+	if len(trace) > n {
+		trace = trace[len(trace)-n:]
+	}
+	return strings.Join(trace, "\n")
+}
@@ -0,0 +1,242 @@
+package testutil
+
+import (
+	"distributed-cache-sidecar/internal/cache"
+	"distributed-cache-sidecar/internal/config"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// T is the part of *testing.T the scenarios use, so they run both from go
+// test and from the selftest command.
+type T interface {
+	Helper()
+	Logf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Scenario is a named integration check against a fresh cluster.
+type Scenario struct {
+	Name    string
+	Summary string
+	Run     func(t T)
+}
+
+// Scenarios is the integration suite.
+var Scenarios = []Scenario{
+	{"replication", "writes on any node reach every node", Replication},
+	{"last-writer-wins", "concurrent writes to one key converge on the latest", LastWriterWins},
+	{"partition-heal", "a cut-off node misses writes during a partition and relinks once it heals", PartitionHeal},
+	{"expiry", "items expire on every node when the clock passes their TTL and are then swept", Expiry},
+	{"failover", "the leader declares an isolated node dead and takes it back when it returns", Failover},
+	{"simulation", "seeded schedules of reordered, duplicated writes under clock skew converge", Simulation},
+}
+
+// SimulationRuns is how many seeds the simulation scenario tries.
+const SimulationRuns = 500
+
+// convergeTimeout bounds how long scenarios wait for replication.
+const convergeTimeout = 5 * time.Second
+
+// linkSettle is how long links must stay up before scenarios write. A
+// node whose dial was still in flight when the other end's link was
+// accepted replaces that link once the dial completes, and writes sent
+// on the replaced link are lost.
+const linkSettle = 200 * time.Millisecond
+
+// linked waits until every node is linked to every other one and has
+// stayed so for linkSettle.
+func linked(c *Cluster) bool {
+	return Eventually(convergeTimeout, func() bool {
+		if !c.Linked() {
+			return false
+		}
+		time.Sleep(linkSettle)
+		return c.Linked()
+	})
+}
+
+func startCluster(t T, size int, configure func(cfg *config.Config)) *Cluster {
+	t.Helper()
+	c, err := NewCluster(size, configure)
+	if err != nil {
+		t.Fatalf("starting cluster: %v", err)
+	}
+	if !linked(c) {
+		c.Stop()
+		t.Fatalf("nodes did not link within %v", convergeTimeout)
+	}
+	return c
+}
+
+// checkInvariants fails the scenario if any node's cache state is
+// inconsistent. Scenarios call it once they are done with the cluster.
+func checkInvariants(t T, c *Cluster) {
+	t.Helper()
+	if violations := c.CheckInvariants(); len(violations) > 0 {
+		t.Fatalf("cache invariants violated:\n    %s", strings.Join(violations, "\n    "))
+	}
+}
+
+func Replication(t T) {
+	c := startCluster(t, 3, nil)
+	defer c.Stop()
+
+	for i, node := range c.Nodes {
+		key := fmt.Sprintf("replication:%d", i)
+		if err := node.Cache.Set(key, node.ID, 0); err != nil {
+			t.Fatalf("set %s on %s: %v", key, node.ID, err)
+		}
+		if !Eventually(convergeTimeout, func() bool { return c.Converged(key, node.ID) }) {
+			t.Fatalf("%s did not replicate from %s: %s", key, node.ID, c.Describe(key))
+		}
+	}
+	checkInvariants(t, c)
+}
+
+func LastWriterWins(t T) {
+	c := startCluster(t, 3, nil)
+	defer c.Stop()
+
+	const key = "lww"
+	for round := 0; round < 5; round++ {
+		for _, node := range c.Nodes {
+			if err := node.Cache.Set(key, fmt.Sprintf("%s/%d", node.ID, round), 0); err != nil {
+				t.Fatalf("set on %s: %v", node.ID, err)
+			}
+		}
+	}
+
+	// The shared clock orders the writes, so the last one issued wins.
+	last := c.Nodes[len(c.Nodes)-1]
+	want := fmt.Sprintf("%s/%d", last.ID, 4)
+	if !Eventually(convergeTimeout, func() bool { return c.Converged(key, want) }) {
+		t.Fatalf("%s did not converge on %q: %s", key, want, c.Describe(key))
+	}
+	checkInvariants(t, c)
+}
+
+func PartitionHeal(t T) {
+	c := startCluster(t, 3, nil)
+	defer c.Stop()
+
+	cutOff := c.Nodes[2]
+	c.Isolate(cutOff)
+
+	const key = "partition"
+	if err := c.Nodes[0].Cache.Set(key, "written during partition", 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !Eventually(convergeTimeout, func() bool { return c.Values(key)[c.Nodes[1].ID] != "" }) {
+		t.Fatalf("%s did not reach %s: %s", key, c.Nodes[1].ID, c.Describe(key))
+	}
+	if value := c.Values(key)[cutOff.ID]; value != "" {
+		t.Fatalf("%s reached isolated %s", key, cutOff.ID)
+	}
+
+	// Replication is fire-and-forget with no catch-up on relinking, so
+	// the write made during the partition stays missing; only writes made
+	// after the partition heals are expected to arrive.
+	c.Network.HealAll()
+	if !linked(c) {
+		t.Fatalf("nodes did not relink within %v", convergeTimeout)
+	}
+	const healed = "partition:healed"
+	if err := c.Nodes[0].Cache.Set(healed, "written after healing", 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !Eventually(convergeTimeout, func() bool { return c.Converged(healed, "written after healing") }) {
+		t.Fatalf("%s did not reach every node after healing: %s", healed, c.Describe(healed))
+	}
+	checkInvariants(t, c)
+}
+
+func Expiry(t T) {
+	c := startCluster(t, 2, nil)
+	defer c.Stop()
+
+	const key = "expiry"
+	if err := c.Nodes[0].Cache.Set(key, "short-lived", 10); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !Eventually(convergeTimeout, func() bool { return c.Converged(key, "short-lived") }) {
+		t.Fatalf("%s did not replicate: %s", key, c.Describe(key))
+	}
+
+	c.Clock.Advance(9 * time.Second)
+	if !c.Converged(key, "short-lived") {
+		t.Fatalf("%s expired early: %s", key, c.Describe(key))
+	}
+
+	c.Clock.Advance(2 * time.Second)
+	for _, node := range c.Nodes {
+		// Until the janitor sweeps it, the item is still held but expired.
+		if _, err := node.Cache.Lookup(key); !errors.Is(err, cache.ErrExpired) && !errors.Is(err, cache.ErrNotFound) {
+			t.Fatalf("lookup of %s on %s after its TTL: got %v, want ErrExpired or ErrNotFound", key, node.ID, err)
+		}
+	}
+
+	swept := func() bool {
+		for _, node := range c.Nodes {
+			if stats := node.Cache.GetStats(); stats.TotalItems != 0 || stats.ExpiredCount != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !Eventually(convergeTimeout, swept) {
+		t.Fatalf("%s was not swept from every node", key)
+	}
+	checkInvariants(t, c)
+}
+
+func Simulation(t T) {
+	for seed := int64(1); seed <= SimulationRuns; seed++ {
+		result := Simulate(SimOptions{
+			Seed:          seed,
+			DuplicateRate: 0.1,
+			MaxSkew:       200 * time.Millisecond,
+		})
+		if result.Diverged() {
+			t.Fatalf("seed %d diverged: %v", seed, result.Divergence)
+		}
+		if len(result.Violations) > 0 {
+			t.Fatalf("seed %d violated cache invariants: %v", seed, result.Violations)
+		}
+	}
+}
+
+func Failover(t T) {
+	c := startCluster(t, 3, func(cfg *config.Config) {
+		cfg.Placement.Mode = "partitioned"
+	})
+	defer c.Stop()
+
+	leader, victim := c.Nodes[0], c.Nodes[2]
+	dead := func() bool {
+		for _, id := range leader.Peers.Topology().Dead {
+			if id == victim.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	c.Isolate(victim)
+	if !Eventually(10*time.Second, dead) {
+		t.Fatalf("%s was not declared dead: topology %+v", victim.ID, leader.Peers.Topology())
+	}
+	for _, id := range leader.Peers.Members() {
+		if id == victim.ID {
+			t.Fatalf("dead %s is still on the ring: %v", victim.ID, leader.Peers.Members())
+		}
+	}
+
+	c.Network.HealAll()
+	if !Eventually(10*time.Second, func() bool { return !dead() }) {
+		t.Fatalf("%s was not brought back: topology %+v", victim.ID, leader.Peers.Topology())
+	}
+	checkInvariants(t, c)
+}
@@ -0,0 +1,28 @@
+package testutil_test
+
+import (
+	"distributed-cache-sidecar/internal/testutil"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The nodes log every link and sync; selftest shows them only with -v.
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+func TestScenarios(t *testing.T) {
+	for _, scenario := range testutil.Scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			scenario.Run(t)
+		})
+	}
+}
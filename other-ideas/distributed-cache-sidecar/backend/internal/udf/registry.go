@@ -0,0 +1,190 @@
+package udf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+var (
+	ErrNotFound  = errors.New("udf not found")
+	ErrBadModule = errors.New("invalid udf module")
+)
+
+// Functions are plain WebAssembly modules with no imports. They must export
+// "memory", "alloc(len i32) i32" and "udf(ptr i32, len i32) i64"; udf
+// receives the JSON invocation input and returns (ptr << 32 | len) of its
+// output in linear memory.
+const (
+	allocExport = "alloc"
+	udfExport   = "udf"
+)
+
+type Info struct {
+	Name       string    `json:"name"`
+	Size       int       `json:"size"`
+	SHA256     string    `json:"sha256"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type function struct {
+	info     Info
+	compiled wazero.CompiledModule
+}
+
+type Registry struct {
+	runtime   wazero.Runtime
+	functions map[string]*function
+	timeout   time.Duration
+	mutex     sync.RWMutex
+}
+
+func NewRegistry(memoryLimitPages uint32, timeout time.Duration) *Registry {
+	ctx := context.Background()
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(memoryLimitPages).
+		WithCloseOnContextDone(true)
+
+	return &Registry{
+		runtime:   wazero.NewRuntimeWithConfig(ctx, cfg),
+		functions: make(map[string]*function),
+		timeout:   timeout,
+	}
+}
+
+func (r *Registry) Register(ctx context.Context, name string, wasm []byte) (Info, error) {
+	compiled, err := r.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrBadModule, err)
+	}
+	if len(compiled.ImportedFunctions()) > 0 {
+		compiled.Close(ctx)
+		return Info{}, fmt.Errorf("%w: host imports are not supported", ErrBadModule)
+	}
+	exports := compiled.ExportedFunctions()
+	for _, required := range []string{allocExport, udfExport} {
+		if _, ok := exports[required]; !ok {
+			compiled.Close(ctx)
+			return Info{}, fmt.Errorf("%w: missing export %q", ErrBadModule, required)
+		}
+	}
+
+	sum := sha256.Sum256(wasm)
+	fn := &function{
+		info: Info{
+			Name:       name,
+			Size:       len(wasm),
+			SHA256:     hex.EncodeToString(sum[:]),
+			UploadedAt: time.Now(),
+		},
+		compiled: compiled,
+	}
+
+	r.mutex.Lock()
+	previous := r.functions[name]
+	r.functions[name] = fn
+	r.mutex.Unlock()
+
+	if previous != nil {
+		previous.compiled.Close(ctx)
+	}
+	return fn.info, nil
+}
+
+func (r *Registry) Remove(ctx context.Context, name string) bool {
+	r.mutex.Lock()
+	fn, exists := r.functions[name]
+	delete(r.functions, name)
+	r.mutex.Unlock()
+
+	if exists {
+		fn.compiled.Close(ctx)
+	}
+	return exists
+}
+
+func (r *Registry) Lookup(name string) (Info, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	fn, exists := r.functions[name]
+	if !exists {
+		return Info{}, false
+	}
+	return fn.info, true
+}
+
+func (r *Registry) List() []Info {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	infos := make([]Info, 0, len(r.functions))
+	for _, fn := range r.functions {
+		infos = append(infos, fn.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Invoke runs the named function against input in a fresh module instance,
+// so invocations never share memory and a trapped call leaves no state
+// behind.
+func (r *Registry) Invoke(ctx context.Context, name string, input []byte) ([]byte, error) {
+	r.mutex.RLock()
+	fn, exists := r.functions[name]
+	r.mutex.RUnlock()
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	mod, err := r.runtime.InstantiateModule(ctx, fn.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate udf %s: %v", name, err)
+	}
+	defer mod.Close(ctx)
+
+	return call(ctx, mod, input)
+}
+
+func call(ctx context.Context, mod api.Module, input []byte) ([]byte, error) {
+	memory := mod.Memory()
+	if memory == nil {
+		return nil, fmt.Errorf("%w: module does not export memory", ErrBadModule)
+	}
+
+	results, err := mod.ExportedFunction(allocExport).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("udf alloc failed: %v", err)
+	}
+	inPtr := uint32(results[0])
+	if !memory.Write(inPtr, input) {
+		return nil, fmt.Errorf("udf alloc returned out of range pointer %d", inPtr)
+	}
+
+	results, err = mod.ExportedFunction(udfExport).Call(ctx, uint64(inPtr), uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("udf execution failed: %v", err)
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := memory.Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("udf returned out of range result (%d, %d)", outPtr, outLen)
+	}
+	return append([]byte(nil), output...), nil
+}
+
+func (r *Registry) Close(ctx context.Context) error {
+	return r.runtime.Close(ctx)
+}
@@ -0,0 +1,978 @@
+// Package client is the Go SDK for the cache sidecar. It fetches the
+// cluster topology, hashes keys onto the same ring as the sidecar and sends
+// each request straight to the key's owner, failing over to the next nodes
+// on the ring when the owner is unhealthy.
+package client
+
+import (
+	"bytes"
+	"context"
+	"distributed-cache-sidecar/pkg/ring"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("key not found")
+	ErrConflict        = errors.New("conflicting update")
+	ErrVersionMismatch = errors.New("version does not match")
+	ErrTooLarge        = errors.New("request too large")
+	ErrNotOwner        = errors.New("node does not own the key")
+	ErrNoNodes         = errors.New("no reachable cache nodes")
+	ErrNoTopology      = errors.New("failed to fetch topology from any seed")
+	errRetryableCall   = errors.New("retryable")
+)
+
+type Item struct {
+	Key       string            `json:"key"`
+	Value     string            `json:"value"`
+	Region    string            `json:"region"`
+	NodeID    string            `json:"node_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	TTL       int64             `json:"ttl"`
+	Encoding  string            `json:"encoding,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Version   uint64            `json:"version"`
+	Sliding   bool              `json:"sliding,omitempty"`
+	MaxReads  int64             `json:"max_reads,omitempty"`
+	Touched   *time.Time        `json:"touched,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	// ExpiresAt and RemainingTTL, in seconds, are nil and 0 for items
+	// without a TTL.
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RemainingTTL int64      `json:"remaining_ttl,omitempty"`
+
+	// Degraded is set when the serving node was cut off from too many of
+	// its peers; Staleness is how long it had been missing updates.
+	Degraded  bool          `json:"-"`
+	Staleness time.Duration `json:"-"`
+}
+
+// binaryEncodings are the encodings whose values the sidecar carries
+// base64-encoded.
+var binaryEncodings = map[string]bool{"binary": true, "msgpack": true, "protobuf": true}
+
+// Bytes returns the item's payload, decoding the base64 that binary
+// encodings are carried in.
+func (i *Item) Bytes() ([]byte, error) {
+	if binaryEncodings[i.Encoding] {
+		return base64.StdEncoding.DecodeString(i.Value)
+	}
+	return []byte(i.Value), nil
+}
+
+// DecodeJSON unmarshals a value stored with the json encoding into v.
+func (i *Item) DecodeJSON(v interface{}) error {
+	if i.Encoding != "json" {
+		return fmt.Errorf("value of %s has encoding %q, not json", i.Key, i.Encoding)
+	}
+	return json.Unmarshal([]byte(i.Value), v)
+}
+
+// Node is a cluster member. Weight scales its share of the ring; nodes
+// that don't report one have weight 1.
+type Node struct {
+	NodeID    string  `json:"node_id"`
+	Region    string  `json:"region"`
+	Zone      string  `json:"zone,omitempty"`
+	Group     string  `json:"group,omitempty"`
+	URL       string  `json:"url"`
+	Connected bool    `json:"connected"`
+	Weight    float64 `json:"weight,omitempty"`
+}
+
+// Topology is the cluster as seen by the node that served it. Version
+// increases whenever the cluster leader fails a node over or brings it
+// back.
+type Topology struct {
+	Epoch     string    `json:"epoch"`
+	Version   uint64    `json:"version"`
+	VNodes    int       `json:"vnodes"`
+	Nodes     []Node    `json:"nodes"`
+	Placement Placement `json:"placement"`
+}
+
+// Placement holds the parts of the cluster's placement settings clients
+// route by. PrefixGroups dedicates keys starting with a prefix to the
+// nodes of a group.
+type Placement struct {
+	PrefixGroups map[string]string `json:"prefix_groups,omitempty"`
+}
+
+type Options struct {
+	HTTPClient *http.Client
+	// RefreshInterval is how often the topology is re-fetched. It is also
+	// re-fetched whenever every candidate node for a key fails.
+	RefreshInterval time.Duration
+	// MaxAttempts bounds how many nodes are tried per operation.
+	MaxAttempts int
+	// BaseBackoff is how long a node is skipped after its first failure;
+	// it doubles per consecutive failure up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// NearCacheTTL, when set, keeps items Get returns in process for up
+	// to that long, so repeated reads of a hot key skip the network.
+	// Writes through this client drop the key at once; other clients'
+	// writes show up when the entry expires. NearCacheSize bounds the
+	// items held, 10000 by default.
+	NearCacheTTL  time.Duration
+	NearCacheSize int
+}
+
+type nodeHealth struct {
+	failures  int
+	downUntil time.Time
+}
+
+type Client struct {
+	seeds   []string
+	options Options
+
+	topology  Topology
+	ring      *ring.Ring
+	byID      map[string]Node
+	fetchedAt time.Time
+	health    map[string]*nodeHealth
+	near      *nearCache
+	mutex     sync.RWMutex
+}
+
+func New(seeds []string, options Options) *Client {
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = 30 * time.Second
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 3
+	}
+	if options.BaseBackoff <= 0 {
+		options.BaseBackoff = time.Second
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = 30 * time.Second
+	}
+	if options.NearCacheSize <= 0 {
+		options.NearCacheSize = 10000
+	}
+
+	trimmed := make([]string, 0, len(seeds))
+	for _, seed := range seeds {
+		trimmed = append(trimmed, strings.TrimRight(seed, "/"))
+	}
+	return &Client{
+		seeds:   trimmed,
+		options: options,
+		ring:    ring.New(nil, 0),
+		byID:    make(map[string]Node),
+		health:  make(map[string]*nodeHealth),
+		near:    newNearCache(options.NearCacheTTL, options.NearCacheSize),
+	}
+}
+
+// Refresh fetches the topology from the first seed or known node that
+// answers.
+func (c *Client) Refresh(ctx context.Context) error {
+	return c.fetchTopology(ctx, "")
+}
+
+// Watch keeps the topology current until ctx is done, long-polling for
+// topology version changes so that failovers reach the client as they
+// happen rather than at the next refresh. Run it in its own goroutine; it
+// returns ctx's error.
+func (c *Client) Watch(ctx context.Context) error {
+	wait := 25 * time.Second
+	if timeout := c.options.HTTPClient.Timeout; timeout > 0 && timeout-time.Second < wait {
+		wait = timeout / 2
+		if timeout > 2*time.Second {
+			wait = timeout - time.Second
+		}
+	}
+
+	backoff := c.options.BaseBackoff
+	for ctx.Err() == nil {
+		query := fmt.Sprintf("?watch=%d&timeout_ms=%d", c.Topology().Version, wait.Milliseconds())
+		if err := c.fetchTopology(ctx, query); err == nil {
+			backoff = c.options.BaseBackoff
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+	return ctx.Err()
+}
+
+// fetchTopology fetches /api/topology with query from the first seed or
+// known node that answers.
+func (c *Client) fetchTopology(ctx context.Context, query string) error {
+	c.mutex.RLock()
+	candidates := append([]string(nil), c.seeds...)
+	for _, node := range c.topology.Nodes {
+		candidates = append(candidates, node.URL)
+	}
+	c.mutex.RUnlock()
+
+	for _, base := range candidates {
+		var topology Topology
+		if err := c.getJSON(ctx, base+"/api/topology"+query, &topology); err != nil {
+			continue
+		}
+
+		ids := make([]string, 0, len(topology.Nodes))
+		weights := make(map[string]float64, len(topology.Nodes))
+		groups := make(map[string]string, len(topology.Nodes))
+		byID := make(map[string]Node, len(topology.Nodes))
+		for _, node := range topology.Nodes {
+			ids = append(ids, node.NodeID)
+			weights[node.NodeID] = node.Weight
+			groups[node.NodeID] = node.Group
+			byID[node.NodeID] = node
+		}
+
+		c.mutex.Lock()
+		if topology.Epoch != c.topology.Epoch {
+			c.ring = ring.NewWeighted(ids, weights, topology.VNodes)
+			if len(topology.Placement.PrefixGroups) > 0 {
+				c.ring = c.ring.WithGroups(groups, topology.Placement.PrefixGroups)
+			}
+		}
+		c.topology = topology
+		c.byID = byID
+		c.fetchedAt = time.Now()
+		c.mutex.Unlock()
+		return nil
+	}
+	return ErrNoTopology
+}
+
+func (c *Client) Topology() Topology {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.topology
+}
+
+// Owners returns the nodes that would be tried for key, in order.
+func (c *Client) Owners(key string) []Node {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ids := c.ring.Owners(key, len(c.topology.Nodes))
+	nodes := make([]Node, 0, len(ids))
+	for _, id := range ids {
+		nodes = append(nodes, c.byID[id])
+	}
+	return nodes
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*Item, error) {
+	if item, ok := c.near.get(key, time.Now()); ok {
+		return item, nil
+	}
+	generation := c.near.generation()
+
+	var item Item
+	err := c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, itemURL(base, key), nil)
+		if err != nil {
+			return err
+		}
+		header, err := c.exchange(req, &item)
+		if err != nil {
+			return err
+		}
+		if header.Get("X-Cache-Degraded") == "true" {
+			item.Degraded = true
+			seconds, _ := strconv.Atoi(header.Get("X-Cache-Staleness"))
+			item.Staleness = time.Duration(seconds) * time.Second
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.near.put(key, &item, generation, time.Now())
+	return &item, nil
+}
+
+// GetMany reads keys in one request per owning node and returns the
+// items found by key; missing keys are left out. Keys a node reports it
+// can't read fail the call.
+func (c *Client) GetMany(ctx context.Context, keys []string) (map[string]*Item, error) {
+	byOwner := make(map[string][]string)
+	for _, key := range keys {
+		owner := ""
+		if owners := c.Owners(key); len(owners) > 0 {
+			owner = owners[0].NodeID
+		}
+		byOwner[owner] = append(byOwner[owner], key)
+	}
+
+	found := make(map[string]*Item, len(keys))
+	for _, group := range byOwner {
+		body, err := json.Marshal(map[string][]string{"keys": group})
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Items  map[string]*Item  `json:"items"`
+			Errors map[string]string `json:"errors"`
+		}
+		err = c.do(ctx, group[0], func(base string) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/cache:batchGet", bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			return c.send(req, &result)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for key, message := range result.Errors {
+			return nil, fmt.Errorf("reading %s: %s", key, message)
+		}
+		for key, item := range result.Items {
+			found[key] = item
+		}
+	}
+	return found, nil
+}
+
+// SetMany stores every value in values, by key, with the given TTL in one
+// request, or none of them if any can't be stored. Readers of the node it
+// is sent to never see some of the values without the others.
+func (c *Client) SetMany(ctx context.Context, values map[string]string, ttl time.Duration) error {
+	type entry struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		TTL   int64  `json:"ttl"`
+	}
+	items := make([]entry, 0, len(values))
+	for key, value := range values {
+		items = append(items, entry{Key: key, Value: value, TTL: int64(ttl / time.Second)})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	defer func() {
+		for key := range values {
+			c.near.forget(key)
+		}
+	}()
+	body, err := json.Marshal(map[string][]entry{"items": items})
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, items[0].Key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/cache:batchSet", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.send(req, nil)
+	})
+}
+
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.set(ctx, key, map[string]interface{}{
+		"value": value,
+		"ttl":   int64(ttl / time.Second),
+	})
+}
+
+// GetOrSet returns the item under key, first setting it to value if it
+// is missing, and reports whether it existed. Clients racing to fill a
+// missing key all get the value the first of them stored, so they can
+// compute a value once and keep whichever won.
+func (c *Client) GetOrSet(ctx context.Context, key, value string, ttl time.Duration) (*Item, bool, error) {
+	var result struct {
+		Existed bool `json:"existed"`
+		Item    Item `json:"item"`
+	}
+	err := c.post(ctx, key, "/getorset", map[string]interface{}{
+		"value": value,
+		"ttl":   int64(ttl / time.Second),
+	}, &result)
+	if err != nil {
+		return nil, false, err
+	}
+	return &result.Item, result.Existed, nil
+}
+
+// SetSliding sets key with a sliding TTL, which restarts whenever the key
+// is read or touched, as suits session data.
+func (c *Client) SetSliding(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.set(ctx, key, map[string]interface{}{
+		"value":   value,
+		"ttl":     int64(ttl / time.Second),
+		"sliding": true,
+	})
+}
+
+// SetMaxReads sets key to a value that is deleted on every node once it
+// has been read maxReads times, such as a one-time token.
+func (c *Client) SetMaxReads(ctx context.Context, key, value string, ttl time.Duration, maxReads int64) error {
+	return c.set(ctx, key, map[string]interface{}{
+		"value":     value,
+		"ttl":       int64(ttl / time.Second),
+		"max_reads": maxReads,
+	})
+}
+
+// SetTagged sets key to value carrying tags, so that InvalidateTag of any
+// of them deletes it.
+func (c *Client) SetTagged(ctx context.Context, key, value string, ttl time.Duration, tags ...string) error {
+	return c.set(ctx, key, map[string]interface{}{
+		"value": value,
+		"ttl":   int64(ttl / time.Second),
+		"tags":  tags,
+	})
+}
+
+// SetJSON sets key to the JSON encoding of v, stored with the json
+// encoding rather than as a string holding JSON.
+func (c *Client) SetJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	document, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.set(ctx, key, map[string]interface{}{
+		"value":    json.RawMessage(document),
+		"encoding": "json",
+		"ttl":      int64(ttl / time.Second),
+	})
+}
+
+// SetBytes sets key to an opaque binary value.
+func (c *Client) SetBytes(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.set(ctx, key, map[string]interface{}{
+		"value":    base64.StdEncoding.EncodeToString(value),
+		"encoding": "binary",
+		"ttl":      int64(ttl / time.Second),
+	})
+}
+
+// CompareAndSet sets key only if it is still at version, as read in
+// Item.Version, and returns the new version. It fails with
+// ErrVersionMismatch when the key has changed or is gone.
+func (c *Client) CompareAndSet(ctx context.Context, key, value string, ttl time.Duration, version uint64) (uint64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"value": value,
+		"ttl":   int64(ttl / time.Second),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Version uint64 `json:"version"`
+	}
+	defer c.near.forget(key)
+	err = c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, itemURL(base, key), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", strconv.Quote(strconv.FormatUint(version, 10)))
+		return c.send(req, &result)
+	})
+	return result.Version, err
+}
+
+func (c *Client) set(ctx context.Context, key string, request map[string]interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	defer c.near.forget(key)
+
+	return c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, itemURL(base, key), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.send(req, nil)
+	})
+}
+
+// Incr adds delta, which may be negative, to the counter under key and
+// returns its new value. A missing key counts from 0. Requests go to the
+// key's owner so that increments from every client apply on one node; an
+// increment retried on another node after a failure may apply twice.
+func (c *Client) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	var result struct {
+		Value int64 `json:"value"`
+	}
+	err := c.post(ctx, key, "/incr", map[string]int64{"delta": delta}, &result)
+	return result.Value, err
+}
+
+// ListPush appends values to the tail of the list under key, or to its head
+// if left is set, creating the list if needed, and returns its new length.
+func (c *Client) ListPush(ctx context.Context, key string, left bool, values ...string) (int, error) {
+	path := "/rpush"
+	if left {
+		path = "/lpush"
+	}
+	var result struct {
+		Length int `json:"length"`
+	}
+	err := c.post(ctx, key, path, map[string][]string{"values": values}, &result)
+	return result.Length, err
+}
+
+// ListPop removes and returns up to count values from the tail of the list
+// under key, or from its head if left is set. Like Incr, a pop retried on
+// another node after a failure may remove values twice.
+func (c *Client) ListPop(ctx context.Context, key string, left bool, count int) ([]string, error) {
+	path := "/rpop"
+	if left {
+		path = "/lpop"
+	}
+	var result struct {
+		Values []string `json:"values"`
+	}
+	err := c.post(ctx, key, path, map[string]int{"count": count}, &result)
+	return result.Values, err
+}
+
+// ListRange returns the values of the list under key from start to stop,
+// inclusive; negative indexes count from the end.
+func (c *Client) ListRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	var result struct {
+		Values []string `json:"values"`
+	}
+	err := c.do(ctx, key, func(base string) error {
+		return c.getJSON(ctx, fmt.Sprintf("%s/list?start=%d&stop=%d", itemURL(base, key), start, stop), &result)
+	})
+	return result.Values, err
+}
+
+// SetAdd adds members to the set under key, creating it if needed, and
+// returns how many weren't in it yet.
+func (c *Client) SetAdd(ctx context.Context, key string, members ...string) (int, error) {
+	var result struct {
+		Added int `json:"added"`
+	}
+	err := c.post(ctx, key, "/sadd", map[string][]string{"members": members}, &result)
+	return result.Added, err
+}
+
+// SetRemove removes members from the set under key and returns how many
+// were in it.
+func (c *Client) SetRemove(ctx context.Context, key string, members ...string) (int, error) {
+	var result struct {
+		Removed int `json:"removed"`
+	}
+	err := c.post(ctx, key, "/srem", map[string][]string{"members": members}, &result)
+	return result.Removed, err
+}
+
+// SetMembers returns the members of the set under key in sorted order.
+func (c *Client) SetMembers(ctx context.Context, key string) ([]string, error) {
+	var result struct {
+		Members []string `json:"members"`
+	}
+	err := c.do(ctx, key, func(base string) error {
+		return c.getJSON(ctx, itemURL(base, key)+"/members", &result)
+	})
+	return result.Members, err
+}
+
+// SetContains reports whether member is in the set under key; a missing
+// key is an empty set.
+func (c *Client) SetContains(ctx context.Context, key, member string) (bool, error) {
+	var result struct {
+		Contains bool `json:"contains"`
+	}
+	err := c.do(ctx, key, func(base string) error {
+		return c.getJSON(ctx, itemURL(base, key)+"/members?member="+url.QueryEscape(member), &result)
+	})
+	return result.Contains, err
+}
+
+// HashSet sets fields of the hash under key, creating it if needed, and
+// returns how many of them are new.
+func (c *Client) HashSet(ctx context.Context, key string, fields map[string]string) (int, error) {
+	var result struct {
+		Added int `json:"added"`
+	}
+	err := c.post(ctx, key, "/hset", map[string]map[string]string{"fields": fields}, &result)
+	return result.Added, err
+}
+
+// HashDelete removes fields from the hash under key and returns how many
+// it held.
+func (c *Client) HashDelete(ctx context.Context, key string, fields ...string) (int, error) {
+	var result struct {
+		Removed int `json:"removed"`
+	}
+	err := c.post(ctx, key, "/hdel", map[string][]string{"fields": fields}, &result)
+	return result.Removed, err
+}
+
+// HashGet returns the named fields the hash under key holds, or all of
+// them when no names are given.
+func (c *Client) HashGet(ctx context.Context, key string, names ...string) (map[string]string, error) {
+	query := url.Values{"field": names}
+	var result struct {
+		Fields map[string]string `json:"fields"`
+	}
+	err := c.do(ctx, key, func(base string) error {
+		return c.getJSON(ctx, itemURL(base, key)+"/fields?"+query.Encode(), &result)
+	})
+	return result.Fields, err
+}
+
+// SetLarge stores everything read from r under key as a large object,
+// uploaded in parts of partSize bytes, so no request carries the whole
+// value. Read it back with GetLarge.
+func (c *Client) SetLarge(ctx context.Context, key string, r io.Reader, partSize int, ttl time.Duration) error {
+	if partSize <= 0 {
+		return fmt.Errorf("part size must be positive, got %d", partSize)
+	}
+	var upload struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := c.post(ctx, key, "/uploads", struct{}{}, &upload); err != nil {
+		return err
+	}
+
+	seconds := int64(ttl / time.Second)
+	buffer := make([]byte, partSize)
+	var parts []int
+	for {
+		n, err := io.ReadFull(r, buffer)
+		if n > 0 {
+			part := len(parts) + 1
+			path := fmt.Sprintf("/uploads/%s/parts/%d?ttl=%d", upload.UploadID, part, seconds)
+			data := buffer[:n]
+			if err := c.do(ctx, key, func(base string) error {
+				req, err := http.NewRequestWithContext(ctx, http.MethodPut, itemURL(base, key)+path, bytes.NewReader(data))
+				if err != nil {
+					return err
+				}
+				req.Header.Set("Content-Type", "application/octet-stream")
+				return c.send(req, nil)
+			}); err != nil {
+				return err
+			}
+			parts = append(parts, part)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("nothing to upload to %s", key)
+	}
+
+	return c.post(ctx, key, "/uploads/"+upload.UploadID+"/complete", map[string]interface{}{
+		"parts": parts,
+		"ttl":   seconds,
+	}, nil)
+}
+
+// GetLarge returns a reader streaming the large object under key, which
+// the caller must close.
+func (c *Client) GetLarge(ctx context.Context, key string) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, itemURL(base, key), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.open(req)
+		if err != nil {
+			return err
+		}
+		body = resp.Body
+		return nil
+	})
+	return body, err
+}
+
+// GetRange returns length bytes of the value under key from offset, as
+// the value is served raw: a binary value's bytes, a large object's
+// contents or a JSON document's text. A range past the end is cut short.
+func (c *Client) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	var data []byte
+	err := c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, itemURL(base, key), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		resp, err := c.open(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("range of %s not served: %s", key, resp.Status)
+		}
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return data, err
+}
+
+// post sends request to the item operation at path under key.
+func (c *Client) post(ctx context.Context, key, path string, request, out interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	defer c.near.forget(key)
+
+	return c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, itemURL(base, key)+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.send(req, out)
+	})
+}
+
+// Touch restarts key's TTL without reading it.
+func (c *Client) Touch(ctx context.Context, key string) error {
+	return c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, itemURL(base, key)+"/touch", nil)
+		if err != nil {
+			return err
+		}
+		return c.send(req, nil)
+	})
+}
+
+// Expire gives key a TTL of ttl from now without sending its value again.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.post(ctx, key, "/expire", map[string]interface{}{"ttl": int64(ttl / time.Second)}, nil)
+}
+
+// Persist removes key's TTL, keeping it until it is deleted or evicted.
+func (c *Client) Persist(ctx context.Context, key string) error {
+	return c.post(ctx, key, "/persist", map[string]interface{}{}, nil)
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	defer c.near.forget(key)
+	return c.do(ctx, key, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, itemURL(base, key), nil)
+		if err != nil {
+			return err
+		}
+		return c.send(req, nil)
+	})
+}
+
+// InvalidateTag deletes every item carrying tag on every node, and returns
+// how many the node that took the request held.
+func (c *Client) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	defer c.near.forgetTag(tag)
+	// Any node can take the request; the tag picks which one.
+	err := c.do(ctx, tag, func(base string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, base+"/api/tags/"+url.PathEscape(tag), nil)
+		if err != nil {
+			return err
+		}
+		return c.send(req, &result)
+	})
+	return result.Deleted, err
+}
+
+// do runs call against the key's owner and then its replicas until one
+// succeeds or returns a non-retryable error. Nodes in backoff are tried
+// last rather than skipped, so a fully degraded cluster is still usable.
+func (c *Client) do(ctx context.Context, key string, call func(base string) error) error {
+	c.mutex.RLock()
+	stale := time.Since(c.fetchedAt) > c.options.RefreshInterval
+	c.mutex.RUnlock()
+	if stale {
+		if err := c.Refresh(ctx); err != nil && len(c.Topology().Nodes) == 0 {
+			return err
+		}
+	}
+
+	lastErr := ErrNoNodes
+	for round := 0; round < 2; round++ {
+		attempts := 0
+		for _, node := range c.candidates(key) {
+			if attempts >= c.options.MaxAttempts {
+				break
+			}
+			attempts++
+
+			err := call(node.URL)
+			if err == nil {
+				c.markHealthy(node.NodeID)
+				return nil
+			}
+			if errors.Is(err, ErrNotOwner) {
+				// The node is fine but the topology is stale; try the
+				// next candidate and refresh if none of them owns it.
+				c.markHealthy(node.NodeID)
+				lastErr = err
+				continue
+			}
+			if !errors.Is(err, errRetryableCall) {
+				c.markHealthy(node.NodeID)
+				return err
+			}
+			c.markFailed(node.NodeID)
+			lastErr = err
+		}
+
+		// Every candidate failed: the topology may have changed.
+		if round == 0 {
+			if err := c.Refresh(ctx); err != nil {
+				break
+			}
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) candidates(key string) []Node {
+	owners := c.Owners(key)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	healthy := make([]Node, 0, len(owners))
+	var down []Node
+	for _, node := range owners {
+		if h := c.health[node.NodeID]; h != nil && now.Before(h.downUntil) {
+			down = append(down, node)
+		} else {
+			healthy = append(healthy, node)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (c *Client) markHealthy(nodeID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.health, nodeID)
+}
+
+func (c *Client) markFailed(nodeID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	h := c.health[nodeID]
+	if h == nil {
+		h = &nodeHealth{}
+		c.health[nodeID] = h
+	}
+	h.failures++
+
+	backoff := c.options.BaseBackoff
+	for i := 1; i < h.failures && backoff < c.options.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.options.MaxBackoff {
+		backoff = c.options.MaxBackoff
+	}
+	h.downUntil = time.Now().Add(backoff)
+}
+
+// send performs req and decodes a JSON response into out. Transport errors
+// and 5xx responses are retryable on another node, and 421 (not the owner)
+// moves on to the next one; other failures are not retried.
+func (c *Client) send(req *http.Request, out interface{}) error {
+	_, err := c.exchange(req, out)
+	return err
+}
+
+// exchange is send that also returns the response headers.
+func (c *Client) exchange(req *http.Request, out interface{}) (http.Header, error) {
+	resp, err := c.open(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// open sends req and returns the response for the caller to read and
+// close, or the error a failed one stands for.
+func (c *Client) open(req *http.Request) (*http.Response, error) {
+	resp, err := c.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errRetryableCall, err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return nil, responseError(ErrConflict, resp)
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return nil, responseError(ErrVersionMismatch, resp)
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return nil, responseError(ErrTooLarge, resp)
+	case resp.StatusCode == http.StatusMisdirectedRequest:
+		return nil, responseError(ErrNotOwner, resp)
+	case resp.StatusCode >= 500:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: %s: %s", errRetryableCall, resp.Status, strings.TrimSpace(string(body)))
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// responseError wraps sentinel with the status and body of resp.
+func responseError(sentinel error, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%w: %s: %s", sentinel, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (c *Client) getJSON(ctx context.Context, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	return c.send(req, out)
+}
+
+func itemURL(base, key string) string {
+	return base + "/api/cache/" + url.PathEscape(key)
+}
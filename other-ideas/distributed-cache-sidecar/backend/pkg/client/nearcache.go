@@ -0,0 +1,128 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// nearCache holds items Get returned, in process, for Options.NearCacheTTL.
+// A nil nearCache holds nothing, so clients without one need no checks.
+type nearCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]nearEntry
+	// writes counts forgotten keys, so a read that raced a write can tell
+	// its item may predate it and leave it out.
+	writes uint64
+	mutex  sync.Mutex
+}
+
+type nearEntry struct {
+	item    Item
+	expires time.Time
+}
+
+func newNearCache(ttl time.Duration, size int) *nearCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &nearCache{ttl: ttl, size: size, entries: make(map[string]nearEntry)}
+}
+
+// get returns a copy of the item held under key, if it hasn't expired.
+func (n *nearCache) get(key string, now time.Time) (*Item, bool) {
+	if n == nil {
+		return nil, false
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	entry, ok := n.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expires) {
+		delete(n.entries, key)
+		return nil, false
+	}
+	item := entry.item
+	return &item, true
+}
+
+// generation is passed back to put to detect writes made since.
+func (n *nearCache) generation() uint64 {
+	if n == nil {
+		return 0
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.writes
+}
+
+// put holds item until the near cache's TTL or the item's own expiry,
+// whichever is sooner, unless a key was forgotten since generation.
+// Items whose reads change them on the node, sliding and read-limited
+// ones, and degraded reads are never held.
+func (n *nearCache) put(key string, item *Item, generation uint64, now time.Time) {
+	if n == nil || item.Sliding || item.MaxReads > 0 || item.Degraded {
+		return
+	}
+	expires := now.Add(n.ttl)
+	if item.ExpiresAt != nil && item.ExpiresAt.Before(expires) {
+		expires = *item.ExpiresAt
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.writes != generation {
+		return
+	}
+	if _, ok := n.entries[key]; !ok && len(n.entries) >= n.size {
+		n.evict(now)
+	}
+	n.entries[key] = nearEntry{item: *item, expires: expires}
+}
+
+// evict drops expired entries, or an arbitrary one if none have expired.
+func (n *nearCache) evict(now time.Time) {
+	for key, entry := range n.entries {
+		if !now.Before(entry.expires) {
+			delete(n.entries, key)
+		}
+	}
+	if len(n.entries) < n.size {
+		return
+	}
+	for key := range n.entries {
+		delete(n.entries, key)
+		return
+	}
+}
+
+// forget drops key after a write to it.
+func (n *nearCache) forget(key string) {
+	if n == nil {
+		return
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.writes++
+	delete(n.entries, key)
+}
+
+// forgetTag drops the items carrying tag after it is invalidated.
+func (n *nearCache) forgetTag(tag string) {
+	if n == nil {
+		return
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.writes++
+	for key, entry := range n.entries {
+		for _, itemTag := range entry.item.Tags {
+			if itemTag == tag {
+				delete(n.entries, key)
+				break
+			}
+		}
+	}
+}
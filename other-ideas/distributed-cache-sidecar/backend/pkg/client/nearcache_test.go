@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode serves a one-node topology and items whose value counts the
+// reads that reached it.
+func fakeNode(t *testing.T, item Item) (*httptest.Server, *int32) {
+	var reads int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/topology":
+			json.NewEncoder(w).Encode(Topology{Epoch: "1", Nodes: []Node{{NodeID: "node-a", URL: server.URL, Connected: true}}})
+		case strings.HasPrefix(r.URL.Path, "/api/cache/") && r.Method == http.MethodGet:
+			atomic.AddInt32(&reads, 1)
+			json.NewEncoder(w).Encode(item)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &reads
+}
+
+func TestNearCache(t *testing.T) {
+	soon := time.Now().Add(50 * time.Millisecond)
+	tests := []struct {
+		name string
+		item Item
+		// between runs between the two reads.
+		between   func(c *Client) error
+		wantReads int32
+	}{
+		{"held", Item{Key: "k", Value: "v"}, nil, 1},
+		{"sliding", Item{Key: "k", Value: "v", Sliding: true}, nil, 2},
+		{"read limited", Item{Key: "k", Value: "v", MaxReads: 5}, nil, 2},
+		{"set", Item{Key: "k", Value: "v"}, func(c *Client) error {
+			return c.Set(context.Background(), "k", "w", time.Minute)
+		}, 2},
+		{"deleted", Item{Key: "k", Value: "v"}, func(c *Client) error {
+			return c.Delete(context.Background(), "k")
+		}, 2},
+		{"tag invalidated", Item{Key: "k", Value: "v", Tags: []string{"t"}}, func(c *Client) error {
+			_, err := c.InvalidateTag(context.Background(), "t")
+			return err
+		}, 2},
+		{"other tag invalidated", Item{Key: "k", Value: "v", Tags: []string{"t"}}, func(c *Client) error {
+			_, err := c.InvalidateTag(context.Background(), "u")
+			return err
+		}, 1},
+		{"item expired", Item{Key: "k", Value: "v", ExpiresAt: &soon}, func(c *Client) error {
+			time.Sleep(time.Until(soon))
+			return nil
+		}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, reads := fakeNode(t, test.item)
+			c := New([]string{server.URL}, Options{NearCacheTTL: time.Minute})
+			if _, err := c.Get(context.Background(), "k"); err != nil {
+				t.Fatalf("first Get: %v", err)
+			}
+			if test.between != nil {
+				if err := test.between(c); err != nil {
+					t.Fatalf("between reads: %v", err)
+				}
+			}
+			if _, err := c.Get(context.Background(), "k"); err != nil {
+				t.Fatalf("second Get: %v", err)
+			}
+			if got := atomic.LoadInt32(reads); got != test.wantReads {
+				t.Errorf("node served %d reads, want %d", got, test.wantReads)
+			}
+		})
+	}
+}
+
+func TestNearCacheOff(t *testing.T) {
+	server, reads := fakeNode(t, Item{Key: "k", Value: "v"})
+	c := New([]string{server.URL}, Options{})
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(context.Background(), "k"); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(reads); got != 2 {
+		t.Errorf("node served %d reads, want 2", got)
+	}
+}
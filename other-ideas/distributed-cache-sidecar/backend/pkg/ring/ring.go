@@ -0,0 +1,229 @@
+// Package ring implements the consistent hash ring shared by the sidecar
+// and its client SDK, so both agree on which node owns a key.
+package ring
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultVNodes = 64
+
+// PartSeparator separates a key from the suffix naming one part of a
+// large object stored under it. Keys are placed by what precedes it, so
+// an object's parts are held by the nodes that own the object.
+const PartSeparator = "~part~"
+
+// placementKey is the part of key that decides where it is placed.
+func placementKey(key string) string {
+	if i := strings.Index(key, PartSeparator); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+type point struct {
+	hash uint64
+	node string
+}
+
+type Ring struct {
+	vnodes  int
+	nodes   []string
+	points  []point
+	domains map[string]string
+	// groups and prefixes dedicate keyspace to node groups; see
+	// WithGroups.
+	groups   map[string]string
+	prefixes Prefixes
+}
+
+// Prefixes maps key prefixes to the node group dedicated to the keys that
+// start with them.
+type Prefixes map[string]string
+
+// Group returns the group dedicated to key by the longest prefix it
+// starts with, or "" if any node may hold it.
+func (p Prefixes) Group(key string) string {
+	group, longest := "", -1
+	for prefix, name := range p {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			group, longest = name, len(prefix)
+		}
+	}
+	return group
+}
+
+func New(nodes []string, vnodes int) *Ring {
+	return NewWeighted(nodes, nil, vnodes)
+}
+
+// NewWeighted builds a ring on which each node gets vnodes points scaled by
+// its weight (at least one), so it owns a proportionate share of the
+// keyspace. Nodes missing from weights, or with a weight of zero or less,
+// have weight 1; a ring with every weight 1 is the same as New's.
+func NewWeighted(nodes []string, weights map[string]float64, vnodes int) *Ring {
+	if vnodes <= 0 {
+		vnodes = DefaultVNodes
+	}
+
+	r := &Ring{vnodes: vnodes, nodes: append([]string(nil), nodes...)}
+	sort.Strings(r.nodes)
+	for _, node := range r.nodes {
+		for i := 0; i < Points(vnodes, weights[node]); i++ {
+			r.points = append(r.points, point{hash: Hash(node + "#" + strconv.Itoa(i)), node: node})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].node < r.points[j].node
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// Points is the number of points a node with weight gets on a ring with
+// vnodes points per node.
+func Points(vnodes int, weight float64) int {
+	if weight <= 0 {
+		weight = 1
+	}
+	points := int(math.Round(float64(vnodes) * weight))
+	if points < 1 {
+		points = 1
+	}
+	return points
+}
+
+// Hash is 64-bit FNV-1a followed by the MurmurHash3 finalizer. FNV-1a
+// alone barely changes the high bits between strings that differ only at
+// the end, such as "node#1" and "node#2", which bunched each node's points
+// (and sequential keys) together on the ring.
+func Hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix(h.Sum64())
+}
+
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Owners returns up to n distinct nodes for key in preference order: the
+// owner first, then the replicas to fail over to.
+//
+// On a ring with failure domains, replicas are spread: after the owner,
+// nodes in a domain that already holds a copy are passed over for nodes
+// in a new domain, and only used once every domain has a copy.
+func (r *Ring) Owners(key string, n int) []string {
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+	eligible := r.eligible(key)
+	if n > len(eligible) {
+		n = len(eligible)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	hash := Hash(placementKey(key))
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+
+	owners := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	var passed []string
+	used := make(map[string]bool)
+	for i := 0; len(owners) < n && len(seen) < len(r.nodes) && i < len(r.points); i++ {
+		p := r.points[(start+i)%len(r.points)]
+		if seen[p.node] {
+			continue
+		}
+		seen[p.node] = true
+		if !eligible[p.node] {
+			continue
+		}
+
+		if r.domains != nil {
+			domain := r.domains[p.node]
+			if used[domain] {
+				passed = append(passed, p.node)
+				continue
+			}
+			used[domain] = true
+		}
+		owners = append(owners, p.node)
+	}
+	for _, node := range passed {
+		if len(owners) == n {
+			break
+		}
+		owners = append(owners, node)
+	}
+	return owners
+}
+
+// WithDomains returns a copy of the ring that spreads replicas across the
+// failure domains (zones or regions) given for each node. Nodes missing
+// from domains share the unnamed domain.
+func (r *Ring) WithDomains(domains map[string]string) *Ring {
+	spread := *r
+	spread.domains = make(map[string]string, len(r.nodes))
+	for _, node := range r.nodes {
+		spread.domains[node] = domains[node]
+	}
+	return &spread
+}
+
+// WithGroups returns a copy of the ring on which the keys prefixes
+// dedicate to a group are owned only by the nodes groups puts in it. Those
+// keys are placed as on a ring of the group's nodes alone; other keys may
+// be owned by any node.
+func (r *Ring) WithGroups(groups map[string]string, prefixes Prefixes) *Ring {
+	dedicated := *r
+	dedicated.groups = make(map[string]string, len(r.nodes))
+	for _, node := range r.nodes {
+		dedicated.groups[node] = groups[node]
+	}
+	dedicated.prefixes = prefixes
+	return &dedicated
+}
+
+// eligible returns the nodes that may own key.
+func (r *Ring) eligible(key string) map[string]bool {
+	group := r.prefixes.Group(key)
+	eligible := make(map[string]bool, len(r.nodes))
+	for _, node := range r.nodes {
+		if group == "" || r.groups[node] == group {
+			eligible[node] = true
+		}
+	}
+	return eligible
+}
+
+// Domain returns the failure domain of node, or "" on a ring without
+// domains.
+func (r *Ring) Domain(node string) string {
+	return r.domains[node]
+}
+
+func (r *Ring) Owner(key string) string {
+	owners := r.Owners(key, 1)
+	if len(owners) == 0 {
+		return ""
+	}
+	return owners[0]
+}
@@ -0,0 +1,122 @@
+using System.Text;
+
+namespace DistributedCache.Sidecar;
+
+/// <summary>
+/// Consistent hash ring, identical to backend/pkg/ring so that keys map to
+/// the same owner as in the Go SDK.
+/// </summary>
+public sealed class HashRing
+{
+    public const int DefaultVNodes = 64;
+
+    private const ulong FnvOffset = 0xcbf29ce484222325;
+    private const ulong FnvPrime = 0x100000001b3;
+
+    private readonly ulong[] _hashes;
+    private readonly string[] _owners;
+
+    public IReadOnlyList<string> Nodes { get; }
+
+    public HashRing(IEnumerable<string> nodes, int vnodes = DefaultVNodes)
+        : this(nodes, null, vnodes)
+    {
+    }
+
+    /// <summary>
+    /// A ring on which each node gets vnodes points scaled by its weight, so
+    /// it owns a proportionate share of the keyspace. Nodes without a
+    /// positive weight have weight 1.
+    /// </summary>
+    public HashRing(IEnumerable<string> nodes, IReadOnlyDictionary<string, double>? weights, int vnodes = DefaultVNodes)
+    {
+        if (vnodes <= 0)
+        {
+            vnodes = DefaultVNodes;
+        }
+
+        var sorted = nodes.OrderBy(n => n, StringComparer.Ordinal).ToList();
+        var points = new List<(ulong Hash, string Node)>(sorted.Count * vnodes);
+        foreach (var node in sorted)
+        {
+            var count = Points(vnodes, weights != null && weights.TryGetValue(node, out var weight) ? weight : 1);
+            for (var i = 0; i < count; i++)
+            {
+                points.Add((Hash($"{node}#{i}"), node));
+            }
+        }
+        points.Sort((a, b) => a.Hash != b.Hash ? a.Hash.CompareTo(b.Hash) : string.CompareOrdinal(a.Node, b.Node));
+
+        Nodes = sorted;
+        _hashes = points.Select(p => p.Hash).ToArray();
+        _owners = points.Select(p => p.Node).ToArray();
+    }
+
+    /// <summary>The number of points a node with weight gets; matches ring.Points.</summary>
+    public static int Points(int vnodes, double weight)
+    {
+        if (weight <= 0)
+        {
+            weight = 1;
+        }
+        return Math.Max(1, (int)Math.Round(vnodes * weight, MidpointRounding.AwayFromZero));
+    }
+
+    /// <summary>64-bit FNV-1a followed by the MurmurHash3 finalizer; matches ring.Hash.</summary>
+    public static ulong Hash(string key)
+    {
+        var hash = FnvOffset;
+        foreach (var b in Encoding.UTF8.GetBytes(key))
+        {
+            hash ^= b;
+            hash *= FnvPrime;
+        }
+
+        hash ^= hash >> 33;
+        hash *= 0xff51afd7ed558ccd;
+        hash ^= hash >> 33;
+        hash *= 0xc4ceb9fe1a85ec53;
+        hash ^= hash >> 33;
+        return hash;
+    }
+
+    /// <summary>Up to n distinct nodes for key: the owner first, then replicas.</summary>
+    public IReadOnlyList<string> Owners(string key, int n)
+    {
+        var result = new List<string>();
+        if (_hashes.Length == 0 || n <= 0)
+        {
+            return result;
+        }
+        n = Math.Min(n, Nodes.Count);
+
+        var start = LowerBound(Hash(key));
+        for (var i = 0; i < _hashes.Length && result.Count < n; i++)
+        {
+            var node = _owners[(start + i) % _hashes.Length];
+            if (!result.Contains(node))
+            {
+                result.Add(node);
+            }
+        }
+        return result;
+    }
+
+    private int LowerBound(ulong hash)
+    {
+        int lo = 0, hi = _hashes.Length;
+        while (lo < hi)
+        {
+            var mid = (lo + hi) / 2;
+            if (_hashes[mid] < hash)
+            {
+                lo = mid + 1;
+            }
+            else
+            {
+                hi = mid;
+            }
+        }
+        return lo;
+    }
+}
@@ -0,0 +1,415 @@
+using System.Net;
+using System.Net.Http.Json;
+using System.Text.Json.Serialization;
+
+namespace DistributedCache.Sidecar;
+
+public sealed record CacheItem(
+    [property: JsonPropertyName("key")] string Key,
+    [property: JsonPropertyName("value")] string Value,
+    [property: JsonPropertyName("region")] string Region,
+    [property: JsonPropertyName("node_id")] string NodeId,
+    [property: JsonPropertyName("timestamp")] DateTimeOffset Timestamp,
+    [property: JsonPropertyName("ttl")] long Ttl,
+    [property: JsonPropertyName("encoding")] string? Encoding,
+    [property: JsonPropertyName("metadata")] Dictionary<string, string>? Metadata,
+    [property: JsonPropertyName("version")] ulong Version,
+    [property: JsonPropertyName("sliding")] bool Sliding = false,
+    [property: JsonPropertyName("max_reads")] long MaxReads = 0,
+    [property: JsonPropertyName("expires_at")] DateTimeOffset? ExpiresAt = null);
+
+public sealed record TopologyNode(
+    [property: JsonPropertyName("node_id")] string NodeId,
+    [property: JsonPropertyName("region")] string Region,
+    [property: JsonPropertyName("url")] string Url,
+    [property: JsonPropertyName("connected")] bool Connected,
+    [property: JsonPropertyName("weight")] double Weight = 1);
+
+public sealed record Topology(
+    [property: JsonPropertyName("epoch")] string Epoch,
+    [property: JsonPropertyName("vnodes")] int VNodes,
+    [property: JsonPropertyName("nodes")] List<TopologyNode> Nodes);
+
+public sealed class SidecarClientOptions
+{
+    public HttpClient? HttpClient { get; set; }
+    /// <summary>How often the topology is re-fetched. It is also re-fetched whenever every candidate node for a key fails.</summary>
+    public TimeSpan RefreshInterval { get; set; } = TimeSpan.FromSeconds(30);
+    /// <summary>Bounds how many nodes are tried per operation.</summary>
+    public int MaxAttempts { get; set; } = 3;
+    /// <summary>How long a node is skipped after its first failure; it doubles per consecutive failure up to MaxBackoff.</summary>
+    public TimeSpan BaseBackoff { get; set; } = TimeSpan.FromSeconds(1);
+    public TimeSpan MaxBackoff { get; set; } = TimeSpan.FromSeconds(30);
+    /// <summary>When set, keeps items GetAsync returns in process for up to that long, so repeated reads of a hot key skip the network. Writes through this client drop the key at once; other clients' writes show up when the entry expires.</summary>
+    public TimeSpan NearCacheTtl { get; set; } = TimeSpan.Zero;
+    /// <summary>Bounds the items the near cache holds.</summary>
+    public int NearCacheSize { get; set; } = 10000;
+}
+
+public class CacheKeyNotFoundException : KeyNotFoundException
+{
+    public CacheKeyNotFoundException(string key) : base($"key not found: {key}") { }
+}
+
+/// <summary>
+/// Fetches the cluster topology, hashes keys onto the same ring as the
+/// sidecar and sends each request straight to the key's owner, failing over
+/// to the next nodes on the ring when the owner is unhealthy. Mirrors the Go
+/// SDK in backend/pkg/client.
+/// </summary>
+public sealed class SidecarClient
+{
+    private sealed class RetryableException : Exception
+    {
+        public RetryableException(string message, Exception? inner = null) : base(message, inner) { }
+    }
+
+    private sealed class NodeHealth
+    {
+        public int Failures;
+        public DateTime DownUntil;
+    }
+
+    private sealed record NearEntry(CacheItem Item, DateTimeOffset Expires);
+
+    private readonly string[] _seeds;
+    private readonly SidecarClientOptions _options;
+    private readonly HttpClient _http;
+    private readonly object _lock = new();
+
+    private Topology _topology = new("", 0, new List<TopologyNode>());
+    private HashRing _ring = new(Array.Empty<string>());
+    private Dictionary<string, TopologyNode> _byId = new();
+    private DateTime _fetchedAt = DateTime.MinValue;
+    private readonly Dictionary<string, NodeHealth> _health = new();
+    private readonly Dictionary<string, NearEntry> _near = new();
+    // Counts forgotten keys, so a read that raced a write can tell its
+    // item may predate it and leave it out of the near cache.
+    private ulong _nearWrites;
+
+    public SidecarClient(IEnumerable<string> seeds, SidecarClientOptions? options = null)
+    {
+        _options = options ?? new SidecarClientOptions();
+        _http = _options.HttpClient ?? new HttpClient { Timeout = TimeSpan.FromSeconds(5) };
+        _seeds = seeds.Select(s => s.TrimEnd('/')).ToArray();
+    }
+
+    public Topology Topology
+    {
+        get { lock (_lock) { return _topology; } }
+    }
+
+    /// <summary>Fetches the topology from the first seed or known node that answers.</summary>
+    public async Task RefreshAsync(CancellationToken cancellationToken = default)
+    {
+        List<string> candidates;
+        lock (_lock)
+        {
+            candidates = _seeds.Concat(_topology.Nodes.Select(n => n.Url)).ToList();
+        }
+
+        foreach (var baseUrl in candidates)
+        {
+            Topology? topology;
+            try
+            {
+                topology = await SendAsync<Topology>(HttpMethod.Get, baseUrl + "/api/topology", null, cancellationToken);
+            }
+            catch (Exception) when (!cancellationToken.IsCancellationRequested)
+            {
+                continue;
+            }
+            if (topology is null)
+            {
+                continue;
+            }
+
+            lock (_lock)
+            {
+                if (topology.Epoch != _topology.Epoch)
+                {
+                    _ring = new HashRing(topology.Nodes.Select(n => n.NodeId), topology.Nodes.ToDictionary(n => n.NodeId, n => n.Weight), topology.VNodes);
+                }
+                _topology = topology;
+                _byId = topology.Nodes.ToDictionary(n => n.NodeId);
+                _fetchedAt = DateTime.UtcNow;
+            }
+            return;
+        }
+        throw new InvalidOperationException("failed to fetch topology from any seed");
+    }
+
+    /// <summary>The nodes that would be tried for key, in order.</summary>
+    public IReadOnlyList<TopologyNode> Owners(string key)
+    {
+        lock (_lock)
+        {
+            return _ring.Owners(key, _topology.Nodes.Count).Select(id => _byId[id]).ToList();
+        }
+    }
+
+    public async Task<CacheItem?> GetAsync(string key, CancellationToken cancellationToken = default)
+    {
+        ulong generation;
+        lock (_lock)
+        {
+            if (_near.TryGetValue(key, out var entry))
+            {
+                if (DateTimeOffset.UtcNow < entry.Expires)
+                {
+                    return entry.Item;
+                }
+                _near.Remove(key);
+            }
+            generation = _nearWrites;
+        }
+
+        var item = await DoAsync(key, baseUrl => SendAsync<CacheItem>(HttpMethod.Get, ItemUrl(baseUrl, key), null, cancellationToken), cancellationToken);
+        if (item is not null)
+        {
+            Remember(key, item, generation);
+        }
+        return item;
+    }
+
+    public async Task SetAsync(string key, string value, TimeSpan ttl = default, CancellationToken cancellationToken = default)
+    {
+        var body = new Dictionary<string, object> { ["value"] = value, ["ttl"] = (long)ttl.TotalSeconds };
+        try
+        {
+            await DoAsync(key, baseUrl => SendAsync<object>(HttpMethod.Post, ItemUrl(baseUrl, key), body, cancellationToken), cancellationToken);
+        }
+        finally
+        {
+            Forget(key);
+        }
+    }
+
+    public async Task DeleteAsync(string key, CancellationToken cancellationToken = default)
+    {
+        try
+        {
+            await DoAsync(key, baseUrl => SendAsync<object>(HttpMethod.Delete, ItemUrl(baseUrl, key), null, cancellationToken), cancellationToken);
+        }
+        finally
+        {
+            Forget(key);
+        }
+    }
+
+    // Holds item in the near cache until its TTL or the item's own expiry,
+    // whichever is sooner, unless a key was forgotten since generation.
+    // Sliding and read-limited items change on the node when read, so they
+    // are never held.
+    private void Remember(string key, CacheItem item, ulong generation)
+    {
+        if (_options.NearCacheTtl <= TimeSpan.Zero || item.Sliding || item.MaxReads > 0)
+        {
+            return;
+        }
+        var now = DateTimeOffset.UtcNow;
+        var expires = now + _options.NearCacheTtl;
+        if (item.ExpiresAt is { } itemExpires && itemExpires < expires)
+        {
+            expires = itemExpires;
+        }
+
+        lock (_lock)
+        {
+            if (_nearWrites != generation)
+            {
+                return;
+            }
+            if (!_near.ContainsKey(key) && _near.Count >= _options.NearCacheSize)
+            {
+                foreach (var expired in _near.Where(e => now >= e.Value.Expires).Select(e => e.Key).ToList())
+                {
+                    _near.Remove(expired);
+                }
+                if (_near.Count >= _options.NearCacheSize)
+                {
+                    _near.Remove(_near.Keys.First());
+                }
+            }
+            _near[key] = new NearEntry(item, expires);
+        }
+    }
+
+    private void Forget(string key)
+    {
+        lock (_lock)
+        {
+            _nearWrites++;
+            _near.Remove(key);
+        }
+    }
+
+    // Runs call against the key's owner and then its replicas until one
+    // succeeds or throws a non-retryable error. Nodes in backoff are tried
+    // last rather than skipped, so a fully degraded cluster is still usable.
+    private async Task<T?> DoAsync<T>(string key, Func<string, Task<T?>> call, CancellationToken cancellationToken)
+    {
+        bool stale, empty;
+        lock (_lock)
+        {
+            stale = DateTime.UtcNow - _fetchedAt > _options.RefreshInterval;
+            empty = _topology.Nodes.Count == 0;
+        }
+        if (stale)
+        {
+            try
+            {
+                await RefreshAsync(cancellationToken);
+            }
+            catch (InvalidOperationException) when (!empty)
+            {
+            }
+        }
+
+        Exception lastError = new InvalidOperationException("no reachable cache nodes");
+        for (var round = 0; round < 2; round++)
+        {
+            foreach (var node in Candidates(key).Take(_options.MaxAttempts))
+            {
+                try
+                {
+                    var result = await call(node.Url);
+                    MarkHealthy(node.NodeId);
+                    return result;
+                }
+                catch (RetryableException e)
+                {
+                    MarkFailed(node.NodeId);
+                    lastError = e;
+                }
+                catch (CacheKeyNotFoundException)
+                {
+                    MarkHealthy(node.NodeId);
+                    throw;
+                }
+            }
+
+            // Every candidate failed: the topology may have changed.
+            if (round == 0)
+            {
+                try
+                {
+                    await RefreshAsync(cancellationToken);
+                }
+                catch (InvalidOperationException)
+                {
+                    break;
+                }
+            }
+        }
+        throw lastError;
+    }
+
+    private List<TopologyNode> Candidates(string key)
+    {
+        var owners = Owners(key);
+        var now = DateTime.UtcNow;
+        lock (_lock)
+        {
+            var healthy = new List<TopologyNode>();
+            var down = new List<TopologyNode>();
+            foreach (var node in owners)
+            {
+                if (_health.TryGetValue(node.NodeId, out var h) && now < h.DownUntil)
+                {
+                    down.Add(node);
+                }
+                else
+                {
+                    healthy.Add(node);
+                }
+            }
+            healthy.AddRange(down);
+            return healthy;
+        }
+    }
+
+    private void MarkHealthy(string nodeId)
+    {
+        lock (_lock)
+        {
+            _health.Remove(nodeId);
+        }
+    }
+
+    private void MarkFailed(string nodeId)
+    {
+        lock (_lock)
+        {
+            if (!_health.TryGetValue(nodeId, out var h))
+            {
+                h = new NodeHealth();
+                _health[nodeId] = h;
+            }
+            h.Failures++;
+
+            var backoff = _options.BaseBackoff;
+            for (var i = 1; i < h.Failures && backoff < _options.MaxBackoff; i++)
+            {
+                backoff *= 2;
+            }
+            if (backoff > _options.MaxBackoff)
+            {
+                backoff = _options.MaxBackoff;
+            }
+            h.DownUntil = DateTime.UtcNow + backoff;
+        }
+    }
+
+    // Transport errors and 5xx responses are retryable on another node;
+    // other failures are not.
+    private async Task<T?> SendAsync<T>(HttpMethod method, string url, object? body, CancellationToken cancellationToken)
+    {
+        using var request = new HttpRequestMessage(method, url);
+        if (body is not null)
+        {
+            request.Content = JsonContent.Create(body);
+        }
+
+        HttpResponseMessage response;
+        try
+        {
+            response = await _http.SendAsync(request, cancellationToken);
+        }
+        catch (HttpRequestException e)
+        {
+            throw new RetryableException(e.Message, e);
+        }
+        catch (TaskCanceledException e) when (!cancellationToken.IsCancellationRequested)
+        {
+            throw new RetryableException("request timed out", e);
+        }
+
+        using (response)
+        {
+            var status = (int)response.StatusCode;
+            if (response.StatusCode == HttpStatusCode.NotFound)
+            {
+                throw new CacheKeyNotFoundException(url);
+            }
+            if (status >= 300)
+            {
+                var detail = (await response.Content.ReadAsStringAsync(cancellationToken)).Trim();
+                var message = $"{status} {response.ReasonPhrase}: {detail}";
+                if (status >= 500)
+                {
+                    throw new RetryableException(message);
+                }
+                throw new HttpRequestException(message, null, response.StatusCode);
+            }
+
+            if (typeof(T) == typeof(object))
+            {
+                return default;
+            }
+            return await response.Content.ReadFromJsonAsync<T>(cancellationToken: cancellationToken);
+        }
+    }
+
+    private static string ItemUrl(string baseUrl, string key) => baseUrl + "/api/cache/" + Uri.EscapeDataString(key);
+}
@@ -0,0 +1,24 @@
+#!/bin/sh
+# Generates low-level .NET and Python API clients from the sidecar's OpenAPI
+# definition, for the endpoints the hand-written SidecarClient wrappers in
+# dotnet/ and python/ don't cover. The output isn't checked in. The wrappers
+# don't depend on it, so regenerating never breaks them.
+set -e
+
+cd "$(dirname "$0")"
+SPEC=../backend/api/openapi.yaml
+GENERATOR=${OPENAPI_GENERATOR_IMAGE:-openapitools/openapi-generator-cli:v7.4.0}
+
+docker run --rm -u "$(id -u):$(id -g)" -v "$PWD/..:/local" "$GENERATOR" generate \
+  -i /local/backend/api/openapi.yaml \
+  -g csharp \
+  -o /local/sdk/dotnet/generated \
+  --additional-properties=packageName=DistributedCache.Sidecar.Api,targetFramework=net8.0
+
+docker run --rm -u "$(id -u):$(id -g)" -v "$PWD/..:/local" "$GENERATOR" generate \
+  -i /local/backend/api/openapi.yaml \
+  -g python \
+  -o /local/sdk/python/generated \
+  --additional-properties=packageName=sidecar_api
+
+echo "Generated clients from $SPEC"
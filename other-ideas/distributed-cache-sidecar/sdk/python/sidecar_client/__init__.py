@@ -0,0 +1,4 @@
+from .client import NoNodesError, NotFoundError, SidecarClient
+from .ring import Ring
+
+__all__ = ["SidecarClient", "Ring", "NotFoundError", "NoNodesError"]
@@ -0,0 +1,204 @@
+"""Topology-aware client with the same routing and failover behaviour as
+the Go SDK in backend/pkg/client."""
+
+import json
+import threading
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+
+from .ring import Ring
+
+
+class NotFoundError(KeyError):
+    pass
+
+
+class NoNodesError(RuntimeError):
+    pass
+
+
+class _Retryable(Exception):
+    pass
+
+
+class SidecarClient:
+    def __init__(self, seeds, timeout=5.0, refresh_interval=30.0, max_attempts=3,
+                 base_backoff=1.0, max_backoff=30.0, near_cache_ttl=0.0, near_cache_size=10000):
+        """near_cache_ttl, when set, keeps items get returns in process for up
+        to that many seconds, so repeated reads of a hot key skip the network.
+        Writes through this client drop the key at once; other clients' writes
+        show up when the entry expires."""
+        self.seeds = [s.rstrip("/") for s in seeds]
+        self.timeout = timeout
+        self.refresh_interval = refresh_interval
+        self.max_attempts = max_attempts
+        self.base_backoff = base_backoff
+        self.max_backoff = max_backoff
+        self.near_cache_ttl = near_cache_ttl
+        self.near_cache_size = near_cache_size
+
+        self._lock = threading.Lock()
+        self._topology = {"epoch": "", "vnodes": 0, "nodes": []}
+        self._ring = Ring([])
+        self._by_id = {}
+        self._fetched_at = 0.0
+        self._health = {}
+        self._near = {}
+        # Counts forgotten keys, so a read that raced a write can tell its
+        # item may predate it and leave it out of the near cache.
+        self._near_writes = 0
+
+    def refresh(self):
+        """Fetch the topology from the first seed or known node that answers."""
+        with self._lock:
+            candidates = self.seeds + [n["url"] for n in self._topology["nodes"]]
+        for base in candidates:
+            try:
+                topology = self._send("GET", base + "/api/topology")
+            except Exception:
+                continue
+            nodes = topology.get("nodes") or []
+            with self._lock:
+                if topology.get("epoch") != self._topology["epoch"]:
+                    self._ring = Ring([n["node_id"] for n in nodes], topology.get("vnodes", 0),
+                                      {n["node_id"]: n.get("weight", 1) for n in nodes})
+                self._topology = topology
+                self._by_id = {n["node_id"]: n for n in nodes}
+                self._fetched_at = time.monotonic()
+            return
+        raise NoNodesError("failed to fetch topology from any seed")
+
+    def owners(self, key):
+        with self._lock:
+            ids = self._ring.owners(key, len(self._topology["nodes"]))
+            return [self._by_id[i] for i in ids]
+
+    def get(self, key):
+        with self._lock:
+            entry = self._near.get(key)
+            if entry is not None:
+                if time.monotonic() < entry[1]:
+                    return dict(entry[0])
+                del self._near[key]
+            generation = self._near_writes
+        item = self._do(key, lambda base: self._send("GET", _item_url(base, key)))
+        self._remember(key, item, generation)
+        return item
+
+    def set(self, key, value, ttl_seconds=0):
+        body = {"value": value, "ttl": int(ttl_seconds)}
+        try:
+            self._do(key, lambda base: self._send("POST", _item_url(base, key), body))
+        finally:
+            self._forget(key)
+
+    def delete(self, key):
+        try:
+            self._do(key, lambda base: self._send("DELETE", _item_url(base, key)))
+        finally:
+            self._forget(key)
+
+    def _remember(self, key, item, generation):
+        """Hold item in the near cache until its TTL or the item's own expiry,
+        whichever is sooner, unless a key was forgotten since generation.
+        Sliding and read-limited items change on the node when read, so they
+        are never held."""
+        if self.near_cache_ttl <= 0 or not item or item.get("sliding") or item.get("max_reads"):
+            return
+        now = time.monotonic()
+        expires = now + self.near_cache_ttl
+        if item.get("expires_at"):
+            expires = min(expires, now + item.get("remaining_ttl", 0))
+        with self._lock:
+            if self._near_writes != generation:
+                return
+            if key not in self._near and len(self._near) >= self.near_cache_size:
+                for expired in [k for k, e in self._near.items() if now >= e[1]]:
+                    del self._near[expired]
+                if len(self._near) >= self.near_cache_size:
+                    del self._near[next(iter(self._near))]
+            self._near[key] = (dict(item), expires)
+
+    def _forget(self, key):
+        with self._lock:
+            self._near_writes += 1
+            self._near.pop(key, None)
+
+    def _do(self, key, call):
+        with self._lock:
+            stale = time.monotonic() - self._fetched_at > self.refresh_interval
+            empty = not self._topology["nodes"]
+        if stale:
+            try:
+                self.refresh()
+            except NoNodesError:
+                if empty:
+                    raise
+
+        last_error = NoNodesError("no reachable cache nodes")
+        for round_ in range(2):
+            for node in self._candidates(key)[: self.max_attempts]:
+                try:
+                    result = call(node["url"])
+                except _Retryable as e:
+                    self._mark_failed(node["node_id"])
+                    last_error = e
+                    continue
+                except Exception:
+                    self._mark_healthy(node["node_id"])
+                    raise
+                self._mark_healthy(node["node_id"])
+                return result
+            # Every candidate failed: the topology may have changed.
+            if round_ == 0:
+                try:
+                    self.refresh()
+                except NoNodesError:
+                    break
+        raise last_error
+
+    def _candidates(self, key):
+        now = time.monotonic()
+        healthy, down = [], []
+        for node in self.owners(key):
+            h = self._health.get(node["node_id"])
+            (down if h and now < h["down_until"] else healthy).append(node)
+        return healthy + down
+
+    def _mark_healthy(self, node_id):
+        with self._lock:
+            self._health.pop(node_id, None)
+
+    def _mark_failed(self, node_id):
+        with self._lock:
+            h = self._health.setdefault(node_id, {"failures": 0, "down_until": 0.0})
+            h["failures"] += 1
+            backoff = min(self.base_backoff * 2 ** (h["failures"] - 1), self.max_backoff)
+            h["down_until"] = time.monotonic() + backoff
+
+    def _send(self, method, url, body=None):
+        data = None
+        headers = {}
+        if body is not None:
+            data = json.dumps(body).encode("utf-8")
+            headers["Content-Type"] = "application/json"
+        request = urllib.request.Request(url, data=data, method=method, headers=headers)
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                payload = response.read()
+        except urllib.error.HTTPError as e:
+            detail = e.read(1024).decode("utf-8", "replace").strip()
+            if e.code == 404:
+                raise NotFoundError(url) from None
+            if e.code >= 500:
+                raise _Retryable(f"{e.code}: {detail}") from None
+            raise RuntimeError(f"{e.code}: {detail}") from None
+        except (urllib.error.URLError, OSError) as e:
+            raise _Retryable(str(e)) from None
+        return json.loads(payload) if payload else None
+
+
+def _item_url(base, key):
+    return base + "/api/cache/" + urllib.parse.quote(key, safe="")
@@ -0,0 +1,64 @@
+"""Consistent hash ring, identical to backend/pkg/ring so that keys map to
+the same owner as in the Go SDK."""
+
+import bisect
+import math
+
+DEFAULT_VNODES = 64
+
+_FNV_OFFSET = 0xCBF29CE484222325
+_FNV_PRIME = 0x100000001B3
+_MASK = 0xFFFFFFFFFFFFFFFF
+
+
+def fnv1a64(data: str) -> int:
+    """64-bit FNV-1a followed by the MurmurHash3 finalizer; matches ring.Hash."""
+    h = _FNV_OFFSET
+    for byte in data.encode("utf-8"):
+        h ^= byte
+        h = (h * _FNV_PRIME) & _MASK
+    h ^= h >> 33
+    h = (h * 0xFF51AFD7ED558CCD) & _MASK
+    h ^= h >> 33
+    h = (h * 0xC4CEB9FE1A85EC53) & _MASK
+    h ^= h >> 33
+    return h
+
+
+def points_for(vnodes: int, weight: float) -> int:
+    """The number of points a node with weight gets; matches ring.Points."""
+    if not weight or weight <= 0:
+        weight = 1
+    return max(1, math.floor(vnodes * weight + 0.5))
+
+
+class Ring:
+    def __init__(self, nodes, vnodes=DEFAULT_VNODES, weights=None):
+        """Each node gets vnodes points scaled by its weight in weights, so it
+        owns a proportionate share of the keyspace; the default weight is 1."""
+        if vnodes <= 0:
+            vnodes = DEFAULT_VNODES
+        weights = weights or {}
+        self.nodes = sorted(nodes)
+        points = []
+        for node in self.nodes:
+            for i in range(points_for(vnodes, weights.get(node, 1))):
+                points.append((fnv1a64(f"{node}#{i}"), node))
+        points.sort()
+        self._hashes = [p[0] for p in points]
+        self._owners = [p[1] for p in points]
+
+    def owners(self, key: str, n: int):
+        """Up to n distinct nodes for key: the owner first, then replicas."""
+        if not self._hashes or n <= 0:
+            return []
+        n = min(n, len(self.nodes))
+        start = bisect.bisect_left(self._hashes, fnv1a64(key))
+        result = []
+        for i in range(len(self._hashes)):
+            node = self._owners[(start + i) % len(self._hashes)]
+            if node not in result:
+                result.append(node)
+                if len(result) == n:
+                    break
+        return result